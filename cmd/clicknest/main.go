@@ -5,7 +5,10 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"strings"
+	_ "time/tzdata" // project timezones must load on hosts without zoneinfo
 
+	"github.com/danielthedm/clicknest/internal/ratelimit"
 	"github.com/danielthedm/clicknest/pkg/bootstrap"
 )
 
@@ -13,7 +16,18 @@ func main() {
 	addr := flag.String("addr", ":8080", "listen address")
 	dataDir := flag.String("data", "./data", "data directory for databases")
 	devMode := flag.Bool("dev", false, "enable development mode")
+	readConns := flag.Int("read-conns", 0, "size of a separate DuckDB read connection pool (0 = share the writer)")
+	metaURL := flag.String("meta-url", os.Getenv("CLICKNEST_META_URL"), "postgres:// URL for the metadata store (default: SQLite in the data directory)")
+	frontendOrigin := flag.String("frontend-origin", os.Getenv("CLICKNEST_FRONTEND_ORIGIN"), "origin of a separately hosted dashboard, e.g. https://app.example.com")
+	sdkOrigins := flag.String("sdk-origins", os.Getenv("CLICKNEST_SDK_ORIGINS"), "comma-separated origins allowed to call the SDK and ingestion routes cross-origin (default: any)")
+	ingestPath := flag.String("ingest-path", os.Getenv("CLICKNEST_INGEST_PATH"), "extra path for SDK event ingestion, e.g. /t/collect (in addition to /api/v1/events)")
+	ingestRate := flag.Float64("ingest-rate", 0, "sustained ingest requests (event batches) per second accepted per project (0 = 10)")
+	ingestBurst := flag.Int("ingest-burst", 0, "ingest requests per project accepted in a burst above the sustained rate (0 = 50)")
+	maxLimit := flag.Int("max-limit", 0, "largest limit a client may request from list endpoints (0 = 1000)")
+	logRepeat := flag.Duration("log-repeat-interval", ratelimit.DefaultLogInterval, "log a repetitive warning (naming failures, unreadable events) at most once per key per interval (0 = log every one)")
+	insecurePerms := flag.Bool("insecure-perms", false, "start even if the encryption key file is readable by other users")
 	flag.Parse()
+	ratelimit.Warnings.SetInterval(*logRepeat)
 
 	// Prepare embedded filesystems.
 	var webFS fs.FS
@@ -31,19 +45,39 @@ func main() {
 	}
 
 	app := bootstrap.Setup(bootstrap.Config{
-		Addr:            *addr,
-		DataDir:         *dataDir,
-		DevMode:         *devMode,
-		WebFS:           webFS,
-		SDKJS:           sdkJS,
-		CloudMode:       os.Getenv("CLICKNEST_CLOUD") == "true",
-		ControlPlaneURL: os.Getenv("CONTROL_PLANE_URL"),
-		InstanceID:      os.Getenv("INSTANCE_ID"),
-		InstanceSecret:  os.Getenv("INSTANCE_SECRET"),
-		Version:         "0.4.0",
+		Addr:                *addr,
+		DataDir:             *dataDir,
+		DevMode:             *devMode,
+		WebFS:               webFS,
+		SDKJS:               sdkJS,
+		CloudMode:           os.Getenv("CLICKNEST_CLOUD") == "true",
+		FrontendOrigin:      *frontendOrigin,
+		IngestPath:          *ingestPath,
+		SDKOrigins:          splitList(*sdkOrigins),
+		ControlPlaneURL:     os.Getenv("CONTROL_PLANE_URL"),
+		InstanceID:          os.Getenv("INSTANCE_ID"),
+		InstanceSecret:      os.Getenv("INSTANCE_SECRET"),
+		DuckDBReadConns:     *readConns,
+		MaxResultLimit:      *maxLimit,
+		RatePerSecond:       *ingestRate,
+		RateBurst:           *ingestBurst,
+		MetaURL:             *metaURL,
+		InsecurePermissions: *insecurePerms,
+		Version:             "0.4.0",
 	})
 	defer app.Close()
 
 	log.Printf("ClickNest started on %s (dev=%v, data=%s)", *addr, *devMode, *dataDir)
 	app.Run()
 }
+
+// splitList parses a comma-separated flag value, dropping empty entries.
+func splitList(v string) []string {
+	var out []string
+	for item := range strings.SplitSeq(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, strings.TrimRight(item, "/"))
+		}
+	}
+	return out
+}
@@ -40,7 +40,7 @@ func (a *Anthropic) GenerateEventName(ctx context.Context, req NamingRequest) (*
 	body := map[string]any{
 		"model":      a.model,
 		"max_tokens": 100,
-		"system":     systemPrompt,
+		"system":     systemPromptFor(req.Style),
 		"messages": []map[string]string{
 			{"role": "user", "content": prompt},
 		},
@@ -19,25 +19,33 @@ func NewCache(meta *storage.SQLite) *Cache {
 }
 
 // Get returns the display name for a fingerprint, or empty string if not cached.
-// User overrides take priority over AI-generated names.
+// User overrides take priority over AI-generated names. A name awaiting review
+// (or rejected) reports ok with an empty name, so it isn't generated again.
 func (c *Cache) Get(ctx context.Context, projectID, fingerprint string) (string, bool) {
 	en, err := c.meta.GetEventName(ctx, projectID, fingerprint)
 	if errors.Is(err, sql.ErrNoRows) || err != nil {
 		return "", false
 	}
-	if en.UserName != nil && *en.UserName != "" {
-		return *en.UserName, true
-	}
-	return en.AIName, true
+	return en.DisplayName(), true
 }
 
-// Set stores an AI-generated event name in the cache.
+// Set stores an approved AI-generated event name in the cache.
 func (c *Cache) Set(ctx context.Context, projectID, fingerprint string, result *NamingResult) error {
+	return c.set(ctx, projectID, fingerprint, result, storage.NameApproved)
+}
+
+// SetPending stores an AI-generated name that must be approved before use.
+func (c *Cache) SetPending(ctx context.Context, projectID, fingerprint string, result *NamingResult) error {
+	return c.set(ctx, projectID, fingerprint, result, storage.NamePending)
+}
+
+func (c *Cache) set(ctx context.Context, projectID, fingerprint string, result *NamingResult, status string) error {
 	return c.meta.SetEventName(ctx, storage.EventName{
 		Fingerprint: fingerprint,
 		ProjectID:   projectID,
 		AIName:      result.Name,
 		SourceFile:  &result.SourceFile,
 		Confidence:  &result.Confidence,
+		Status:      status,
 	})
 }
@@ -1,9 +1,11 @@
 package ai
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -32,7 +34,232 @@ func ChatWithHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg stri
 	}
 }
 
+// ChatDelta is one piece of a streamed chat reply. A stream that fails
+// partway ends with a delta carrying Err instead of text.
+type ChatDelta struct {
+	Text string
+	Err  error
+}
+
+// ChatWithHistoryStream is ChatWithHistory with the reply sent over the
+// channel as the provider generates it; the channel closes when the reply
+// ends. A provider or model that rejects streaming gets the buffered request
+// instead, its reply sent as a single delta. Errors before any text arrives
+// are returned directly.
+func ChatWithHistoryStream(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage) (<-chan ChatDelta, error) {
+	var req *http.Request
+	var err error
+	var parse func(io.Reader, func(string) bool) error
+	switch cfg.Provider {
+	case "openai":
+		req, err = openaiChatRequest(ctx, cfg, systemMsg, history, true)
+		parse = parseOpenAIStream
+	case "anthropic":
+		req, err = anthropicChatRequest(ctx, cfg, systemMsg, history, true)
+		parse = parseAnthropicStream
+	case "ollama":
+		req, err = ollamaChatRequest(ctx, cfg, systemMsg, history, true)
+		parse = parseOllamaStream
+	default:
+		return nil, fmt.Errorf("unsupported provider: %s", cfg.Provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling %s: %w", cfg.Provider, err)
+	}
+	if resp.StatusCode != 200 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if !streamRejected(resp.StatusCode) {
+			return nil, fmt.Errorf("%s returned %d: %s", cfg.Provider, resp.StatusCode, string(respBody))
+		}
+		reply, err := ChatWithHistory(ctx, cfg, systemMsg, history)
+		if err != nil {
+			return nil, err
+		}
+		ch := make(chan ChatDelta, 1)
+		ch <- ChatDelta{Text: reply}
+		close(ch)
+		return ch, nil
+	}
+
+	ch := make(chan ChatDelta)
+	go func() {
+		defer close(ch)
+		defer resp.Body.Close()
+		send := func(d ChatDelta) bool {
+			select {
+			case ch <- d:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		err := parse(resp.Body, func(text string) bool { return send(ChatDelta{Text: text}) })
+		if err != nil && ctx.Err() == nil {
+			send(ChatDelta{Err: fmt.Errorf("reading %s stream: %w", cfg.Provider, err)})
+		}
+	}()
+	return ch, nil
+}
+
+// streamRejected reports whether a status means the provider refused the
+// request because it asked to stream, rather than failing outright: bad
+// request or unsupported, not auth, rate limit or server errors.
+func streamRejected(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusUnprocessableEntity, http.StatusNotImplemented:
+		return true
+	}
+	return false
+}
+
+// scanLines calls fn with each line of r until fn returns false.
+func scanLines(r io.Reader, fn func(line string) (bool, error)) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for sc.Scan() {
+		more, err := fn(sc.Text())
+		if err != nil || !more {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// parseOpenAIStream reads chat completion chunks from an OpenAI SSE stream.
+func parseOpenAIStream(r io.Reader, emit func(string) bool) error {
+	return scanLines(r, func(line string) (bool, error) {
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			return true, nil
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			return false, nil
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return false, fmt.Errorf("parsing chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return false, errors.New(chunk.Error.Message)
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			return emit(chunk.Choices[0].Delta.Content), nil
+		}
+		return true, nil
+	})
+}
+
+// parseAnthropicStream reads text deltas from an Anthropic messages SSE
+// stream.
+func parseAnthropicStream(r io.Reader, emit func(string) bool) error {
+	return scanLines(r, func(line string) (bool, error) {
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			return true, nil
+		}
+		var ev struct {
+			Type  string `json:"type"`
+			Delta struct {
+				Type string `json:"type"`
+				Text string `json:"text"`
+			} `json:"delta"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &ev); err != nil {
+			return false, fmt.Errorf("parsing event: %w", err)
+		}
+		switch ev.Type {
+		case "content_block_delta":
+			if ev.Delta.Type == "text_delta" && ev.Delta.Text != "" {
+				return emit(ev.Delta.Text), nil
+			}
+		case "message_stop":
+			return false, nil
+		case "error":
+			return false, errors.New(ev.Error.Message)
+		}
+		return true, nil
+	})
+}
+
+// parseOllamaStream reads the newline-delimited JSON Ollama streams.
+func parseOllamaStream(r io.Reader, emit func(string) bool) error {
+	return scanLines(r, func(line string) (bool, error) {
+		if strings.TrimSpace(line) == "" {
+			return true, nil
+		}
+		var chunk struct {
+			Response string `json:"response"`
+			Done     bool   `json:"done"`
+			Error    string `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return false, fmt.Errorf("parsing chunk: %w", err)
+		}
+		if chunk.Error != "" {
+			return false, errors.New(chunk.Error)
+		}
+		if chunk.Response != "" && !emit(chunk.Response) {
+			return false, nil
+		}
+		return !chunk.Done, nil
+	})
+}
+
 func openaiChatHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage) (string, error) {
+	req, err := openaiChatRequest(ctx, cfg, systemMsg, history, false)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("calling openai: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("reading openai response: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("openai returned %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return "", fmt.Errorf("parsing response: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("no choices in response")
+	}
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
+
+func openaiChatRequest(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage, stream bool) (*http.Request, error) {
 	apiKey := ""
 	if cfg.APIKey != nil {
 		apiKey = *cfg.APIKey
@@ -56,46 +283,53 @@ func openaiChatHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg st
 		"messages":    messages,
 		"temperature": 0.5,
 		"max_tokens":  1200,
+		"stream":      stream,
 	}
 
 	jsonBody, _ := json.Marshal(body)
 	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/chat/completions", bytes.NewReader(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+apiKey)
+	return req, nil
+}
+
+func anthropicChatHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage) (string, error) {
+	req, err := anthropicChatRequest(ctx, cfg, systemMsg, history, false)
+	if err != nil {
+		return "", err
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("calling openai: %w", err)
+		return "", fmt.Errorf("calling anthropic: %w", err)
 	}
 	defer resp.Body.Close()
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("reading openai response: %w", err)
+		return "", fmt.Errorf("reading anthropic response: %w", err)
 	}
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("openai returned %d: %s", resp.StatusCode, string(respBody))
+		return "", fmt.Errorf("anthropic returned %d: %s", resp.StatusCode, string(respBody))
 	}
 
 	var result struct {
-		Choices []struct {
-			Message struct {
-				Content string `json:"content"`
-			} `json:"message"`
-		} `json:"choices"`
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
 	}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		return "", fmt.Errorf("parsing response: %w", err)
 	}
-	if len(result.Choices) == 0 {
-		return "", fmt.Errorf("no choices in response")
+	if len(result.Content) == 0 {
+		return "", fmt.Errorf("no content in response")
 	}
-	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+	return strings.TrimSpace(result.Content[0].Text), nil
 }
 
-func anthropicChatHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage) (string, error) {
+func anthropicChatRequest(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage, stream bool) (*http.Request, error) {
 	apiKey := ""
 	if cfg.APIKey != nil {
 		apiKey = *cfg.APIKey
@@ -119,45 +353,49 @@ func anthropicChatHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg
 		"max_tokens": 1200,
 		"system":     systemMsg,
 		"messages":   messages,
+		"stream":     stream,
 	}
 
 	jsonBody, _ := json.Marshal(body)
 	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/v1/messages", bytes.NewReader(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("x-api-key", apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
+	return req, nil
+}
+
+func ollamaChatHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage) (string, error) {
+	req, err := ollamaChatRequest(ctx, cfg, systemMsg, history, false)
+	if err != nil {
+		return "", err
+	}
 
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("calling anthropic: %w", err)
+		return "", fmt.Errorf("calling ollama: %w", err)
 	}
 	defer resp.Body.Close()
 	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("reading anthropic response: %w", err)
+		return "", fmt.Errorf("reading ollama response: %w", err)
 	}
 	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("anthropic returned %d: %s", resp.StatusCode, string(respBody))
+		return "", fmt.Errorf("ollama returned %d: %s", resp.StatusCode, string(respBody))
 	}
 
 	var result struct {
-		Content []struct {
-			Text string `json:"text"`
-		} `json:"content"`
+		Response string `json:"response"`
 	}
 	if err := json.Unmarshal(respBody, &result); err != nil {
 		return "", fmt.Errorf("parsing response: %w", err)
 	}
-	if len(result.Content) == 0 {
-		return "", fmt.Errorf("no content in response")
-	}
-	return strings.TrimSpace(result.Content[0].Text), nil
+	return strings.TrimSpace(result.Response), nil
 }
 
-func ollamaChatHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage) (string, error) {
+func ollamaChatRequest(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage, stream bool) (*http.Request, error) {
 	model := cfg.Model
 	if model == "" {
 		model = "llama3"
@@ -183,7 +421,7 @@ func ollamaChatHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg st
 	body := map[string]any{
 		"model":  model,
 		"prompt": sb.String(),
-		"stream": false,
+		"stream": stream,
 		"options": map[string]any{
 			"temperature": 0.5,
 			"num_predict": 1200,
@@ -193,28 +431,8 @@ func ollamaChatHistory(ctx context.Context, cfg *storage.LLMConfig, systemMsg st
 	jsonBody, _ := json.Marshal(body)
 	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/api/generate", bytes.NewReader(jsonBody))
 	if err != nil {
-		return "", fmt.Errorf("creating request: %w", err)
+		return nil, fmt.Errorf("creating request: %w", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("calling ollama: %w", err)
-	}
-	defer resp.Body.Close()
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("reading ollama response: %w", err)
-	}
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("ollama returned %d: %s", resp.StatusCode, string(respBody))
-	}
-
-	var result struct {
-		Response string `json:"response"`
-	}
-	if err := json.Unmarshal(respBody, &result); err != nil {
-		return "", fmt.Errorf("parsing response: %w", err)
-	}
-	return strings.TrimSpace(result.Response), nil
+	return req, nil
 }
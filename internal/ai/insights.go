@@ -0,0 +1,83 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// Insight is one notable finding the LLM surfaced from an analytics snapshot.
+type Insight struct {
+	Kind     string `json:"kind"`     // spike, drop, funnel_dropoff, trend or other
+	Severity string `json:"severity"` // info, warning or critical
+	Title    string `json:"title"`
+	Detail   string `json:"detail"`
+	Metric   string `json:"metric,omitempty"` // the event, page or funnel it concerns
+}
+
+// maxInsights caps the findings kept from one response.
+const maxInsights = 10
+
+var (
+	insightKinds      = []string{"spike", "drop", "funnel_dropoff", "trend", "other"}
+	insightSeverities = []string{"info", "warning", "critical"}
+)
+
+// GenerateInsights asks the LLM for notable findings in snapshot, a plain
+// text summary of the project's recent analytics.
+func GenerateInsights(ctx context.Context, cfg *storage.LLMConfig, snapshot string) ([]Insight, error) {
+	systemMsg := `You are a senior product analyst reviewing a product's analytics. Proactively point out what the team should know: traffic or event spikes and drops, funnels with a high drop-off between steps, and notable trends.
+
+Return ONLY valid JSON in this format:
+{"insights": [{"kind": "drop", "severity": "warning", "title": "Signups fell 40% yesterday", "detail": "Signups went from 50 to 30 day-over-day while pageviews held steady, so the signup flow may be broken.", "metric": "Sign Up"}]}
+
+Rules:
+- kind must be one of: spike, drop, funnel_dropoff, trend, other
+- severity must be one of: info, warning, critical
+- Return at most 5 insights, most important first
+- Only report findings supported by the numbers given; cite them in the detail
+- Return {"insights": []} if nothing is notable`
+
+	raw, err := chatComplete(ctx, cfg, systemMsg, snapshot)
+	if err != nil {
+		return nil, fmt.Errorf("LLM chat completion: %w", err)
+	}
+	return ParseInsights(raw)
+}
+
+// ParseInsights decodes and validates an insights response. Findings without
+// a title are dropped, unknown kinds become "other" and unknown severities
+// "info".
+func ParseInsights(raw string) ([]Insight, error) {
+	var result struct {
+		Insights []Insight `json:"insights"`
+	}
+	cleaned := extractJSON(raw)
+	if err := json.Unmarshal([]byte(cleaned), &result); err != nil {
+		return nil, fmt.Errorf("parsing LLM response: %w (raw: %s)", err, cleaned)
+	}
+
+	insights := make([]Insight, 0, len(result.Insights))
+	for _, in := range result.Insights {
+		in.Title = strings.TrimSpace(in.Title)
+		if in.Title == "" {
+			continue
+		}
+		in.Detail = strings.TrimSpace(in.Detail)
+		if !slices.Contains(insightKinds, in.Kind) {
+			in.Kind = "other"
+		}
+		if !slices.Contains(insightSeverities, in.Severity) {
+			in.Severity = "info"
+		}
+		insights = append(insights, in)
+		if len(insights) == maxInsights {
+			break
+		}
+	}
+	return insights, nil
+}
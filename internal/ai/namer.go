@@ -2,9 +2,11 @@ package ai
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"sync"
 
+	"github.com/danielthedm/clicknest/internal/ratelimit"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
 
@@ -30,6 +32,7 @@ type Namer struct {
 	events   *storage.DuckDB
 	jobs     chan NamingJob
 	wg       sync.WaitGroup
+	nameMu   sync.Mutex // serializes dedupe + cache write across workers
 }
 
 // NewNamer creates a naming orchestrator with the given number of workers.
@@ -215,16 +218,39 @@ func (n *Namer) worker() {
 			}
 		}
 
+		if cfg, err := n.cache.meta.GetLLMConfig(ctx, job.ProjectID); err == nil {
+			req.Style = cfg.NamingStyle
+		}
+
 		result, err := provider.GenerateEventName(ctx, req)
 		if err != nil {
-			log.Printf("WARN naming event %s: %v", job.Fingerprint, err)
+			ratelimit.Warnings.Printf("naming "+job.Fingerprint, "WARN naming event %s: %v", job.Fingerprint, err)
 			continue
 		}
+		result.Name = FormatName(normalizeName(result.Name), req.Style)
+		if result.Name == "" {
+			ratelimit.Warnings.Printf("naming empty "+job.Fingerprint, "WARN naming event %s: provider returned an empty name", job.Fingerprint)
+			continue
+		}
+
+		review := n.cache.meta.NameReviewEnabled(ctx, job.ProjectID)
 
-		if err := n.cache.Set(ctx, job.ProjectID, job.Fingerprint, result); err != nil {
+		n.nameMu.Lock()
+		result.Name = n.uniqueName(ctx, job.ProjectID, job.Fingerprint, result.Name, req)
+		if review {
+			err = n.cache.SetPending(ctx, job.ProjectID, job.Fingerprint, result)
+		} else {
+			err = n.cache.Set(ctx, job.ProjectID, job.Fingerprint, result)
+		}
+		n.nameMu.Unlock()
+		if err != nil {
 			log.Printf("WARN caching name for %s: %v", job.Fingerprint, err)
 			continue
 		}
+		if review {
+			// Events are backfilled when the name is approved.
+			continue
+		}
 
 		// Backfill existing events with the new name.
 		name := result.Name
@@ -233,3 +259,32 @@ func (n *Namer) worker() {
 		}
 	}
 }
+
+// uniqueName disambiguates name when another fingerprint in the project
+// already uses it, first by appending the page path, then a counter, and
+// finally the fingerprint itself.
+// Lookup errors fall back to the original name rather than dropping the job.
+func (n *Namer) uniqueName(ctx context.Context, projectID, fingerprint, name string, req NamingRequest) string {
+	taken := func(candidate string) bool {
+		t, err := n.cache.meta.EventNameTaken(ctx, projectID, candidate, fingerprint)
+		return err == nil && t
+	}
+	if !taken(name) {
+		return name
+	}
+	base := name
+	if req.URLPath != "" && req.URLPath != "/" {
+		base = withSuffix(name, req.URLPath, req.Style)
+		if !taken(base) {
+			return base
+		}
+	}
+	for i := 2; i < 100; i++ {
+		candidate := withSuffix(base, fmt.Sprint(i), req.Style)
+		if !taken(candidate) {
+			return candidate
+		}
+	}
+	// Fingerprints are unique within a project, so this can't collide.
+	return withSuffix(base, fingerprint, req.Style)
+}
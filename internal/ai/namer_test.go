@@ -0,0 +1,231 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danielthedm/clicknest/internal/storage"
+
+	_ "github.com/marcboeker/go-duckdb"
+	_ "modernc.org/sqlite"
+)
+
+// fakeProvider returns canned names in order and records the requests it saw.
+type fakeProvider struct {
+	mu    sync.Mutex
+	names []string
+	reqs  []NamingRequest
+}
+
+func (f *fakeProvider) GenerateEventName(ctx context.Context, req NamingRequest) (*NamingResult, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reqs = append(f.reqs, req)
+	name := f.names[0]
+	if len(f.names) > 1 {
+		f.names = f.names[1:]
+	}
+	return &NamingResult{Name: name, Confidence: 0.8}, nil
+}
+
+func newTestNamer(t *testing.T, provider Provider) (*Namer, *storage.SQLite) {
+	t.Helper()
+	dir := t.TempDir()
+	events, err := storage.NewDuckDB(filepath.Join(dir, "events.duckdb"))
+	if err != nil {
+		t.Fatalf("NewDuckDB: %v", err)
+	}
+	t.Cleanup(func() { events.Close() })
+	enc, err := storage.NewEncryptor(dir)
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	meta, err := storage.NewSQLite(filepath.Join(dir, "clicknest.db"), enc)
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+	if _, err := meta.CreateProject(context.Background(), "proj-1", "Test"); err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	return NewNamer(provider, NewCache(meta), events, 1), meta
+}
+
+func TestFormatName(t *testing.T) {
+	cases := []struct {
+		name, style, want string
+	}{
+		{"Submit Checkout Form", StyleSentence, "Submit Checkout Form"},
+		{"Submit Checkout Form", StyleSnakeCase, "submit_checkout_form"},
+		{"openNavMenu", StyleSnakeCase, "open_nav_menu"},
+		{"Checkout.Submit", StyleDotNotation, "checkout.submit"},
+		{"Nav.Open Menu!", StyleDotNotation, "nav.open_menu"},
+		{"Checkout Submit", StyleDotNotation, "checkout.submit"},
+	}
+	for _, c := range cases {
+		if got := FormatName(c.name, c.style); got != c.want {
+			t.Errorf("FormatName(%q, %q) = %q, want %q", c.name, c.style, got, c.want)
+		}
+	}
+}
+
+func TestNamer_AppliesProjectNamingStyle(t *testing.T) {
+	ctx := context.Background()
+	provider := &fakeProvider{names: []string{"Checkout Submit"}}
+	namer, meta := newTestNamer(t, provider)
+
+	key := "sk-test"
+	if err := meta.SetLLMConfig(ctx, storage.LLMConfig{
+		ProjectID: "proj-1", Provider: "openai", APIKey: &key, Model: "gpt-4o-mini", NamingStyle: StyleDotNotation,
+	}); err != nil {
+		t.Fatalf("SetLLMConfig: %v", err)
+	}
+
+	namer.Submit(ctx, NamingJob{ProjectID: "proj-1", Fingerprint: "fp1", Request: NamingRequest{ElementTag: "button"}})
+	namer.Close()
+
+	if len(provider.reqs) != 1 || provider.reqs[0].Style != StyleDotNotation {
+		t.Fatalf("expected provider to see dot.notation style, got %+v", provider.reqs)
+	}
+	if got := systemPromptFor(StyleDotNotation); got == systemPrompt {
+		t.Fatal("expected dot.notation to adjust the system prompt")
+	}
+	en, err := meta.GetEventName(ctx, "proj-1", "fp1")
+	if err != nil {
+		t.Fatalf("GetEventName: %v", err)
+	}
+	if en.AIName != "checkout.submit" {
+		t.Fatalf("expected dot.notation-formatted name, got %q", en.AIName)
+	}
+}
+
+func TestNormalizeName(t *testing.T) {
+	cases := []struct{ in, want string }{
+		{`  "Click Buy Button."  `, "Click Buy Button"},
+		{"Open   Settings!\nThis names the settings link.", "Open Settings"},
+		{"`Toggle Dark Mode`", "Toggle Dark Mode"},
+	}
+	for _, c := range cases {
+		if got := normalizeName(c.in); got != c.want {
+			t.Errorf("normalizeName(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+
+	long := normalizeName(strings.Repeat("Word ", 30))
+	if len(long) > maxNameLength || strings.HasSuffix(long, " ") {
+		t.Fatalf("expected name capped at %d chars on a word boundary, got %q (%d)", maxNameLength, long, len(long))
+	}
+}
+
+func TestNamer_DisambiguatesCollisions(t *testing.T) {
+	ctx := context.Background()
+	provider := &fakeProvider{names: []string{"Click Buy Button"}}
+	namer, meta := newTestNamer(t, provider)
+
+	namer.Submit(ctx, NamingJob{ProjectID: "proj-1", Fingerprint: "fp1", Request: NamingRequest{URLPath: "/"}})
+	namer.Submit(ctx, NamingJob{ProjectID: "proj-1", Fingerprint: "fp2", Request: NamingRequest{URLPath: "/pricing"}})
+	namer.Submit(ctx, NamingJob{ProjectID: "proj-1", Fingerprint: "fp3", Request: NamingRequest{URLPath: "/pricing"}})
+	namer.Close()
+
+	got := map[string]string{}
+	for _, fp := range []string{"fp1", "fp2", "fp3"} {
+		en, err := meta.GetEventName(ctx, "proj-1", fp)
+		if err != nil {
+			t.Fatalf("GetEventName(%s): %v", fp, err)
+		}
+		got[fp] = en.AIName
+	}
+	want := map[string]string{
+		"fp1": "Click Buy Button",
+		"fp2": "Click Buy Button (/pricing)",
+		"fp3": "Click Buy Button (/pricing) (2)",
+	}
+	for fp, w := range want {
+		if got[fp] != w {
+			t.Errorf("%s: got %q, want %q", fp, got[fp], w)
+		}
+	}
+}
+
+func TestNamer_ReviewModeHoldsNamesPending(t *testing.T) {
+	ctx := context.Background()
+	namer, meta := newTestNamer(t, &fakeProvider{names: []string{"Click Buy"}})
+	if err := meta.SetGrowthSetting(ctx, "proj-1", storage.NameReviewSetting, "true"); err != nil {
+		t.Fatalf("SetGrowthSetting: %v", err)
+	}
+
+	namer.Submit(ctx, NamingJob{ProjectID: "proj-1", Fingerprint: "fp1"})
+	namer.Close()
+
+	en, err := meta.GetEventName(ctx, "proj-1", "fp1")
+	if err != nil {
+		t.Fatalf("GetEventName: %v", err)
+	}
+	if en.Status != storage.NamePending || en.DisplayName() != "" {
+		t.Fatalf("expected pending name hidden from display, got %+v", en)
+	}
+}
+
+func TestNamer_DisambiguatesLongPaths(t *testing.T) {
+	ctx := context.Background()
+	provider := &fakeProvider{names: []string{"Click Buy Button"}}
+	namer, meta := newTestNamer(t, provider)
+
+	long := "/products/" + strings.Repeat("very-long-category-name/", 6)
+	namer.Submit(ctx, NamingJob{ProjectID: "proj-1", Fingerprint: "fp1", Request: NamingRequest{URLPath: "/"}})
+	namer.Submit(ctx, NamingJob{ProjectID: "proj-1", Fingerprint: "fp2", Request: NamingRequest{URLPath: long + "a"}})
+	namer.Submit(ctx, NamingJob{ProjectID: "proj-1", Fingerprint: "fp3", Request: NamingRequest{URLPath: long + "b"}})
+	namer.Close()
+
+	seen := map[string]bool{}
+	for _, fp := range []string{"fp1", "fp2", "fp3"} {
+		en, err := meta.GetEventName(ctx, "proj-1", fp)
+		if err != nil {
+			t.Fatalf("GetEventName(%s): %v", fp, err)
+		}
+		if en.AIName == "" || len(en.AIName) > maxNameLength {
+			t.Errorf("%s: name %q (%d) not within %d chars", fp, en.AIName, len(en.AIName), maxNameLength)
+		}
+		if seen[en.AIName] {
+			t.Errorf("%s: duplicate name %q", fp, en.AIName)
+		}
+		seen[en.AIName] = true
+	}
+
+	// Suffixes longer than the name itself still fit in every style.
+	for _, style := range []string{StyleSentence, StyleSnakeCase, StyleDotNotation} {
+		if got := withSuffix("Click Buy Button", strings.Repeat("x", 200), style); len(got) > maxNameLength {
+			t.Errorf("%s: withSuffix gave %d chars: %q", style, len(got), got)
+		}
+	}
+}
+
+func TestNamer_FallsBackToFingerprintSuffix(t *testing.T) {
+	ctx := context.Background()
+	namer, meta := newTestNamer(t, &fakeProvider{names: []string{"Click Buy"}})
+	// Every counter suffix is already in use.
+	for i := 1; i < 100; i++ {
+		name := "Click Buy"
+		if i > 1 {
+			name = fmt.Sprintf("Click Buy (%d)", i)
+		}
+		if err := meta.SetEventName(ctx, storage.EventName{ProjectID: "proj-1", Fingerprint: fmt.Sprintf("taken%d", i), AIName: name}); err != nil {
+			t.Fatalf("SetEventName: %v", err)
+		}
+	}
+
+	namer.Submit(ctx, NamingJob{ProjectID: "proj-1", Fingerprint: "fp1", Request: NamingRequest{URLPath: "/"}})
+	namer.Close()
+
+	en, err := meta.GetEventName(ctx, "proj-1", "fp1")
+	if err != nil {
+		t.Fatalf("GetEventName: %v", err)
+	}
+	if en.AIName != "Click Buy (fp1)" {
+		t.Fatalf("expected the fingerprint suffix, got %q", en.AIName)
+	}
+}
@@ -33,7 +33,7 @@ func NewOllama(model, baseURL string) *Ollama {
 }
 
 func (o *Ollama) GenerateEventName(ctx context.Context, req NamingRequest) (*NamingResult, error) {
-	prompt := systemPrompt + "\n\n" + buildPrompt(req)
+	prompt := systemPromptFor(req.Style) + "\n\n" + buildPrompt(req)
 
 	body := map[string]any{
 		"model":  o.model,
@@ -40,7 +40,7 @@ func (o *OpenAI) GenerateEventName(ctx context.Context, req NamingRequest) (*Nam
 	body := map[string]any{
 		"model": o.model,
 		"messages": []map[string]string{
-			{"role": "system", "content": systemPrompt},
+			{"role": "system", "content": systemPromptFor(req.Style)},
 			{"role": "user", "content": prompt},
 		},
 		"temperature": 0.2,
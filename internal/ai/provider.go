@@ -19,6 +19,7 @@ type NamingRequest struct {
 	PageTitle      string
 	SourceCode     string // matched source code snippet (from GitHub)
 	SourceFile     string // matched source file path
+	Style          string // project naming style (see StyleSentence etc.); empty means sentence
 }
 
 // NamingResult contains the AI-generated name and metadata.
@@ -0,0 +1,162 @@
+package ai
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Naming styles a project can choose for AI-generated event names.
+const (
+	StyleSentence    = "sentence"     // "Submit Checkout Form"
+	StyleSnakeCase   = "snake_case"   // "submit_checkout_form"
+	StyleDotNotation = "dot.notation" // "checkout.submit"
+)
+
+// ValidNamingStyle reports whether s is a known naming style. The empty
+// string is accepted and means StyleSentence.
+func ValidNamingStyle(s string) bool {
+	switch s {
+	case "", StyleSentence, StyleSnakeCase, StyleDotNotation:
+		return true
+	}
+	return false
+}
+
+const sentenceFormatRule = "- Use Title Case, 2-5 words max"
+
+// systemPromptFor returns the naming system prompt with the format rule
+// adjusted for the given style.
+func systemPromptFor(style string) string {
+	switch style {
+	case StyleSnakeCase:
+		return strings.Replace(systemPrompt, sentenceFormatRule,
+			"- Use lowercase snake_case, 2-5 words max (e.g. submit_checkout_form)", 1)
+	case StyleDotNotation:
+		return strings.Replace(systemPrompt, sentenceFormatRule,
+			"- Use lowercase dot notation: the area or object first, then the action (e.g. checkout.submit, nav.open_menu)", 1)
+	}
+	return systemPrompt
+}
+
+// FormatName coerces a model-produced name into the given style, so names
+// stay consistent even when the model ignores the format instruction.
+func FormatName(name, style string) string {
+	switch style {
+	case StyleSnakeCase:
+		return strings.Join(nameWords(name), "_")
+	case StyleDotNotation:
+		// Keep any dots the model produced as segment boundaries, joining
+		// words inside a segment with underscores. A name with no dots at
+		// all is split word by word.
+		if !strings.Contains(name, ".") {
+			return strings.Join(nameWords(name), ".")
+		}
+		var segments []string
+		for _, seg := range strings.Split(name, ".") {
+			if words := nameWords(seg); len(words) > 0 {
+				segments = append(segments, strings.Join(words, "_"))
+			}
+		}
+		return strings.Join(segments, ".")
+	}
+	return name
+}
+
+// nameWords splits a name into lowercase words on any non-alphanumeric rune
+// and on camelCase boundaries.
+func nameWords(s string) []string {
+	var words []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, strings.ToLower(string(cur)))
+			cur = cur[:0]
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]) {
+			flush()
+		}
+		cur = append(cur, r)
+	}
+	flush()
+	return words
+}
+
+// maxNameLength caps generated names; longer model output is cut at a word
+// boundary.
+const maxNameLength = 80
+
+// normalizeName cleans up raw model output: surrounding quotes and
+// whitespace, trailing punctuation, repeated spaces and over-long names.
+func normalizeName(name string) string {
+	name = strings.TrimSpace(name)
+	// Models sometimes answer with several lines; only the first is the name.
+	if i := strings.IndexAny(name, "\r\n"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.Trim(name, "\"'` ")
+	name = strings.TrimRight(name, ".,;:!? ")
+	name = strings.Join(strings.Fields(name), " ")
+	return truncateName(name, maxNameLength)
+}
+
+// truncateName shortens name to at most max bytes, preferring to cut at the
+// last space and never splitting a multi-byte rune.
+func truncateName(name string, max int) string {
+	if max < 0 {
+		max = 0
+	}
+	if len(name) <= max {
+		return name
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	name = name[:cut]
+	if i := strings.LastIndexByte(name, ' '); i > max/2 {
+		name = name[:i]
+	}
+	return strings.TrimRight(name, " ._")
+}
+
+// maxSuffixLength caps a disambiguating suffix so the name it is added to
+// keeps most of its length.
+const maxSuffixLength = 32
+
+// withSuffix appends a disambiguating suffix in a form that fits the style,
+// keeping the result within maxNameLength.
+func withSuffix(name, suffix, style string) string {
+	var sep, tail, end string
+	switch style {
+	case StyleSnakeCase:
+		sep, tail = "_", boundSuffix(strings.Join(nameWords(suffix), "_"), "_")
+	case StyleDotNotation:
+		sep, tail = ".", boundSuffix(strings.Join(nameWords(suffix), "_"), "_")
+	default:
+		sep, tail, end = " (", boundSuffix(suffix, "~"), ")"
+	}
+	return truncateName(name, maxNameLength-len(sep)-len(tail)-len(end)) + sep + tail + end
+}
+
+// boundSuffix shortens a suffix longer than maxSuffixLength to its start
+// plus a hash of the whole, joined by sep, so long paths sharing a prefix
+// still get distinct suffixes.
+func boundSuffix(suffix, sep string) string {
+	if len(suffix) <= maxSuffixLength {
+		return suffix
+	}
+	h := fnv.New32a()
+	h.Write([]byte(suffix))
+	hash := fmt.Sprintf("%08x", h.Sum32())
+	return truncateName(suffix, maxSuffixLength-len(sep)-len(hash)) + sep + hash
+}
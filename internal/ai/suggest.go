@@ -103,19 +103,21 @@ func buildSuggestPrompt(sequences []storage.EventSequence, productDesc string, n
 		b.WriteString("\n")
 	}
 
-	// Show named events with fingerprints for funnel step references.
-	if len(namedEvents) > 0 {
-		b.WriteString("NAMED EVENTS (use fingerprint for click/submit funnel steps):\n")
-		cap := 40
-		if len(namedEvents) < cap {
-			cap = len(namedEvents)
+	// Show named events with fingerprints for funnel step references. AI
+	// names still in review, or rejected, are left out like everywhere else.
+	var shown []string
+	for _, en := range namedEvents {
+		if len(shown) == 40 {
+			break
 		}
-		for _, en := range namedEvents[:cap] {
-			name := en.AIName
-			if en.UserName != nil && *en.UserName != "" {
-				name = *en.UserName
-			}
-			fmt.Fprintf(&b, "  - %s [fingerprint: %s]\n", name, en.Fingerprint)
+		if name := en.DisplayName(); name != "" {
+			shown = append(shown, fmt.Sprintf("  - %s [fingerprint: %s]\n", name, en.Fingerprint))
+		}
+	}
+	if len(shown) > 0 {
+		b.WriteString("NAMED EVENTS (use fingerprint for click/submit funnel steps):\n")
+		for _, line := range shown {
+			b.WriteString(line)
 		}
 		b.WriteString("\n")
 	}
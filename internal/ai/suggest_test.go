@@ -0,0 +1,28 @@
+package ai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestBuildSuggestPrompt_OnlyReviewedNames(t *testing.T) {
+	override := "Start Checkout"
+	prompt := buildSuggestPrompt(nil, "", []storage.EventName{
+		{Fingerprint: "fp1", AIName: "Click Buy", Status: storage.NameApproved},
+		{Fingerprint: "fp2", AIName: "Click Secret", Status: storage.NamePending},
+		{Fingerprint: "fp3", AIName: "Click Wrong", Status: storage.NameRejected},
+		{Fingerprint: "fp4", AIName: "Click Cart", Status: storage.NamePending, UserName: &override},
+	}, nil)
+	for _, want := range []string{"Click Buy [fingerprint: fp1]", "Start Checkout [fingerprint: fp4]"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("expected %q in prompt", want)
+		}
+	}
+	for _, leaked := range []string{"Click Secret", "Click Wrong", "fp2", "fp3"} {
+		if strings.Contains(prompt, leaked) {
+			t.Errorf("unreviewed name %q leaked into prompt", leaked)
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// MaxToolRounds caps the requests one chat reply may take when the model
+// calls tools. The last round forbids further calls, so the model has to
+// answer with what it has looked up; calls it makes anyway are not run.
+const MaxToolRounds = 5
+
+// errToolRounds is returned when the model still asks for tools on the last
+// round without having written any reply.
+var errToolRounds = fmt.Errorf("model kept calling tools after %d rounds", MaxToolRounds)
+
+// ChatTool is a function the model may call while answering a chat. Run gets
+// the model's JSON arguments; its result, or its error, is sent back to the
+// model as JSON.
+type ChatTool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any // JSON Schema of the arguments object
+	Run         func(ctx context.Context, args json.RawMessage) (any, error)
+}
+
+// errStreamRejected marks a streamed first round the provider refused, so
+// the caller can retry buffered.
+var errStreamRejected = errors.New("streaming rejected")
+
+// ChatWithTools is ChatWithHistory with tools the model may call to look
+// things up before answering. Tool calling is only sent to the OpenAI
+// provider; others answer from the prompt alone.
+func ChatWithTools(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage, tools []ChatTool) (string, error) {
+	if cfg.Provider != "openai" || len(tools) == 0 {
+		return ChatWithHistory(ctx, cfg, systemMsg, history)
+	}
+	c := newToolChat(cfg, systemMsg, history, tools, false)
+	var reply strings.Builder
+	for round := 1; ; round++ {
+		resp, err := c.send(ctx, round == MaxToolRounds)
+		if err != nil {
+			return "", err
+		}
+		calls, err := c.read(resp, func(text string) bool { reply.WriteString(text); return true })
+		if err != nil {
+			return "", err
+		}
+		if len(calls) == 0 || round == MaxToolRounds {
+			if len(calls) > 0 && strings.TrimSpace(reply.String()) == "" {
+				return "", errToolRounds
+			}
+			return strings.TrimSpace(reply.String()), nil
+		}
+		c.runTools(ctx, calls)
+	}
+}
+
+// ChatWithToolsStream is ChatWithTools with the reply streamed as
+// ChatWithHistoryStream streams it. Tool rounds happen between deltas; only
+// the model's text is sent on the channel.
+func ChatWithToolsStream(ctx context.Context, cfg *storage.LLMConfig, systemMsg string, history []ChatMessage, tools []ChatTool) (<-chan ChatDelta, error) {
+	if cfg.Provider != "openai" || len(tools) == 0 {
+		return ChatWithHistoryStream(ctx, cfg, systemMsg, history)
+	}
+	c := newToolChat(cfg, systemMsg, history, tools, true)
+	resp, err := c.send(ctx, false)
+	if errors.Is(err, errStreamRejected) {
+		reply, err := ChatWithTools(ctx, cfg, systemMsg, history, tools)
+		if err != nil {
+			return nil, err
+		}
+		ch := make(chan ChatDelta, 1)
+		ch <- ChatDelta{Text: reply}
+		close(ch)
+		return ch, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan ChatDelta)
+	go func() {
+		defer close(ch)
+		send := func(d ChatDelta) bool {
+			select {
+			case ch <- d:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		wrote := false
+		for round := 1; ; round++ {
+			if round > 1 {
+				if resp, err = c.send(ctx, round == MaxToolRounds); err != nil {
+					send(ChatDelta{Err: err})
+					return
+				}
+			}
+			calls, err := c.read(resp, func(text string) bool { wrote = true; return send(ChatDelta{Text: text}) })
+			if err != nil {
+				if ctx.Err() == nil {
+					send(ChatDelta{Err: fmt.Errorf("reading openai stream: %w", err)})
+				}
+				return
+			}
+			if len(calls) == 0 || ctx.Err() != nil {
+				return
+			}
+			if round == MaxToolRounds {
+				if !wrote {
+					send(ChatDelta{Err: errToolRounds})
+				}
+				return
+			}
+			c.runTools(ctx, calls)
+		}
+	}()
+	return ch, nil
+}
+
+// toolChat is an OpenAI chat completion conversation that may go several
+// rounds while the model calls tools.
+type toolChat struct {
+	cfg      *storage.LLMConfig
+	tools    []ChatTool
+	stream   bool
+	messages []map[string]any
+}
+
+// openaiToolCall is a function call the model asked for.
+type openaiToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+func newToolChat(cfg *storage.LLMConfig, systemMsg string, history []ChatMessage, tools []ChatTool, stream bool) *toolChat {
+	messages := []map[string]any{{"role": "system", "content": systemMsg}}
+	for _, m := range history {
+		messages = append(messages, map[string]any{"role": m.Role, "content": m.Content})
+	}
+	return &toolChat{cfg: cfg, tools: tools, stream: stream, messages: messages}
+}
+
+// send posts the conversation so far. With final set the model may not
+// call tools. A non-200 answer is an error; on a streamed request it wraps
+// errStreamRejected when the status suggests streaming was the problem.
+func (c *toolChat) send(ctx context.Context, final bool) (*http.Response, error) {
+	apiKey := ""
+	if c.cfg.APIKey != nil {
+		apiKey = *c.cfg.APIKey
+	}
+	model := c.cfg.Model
+	if model == "" {
+		model = "gpt-4o-mini"
+	}
+	baseURL := "https://api.openai.com/v1"
+	if c.cfg.BaseURL != nil && *c.cfg.BaseURL != "" {
+		baseURL = strings.TrimRight(*c.cfg.BaseURL, "/")
+	}
+
+	tools := make([]map[string]any, len(c.tools))
+	for i, t := range c.tools {
+		tools[i] = map[string]any{
+			"type": "function",
+			"function": map[string]any{
+				"name":        t.Name,
+				"description": t.Description,
+				"parameters":  t.Parameters,
+			},
+		}
+	}
+	body := map[string]any{
+		"model":       model,
+		"messages":    c.messages,
+		"temperature": 0.5,
+		"max_tokens":  1200,
+		"stream":      c.stream,
+		"tools":       tools,
+	}
+	if final {
+		body["tool_choice"] = "none"
+	}
+
+	jsonBody, _ := json.Marshal(body)
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/chat/completions", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("calling openai: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		err := fmt.Errorf("openai returned %d: %s", resp.StatusCode, string(respBody))
+		if c.stream && streamRejected(resp.StatusCode) {
+			return nil, fmt.Errorf("%w: %w", errStreamRejected, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// read consumes one response, passing the model's text to emit (stopping
+// early if emit returns false), and returns the tool calls it asked for.
+func (c *toolChat) read(resp *http.Response, emit func(string) bool) ([]openaiToolCall, error) {
+	defer resp.Body.Close()
+	var content strings.Builder
+	var calls []openaiToolCall
+	if c.stream {
+		err := scanLines(resp.Body, func(line string) (bool, error) {
+			data, ok := strings.CutPrefix(line, "data:")
+			if !ok {
+				return true, nil
+			}
+			data = strings.TrimSpace(data)
+			if data == "[DONE]" {
+				return false, nil
+			}
+			var chunk struct {
+				Choices []struct {
+					Delta struct {
+						Content   string `json:"content"`
+						ToolCalls []struct {
+							Index int `json:"index"`
+							openaiToolCall
+						} `json:"tool_calls"`
+					} `json:"delta"`
+				} `json:"choices"`
+				Error *struct {
+					Message string `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return false, fmt.Errorf("parsing chunk: %w", err)
+			}
+			if chunk.Error != nil {
+				return false, errors.New(chunk.Error.Message)
+			}
+			if len(chunk.Choices) == 0 {
+				return true, nil
+			}
+			delta := chunk.Choices[0].Delta
+			// A call's ID and name arrive in its first fragment, its
+			// arguments spread over the rest.
+			for _, tc := range delta.ToolCalls {
+				for len(calls) <= tc.Index {
+					calls = append(calls, openaiToolCall{Type: "function"})
+				}
+				call := &calls[tc.Index]
+				if tc.ID != "" {
+					call.ID = tc.ID
+				}
+				if tc.Function.Name != "" {
+					call.Function.Name = tc.Function.Name
+				}
+				call.Function.Arguments += tc.Function.Arguments
+			}
+			if delta.Content != "" {
+				content.WriteString(delta.Content)
+				return emit(delta.Content), nil
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var result struct {
+			Choices []struct {
+				Message struct {
+					Content   string           `json:"content"`
+					ToolCalls []openaiToolCall `json:"tool_calls"`
+				} `json:"message"`
+			} `json:"choices"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			return nil, fmt.Errorf("parsing response: %w", err)
+		}
+		if len(result.Choices) == 0 {
+			return nil, fmt.Errorf("no choices in response")
+		}
+		msg := result.Choices[0].Message
+		content.WriteString(msg.Content)
+		calls = msg.ToolCalls
+		if msg.Content != "" {
+			emit(msg.Content)
+		}
+	}
+
+	if len(calls) > 0 {
+		assistant := map[string]any{"role": "assistant", "tool_calls": calls}
+		if content.Len() > 0 {
+			assistant["content"] = content.String()
+		}
+		c.messages = append(c.messages, assistant)
+	}
+	return calls, nil
+}
+
+// runTools runs each call and adds its result to the conversation. Unknown
+// tools and failures are reported to the model as {"error": ...} so it can
+// recover.
+func (c *toolChat) runTools(ctx context.Context, calls []openaiToolCall) {
+	for _, call := range calls {
+		var result any
+		tool := c.tool(call.Function.Name)
+		if tool == nil {
+			result = map[string]string{"error": "unknown tool " + call.Function.Name}
+		} else {
+			args := json.RawMessage(call.Function.Arguments)
+			if len(bytes.TrimSpace(args)) == 0 {
+				args = json.RawMessage("{}")
+			}
+			out, err := tool.Run(ctx, args)
+			if err != nil {
+				out = map[string]string{"error": err.Error()}
+			}
+			result = out
+		}
+		b, err := json.Marshal(result)
+		if err != nil {
+			b, _ = json.Marshal(map[string]string{"error": err.Error()})
+		}
+		c.messages = append(c.messages, map[string]any{
+			"role":         "tool",
+			"tool_call_id": call.ID,
+			"content":      string(b),
+		})
+	}
+}
+
+func (c *toolChat) tool(name string) *ChatTool {
+	for i := range c.tools {
+		if c.tools[i].Name == name {
+			return &c.tools[i]
+		}
+	}
+	return nil
+}
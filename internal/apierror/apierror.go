@@ -0,0 +1,103 @@
+// Package apierror writes the API's JSON error responses. Every error body
+// has the same shape:
+//
+//	{"error": {"code": "not_found", "message": "funnel not found"}}
+//
+// code is stable and machine-readable; message is for humans and may change.
+// Some errors add a details object locating the problem in the request.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes. Most follow from the HTTP status; the rest name a failure
+// class clients are expected to handle specially.
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidJSON      = "invalid_json"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeTooLarge         = "payload_too_large"
+	CodeUnsupportedMedia = "unsupported_media_type"
+	CodeRateLimited      = "rate_limited"
+	CodeQuotaExceeded    = "quota_exceeded"
+	CodeInternal         = "internal"
+	CodeQueryFailed      = "query_failed"
+	CodeUpstream         = "upstream_error"
+	CodeUnavailable      = "unavailable"
+	CodeUpgradeRequired  = "upgrade_required"
+	CodeLLMNotConfigured = "llm_not_configured"
+)
+
+// Body is the JSON envelope of an error response.
+type Body struct {
+	Error Detail `json:"error"`
+}
+
+// Detail is the content of an error response.
+type Detail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+// Error replies with message and status, like http.Error, using the code
+// that corresponds to status.
+func Error(w http.ResponseWriter, message string, status int) {
+	ErrorCode(w, CodeForStatus(status), message, status)
+}
+
+// ErrorCode replies with an explicit code.
+func ErrorCode(w http.ResponseWriter, code, message string, status int) {
+	ErrorDetails(w, code, message, status, nil)
+}
+
+// ErrorDetails replies with an explicit code and a details object, omitted
+// when nil.
+func ErrorDetails(w http.ResponseWriter, code, message string, status int, details any) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Type", "application/json")
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Body{Error: Detail{Code: code, Message: message, Details: details}})
+}
+
+// CodeForStatus returns the default code for an HTTP status.
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeTooLarge
+	case http.StatusUnsupportedMediaType:
+		return CodeUnsupportedMedia
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return CodeUpstream
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	case http.StatusPaymentRequired:
+		return CodeUpgradeRequired
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
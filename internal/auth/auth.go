@@ -40,7 +40,7 @@ func WithProject(ctx context.Context, p *storage.Project) context.Context {
 }
 
 // ValidateAPIKey looks up a project by API key. Returns ErrUnauthorized if not found.
-func ValidateAPIKey(ctx context.Context, meta *storage.SQLite, apiKey string) (*storage.Project, error) {
+func ValidateAPIKey(ctx context.Context, meta storage.MetaStore, apiKey string) (*storage.Project, error) {
 	if apiKey == "" {
 		return nil, ErrUnauthorized
 	}
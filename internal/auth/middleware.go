@@ -3,19 +3,25 @@ package auth
 import (
 	"net/http"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
 
 const SessionCookieName = "clicknest_session"
 
 // APIKeyMiddleware validates the X-API-Key header for SDK ingestion endpoints.
-func APIKeyMiddleware(meta *storage.SQLite) func(http.Handler) http.Handler {
+// Without the header it falls back to the api_key query parameter, since
+// navigator.sendBeacon can't set headers.
+func APIKeyMiddleware(meta storage.MetaStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			apiKey := r.Header.Get("X-API-Key")
+			if apiKey == "" {
+				apiKey = r.URL.Query().Get("api_key")
+			}
 			project, err := ValidateAPIKey(r.Context(), meta, apiKey)
 			if err != nil {
-				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+				apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
 			}
 			ctx := WithProject(r.Context(), project)
@@ -24,25 +30,82 @@ func APIKeyMiddleware(meta *storage.SQLite) func(http.Handler) http.Handler {
 	}
 }
 
+// PublicIDMiddleware rejects project-scoped URLs (/api/v1/{public_id}/...)
+// whose public ID doesn't name a project. It does not authenticate: the
+// public ID is not secret, so handlers still need APIKeyMiddleware and
+// RequireMatchingPublicID.
+func PublicIDMiddleware(meta storage.MetaStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, err := meta.GetProjectByPublicID(r.Context(), r.PathValue("public_id")); err != nil {
+				apierror.Error(w, "unknown project", http.StatusNotFound)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireMatchingPublicID, placed after APIKeyMiddleware, rejects requests
+// whose API key belongs to a different project than the one in the path.
+func RequireMatchingPublicID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		project := ProjectFromContext(r.Context())
+		if project == nil || project.PublicID != r.PathValue("public_id") {
+			apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ProjectHeader and ProjectParam select the project a dashboard request acts
+// on, overriding the session's active project for that request only.
+const (
+	ProjectHeader = "X-Project-ID"
+	ProjectParam  = "project"
+)
+
 // SessionMiddleware validates cookie-based sessions for the dashboard.
-// It resolves the user's active project from the session, falling back
-// to their first project membership or the global project list.
-func SessionMiddleware(meta *storage.SQLite) func(http.Handler) http.Handler {
+// A request may pick a project with the X-Project-ID header or ?project=
+// parameter; it must exist and the user must be a member. Otherwise the
+// user's active project comes from the session, falling back to their first
+// project membership or the global project list.
+func SessionMiddleware(meta storage.MetaStore) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			cookie, err := r.Cookie(SessionCookieName)
 			if err != nil {
-				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+				apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
 			}
 			userID, projectID, err := meta.GetUserSession(r.Context(), cookie.Value)
 			if err != nil {
-				http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+				apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
 			}
 
 			ctx := WithUserID(r.Context(), userID)
 
+			// An explicit per-request selector wins, but only for members.
+			selected := r.Header.Get(ProjectHeader)
+			if selected == "" {
+				selected = r.URL.Query().Get(ProjectParam)
+			}
+			if selected != "" {
+				p, err := meta.GetProject(ctx, selected)
+				if err != nil {
+					apierror.Error(w, "unknown project", http.StatusNotFound)
+					return
+				}
+				if _, err := meta.GetUserProjectRole(ctx, userID, p.ID); err != nil {
+					apierror.Error(w, "not a member of this project", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(WithProject(ctx, p)))
+				return
+			}
+
 			// Try session's project_id first.
 			if projectID != "" {
 				p, err := meta.GetProject(ctx, projectID)
@@ -64,7 +127,7 @@ func SessionMiddleware(meta *storage.SQLite) func(http.Handler) http.Handler {
 			// Final fallback: global project list (backward compat for pre-migration).
 			projects, err := meta.ListProjects(ctx)
 			if err != nil || len(projects) == 0 {
-				http.Error(w, `{"error":"no project configured"}`, http.StatusUnauthorized)
+				apierror.Error(w, "no project configured", http.StatusUnauthorized)
 				return
 			}
 			ctx = WithProject(ctx, &projects[0])
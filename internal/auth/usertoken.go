@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// Purposes a user token can be issued for. A token only authorizes the
+// purpose it was signed with.
+const (
+	PurposeDelete = "delete"
+	PurposeExport = "export"
+)
+
+// UserToken identifies an end user (by distinct ID) for self-serve data
+// requests, so they can act on their own data without a dashboard login.
+type UserToken struct {
+	ProjectID  string    `json:"p"`
+	DistinctID string    `json:"d"`
+	Purpose    string    `json:"u"`
+	ExpiresAt  time.Time `json:"e"`
+}
+
+// SignUserToken encodes t as "<payload>.<signature>", both base64url, signed
+// with the instance encryption key.
+func SignUserToken(enc *storage.Encryptor, t UserToken) (string, error) {
+	return signClaims(enc, t)
+}
+
+// VerifyUserToken checks the signature, expiry and purpose of a token and
+// returns its claims. Any failure returns ErrUnauthorized.
+func VerifyUserToken(enc *storage.Encryptor, token, purpose string) (*UserToken, error) {
+	var t UserToken
+	if err := verifyClaims(enc, token, &t); err != nil {
+		return nil, err
+	}
+	if t.Purpose != purpose || t.DistinctID == "" || t.ProjectID == "" || time.Now().After(t.ExpiresAt) {
+		return nil, ErrUnauthorized
+	}
+	return &t, nil
+}
+
+// WidgetToken is a share token for one embeddable widget. It carries no
+// expiry; deleting the widget revokes it.
+type WidgetToken struct {
+	ProjectID string `json:"p"`
+	WidgetID  string `json:"w"`
+}
+
+// SignWidgetToken encodes and signs t like SignUserToken.
+func SignWidgetToken(enc *storage.Encryptor, t WidgetToken) (string, error) {
+	return signClaims(enc, t)
+}
+
+// VerifyWidgetToken checks a widget token's signature and returns its claims.
+// Any failure returns ErrUnauthorized.
+func VerifyWidgetToken(enc *storage.Encryptor, token string) (*WidgetToken, error) {
+	var t WidgetToken
+	if err := verifyClaims(enc, token, &t); err != nil {
+		return nil, err
+	}
+	if t.ProjectID == "" || t.WidgetID == "" {
+		return nil, ErrUnauthorized
+	}
+	return &t, nil
+}
+
+func signClaims(enc *storage.Encryptor, claims any) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	sig := enc.Sign(payload)
+	if sig == nil {
+		return "", ErrUnauthorized
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+func verifyClaims(enc *storage.Encryptor, token string, claims any) error {
+	p, s, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrUnauthorized
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(p)
+	if err != nil {
+		return ErrUnauthorized
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || !enc.Verify(payload, sig) {
+		return ErrUnauthorized
+	}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return ErrUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestUserToken_RoundTrip(t *testing.T) {
+	enc, err := storage.NewEncryptor(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tok, err := SignUserToken(enc, UserToken{ProjectID: "p1", DistinctID: "u1", Purpose: PurposeDelete, ExpiresAt: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := VerifyUserToken(enc, tok, PurposeDelete)
+	if err != nil || got.ProjectID != "p1" || got.DistinctID != "u1" {
+		t.Fatalf("expected valid token, got %+v (%v)", got, err)
+	}
+	if _, err := VerifyUserToken(enc, tok, PurposeExport); err != ErrUnauthorized {
+		t.Fatal("expected token to be rejected for another purpose")
+	}
+}
+
+func TestUserToken_Rejected(t *testing.T) {
+	enc, _ := storage.NewEncryptor(t.TempDir())
+	other, _ := storage.NewEncryptor(t.TempDir())
+
+	expired, _ := SignUserToken(enc, UserToken{ProjectID: "p1", DistinctID: "u1", Purpose: PurposeDelete, ExpiresAt: time.Now().Add(-time.Minute)})
+	foreign, _ := SignUserToken(other, UserToken{ProjectID: "p1", DistinctID: "u1", Purpose: PurposeDelete, ExpiresAt: time.Now().Add(time.Hour)})
+	valid, _ := SignUserToken(enc, UserToken{ProjectID: "p1", DistinctID: "u1", Purpose: PurposeDelete, ExpiresAt: time.Now().Add(time.Hour)})
+
+	for name, tok := range map[string]string{
+		"expired":  expired,
+		"foreign":  foreign,
+		"tampered": "x" + valid,
+		"garbage":  "not-a-token",
+	} {
+		if _, err := VerifyUserToken(enc, tok, PurposeDelete); err != ErrUnauthorized {
+			t.Errorf("%s: expected ErrUnauthorized, got %v", name, err)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package ingest
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"regexp"
 	"strings"
+
+	"github.com/danielthedm/clicknest/internal/storage"
 )
 
 // ComputeFingerprint generates a stable hash from DOM context for event dedup and naming.
@@ -27,3 +30,26 @@ func ComputeFingerprint(elementTag, elementID, elementClasses, parentPath, urlPa
 
 	return hex.EncodeToString(h.Sum(nil))[:16]
 }
+
+// hashedClass matches class names generated at build time, which change from
+// deploy to deploy: CSS modules (Button_primary__3xK9q), styled-components
+// (sc-bdVaJa) and emotion (css-1q2w3e4).
+var hashedClass = regexp.MustCompile(`^(?:css|sc|jsx|emotion|svelte)-[a-zA-Z0-9]+$|__[a-zA-Z0-9_-]{5,}$`)
+
+// ComputeFingerprintWith is ComputeFingerprint under a project's strategy.
+// The zero strategy gives the same fingerprint as ComputeFingerprint.
+func ComputeFingerprintWith(st storage.FingerprintStrategy, elementTag, elementID, elementClasses, parentPath, urlPath string) string {
+	if st.ExcludeURLPath {
+		urlPath = ""
+	}
+	if st.StripHashedClasses {
+		var kept []string
+		for c := range strings.FieldsSeq(elementClasses) {
+			if !hashedClass.MatchString(c) {
+				kept = append(kept, c)
+			}
+		}
+		elementClasses = strings.Join(kept, " ")
+	}
+	return ComputeFingerprint(elementTag, elementID, elementClasses, parentPath, urlPath)
+}
@@ -3,6 +3,8 @@ package ingest
 import (
 	"strings"
 	"testing"
+
+	"github.com/danielthedm/clicknest/internal/storage"
 )
 
 func TestComputeFingerprint_Deterministic(t *testing.T) {
@@ -59,3 +61,19 @@ func TestComputeFingerprint_IsHex(t *testing.T) {
 		}
 	}
 }
+
+func TestComputeFingerprintWith_Strategy(t *testing.T) {
+	if got, want := ComputeFingerprintWith(storage.FingerprintStrategy{}, "a", "x", "btn", "nav", "/p"), ComputeFingerprint("a", "x", "btn", "nav", "/p"); got != want {
+		t.Fatalf("zero strategy should match ComputeFingerprint: %q vs %q", got, want)
+	}
+	noPath := storage.FingerprintStrategy{ExcludeURLPath: true}
+	if ComputeFingerprintWith(noPath, "a", "x", "btn", "nav", "/one") != ComputeFingerprintWith(noPath, "a", "x", "btn", "nav", "/two") {
+		t.Fatal("excluding the URL path should fingerprint pages alike")
+	}
+	stripped := storage.FingerprintStrategy{StripHashedClasses: true}
+	for _, classes := range []string{"btn Button_primary__3xK9q", "btn sc-bdVaJa", "css-1q2w3e4 btn"} {
+		if got, want := ComputeFingerprintWith(stripped, "a", "x", classes, "nav", "/"), ComputeFingerprint("a", "x", "btn", "nav", "/"); got != want {
+			t.Fatalf("hashed classes in %q should be ignored", classes)
+		}
+	}
+}
@@ -1,12 +1,22 @@
 package ingest
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"io"
 	"log"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/danielthedm/clicknest/internal/ai"
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
@@ -28,55 +38,154 @@ type IngestEvent struct {
 	ScreenHeight   int               `json:"screen_height,omitempty"`
 	Timestamp      int64             `json:"timestamp"`
 	Properties     map[string]any    `json:"properties,omitempty"`
+	// ClientEventID is an optional caller-chosen ID echoed back with the
+	// stored event ID when the batch is posted with ?ack=ids.
+	ClientEventID string `json:"client_event_id,omitempty"`
 }
 
 type IngestPayload struct {
 	Events     []IngestEvent `json:"events"`
 	SessionID  string        `json:"session_id"`
 	DistinctID string        `json:"distinct_id,omitempty"`
+	// Internal marks the whole batch as internal traffic; the SDK sets it
+	// once the browser has visited a page with ?ch_internal=1.
+	Internal bool `json:"internal,omitempty"`
 }
 
+// MaxPayloadBytes caps an ingest request body, measured after gzip
+// decompression.
+const MaxPayloadBytes = 10 << 20
+
 type Handler struct {
 	events *storage.DuckDB
-	meta   *storage.SQLite
+	meta   storage.MetaStore
 	namer  *ai.Namer
 
 	// OnIngested is called in a goroutine after events are successfully written.
 	// It receives the project ID and the number of events accepted.
 	// Used by EE to record usage in the control-plane database.
 	OnIngested func(projectID string, count int64)
+
+	discarded sync.Map // projectID → *atomic.Int64, events dropped by bot filters
 }
 
-func NewHandler(events *storage.DuckDB, meta *storage.SQLite, namer *ai.Namer) *Handler {
+func NewHandler(events *storage.DuckDB, meta storage.MetaStore, namer *ai.Namer) *Handler {
 	return &Handler{events: events, meta: meta, namer: namer}
 }
 
+// Discarded returns how many events from the project have been dropped by
+// its bot filters since the server started.
+func (h *Handler) Discarded(projectID string) int64 {
+	if n, ok := h.discarded.Load(projectID); ok {
+		return n.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+func (h *Handler) addDiscarded(projectID string, n int) {
+	c, _ := h.discarded.LoadOrStore(projectID, new(atomic.Int64))
+	c.(*atomic.Int64).Add(int64(n))
+}
+
 func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, `{"error":"method not allowed"}`, http.StatusMethodNotAllowed)
+		apierror.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
+	now := time.Now()
+	quota, ok := h.checkQuota(w, r.Context(), project.ID, now)
+	if !ok {
+		return
+	}
+
+	// Beacons (navigator.sendBeacon) send the JSON batch as text/plain.
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil || (mt != "application/json" && mt != "text/plain") {
+			apierror.Error(w, "content type must be application/json or text/plain", http.StatusUnsupportedMediaType)
+			return
+		}
+	}
+
+	// SDK batches may be gzipped. The cap applies to the decompressed
+	// stream so a small compressed body can't expand without bound.
+	body := r.Body
+	gzipped := strings.EqualFold(r.Header.Get("Content-Encoding"), "gzip")
+	if gzipped {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			apierror.Error(w, "invalid gzip", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	}
+	body = http.MaxBytesReader(w, body, MaxPayloadBytes)
 
 	var payload IngestPayload
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+	if err := json.NewDecoder(body).Decode(&payload); err != nil {
+		var tooLarge *http.MaxBytesError
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &tooLarge):
+			apierror.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		case gzipped && !errors.As(err, &syntaxErr) && !errors.As(err, &typeErr):
+			apierror.Error(w, "invalid gzip", http.StatusBadRequest)
+		default:
+			apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
+		}
 		return
 	}
+	// The gzip checksum is only verified at end of stream, past where the
+	// decoder stops reading, so corrupted data could otherwise slip through.
+	if gzipped {
+		if _, err := io.Copy(io.Discard, body); err != nil {
+			apierror.Error(w, "invalid gzip", http.StatusBadRequest)
+			return
+		}
+	}
 
 	if err := ValidatePayload(&payload); err != nil {
-		http.Error(w, `{"error":"`+err.Error()+`"}`, http.StatusBadRequest)
+		// The message stays the bare reason; details say which event and
+		// field it applies to.
+		var ve *ValidationError
+		if errors.As(err, &ve) {
+			apierror.ErrorDetails(w, apierror.CodeInvalidRequest, ve.Err.Error(), http.StatusBadRequest, map[string]any{
+				"index":  ve.Index,
+				"field":  ve.Field,
+				"reason": ve.Err.Error(),
+			})
+			return
+		}
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	userAgent := r.Header.Get("User-Agent")
 
+	// Excluded user agents (crawlers, synthetic monitors) get the usual
+	// success response so they don't retry, but nothing is stored.
+	if h.meta != nil && h.meta.BotFilter(r.Context(), project.ID).Match(userAgent) {
+		h.addDiscarded(project.ID, len(payload.Events))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{
+			"status":      "ok",
+			"accepted":    0,
+			"sampled_out": 0,
+		})
+		return
+	}
+
 	// Process $identify events: record the alias and backfill historical events.
+	identified := false
 	for _, e := range payload.Events {
 		if e.EventType != "$identify" {
 			continue
@@ -89,6 +198,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			if err := h.meta.SetIdentityAlias(r.Context(), project.ID, previousID, payload.DistinctID); err != nil {
 				log.Printf("ERROR setting identity alias: %v", err)
 			} else {
+				identified = true
 				merged, err := h.events.MergeDistinctID(r.Context(), project.ID, previousID, payload.DistinctID)
 				if err != nil {
 					log.Printf("ERROR merging distinct_id: %v", err)
@@ -109,14 +219,39 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// Per-project sampling drops whole sessions; errors are always kept.
+	keepSession, sampleRate := true, 1.0
+	if h.meta != nil {
+		sampleRate = h.meta.SampleRate(r.Context(), project.ID)
+		keepSession = KeepSession(payload.SessionID, sampleRate)
+	}
+
+	// Internal traffic is tagged rather than dropped so the project can
+	// choose at query time whether to count it.
+	internal := payload.Internal
+	if !internal && h.meta != nil {
+		internal = h.meta.InternalTraffic(r.Context(), project.ID).MatchIP(clientIP(r))
+	}
+	sampledOut := 0
+
+	var strategy storage.FingerprintStrategy
+	if h.meta != nil {
+		strategy = h.meta.FingerprintStrategy(r.Context(), project.ID)
+	}
+
 	events := make([]storage.Event, 0, len(payload.Events))
+	clientIDs := make([]string, 0, len(payload.Events))
 	for _, e := range payload.Events {
 		// Skip $identify meta-events — they are not stored as analytics events.
 		if e.EventType == "$identify" {
 			continue
 		}
+		if !keepSession && e.EventType != "error" {
+			sampledOut++
+			continue
+		}
 
-		fingerprint := ComputeFingerprint(
+		fingerprint := ComputeFingerprintWith(strategy,
 			e.ElementTag, e.ElementID, e.ElementClasses, e.ParentPath, e.URLPath,
 		)
 
@@ -125,6 +260,23 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			ts = time.Now().UTC()
 		}
 
+		// Only ingest sets the reserved properties below.
+		storage.StripReservedProperties(e.Properties)
+		if internal || hasInternalParam(e.URL) {
+			if e.Properties == nil {
+				e.Properties = map[string]any{}
+			}
+			e.Properties[storage.InternalProperty] = true
+		}
+		// Kept events carry the rate so counts can be scaled back up.
+		// Errors bypass sampling and so weigh 1.
+		if sampleRate < 1 && e.EventType != "error" {
+			if e.Properties == nil {
+				e.Properties = map[string]any{}
+			}
+			e.Properties[storage.SampleRateProperty] = sampleRate
+		}
+
 		events = append(events, storage.Event{
 			ProjectID:      project.ID,
 			SessionID:      payload.SessionID,
@@ -148,6 +300,7 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Timestamp:      ts,
 			Properties:     e.Properties,
 		})
+		clientIDs = append(clientIDs, e.ClientEventID)
 	}
 
 	if len(events) == 0 {
@@ -155,26 +308,41 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusAccepted)
 		json.NewEncoder(w).Encode(map[string]any{
-			"status":   "ok",
-			"accepted": 0,
+			"status":      "ok",
+			"accepted":    0,
+			"sampled_out": sampledOut,
 		})
 		return
 	}
 
 	if err := h.events.InsertEvents(r.Context(), events); err != nil {
 		log.Printf("ERROR inserting events: %v", err)
-		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
+	// Once this batch's identified events are stored, the session's earlier
+	// events sent without any ID can be attributed too.
+	if identified && resolvedDistinctID != "" {
+		if _, err := h.events.BackfillSessionDistinctID(r.Context(), project.ID, resolvedDistinctID); err != nil {
+			log.Printf("ERROR backfilling session distinct_id: %v", err)
+		}
+	}
+
+	h.recordUsage(w, r.Context(), project.ID, now, quota, int64(len(events)))
 	if h.OnIngested != nil {
 		go h.OnIngested(project.ID, int64(len(events)))
 	}
 
-	// Submit naming jobs for interaction events (not pageviews).
+	// Submit naming jobs for the event types the project has naming on for
+	// (by default interactions, not pageviews or metrics).
 	if h.namer != nil {
+		var namingTypes []string
+		if h.meta != nil {
+			namingTypes = h.meta.NamingEventTypes(r.Context(), project.ID)
+		}
 		for _, ev := range events {
-			if ev.EventType == "pageview" {
+			if !storage.NamesEventType(namingTypes, ev.EventType) {
 				continue
 			}
 			h.namer.Submit(r.Context(), ai.NamingJob{
@@ -197,8 +365,48 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]any{
-		"status":   "ok",
-		"accepted": len(events),
-	})
+	resp := map[string]any{
+		"status":      "ok",
+		"accepted":    len(events),
+		"sampled_out": sampledOut,
+	}
+	// ?ack=ids returns the stored IDs in batch order (sampled-out and
+	// $identify events are omitted) plus a client_event_id → id map.
+	if r.URL.Query().Get("ack") == "ids" {
+		ids := make([]string, len(events))
+		idMap := map[string]string{}
+		for i, ev := range events {
+			ids[i] = ev.ID
+			if clientIDs[i] != "" {
+				idMap[clientIDs[i]] = ev.ID
+			}
+		}
+		resp["ids"] = ids
+		resp["id_map"] = idMap
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// clientIP returns the caller's address: the first X-Forwarded-For hop when
+// behind a proxy, otherwise the connection's remote address. It is used only
+// to match internal traffic and is never stored.
+func clientIP(r *http.Request) string {
+	if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+		first, _, _ := strings.Cut(fwd, ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// hasInternalParam reports whether a page URL carries ?ch_internal=1.
+func hasInternalParam(raw string) bool {
+	if !strings.Contains(raw, storage.InternalParam) {
+		return false
+	}
+	u, err := url.Parse(raw)
+	return err == nil && u.Query().Get(storage.InternalParam) == "1"
 }
@@ -0,0 +1,73 @@
+package ingest
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+)
+
+// Headers reporting a project's monthly event quota on ingest responses.
+// They are only set when the project has a quota.
+const (
+	QuotaLimitHeader     = "X-ClickNest-Quota-Limit"
+	QuotaRemainingHeader = "X-ClickNest-Quota-Remaining"
+)
+
+// checkQuota answers 429 and returns false once the project has ingested its
+// monthly event quota. Otherwise it sets the quota headers and returns the
+// quota, 0 when there is none. A batch that starts under the quota is taken
+// whole, even if it ends over it.
+func (h *Handler) checkQuota(w http.ResponseWriter, ctx context.Context, projectID string, now time.Time) (int64, bool) {
+	if h.meta == nil {
+		return 0, true
+	}
+	quota := h.meta.EventQuota(ctx, projectID)
+	if quota == 0 {
+		return 0, true
+	}
+	used, err := h.meta.MonthlyEventUsage(ctx, projectID, now)
+	if err != nil {
+		// Fail open: a usage lookup error shouldn't lose events.
+		log.Printf("ERROR reading event usage for %s: %v", projectID, err)
+		return quota, true
+	}
+	setQuotaHeaders(w, quota, used)
+	if used >= quota {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(nextMonth(now).Sub(now).Seconds()))))
+		apierror.ErrorCode(w, apierror.CodeQuotaExceeded, "monthly event quota exceeded", http.StatusTooManyRequests)
+		return quota, false
+	}
+	return quota, true
+}
+
+// recordUsage adds n stored events to the project's monthly usage and
+// updates the remaining header to match. Usage is only tracked under a quota,
+// keeping unlimited projects, the default, off the metadata store; setting a
+// quota seeds the month's usage from the events already stored.
+func (h *Handler) recordUsage(w http.ResponseWriter, ctx context.Context, projectID string, now time.Time, quota, n int64) {
+	if h.meta == nil || n == 0 || quota == 0 {
+		return
+	}
+	used, err := h.meta.AddEventUsage(ctx, projectID, now, n)
+	if err != nil {
+		log.Printf("ERROR recording event usage for %s: %v", projectID, err)
+		return
+	}
+	setQuotaHeaders(w, quota, used)
+}
+
+func setQuotaHeaders(w http.ResponseWriter, quota, used int64) {
+	w.Header().Set(QuotaLimitHeader, strconv.FormatInt(quota, 10))
+	w.Header().Set(QuotaRemainingHeader, strconv.FormatInt(max(quota-used, 0), 10))
+}
+
+// nextMonth returns the start of the UTC month after t, when usage resets.
+func nextMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,21 @@
+package ingest
+
+import "hash/fnv"
+
+// sampleBuckets is the resolution of sampling decisions (0.01%).
+const sampleBuckets = 10000
+
+// KeepSession reports whether events from sessionID survive sampling at the
+// given rate (0–1). The decision is a pure function of the session ID, so a
+// session is always kept or dropped as a whole, across batches and servers.
+func KeepSession(sessionID string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	if rate <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte(sessionID))
+	return float64(h.Sum32()%sampleBuckets) < rate*sampleBuckets
+}
@@ -0,0 +1,50 @@
+package ingest
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestKeepSession_Consistent(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("sess-%d", i)
+		first := KeepSession(id, 0.3)
+		for j := 0; j < 5; j++ {
+			if KeepSession(id, 0.3) != first {
+				t.Fatalf("session %s sampled inconsistently", id)
+			}
+		}
+	}
+}
+
+func TestKeepSession_Rate(t *testing.T) {
+	kept := 0
+	const n = 20000
+	for i := 0; i < n; i++ {
+		if KeepSession(fmt.Sprintf("sess-%d", i), 0.25) {
+			kept++
+		}
+	}
+	if ratio := float64(kept) / n; ratio < 0.22 || ratio > 0.28 {
+		t.Fatalf("expected ~25%% of sessions kept, got %.3f", ratio)
+	}
+}
+
+func TestKeepSession_Bounds(t *testing.T) {
+	if !KeepSession("any", 1) {
+		t.Fatal("rate 1 must keep everything")
+	}
+	if KeepSession("any", 0) {
+		t.Fatal("rate 0 must drop everything")
+	}
+}
+
+func TestKeepSession_HigherRateIsSuperset(t *testing.T) {
+	// Raising the rate only adds sessions; already-kept sessions stay kept.
+	for i := 0; i < 1000; i++ {
+		id := fmt.Sprintf("sess-%d", i)
+		if KeepSession(id, 0.1) && !KeepSession(id, 0.5) {
+			t.Fatalf("session %s kept at 10%% but dropped at 50%%", id)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package ingest
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"strings"
 	"unicode/utf8"
@@ -15,21 +16,38 @@ var (
 	ErrMissingURL     = errors.New("url is required")
 	ErrInvalidURL     = errors.New("invalid url")
 	ErrMissingSession = errors.New("session_id is required")
+	ErrInvalidMetric  = errors.New("performance events require a metric name and numeric value in properties")
 )
 
+// ValidationError reports the event in a batch that failed validation, the
+// field at fault and why. Err is one of the Err values above.
+type ValidationError struct {
+	Index int    // position in the payload's events
+	Field string // JSON name of the field, e.g. "url" or "properties.value"
+	Err   error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("events[%d].%s: %v", e.Index, e.Field, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error { return e.Err }
+
 const maxBatchSize = 100
 const maxTextLength = 500
 
 var validEventTypes = map[string]bool{
-	"click":    true,
-	"pageview": true,
-	"input":    true,
-	"submit":   true,
-	"custom":   true,
-	"error":    true,
+	"click":       true,
+	"pageview":    true,
+	"input":       true,
+	"submit":      true,
+	"custom":      true,
+	"error":       true,
+	"performance": true,
 }
 
 // ValidatePayload checks the incoming ingestion request for required fields.
+// A bad event is reported as a *ValidationError.
 func ValidatePayload(p *IngestPayload) error {
 	if len(p.Events) == 0 {
 		return ErrEmptyBatch
@@ -41,25 +59,41 @@ func ValidatePayload(p *IngestPayload) error {
 		return ErrMissingSession
 	}
 	for i := range p.Events {
-		if err := validateEvent(&p.Events[i]); err != nil {
-			return err
+		if field, err := validateEvent(&p.Events[i]); err != nil {
+			return &ValidationError{Index: i, Field: field, Err: err}
 		}
 	}
 	return nil
 }
 
-func validateEvent(e *IngestEvent) error {
+// validateEvent checks and sanitizes one event, returning the name of the
+// offending field with any error.
+func validateEvent(e *IngestEvent) (string, error) {
 	if e.EventType == "" {
-		return ErrMissingType
+		return "event_type", ErrMissingType
 	}
 	if !validEventTypes[e.EventType] {
-		return ErrInvalidType
+		return "event_type", ErrInvalidType
 	}
 	if e.URL == "" {
-		return ErrMissingURL
+		return "url", ErrMissingURL
 	}
 	if _, err := url.ParseRequestURI(e.URL); err != nil {
-		return ErrInvalidURL
+		return "url", ErrInvalidURL
+	}
+	if e.EventType == "performance" {
+		if metric, _ := e.Properties["metric"].(string); strings.TrimSpace(metric) == "" {
+			return "properties.metric", ErrInvalidMetric
+		}
+		if _, ok := e.Properties["value"].(float64); !ok {
+			return "properties.value", ErrInvalidMetric
+		}
+	}
+
+	// Input events record which field was touched, never what was typed.
+	if e.EventType == "input" {
+		e.ElementText = ""
+		delete(e.Properties, "value")
 	}
 
 	// Sanitize text fields to prevent excessive storage.
@@ -67,6 +101,7 @@ func validateEvent(e *IngestEvent) error {
 	e.AriaLabel = truncate(e.AriaLabel, maxTextLength)
 	e.PageTitle = truncate(e.PageTitle, maxTextLength)
 	e.ParentPath = truncate(e.ParentPath, 1000)
+	e.ClientEventID = truncate(e.ClientEventID, 200)
 
 	// Derive url_path if not set.
 	if e.URLPath == "" {
@@ -75,7 +110,7 @@ func validateEvent(e *IngestEvent) error {
 		}
 	}
 
-	return nil
+	return "", nil
 }
 
 func truncate(s string, maxLen int) string {
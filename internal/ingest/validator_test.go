@@ -1,6 +1,7 @@
 package ingest
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -56,7 +57,7 @@ func TestValidatePayload_MissingSession(t *testing.T) {
 func TestValidatePayload_MissingEventType(t *testing.T) {
 	p := validPayload()
 	p.Events[0].EventType = ""
-	if err := ValidatePayload(&p); err != ErrMissingType {
+	if err := ValidatePayload(&p); !errors.Is(err, ErrMissingType) {
 		t.Fatalf("expected ErrMissingType, got: %v", err)
 	}
 }
@@ -64,11 +65,25 @@ func TestValidatePayload_MissingEventType(t *testing.T) {
 func TestValidatePayload_InvalidEventType(t *testing.T) {
 	p := validPayload()
 	p.Events[0].EventType = "hover"
-	if err := ValidatePayload(&p); err != ErrInvalidType {
+	if err := ValidatePayload(&p); !errors.Is(err, ErrInvalidType) {
 		t.Fatalf("expected ErrInvalidType, got: %v", err)
 	}
 }
 
+func TestValidatePayload_PerformanceEvent(t *testing.T) {
+	p := validPayload()
+	p.Events[0].EventType = "performance"
+	p.Events[0].Properties = map[string]any{"metric": "LCP", "value": 2450.5}
+	if err := ValidatePayload(&p); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	p.Events[0].Properties = map[string]any{"metric": "LCP", "value": "slow"}
+	if err := ValidatePayload(&p); !errors.Is(err, ErrInvalidMetric) {
+		t.Fatalf("expected ErrInvalidMetric, got: %v", err)
+	}
+}
+
 func TestValidatePayload_AllValidEventTypes(t *testing.T) {
 	for _, et := range []string{"click", "pageview", "input", "submit", "custom", "error"} {
 		p := validPayload()
@@ -82,7 +97,7 @@ func TestValidatePayload_AllValidEventTypes(t *testing.T) {
 func TestValidatePayload_MissingURL(t *testing.T) {
 	p := validPayload()
 	p.Events[0].URL = ""
-	if err := ValidatePayload(&p); err != ErrMissingURL {
+	if err := ValidatePayload(&p); !errors.Is(err, ErrMissingURL) {
 		t.Fatalf("expected ErrMissingURL, got: %v", err)
 	}
 }
@@ -90,7 +105,7 @@ func TestValidatePayload_MissingURL(t *testing.T) {
 func TestValidatePayload_InvalidURL(t *testing.T) {
 	p := validPayload()
 	p.Events[0].URL = "not a url"
-	if err := ValidatePayload(&p); err != ErrInvalidURL {
+	if err := ValidatePayload(&p); !errors.Is(err, ErrInvalidURL) {
 		t.Fatalf("expected ErrInvalidURL, got: %v", err)
 	}
 }
@@ -118,6 +133,24 @@ func TestValidatePayload_TruncatesLongText(t *testing.T) {
 	}
 }
 
+func TestValidatePayload_InputDropsValue(t *testing.T) {
+	p := validPayload()
+	p.Events[0].EventType = "input"
+	p.Events[0].ElementID = "email"
+	p.Events[0].ElementText = "jane@example.com"
+	p.Events[0].Properties = map[string]any{"field_name": "email", "value": "jane@example.com"}
+	if err := ValidatePayload(&p); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	e := p.Events[0]
+	if _, ok := e.Properties["value"]; ok || e.ElementText != "" {
+		t.Fatalf("expected the typed value stripped, got text %q properties %v", e.ElementText, e.Properties)
+	}
+	if e.ElementID != "email" || e.Properties["field_name"] != "email" {
+		t.Fatalf("expected field identity kept, got %+v", e)
+	}
+}
+
 func TestTruncate_ShortString(t *testing.T) {
 	s := truncate("hello", 10)
 	if s != "hello" {
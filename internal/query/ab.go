@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 )
 
@@ -18,14 +19,14 @@ type ABVariation struct {
 func (h *Handler) ABResultsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	campaignID := r.PathValue("id")
 	campaign, err := h.meta.GetCampaign(r.Context(), project.ID, campaignID)
 	if err != nil {
-		http.Error(w, `{"error":"campaign not found"}`, http.StatusNotFound)
+		apierror.Error(w, "campaign not found", http.StatusNotFound)
 		return
 	}
 
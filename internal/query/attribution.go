@@ -2,11 +2,10 @@ package query
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
-	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 )
 
@@ -14,7 +13,7 @@ import (
 func (h *Handler) AttributionHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -30,8 +29,7 @@ func (h *Handler) AttributionHandler(w http.ResponseWriter, r *http.Request) {
 
 	channels, err := h.events.QueryAttributionOverview(r.Context(), project.ID, start, end)
 	if err != nil {
-		log.Printf("ERROR querying attribution overview: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying attribution overview", err)
 		return
 	}
 
@@ -43,7 +41,7 @@ func (h *Handler) AttributionHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) AttributionSourcesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -56,20 +54,14 @@ func (h *Handler) AttributionSourcesHandler(w http.ResponseWriter, r *http.Reque
 	if v := q.Get("end"); v != "" {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
-	limit := 50
-	if v := q.Get("limit"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			limit = n
-		}
-	}
+	limit := h.limit(r, 50)
 
 	sources, err := h.events.QueryAttribution(r.Context(), project.ID, start, end, limit)
 	if err != nil {
-		log.Printf("ERROR querying attribution sources: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying attribution sources", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"sources": sources})
+	json.NewEncoder(w).Encode(map[string]any{"sources": sources, "limit": limit})
 }
@@ -2,10 +2,10 @@ package query
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
@@ -15,14 +15,14 @@ import (
 func (h *Handler) ConversionGoalResultsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	goalID := r.PathValue("id")
 	goal, err := h.meta.GetConversionGoal(r.Context(), project.ID, goalID)
 	if err != nil {
-		http.Error(w, `{"error":"goal not found"}`, http.StatusNotFound)
+		apierror.Error(w, "goal not found", http.StatusNotFound)
 		return
 	}
 
@@ -50,8 +50,7 @@ func (h *Handler) ConversionGoalResultsHandler(w http.ResponseWriter, r *http.Re
 
 	attributions, err := h.events.QueryConversionsByGoal(r.Context(), project.ID, criteria, model, start, end)
 	if err != nil {
-		log.Printf("ERROR querying conversion goal results: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying conversion goal results", err)
 		return
 	}
 
@@ -78,7 +77,7 @@ func (h *Handler) ConversionGoalResultsHandler(w http.ResponseWriter, r *http.Re
 func (h *Handler) RevenueAttributionHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -96,7 +95,7 @@ func (h *Handler) RevenueAttributionHandler(w http.ResponseWriter, r *http.Reque
 	if goalID := q.Get("goal_id"); goalID != "" {
 		goal, err := h.meta.GetConversionGoal(r.Context(), project.ID, goalID)
 		if err != nil {
-			http.Error(w, `{"error":"goal not found"}`, http.StatusNotFound)
+			apierror.Error(w, "goal not found", http.StatusNotFound)
 			return
 		}
 		criteria = storage.GoalCriteria{
@@ -115,8 +114,7 @@ func (h *Handler) RevenueAttributionHandler(w http.ResponseWriter, r *http.Reque
 
 	overview, err := h.events.QueryRevenueOverview(r.Context(), project.ID, criteria, start, end)
 	if err != nil {
-		log.Printf("ERROR querying revenue attribution: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying revenue attribution", err)
 		return
 	}
 
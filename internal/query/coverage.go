@@ -0,0 +1,86 @@
+package query
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// NamingCoverageHandler handles GET /api/v1/naming/coverage — whether AI
+// naming is keeping up with new interaction fingerprints. Each day reports
+// the fingerprints first seen that day, how many of them are still unnamed,
+// and how many names were generated that day. coverage_pct is the share of
+// the window's new fingerprints that have a name, or null when there are none.
+func (h *Handler) NamingCoverageHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	end := time.Now().UTC()
+	start := end.Add(-30 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+
+	points, err := h.events.QueryNamingCoverage(r.Context(), project.ID, start, end)
+	if err != nil {
+		queryError(w, r, "querying naming coverage", err)
+		return
+	}
+	named, err := h.meta.CountEventNamesByDay(r.Context(), project.ID, start, end)
+	if err != nil {
+		queryError(w, r, "counting generated names", err)
+		return
+	}
+
+	// Merge in days where names were generated but no new fingerprints appeared.
+	byDay := make(map[string]int, len(points))
+	for i := range points {
+		points[i].Bucket, _, _ = strings.Cut(points[i].Bucket, " ")
+		byDay[points[i].Bucket] = i
+	}
+	for day, n := range named {
+		if i, ok := byDay[day]; ok {
+			points[i].Named = n
+		} else {
+			points = append(points, storage.NamingCoveragePoint{Bucket: day, Named: n})
+		}
+	}
+	slices.SortFunc(points, func(a, b storage.NamingCoveragePoint) int {
+		return strings.Compare(a.Bucket, b.Bucket)
+	})
+
+	var total, unnamed int64
+	for _, p := range points {
+		total += p.NewFingerprints
+		unnamed += p.Unnamed
+	}
+	var coverage *float64
+	if total > 0 {
+		pct := float64(total-unnamed) / float64(total) * 100
+		coverage = &pct
+	}
+	if points == nil {
+		points = []storage.NamingCoveragePoint{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"data":             points,
+		"new_fingerprints": total,
+		"unnamed":          unnamed,
+		"coverage_pct":     coverage,
+	})
+}
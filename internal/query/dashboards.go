@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
@@ -13,14 +14,13 @@ import (
 func (h *Handler) ListDashboardsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	dashboards, err := h.meta.ListDashboards(r.Context(), project.ID)
 	if err != nil {
-		log.Printf("ERROR listing dashboards: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "listing dashboards", err)
 		return
 	}
 
@@ -32,7 +32,7 @@ func (h *Handler) ListDashboardsHandler(w http.ResponseWriter, r *http.Request)
 func (h *Handler) CreateDashboardHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -41,17 +41,17 @@ func (h *Handler) CreateDashboardHandler(w http.ResponseWriter, r *http.Request)
 		Config json.RawMessage `json:"config"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if body.Name == "" || len(body.Config) == 0 {
-		http.Error(w, `{"error":"name and config required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name and config required", http.StatusBadRequest)
 		return
 	}
 
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	d := storage.Dashboard{
@@ -63,7 +63,7 @@ func (h *Handler) CreateDashboardHandler(w http.ResponseWriter, r *http.Request)
 
 	if err := h.meta.CreateDashboard(r.Context(), d); err != nil {
 		log.Printf("ERROR creating dashboard: %v", err)
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -76,14 +76,14 @@ func (h *Handler) CreateDashboardHandler(w http.ResponseWriter, r *http.Request)
 func (h *Handler) GetDashboardHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	d, err := h.meta.GetDashboard(r.Context(), project.ID, id)
 	if err != nil {
-		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		apierror.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
@@ -95,7 +95,7 @@ func (h *Handler) GetDashboardHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) UpdateDashboardHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -105,7 +105,7 @@ func (h *Handler) UpdateDashboardHandler(w http.ResponseWriter, r *http.Request)
 		Config json.RawMessage `json:"config"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 
@@ -118,7 +118,7 @@ func (h *Handler) UpdateDashboardHandler(w http.ResponseWriter, r *http.Request)
 
 	if err := h.meta.UpdateDashboard(r.Context(), d); err != nil {
 		log.Printf("ERROR updating dashboard: %v", err)
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -130,14 +130,14 @@ func (h *Handler) UpdateDashboardHandler(w http.ResponseWriter, r *http.Request)
 func (h *Handler) DeleteDashboardHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	if err := h.meta.DeleteDashboard(r.Context(), project.ID, id); err != nil {
 		log.Printf("ERROR deleting dashboard: %v", err)
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -4,9 +4,9 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
-	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
@@ -15,7 +15,7 @@ import (
 func (h *Handler) ErrorGroupsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -28,17 +28,11 @@ func (h *Handler) ErrorGroupsHandler(w http.ResponseWriter, r *http.Request) {
 	if v := q.Get("end"); v != "" {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
-	limit := 50
-	if v := q.Get("limit"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			limit = n
-		}
-	}
+	limit := h.limit(r, 50)
 
 	groups, totalCount, err := h.events.QueryErrorGroups(r.Context(), project.ID, start, end, limit)
 	if err != nil {
-		log.Printf("ERROR querying error groups: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying error groups", err)
 		return
 	}
 
@@ -64,6 +58,7 @@ func (h *Handler) ErrorGroupsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{
 		"groups":      groups,
 		"total_count": totalCount,
+		"limit":       limit,
 	})
 }
 
@@ -71,14 +66,14 @@ func (h *Handler) ErrorGroupsHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) ErrorDetailHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	q := r.URL.Query()
 	message := q.Get("message")
 	if message == "" {
-		http.Error(w, `{"error":"message parameter required"}`, http.StatusBadRequest)
+		apierror.Error(w, "message parameter required", http.StatusBadRequest)
 		return
 	}
 
@@ -90,12 +85,7 @@ func (h *Handler) ErrorDetailHandler(w http.ResponseWriter, r *http.Request) {
 	if v := q.Get("end"); v != "" {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
-	limit := 50
-	if v := q.Get("limit"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			limit = n
-		}
-	}
+	limit := h.limit(r, 50)
 
 	filter := storage.EventFilter{
 		ProjectID:     project.ID,
@@ -109,8 +99,7 @@ func (h *Handler) ErrorDetailHandler(w http.ResponseWriter, r *http.Request) {
 
 	events, err := h.events.QueryEvents(r.Context(), filter)
 	if err != nil {
-		log.Printf("ERROR querying error detail: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying error detail", err)
 		return
 	}
 
@@ -134,5 +123,6 @@ func (h *Handler) ErrorDetailHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{
 		"events":      events,
 		"source_link": sourceLink,
+		"limit":       limit,
 	})
 }
@@ -1,22 +1,26 @@
 package query
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
 
 // EventsHandler handles GET /api/v1/events — list events with filters.
+// fields=id,event_type,... returns only those event fields.
 func (h *Handler) EventsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -30,10 +34,19 @@ func (h *Handler) EventsHandler(w http.ResponseWriter, r *http.Request) {
 		DistinctID:    q.Get("distinct_id"),
 		PropertyKey:   q.Get("property_key"),
 		PropertyValue: q.Get("property_value"),
+		Referrer:      q.Get("referrer"),
+		UTMSource:     q.Get("utm_source"),
+		UTMMedium:     q.Get("utm_medium"),
+		UTMCampaign:   q.Get("utm_campaign"),
 	}
 
-	if v := q.Get("limit"); v != "" {
-		filter.Limit, _ = strconv.Atoi(v)
+	filter.Limit = h.limit(r, 100)
+	if v := q.Get("cursor"); v != "" {
+		var err error
+		if filter.BeforeTimestamp, filter.BeforeID, err = decodeEventCursor(v); err != nil {
+			apierror.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
 	}
 	if v := q.Get("offset"); v != "" {
 		filter.Offset, _ = strconv.Atoi(v)
@@ -45,10 +58,18 @@ func (h *Handler) EventsHandler(w http.ResponseWriter, r *http.Request) {
 		filter.EndTime, _ = time.Parse(time.RFC3339, v)
 	}
 
+	var fields []string
+	if v := q.Get("fields"); v != "" {
+		var err error
+		if fields, err = parseEventFields(v); err != nil {
+			apierror.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	events, err := h.events.QueryEvents(r.Context(), filter)
 	if err != nil {
-		log.Printf("ERROR querying events: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying events", err)
 		return
 	}
 
@@ -76,11 +97,9 @@ func (h *Handler) EventsHandler(w http.ResponseWriter, r *http.Request) {
 			continue
 		}
 		// Always prefer the cache (freshest) over the denormalized DuckDB name.
-		name := en.AIName
-		if en.UserName != nil && *en.UserName != "" {
-			name = *en.UserName
+		if name := en.DisplayName(); name != "" {
+			events[i].EventName = &name
 		}
-		events[i].EventName = &name
 		if en.SourceFile != nil && *en.SourceFile != "" {
 			events[i].SourceFile = *en.SourceFile
 			if ghURLPrefix != "" {
@@ -89,18 +108,168 @@ func (h *Handler) EventsHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// A full page may have more behind it; a short one is the end.
+	var nextCursor string
+	if len(events) == filter.Limit {
+		last := events[len(events)-1]
+		nextCursor = encodeEventCursor(last.Timestamp, last.ID)
+	}
+
+	var body any = events
+	if fields != nil {
+		if body, err = selectEventFields(events, fields); err != nil {
+			queryError(w, r, "selecting event fields", err)
+			return
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"events": events,
-		"count":  len(events),
+		"events":      body,
+		"count":       len(events),
+		"limit":       filter.Limit,
+		"next_cursor": nextCursor,
 	})
 }
 
+// eventFields is the set of JSON field names on an event.
+var eventFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeFor[storage.Event]()
+	for i := range t.NumField() {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		fields[name] = true
+	}
+	return fields
+}()
+
+// parseEventFields parses a comma-separated ?fields= list, rejecting names
+// that aren't event fields.
+func parseEventFields(v string) ([]string, error) {
+	fields := []string{}
+	for f := range strings.SplitSeq(v, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !eventFields[f] {
+			return nil, fmt.Errorf("unknown event field %q", f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// selectEventFields marshals each event to a map holding only fields. Fields
+// an event omits when empty stay omitted.
+func selectEventFields(events []storage.Event, fields []string) ([]map[string]json.RawMessage, error) {
+	out := make([]map[string]json.RawMessage, len(events))
+	for i, e := range events {
+		b, err := json.Marshal(e)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(b, &all); err != nil {
+			return nil, err
+		}
+		out[i] = make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if v, ok := all[f]; ok {
+				out[i][f] = v
+			}
+		}
+	}
+	return out, nil
+}
+
+// eventCursor is the decoded form of the opaque ?cursor= token: the
+// timestamp (Unix microseconds, DuckDB's precision) and ID of the last event
+// on the previous page.
+type eventCursor struct {
+	T  int64  `json:"t"`
+	ID string `json:"id"`
+}
+
+func encodeEventCursor(ts time.Time, id string) string {
+	b, _ := json.Marshal(eventCursor{T: ts.UnixMicro(), ID: id})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeEventCursor(s string) (time.Time, string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	var c eventCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return time.Time{}, "", err
+	}
+	if c.T <= 0 || c.ID == "" {
+		return time.Time{}, "", fmt.Errorf("incomplete cursor")
+	}
+	return time.UnixMicro(c.T).UTC(), c.ID, nil
+}
+
+// DeleteEventsHandler handles DELETE /api/v1/events — remove the events
+// matching the same filters EventsHandler takes. At least one filter is
+// required, and malformed times are rejected rather than ignored so a typo
+// can't widen what gets deleted.
+func (h *Handler) DeleteEventsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	filter := storage.EventFilter{
+		ProjectID:     project.ID,
+		EventType:     q.Get("event_type"),
+		EventName:     q.Get("event_name"),
+		Fingerprint:   q.Get("fingerprint"),
+		SessionID:     q.Get("session_id"),
+		DistinctID:    q.Get("distinct_id"),
+		PropertyKey:   q.Get("property_key"),
+		PropertyValue: q.Get("property_value"),
+		Referrer:      q.Get("referrer"),
+		UTMSource:     q.Get("utm_source"),
+		UTMMedium:     q.Get("utm_medium"),
+		UTMCampaign:   q.Get("utm_campaign"),
+	}
+	for name, dst := range map[string]*time.Time{"start": &filter.StartTime, "end": &filter.EndTime} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			apierror.Error(w, name+" must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		*dst = t
+	}
+	if !filter.Narrowed() {
+		apierror.Error(w, "at least one filter is required", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := h.events.DeleteEvents(r.Context(), filter)
+	if err != nil {
+		queryError(w, r, "deleting events", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"deleted": deleted})
+}
+
 // EventStatsHandler handles GET /api/v1/events/stats — top named events by frequency.
+// sparkline=true adds each event's daily count over the range.
 func (h *Handler) EventStatsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -113,20 +282,23 @@ func (h *Handler) EventStatsHandler(w http.ResponseWriter, r *http.Request) {
 	if v := q.Get("end"); v != "" {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
-	limit := 50
-	if v := q.Get("limit"); v != "" {
-		limit, _ = strconv.Atoi(v)
-	}
+	limit := h.limit(r, 50)
 
 	stats, err := h.events.QueryTopEventNames(r.Context(), project.ID, start, end, limit)
 	if err != nil {
-		log.Printf("ERROR querying event stats: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying event stats", err)
 		return
 	}
+	if q.Get("sparkline") == "true" {
+		if err := h.events.AttachEventSparklines(r.Context(), project.ID, stats, start, end); err != nil {
+			queryError(w, r, "querying event sparklines", err)
+			return
+		}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"stats": stats,
+		"limit": limit,
 	})
 }
@@ -2,9 +2,9 @@ package query
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
@@ -23,14 +23,14 @@ type ExperimentResultsResponse struct {
 func (h *Handler) ExperimentResultsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	expID := r.PathValue("id")
 	exp, err := h.meta.GetExperiment(r.Context(), project.ID, expID)
 	if err != nil {
-		http.Error(w, `{"error":"experiment not found"}`, http.StatusNotFound)
+		apierror.Error(w, "experiment not found", http.StatusNotFound)
 		return
 	}
 
@@ -59,8 +59,7 @@ func (h *Handler) ExperimentResultsHandler(w http.ResponseWriter, r *http.Reques
 
 	results, err := h.events.QueryExperimentResults(r.Context(), project.ID, exp.FlagKey, variants, goal, start, end)
 	if err != nil {
-		log.Printf("ERROR querying experiment results: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying experiment results", err)
 		return
 	}
 
@@ -140,14 +139,14 @@ func (h *Handler) ExperimentResultsHandler(w http.ResponseWriter, r *http.Reques
 func (h *Handler) ExperimentSampleSizeHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	expID := r.PathValue("id")
 	exp, err := h.meta.GetExperiment(r.Context(), project.ID, expID)
 	if err != nil {
-		http.Error(w, `{"error":"experiment not found"}`, http.StatusNotFound)
+		apierror.Error(w, "experiment not found", http.StatusNotFound)
 		return
 	}
 
@@ -162,7 +161,7 @@ func (h *Handler) ExperimentSampleSizeHandler(w http.ResponseWriter, r *http.Req
 
 	results, err := h.events.QueryExperimentResults(r.Context(), project.ID, exp.FlagKey, variants, nil, start, end)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -0,0 +1,145 @@
+package query
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// exportPageSize is how many events are read per query while streaming a
+// user export, so large histories never sit in memory at once.
+const exportPageSize = 1000
+
+// UserExportHandler handles GET /api/v1/users/{id}/export — every event for a
+// distinct ID (and anonymous IDs aliased to it) for a data-subject access
+// request. ?format=csv returns CSV; the default is JSON.
+func (h *Handler) UserExportHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	distinctID := r.PathValue("id")
+	if distinctID == "" {
+		apierror.Error(w, "user id required", http.StatusBadRequest)
+		return
+	}
+	h.writeUserExport(w, r, project.ID, distinctID)
+}
+
+// SelfServeExportHandler handles GET /api/v1/gdpr/export?token=... — the same
+// export, authenticated by a signed user token instead of a session.
+func (h *Handler) SelfServeExportHandler(w http.ResponseWriter, r *http.Request) {
+	tok, err := auth.VerifyUserToken(h.meta.Encryptor(), r.URL.Query().Get("token"), auth.PurposeExport)
+	if err != nil {
+		apierror.Error(w, "invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+	h.writeUserExport(w, r, tok.ProjectID, tok.DistinctID)
+}
+
+func (h *Handler) writeUserExport(w http.ResponseWriter, r *http.Request, projectID, distinctID string) {
+	ctx := r.Context()
+	aliases, err := h.meta.ListAliases(ctx, projectID, distinctID)
+	if err != nil {
+		log.Printf("ERROR user export: listing aliases: %v", err)
+		apierror.Error(w, "export failed", http.StatusInternalServerError)
+		return
+	}
+	ids := append([]string{distinctID}, aliases...)
+
+	csvFormat := r.URL.Query().Get("format") == "csv"
+	filename := "user-export-" + time.Now().UTC().Format("20060102")
+	if csvFormat {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.csv"`)
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+	}
+
+	// Headers are sent with the first write, so errors past this point can
+	// only be logged and the stream cut short.
+	var cw *csv.Writer
+	if csvFormat {
+		cw = csv.NewWriter(w)
+		cw.Write([]string{"id", "timestamp", "distinct_id", "session_id", "event_type", "event_name", "url", "url_path", "page_title", "referrer", "element_text", "properties"})
+	} else {
+		head, _ := json.Marshal(map[string]any{"distinct_id": distinctID, "aliases": aliases})
+		w.Write(head[:len(head)-1])
+		w.Write([]byte(`,"events":[`))
+	}
+
+	first := true
+	for _, id := range ids {
+		// Page by keyset rather than offset so events arriving mid-export
+		// neither shift rows into a page twice nor push them past the end.
+		filter := storage.EventFilter{ProjectID: projectID, DistinctID: id, Limit: exportPageSize}
+		for {
+			events, err := h.events.QueryEvents(ctx, filter)
+			if err != nil {
+				log.Printf("ERROR user export: querying events: %v", err)
+				return
+			}
+			h.resolveNames(r, projectID, events)
+			for _, e := range events {
+				if csvFormat {
+					name := ""
+					if e.EventName != nil {
+						name = *e.EventName
+					}
+					props, _ := json.Marshal(e.Properties)
+					cw.Write([]string{e.ID, e.Timestamp.Format(time.RFC3339Nano), e.DistinctID, e.SessionID, e.EventType, name, e.URL, e.URLPath, e.PageTitle, e.Referrer, e.ElementText, string(props)})
+					continue
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				if !first {
+					w.Write([]byte{','})
+				}
+				first = false
+				w.Write(data)
+			}
+			if cw != nil {
+				cw.Flush()
+			}
+			if len(events) < exportPageSize {
+				break
+			}
+			last := events[len(events)-1]
+			filter.BeforeTimestamp, filter.BeforeID = last.Timestamp, last.ID
+		}
+	}
+	if !csvFormat {
+		w.Write([]byte("]}\n"))
+	}
+}
+
+// resolveNames replaces each event's stored name with the current display
+// name from the naming cache.
+func (h *Handler) resolveNames(r *http.Request, projectID string, events []storage.Event) {
+	fps := make([]string, 0, len(events))
+	seen := make(map[string]bool, len(events))
+	for _, e := range events {
+		if !seen[e.Fingerprint] {
+			fps = append(fps, e.Fingerprint)
+			seen[e.Fingerprint] = true
+		}
+	}
+	names, _ := h.meta.BatchGetEventNames(r.Context(), projectID, fps)
+	for i := range events {
+		if en, ok := names[events[i].Fingerprint]; ok {
+			if name := en.DisplayName(); name != "" {
+				events[i].EventName = &name
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package query
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+)
+
+// FormFieldsHandler handles GET /api/v1/forms/{path}/fields — per-field
+// interaction and drop-off for the form on a page, from input events. The
+// page path is one URL-escaped segment (%2Fsignup for /signup).
+func (h *Handler) FormFieldsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	urlPath := r.PathValue("path")
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+	q := r.URL.Query()
+	end := time.Now().UTC()
+	start := end.Add(-7 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+
+	fields, err := h.events.QueryFormFieldEngagement(r.Context(), project.ID, urlPath, start, end)
+	if err != nil {
+		queryError(w, r, "querying form fields", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"path": urlPath, "fields": fields})
+}
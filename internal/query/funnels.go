@@ -2,28 +2,36 @@ package query
 
 import (
 	"crypto/rand"
+	"database/sql"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
 
+// maxFunnelWindowHours caps a funnel's conversion window at a year.
+const maxFunnelWindowHours = 24 * 365
+
+const errFunnelWindow = "window_hours must be between 0 and 8760"
+
 // ListFunnelsHandler handles GET /api/v1/funnels.
 func (h *Handler) ListFunnelsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	funnels, err := h.meta.ListFunnels(r.Context(), project.ID)
 	if err != nil {
-		log.Printf("ERROR listing funnels: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "listing funnels", err)
 		return
 	}
 
@@ -35,44 +43,38 @@ func (h *Handler) ListFunnelsHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) CreateFunnelHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	var body struct {
-		Name  string             `json:"name"`
-		Steps []storage.FunnelStep `json:"steps"`
-	}
+	var body funnelRequest
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
-		return
-	}
-	if body.Name == "" || len(body.Steps) < 2 {
-		http.Error(w, `{"error":"name and at least 2 steps required"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
-
-	stepsJSON, err := json.Marshal(body.Steps)
+	stepsJSON, err := body.validate()
 	if err != nil {
-		http.Error(w, `{"error":"invalid steps"}`, http.StatusBadRequest)
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	funnel := storage.Funnel{
-		ID:        id,
-		ProjectID: project.ID,
-		Name:      body.Name,
-		Steps:     string(stepsJSON),
+		ID:          id,
+		ProjectID:   project.ID,
+		Name:        body.Name,
+		Steps:       string(stepsJSON),
+		WindowHours: body.WindowHours,
+		Mode:        body.Mode,
 	}
 
 	if err := h.meta.CreateFunnel(r.Context(), funnel); err != nil {
 		log.Printf("ERROR creating funnel: %v", err)
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -86,14 +88,14 @@ func (h *Handler) CreateFunnelHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) GetFunnelHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	funnel, err := h.meta.GetFunnel(r.Context(), project.ID, id)
 	if err != nil {
-		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		apierror.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
@@ -105,14 +107,14 @@ func (h *Handler) GetFunnelHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DeleteFunnelHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	if err := h.meta.DeleteFunnel(r.Context(), project.ID, id); err != nil {
 		log.Printf("ERROR deleting funnel: %v", err)
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -120,24 +122,103 @@ func (h *Handler) DeleteFunnelHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// UpdateFunnelHandler handles PUT /api/v1/funnels/{id}, replacing the
+// funnel's definition under the same ID so saved references keep working.
+func (h *Handler) UpdateFunnelHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	funnel, err := h.meta.GetFunnel(r.Context(), project.ID, r.PathValue("id"))
+	if err != nil {
+		apierror.Error(w, "funnel not found", http.StatusNotFound)
+		return
+	}
+	var body funnelRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
+		return
+	}
+	stepsJSON, err := body.validate()
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	funnel.Name = body.Name
+	funnel.Steps = string(stepsJSON)
+	funnel.WindowHours = body.WindowHours
+	funnel.Mode = body.Mode
+	if err := h.meta.UpdateFunnel(r.Context(), *funnel); errors.Is(err, sql.ErrNoRows) {
+		apierror.Error(w, "funnel not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("ERROR updating funnel: %v", err)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(funnel)
+}
+
+// funnelRequest is the body of funnel create and update requests.
+type funnelRequest struct {
+	Name        string               `json:"name"`
+	Steps       []storage.FunnelStep `json:"steps"`
+	WindowHours int                  `json:"window_hours"`
+	Mode        string               `json:"mode"`
+}
+
+// validate checks the request, defaulting its mode, and returns its steps
+// as stored.
+func (b *funnelRequest) validate() ([]byte, error) {
+	if b.Name == "" || len(b.Steps) < 2 {
+		return nil, errors.New("name and at least 2 steps required")
+	}
+	if err := storage.ValidateFunnelSteps(b.Steps); err != nil {
+		return nil, err
+	}
+	if b.WindowHours < 0 || b.WindowHours > maxFunnelWindowHours {
+		return nil, errors.New(errFunnelWindow)
+	}
+	switch b.Mode {
+	case "":
+		b.Mode = storage.FunnelOrdered
+	case storage.FunnelOrdered, storage.FunnelUnordered:
+	default:
+		return nil, errors.New("mode must be ordered or unordered")
+	}
+	stepsJSON, err := json.Marshal(b.Steps)
+	if err != nil {
+		return nil, errors.New("invalid steps")
+	}
+	return stepsJSON, nil
+}
+
 // FunnelResultsHandler handles GET /api/v1/funnels/{id}/results.
+// segment=<id>, utm_source/utm_medium/utm_campaign and
+// property_key/property_value restrict the population entering the first
+// step to a saved segment's members or sessions carrying those values.
 func (h *Handler) FunnelResultsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	funnel, err := h.meta.GetFunnel(r.Context(), project.ID, id)
 	if err != nil {
-		http.Error(w, `{"error":"funnel not found"}`, http.StatusNotFound)
+		apierror.Error(w, "funnel not found", http.StatusNotFound)
 		return
 	}
 
 	var steps []storage.FunnelStep
 	if err := json.Unmarshal([]byte(funnel.Steps), &steps); err != nil {
-		http.Error(w, `{"error":"invalid funnel steps"}`, http.StatusInternalServerError)
+		apierror.Error(w, "invalid funnel steps", http.StatusInternalServerError)
 		return
 	}
 
@@ -151,35 +232,166 @@ func (h *Handler) FunnelResultsHandler(w http.ResponseWriter, r *http.Request) {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
 
-	results, err := h.events.QueryFunnel(r.Context(), project.ID, steps, start, end)
+	// ?window_hours= overrides the funnel's stored conversion window; 0
+	// removes it.
+	windowHours := funnel.WindowHours
+	if v := q.Get("window_hours"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxFunnelWindowHours {
+			apierror.Error(w, errFunnelWindow, http.StatusBadRequest)
+			return
+		}
+		windowHours = n
+	}
+
+	pop := storage.FunnelPopulation{
+		UTMSource:     q.Get("utm_source"),
+		UTMMedium:     q.Get("utm_medium"),
+		UTMCampaign:   q.Get("utm_campaign"),
+		PropertyKey:   q.Get("property_key"),
+		PropertyValue: q.Get("property_value"),
+	}
+	if v := q.Get("segment"); v != "" {
+		ids, ok := h.segmentPopulation(w, r, project.ID, v, start, end)
+		if !ok {
+			return
+		}
+		pop.DistinctIDs = ids
+	}
+
+	results, err := h.events.QueryFunnel(r.Context(), project.ID, steps, start, end, time.Duration(windowHours)*time.Hour, funnel.Mode, pop)
+	if errors.Is(err, storage.ErrFunnelTooLarge) {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		log.Printf("ERROR querying funnel results: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying funnel results", err)
 		return
 	}
 
+	resp := map[string]any{"results": results, "window_hours": windowHours, "mode": funnel.Mode}
+
+	// ?breakdown=<property> adds the step counts per value of that event
+	// property, for the top values by sessions entering the funnel.
+	if prop := q.Get("breakdown"); prop != "" {
+		breakdown, err := h.events.QueryFunnelBreakdown(r.Context(), project.ID, steps, prop, start, end, time.Duration(windowHours)*time.Hour, funnel.Mode, pop)
+		if err != nil {
+			queryError(w, r, "querying funnel breakdown", err)
+			return
+		}
+		resp["breakdown"] = breakdown
+		resp["breakdown_property"] = prop
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"results": results})
+	json.NewEncoder(w).Encode(resp)
+}
+
+// FunnelConvertersHandler handles GET /api/v1/funnels/{id}/converters — the
+// sessions that completed the funnel under its stored window and mode, most
+// recent first, paged with limit and offset.
+func (h *Handler) FunnelConvertersHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	funnel, err := h.meta.GetFunnel(r.Context(), project.ID, id)
+	if err != nil {
+		apierror.Error(w, "funnel not found", http.StatusNotFound)
+		return
+	}
+
+	var steps []storage.FunnelStep
+	if err := json.Unmarshal([]byte(funnel.Steps), &steps); err != nil {
+		apierror.Error(w, "invalid funnel steps", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	end := time.Now().UTC()
+	start := end.Add(-30 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+	limit := h.limit(r, 50)
+	offset := 0
+	if v := q.Get("offset"); v != "" {
+		offset, _ = strconv.Atoi(v)
+	}
+	offset = max(offset, 0)
+
+	converters, total, err := h.events.QueryFunnelConverters(r.Context(), project.ID, steps, start, end,
+		time.Duration(funnel.WindowHours)*time.Hour, funnel.Mode, limit, offset)
+	if errors.Is(err, storage.ErrFunnelTooLarge) {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		queryError(w, r, "querying funnel converters", err)
+		return
+	}
+	if converters == nil {
+		converters = []storage.FunnelConverter{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"converters": converters,
+		"total":      total,
+		"limit":      limit,
+		"offset":     offset,
+	})
+}
+
+// segmentPopulation expands a saved segment into the distinct IDs of its
+// members over start–end, writing the error response when it cannot.
+func (h *Handler) segmentPopulation(w http.ResponseWriter, r *http.Request, projectID, segmentID string, start, end time.Time) ([]string, bool) {
+	seg, err := h.meta.GetSegment(r.Context(), projectID, segmentID)
+	if err != nil {
+		apierror.Error(w, "segment not found", http.StatusNotFound)
+		return nil, false
+	}
+	var conditions []storage.ScoringRule
+	if err := json.Unmarshal([]byte(seg.Conditions), &conditions); err != nil {
+		apierror.Error(w, "invalid segment conditions", http.StatusBadRequest)
+		return nil, false
+	}
+	members, err := h.events.SegmentMembers(r.Context(), projectID, conditions, start, end)
+	if err != nil {
+		queryError(w, r, "expanding funnel segment", err)
+		return nil, false
+	}
+	ids := make([]string, len(members))
+	for i, m := range members {
+		ids[i] = m.DistinctID
+	}
+	return ids, true
 }
 
 // FunnelCohortsHandler handles GET /api/v1/funnels/{id}/cohorts.
 func (h *Handler) FunnelCohortsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	id := r.PathValue("id")
 	funnel, err := h.meta.GetFunnel(r.Context(), project.ID, id)
 	if err != nil {
-		http.Error(w, `{"error":"funnel not found"}`, http.StatusNotFound)
+		apierror.Error(w, "funnel not found", http.StatusNotFound)
 		return
 	}
 
 	var steps []storage.FunnelStep
 	if err := json.Unmarshal([]byte(funnel.Steps), &steps); err != nil {
-		http.Error(w, `{"error":"invalid funnel steps"}`, http.StatusInternalServerError)
+		apierror.Error(w, "invalid funnel steps", http.StatusInternalServerError)
 		return
 	}
 
@@ -199,9 +411,12 @@ func (h *Handler) FunnelCohortsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	cohorts, err := h.events.QueryFunnelCohorts(r.Context(), project.ID, steps, interval, start, end)
+	if errors.Is(err, storage.ErrFunnelTooLarge) {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
-		log.Printf("ERROR querying funnel cohorts: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying funnel cohorts", err)
 		return
 	}
 
@@ -209,6 +424,57 @@ func (h *Handler) FunnelCohortsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{"cohorts": cohorts})
 }
 
+// FunnelTrendHandler handles GET /api/v1/funnels/{id}/trend — the funnel's
+// overall conversion rate per period (default weekly).
+func (h *Handler) FunnelTrendHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	id := r.PathValue("id")
+	funnel, err := h.meta.GetFunnel(r.Context(), project.ID, id)
+	if err != nil {
+		apierror.Error(w, "funnel not found", http.StatusNotFound)
+		return
+	}
+
+	var steps []storage.FunnelStep
+	if err := json.Unmarshal([]byte(funnel.Steps), &steps); err != nil {
+		apierror.Error(w, "invalid funnel steps", http.StatusInternalServerError)
+		return
+	}
+
+	q := r.URL.Query()
+	end := time.Now().UTC()
+	start := end.Add(-90 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+
+	interval := q.Get("interval")
+	if interval == "" {
+		interval = "week"
+	}
+
+	trend, err := h.events.QueryFunnelTrend(r.Context(), project.ID, steps, interval, start, end)
+	if errors.Is(err, storage.ErrFunnelTooLarge) {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		queryError(w, r, "querying funnel trend", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"trend": trend, "interval": interval})
+}
+
 func generateID() (string, error) {
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
@@ -1,20 +1,73 @@
 package query
 
 import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
 	ghub "github.com/danielthedm/clicknest/internal/github"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
 
+// DefaultMaxLimit caps the limit query parameter when no other cap is set.
+const DefaultMaxLimit = 1000
+
 type Handler struct {
-	events  *storage.DuckDB
-	meta    *storage.SQLite
-	matcher *ghub.Matcher
+	events   *storage.DuckDB
+	meta     storage.MetaStore
+	matcher  *ghub.Matcher
+	maxLimit int
 }
 
-func NewHandler(events *storage.DuckDB, meta *storage.SQLite) *Handler {
+func NewHandler(events *storage.DuckDB, meta storage.MetaStore) *Handler {
 	return &Handler{events: events, meta: meta}
 }
 
 func (h *Handler) SetMatcher(m *ghub.Matcher) {
 	h.matcher = m
 }
+
+// SetMaxLimit sets the most rows a client may ask for with ?limit=. Zero
+// restores DefaultMaxLimit.
+func (h *Handler) SetMaxLimit(n int) {
+	h.maxLimit = n
+}
+
+func (h *Handler) limit(r *http.Request, def int) int {
+	return Limit(r, def, h.maxLimit)
+}
+
+// Limit reads the request's limit parameter, falling back to def when it is
+// missing or not a positive number, and clamps it to max (DefaultMaxLimit
+// when max is 0). Handlers echo the result so clients can see a clamp.
+func Limit(r *http.Request, def, max int) int {
+	if max <= 0 {
+		max = DefaultMaxLimit
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || n <= 0 {
+		n = def
+	}
+	return min(n, max)
+}
+
+// pathRules returns the project's path normalization rules when the request
+// asks for ?normalize=true, and nil (raw paths) otherwise.
+func (h *Handler) pathRules(r *http.Request, projectID string) []storage.PathRule {
+	if r.URL.Query().Get("normalize") != "true" {
+		return nil
+	}
+	return h.meta.GetPathRules(r.Context(), projectID)
+}
+
+// queryError answers a failed query with a 500. When the client has already
+// disconnected, the failure is just DuckDB aborting on the cancelled request
+// context: there is nobody to answer and nothing worth logging.
+func queryError(w http.ResponseWriter, r *http.Request, what string, err error) {
+	if r.Context().Err() != nil {
+		return
+	}
+	log.Printf("ERROR %s: %v", what, err)
+	apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+}
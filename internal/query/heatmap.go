@@ -2,10 +2,10 @@ package query
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 )
 
@@ -13,7 +13,7 @@ import (
 func (h *Handler) HeatmapHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -29,13 +29,13 @@ func (h *Handler) HeatmapHandler(w http.ResponseWriter, r *http.Request) {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
 
-	points, err := h.events.QueryHeatmap(r.Context(), project.ID, urlPath, start, end)
+	rules := h.pathRules(r, project.ID)
+	points, err := h.events.QueryHeatmap(r.Context(), project.ID, urlPath, start, end, rules)
 	if err != nil {
-		log.Printf("ERROR querying heatmap: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying heatmap", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"points": points})
+	json.NewEncoder(w).Encode(map[string]any{"points": points, "normalized": rules != nil})
 }
@@ -6,32 +6,30 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 )
 
 func (h *Handler) LeadScoresHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	start, end := parseLeadTimeRange(r)
-	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	limit := h.limit(r, 50)
 	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
-	if limit <= 0 {
-		limit = 50
-	}
 
 	rules, err := h.meta.ListScoringRules(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"failed to load scoring rules"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to load scoring rules", http.StatusInternalServerError)
 		return
 	}
 
 	leads, total, err := h.events.QueryLeadScores(r.Context(), project.ID, rules, start, end, limit, offset)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -46,7 +44,7 @@ func (h *Handler) LeadScoresHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"leads": leads, "total": total})
+	json.NewEncoder(w).Encode(map[string]any{"leads": leads, "total": total, "limit": limit})
 }
 
 func parseLeadTimeRange(r *http.Request) (time.Time, time.Time) {
@@ -2,19 +2,21 @@ package query
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
 )
 
 // PagesHandler handles GET /api/v1/pages — top pages by traffic.
+// sparkline=true adds each page's daily views over the range.
 func (h *Handler) PagesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -28,20 +30,62 @@ func (h *Handler) PagesHandler(w http.ResponseWriter, r *http.Request) {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
 
-	limit := 50
-	if v := q.Get("limit"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			limit = n
+	limit := h.limit(r, 50)
+
+	rules := h.pathRules(r, project.ID)
+	pages, err := h.events.QueryTopPages(r.Context(), project.ID, start, end, limit, rules)
+	if err != nil {
+		queryError(w, r, "querying top pages", err)
+		return
+	}
+	if q.Get("sparkline") == "true" {
+		if err := h.events.AttachPageSparklines(r.Context(), project.ID, pages, start, end, rules); err != nil {
+			queryError(w, r, "querying page sparklines", err)
+			return
 		}
 	}
 
-	pages, err := h.events.QueryTopPages(r.Context(), project.ID, start, end, limit)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"pages": pages, "normalized": rules != nil, "limit": limit})
+}
+
+// PageSuggestionsHandler handles GET /api/v1/pages/suggestions — proposes
+// path grouping rules for high-cardinality URL segments. Accepted rules are
+// saved through PUT /api/v1/settings/path-rules.
+func (h *Handler) PageSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	end := time.Now().UTC()
+	start := end.Add(-30 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+	minDistinct := 20
+	if v := q.Get("min_distinct"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 1 {
+			minDistinct = n
+		}
+	}
+
+	pages, err := h.events.QueryTopPages(r.Context(), project.ID, start, end, 10000, nil)
 	if err != nil {
-		log.Printf("ERROR querying top pages: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying pages for suggestions", err)
 		return
 	}
+	rules := h.meta.GetPathRules(r.Context(), project.ID)
+	suggestions := storage.SuggestPathRules(pages, rules, minDistinct)
+	if suggestions == nil {
+		suggestions = []storage.PathSuggestion{}
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"pages": pages})
+	json.NewEncoder(w).Encode(map[string]any{"suggestions": suggestions, "rules": rules})
 }
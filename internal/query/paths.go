@@ -2,11 +2,10 @@ package query
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
-	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 )
 
@@ -14,7 +13,7 @@ import (
 func (h *Handler) PathsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -27,20 +26,15 @@ func (h *Handler) PathsHandler(w http.ResponseWriter, r *http.Request) {
 	if v := q.Get("end"); v != "" {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
-	limit := 20
-	if v := q.Get("limit"); v != "" {
-		if n, err := strconv.Atoi(v); err == nil && n > 0 {
-			limit = n
-		}
-	}
+	limit := h.limit(r, 20)
 
-	transitions, err := h.events.QueryPaths(r.Context(), project.ID, start, end, limit)
+	rules := h.pathRules(r, project.ID)
+	transitions, err := h.events.QueryPaths(r.Context(), project.ID, start, end, limit, rules)
 	if err != nil {
-		log.Printf("ERROR querying paths: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying paths", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"transitions": transitions})
+	json.NewEncoder(w).Encode(map[string]any{"transitions": transitions, "normalized": rules != nil, "limit": limit})
 }
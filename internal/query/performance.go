@@ -0,0 +1,49 @@
+package query
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// PerformanceHandler handles GET /api/v1/performance — p50/p75/p95 of a
+// performance metric (e.g. LCP, CLS, FID) per page. Requires metric; path
+// narrows the result to one page.
+func (h *Handler) PerformanceHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	metric := q.Get("metric")
+	if metric == "" {
+		apierror.Error(w, "metric is required", http.StatusBadRequest)
+		return
+	}
+	end := time.Now().UTC()
+	start := end.Add(-7 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+
+	stats, err := h.events.QueryPerformance(r.Context(), project.ID, metric, q.Get("path"), start, end)
+	if err != nil {
+		queryError(w, r, "querying performance", err)
+		return
+	}
+	if stats == nil {
+		stats = []storage.PerformanceStat{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"metric": metric, "pages": stats})
+}
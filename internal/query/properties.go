@@ -2,24 +2,45 @@ package query
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
+	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
 )
 
+// propertyDiscoveryWindow is how far back property key and value discovery
+// looks when no start is given, so long-dead keys drop out of the pickers.
+const propertyDiscoveryWindow = 30 * 24 * time.Hour
+
+// discoveryRange parses start and end for property discovery, defaulting to
+// the last propertyDiscoveryWindow.
+func discoveryRange(r *http.Request) (time.Time, time.Time) {
+	q := r.URL.Query()
+	end := time.Now().UTC()
+	start := end.Add(-propertyDiscoveryWindow)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+	return start, end
+}
+
 // PropertyKeysHandler handles GET /api/v1/properties/keys.
 func (h *Handler) PropertyKeysHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	keys, err := h.events.QueryPropertyKeys(r.Context(), project.ID)
+	start, end := discoveryRange(r)
+	keys, err := h.events.QueryPropertyKeys(r.Context(), project.ID, start, end)
 	if err != nil {
-		log.Printf("ERROR querying property keys: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying property keys", err)
 		return
 	}
 
@@ -31,23 +52,66 @@ func (h *Handler) PropertyKeysHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) PropertyValuesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	key := r.URL.Query().Get("key")
 	if key == "" {
-		http.Error(w, `{"error":"key parameter required"}`, http.StatusBadRequest)
+		apierror.Error(w, "key parameter required", http.StatusBadRequest)
 		return
 	}
 
-	values, err := h.events.QueryPropertyValues(r.Context(), project.ID, key, 100)
+	start, end := discoveryRange(r)
+	values, err := h.events.QueryPropertyValues(r.Context(), project.ID, key, start, end, 100)
 	if err != nil {
-		log.Printf("ERROR querying property values: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying property values", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{"values": values})
 }
+
+// PropertyBreakdownHandler handles GET /api/v1/breakdown/property?key=... —
+// event counts grouped by one property's values. Events without the
+// property are counted under a null value.
+func (h *Handler) PropertyBreakdownHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	key := q.Get("key")
+	if key == "" {
+		apierror.Error(w, "key parameter required", http.StatusBadRequest)
+		return
+	}
+	limit := h.limit(r, 50)
+	end := time.Now().UTC()
+	start := end.Add(-7 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+
+	counts, err := h.events.QueryCountByProperty(r.Context(), project.ID, key, start, end, limit)
+	if err != nil {
+		queryError(w, r, "querying property breakdown", err)
+		return
+	}
+	if counts == nil {
+		counts = []storage.PropertyCount{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"key":    key,
+		"values": counts,
+		"limit":  limit,
+	})
+}
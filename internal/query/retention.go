@@ -2,11 +2,11 @@ package query
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 )
 
@@ -14,7 +14,7 @@ import (
 func (h *Handler) RetentionHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -39,8 +39,7 @@ func (h *Handler) RetentionHandler(w http.ResponseWriter, r *http.Request) {
 
 	cohorts, err := h.events.QueryRetention(r.Context(), project.ID, interval, periods, start, end)
 	if err != nil {
-		log.Printf("ERROR querying retention: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying retention", err)
 		return
 	}
 
@@ -6,27 +6,29 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
 
 // SessionsHandler handles GET /api/v1/sessions — list sessions.
+// min_events and min_duration (seconds) drop sessions below those thresholds.
+// stitch=true derives sessions server-side from each user's activity, split
+// on 30 minutes of inactivity, instead of trusting the SDK's session_id.
 func (h *Handler) SessionsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	q := r.URL.Query()
-	limit := 50
-	if v := q.Get("limit"); v != "" {
-		limit, _ = strconv.Atoi(v)
-	}
+	limit := h.limit(r, 50)
 	offset := 0
 	if v := q.Get("offset"); v != "" {
 		offset, _ = strconv.Atoi(v)
 	}
+	offset = max(offset, 0)
 
 	end := time.Now().UTC()
 	start := end.Add(-7 * 24 * time.Hour)
@@ -37,87 +39,88 @@ func (h *Handler) SessionsHandler(w http.ResponseWriter, r *http.Request) {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
 
-	// Get events grouped by session — query all events and group in memory.
-	events, err := h.events.QueryEvents(r.Context(), storage.EventFilter{
-		ProjectID: project.ID,
-		StartTime: start,
-		EndTime:   end,
-		Limit:     10000,
-	})
-	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
-		return
-	}
-
-	type Session struct {
-		SessionID  string    `json:"session_id"`
-		DistinctID string    `json:"distinct_id,omitempty"`
-		EventCount int       `json:"event_count"`
-		FirstSeen  time.Time `json:"first_seen"`
-		LastSeen   time.Time `json:"last_seen"`
-		EntryURL   string    `json:"entry_url"`
-	}
-
-	sessMap := make(map[string]*Session)
-	sessOrder := []string{}
-	for _, e := range events {
-		s, ok := sessMap[e.SessionID]
-		if !ok {
-			s = &Session{
-				SessionID:  e.SessionID,
-				DistinctID: e.DistinctID,
-				FirstSeen:  e.Timestamp,
-				LastSeen:   e.Timestamp,
-				EntryURL:   e.URL,
-			}
-			sessMap[e.SessionID] = s
-			sessOrder = append(sessOrder, e.SessionID)
+	f := storage.SessionFilter{EventFilter: storage.EventFilter{StartTime: start, EndTime: end}}
+	if v := q.Get("min_events"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			apierror.Error(w, "min_events must be a non-negative integer", http.StatusBadRequest)
+			return
 		}
-		s.EventCount++
-		if e.Timestamp.Before(s.FirstSeen) {
-			s.FirstSeen = e.Timestamp
-			s.EntryURL = e.URL
-		}
-		if e.Timestamp.After(s.LastSeen) {
-			s.LastSeen = e.Timestamp
+		f.MinEvents = n
+	}
+	if v := q.Get("min_duration"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			apierror.Error(w, "min_duration must be a non-negative number of seconds", http.StatusBadRequest)
+			return
 		}
+		f.MinDuration = time.Duration(secs) * time.Second
 	}
 
-	sessions := make([]Session, 0, len(sessOrder))
-	for _, id := range sessOrder {
-		sessions = append(sessions, *sessMap[id])
+	query := h.events.QuerySessions
+	stitch := q.Get("stitch") == "true"
+	if stitch {
+		query = h.events.QueryStitchedSessions
 	}
-
-	// Apply pagination.
-	total := len(sessions)
-	if offset >= total {
-		sessions = nil
-	} else {
-		end := offset + limit
-		if end > total {
-			end = total
-		}
-		sessions = sessions[offset:end]
+	sessions, total, err := query(r.Context(), project.ID, f, limit, offset)
+	if err != nil {
+		queryError(w, r, "sessions query", err)
+		return
+	}
+	if sessions == nil {
+		sessions = []storage.SessionSummary{}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"sessions": sessions,
 		"total":    total,
+		"limit":    limit,
+		"stitched": stitch,
 	})
 }
 
+// SessionStatsHandler handles GET /api/v1/sessions/stats — summary figures
+// for the sessions list (total, average duration, bounce rate, average events
+// per session) over start–end, default the last 7 days.
+func (h *Handler) SessionStatsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	end := time.Now().UTC()
+	start := end.Add(-7 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+
+	stats, err := h.events.QuerySessionStats(r.Context(), project.ID, start, end)
+	if err != nil {
+		queryError(w, r, "session stats query", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
 // SessionDetailHandler handles GET /api/v1/sessions/{id} — session event timeline.
 func (h *Handler) SessionDetailHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	sessionID := r.PathValue("id")
 	if sessionID == "" {
-		http.Error(w, `{"error":"session_id required"}`, http.StatusBadRequest)
+		apierror.Error(w, "session_id required", http.StatusBadRequest)
 		return
 	}
 
@@ -127,7 +130,7 @@ func (h *Handler) SessionDetailHandler(w http.ResponseWriter, r *http.Request) {
 		Limit:     1000,
 	})
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 
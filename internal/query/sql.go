@@ -0,0 +1,65 @@
+package query
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// sqlQueryTimeout cancels explorer queries that run longer.
+const sqlQueryTimeout = 10 * time.Second
+
+// SQLHandler handles POST /api/v1/query/sql with {"sql", "limit"}: an ad-hoc
+// read-only SELECT over the project's events, answered with its columns and
+// rows. Statements that aren't a single SELECT on events, or that fail to
+// parse or run, are a 400; one that outruns sqlQueryTimeout is a 504.
+func (h *Handler) SQLHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		SQL   string `json:"sql"`
+		Limit int    `json:"limit"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64*1024)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if body.Limit <= 0 {
+		body.Limit = 1000
+	}
+	body.Limit = min(body.Limit, storage.MaxSQLRows)
+
+	ctx, cancel := context.WithTimeout(r.Context(), sqlQueryTimeout)
+	defer cancel()
+	result, err := h.events.QuerySQL(ctx, project.ID, body.SQL, body.Limit)
+	switch {
+	case errors.Is(err, storage.ErrInvalidSQL):
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, context.DeadlineExceeded) && r.Context().Err() == nil:
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query timed out after "+sqlQueryTimeout.String(), http.StatusGatewayTimeout)
+		return
+	case err != nil:
+		queryError(w, r, "running sql query", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"columns":   result.Columns,
+		"rows":      result.Rows,
+		"truncated": result.Truncated,
+		"limit":     body.Limit,
+	})
+}
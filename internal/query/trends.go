@@ -1,19 +1,24 @@
 package query
 
 import (
+	"context"
 	"encoding/json"
-	"log"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
 )
 
 // TrendsBreakdownHandler handles GET /api/v1/trends/breakdown — multi-series trends split by a dimension.
+// ?top=N picks how many series to return (default 8, capped); ?totals=true
+// adds "Other" and "All events" series that reconcile with the total.
 func (h *Handler) TrendsBreakdownHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -36,10 +41,20 @@ func (h *Handler) TrendsBreakdownHandler(w http.ResponseWriter, r *http.Request)
 		end, _ = time.Parse(time.RFC3339, v)
 	}
 
-	series, err := h.events.QueryTrendsBreakdown(r.Context(), project.ID, interval, groupBy, start, end)
+	totals := q.Get("totals") == "true"
+	top := storage.DefaultBreakdownTop
+	if v := q.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			apierror.Error(w, "top must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		top = min(n, storage.MaxBreakdownTop)
+	}
+
+	series, err := h.events.QueryTrendsBreakdown(r.Context(), project.ID, interval, groupBy, start, end, top, totals)
 	if err != nil {
-		log.Printf("ERROR querying trends breakdown: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying trends breakdown", err)
 		return
 	}
 
@@ -48,14 +63,26 @@ func (h *Handler) TrendsBreakdownHandler(w http.ResponseWriter, r *http.Request)
 		"series":   series,
 		"interval": interval,
 		"group_by": groupBy,
+		"top":      top,
 	})
 }
 
-// TrendsHandler handles GET /api/v1/trends — time-series event counts.
+// sampleScaling returns the context for a count query: with
+// ?scale_sampling=true, counts of sampled events are scaled up by their
+// sample rate and the response is flagged "estimated".
+func sampleScaling(r *http.Request) (context.Context, bool) {
+	if r.URL.Query().Get("scale_sampling") != "true" {
+		return r.Context(), false
+	}
+	return storage.WithSampleScaling(r.Context()), true
+}
+
+// TrendsHandler handles GET /api/v1/trends — time-series event counts,
+// optionally scoped with ?event_type= and/or ?event_name=.
 func (h *Handler) TrendsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -75,18 +102,107 @@ func (h *Handler) TrendsHandler(w http.ResponseWriter, r *http.Request) {
 		end, _ = time.Parse(time.RFC3339, v)
 	}
 
-	points, err := h.events.QueryTrends(r.Context(), project.ID, interval, start, end)
+	eventType, eventName := q.Get("event_type"), q.Get("event_name")
+	ctx, estimated := sampleScaling(r)
+	points, err := h.events.QueryTrends(ctx, project.ID, interval, eventType, eventName, start, end)
 	if err != nil {
-		log.Printf("ERROR querying trends: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying trends", err)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
-		"data":     points,
-		"interval": interval,
-		"start":    start.Format(time.RFC3339),
-		"end":      end.Format(time.RFC3339),
+		"data":       points,
+		"interval":   interval,
+		"event_type": eventType,
+		"event_name": eventName,
+		"start":      start.Format(time.RFC3339),
+		"end":        end.Format(time.RFC3339),
+		"estimated":  estimated,
+	})
+}
+
+// maxTrendMetrics bounds the queries a single multi-metric request can run.
+const maxTrendMetrics = 10
+
+// TrendsMultiHandler handles POST /api/v1/trends/multi — several metric
+// series in one request, aligned on a shared gap-filled timeline.
+func (h *Handler) TrendsMultiHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Interval string `json:"interval"`
+		Start    string `json:"start"`
+		End      string `json:"end"`
+		Metrics  []struct {
+			storage.TrendMetric
+			Interval string `json:"interval"`
+		} `json:"metrics"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if len(body.Metrics) == 0 || len(body.Metrics) > maxTrendMetrics {
+		apierror.Error(w, "between 1 and 10 metrics are required", http.StatusBadRequest)
+		return
+	}
+
+	// Series can only align on one timeline, so per-metric intervals must
+	// agree with each other (and with the top-level interval if given).
+	interval := body.Interval
+	metrics := make([]storage.TrendMetric, len(body.Metrics))
+	for i, m := range body.Metrics {
+		if m.Interval != "" {
+			if interval != "" && m.Interval != interval {
+				apierror.Error(w, "all metrics must share the same interval", http.StatusBadRequest)
+				return
+			}
+			interval = m.Interval
+		}
+		if m.Name == "" {
+			m.Name = m.EventName
+		}
+		if m.Name == "" {
+			m.Name = m.EventType
+		}
+		if m.Name == "" {
+			m.Name = "all events"
+		}
+		metrics[i] = m.TrendMetric
+	}
+	switch interval {
+	case "minute", "hour", "day", "week", "month":
+	default:
+		interval = "hour"
+	}
+
+	end := time.Now().UTC()
+	start := end.Add(-24 * time.Hour)
+	if body.Start != "" {
+		start, _ = time.Parse(time.RFC3339, body.Start)
+	}
+	if body.End != "" {
+		end, _ = time.Parse(time.RFC3339, body.End)
+	}
+
+	ctx, estimated := sampleScaling(r)
+	series, err := h.events.QueryTrendsMulti(ctx, project.ID, interval, metrics, start, end)
+	if err != nil {
+		queryError(w, r, "querying multi-metric trends", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"series":    series,
+		"interval":  interval,
+		"start":     start.Format(time.RFC3339),
+		"end":       end.Format(time.RFC3339),
+		"estimated": estimated,
 	})
 }
@@ -2,11 +2,11 @@ package query
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	"github.com/danielthedm/clicknest/internal/storage"
 )
@@ -15,15 +15,12 @@ import (
 func (h *Handler) UsersHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	q := r.URL.Query()
-	limit := 50
-	if v := q.Get("limit"); v != "" {
-		limit, _ = strconv.Atoi(v)
-	}
+	limit := h.limit(r, 50)
 	offset := 0
 	if v := q.Get("offset"); v != "" {
 		offset, _ = strconv.Atoi(v)
@@ -40,8 +37,7 @@ func (h *Handler) UsersHandler(w http.ResponseWriter, r *http.Request) {
 
 	users, total, err := h.events.QueryUsers(r.Context(), project.ID, limit, offset, start, end)
 	if err != nil {
-		log.Printf("ERROR querying users: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying users", err)
 		return
 	}
 
@@ -49,6 +45,7 @@ func (h *Handler) UsersHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{
 		"users": users,
 		"total": total,
+		"limit": limit,
 	})
 }
 
@@ -56,20 +53,17 @@ func (h *Handler) UsersHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) UserEventsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	distinctID := r.PathValue("id")
 	if distinctID == "" {
-		http.Error(w, `{"error":"user id required"}`, http.StatusBadRequest)
+		apierror.Error(w, "user id required", http.StatusBadRequest)
 		return
 	}
 
-	limit := 100
-	if v := r.URL.Query().Get("limit"); v != "" {
-		limit, _ = strconv.Atoi(v)
-	}
+	limit := h.limit(r, 100)
 
 	events, err := h.events.QueryEvents(r.Context(), storage.EventFilter{
 		ProjectID:  project.ID,
@@ -77,8 +71,7 @@ func (h *Handler) UserEventsHandler(w http.ResponseWriter, r *http.Request) {
 		Limit:      limit,
 	})
 	if err != nil {
-		log.Printf("ERROR querying user events: %v", err)
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		queryError(w, r, "querying user events", err)
 		return
 	}
 
@@ -86,5 +79,6 @@ func (h *Handler) UserEventsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{
 		"events": events,
 		"count":  len(events),
+		"limit":  limit,
 	})
 }
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// DefaultLogInterval is how long Warnings suppresses repeats of a key.
+const DefaultLogInterval = time.Minute
+
+// Warnings deduplicates repetitive warnings shared across packages, such as
+// naming failures and unreadable event rows.
+var Warnings = NewLogLimiter(DefaultLogInterval)
+
+// maxLogKeys bounds the keys a LogLimiter remembers; past it, keys whose
+// window has expired are dropped.
+const maxLogKeys = 10000
+
+// LogLimiter logs a message at most once per key per interval. Repeats inside
+// the window are counted and reported on the next line logged for that key,
+// so one recurring bad record yields one line a minute instead of thousands.
+type LogLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	keys     map[string]*logKey
+	logf     func(format string, args ...any)
+	now      func() time.Time
+}
+
+type logKey struct {
+	last       time.Time
+	suppressed int
+}
+
+// NewLogLimiter creates a LogLimiter writing to the standard logger. An
+// interval of 0 or less logs every message.
+func NewLogLimiter(interval time.Duration) *LogLimiter {
+	return &LogLimiter{
+		interval: interval,
+		keys:     make(map[string]*logKey),
+		logf:     log.Printf,
+		now:      time.Now,
+	}
+}
+
+// SetInterval changes the suppression window; 0 or less disables it.
+func (l *LogLimiter) SetInterval(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.interval = d
+}
+
+// Printf logs the message unless one with the same key was logged within the
+// interval. It reports whether the message was logged.
+func (l *LogLimiter) Printf(key, format string, args ...any) bool {
+	l.mu.Lock()
+	if l.interval <= 0 {
+		l.mu.Unlock()
+		l.logf(format, args...)
+		return true
+	}
+
+	now := l.now()
+	k, ok := l.keys[key]
+	if ok && now.Sub(k.last) < l.interval {
+		k.suppressed++
+		l.mu.Unlock()
+		return false
+	}
+	if !ok {
+		if len(l.keys) >= maxLogKeys {
+			l.prune(now)
+		}
+		k = &logKey{}
+		l.keys[key] = k
+	}
+	suppressed := k.suppressed
+	k.last, k.suppressed = now, 0
+	l.mu.Unlock()
+
+	if suppressed > 0 {
+		format += " (%d similar suppressed)"
+		args = append(args, suppressed)
+	}
+	l.logf(format, args...)
+	return true
+}
+
+// prune drops keys whose window has expired. Callers hold l.mu.
+func (l *LogLimiter) prune(now time.Time) {
+	for key, k := range l.keys {
+		if now.Sub(k.last) >= l.interval {
+			delete(l.keys, key)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestLogLimiter_SuppressesRepeatsWithinInterval(t *testing.T) {
+	l := NewLogLimiter(time.Minute)
+	var lines []string
+	l.logf = func(format string, args ...any) { lines = append(lines, fmt.Sprintf(format, args...)) }
+	now := time.Unix(1_700_000_000, 0)
+	l.now = func() time.Time { return now }
+
+	for range 1000 {
+		l.Printf("naming fp1", "WARN naming event %s: %v", "fp1", "timeout")
+	}
+	if len(lines) != 1 || lines[0] != "WARN naming event fp1: timeout" {
+		t.Fatalf("expected one line for 1000 identical warnings, got %d: %q", len(lines), lines)
+	}
+
+	// Other keys are limited independently.
+	if !l.Printf("naming fp2", "WARN naming event %s: %v", "fp2", "timeout") || len(lines) != 2 {
+		t.Fatalf("expected a different key to log, got %q", lines)
+	}
+
+	// Once the window passes the key logs again, reporting what it dropped.
+	now = now.Add(time.Minute)
+	if !l.Printf("naming fp1", "WARN naming event %s: %v", "fp1", "timeout") {
+		t.Fatal("expected the key to log again after the interval")
+	}
+	if want := "WARN naming event fp1: timeout (999 similar suppressed)"; lines[2] != want {
+		t.Fatalf("expected %q, got %q", want, lines[2])
+	}
+
+	l.SetInterval(0)
+	l.Printf("naming fp1", "again")
+	l.Printf("naming fp1", "again")
+	if len(lines) != 5 {
+		t.Fatalf("expected a zero interval to log everything, got %d lines", len(lines))
+	}
+}
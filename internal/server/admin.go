@@ -0,0 +1,139 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// requireInstanceAdmin reports whether the request comes from the instance
+// admin, writing 403 if not. Actions that reach beyond the caller's project,
+// such as schema migrations, are limited to that one account.
+func (s *Server) requireInstanceAdmin(w http.ResponseWriter, r *http.Request) bool {
+	userID := auth.UserIDFromContext(r.Context())
+	adminID, err := s.meta.InstanceAdminID(r.Context())
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		log.Printf("ERROR looking up instance admin: %v", err)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
+		return false
+	}
+	if userID == "" || userID != adminID {
+		apierror.Error(w, "instance admin access required", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+type migrationReport struct {
+	Applied []storage.MigrationStatus `json:"applied"`
+	Pending []storage.MigrationStatus `json:"pending"`
+}
+
+func splitMigrations(all []storage.MigrationStatus) migrationReport {
+	rep := migrationReport{Applied: []storage.MigrationStatus{}, Pending: []storage.MigrationStatus{}}
+	for _, m := range all {
+		if m.Applied {
+			rep.Applied = append(rep.Applied, m)
+		} else {
+			rep.Pending = append(rep.Pending, m)
+		}
+	}
+	return rep
+}
+
+// migrationStatus collects applied/pending migrations for both databases.
+func (s *Server) migrationStatus() (map[string]migrationReport, error) {
+	duck, err := s.events.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	lite, err := s.meta.MigrationStatus()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]migrationReport{
+		"duckdb": splitMigrations(duck),
+		"sqlite": splitMigrations(lite),
+	}, nil
+}
+
+// migrationsHandler lists applied and pending schema migrations for both databases.
+// GET /api/v1/admin/migrations
+func (s *Server) migrationsHandler(w http.ResponseWriter, r *http.Request) {
+	status, err := s.migrationStatus()
+	if err != nil {
+		log.Printf("ERROR migration status: %v", err)
+		apierror.Error(w, "failed to read migration status", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// runMigrationsHandler applies any pending migrations to both databases and
+// returns the resulting status. Already-applied migrations are skipped, so
+// this is safe to call repeatedly. Migrations change every project's schema,
+// so only the instance admin may run them.
+// POST /api/v1/admin/migrations/run
+func (s *Server) runMigrationsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireInstanceAdmin(w, r) {
+		return
+	}
+	if err := s.events.Migrate(); err != nil {
+		log.Printf("ERROR running duckdb migrations: %v", err)
+		apierror.Error(w, "duckdb migration failed", http.StatusInternalServerError)
+		return
+	}
+	if err := s.meta.Migrate(); err != nil {
+		log.Printf("ERROR running sqlite migrations: %v", err)
+		apierror.Error(w, "sqlite migration failed", http.StatusInternalServerError)
+		return
+	}
+	s.migrationsHandler(w, r)
+}
+
+// rollbackMigrationHandler reverts a single applied migration using its
+// paired .down.sql script. This is an explicit instance admin action; normal
+// startup only ever migrates forward.
+// POST /api/v1/admin/migrations/rollback  {"database":"sqlite","filename":"027_x.sql"}
+func (s *Server) rollbackMigrationHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.requireInstanceAdmin(w, r) {
+		return
+	}
+	var body struct {
+		Database string `json:"database"`
+		Filename string `json:"filename"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	switch body.Database {
+	case "sqlite":
+		err = s.meta.RollbackMigration(body.Filename)
+	case "duckdb":
+		err = s.events.RollbackMigration(body.Filename)
+	default:
+		apierror.Error(w, "database must be sqlite or duckdb", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		if errors.Is(err, storage.ErrInvalidRollback) {
+			apierror.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("ERROR rolling back %s migration %s: %v", body.Database, body.Filename, err)
+		apierror.Error(w, "rollback failed", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("INFO rolled back %s migration %s", body.Database, body.Filename)
+	s.migrationsHandler(w, r)
+}
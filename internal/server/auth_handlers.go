@@ -10,6 +10,7 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 )
 
@@ -18,7 +19,7 @@ const sessionDuration = 30 * 24 * time.Hour
 func (s *Server) setupRequiredHandler(w http.ResponseWriter, r *http.Request) {
 	n, err := s.meta.CountUsers(r.Context())
 	if err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -28,7 +29,7 @@ func (s *Server) setupRequiredHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) setupHandler(w http.ResponseWriter, r *http.Request) {
 	n, err := s.meta.CountUsers(r.Context())
 	if err != nil || n > 0 {
-		http.Error(w, `{"error":"setup already complete"}`, http.StatusForbidden)
+		apierror.Error(w, "setup already complete", http.StatusForbidden)
 		return
 	}
 	var req struct {
@@ -36,17 +37,17 @@ func (s *Server) setupHandler(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" || len(req.Password) < 8 || len(req.Password) > 1024 {
-		http.Error(w, `{"error":"email and password (min 8 chars) required"}`, http.StatusBadRequest)
+		apierror.Error(w, "email and password (min 8 chars) required", http.StatusBadRequest)
 		return
 	}
 	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 	user, err := s.meta.CreateUser(r.Context(), req.Email, string(hash))
 	if err != nil {
-		http.Error(w, `{"error":"failed to create user"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to create user", http.StatusInternalServerError)
 		return
 	}
 
@@ -62,7 +63,7 @@ func (s *Server) setupHandler(w http.ResponseWriter, r *http.Request) {
 		firstProjectID = projects[0].ID
 	}
 	if err := s.issueSession(w, r, user.ID, firstProjectID); err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 	s.track("user_signup", map[string]any{"user_id": user.ID})
@@ -76,18 +77,18 @@ func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
 		Password string `json:"password"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		apierror.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
 	user, err := s.meta.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
 		// Run bcrypt anyway to prevent timing attacks.
 		bcrypt.CompareHashAndPassword([]byte("$2a$10$dummy.dummy.dummy.dummy.dummy.dummy.dummy.dummy.dummyu"), []byte(req.Password))
-		http.Error(w, `{"error":"invalid email or password"}`, http.StatusUnauthorized)
+		apierror.Error(w, "invalid email or password", http.StatusUnauthorized)
 		return
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
-		http.Error(w, `{"error":"invalid email or password"}`, http.StatusUnauthorized)
+		apierror.Error(w, "invalid email or password", http.StatusUnauthorized)
 		return
 	}
 
@@ -99,7 +100,7 @@ func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := s.issueSession(w, r, user.ID, firstProjectID); err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 	s.track("user_login", map[string]any{"user_id": user.ID})
@@ -111,13 +112,13 @@ func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
 	if cookie, err := r.Cookie(auth.SessionCookieName); err == nil {
 		s.meta.DeleteUserSession(r.Context(), cookie.Value)
 	}
-	http.SetCookie(w, &http.Cookie{
+	http.SetCookie(w, s.crossSiteCookie(&http.Cookie{
 		Name:     auth.SessionCookieName,
 		Value:    "",
 		Path:     "/",
 		MaxAge:   -1,
 		HttpOnly: true,
-	})
+	}))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
@@ -165,7 +166,7 @@ func (s *Server) issueSession(w http.ResponseWriter, r *http.Request, userID, pr
 		return err
 	}
 	secure := r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https"
-	http.SetCookie(w, &http.Cookie{
+	http.SetCookie(w, s.crossSiteCookie(&http.Cookie{
 		Name:     auth.SessionCookieName,
 		Value:    token,
 		Path:     "/",
@@ -173,7 +174,7 @@ func (s *Server) issueSession(w http.ResponseWriter, r *http.Request, userID, pr
 		HttpOnly: true,
 		Secure:   secure,
 		SameSite: http.SameSiteStrictMode,
-	})
+	}))
 	return nil
 }
 
@@ -185,24 +186,24 @@ func (s *Server) switchProjectHandler(w http.ResponseWriter, r *http.Request) {
 		ProjectID string `json:"project_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.ProjectID == "" {
-		http.Error(w, `{"error":"project_id required"}`, http.StatusBadRequest)
+		apierror.Error(w, "project_id required", http.StatusBadRequest)
 		return
 	}
 
 	// Verify user has access to this project.
 	_, err := s.meta.GetUserProjectRole(r.Context(), userID, req.ProjectID)
 	if err != nil {
-		http.Error(w, `{"error":"not a member of this project"}`, http.StatusForbidden)
+		apierror.Error(w, "not a member of this project", http.StatusForbidden)
 		return
 	}
 
 	cookie, err := r.Cookie(auth.SessionCookieName)
 	if err != nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	if err := s.meta.SwitchSessionProject(r.Context(), cookie.Value, req.ProjectID); err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 
@@ -214,7 +215,7 @@ func (s *Server) listProjectsHandler(w http.ResponseWriter, r *http.Request) {
 	userID := auth.UserIDFromContext(r.Context())
 	projects, err := s.meta.ListUserProjects(r.Context(), userID)
 	if err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -227,25 +228,25 @@ func (s *Server) createProjectHandler(w http.ResponseWriter, r *http.Request) {
 		Name string `json:"name"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
-		http.Error(w, `{"error":"name required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name required", http.StatusBadRequest)
 		return
 	}
 
 	id, err := generateProjectID()
 	if err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 
 	project, err := s.meta.CreateProject(r.Context(), id, req.Name)
 	if err != nil {
-		http.Error(w, `{"error":"failed to create project"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to create project", http.StatusInternalServerError)
 		return
 	}
 
 	// Auto-add creator as owner.
 	if err := s.meta.AddProjectMember(r.Context(), userID, project.ID, "owner"); err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 
@@ -262,13 +263,13 @@ func (s *Server) listMembersHandler(w http.ResponseWriter, r *http.Request) {
 	// Verify caller is a member.
 	_, err := s.meta.GetUserProjectRole(r.Context(), userID, projectID)
 	if err != nil {
-		http.Error(w, `{"error":"not a member of this project"}`, http.StatusForbidden)
+		apierror.Error(w, "not a member of this project", http.StatusForbidden)
 		return
 	}
 
 	members, err := s.meta.ListProjectMembers(r.Context(), projectID)
 	if err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -282,7 +283,7 @@ func (s *Server) addMemberHandler(w http.ResponseWriter, r *http.Request) {
 	// Only owners can add members.
 	role, err := s.meta.GetUserProjectRole(r.Context(), callerID, projectID)
 	if err != nil || role != "owner" {
-		http.Error(w, `{"error":"owner access required"}`, http.StatusForbidden)
+		apierror.Error(w, "owner access required", http.StatusForbidden)
 		return
 	}
 
@@ -291,29 +292,29 @@ func (s *Server) addMemberHandler(w http.ResponseWriter, r *http.Request) {
 		Role  string `json:"role"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Email == "" {
-		http.Error(w, `{"error":"email required"}`, http.StatusBadRequest)
+		apierror.Error(w, "email required", http.StatusBadRequest)
 		return
 	}
 	if req.Role == "" {
 		req.Role = "member"
 	}
 	if req.Role != "owner" && req.Role != "member" {
-		http.Error(w, `{"error":"role must be owner or member"}`, http.StatusBadRequest)
+		apierror.Error(w, "role must be owner or member", http.StatusBadRequest)
 		return
 	}
 
 	user, err := s.meta.GetUserByEmail(r.Context(), req.Email)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			http.Error(w, `{"error":"user not found"}`, http.StatusNotFound)
+			apierror.Error(w, "user not found", http.StatusNotFound)
 			return
 		}
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 
 	if err := s.meta.AddProjectMember(r.Context(), user.ID, projectID, req.Role); err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 
@@ -330,12 +331,12 @@ func (s *Server) removeMemberHandler(w http.ResponseWriter, r *http.Request) {
 	// Only owners can remove members.
 	role, err := s.meta.GetUserProjectRole(r.Context(), callerID, projectID)
 	if err != nil || role != "owner" {
-		http.Error(w, `{"error":"owner access required"}`, http.StatusForbidden)
+		apierror.Error(w, "owner access required", http.StatusForbidden)
 		return
 	}
 
 	if err := s.meta.RemoveProjectMember(r.Context(), targetUserID, projectID); err != nil {
-		http.Error(w, `{"error":"internal"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal", http.StatusInternalServerError)
 		return
 	}
 
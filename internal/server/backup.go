@@ -11,19 +11,36 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
 )
 
 // exportHandler streams a .tar.gz backup of the data directory.
-// GET /api/v1/export
+// GET /api/v1/export[?include_key=false]
+//
+// By default the archive includes .encryption_key so it is a complete disaster
+// recovery backup. With include_key=false the key is omitted, which makes the
+// archive safer to share: events and metadata restore normally, but encrypted
+// secrets (LLM API keys, GitHub and OAuth tokens) cannot be decrypted
+// unless the original key is supplied on restore via the key file or
+// CLICKNEST_ENCRYPTION_KEY. Importing such an archive keeps the restoring
+// instance's existing key.
+//
+// With metadata in Postgres the archive holds events only; metadata is
+// backed up with pg_dump, and a clicknest.db left in the data directory from
+// before the switch is stale, so it is neither exported nor restored.
 func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	includeKey := r.URL.Query().Get("include_key") != "false"
 
 	// Flush WAL to main files so copies are consistent.
 	if err := s.events.Checkpoint(ctx); err != nil {
 		log.Printf("WARN: export: checkpoint duckdb: %v", err)
 	}
-	if _, err := s.meta.DB().ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
-		log.Printf("WARN: export: checkpoint sqlite: %v", err)
+	if !s.meta.Postgres() {
+		if _, err := s.meta.DB().ExecContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+			log.Printf("WARN: export: checkpoint sqlite: %v", err)
+		}
 	}
 
 	filename := fmt.Sprintf("clicknest-backup-%s.tar.gz", time.Now().UTC().Format("20060102-150405"))
@@ -33,7 +50,14 @@ func (s *Server) exportHandler(w http.ResponseWriter, r *http.Request) {
 	gz := gzip.NewWriter(w)
 	tw := tar.NewWriter(gz)
 
-	for _, name := range []string{"events.duckdb", "clicknest.db", ".encryption_key"} {
+	files := []string{"events.duckdb"}
+	if !s.meta.Postgres() {
+		files = append(files, "clicknest.db")
+	}
+	if includeKey {
+		files = append(files, ".encryption_key")
+	}
+	for _, name := range files {
 		path := filepath.Join(s.config.DataDir, name)
 		f, err := os.Open(path)
 		if os.IsNotExist(err) {
@@ -78,28 +102,28 @@ func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, 10<<30)
 
 	if err := r.ParseMultipartForm(32 << 20); err != nil {
-		http.Error(w, `{"error":"invalid multipart form"}`, http.StatusBadRequest)
+		apierror.Error(w, "invalid multipart form", http.StatusBadRequest)
 		return
 	}
 
 	file, _, err := r.FormFile("backup")
 	if err != nil {
-		http.Error(w, `{"error":"missing backup field"}`, http.StatusBadRequest)
+		apierror.Error(w, "missing backup field", http.StatusBadRequest)
 		return
 	}
 	defer file.Close()
 
 	gr, err := gzip.NewReader(file)
 	if err != nil {
-		http.Error(w, `{"error":"invalid gzip archive"}`, http.StatusBadRequest)
+		apierror.Error(w, "invalid gzip archive", http.StatusBadRequest)
 		return
 	}
 	defer gr.Close()
 
 	allowed := map[string]bool{
-		"events.duckdb":    true,
-		"clicknest.db":     true,
-		".encryption_key":  true,
+		"events.duckdb":   true,
+		"clicknest.db":    !s.meta.Postgres(),
+		".encryption_key": true,
 	}
 
 	// Extract to temp files first, then swap after closing DBs.
@@ -116,7 +140,7 @@ func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 		if err != nil {
-			http.Error(w, `{"error":"corrupt archive"}`, http.StatusBadRequest)
+			apierror.Error(w, "corrupt archive", http.StatusBadRequest)
 			// Clean up temps.
 			for _, e := range entries {
 				os.Remove(e.tempPath)
@@ -132,7 +156,7 @@ func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
 		tempPath := filepath.Join(s.config.DataDir, name+".import_tmp")
 		f, err := os.OpenFile(tempPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 		if err != nil {
-			http.Error(w, `{"error":"failed to write temp file"}`, http.StatusInternalServerError)
+			apierror.Error(w, "failed to write temp file", http.StatusInternalServerError)
 			for _, e := range entries {
 				os.Remove(e.tempPath)
 			}
@@ -143,7 +167,7 @@ func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
 		if _, err := io.Copy(f, io.LimitReader(tr, 10<<30)); err != nil {
 			f.Close()
 			os.Remove(tempPath)
-			http.Error(w, `{"error":"failed to write temp file"}`, http.StatusInternalServerError)
+			apierror.Error(w, "failed to write temp file", http.StatusInternalServerError)
 			for _, e := range entries {
 				os.Remove(e.tempPath)
 			}
@@ -158,7 +182,7 @@ func (s *Server) importHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(entries) == 0 {
-		http.Error(w, `{"error":"no recognizable files in archive"}`, http.StatusBadRequest)
+		apierror.Error(w, "no recognizable files in archive", http.StatusBadRequest)
 		return
 	}
 
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/ai"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// maxChatToolBuckets bounds a query_trends result so one call can't fill
+// the model's context.
+const maxChatToolBuckets = 400
+
+// chatToolTimeParam describes a start or end argument to the model.
+func chatToolTimeParam(desc string) map[string]any {
+	return map[string]any{
+		"type":        "string",
+		"description": desc + " RFC 3339 timestamp, or a YYYY-MM-DD date in the project's timezone.",
+	}
+}
+
+// chatTools are the live queries the AI chat may call to answer with exact
+// numbers rather than the system prompt's snapshot. Dates the model passes
+// are read in loc, the project's timezone.
+func (s *Server) chatTools(projectID string, loc *time.Location) []ai.ChatTool {
+	return []ai.ChatTool{
+		{
+			Name:        "query_trends",
+			Description: "Count the project's events per time bucket between start and end, optionally only events with one event name.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"interval":   map[string]any{"type": "string", "enum": []string{"hour", "day", "week", "month"}},
+					"start":      chatToolTimeParam("Start of the range; a date means its first moment."),
+					"end":        chatToolTimeParam("End of the range; a date means its last moment."),
+					"event_name": map[string]any{"type": "string", "description": "Only count events with this name, as listed by top_events."},
+				},
+				"required": []string{"interval", "start", "end"},
+			},
+			Run: func(ctx context.Context, raw json.RawMessage) (any, error) {
+				var args struct {
+					Interval  string `json:"interval"`
+					Start     string `json:"start"`
+					End       string `json:"end"`
+					EventName string `json:"event_name"`
+				}
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return nil, fmt.Errorf("invalid arguments: %w", err)
+				}
+				switch args.Interval {
+				case "hour", "day", "week", "month":
+				default:
+					return nil, fmt.Errorf("interval must be hour, day, week or month")
+				}
+				start, end, err := chatToolRange(args.Start, args.End, loc)
+				if err != nil {
+					return nil, err
+				}
+				if n := chatToolBuckets(args.Interval, start, end); n > maxChatToolBuckets {
+					return nil, fmt.Errorf("%d buckets is too many; use a coarser interval or a shorter range", n)
+				}
+				points, err := s.events.QueryTrends(ctx, projectID, args.Interval, "", args.EventName, start, end)
+				if err != nil {
+					return nil, fmt.Errorf("query failed: %w", err)
+				}
+				var total int64
+				for _, p := range points {
+					total += p.Count
+				}
+				return map[string]any{"interval": args.Interval, "total": total, "buckets": points}, nil
+			},
+		},
+		{
+			Name:        "top_events",
+			Description: "List the project's most frequent named events between start and end, with event, session and user counts.",
+			Parameters: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"start": chatToolTimeParam("Start of the range; a date means its first moment."),
+					"end":   chatToolTimeParam("End of the range; a date means its last moment."),
+				},
+				"required": []string{"start", "end"},
+			},
+			Run: func(ctx context.Context, raw json.RawMessage) (any, error) {
+				var args struct {
+					Start string `json:"start"`
+					End   string `json:"end"`
+				}
+				if err := json.Unmarshal(raw, &args); err != nil {
+					return nil, fmt.Errorf("invalid arguments: %w", err)
+				}
+				start, end, err := chatToolRange(args.Start, args.End, loc)
+				if err != nil {
+					return nil, err
+				}
+				stats, err := s.events.QueryTopEventNames(ctx, projectID, start, end, 20)
+				if err != nil {
+					return nil, fmt.Errorf("query failed: %w", err)
+				}
+				if stats == nil {
+					stats = []storage.EventNameStat{}
+				}
+				return map[string]any{"events": stats}, nil
+			},
+		},
+	}
+}
+
+// chatToolBuckets estimates how many interval buckets [start, end] spans,
+// to within one, so an oversized range is refused before it reaches DuckDB.
+func chatToolBuckets(interval string, start, end time.Time) int64 {
+	d := end.Sub(start)
+	switch interval {
+	case "hour":
+		return int64(d/time.Hour) + 1
+	case "day":
+		return int64(d/(24*time.Hour)) + 1
+	case "week":
+		return int64(d/(7*24*time.Hour)) + 2
+	default:
+		months := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+		return int64(months) + 1
+	}
+}
+
+// chatToolRange parses a tool's start and end. A bare date covers that whole
+// day in loc.
+func chatToolRange(startArg, endArg string, loc *time.Location) (time.Time, time.Time, error) {
+	parse := func(name, v string, endOfDay bool) (time.Time, error) {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t, nil
+		}
+		d, err := time.ParseInLocation("2006-01-02", v, loc)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s must be an RFC 3339 timestamp or a YYYY-MM-DD date", name)
+		}
+		if endOfDay {
+			d = d.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return d, nil
+	}
+	start, err := parse("start", startArg, false)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := parse("end", endArg, true)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end must not be before start")
+	}
+	return start.UTC(), end.UTC(), nil
+}
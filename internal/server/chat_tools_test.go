@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/ai"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestAIChat_ToolCallsRunLiveQueries(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedUserEvents(t, s, project.ID, "a", "b", "c")
+	today := time.Now().UTC().Format("2006-01-02")
+	args := fmt.Sprintf(`{"interval":"day","start":%q,"end":%q}`, today, today)
+
+	// The fake model asks for today's trend, then answers with the total it
+	// was given; loop makes it ask again every round it is allowed to, and
+	// stubborn makes it ignore tool_choice "none" as well.
+	var requests int
+	loop, stubborn := false, false
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		var req struct {
+			Stream     bool             `json:"stream"`
+			ToolChoice string           `json:"tool_choice"`
+			Messages   []map[string]any `json:"messages"`
+			Tools      []map[string]any `json:"tools"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if len(req.Tools) != 2 {
+			t.Errorf("expected 2 tools offered, got %d", len(req.Tools))
+		}
+		last := req.Messages[len(req.Messages)-1]
+		answer := ""
+		switch {
+		case req.ToolChoice == "none" && !stubborn:
+			answer = "Out of lookups."
+		case last["role"] == "tool" && !loop:
+			var result struct {
+				Total int64 `json:"total"`
+			}
+			json.Unmarshal([]byte(last["content"].(string)), &result)
+			answer = fmt.Sprintf("%d events today.", result.Total)
+		}
+
+		if !req.Stream {
+			if answer != "" {
+				fmt.Fprintf(w, `{"choices":[{"message":{"content":%q}}]}`, answer)
+				return
+			}
+			fmt.Fprintf(w, `{"choices":[{"message":{"tool_calls":[{"id":"call_%d","type":"function","function":{"name":"query_trends","arguments":%q}}]}}]}`, requests, args)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		if answer != "" {
+			for _, word := range strings.SplitAfter(answer, " ") {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", word)
+			}
+		} else {
+			// Arguments arrive split across chunks.
+			fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"id\":\"call_%d\",\"type\":\"function\",\"function\":{\"name\":\"query_trends\",\"arguments\":\"\"}}]}}]}\n\n", requests)
+			for _, part := range []string{args[:10], args[10:]} {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"tool_calls\":[{\"index\":0,\"function\":{\"arguments\":%q}}]}}]}\n\n", part)
+			}
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer provider.Close()
+	key, baseURL := "sk-test", provider.URL
+	if err := s.meta.SetLLMConfig(context.Background(), storage.LLMConfig{
+		ProjectID: project.ID, Provider: "openai", APIKey: &key, BaseURL: &baseURL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", `{"message":"how many events today?"}`, project, "u1"))
+	var resp struct {
+		Reply string `json:"reply"`
+	}
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil || resp.Reply != "3 events today." || requests != 2 {
+		t.Fatalf("buffered: %d %q after %d requests, want the tool's total in the reply after 2", w.Code, resp.Reply, requests)
+	}
+
+	requests = 0
+	w = httptest.NewRecorder()
+	s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", `{"message":"how many events today?","stream":true}`, project, "u2"))
+	var streamed strings.Builder
+	for line := range strings.SplitSeq(w.Body.String(), "\n") {
+		var c chatChunk
+		if data, ok := strings.CutPrefix(line, "data: "); ok && data != "[DONE]" && json.Unmarshal([]byte(data), &c) == nil && len(c.Choices) > 0 {
+			streamed.WriteString(c.Choices[0].Delta["content"])
+		}
+	}
+	if streamed.String() != "3 events today." || requests != 2 {
+		t.Fatalf("streamed: %q after %d requests: %s", streamed.String(), requests, w.Body)
+	}
+
+	// A model that never stops calling tools is cut off.
+	loop, requests = true, 0
+	w = httptest.NewRecorder()
+	s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", `{"message":"loop"}`, project, "u3"))
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil || resp.Reply != "Out of lookups." || requests != ai.MaxToolRounds {
+		t.Fatalf("loop: %d %q after %d requests, want an answer after %d", w.Code, resp.Reply, requests, ai.MaxToolRounds)
+	}
+
+	// Nor does a backend that ignores tool_choice "none" get more rounds.
+	stubborn, requests = true, 0
+	w = httptest.NewRecorder()
+	s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", `{"message":"loop"}`, project, "u4"))
+	if w.Code != http.StatusInternalServerError || requests != ai.MaxToolRounds {
+		t.Fatalf("stubborn: %d after %d requests, want an error after %d", w.Code, requests, ai.MaxToolRounds)
+	}
+	requests = 0
+	w = httptest.NewRecorder()
+	s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", `{"message":"loop","stream":true}`, project, "u5"))
+	if !strings.Contains(w.Body.String(), "kept calling tools") || requests != ai.MaxToolRounds {
+		t.Fatalf("stubborn streamed: after %d requests, want an error frame after %d: %s", requests, ai.MaxToolRounds, w.Body)
+	}
+}
+
+func TestChatTools_RejectOversizedTrendRanges(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	trends := s.chatTools(project.ID, time.UTC)[0]
+
+	cases := []struct {
+		args string
+		ok   bool
+	}{
+		{`{"interval":"hour","start":"2020-01-01","end":"2024-12-31"}`, false},
+		{`{"interval":"day","start":"2020-01-01","end":"2024-12-31"}`, false},
+		{`{"interval":"hour","start":"2024-01-01","end":"2024-01-14"}`, true},
+		{`{"interval":"week","start":"2020-01-01","end":"2024-12-31"}`, true},
+		{`{"interval":"month","start":"2000-01-01","end":"2024-12-31"}`, true},
+	}
+	for _, c := range cases {
+		_, err := trends.Run(context.Background(), json.RawMessage(c.args))
+		if c.ok && err != nil {
+			t.Errorf("%s: %v", c.args, err)
+		}
+		if !c.ok && (err == nil || !strings.Contains(err.Error(), "too many")) {
+			t.Errorf("%s: expected the range refused, got %v", c.args, err)
+		}
+	}
+}
@@ -14,6 +14,8 @@ import (
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
 )
 
 // handleSeed creates the first user and project in this instance.
@@ -21,13 +23,13 @@ import (
 func (s *Server) handleSeed(w http.ResponseWriter, r *http.Request) {
 	secret := os.Getenv("INSTANCE_SECRET")
 	if secret == "" {
-		http.Error(w, `{"error":"seed not configured"}`, http.StatusNotFound)
+		apierror.Error(w, "seed not configured", http.StatusNotFound)
 		return
 	}
 
 	auth := r.Header.Get("Authorization")
 	if auth != "Bearer "+secret {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -36,7 +38,7 @@ func (s *Server) handleSeed(w http.ResponseWriter, r *http.Request) {
 	// Reject if any user already exists.
 	userCount, _ := s.meta.CountUsers(ctx)
 	if userCount > 0 {
-		http.Error(w, `{"error":"instance already seeded"}`, http.StatusConflict)
+		apierror.Error(w, "instance already seeded", http.StatusConflict)
 		return
 	}
 
@@ -45,19 +47,19 @@ func (s *Server) handleSeed(w http.ResponseWriter, r *http.Request) {
 		PasswordHash string `json:"password_hash"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		apierror.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
 
 	if req.Email == "" || req.PasswordHash == "" {
-		http.Error(w, `{"error":"email and password_hash required"}`, http.StatusBadRequest)
+		apierror.Error(w, "email and password_hash required", http.StatusBadRequest)
 		return
 	}
 
 	user, err := s.meta.CreateUser(ctx, req.Email, req.PasswordHash)
 	if err != nil {
 		log.Printf("seed: create user: %v", err)
-		http.Error(w, `{"error":"failed to create user"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to create user", http.StatusInternalServerError)
 		return
 	}
 
@@ -65,7 +67,7 @@ func (s *Server) handleSeed(w http.ResponseWriter, r *http.Request) {
 	project, err := s.meta.CreateProject(ctx, projectID, "My Project")
 	if err != nil {
 		log.Printf("seed: create project: %v", err)
-		http.Error(w, `{"error":"failed to create project"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to create project", http.StatusInternalServerError)
 		return
 	}
 
@@ -88,13 +90,13 @@ func (s *Server) handleTokenExchange(w http.ResponseWriter, r *http.Request) {
 		Token string `json:"token"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		apierror.Error(w, "invalid request", http.StatusBadRequest)
 		return
 	}
 
 	controlPlaneURL := s.config.ControlPlaneURL
 	if controlPlaneURL == "" {
-		http.Error(w, `{"error":"not a cloud instance"}`, http.StatusNotFound)
+		apierror.Error(w, "not a cloud instance", http.StatusNotFound)
 		return
 	}
 
@@ -106,7 +108,7 @@ func (s *Server) handleTokenExchange(w http.ResponseWriter, r *http.Request) {
 	client := &http.Client{Timeout: 10 * time.Second}
 	resp, err := client.Do(verifyReq)
 	if err != nil || resp.StatusCode != http.StatusOK {
-		http.Error(w, `{"error":"invalid token"}`, http.StatusUnauthorized)
+		apierror.Error(w, "invalid token", http.StatusUnauthorized)
 		return
 	}
 	defer resp.Body.Close()
@@ -116,7 +118,7 @@ func (s *Server) handleTokenExchange(w http.ResponseWriter, r *http.Request) {
 		Email      string `json:"email"`
 	}
 	if err := json.NewDecoder(resp.Body).Decode(&claims); err != nil {
-		http.Error(w, `{"error":"invalid token response"}`, http.StatusUnauthorized)
+		apierror.Error(w, "invalid token response", http.StatusUnauthorized)
 		return
 	}
 
@@ -130,7 +132,7 @@ func (s *Server) handleTokenExchange(w http.ResponseWriter, r *http.Request) {
 		user, err = s.meta.CreateUser(ctx, claims.Email, string(randomHash))
 		if err != nil {
 			log.Printf("token-exchange: create user: %v", err)
-			http.Error(w, `{"error":"failed to create user"}`, http.StatusInternalServerError)
+			apierror.Error(w, "failed to create user", http.StatusInternalServerError)
 			return
 		}
 	}
@@ -144,18 +146,18 @@ func (s *Server) handleTokenExchange(w http.ResponseWriter, r *http.Request) {
 
 	token, err := s.meta.CreateUserSession(ctx, user.ID, time.Now().Add(7*24*time.Hour), projectID)
 	if err != nil {
-		http.Error(w, `{"error":"failed to create session"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to create session", http.StatusInternalServerError)
 		return
 	}
 
-	http.SetCookie(w, &http.Cookie{
+	http.SetCookie(w, s.crossSiteCookie(&http.Cookie{
 		Name:     "clicknest_session",
 		Value:    token,
 		Path:     "/",
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
 		MaxAge:   7 * 24 * 60 * 60,
-	})
+	}))
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
@@ -169,7 +171,7 @@ func (s *Server) handleBillingProxy(w http.ResponseWriter, r *http.Request) {
 	controlPlaneURL := s.config.ControlPlaneURL
 	instanceSecret := s.config.InstanceSecret
 	if controlPlaneURL == "" || instanceSecret == "" {
-		http.Error(w, `{"error":"not a cloud instance"}`, http.StatusNotFound)
+		apierror.Error(w, "not a cloud instance", http.StatusNotFound)
 		return
 	}
 
@@ -184,7 +186,7 @@ func (s *Server) handleBillingProxy(w http.ResponseWriter, r *http.Request) {
 
 	proxyReq, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, bodyReader)
 	if err != nil {
-		http.Error(w, `{"error":"proxy error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "proxy error", http.StatusInternalServerError)
 		return
 	}
 	proxyReq.Header.Set("Content-Type", "application/json")
@@ -197,7 +199,7 @@ func (s *Server) handleBillingProxy(w http.ResponseWriter, r *http.Request) {
 	proxyClient := &http.Client{Timeout: 30 * time.Second}
 	resp, err := proxyClient.Do(proxyReq)
 	if err != nil {
-		http.Error(w, `{"error":"control plane unreachable"}`, http.StatusBadGateway)
+		apierror.Error(w, "control plane unreachable", http.StatusBadGateway)
 		return
 	}
 	defer resp.Body.Close()
@@ -1,16 +1,62 @@
 package server
 
-import "net/http"
+import (
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+)
 
 // CORS wraps a handler with permissive CORS headers for SDK requests.
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, Authorization")
-		w.Header().Set("Access-Control-Max-Age", "86400")
+		setCORSHeaders(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cors applies the server's two CORS policies. Routes registered with
+// sdkRoute are public: any origin may call them (or only SDKOrigins, when
+// set), uncredentialed. Every other route belongs to the dashboard, which
+// only FrontendOrigin may call cross-origin, with credentials; preflights
+// from other origins are refused. FrontendOrigin gets credentialed access to
+// SDK routes too, since the dashboard calls some of them.
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		frontend := s.config.FrontendOrigin
+		sdk := s.isSDKRoute(r)
+		if frontend != "" || (sdk && len(s.config.SDKOrigins) > 0) {
+			w.Header().Add("Vary", "Origin")
+		}
+
+		allowed := true
+		switch {
+		case frontend != "" && origin == frontend:
+			w.Header().Set("Access-Control-Allow-Origin", frontend)
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		case sdk && len(s.config.SDKOrigins) == 0:
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case sdk && slices.Contains(s.config.SDKOrigins, origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		default:
+			allowed = origin == "" || sameHost(origin, r)
+		}
+		if allowed {
+			setCORSHeaders(w)
+		}
 
 		if r.Method == http.MethodOptions {
+			if !allowed {
+				apierror.Error(w, "cross-origin request not allowed", http.StatusForbidden)
+				return
+			}
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
@@ -18,3 +64,76 @@ func CORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// setCORSHeaders sets the CORS headers common to every allowed origin.
+func setCORSHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Encoding, X-API-Key, Authorization, Idempotency-Key, X-Project-ID")
+	w.Header().Set("Access-Control-Max-Age", "86400")
+}
+
+// sdkRoute registers a route the SDK or other public clients call from
+// arbitrary sites, putting it under the SDK CORS policy.
+func (s *Server) sdkRoute(pattern string, h http.Handler) {
+	s.sdkRoutes[pattern] = true
+	s.mux.Handle(pattern, h)
+}
+
+// isSDKRoute reports whether r goes to an SDK route. A preflight is matched
+// by the method it asks about.
+func (s *Server) isSDKRoute(r *http.Request) bool {
+	if m := r.Header.Get("Access-Control-Request-Method"); r.Method == http.MethodOptions && m != "" {
+		preflight := *r
+		preflight.Method = m
+		r = &preflight
+	}
+	_, pattern := s.mux.Handler(r)
+	return s.sdkRoutes[pattern]
+}
+
+// originGuard rejects state-changing, cookie-authenticated requests from
+// foreign origins. It only matters with a separate frontend origin: the
+// session cookie is then SameSite=None and would otherwise be sent along with
+// requests forged by any site.
+func (s *Server) originGuard(next http.Handler) http.Handler {
+	if s.config.FrontendOrigin == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			origin := r.Header.Get("Origin")
+			if origin != "" && origin != s.config.FrontendOrigin && !sameHost(origin, r) {
+				apierror.Error(w, "cross-origin request not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// websocketOriginAllowed guards WebSocket handshakes, which are GETs that
+// browsers send cross-site along with cookies: a browser Origin must be the
+// frontend's or the server's own.
+func (s *Server) websocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	return origin == "" || (s.config.FrontendOrigin != "" && origin == s.config.FrontendOrigin) || sameHost(origin, r)
+}
+
+// sameHost reports whether origin names the host r was sent to.
+func sameHost(origin string, r *http.Request) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// crossSiteCookie adjusts a session cookie for a separate frontend origin:
+// browsers only send cookies on cross-site requests when SameSite=None, and
+// only accept SameSite=None together with Secure.
+func (s *Server) crossSiteCookie(c *http.Cookie) *http.Cookie {
+	if s.config.FrontendOrigin != "" {
+		c.SameSite = http.SameSiteNoneMode
+		c.Secure = true
+	}
+	return c
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// loginCookie issues a dashboard session for a new user and returns its cookie.
+func loginCookie(t *testing.T, s *Server, projectID string) *http.Cookie {
+	t.Helper()
+	user, err := s.meta.CreateUser(context.Background(), "owner@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	w := httptest.NewRecorder()
+	if err := s.issueSession(w, httptest.NewRequest("POST", "/api/v1/auth/login", nil), user.ID, projectID); err != nil {
+		t.Fatalf("issueSession: %v", err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected one session cookie, got %d", len(cookies))
+	}
+	return cookies[0]
+}
+
+func TestCORS_DefaultSingleOrigin(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	cookie := loginCookie(t, s, project.ID)
+	if cookie.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected SameSite=Strict by default, got %v", cookie.SameSite)
+	}
+
+	r := httptest.NewRequest("OPTIONS", "/api/v1/funnels", nil)
+	r.Header.Set("Origin", "https://app.example.com")
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected a cross-origin dashboard preflight to be refused, got %d %v", w.Code, w.Header())
+	}
+	if w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatal("expected no credentialed CORS by default")
+	}
+}
+
+func TestCORS_SeparateFrontendOrigin(t *testing.T) {
+	const frontend = "https://app.example.com"
+	s, project := newTestServer(t, Config{FrontendOrigin: frontend + "/"})
+	cookie := loginCookie(t, s, project.ID)
+	if cookie.SameSite != http.SameSiteNoneMode || !cookie.Secure {
+		t.Fatalf("expected SameSite=None; Secure cookie, got SameSite=%v Secure=%v", cookie.SameSite, cookie.Secure)
+	}
+
+	preflight := func(origin string) http.Header {
+		r := httptest.NewRequest("OPTIONS", "/api/v1/funnels", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, r)
+		return w.Header()
+	}
+	h := preflight(frontend)
+	if h.Get("Access-Control-Allow-Origin") != frontend || h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Fatalf("expected credentialed CORS for the frontend origin, got %v", h)
+	}
+	h = preflight("https://evil.example")
+	if h.Get("Access-Control-Allow-Origin") != "" || h.Get("Access-Control-Allow-Credentials") != "" {
+		t.Fatalf("expected other origins to get no CORS access, got %v", h)
+	}
+
+	post := func(origin string) int {
+		r := httptest.NewRequest("POST", "/api/v1/funnels", strings.NewReader(`{}`))
+		r.Header.Set("Origin", origin)
+		r.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, r)
+		return w.Code
+	}
+	if code := post("https://evil.example"); code != http.StatusForbidden {
+		t.Fatalf("expected cookie-authenticated POST from a foreign origin to be rejected, got %d", code)
+	}
+	if code := post(frontend); code == http.StatusForbidden || code == http.StatusUnauthorized {
+		t.Fatalf("expected POST from the frontend origin to reach the handler, got %d", code)
+	}
+}
+
+func TestCORS_SDKRoutesOpenDashboardClosed(t *testing.T) {
+	preflight := func(s *Server, path, method, origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("OPTIONS", path, nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", method)
+		r.Header.Set("Access-Control-Request-Headers", "content-type, x-api-key")
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	s, _ := newTestServer(t, Config{IngestPath: "/t/collect"})
+	for _, path := range []string{"/api/v1/events", "/t/collect"} {
+		w := preflight(s, path, "POST", "https://shop.example.net")
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+			t.Fatalf("expected an ingest preflight to %s from any origin to succeed, got %d %v", path, w.Code, w.Header())
+		}
+	}
+	r := httptest.NewRequest("GET", "/sdk.js", nil)
+	r.Header.Set("Origin", "https://shop.example.net")
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("expected /sdk.js to allow any origin, got %v", w.Header())
+	}
+	// The same path's dashboard method stays closed.
+	if w := preflight(s, "/api/v1/events", "GET", "https://shop.example.net"); w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected a dashboard preflight from a random origin to fail, got %d %v", w.Code, w.Header())
+	}
+	if w := preflight(s, "/api/v1/events", "GET", "http://example.com"); w.Code != http.StatusNoContent {
+		t.Fatalf("expected a same-origin preflight to succeed, got %d", w.Code)
+	}
+
+	// SDKOrigins narrows the SDK routes to the listed sites.
+	s, _ = newTestServer(t, Config{SDKOrigins: []string{"https://shop.example.net"}})
+	if w := preflight(s, "/api/v1/events", "POST", "https://shop.example.net"); w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "https://shop.example.net" {
+		t.Fatalf("expected a listed origin to be allowed, got %d %v", w.Code, w.Header())
+	}
+	if w := preflight(s, "/api/v1/events", "POST", "https://other.example.org"); w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Fatalf("expected an unlisted origin to be refused, got %d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/ingest"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// demoProperty marks seeded demo events ("demo": true) so they can be told
+// apart from real traffic and purged in one query.
+const demoProperty = "demo"
+
+// Demo data shape: demoSessions visits spread over the last demoDays days,
+// drawn from a generator seeded with demoSeed.
+const (
+	demoSessions = 300
+	demoDays     = 14
+	demoSeed     = 1
+)
+
+// demoStep is one event of the seeded signup journey. keep is the fraction
+// of visitors at the previous step who go on to this one.
+type demoStep struct {
+	eventType string
+	path      string
+	tag, id   string
+	text      string
+	keep      float64
+}
+
+// demoJourney is the funnel-shaped path every demo visit walks down until it
+// drops off.
+var demoJourney = []demoStep{
+	{eventType: "pageview", path: "/", keep: 1},
+	{eventType: "click", path: "/", tag: "a", id: "nav-pricing", text: "Pricing", keep: 0.6},
+	{eventType: "pageview", path: "/pricing", keep: 0.95},
+	{eventType: "click", path: "/pricing", tag: "button", id: "start-trial", text: "Start free trial", keep: 0.45},
+	{eventType: "pageview", path: "/signup", keep: 0.9},
+	{eventType: "submit", path: "/signup", tag: "form", id: "signup-form", text: "Create account", keep: 0.55},
+	{eventType: "pageview", path: "/onboarding", keep: 0.95},
+}
+
+var demoReferrers = []string{"", "", "https://www.google.com/", "https://news.ycombinator.com/", "https://twitter.com/"}
+
+// demoEvents generates the seeded events. The generator is seeded so every
+// run produces the same shape of data, shifted to end at now.
+func demoEvents(projectID string, now time.Time) []storage.Event {
+	rng := rand.New(rand.NewPCG(demoSeed, demoSeed))
+	var events []storage.Event
+	for i := range demoSessions {
+		sessionID := "demo_" + strconv.Itoa(i)
+		// Ends a quarter hour back so no journey runs past now.
+		start := now.Add(-15*time.Minute - time.Duration(rng.Int64N(int64(demoDays*24*time.Hour))))
+		referrer := demoReferrers[rng.IntN(len(demoReferrers))]
+		var distinctID string
+		at := start
+		for j, step := range demoJourney {
+			if rng.Float64() >= step.keep {
+				break
+			}
+			if step.eventType == "submit" {
+				distinctID = "demo_user_" + strconv.Itoa(i)
+			}
+			e := storage.Event{
+				ProjectID:   projectID,
+				SessionID:   sessionID,
+				DistinctID:  distinctID,
+				EventType:   step.eventType,
+				Fingerprint: ingest.ComputeFingerprint(step.tag, step.id, "", "", step.path),
+				ElementTag:  step.tag,
+				ElementID:   step.id,
+				ElementText: step.text,
+				URL:         "https://demo.clicknest.dev" + step.path,
+				URLPath:     step.path,
+				Timestamp:   at,
+				Properties:  map[string]any{demoProperty: true},
+			}
+			if j == 0 {
+				e.Referrer = referrer
+			}
+			if step.eventType == "pageview" {
+				e.PageTitle = "Demo " + step.path
+			}
+			events = append(events, e)
+			at = at.Add(time.Duration(5+rng.IntN(90)) * time.Second)
+		}
+	}
+	return events
+}
+
+// demoFilter matches the project's seeded demo events.
+func demoFilter(projectID string) storage.EventFilter {
+	return storage.EventFilter{ProjectID: projectID, PropertyKey: demoProperty, PropertyValue: "true"}
+}
+
+// seedDemoHandler fills the project with synthetic demo events: a few hundred
+// visits over the past two weeks walking a landing → pricing → signup →
+// onboarding journey with realistic drop-off. Every event carries
+// "demo": true and a demo_ session ID, so DELETE removes them all. Limited
+// to the instance admin, like the other admin endpoints.
+// POST /api/v1/admin/seed-demo
+func (s *Server) seedDemoHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.requireInstanceAdmin(w, r) {
+		return
+	}
+
+	// Reseeding replaces the previous demo data rather than doubling it.
+	if _, err := s.events.DeleteEvents(r.Context(), demoFilter(project.ID)); err != nil {
+		log.Printf("ERROR clearing demo events: %v", err)
+		apierror.Error(w, "seeding demo data failed", http.StatusInternalServerError)
+		return
+	}
+	events := demoEvents(project.ID, time.Now().UTC())
+	if err := s.events.InsertEvents(r.Context(), events); err != nil {
+		log.Printf("ERROR seeding demo events: %v", err)
+		apierror.Error(w, "seeding demo data failed", http.StatusInternalServerError)
+		return
+	}
+	s.live.notify(project.ID)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"events":   len(events),
+		"sessions": demoSessions,
+	})
+}
+
+// purgeDemoHandler deletes the project's seeded demo events, leaving real
+// traffic alone.
+// DELETE /api/v1/admin/seed-demo
+func (s *Server) purgeDemoHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.requireInstanceAdmin(w, r) {
+		return
+	}
+
+	deleted, err := s.events.DeleteEvents(r.Context(), demoFilter(project.ID))
+	if err != nil {
+		log.Printf("ERROR purging demo events: %v", err)
+		apierror.Error(w, "purging demo data failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"deleted": deleted})
+}
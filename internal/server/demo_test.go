@@ -0,0 +1,84 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/query"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestSeedDemo_QueryableAndPurgeable(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	adminID, memberID := seedInstanceUsers(t, s, project)
+	ctx := context.Background()
+	real := storage.Event{ProjectID: project.ID, SessionID: "real", EventType: "pageview",
+		URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC().Add(-time.Hour)}
+	if err := s.events.InsertEvents(ctx, []storage.Event{real}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	// Project members can't inject or purge synthetic data.
+	w := httptest.NewRecorder()
+	s.seedDemoHandler(w, authedRequest("POST", "/api/v1/admin/seed-demo", "", project, memberID))
+	assertAPIError(t, "member seed", w, http.StatusForbidden, "forbidden")
+	w = httptest.NewRecorder()
+	s.purgeDemoHandler(w, authedRequest("DELETE", "/api/v1/admin/seed-demo", "", project, memberID))
+	assertAPIError(t, "member purge", w, http.StatusForbidden, "forbidden")
+
+	seed := func() int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.seedDemoHandler(w, authedRequest("POST", "/api/v1/admin/seed-demo", "", project, adminID))
+		var resp struct {
+			Events int `json:"events"`
+		}
+		if w.Code != http.StatusCreated || json.NewDecoder(w.Body).Decode(&resp) != nil || resp.Events == 0 {
+			t.Fatalf("seed: %d %s", w.Code, w.Body.String())
+		}
+		return resp.Events
+	}
+	seeded := seed()
+	// Reseeding replaces the demo data instead of doubling it.
+	if again := seed(); again != seeded {
+		t.Fatalf("expected a reseed to produce %d events, got %d", seeded, again)
+	}
+
+	qh := query.NewHandler(s.events, s.meta)
+	w = httptest.NewRecorder()
+	qh.SessionsHandler(w, authedRequest("GET", "/api/v1/sessions?limit=1000&start="+
+		time.Now().UTC().Add(-15*24*time.Hour).Format(time.RFC3339), "", project, ""))
+	var sessions struct {
+		Total int64 `json:"total"`
+	}
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&sessions) != nil || sessions.Total != demoSessions+1 {
+		t.Fatalf("expected %d sessions, got %d: %s", demoSessions+1, sessions.Total, w.Body.String())
+	}
+
+	// The journey narrows like a funnel: fewer signups than landings.
+	steps := []storage.FunnelStep{{EventType: "pageview", URLPath: "/"}, {EventType: "submit", URLPath: "/signup"}}
+	funnel, err := s.events.QueryFunnel(ctx, project.ID, steps, time.Now().Add(-15*24*time.Hour), time.Now(), 0, storage.FunnelOrdered, storage.FunnelPopulation{})
+	if err != nil {
+		t.Fatalf("QueryFunnel: %v", err)
+	}
+	if len(funnel) != 2 || funnel[1].Count == 0 || funnel[1].Count >= funnel[0].Count {
+		t.Fatalf("expected a narrowing demo funnel, got %+v", funnel)
+	}
+
+	w = httptest.NewRecorder()
+	s.purgeDemoHandler(w, authedRequest("DELETE", "/api/v1/admin/seed-demo", "", project, adminID))
+	var purged struct {
+		Deleted int `json:"deleted"`
+	}
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&purged) != nil || purged.Deleted != seeded {
+		t.Fatalf("expected %d demo events purged, got %d: %s", seeded, purged.Deleted, w.Body.String())
+	}
+	left, _ := s.events.QueryEvents(ctx, storage.EventFilter{ProjectID: project.ID})
+	if len(left) != 1 || left[0].SessionID != "real" {
+		t.Fatalf("expected only the real event to remain, got %+v", left)
+	}
+}
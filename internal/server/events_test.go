@@ -0,0 +1,291 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/query"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestDeleteEvents_ByFilter(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedUserEvents(t, s, project.ID, "junk", "junk", "keep")
+	h := query.NewHandler(s.events, s.meta)
+
+	for _, target := range []string{"/api/v1/events", "/api/v1/events?limit=5", "/api/v1/events?start=yesterday"} {
+		w := httptest.NewRecorder()
+		h.DeleteEventsHandler(w, authedRequest("DELETE", target, "", project, ""))
+		assertAPIError(t, target, w, http.StatusBadRequest, "invalid_request")
+	}
+
+	w := httptest.NewRecorder()
+	h.DeleteEventsHandler(w, authedRequest("DELETE", "/api/v1/events?session_id=s-junk", "", project, ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Deleted int64 `json:"deleted"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Deleted != 2 {
+		t.Fatalf("expected 2 deleted, got %d", resp.Deleted)
+	}
+
+	left, err := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID})
+	if err != nil {
+		t.Fatalf("QueryEvents: %v", err)
+	}
+	if len(left) != 1 || left[0].SessionID != "s-keep" {
+		t.Fatalf("expected only the kept event left, got %+v", left)
+	}
+}
+
+func TestEvents_LimitClamped(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedUserEvents(t, s, project.ID, "a", "b", "c", "d", "e")
+
+	list := func(h *query.Handler, target string) (count, limit int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		h.EventsHandler(w, authedRequest("GET", target, "", project, ""))
+		var resp struct {
+			Count int `json:"count"`
+			Limit int `json:"limit"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil {
+			t.Fatalf("%s: status %d: %s", target, w.Code, w.Body.String())
+		}
+		return resp.Count, resp.Limit
+	}
+
+	capped := query.NewHandler(s.events, s.meta)
+	capped.SetMaxLimit(3)
+	if count, limit := list(capped, "/api/v1/events?limit=1000000"); count != 3 || limit != 3 {
+		t.Fatalf("expected 3 events at limit 3, got %d at %d", count, limit)
+	}
+	if _, limit := list(query.NewHandler(s.events, s.meta), "/api/v1/events?limit=1000000"); limit != query.DefaultMaxLimit {
+		t.Fatalf("expected the default cap %d, got %d", query.DefaultMaxLimit, limit)
+	}
+	if count, limit := list(capped, "/api/v1/events?limit=2"); count != 2 || limit != 2 {
+		t.Fatalf("expected an in-range limit kept, got %d at %d", count, limit)
+	}
+}
+
+func TestEvents_CursorPagesStableUnderInserts(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	insert := func(session string, at time.Time) {
+		t.Helper()
+		if err := s.events.InsertEvents(ctx, []storage.Event{{ProjectID: project.ID, SessionID: session, EventType: "pageview",
+			Fingerprint: "fp", URL: "https://example.com/", URLPath: "/", Timestamp: at}}); err != nil {
+			t.Fatalf("InsertEvents: %v", err)
+		}
+	}
+	// Five events, two sharing a timestamp so the ID tie-break matters.
+	for i, offset := range []int{0, 1, 2, 2, 3} {
+		insert("old-"+string(rune('a'+i)), base.Add(time.Duration(offset)*time.Minute))
+	}
+
+	h := query.NewHandler(s.events, s.meta)
+	page := func(cursor string) ([]storage.Event, string) {
+		t.Helper()
+		target := "/api/v1/events?limit=2"
+		if cursor != "" {
+			target += "&cursor=" + url.QueryEscape(cursor)
+		}
+		w := httptest.NewRecorder()
+		h.EventsHandler(w, authedRequest("GET", target, "", project, ""))
+		var resp struct {
+			Events     []storage.Event `json:"events"`
+			NextCursor string          `json:"next_cursor"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil {
+			t.Fatalf("%s: status %d: %s", target, w.Code, w.Body.String())
+		}
+		return resp.Events, resp.NextCursor
+	}
+
+	seen := map[string]bool{}
+	events, cursor := page("")
+	for cursor != "" {
+		for _, e := range events {
+			if seen[e.ID] {
+				t.Fatalf("event %s returned twice", e.ID)
+			}
+			seen[e.ID] = true
+		}
+		// New events arriving between pages must not shift later pages.
+		insert("new", time.Now().UTC())
+		events, cursor = page(cursor)
+	}
+	for _, e := range events {
+		seen[e.ID] = true
+	}
+	if len(seen) != 5 {
+		t.Fatalf("expected all 5 original events across pages, got %d", len(seen))
+	}
+
+	w := httptest.NewRecorder()
+	h.EventsHandler(w, authedRequest("GET", "/api/v1/events?cursor=garbage", "", project, ""))
+	assertAPIError(t, "bad cursor", w, http.StatusBadRequest, "invalid_request")
+}
+
+func TestEvents_SparseFields(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedUserEvents(t, s, project.ID, "a", "b")
+	h := query.NewHandler(s.events, s.meta)
+
+	w := httptest.NewRecorder()
+	h.EventsHandler(w, authedRequest("GET", "/api/v1/events?fields=id,%20event_type,distinct_id", "", project, ""))
+	var resp struct {
+		Events []map[string]any `json:"events"`
+		Count  int              `json:"count"`
+	}
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil || resp.Count != 2 || len(resp.Events) != 2 {
+		t.Fatalf("events: %d %s", w.Code, w.Body.String())
+	}
+	for _, e := range resp.Events {
+		if len(e) != 3 || e["id"] == "" || e["event_type"] != "pageview" || e["distinct_id"] == nil {
+			t.Errorf("expected only id, event_type and distinct_id, got %v", e)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.EventsHandler(w, authedRequest("GET", "/api/v1/events?fields=id,password", "", project, ""))
+	assertAPIError(t, "unknown field", w, http.StatusBadRequest, "invalid_request")
+}
+
+func TestHeartbeat_ReportsLatestEvent(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	heartbeat := func() (last *time.Time, since *int64) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.heartbeatHandler(w, authedRequest("GET", "/api/v1/heartbeat", "", project, ""))
+		var resp struct {
+			LastEventAt  *time.Time `json:"last_event_at"`
+			SecondsSince *int64     `json:"seconds_since"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		return resp.LastEventAt, resp.SecondsSince
+	}
+
+	if last, since := heartbeat(); last != nil || since != nil {
+		t.Fatalf("expected null fields before any event, got %v %v", last, since)
+	}
+
+	latest := time.Now().UTC().Add(-90 * time.Second).Truncate(time.Second)
+	for _, at := range []time.Time{latest.Add(-time.Hour), latest} {
+		if err := s.events.InsertEvents(context.Background(), []storage.Event{{ProjectID: project.ID, SessionID: "s1",
+			EventType: "pageview", URL: "https://example.com/", URLPath: "/", Timestamp: at}}); err != nil {
+			t.Fatalf("InsertEvents: %v", err)
+		}
+	}
+	last, since := heartbeat()
+	if last == nil || !last.Equal(latest) {
+		t.Fatalf("expected last_event_at %v, got %v", latest, last)
+	}
+	if since == nil || *since < 90 || *since > 120 {
+		t.Fatalf("expected about 90 seconds since, got %v", since)
+	}
+}
+
+func TestIdentify_BackfillsAnonymousSessionEvents(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-time.Hour)
+	event := func(session, distinctID string, at time.Duration) storage.Event {
+		return storage.Event{ProjectID: project.ID, SessionID: session, DistinctID: distinctID, EventType: "pageview",
+			URL: "https://example.com/", URLPath: "/", Timestamp: base.Add(at)}
+	}
+	if err := s.events.InsertEvents(ctx, []storage.Event{
+		// s1 browses without an ID, then signs in as anon-1's user.
+		event("s1", "", 0), event("s1", "", time.Minute), event("s1", "anon-1", 2*time.Minute),
+		// s2 is a shared device: its first anonymous event belongs to other.
+		event("s2", "", 0), event("s2", "other", time.Minute), event("s2", "", 2*time.Minute), event("s2", "anon-1", 3*time.Minute),
+		// s3 never identifies.
+		event("s3", "", 0),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	s.identifyHandler(w, authedRequest("POST", "/api/v1/identify", `{"anonymous_id":"anon-1","distinct_id":"user-1"}`, project, ""))
+	var resp map[string]any
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil || resp["events_updated"] != float64(2) || resp["session_events_updated"] != float64(3) {
+		t.Fatalf("expected 2 merged and 3 backfilled, got %d %v", w.Code, resp)
+	}
+
+	for session, want := range map[string][]string{
+		"s1": {"user-1", "user-1", "user-1"},
+		"s2": {"", "other", "user-1", "user-1"},
+		"s3": {""},
+	} {
+		events, err := s.events.QueryEvents(ctx, storage.EventFilter{ProjectID: project.ID, SessionID: session})
+		if err != nil || len(events) != len(want) {
+			t.Fatalf("%s: expected %d events, got %d (%v)", session, len(want), len(events), err)
+		}
+		// QueryEvents is newest first.
+		for i, e := range events {
+			if got := want[len(want)-1-i]; e.DistinctID != got {
+				t.Errorf("%s at %v: expected distinct ID %q, got %q", session, e.Timestamp.Sub(base), got, e.DistinctID)
+			}
+		}
+	}
+}
+
+func TestIdentify_MergesAndAliasesAnonymousID(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	if err := s.events.InsertEvents(ctx, []storage.Event{
+		{ProjectID: project.ID, SessionID: "s1", DistinctID: "anon-1", EventType: "pageview", URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC()},
+		{ProjectID: project.ID, SessionID: "s1", DistinctID: "anon-1", EventType: "click", URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC()},
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	identify := func(body string) (int, map[string]any) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.identifyHandler(w, authedRequest("POST", "/api/v1/identify", body, project, ""))
+		var resp map[string]any
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	code, resp := identify(`{"anonymous_id":"anon-1","distinct_id":"user-1"}`)
+	if code != http.StatusOK || resp["events_updated"] != float64(2) {
+		t.Fatalf("expected 2 events merged, got %d %v", code, resp)
+	}
+	// Repeating the merge is a no-op.
+	if code, resp := identify(`{"anonymous_id":"anon-1","distinct_id":"user-1"}`); code != http.StatusOK || resp["events_updated"] != float64(0) {
+		t.Fatalf("expected an idempotent repeat, got %d %v", code, resp)
+	}
+	events, _ := s.events.QueryEvents(ctx, storage.EventFilter{ProjectID: project.ID, DistinctID: "user-1"})
+	if len(events) != 2 {
+		t.Fatalf("expected both events under user-1, got %d", len(events))
+	}
+	if id, _ := s.meta.ResolveIdentity(ctx, project.ID, "anon-1"); id != "user-1" {
+		t.Fatalf("expected future anon-1 events to resolve to user-1, got %q", id)
+	}
+
+	// Merging into a merged ID aliases straight to the canonical one.
+	if code, resp := identify(`{"anonymous_id":"anon-2","distinct_id":"anon-1"}`); code != http.StatusOK || resp["distinct_id"] != "user-1" {
+		t.Fatalf("expected anon-2 aliased to user-1, got %d %v", code, resp)
+	}
+	if code, _ := identify(`{"anonymous_id":"user-1","distinct_id":"anon-1"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected a self-merge to be rejected, got %d", code)
+	}
+	if code, _ := identify(`{"anonymous_id":"anon-3"}`); code != http.StatusBadRequest {
+		t.Fatalf("expected missing distinct_id to be rejected, got %d", code)
+	}
+}
@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/ingest"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// fingerprintBatch is how many distinct elements a recompute rewrites per
+// DuckDB transaction, and so how often its progress advances.
+const fingerprintBatch = 200
+
+// fingerprintJob is the progress of a project's fingerprint recompute.
+type fingerprintJob struct {
+	Status        string                      `json:"status"` // running, done or failed
+	Strategy      storage.FingerprintStrategy `json:"strategy"`
+	Done          int                         `json:"done"`  // distinct elements processed
+	Total         int                         `json:"total"` // distinct elements to process
+	Changed       int                         `json:"changed"`
+	EventsMoved   int64                       `json:"events_moved"`
+	NamesRelinked int                         `json:"names_relinked"`
+	Error         string                      `json:"error,omitempty"`
+	StartedAt     time.Time                   `json:"started_at"`
+	FinishedAt    *time.Time                  `json:"finished_at,omitempty"`
+}
+
+// fingerprintJobs holds the latest recompute per project.
+type fingerprintJobs struct {
+	mu   sync.Mutex
+	jobs map[string]*fingerprintJob
+}
+
+func newFingerprintJobs() *fingerprintJobs {
+	return &fingerprintJobs{jobs: make(map[string]*fingerprintJob)}
+}
+
+// start registers a new running job, or reports false if one is running.
+func (j *fingerprintJobs) start(projectID string, st storage.FingerprintStrategy) (fingerprintJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if job := j.jobs[projectID]; job != nil && job.Status == "running" {
+		return *job, false
+	}
+	job := &fingerprintJob{Status: "running", Strategy: st, StartedAt: time.Now().UTC()}
+	j.jobs[projectID] = job
+	return *job, true
+}
+
+// get returns a copy of the project's latest job.
+func (j *fingerprintJobs) get(projectID string) (fingerprintJob, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	job := j.jobs[projectID]
+	if job == nil {
+		return fingerprintJob{}, false
+	}
+	return *job, true
+}
+
+func (j *fingerprintJobs) update(projectID string, fn func(*fingerprintJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if job := j.jobs[projectID]; job != nil {
+		fn(job)
+	}
+}
+
+// getFingerprintStrategyHandler returns the project's fingerprint strategy.
+func (s *Server) getFingerprintStrategyHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.meta.FingerprintStrategy(r.Context(), project.ID))
+}
+
+// putFingerprintStrategyHandler sets the strategy new events are fingerprinted
+// under. Historical events keep their fingerprints until
+// POST /api/v1/admin/recompute-fingerprints.
+func (s *Server) putFingerprintStrategyHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var st storage.FingerprintStrategy
+	if err := json.NewDecoder(r.Body).Decode(&st); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := s.meta.SetFingerprintStrategy(r.Context(), project.ID, st); err != nil {
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// recomputeFingerprintsHandler starts rewriting every historical event's
+// fingerprint under the project's current strategy, then re-links names to
+// the new fingerprints. It runs in the background; poll GET on the same path
+// for progress. A second start while one runs is a 409. Only the instance
+// admin may start one, since it rewrites the project's full history.
+// POST /api/v1/admin/recompute-fingerprints
+func (s *Server) recomputeFingerprintsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.requireInstanceAdmin(w, r) {
+		return
+	}
+
+	st := s.meta.FingerprintStrategy(r.Context(), project.ID)
+	job, ok := s.fingerprints.start(project.ID, st)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(job)
+		return
+	}
+	go s.recomputeFingerprints(context.Background(), project.ID, st)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// fingerprintJobHandler reports the project's latest recompute.
+// GET /api/v1/admin/recompute-fingerprints
+func (s *Server) fingerprintJobHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	job, ok := s.fingerprints.get(project.ID)
+	if !ok {
+		apierror.Error(w, "no recompute has run", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// recomputeFingerprints runs a recompute job to completion.
+func (s *Server) recomputeFingerprints(ctx context.Context, projectID string, st storage.FingerprintStrategy) {
+	compute := func(tag, id, classes, parentPath, urlPath string) string {
+		return ingest.ComputeFingerprintWith(st, tag, id, classes, parentPath, urlPath)
+	}
+	changes, err := s.events.RecomputeFingerprints(ctx, projectID, compute, fingerprintBatch, func(done, total int) {
+		s.fingerprints.update(projectID, func(j *fingerprintJob) { j.Done, j.Total = done, total })
+	})
+	var relinked int
+	if err == nil {
+		relinked = s.relinkFingerprintNames(ctx, projectID, changes)
+		// Elements that had no name under any old fingerprint get one now.
+		if s.namer != nil {
+			go s.namer.Backfill(context.Background(), projectID)
+		}
+	} else {
+		log.Printf("ERROR recomputing fingerprints for %s: %v", projectID, err)
+	}
+
+	s.fingerprints.update(projectID, func(j *fingerprintJob) {
+		now := time.Now().UTC()
+		j.FinishedAt = &now
+		if err != nil {
+			j.Status, j.Error = "failed", err.Error()
+			return
+		}
+		j.Status, j.Changed, j.NamesRelinked = "done", len(changes), relinked
+		for _, c := range changes {
+			j.EventsMoved += c.Events
+		}
+	})
+}
+
+// relinkFingerprintNames gives each new fingerprint the name of the old
+// fingerprint that contributed most of its events, unless it already has
+// one (as when a strategy is reverted), and stamps that name on its events.
+// Old names are kept so a revert finds them again. It returns the number of
+// names copied.
+func (s *Server) relinkFingerprintNames(ctx context.Context, projectID string, changes []storage.FingerprintChange) int {
+	byNew := make(map[string][]storage.FingerprintChange)
+	var fps []string
+	for _, c := range changes {
+		if byNew[c.New] == nil {
+			fps = append(fps, c.New)
+		}
+		byNew[c.New] = append(byNew[c.New], c)
+		fps = append(fps, c.Old)
+	}
+	names, err := s.meta.BatchGetEventNames(ctx, projectID, fps)
+	if err != nil {
+		log.Printf("ERROR re-linking names for %s: %v", projectID, err)
+		return 0
+	}
+
+	relinked := 0
+	for newFP, olds := range byNew {
+		en := names[newFP]
+		if en == nil {
+			sort.SliceStable(olds, func(i, j int) bool { return olds[i].Events > olds[j].Events })
+			for _, c := range olds {
+				old := names[c.Old]
+				if old == nil {
+					continue
+				}
+				copied := *old
+				copied.Fingerprint = newFP
+				if err := s.meta.SetEventName(ctx, copied); err != nil {
+					log.Printf("WARN re-linking name %s to %s: %v", c.Old, newFP, err)
+					break
+				}
+				if copied.UserName != nil {
+					if err := s.meta.OverrideEventName(ctx, projectID, newFP, *copied.UserName); err != nil {
+						log.Printf("WARN re-linking name override %s to %s: %v", c.Old, newFP, err)
+					}
+				}
+				en = &copied
+				relinked++
+				break
+			}
+		}
+		if en == nil {
+			continue
+		}
+		if name := en.DisplayName(); name != "" {
+			if err := s.events.SetFingerprintEventName(ctx, projectID, newFP, name); err != nil {
+				log.Printf("WARN stamping name on %s: %v", newFP, err)
+			}
+		}
+	}
+	return relinked
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/ingest"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestRecomputeFingerprints_RegroupsUnderNewStrategy(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	adminID, memberID := seedInstanceUsers(t, s, project)
+	ctx := context.Background()
+	now := time.Now().UTC().Add(-time.Hour)
+	// The same nav button on two pages, across a deploy that changed its
+	// CSS-module hash: three fingerprints under the default strategy.
+	click := func(path, classes string, at time.Duration) storage.Event {
+		return storage.Event{
+			ProjectID: project.ID, SessionID: "s1", EventType: "click",
+			Fingerprint: ingest.ComputeFingerprint("a", "nav-pricing", classes, "nav", path),
+			ElementTag:  "a", ElementID: "nav-pricing", ElementClasses: classes, ParentPath: "nav",
+			URL: "https://example.com" + path, URLPath: path, Timestamp: now.Add(at),
+		}
+	}
+	events := []storage.Event{
+		click("/", "link Nav_link__3xK9q", 0),
+		click("/", "link Nav_link__3xK9q", time.Minute),
+		click("/blog", "link Nav_link__3xK9q", 2*time.Minute),
+		click("/", "link Nav_link__8pQ2z", 3*time.Minute),
+	}
+	if err := s.events.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	if err := s.meta.SetEventName(ctx, storage.EventName{
+		Fingerprint: events[0].Fingerprint, ProjectID: project.ID, AIName: "Click Pricing Nav",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.putFingerprintStrategyHandler(w, authedRequest("PUT", "/api/v1/settings/fingerprint-strategy",
+		`{"exclude_url_path": true, "strip_hashed_classes": true}`, project, ""))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("put strategy: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.recomputeFingerprintsHandler(w, authedRequest("POST", "/api/v1/admin/recompute-fingerprints", "", project, memberID))
+	assertAPIError(t, "member recompute", w, http.StatusForbidden, "forbidden")
+
+	w = httptest.NewRecorder()
+	s.recomputeFingerprintsHandler(w, authedRequest("POST", "/api/v1/admin/recompute-fingerprints", "", project, adminID))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("start recompute: %d %s", w.Code, w.Body.String())
+	}
+
+	var job fingerprintJob
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		w = httptest.NewRecorder()
+		s.fingerprintJobHandler(w, authedRequest("GET", "/api/v1/admin/recompute-fingerprints", "", project, ""))
+		if err := json.NewDecoder(w.Body).Decode(&job); err != nil {
+			t.Fatalf("decoding job: %v", err)
+		}
+		if job.Status != "running" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("recompute did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if job.Status != "done" || job.Done != 3 || job.Total != 3 || job.EventsMoved != 4 || job.NamesRelinked != 1 {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	want := ingest.ComputeFingerprintWith(storage.FingerprintStrategy{ExcludeURLPath: true, StripHashedClasses: true},
+		"a", "nav-pricing", "link", "nav", "")
+	got, err := s.events.QueryEvents(ctx, storage.EventFilter{ProjectID: project.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range got {
+		if e.Fingerprint != want || e.EventName == nil || *e.EventName != "Click Pricing Nav" {
+			t.Fatalf("expected every click under %s named Click Pricing Nav, got %s %v", want, e.Fingerprint, e.EventName)
+		}
+	}
+	if en, err := s.meta.GetEventName(ctx, project.ID, want); err != nil || en.AIName != "Click Pricing Nav" {
+		t.Fatalf("expected the name re-linked to the new fingerprint, got %+v (%v)", en, err)
+	}
+
+	// New events fingerprint under the strategy too, joining the group.
+	w = postEvents(t, s, project, `{"session_id": "s2", "events": [{"event_type": "click", "element_tag": "a",
+		"element_id": "nav-pricing", "element_classes": "link Nav_link__0zZ1y", "parent_path": "nav",
+		"url": "https://example.com/docs", "url_path": "/docs"}]}`, "")
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("ingest: %d %s", w.Code, w.Body.String())
+	}
+	got, _ = s.events.QueryEvents(ctx, storage.EventFilter{ProjectID: project.ID, SessionID: "s2"})
+	if len(got) != 1 || got[0].Fingerprint != want {
+		t.Fatalf("expected the new event under %s, got %+v", want, got)
+	}
+	if !strings.Contains(w.Body.String(), `"accepted":1`) {
+		t.Fatalf("unexpected ingest response %s", w.Body.String())
+	}
+}
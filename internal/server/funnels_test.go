@@ -0,0 +1,411 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/query"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestCreateFunnel_RejectsTooManySteps(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	h := query.NewHandler(s.events, s.meta)
+
+	create := func(n int) *httptest.ResponseRecorder {
+		steps := make([]storage.FunnelStep, n)
+		for i := range steps {
+			steps[i] = storage.FunnelStep{EventType: "pageview"}
+		}
+		body, _ := json.Marshal(map[string]any{"name": "Long", "steps": steps})
+		w := httptest.NewRecorder()
+		h.CreateFunnelHandler(w, authedRequest("POST", "/api/v1/funnels", string(body), project, ""))
+		return w
+	}
+
+	assertAPIError(t, "11 steps", create(storage.MaxFunnelSteps+1), http.StatusBadRequest, "invalid_request")
+	if w := create(storage.MaxFunnelSteps); w.Code != http.StatusCreated {
+		t.Fatalf("expected %d steps to be accepted, got %d: %s", storage.MaxFunnelSteps, w.Code, w.Body.String())
+	}
+	if funnels, _ := s.meta.ListFunnels(context.Background(), project.ID); len(funnels) != 1 {
+		t.Fatalf("expected only the in-bounds funnel saved, got %d", len(funnels))
+	}
+}
+
+func TestFunnelResults_ConversionWindow(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	h := query.NewHandler(s.events, s.meta)
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-10 * 24 * time.Hour)
+	visit := func(session string, after time.Duration) []storage.Event {
+		return []storage.Event{
+			{ProjectID: project.ID, SessionID: session, EventType: "pageview", URL: "https://example.com/pricing", URLPath: "/pricing", Timestamp: base},
+			{ProjectID: project.ID, SessionID: session, EventType: "pageview", URL: "https://example.com/signup", URLPath: "/signup", Timestamp: base.Add(after)},
+		}
+	}
+	// a converts within the hour, b three days later.
+	if err := s.events.InsertEvents(ctx, append(visit("a", time.Hour), visit("b", 72*time.Hour)...)); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	h.CreateFunnelHandler(w, authedRequest("POST", "/api/v1/funnels",
+		`{"name": "Signup", "window_hours": 24, "steps": [{"event_type": "pageview", "url_path": "/pricing"}, {"event_type": "pageview", "url_path": "/signup"}]}`, project, ""))
+	var funnel storage.Funnel
+	if w.Code != http.StatusCreated || json.NewDecoder(w.Body).Decode(&funnel) != nil || funnel.WindowHours != 24 {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	converted := func(query string) int64 {
+		t.Helper()
+		r := authedRequest("GET", "/api/v1/funnels/"+funnel.ID+"/results"+query, "", project, "")
+		r.SetPathValue("id", funnel.ID)
+		w := httptest.NewRecorder()
+		h.FunnelResultsHandler(w, r)
+		var resp struct {
+			Results []storage.FunnelResult `json:"results"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil || len(resp.Results) != 2 || resp.Results[0].Count != 2 {
+			t.Fatalf("results%s: %d %s", query, w.Code, w.Body.String())
+		}
+		return resp.Results[1].Count
+	}
+	if got := converted(""); got != 1 {
+		t.Fatalf("expected the stored 24h window to count only a, got %d", got)
+	}
+	if got := converted("?window_hours=0"); got != 2 {
+		t.Fatalf("expected no window to count both, got %d", got)
+	}
+	if got := converted("?window_hours=96"); got != 2 {
+		t.Fatalf("expected a 96h window to count both, got %d", got)
+	}
+
+	r := authedRequest("GET", "/api/v1/funnels/"+funnel.ID+"/results?window_hours=-1", "", project, "")
+	r.SetPathValue("id", funnel.ID)
+	w = httptest.NewRecorder()
+	h.FunnelResultsHandler(w, r)
+	assertAPIError(t, "negative window", w, http.StatusBadRequest, "invalid_request")
+}
+
+func TestFunnelResults_PopulationFilter(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	h := query.NewHandler(s.events, s.meta)
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-2 * time.Hour)
+	var events []storage.Event
+	visit := func(session, user string, props map[string]any, converts bool) {
+		events = append(events, storage.Event{ProjectID: project.ID, SessionID: session, DistinctID: user, EventType: "pageview",
+			URL: "https://example.com/pricing", URLPath: "/pricing", Timestamp: base, Properties: props})
+		if converts {
+			events = append(events, storage.Event{ProjectID: project.ID, SessionID: session, DistinctID: user, EventType: "pageview",
+				URL: "https://example.com/signup", URLPath: "/signup", Timestamp: base.Add(time.Minute)})
+		}
+	}
+	visit("s1", "u1", map[string]any{"plan": "pro"}, true)
+	visit("s2", "u2", map[string]any{"plan": "free"}, false)
+	visit("s3", "", map[string]any{"utm_source": "newsletter"}, true)
+	visit("s4", "", nil, false)
+	if err := s.events.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	stepsJSON := `[{"event_type": "pageview", "url_path": "/pricing"}, {"event_type": "pageview", "url_path": "/signup"}]`
+	if err := s.meta.CreateFunnel(ctx, storage.Funnel{ID: "f1", ProjectID: project.ID, Name: "Signup", Steps: stepsJSON}); err != nil {
+		t.Fatal(err)
+	}
+	seg, err := s.meta.CreateSegment(ctx, project.ID, "Pro",
+		`[{"rule_type":"property_match","config":"{\"property_key\":\"plan\",\"property_value\":\"pro\"}","points":1,"enabled":true}]`)
+	if err != nil {
+		t.Fatalf("CreateSegment: %v", err)
+	}
+
+	results := func(query string) []storage.FunnelResult {
+		t.Helper()
+		r := authedRequest("GET", "/api/v1/funnels/f1/results"+query, "", project, "")
+		r.SetPathValue("id", "f1")
+		w := httptest.NewRecorder()
+		h.FunnelResultsHandler(w, r)
+		var resp struct {
+			Results []storage.FunnelResult `json:"results"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil || len(resp.Results) != 2 {
+			t.Fatalf("results%s: %d %s", query, w.Code, w.Body.String())
+		}
+		return resp.Results
+	}
+	for _, tc := range []struct {
+		query            string
+		entered, convert int64
+	}{
+		{"", 4, 2},
+		{"?segment=" + seg.ID, 1, 1},
+		{"?utm_source=newsletter", 1, 1},
+		{"?property_key=plan&property_value=free", 1, 0},
+	} {
+		got := results(tc.query)
+		if got[0].Count != tc.entered || got[1].Count != tc.convert {
+			t.Errorf("%q: expected %d entered and %d converted, got %+v", tc.query, tc.entered, tc.convert, got)
+		}
+	}
+
+	r := authedRequest("GET", "/api/v1/funnels/f1/results?segment=missing", "", project, "")
+	r.SetPathValue("id", "f1")
+	w := httptest.NewRecorder()
+	h.FunnelResultsHandler(w, r)
+	assertAPIError(t, "unknown segment", w, http.StatusNotFound, "not_found")
+}
+
+func TestFunnelResults_Breakdown(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	h := query.NewHandler(s.events, s.meta)
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-2 * time.Hour)
+	var events []storage.Event
+	n := 0
+	visit := func(plan string, converts bool) {
+		n++
+		session := fmt.Sprintf("s%d", n)
+		var props map[string]any
+		if plan != "" {
+			props = map[string]any{"plan": plan}
+		}
+		events = append(events, storage.Event{ProjectID: project.ID, SessionID: session, EventType: "pageview",
+			URL: "https://example.com/pricing", URLPath: "/pricing", Timestamp: base, Properties: props})
+		if converts {
+			// Later values don't move a session to another breakdown row.
+			events = append(events, storage.Event{ProjectID: project.ID, SessionID: session, EventType: "pageview",
+				URL: "https://example.com/signup", URLPath: "/signup", Timestamp: base.Add(time.Minute),
+				Properties: map[string]any{"plan": "other"}})
+		}
+	}
+	for range 3 {
+		visit("pro", true)
+	}
+	visit("free", true)
+	for range 4 {
+		visit("free", false)
+	}
+	visit("", true)
+	visit("", false)
+	// Ten one-session values; only some fit under the top-values limit.
+	for i := range 10 {
+		visit(fmt.Sprintf("rare%d", i), false)
+	}
+	if err := s.events.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	stepsJSON := `[{"event_type": "pageview", "url_path": "/pricing"}, {"event_type": "pageview", "url_path": "/signup"}]`
+	if err := s.meta.CreateFunnel(ctx, storage.Funnel{ID: "f1", ProjectID: project.ID, Name: "Signup", Steps: stepsJSON}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := authedRequest("GET", "/api/v1/funnels/f1/results?breakdown=plan", "", project, "")
+	r.SetPathValue("id", "f1")
+	w := httptest.NewRecorder()
+	h.FunnelResultsHandler(w, r)
+	var resp struct {
+		Results           []storage.FunnelResult    `json:"results"`
+		Breakdown         []storage.FunnelBreakdown `json:"breakdown"`
+		BreakdownProperty string                    `json:"breakdown_property"`
+	}
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil {
+		t.Fatalf("results: %d %s", w.Code, w.Body.String())
+	}
+	if resp.BreakdownProperty != "plan" || len(resp.Results) != 2 || resp.Results[0].Count != 20 || resp.Results[1].Count != 5 {
+		t.Fatalf("expected overall results alongside the breakdown, got %+v", resp)
+	}
+	if len(resp.Breakdown) != storage.DefaultBreakdownTop {
+		t.Fatalf("expected %d breakdown values, got %d: %+v", storage.DefaultBreakdownTop, len(resp.Breakdown), resp.Breakdown)
+	}
+	free, pro := "free", "pro"
+	for i, want := range []struct {
+		value            *string
+		entered, convert int64
+	}{
+		{&free, 5, 1},
+		{&pro, 3, 3},
+		{nil, 2, 1},
+	} {
+		got := resp.Breakdown[i]
+		if (got.Value == nil) != (want.value == nil) || (got.Value != nil && *got.Value != *want.value) ||
+			len(got.Steps) != 2 || got.Steps[0].Count != want.entered || got.Steps[1].Count != want.convert {
+			t.Errorf("breakdown[%d]: expected %v with %d entered and %d converted, got %+v", i, want.value, want.entered, want.convert, got)
+		}
+	}
+	if got := resp.Breakdown[3]; got.Steps[0].Step != "Step 1: pageview" || got.Steps[0].Count != 1 || got.Steps[1].Count != 0 {
+		t.Errorf("expected a rare value with a zero-filled second step, got %+v", got)
+	}
+}
+
+func TestFunnelResults_UnorderedMode(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	h := query.NewHandler(s.events, s.meta)
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-10 * 24 * time.Hour)
+	step := func(session, path string, at time.Duration) storage.Event {
+		return storage.Event{ProjectID: project.ID, SessionID: session, EventType: "pageview",
+			URL: "https://example.com" + path, URLPath: path, Timestamp: base.Add(at)}
+	}
+	events := []storage.Event{
+		// a completes onboarding in order, b backwards, c backwards two days apart.
+		step("a", "/profile", 0), step("a", "/invite", time.Minute), step("a", "/billing", 2*time.Minute),
+		step("b", "/billing", 0), step("b", "/invite", time.Minute), step("b", "/profile", 2*time.Minute),
+		step("c", "/invite", 0), step("c", "/profile", 48*time.Hour),
+	}
+	if err := s.events.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.CreateFunnelHandler(w, authedRequest("POST", "/api/v1/funnels", body, project, ""))
+		return w
+	}
+	const steps = `"steps": [{"event_type": "pageview", "url_path": "/profile"}, {"event_type": "pageview", "url_path": "/invite"}, {"event_type": "pageview", "url_path": "/billing"}]`
+	assertAPIError(t, "unknown mode", create(`{"name": "Onboarding", "mode": "sideways", `+steps+`}`), http.StatusBadRequest, "invalid_request")
+
+	counts := func(body string) (string, []int64) {
+		t.Helper()
+		w := create(body)
+		var funnel storage.Funnel
+		if w.Code != http.StatusCreated || json.NewDecoder(w.Body).Decode(&funnel) != nil {
+			t.Fatalf("create: %d %s", w.Code, w.Body.String())
+		}
+		r := authedRequest("GET", "/api/v1/funnels/"+funnel.ID+"/results", "", project, "")
+		r.SetPathValue("id", funnel.ID)
+		w = httptest.NewRecorder()
+		h.FunnelResultsHandler(w, r)
+		var resp struct {
+			Results []storage.FunnelResult `json:"results"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil || len(resp.Results) != 3 {
+			t.Fatalf("results: %d %s", w.Code, w.Body.String())
+		}
+		var got []int64
+		for _, r := range resp.Results {
+			got = append(got, r.Count)
+		}
+		return funnel.Mode, got
+	}
+	for _, tc := range []struct {
+		body string
+		mode string
+		want []int64
+	}{
+		{`{"name": "Ordered", ` + steps + `}`, storage.FunnelOrdered, []int64{3, 1, 1}},
+		{`{"name": "Any order", "mode": "unordered", ` + steps + `}`, storage.FunnelUnordered, []int64{3, 3, 2}},
+		{`{"name": "Any order, one day", "mode": "unordered", "window_hours": 24, ` + steps + `}`, storage.FunnelUnordered, []int64{3, 2, 2}},
+	} {
+		mode, got := counts(tc.body)
+		if mode != tc.mode || fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("%s: expected mode %s with %v, got %s with %v", tc.body, tc.mode, tc.want, mode, got)
+		}
+	}
+}
+
+func TestFunnelConverters_PagesCompletedSessions(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	h := query.NewHandler(s.events, s.meta)
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-24 * time.Hour)
+	var events []storage.Event
+	visit := func(session, user string, at time.Duration, converts bool) {
+		events = append(events, storage.Event{ProjectID: project.ID, SessionID: session, EventType: "pageview",
+			URL: "https://example.com/pricing", URLPath: "/pricing", Timestamp: base.Add(at)})
+		if converts {
+			events = append(events, storage.Event{ProjectID: project.ID, SessionID: session, DistinctID: user, EventType: "pageview",
+				URL: "https://example.com/signup", URLPath: "/signup", Timestamp: base.Add(at + time.Minute)})
+		}
+	}
+	visit("s1", "u1", 0, true)
+	visit("s2", "", time.Hour, false)
+	visit("s3", "u3", 2*time.Hour, true)
+	visit("s4", "", 3*time.Hour, true)
+	if err := s.events.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	stepsJSON := `[{"event_type": "pageview", "url_path": "/pricing"}, {"event_type": "pageview", "url_path": "/signup"}]`
+	if err := s.meta.CreateFunnel(ctx, storage.Funnel{ID: "f1", ProjectID: project.ID, Name: "Signup", Steps: stepsJSON}); err != nil {
+		t.Fatal(err)
+	}
+
+	page := func(query string) ([]storage.FunnelConverter, int64) {
+		t.Helper()
+		r := authedRequest("GET", "/api/v1/funnels/f1/converters"+query, "", project, "")
+		r.SetPathValue("id", "f1")
+		w := httptest.NewRecorder()
+		h.FunnelConvertersHandler(w, r)
+		var resp struct {
+			Converters []storage.FunnelConverter `json:"converters"`
+			Total      int64                     `json:"total"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil || resp.Converters == nil {
+			t.Fatalf("converters%s: %d %s", query, w.Code, w.Body.String())
+		}
+		return resp.Converters, resp.Total
+	}
+
+	got, total := page("?limit=2")
+	if total != 3 || len(got) != 2 || got[0].SessionID != "s4" || got[0].DistinctID != "" || got[1].SessionID != "s3" || got[1].DistinctID != "u3" {
+		t.Fatalf("expected s4 then s3 of 3 converters, got %d %+v", total, got)
+	}
+	if !got[1].CompletedAt.Equal(base.Add(2*time.Hour + time.Minute).Truncate(time.Microsecond)) {
+		t.Errorf("expected s3 completed at its signup, got %v", got[1].CompletedAt)
+	}
+	if got, total = page("?limit=2&offset=2"); total != 3 || len(got) != 1 || got[0].SessionID != "s1" || got[0].DistinctID != "u1" {
+		t.Fatalf("expected s1 on the second page, got %d %+v", total, got)
+	}
+	if got, total = page("?limit=2&offset=4"); total != 3 || len(got) != 0 {
+		t.Fatalf("expected an empty page past the end, got %d %+v", total, got)
+	}
+}
+
+func TestUpdateFunnel_KeepsIDAndCreatedAt(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	h := query.NewHandler(s.events, s.meta)
+	ctx := context.Background()
+	steps := `[{"event_type": "pageview", "url_path": "/pricing"}, {"event_type": "pageview", "url_path": "/signup"}]`
+	if err := s.meta.CreateFunnel(ctx, storage.Funnel{ID: "f1", ProjectID: project.ID, Name: "Signup", Steps: steps}); err != nil {
+		t.Fatal(err)
+	}
+	before, err := s.meta.GetFunnel(ctx, project.ID, "f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	update := func(id, body string) *httptest.ResponseRecorder {
+		r := authedRequest("PUT", "/api/v1/funnels/"+id, body, project, "")
+		r.SetPathValue("id", id)
+		w := httptest.NewRecorder()
+		h.UpdateFunnelHandler(w, r)
+		return w
+	}
+	w := update("f1", `{"name": "Checkout", "window_hours": 2, "mode": "unordered", "steps": [{"event_type": "pageview", "url_path": "/cart"}, {"event_type": "pageview", "url_path": "/checkout"}, {"event_type": "pageview", "url_path": "/thanks"}]}`)
+	var got storage.Funnel
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&got) != nil {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	stored, err := s.meta.GetFunnel(ctx, project.ID, "f1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []storage.Funnel{got, *stored} {
+		var stepsGot []storage.FunnelStep
+		json.Unmarshal([]byte(f.Steps), &stepsGot)
+		if f.ID != "f1" || !f.CreatedAt.Equal(before.CreatedAt) || f.Name != "Checkout" || len(stepsGot) != 3 ||
+			f.WindowHours != 2 || f.Mode != storage.FunnelUnordered {
+			t.Errorf("expected the edited funnel under the same id and created_at, got %+v", f)
+		}
+	}
+
+	assertAPIError(t, "one step", update("f1", `{"name": "Checkout", "steps": [{"event_type": "pageview"}]}`), http.StatusBadRequest, "invalid_request")
+	assertAPIError(t, "unknown funnel", update("missing", `{"name": "Checkout", "steps": [{"event_type": "pageview"}, {"event_type": "click"}]}`), http.StatusNotFound, "not_found")
+	if f, _ := s.meta.GetFunnel(ctx, project.ID, "f1"); f.Name != "Checkout" {
+		t.Fatalf("expected a rejected update to leave the funnel alone, got %+v", f)
+	}
+}
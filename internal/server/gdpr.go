@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+)
+
+// defaultUserTokenTTL is how long a self-serve data request link stays
+// valid, and maxUserTokenTTLHours the longest ttl_hours a caller may ask for.
+const (
+	defaultUserTokenTTL  = 7 * 24 * time.Hour
+	maxUserTokenTTLHours = 30 * 24
+)
+
+// createUserTokenHandler handles POST /api/v1/gdpr/tokens. A project admin
+// mints a signed token for one distinct ID, typically emailed to the end user
+// as a link, so they can delete or export their own data.
+func (s *Server) createUserTokenHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		DistinctID string `json:"distinct_id"`
+		Purpose    string `json:"purpose"`
+		TTLHours   int    `json:"ttl_hours"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if body.DistinctID == "" {
+		apierror.Error(w, "distinct_id is required", http.StatusBadRequest)
+		return
+	}
+	if body.Purpose != auth.PurposeDelete && body.Purpose != auth.PurposeExport {
+		apierror.Error(w, "purpose must be delete or export", http.StatusBadRequest)
+		return
+	}
+	if body.TTLHours < 0 || body.TTLHours > maxUserTokenTTLHours {
+		apierror.Error(w, fmt.Sprintf("ttl_hours must be 0 (the default of a week) to %d", maxUserTokenTTLHours), http.StatusBadRequest)
+		return
+	}
+	ttl := defaultUserTokenTTL
+	if body.TTLHours > 0 {
+		ttl = time.Duration(body.TTLHours) * time.Hour
+	}
+
+	expires := time.Now().UTC().Add(ttl)
+	token, err := auth.SignUserToken(s.meta.Encryptor(), auth.UserToken{
+		ProjectID:  project.ID,
+		DistinctID: body.DistinctID,
+		Purpose:    body.Purpose,
+		ExpiresAt:  expires,
+	})
+	if err != nil {
+		apierror.Error(w, "token signing unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"token": token, "expires_at": expires})
+}
+
+// userTokenFromRequest reads a user token from ?token= (signed links) or a
+// JSON body {"token": "..."} and verifies it for purpose.
+func (s *Server) userTokenFromRequest(r *http.Request, purpose string) (*auth.UserToken, error) {
+	token := r.URL.Query().Get("token")
+	if token == "" && r.Body != nil {
+		var body struct {
+			Token string `json:"token"`
+		}
+		json.NewDecoder(http.MaxBytesReader(nil, r.Body, 4096)).Decode(&body)
+		token = body.Token
+	}
+	return auth.VerifyUserToken(s.meta.Encryptor(), token, purpose)
+}
+
+// gdprDeleteHandler handles POST /api/v1/gdpr/delete. It is authenticated by
+// a user token rather than a session and purges every event recorded for the
+// token's distinct ID, including anonymous IDs aliased to it.
+func (s *Server) gdprDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	tok, err := s.userTokenFromRequest(r, auth.PurposeDelete)
+	if err != nil {
+		apierror.Error(w, "invalid or expired token", http.StatusUnauthorized)
+		return
+	}
+
+	ids := []string{tok.DistinctID}
+	aliases, err := s.meta.ListAliases(r.Context(), tok.ProjectID, tok.DistinctID)
+	if err != nil {
+		log.Printf("ERROR gdpr delete: listing aliases: %v", err)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
+		return
+	}
+	ids = append(ids, aliases...)
+
+	deleted, err := s.events.DeleteUserEvents(r.Context(), tok.ProjectID, ids)
+	if err != nil {
+		log.Printf("ERROR gdpr delete: deleting events: %v", err)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
+		return
+	}
+	if err := s.meta.DeleteIdentityAliases(r.Context(), tok.ProjectID, tok.DistinctID); err != nil {
+		log.Printf("WARN gdpr delete: removing aliases: %v", err)
+	}
+	log.Printf("INFO gdpr delete: project %s removed %d events", tok.ProjectID, deleted)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"deleted": deleted})
+}
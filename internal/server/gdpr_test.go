@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/query"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// seedUserEvents inserts one pageview per distinct ID.
+func seedUserEvents(t *testing.T, s *Server, projectID string, distinctIDs ...string) {
+	t.Helper()
+	var events []storage.Event
+	for _, id := range distinctIDs {
+		events = append(events, storage.Event{
+			ProjectID: projectID, SessionID: "s-" + id, DistinctID: id, EventType: "pageview", Fingerprint: "fp",
+			URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC(),
+		})
+	}
+	if err := s.events.InsertEvents(context.Background(), events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+}
+
+func mintUserToken(t *testing.T, s *Server, project *storage.Project, distinctID, purpose string) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.createUserTokenHandler(w, authedRequest("POST", "/api/v1/gdpr/tokens",
+		`{"distinct_id":"`+distinctID+`","purpose":"`+purpose+`"}`, project, "admin"))
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || resp.Token == "" {
+		t.Fatalf("minting token: %d %v", w.Code, err)
+	}
+	return resp.Token
+}
+
+func TestCreateUserToken_BoundsTTL(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	mint := func(ttl string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.createUserTokenHandler(w, authedRequest("POST", "/api/v1/gdpr/tokens",
+			`{"distinct_id":"u1","purpose":"export","ttl_hours":`+ttl+`}`, project, "admin"))
+		return w
+	}
+
+	for _, ttl := range []string{"721", "-1", "9223372036854775807"} {
+		assertAPIError(t, "ttl_hours "+ttl, mint(ttl), http.StatusBadRequest, "invalid_request")
+	}
+	w := mint("720")
+	var resp struct {
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("ttl_hours 720: %d %v", w.Code, err)
+	}
+	if d := time.Until(resp.ExpiresAt); d < 719*time.Hour || d > 720*time.Hour {
+		t.Fatalf("expected the token to expire in 720h, got %v", d)
+	}
+}
+
+func TestGDPRDelete_ValidToken(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedUserEvents(t, s, project.ID, "user-1", "anon-1", "user-2")
+	if err := s.meta.SetIdentityAlias(context.Background(), project.ID, "anon-1", "user-1"); err != nil {
+		t.Fatal(err)
+	}
+
+	token := mintUserToken(t, s, project, "user-1", auth.PurposeDelete)
+	w := httptest.NewRecorder()
+	s.gdprDeleteHandler(w, httptest.NewRequest("POST", "/api/v1/gdpr/delete", strings.NewReader(`{"token":"`+token+`"}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"deleted":2`) {
+		t.Fatalf("expected user and alias events deleted, got %s", w.Body.String())
+	}
+
+	remaining, _ := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID})
+	if len(remaining) != 1 || remaining[0].DistinctID != "user-2" {
+		t.Fatalf("expected only user-2's events to remain, got %+v", remaining)
+	}
+}
+
+func TestGDPRDelete_InvalidToken(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedUserEvents(t, s, project.ID, "user-1")
+	exportToken := mintUserToken(t, s, project, "user-1", auth.PurposeExport)
+
+	for name, token := range map[string]string{
+		"garbage":       "nope",
+		"wrong purpose": exportToken,
+		"tampered":      exportToken[:len(exportToken)-2] + "xx",
+	} {
+		w := httptest.NewRecorder()
+		s.gdprDeleteHandler(w, httptest.NewRequest("POST", "/api/v1/gdpr/delete?token="+token, nil))
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+	}
+	remaining, _ := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID})
+	if len(remaining) != 1 {
+		t.Fatalf("expected events untouched, got %d", len(remaining))
+	}
+}
+
+func TestUserExport_ReturnsUsersEvents(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedUserEvents(t, s, project.ID, "user-1", "anon-1", "user-2")
+	ctx := context.Background()
+	if err := s.meta.SetIdentityAlias(ctx, project.ID, "anon-1", "user-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.meta.SetEventName(ctx, storage.EventName{ProjectID: project.ID, Fingerprint: "fp", AIName: "View Home"}); err != nil {
+		t.Fatal(err)
+	}
+
+	r := authedRequest("GET", "/api/v1/users/user-1/export", "", project, "admin")
+	r.SetPathValue("id", "user-1")
+	w := httptest.NewRecorder()
+	query.NewHandler(s.events, s.meta).UserExportHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var export struct {
+		DistinctID string          `json:"distinct_id"`
+		Events     []storage.Event `json:"events"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&export); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if export.DistinctID != "user-1" || len(export.Events) != 2 {
+		t.Fatalf("expected user-1 and alias events, got %+v", export)
+	}
+	for _, e := range export.Events {
+		if e.DistinctID == "user-2" {
+			t.Fatal("export leaked another user's events")
+		}
+		if e.EventName == nil || *e.EventName != "View Home" {
+			t.Fatalf("expected resolved event name, got %v", e.EventName)
+		}
+	}
+
+	// The self-serve variant is reachable without a session, with a token.
+	token := mintUserToken(t, s, project, "user-1", auth.PurposeExport)
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/gdpr/export?format=csv&token="+token, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("expected CSV export, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	if lines := strings.Count(strings.TrimSpace(w.Body.String()), "\n"); lines != 2 {
+		t.Fatalf("expected header plus 2 rows, got %q", w.Body.String())
+	}
+
+	deleteToken := mintUserToken(t, s, project, "user-1", auth.PurposeDelete)
+	w = httptest.NewRecorder()
+	s.mux.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/gdpr/export?token="+deleteToken, nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected delete token to be refused for export, got %d", w.Code)
+	}
+}
+
+func TestUserExport_PagesEveryEventOnce(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	// Spread more than two pages of events over a few shared timestamps so
+	// page boundaries fall inside runs of equal timestamps.
+	const total = 2500
+	now := time.Now().UTC().Truncate(time.Second)
+	events := make([]storage.Event, total)
+	for i := range events {
+		events[i] = storage.Event{
+			ProjectID: project.ID, SessionID: "s1", DistinctID: "user-1", EventType: "pageview", Fingerprint: "fp",
+			URL: "https://example.com/", URLPath: "/", Timestamp: now.Add(-time.Duration(i%7) * time.Second),
+		}
+	}
+	if err := s.events.InsertEvents(context.Background(), events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	r := authedRequest("GET", "/api/v1/users/user-1/export", "", project, "admin")
+	r.SetPathValue("id", "user-1")
+	w := httptest.NewRecorder()
+	query.NewHandler(s.events, s.meta).UserExportHandler(w, r)
+	var export struct {
+		Events []storage.Event `json:"events"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&export); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	seen := make(map[string]bool, total)
+	for _, e := range export.Events {
+		if seen[e.ID] {
+			t.Fatalf("event %s exported twice", e.ID)
+		}
+		seen[e.ID] = true
+	}
+	if len(seen) != total {
+		t.Fatalf("expected %d events, got %d", total, len(seen))
+	}
+}
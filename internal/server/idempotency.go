@@ -0,0 +1,186 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+)
+
+// idempotencyTTL is how long a create response is replayed for its key, and
+// idempotencySweep how often expired entries are dropped.
+const (
+	idempotencyTTL   = 10 * time.Minute
+	idempotencySweep = time.Minute
+)
+
+// maxIdempotencyKey bounds the Idempotency-Key header length, and
+// maxIdempotentBody the request body kept to compare replays against.
+const (
+	maxIdempotencyKey = 255
+	maxIdempotentBody = 1 << 20
+)
+
+// idempotencyCache remembers create responses by project, route and
+// Idempotency-Key so a retried or double-submitted request gets the original
+// resource back instead of making a second one.
+type idempotencyCache struct {
+	mu        sync.Mutex
+	entries   map[string]*idempotentEntry
+	nextSweep time.Time
+}
+
+type idempotentEntry struct {
+	done    chan struct{} // closed once the first request has finished
+	bodySum [sha256.Size]byte
+	expires time.Time
+	ok      bool // the first request succeeded and its response is stored
+	status  int
+	header  http.Header
+	body    []byte
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{entries: make(map[string]*idempotentEntry)}
+}
+
+// claim returns the entry for key and whether the caller created it. A new
+// entry must be finished with complete or release.
+func (c *idempotencyCache) claim(key string, bodySum [sha256.Size]byte) (*idempotentEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if e, ok := c.entries[key]; ok && (e.expires.IsZero() || now.Before(e.expires)) {
+		return e, false
+	}
+	// Sweeping costs a pass over every entry, so it runs at most once per
+	// idempotencySweep rather than on every claim.
+	if now.After(c.nextSweep) {
+		for k, e := range c.entries {
+			if !e.expires.IsZero() && now.After(e.expires) {
+				delete(c.entries, k)
+			}
+		}
+		c.nextSweep = now.Add(idempotencySweep)
+	}
+	e := &idempotentEntry{done: make(chan struct{}), bodySum: bodySum}
+	c.entries[key] = e
+	return e, true
+}
+
+// complete stores the first request's response for replay.
+func (c *idempotencyCache) complete(e *idempotentEntry, rec *responseRecorder) {
+	c.mu.Lock()
+	e.ok, e.status, e.header, e.body = true, rec.status, rec.Header().Clone(), rec.buf.Bytes()
+	e.expires = time.Now().Add(idempotencyTTL)
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// release drops the entry of a failed first request so the key can be
+// retried.
+func (c *idempotencyCache) release(key string, e *idempotentEntry) {
+	c.mu.Lock()
+	if c.entries[key] == e {
+		delete(c.entries, key)
+	}
+	c.mu.Unlock()
+	close(e.done)
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.buf.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent makes a create endpoint honour the Idempotency-Key header. The
+// first successful response for a key is replayed to later requests with the
+// same key and body for idempotencyTTL; a concurrent duplicate waits for the
+// first to finish. Reusing a key with a different body is a conflict. Keys are
+// scoped to the project and route. Requests without the header pass straight
+// through.
+func (s *Server) idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		project := auth.ProjectFromContext(r.Context())
+		if key == "" || project == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			apierror.Error(w, "Idempotency-Key is too long", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBody))
+		if err != nil {
+			apierror.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+
+		cacheKey := project.ID + "\x00" + r.Method + " " + r.URL.Path + "\x00" + key
+		for {
+			e, first := s.idempotency.claim(cacheKey, sum)
+			if first {
+				// Deferred so a panicking handler still gives the key up;
+				// otherwise the entry would block it for good.
+				completed := false
+				defer func() {
+					if !completed {
+						s.idempotency.release(cacheKey, e)
+					}
+				}()
+				rec := &responseRecorder{ResponseWriter: w}
+				next.ServeHTTP(rec, r)
+				if rec.status >= 200 && rec.status < 300 {
+					s.idempotency.complete(e, rec)
+					completed = true
+				}
+				return
+			}
+			select {
+			case <-e.done:
+			case <-r.Context().Done():
+				return
+			}
+			if !e.ok {
+				// The first attempt failed and gave the key up; run this one.
+				continue
+			}
+			if e.bodySum != sum {
+				apierror.Error(w, "Idempotency-Key was already used with a different request body", http.StatusConflict)
+				return
+			}
+			for k, v := range e.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(e.status)
+			w.Write(e.body)
+			return
+		}
+	})
+}
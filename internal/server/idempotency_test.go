@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/query"
+)
+
+func TestIdempotencyKey_SingleFunnel(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	handler := s.idempotent(http.HandlerFunc(query.NewHandler(s.events, s.meta).CreateFunnelHandler))
+	body := `{"name":"Signup","steps":[{"event_type":"pageview"},{"event_type":"custom","event_name":"Signup"}]}`
+
+	create := func(key, body string) *httptest.ResponseRecorder {
+		r := authedRequest("POST", "/api/v1/funnels", body, project, "")
+		r.Header.Set("Idempotency-Key", key)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	// A double-click: two requests with the same key racing each other.
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 2)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = create("k1", body)
+		}(i)
+	}
+	wg.Wait()
+
+	var ids []string
+	for _, w := range results {
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+		}
+		var f struct {
+			ID string `json:"id"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&f); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		ids = append(ids, f.ID)
+	}
+	if ids[0] == "" || ids[0] != ids[1] {
+		t.Fatalf("expected the same funnel twice, got %v", ids)
+	}
+	funnels, err := s.meta.ListFunnels(context.Background(), project.ID)
+	if err != nil {
+		t.Fatalf("ListFunnels: %v", err)
+	}
+	if len(funnels) != 1 {
+		t.Fatalf("expected 1 funnel, got %d", len(funnels))
+	}
+
+	if w := create("k1", `{"name":"Other","steps":[{"event_type":"pageview"},{"event_type":"click"}]}`); w.Code != http.StatusConflict {
+		t.Fatalf("reused key with a new body: expected 409, got %d", w.Code)
+	}
+	if w := create("k2", body); w.Code != http.StatusCreated {
+		t.Fatalf("new key: expected 201, got %d", w.Code)
+	}
+	if funnels, _ = s.meta.ListFunnels(context.Background(), project.ID); len(funnels) != 2 {
+		t.Fatalf("expected a second funnel for a new key, got %d", len(funnels))
+	}
+}
+
+func TestIdempotencyKey_PanicReleasesKey(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	panicking := true
+	handler := s.idempotent(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if panicking {
+			panic("boom")
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	create := func() *httptest.ResponseRecorder {
+		r := authedRequest("POST", "/api/v1/funnels", `{}`, project, "")
+		r.Header.Set("Idempotency-Key", "k1")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected the handler's panic to propagate")
+			}
+		}()
+		create()
+	}()
+
+	// The retry must run rather than wait on the abandoned first attempt.
+	panicking = false
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- create() }()
+	select {
+	case w := <-done:
+		if w.Code != http.StatusCreated {
+			t.Fatalf("expected the retry to run, got %d", w.Code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("retry blocked on the key of a request that panicked")
+	}
+}
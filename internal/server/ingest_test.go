@@ -0,0 +1,617 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/ai"
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/ingest"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// postEvents posts a batch through the real route with the project's API key.
+func postEvents(t *testing.T, s *Server, project *storage.Project, body, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/api/v1/events"+query, strings.NewReader(body))
+	r.Header.Set("X-API-Key", project.APIKey)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, r)
+	return w
+}
+
+func TestIngest_SamplingKeepsWholeSessions(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	if err := s.meta.SetGrowthSetting(ctx, project.ID, storage.SampleRateSetting, "0.5"); err != nil {
+		t.Fatal(err)
+	}
+
+	const sessions = 20
+	ts := time.Now().UnixMilli()
+	for i := 0; i < sessions; i++ {
+		// Two batches per session: sampling must agree across requests.
+		for batch := 0; batch < 2; batch++ {
+			body := fmt.Sprintf(`{"session_id":"sess-%d","events":[
+				{"event_type":"pageview","url":"https://example.com/","timestamp":%d},
+				{"event_type":"click","url":"https://example.com/","timestamp":%d},
+				{"event_type":"error","url":"https://example.com/","timestamp":%d}]}`, i, ts, ts, ts)
+			if w := postEvents(t, s, project, body, ""); w.Code >= 300 {
+				t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+			}
+		}
+	}
+
+	kept, dropped := 0, 0
+	for i := 0; i < sessions; i++ {
+		events, err := s.events.QueryEvents(ctx, storage.EventFilter{ProjectID: project.ID, SessionID: fmt.Sprintf("sess-%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch len(events) {
+		case 6:
+			kept++
+		case 2:
+			for _, e := range events {
+				if e.EventType != "error" {
+					t.Fatalf("sampled-out session kept a %s event", e.EventType)
+				}
+			}
+			dropped++
+		default:
+			t.Fatalf("session sess-%d partially sampled: %d events", i, len(events))
+		}
+	}
+	if kept == 0 || dropped == 0 {
+		t.Fatalf("expected a mix of kept and dropped sessions, got kept=%d dropped=%d", kept, dropped)
+	}
+}
+
+func TestIngest_AckIDs(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ts := time.Now().UnixMilli()
+	body := fmt.Sprintf(`{"session_id":"s1","events":[
+		{"event_type":"pageview","url":"https://example.com/","timestamp":%d,"client_event_id":"c-1"},
+		{"event_type":"click","url":"https://example.com/","timestamp":%d}]}`, ts, ts)
+
+	w := postEvents(t, s, project, body, "?ack=ids")
+	var resp struct {
+		Accepted int               `json:"accepted"`
+		IDs      []string          `json:"ids"`
+		IDMap    map[string]string `json:"id_map"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Accepted != 2 || len(resp.IDs) != 2 || resp.IDs[0] == "" || resp.IDs[0] == resp.IDs[1] {
+		t.Fatalf("expected two distinct ids, got %+v", resp)
+	}
+	if resp.IDMap["c-1"] != resp.IDs[0] || len(resp.IDMap) != 1 {
+		t.Fatalf("expected c-1 mapped to first id, got %+v", resp.IDMap)
+	}
+
+	stored, err := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byID := map[string]string{}
+	for _, e := range stored {
+		byID[e.ID] = e.EventType
+	}
+	if byID[resp.IDs[0]] != "pageview" || byID[resp.IDs[1]] != "click" {
+		t.Fatalf("returned ids don't match stored rows: %v vs %v", resp.IDs, byID)
+	}
+
+	// Without ack=ids the response shape is unchanged.
+	w = postEvents(t, s, project, body, "")
+	if strings.Contains(w.Body.String(), `"ids"`) {
+		t.Fatalf("expected no ids without ack, got %s", w.Body.String())
+	}
+}
+
+func TestIngest_BotFilterDiscardsEvents(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	if err := s.meta.SetBotFilters(ctx, project.ID, []string{"UptimeRobot", `/headless\w+/`}); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(sessionID, ua string) int {
+		body := fmt.Sprintf(`{"session_id":%q,"events":[
+			{"event_type":"pageview","url":"https://example.com/","timestamp":%d}]}`, sessionID, time.Now().UnixMilli())
+		r := httptest.NewRequest("POST", "/api/v1/events", strings.NewReader(body))
+		r.Header.Set("X-API-Key", project.APIKey)
+		r.Header.Set("User-Agent", ua)
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, r)
+		return w.Code
+	}
+	for sessionID, ua := range map[string]string{
+		"monitor": "Mozilla/5.0+(compatible; UptimeRobot/2.0)",
+		"crawler": "Mozilla/5.0 HeadlessChrome/120.0",
+		"human":   "Mozilla/5.0 (Macintosh) Safari/605.1.15",
+	} {
+		if code := post(sessionID, ua); code >= 300 {
+			t.Fatalf("expected %s batch to be acknowledged, got %d", sessionID, code)
+		}
+	}
+
+	events, err := s.events.QueryEvents(ctx, storage.EventFilter{ProjectID: project.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 || events[0].SessionID != "human" {
+		t.Fatalf("expected only the human session stored, got %+v", events)
+	}
+	if n := s.ingest.Discarded(project.ID); n != 2 {
+		t.Fatalf("expected 2 discarded events, got %d", n)
+	}
+}
+
+// recordingProvider names every element "Named" and records the element IDs
+// it was asked about.
+type recordingProvider struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+func (p *recordingProvider) GenerateEventName(ctx context.Context, req ai.NamingRequest) (*ai.NamingResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ids = append(p.ids, req.ElementID)
+	return &ai.NamingResult{Name: "Named", Confidence: 0.9}, nil
+}
+
+func (p *recordingProvider) seen() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Clone(p.ids)
+}
+
+func TestIngest_NamingEventTypes(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	provider := &recordingProvider{}
+	namer := ai.NewNamer(provider, ai.NewCache(s.meta.(*storage.SQLite)), s.events, 1)
+	defer namer.Close()
+	h := ingest.NewHandler(s.events, s.meta, namer)
+	if err := s.meta.SetNamingEventTypes(context.Background(), project.ID, []string{"click", "submit"}); err != nil {
+		t.Fatalf("SetNamingEventTypes: %v", err)
+	}
+
+	// The single worker takes jobs in order, so once the click is named the
+	// input before it would have been too had it been submitted.
+	body := fmt.Sprintf(`{"session_id":"s1","events":[
+		{"event_type":"input","element_tag":"input","element_id":"email","url":"https://example.com/","url_path":"/","timestamp":%[1]d},
+		{"event_type":"click","element_tag":"button","element_id":"buy","url":"https://example.com/","url_path":"/","timestamp":%[1]d}]}`,
+		time.Now().UnixMilli())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, authedRequest("POST", "/api/v1/events", body, project, ""))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("ingest: %d %s", w.Code, w.Body.String())
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(provider.seen()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := provider.seen(); !slices.Equal(got, []string{"buy"}) {
+		t.Fatalf("expected only the click submitted for naming, got %v", got)
+	}
+}
+
+func TestIngest_GzipBody(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	post := func(body []byte) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/api/v1/events", bytes.NewReader(body))
+		r.Header.Set("X-API-Key", project.APIKey)
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, r)
+		return w
+	}
+	compress := func(s string) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(s))
+		zw.Close()
+		return buf.Bytes()
+	}
+
+	batch := fmt.Sprintf(`{"session_id":"gz","events":[
+		{"event_type":"pageview","url":"https://example.com/","timestamp":%d}]}`, time.Now().UnixMilli())
+	if w := post(compress(batch)); w.Code != http.StatusAccepted {
+		t.Fatalf("gzipped batch: status %d: %s", w.Code, w.Body)
+	}
+	events, err := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID, SessionID: "gz"})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected the gzipped event stored, got %d (%v)", len(events), err)
+	}
+
+	corrupt := compress(batch)
+	corrupt[len(corrupt)/2] ^= 0xff
+	for name, body := range map[string][]byte{"not gzip": []byte(batch), "corrupt": corrupt} {
+		w := post(body)
+		if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid gzip") {
+			t.Errorf("%s: expected 400 invalid gzip, got %d: %s", name, w.Code, w.Body)
+		}
+	}
+
+	bomb := compress(`{"session_id":"` + strings.Repeat("a", ingest.MaxPayloadBytes+1) + `","events":[]}`)
+	if w := post(bomb); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for an oversized decompressed body, got %d", w.Code)
+	}
+}
+
+func TestIngest_ValidationErrorDetails(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	body := `{"session_id":"bad","events":[
+		{"event_type":"pageview","url":"https://example.com/"},
+		{"event_type":"performance","url":"https://example.com/","properties":{"metric":"LCP","value":"slow"}}]}`
+	w := postEvents(t, s, project, body, "")
+	assertAPIError(t, "invalid event", w, http.StatusBadRequest, "invalid_request")
+
+	var resp struct {
+		Error struct {
+			Message string `json:"message"`
+			Details struct {
+				Index  int    `json:"index"`
+				Field  string `json:"field"`
+				Reason string `json:"reason"`
+			} `json:"details"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	d := resp.Error.Details
+	if d.Index != 1 || d.Field != "properties.value" || d.Reason != ingest.ErrInvalidMetric.Error() {
+		t.Errorf("details = %+v, want event 1, field properties.value", d)
+	}
+	if resp.Error.Message != ingest.ErrInvalidMetric.Error() {
+		t.Errorf("message = %q, want the plain reason", resp.Error.Message)
+	}
+
+	// Batch-level errors have no event to point at.
+	w = postEvents(t, s, project, `{"events":[{"event_type":"click","url":"https://example.com/"}]}`, "")
+	if w.Code != http.StatusBadRequest || strings.Contains(w.Body.String(), "details") {
+		t.Errorf("missing session: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestIngest_BeaconQueryKey(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	beacon := func(query, contentType string) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"session_id":"beacon","events":[
+			{"event_type":"pageview","url":"https://example.com/","timestamp":%d}]}`, time.Now().UnixMilli())
+		r := httptest.NewRequest("POST", "/api/v1/events"+query, strings.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := beacon("?api_key="+project.APIKey, "text/plain;charset=UTF-8"); w.Code != http.StatusAccepted {
+		t.Fatalf("beacon: status %d: %s", w.Code, w.Body)
+	}
+	events, err := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID, SessionID: "beacon"})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected the beacon event stored, got %d (%v)", len(events), err)
+	}
+
+	for name, query := range map[string]string{"missing": "", "empty": "?api_key=", "invalid": "?api_key=nope"} {
+		if w := beacon(query, "text/plain;charset=UTF-8"); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s key: expected 401, got %d", name, w.Code)
+		}
+	}
+	w := beacon("?api_key="+project.APIKey, "application/x-www-form-urlencoded")
+	assertAPIError(t, "form body", w, http.StatusUnsupportedMediaType, "unsupported_media_type")
+}
+
+func TestInternalTraffic_ExcludedFromCounts(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	rule := storage.InternalTrafficRule{IPRanges: []string{"10.1.0.0/16"}, DistinctIDs: []string{"teammate"}}
+	if err := s.meta.SetInternalTraffic(ctx, project.ID, rule); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(sessionID, distinctID, pageURL, forwardedFor string, internal bool) {
+		body := fmt.Sprintf(`{"session_id":%q,"distinct_id":%q,"internal":%t,"events":[
+			{"event_type":"pageview","url":%q,"timestamp":%d}]}`, sessionID, distinctID, internal, pageURL, time.Now().UnixMilli())
+		r := httptest.NewRequest("POST", "/api/v1/events", strings.NewReader(body))
+		r.Header.Set("X-API-Key", project.APIKey)
+		if forwardedFor != "" {
+			r.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, r)
+		if w.Code >= 300 {
+			t.Fatalf("ingest %s: status %d: %s", sessionID, w.Code, w.Body)
+		}
+	}
+	post("visitor", "v1", "https://example.com/", "203.0.113.9", false)
+	post("office", "v2", "https://example.com/", "10.1.4.20, 203.0.113.1", false)
+	post("param", "v3", "https://example.com/?ch_internal=1", "", false)
+	post("sdk", "v4", "https://example.com/docs", "", true)
+	post("listed", "teammate", "https://example.com/", "", false)
+
+	// count runs the query behind the session middleware, as a dashboard would.
+	count := func() int64 {
+		t.Helper()
+		var n int64
+		var err error
+		s.excludeInternal(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, err = s.events.CountEvents(r.Context(), project.ID, "pageview", "", time.Time{})
+		})).ServeHTTP(httptest.NewRecorder(), authedRequest("GET", "/api/v1/events/stats", "", project, ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(); n != 5 {
+		t.Fatalf("expected all 5 pageviews counted before exclusion is on, got %d", n)
+	}
+
+	rule.Exclude = true
+	if err := s.meta.SetInternalTraffic(ctx, project.ID, rule); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(); n != 1 {
+		t.Fatalf("expected only the visitor's pageview counted, got %d", n)
+	}
+
+	events, err := s.events.QueryEvents(ctx, storage.EventFilter{ProjectID: project.ID, SessionID: "office"})
+	if err != nil || len(events) != 1 || events[0].Properties[storage.InternalProperty] != true {
+		t.Fatalf("expected the office pageview stored and tagged internal, got %+v (%v)", events, err)
+	}
+}
+
+func TestIngest_ClientCannotSetReservedProperties(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	rule := storage.InternalTrafficRule{Exclude: true}
+	if err := s.meta.SetInternalTraffic(ctx, project.ID, rule); err != nil {
+		t.Fatal(err)
+	}
+
+	body := fmt.Sprintf(`{"session_id":"s1","events":[{"event_type":"pageview","url":"https://example.com/","timestamp":%d,
+		"properties":{"$sample_rate":0.0001,"$internal":true,"sample_rate":0.0001,"internal":true}}]}`, time.Now().UnixMilli())
+	if w := postEvents(t, s, project, body, ""); w.Code >= 300 {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+
+	scaled := storage.WithSampleScaling(storage.WithInternalExclusion(ctx, &rule))
+	n, err := s.events.CountEvents(scaled, project.ID, "pageview", "", time.Time{})
+	if err != nil || n != 1 {
+		t.Fatalf("expected the pageview counted once, got %d (%v)", n, err)
+	}
+	events, err := s.events.QueryEvents(ctx, storage.EventFilter{ProjectID: project.ID, SessionID: "s1"})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("QueryEvents: %+v (%v)", events, err)
+	}
+	props := events[0].Properties
+	if _, ok := props[storage.SampleRateProperty]; ok {
+		t.Errorf("client-sent %s kept: %v", storage.SampleRateProperty, props)
+	}
+	if _, ok := props[storage.InternalProperty]; ok {
+		t.Errorf("client-sent %s kept: %v", storage.InternalProperty, props)
+	}
+	if props["sample_rate"] != 0.0001 || props["internal"] != true {
+		t.Errorf("unreserved client properties dropped: %v", props)
+	}
+}
+
+func TestIngest_ProjectInPathAndCustomPath(t *testing.T) {
+	s, project := newTestServer(t, Config{IngestPath: "t/collect"})
+	other, err := s.meta.CreateProject(context.Background(), "proj-2", "Other")
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	if project.PublicID == "" || project.PublicID == project.APIKey {
+		t.Fatalf("expected a separate public ID, got %q", project.PublicID)
+	}
+	body := fmt.Sprintf(`{"session_id":"s1","events":[{"event_type":"pageview","url":"https://example.com/","timestamp":%d}]}`, time.Now().UnixMilli())
+	post := func(path, apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("X-API-Key", apiKey)
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := post("/api/v1/"+project.PublicID+"/events", project.APIKey); w.Code != 202 && w.Code != 200 {
+		t.Fatalf("expected project-scoped ingest to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+	if w := post("/api/v1/pub_unknown/events", project.APIKey); w.Code != 404 {
+		t.Fatalf("expected 404 for unknown public ID, got %d", w.Code)
+	}
+	if w := post("/api/v1/"+project.PublicID+"/events", other.APIKey); w.Code != 401 {
+		t.Fatalf("expected 401 for another project's key, got %d", w.Code)
+	}
+	if w := post("/api/v1/"+project.PublicID+"/events", ""); w.Code != 401 {
+		t.Fatalf("expected 401 without an API key, got %d", w.Code)
+	}
+	if w := post("/t/collect", project.APIKey); w.Code != 202 && w.Code != 200 {
+		t.Fatalf("expected custom ingest path to succeed, got %d: %s", w.Code, w.Body.String())
+	}
+
+	events, err := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID})
+	if err != nil || len(events) != 2 {
+		t.Fatalf("expected 2 stored events, got %d (%v)", len(events), err)
+	}
+}
+
+func TestPatchEvent_MergesProperties(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	body := fmt.Sprintf(`{"session_id":"s1","events":[{"event_type":"custom","url":"https://example.com/checkout","timestamp":%d,"properties":{"plan":"pro"}}]}`, time.Now().UnixMilli())
+	var ack struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(postEvents(t, s, project, body, "?ack=ids").Body).Decode(&ack); err != nil || len(ack.IDs) != 1 {
+		t.Fatalf("expected one acked id, got %+v (%v)", ack, err)
+	}
+	patch := func(id, body, apiKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("PATCH", "/api/v1/events/"+id, strings.NewReader(body))
+		r.Header.Set("X-API-Key", apiKey)
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := patch(ack.IDs[0], `{"properties":{"revenue":49.5}}`, project.APIKey); w.Code != 204 {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	events, err := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one event, got %d (%v)", len(events), err)
+	}
+	if p := events[0].Properties; p["plan"] != "pro" || p["revenue"] != 49.5 {
+		t.Fatalf("expected merged properties, got %v", p)
+	}
+
+	if w := patch(ack.IDs[0], `{"properties":{"x":1},"event_type":"click"}`, project.APIKey); w.Code != 400 {
+		t.Fatalf("expected 400 for a structural field, got %d", w.Code)
+	}
+	if w := patch("missing", `{"properties":{"x":1}}`, project.APIKey); w.Code != 404 {
+		t.Fatalf("expected 404 for an unknown event, got %d", w.Code)
+	}
+	other, err := s.meta.CreateProject(context.Background(), "proj-2", "Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := patch(ack.IDs[0], `{"properties":{"x":1}}`, other.APIKey); w.Code != 404 {
+		t.Fatalf("expected another project's key not to reach the event, got %d", w.Code)
+	}
+}
+
+func TestPatchEvent_RejectsReservedProperties(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	body := fmt.Sprintf(`{"session_id":"s1","events":[{"event_type":"pageview","url":"https://example.com/?ch_internal=1","timestamp":%d}]}`, time.Now().UnixMilli())
+	var ack struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(postEvents(t, s, project, body, "?ack=ids").Body).Decode(&ack); err != nil || len(ack.IDs) != 1 {
+		t.Fatalf("expected one acked id, got %+v (%v)", ack, err)
+	}
+
+	for _, patch := range []string{
+		`{"properties":{"$internal":null}}`,
+		`{"properties":{"$internal":false,"plan":"pro"}}`,
+		`{"properties":{"$sample_rate":0.0001}}`,
+	} {
+		r := httptest.NewRequest("PATCH", "/api/v1/events/"+ack.IDs[0], strings.NewReader(patch))
+		r.Header.Set("X-API-Key", project.APIKey)
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, r)
+		assertAPIError(t, patch, w, http.StatusBadRequest, "invalid_request")
+	}
+
+	events, err := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID})
+	if err != nil || len(events) != 1 {
+		t.Fatalf("expected one event, got %d (%v)", len(events), err)
+	}
+	if p := events[0].Properties; p[storage.InternalProperty] != true || p["plan"] != nil || p[storage.SampleRateProperty] != nil {
+		t.Fatalf("expected properties untouched, got %v", p)
+	}
+}
+
+func TestIngest_RateLimitedPerProject(t *testing.T) {
+	s, project := newTestServer(t, Config{RatePerSecond: 0.1, RateBurst: 1})
+	body := fmt.Sprintf(`{"session_id":"flood","events":[
+		{"event_type":"pageview","url":"https://example.com/","timestamp":%d}]}`, time.Now().UnixMilli())
+
+	if w := postEvents(t, s, project, body, ""); w.Code != http.StatusAccepted {
+		t.Fatalf("first batch: status %d: %s", w.Code, w.Body)
+	}
+	w := postEvents(t, s, project, body, "")
+	assertAPIError(t, "over limit", w, http.StatusTooManyRequests, "rate_limited")
+	if got := w.Header().Get("Retry-After"); got != "10" {
+		t.Fatalf("expected Retry-After 10 at 0.1/s, got %q", got)
+	}
+}
+
+func TestIngest_MonthlyEventQuota(t *testing.T) {
+	s, project := newTestServer(t, Config{RatePerSecond: 1000, RateBurst: 1000})
+	adminID, _ := seedInstanceUsers(t, s, project)
+	ctx := context.Background()
+	setQuota := func(quota int) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.putQuotaHandler(w, authedRequest("PUT", "/api/v1/admin/quota", fmt.Sprintf(`{"monthly_event_quota":%d}`, quota), project, adminID))
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("set quota %d: %d %s", quota, w.Code, w.Body)
+		}
+	}
+	batch := func(n int) string {
+		events := make([]string, n)
+		for i := range events {
+			events[i] = fmt.Sprintf(`{"event_type":"pageview","url":"https://example.com/","timestamp":%d}`, time.Now().UnixMilli())
+		}
+		return `{"session_id":"quota","events":[` + strings.Join(events, ",") + `]}`
+	}
+
+	// Unlimited by default: no quota headers are sent and usage isn't
+	// tracked in the metadata store.
+	w := postEvents(t, s, project, batch(2), "")
+	if w.Code != http.StatusAccepted || w.Header().Get(ingest.QuotaRemainingHeader) != "" {
+		t.Fatalf("unlimited: %d, remaining %q", w.Code, w.Header().Get(ingest.QuotaRemainingHeader))
+	}
+	if used, err := s.meta.MonthlyEventUsage(ctx, project.ID, time.Now()); err != nil || used != 0 {
+		t.Fatalf("unlimited usage tracked: %d (%v)", used, err)
+	}
+
+	// Setting a quota counts the events already stored this month.
+	setQuota(5)
+	w = postEvents(t, s, project, batch(2), "")
+	if w.Code != http.StatusAccepted || w.Header().Get(ingest.QuotaRemainingHeader) != "1" || w.Header().Get(ingest.QuotaLimitHeader) != "5" {
+		t.Fatalf("under quota: %d, limit %q remaining %q", w.Code,
+			w.Header().Get(ingest.QuotaLimitHeader), w.Header().Get(ingest.QuotaRemainingHeader))
+	}
+	// A batch started under the quota is taken whole.
+	if w = postEvents(t, s, project, batch(3), ""); w.Code != http.StatusAccepted || w.Header().Get(ingest.QuotaRemainingHeader) != "0" {
+		t.Fatalf("crossing batch: %d, remaining %q", w.Code, w.Header().Get(ingest.QuotaRemainingHeader))
+	}
+	w = postEvents(t, s, project, batch(1), "")
+	assertAPIError(t, "over quota", w, http.StatusTooManyRequests, apierror.CodeQuotaExceeded)
+	if w.Header().Get("Retry-After") == "" || w.Header().Get(ingest.QuotaRemainingHeader) != "0" {
+		t.Errorf("over quota: Retry-After %q, remaining %q", w.Header().Get("Retry-After"), w.Header().Get(ingest.QuotaRemainingHeader))
+	}
+	if used, err := s.meta.MonthlyEventUsage(ctx, project.ID, time.Now()); err != nil || used != 7 {
+		t.Errorf("usage = %d (%v), want 7 stored events", used, err)
+	}
+
+	// Other projects have their own counters.
+	other, err := s.meta.CreateProject(ctx, "proj-2", "Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := postEvents(t, s, other, batch(1), ""); w.Code != http.StatusAccepted {
+		t.Errorf("other project: %d %s", w.Code, w.Body)
+	}
+
+	// Removing the quota makes ingest unlimited again.
+	setQuota(0)
+	if w := postEvents(t, s, project, batch(1), ""); w.Code != http.StatusAccepted {
+		t.Errorf("quota removed: %d %s", w.Code, w.Body)
+	}
+	// Untracked usage is still reported, from the stored events.
+	w = httptest.NewRecorder()
+	s.getQuotaHandler(w, authedRequest("GET", "/api/v1/admin/quota", "", project, adminID))
+	var status quotaStatus
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil || status.Used != 8 || status.Remaining != nil {
+		t.Errorf("unlimited status: %+v (%v), want 8 used", status, err)
+	}
+}
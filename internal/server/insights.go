@@ -0,0 +1,182 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/ai"
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// insightsTTL is how long a project's generated insights are served from
+// cache; each generation costs an LLM call.
+const insightsTTL = time.Hour
+
+// maxInsightFunnels bounds the funnels summarized into the snapshot.
+const maxInsightFunnels = 5
+
+// insightsCache holds the last generated insights per project.
+type insightsCache struct {
+	mu      sync.Mutex
+	entries map[string]insightsEntry
+}
+
+type insightsEntry struct {
+	insights    []ai.Insight
+	generatedAt time.Time
+}
+
+func newInsightsCache() *insightsCache {
+	return &insightsCache{entries: make(map[string]insightsEntry)}
+}
+
+// get returns the project's cached insights if they are younger than
+// insightsTTL.
+func (c *insightsCache) get(projectID string) (insightsEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[projectID]
+	if !ok || time.Since(e.generatedAt) >= insightsTTL {
+		return insightsEntry{}, false
+	}
+	return e, true
+}
+
+func (c *insightsCache) set(projectID string, e insightsEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[projectID] = e
+}
+
+// aiInsightsHandler handles POST /api/v1/ai/insights: the LLM reviews a
+// snapshot of the project's recent analytics and returns notable findings
+// (spikes, drops, leaky funnels) as structured JSON. Results are cached for
+// insightsTTL; ?refresh=true regenerates them.
+func (s *Server) aiInsightsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	if r.URL.Query().Get("refresh") != "true" {
+		if e, ok := s.insights.get(project.ID); ok {
+			writeInsights(w, e, true)
+			return
+		}
+	}
+
+	cfg, err := s.meta.GetLLMConfig(r.Context(), project.ID)
+	if err != nil || cfg.Provider == "" {
+		llmNotConfigured(w)
+		return
+	}
+	// Generation shares the chat budget: both cost an LLM call.
+	limitKey := auth.UserIDFromContext(r.Context())
+	if limitKey == "" {
+		limitKey = "project:" + project.ID
+	}
+	if !s.chatLimiter.Allow(limitKey) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(60/s.config.ChatRatePerMinute))))
+		apierror.Error(w, "chat rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	snapshot := s.insightsSnapshot(r.Context(), project.ID, project.Description, time.Now().UTC())
+	insights, err := ai.GenerateInsights(r.Context(), cfg, snapshot)
+	if err != nil {
+		log.Printf("ERROR generating insights: %v", err)
+		apierror.Error(w, "AI request failed", http.StatusInternalServerError)
+		return
+	}
+
+	e := insightsEntry{insights: insights, generatedAt: time.Now().UTC()}
+	s.insights.set(project.ID, e)
+	writeInsights(w, e, false)
+}
+
+func writeInsights(w http.ResponseWriter, e insightsEntry, cached bool) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"insights":     e.insights,
+		"generated_at": e.generatedAt,
+		"cached":       cached,
+	})
+}
+
+// insightsSnapshot summarizes the project's recent analytics for the LLM:
+// daily volume, the primary event, top pages and events, and step counts of
+// its first funnels.
+func (s *Server) insightsSnapshot(ctx context.Context, projectID, description string, now time.Time) string {
+	weekAgo := now.Add(-7 * 24 * time.Hour)
+	monthAgo := now.Add(-30 * 24 * time.Hour)
+
+	var b strings.Builder
+	if description != "" {
+		fmt.Fprintf(&b, "ABOUT THIS PRODUCT:\n%s\n\n", description)
+	}
+
+	if primary, _ := s.primaryEventSummary(ctx, projectID, now); primary != nil {
+		fmt.Fprintf(&b, "PRIMARY EVENT: %q — %d in the last 7 days, %d in the 7 before\n\n",
+			primary.EventName, primary.Total, primary.PreviousTotal)
+	}
+
+	if trends, _ := s.events.QueryTrends(ctx, projectID, "day", "", "", weekAgo, now); len(trends) > 0 {
+		b.WriteString("DAILY EVENT VOLUME (last 7 days):")
+		for _, p := range trends {
+			fmt.Fprintf(&b, " %s=%d", strings.SplitN(p.Bucket, " ", 2)[0], p.Count)
+		}
+		b.WriteString("\n\n")
+	}
+
+	if pages, _ := s.events.QueryTopPages(ctx, projectID, weekAgo, now, 10, nil); len(pages) > 0 {
+		b.WriteString("TOP PAGES (last 7 days):\n")
+		for i, p := range pages {
+			fmt.Fprintf(&b, "%d. %s — %d views, %d sessions\n", i+1, p.Path, p.Views, p.Sessions)
+		}
+		b.WriteString("\n")
+	}
+
+	if events, _ := s.events.QueryTopEventNames(ctx, projectID, monthAgo, now, 10); len(events) > 0 {
+		b.WriteString("TOP NAMED EVENTS (last 30 days):\n")
+		for i, e := range events {
+			fmt.Fprintf(&b, "%d. %s — %d occurrences\n", i+1, e.Name, e.Count)
+		}
+		b.WriteString("\n")
+	}
+
+	funnels, _ := s.meta.ListFunnels(ctx, projectID)
+	for i, f := range funnels {
+		if i == maxInsightFunnels {
+			break
+		}
+		var steps []storage.FunnelStep
+		if json.Unmarshal([]byte(f.Steps), &steps) != nil {
+			continue
+		}
+		results, err := s.events.QueryFunnel(ctx, projectID, steps, monthAgo, now, time.Duration(f.WindowHours)*time.Hour, f.Mode, storage.FunnelPopulation{})
+		if err != nil || len(results) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "FUNNEL %q (last 30 days):", f.Name)
+		for _, step := range results {
+			fmt.Fprintf(&b, " %s=%d", step.Step, step.Count)
+		}
+		b.WriteString("\n")
+	}
+
+	if b.Len() == 0 {
+		b.WriteString("No analytics data has been recorded yet.")
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/ai"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestAIInsights_ParsesAndCachesFindings(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	if err := s.events.InsertEvents(ctx, []storage.Event{{ProjectID: project.ID, SessionID: "s1",
+		EventType: "pageview", URL: "https://example.com/pricing", URLPath: "/pricing", Timestamp: time.Now().UTC()}}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	// A fake OpenAI-compatible provider answering with fenced JSON: one valid
+	// finding, one with an unknown kind and severity, and one without a title.
+	var calls atomic.Int32
+	var prompt string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		prompt = req.Messages[len(req.Messages)-1].Content
+		content := "```json\n" + `{"insights": [
+			{"kind": "spike", "severity": "warning", "title": "Pricing views doubled", "detail": "1 view today", "metric": "/pricing"},
+			{"kind": "anomaly", "severity": "urgent", "title": "Odd traffic"},
+			{"kind": "drop", "severity": "info", "title": "  "}
+		]}` + "\n```"
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []map[string]any{{"message": map[string]string{"content": content}}},
+		})
+	}))
+	defer provider.Close()
+	key, baseURL := "sk-test", provider.URL
+	if err := s.meta.SetLLMConfig(ctx, storage.LLMConfig{
+		ProjectID: project.ID, Provider: "openai", APIKey: &key, BaseURL: &baseURL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	fetch := func(target string) (insights []ai.Insight, cached bool) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.aiInsightsHandler(w, authedRequest("POST", target, "", project, "u1"))
+		var resp struct {
+			Insights []ai.Insight `json:"insights"`
+			Cached   bool         `json:"cached"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil {
+			t.Fatalf("status %d: %s", w.Code, w.Body.String())
+		}
+		return resp.Insights, resp.Cached
+	}
+
+	insights, cached := fetch("/api/v1/ai/insights")
+	if cached || len(insights) != 2 {
+		t.Fatalf("expected 2 fresh insights, got %d (cached %v): %+v", len(insights), cached, insights)
+	}
+	if got := insights[0]; got.Kind != "spike" || got.Severity != "warning" || got.Title != "Pricing views doubled" || got.Metric != "/pricing" {
+		t.Fatalf("unexpected first insight %+v", got)
+	}
+	if got := insights[1]; got.Kind != "other" || got.Severity != "info" {
+		t.Fatalf("expected unknown kind and severity normalized, got %+v", got)
+	}
+	if !strings.Contains(prompt, "/pricing") {
+		t.Fatalf("expected the snapshot to include top pages, got %q", prompt)
+	}
+
+	if _, cached := fetch("/api/v1/ai/insights"); !cached || calls.Load() != 1 {
+		t.Fatalf("expected a cached repeat, got cached=%v after %d calls", cached, calls.Load())
+	}
+	if _, cached := fetch("/api/v1/ai/insights?refresh=true"); cached || calls.Load() != 2 {
+		t.Fatalf("expected refresh to regenerate, got cached=%v after %d calls", cached, calls.Load())
+	}
+}
@@ -0,0 +1,471 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// liveBroker fans out "project data changed" signals to open live streams.
+// Notifications are debounced per project: the first ingest after a quiet
+// period starts a timer, later ingests inside the window are folded into it,
+// and subscribers are signalled once when it fires. This bounds aggregate
+// recomputation to one per window per stream no matter the ingest rate.
+type liveBroker struct {
+	debounce time.Duration
+
+	mu      sync.Mutex
+	subs    map[string]map[chan struct{}]struct{} // projectID → subscriber channels
+	pending map[string]*time.Timer
+}
+
+func newLiveBroker(debounce time.Duration) *liveBroker {
+	return &liveBroker{
+		debounce: debounce,
+		subs:     make(map[string]map[chan struct{}]struct{}),
+		pending:  make(map[string]*time.Timer),
+	}
+}
+
+// subscribe registers interest in a project's changes. The returned channel
+// has a buffer of one so a slow reader sees at most one queued signal; the
+// cancel func must be called when the stream ends.
+func (b *liveBroker) subscribe(projectID string) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	b.mu.Lock()
+	if b.subs[projectID] == nil {
+		b.subs[projectID] = make(map[chan struct{}]struct{})
+	}
+	b.subs[projectID][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subs[projectID], ch)
+		if len(b.subs[projectID]) == 0 {
+			delete(b.subs, projectID)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// notify records that projectID received new events.
+func (b *liveBroker) notify(projectID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.subs[projectID]) == 0 {
+		return
+	}
+	if _, ok := b.pending[projectID]; ok {
+		return
+	}
+	b.pending[projectID] = time.AfterFunc(b.debounce, func() { b.fire(projectID) })
+}
+
+func (b *liveBroker) fire(projectID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.pending, projectID)
+	for ch := range b.subs[projectID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// liveWidget is an aggregate a live client asked to have pushed, parsed from
+// the ?widgets= query parameter: "funnel:<id>" or "retention[:<interval>]".
+type liveWidget struct {
+	Kind string
+	Arg  string
+}
+
+func (w liveWidget) String() string {
+	if w.Arg == "" {
+		return w.Kind
+	}
+	return w.Kind + ":" + w.Arg
+}
+
+// maxLiveWidgets caps the widgets one live stream may subscribe to; each is
+// recomputed on every debounced change.
+const maxLiveWidgets = 20
+
+// parseLiveWidgets parses a comma-separated widget list, ignoring unknown
+// kinds and repeats. More than maxLiveWidgets distinct widgets is an error.
+func parseLiveWidgets(v string) ([]liveWidget, error) {
+	var out []liveWidget
+	seen := map[liveWidget]bool{}
+	for _, part := range strings.Split(v, ",") {
+		kind, arg, _ := strings.Cut(strings.TrimSpace(part), ":")
+		wg := liveWidget{Kind: kind, Arg: arg}
+		switch kind {
+		case "funnel":
+			if arg == "" {
+				continue
+			}
+		case "retention":
+		default:
+			continue
+		}
+		if seen[wg] {
+			continue
+		}
+		if len(out) == maxLiveWidgets {
+			return nil, fmt.Errorf("at most %d widgets per stream", maxLiveWidgets)
+		}
+		seen[wg] = true
+		out = append(out, wg)
+	}
+	return out, nil
+}
+
+// computeLiveWidget recomputes a widget's aggregate over the same default
+// window its REST endpoint uses.
+func (s *Server) computeLiveWidget(ctx context.Context, projectID string, wg liveWidget) (any, error) {
+	end := time.Now().UTC()
+	switch wg.Kind {
+	case "funnel":
+		funnel, err := s.meta.GetFunnel(ctx, projectID, wg.Arg)
+		if err != nil {
+			return nil, fmt.Errorf("funnel not found")
+		}
+		var steps []storage.FunnelStep
+		if err := json.Unmarshal([]byte(funnel.Steps), &steps); err != nil {
+			return nil, fmt.Errorf("invalid funnel steps")
+		}
+		return s.events.QueryFunnel(ctx, projectID, steps, end.Add(-30*24*time.Hour), end, time.Duration(funnel.WindowHours)*time.Hour, funnel.Mode, storage.FunnelPopulation{})
+	case "retention":
+		interval := wg.Arg
+		if interval == "" {
+			interval = "week"
+		}
+		return s.events.QueryRetention(ctx, projectID, interval, 8, end.Add(-90*24*time.Hour), end)
+	}
+	return nil, fmt.Errorf("unknown widget %q", wg.Kind)
+}
+
+// liveSink is a live stream transport: SSE or WebSocket.
+type liveSink interface {
+	events(id string, data []byte) error // a JSON array of events, newest first
+	dropped(n int64) error
+	aggregate(data []byte) error
+	heartbeat() error
+	flush() error
+}
+
+// liveResumePoint is where a live stream starts. Each events message carries
+// an id of its newest event's timestamp, so a reconnecting EventSource
+// (Last-Event-ID header) or a client that reconnects manually
+// (?last_event_id=) resumes right after it.
+func liveResumePoint(r *http.Request) time.Time {
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+	if t, ok := parseLiveEventID(lastID); ok {
+		return t.Add(time.Microsecond)
+	}
+	return time.Now().UTC()
+}
+
+// liveFilter narrows a live stream to the events matching its event_type,
+// event_name and url_path parameters.
+func liveFilter(r *http.Request, projectID string) storage.EventFilter {
+	q := r.URL.Query()
+	return storage.EventFilter{
+		ProjectID: projectID,
+		EventType: q.Get("event_type"),
+		EventName: q.Get("event_name"),
+		URLPath:   q.Get("url_path"),
+	}
+}
+
+// streamLive polls the new events matching filter every LiveInterval and
+// writes them to out until ctx ends or a write fails. Clients may ask for
+// aggregates to be pushed whenever new data arrives, e.g.
+// widgets=funnel:abc,retention:day; those aren't narrowed by the filter.
+// Recomputes share the project's query slots with the REST endpoints; when
+// none is free, the recompute is retried on the next poll.
+func (s *Server) streamLive(ctx context.Context, filter storage.EventFilter, lastCheck time.Time, widgets []liveWidget, out liveSink) {
+	projectID := filter.ProjectID
+
+	ticker := time.NewTicker(s.config.LiveInterval)
+	defer ticker.Stop()
+
+	heartbeat := time.NewTicker(s.config.LiveHeartbeat)
+	defer heartbeat.Stop()
+
+	var recompute <-chan struct{}
+	if len(widgets) > 0 {
+		ch, cancel := s.live.subscribe(projectID)
+		defer cancel()
+		recompute = ch
+	}
+	stale := false
+	// pushWidgets recomputes and writes every widget if a query slot is
+	// free, leaving stale set otherwise. It returns false if a write failed.
+	pushWidgets := func() bool {
+		release, ok := s.tryQuerySlot(projectID)
+		if !ok {
+			return true
+		}
+		defer release()
+		stale = false
+		for _, wg := range widgets {
+			msg := map[string]any{"widget": wg.String()}
+			if result, err := s.computeLiveWidget(ctx, projectID, wg); err != nil {
+				msg["error"] = err.Error()
+			} else {
+				msg["results"] = result
+			}
+			data, err := json.Marshal(msg)
+			if err != nil {
+				return false
+			}
+			if err := out.aggregate(data); err != nil {
+				return false
+			}
+		}
+		return out.flush() == nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-recompute:
+			stale = true
+			if !pushWidgets() {
+				return
+			}
+		case <-heartbeat.C:
+			// Keeps the connection alive and detects dead clients.
+			if err := out.heartbeat(); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if stale && !pushWidgets() {
+				return
+			}
+			now := time.Now().UTC()
+			events, dropped, err := s.liveBatch(ctx, filter, lastCheck)
+			if err != nil {
+				continue
+			}
+			// Clock skew can put event timestamps ahead of ours; never move
+			// lastCheck backwards or those events would be resent.
+			if now.After(lastCheck) {
+				lastCheck = now
+			}
+			if len(events) > 0 && !events[0].Timestamp.Before(lastCheck) {
+				lastCheck = events[0].Timestamp.Add(time.Microsecond)
+			}
+
+			if dropped > 0 {
+				if err := out.dropped(dropped); err != nil {
+					return
+				}
+			}
+			if len(events) > 0 {
+				s.resolveEventNames(ctx, projectID, events)
+				data, err := json.Marshal(events)
+				if err != nil {
+					return
+				}
+				if err := out.events(liveEventID(events[0].Timestamp), data); err != nil {
+					return
+				}
+			}
+			if dropped > 0 || len(events) > 0 {
+				if err := out.flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+// sseSink writes a live stream as Server-Sent Events.
+type sseSink struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+}
+
+func (o sseSink) events(id string, data []byte) error {
+	_, err := fmt.Fprintf(o.w, "id: %s\ndata: %s\n\n", id, data)
+	return err
+}
+
+func (o sseSink) dropped(n int64) error {
+	_, err := fmt.Fprintf(o.w, "event: dropped\ndata: {\"dropped\":%d}\n\n", n)
+	return err
+}
+
+func (o sseSink) aggregate(data []byte) error {
+	_, err := fmt.Fprintf(o.w, "event: aggregate\ndata: %s\n\n", data)
+	return err
+}
+
+// heartbeat sends an SSE comment.
+func (o sseSink) heartbeat() error {
+	if _, err := fmt.Fprint(o.w, ":heartbeat\n\n"); err != nil {
+		return err
+	}
+	return o.flush()
+}
+
+func (o sseSink) flush() error {
+	o.flusher.Flush()
+	return nil
+}
+
+// liveEventsWSHandler handles GET /api/v1/events/ws: the live feed over a
+// WebSocket, for proxies that buffer SSE. Each text message is
+// {"type": "events"|"dropped"|"aggregate", "id", "data"} carrying what the
+// SSE stream sends as the same-named event; pings replace the heartbeat
+// comment. It takes the same filter, last_event_id and widgets parameters.
+func (s *Server) liveEventsWSHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.websocketOriginAllowed(r) {
+		apierror.Error(w, "cross-origin request not allowed", http.StatusForbidden)
+		return
+	}
+	widgets, err := parseLiveWidgets(r.URL.Query().Get("widgets"))
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+
+	// A hijacked connection's request context doesn't end when the client
+	// goes away, so the reader cancels the stream instead.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	clientClosed := make(chan uint16, 1)
+	go func() {
+		clientClosed <- ws.readLoop()
+		cancel()
+	}()
+
+	s.streamLive(ctx, liveFilter(r, project.ID), liveResumePoint(r), widgets, wsSink{ws})
+
+	code := uint16(wsCloseNormal)
+	select {
+	case code = <-clientClosed:
+	default:
+	}
+	ws.close(code)
+}
+
+// wsSink writes a live stream as WebSocket messages.
+type wsSink struct {
+	ws *wsConn
+}
+
+// wsMessage is one live feed WebSocket message.
+type wsMessage struct {
+	Type string          `json:"type"`
+	ID   string          `json:"id,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+func (o wsSink) send(m wsMessage) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return o.ws.writeText(data)
+}
+
+func (o wsSink) events(id string, data []byte) error {
+	return o.send(wsMessage{Type: "events", ID: id, Data: data})
+}
+
+func (o wsSink) dropped(n int64) error {
+	return o.send(wsMessage{Type: "dropped", Data: fmt.Appendf(nil, `{"dropped":%d}`, n)})
+}
+
+func (o wsSink) aggregate(data []byte) error {
+	return o.send(wsMessage{Type: "aggregate", Data: data})
+}
+
+func (o wsSink) heartbeat() error { return o.ws.ping() }
+
+func (o wsSink) flush() error { return nil }
+
+// liveBatch returns the newest events matching filter since the given time,
+// capped at LiveMaxBatch, along with how many older matching events in the
+// window were dropped to stay under the cap.
+func (s *Server) liveBatch(ctx context.Context, filter storage.EventFilter, since time.Time) ([]storage.Event, int64, error) {
+	filter.StartTime = since
+	filter.Limit = s.config.LiveMaxBatch
+	events, err := s.events.QueryEvents(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(events) < s.config.LiveMaxBatch {
+		return events, 0, nil
+	}
+	total, err := s.events.CountMatchingEvents(ctx, filter)
+	if err != nil {
+		return events, 0, nil
+	}
+	return events, max(0, total-int64(len(events))), nil
+}
+
+// resolveEventNames replaces each event's stored name with the current
+// display name from the naming cache, as the events list does.
+func (s *Server) resolveEventNames(ctx context.Context, projectID string, events []storage.Event) {
+	fps := make([]string, 0, len(events))
+	seen := make(map[string]bool, len(events))
+	for _, e := range events {
+		if !seen[e.Fingerprint] {
+			fps = append(fps, e.Fingerprint)
+			seen[e.Fingerprint] = true
+		}
+	}
+	names, _ := s.meta.BatchGetEventNames(ctx, projectID, fps)
+	for i := range events {
+		if en, ok := names[events[i].Fingerprint]; ok {
+			if name := en.DisplayName(); name != "" {
+				events[i].EventName = &name
+			}
+		}
+	}
+}
+
+// liveEventID encodes an event timestamp as an SSE event id (Unix
+// microseconds, the precision DuckDB stores).
+func liveEventID(t time.Time) string {
+	return strconv.FormatInt(t.UnixMicro(), 10)
+}
+
+// parseLiveEventID decodes an id produced by liveEventID.
+func parseLiveEventID(id string) (time.Time, bool) {
+	if id == "" {
+		return time.Time{}, false
+	}
+	us, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || us <= 0 {
+		return time.Time{}, false
+	}
+	return time.UnixMicro(us).UTC(), true
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestLiveBroker_DebouncesNotifications(t *testing.T) {
+	b := newLiveBroker(30 * time.Millisecond)
+	ch, cancel := b.subscribe("p1")
+	defer cancel()
+
+	for i := 0; i < 10; i++ {
+		b.notify("p1")
+	}
+	b.notify("other") // no subscribers, ignored
+
+	select {
+	case <-ch:
+	case <-time.After(time.Second):
+		t.Fatal("expected a recompute signal")
+	}
+	select {
+	case <-ch:
+		t.Fatal("expected burst to collapse into a single signal")
+	case <-time.After(80 * time.Millisecond):
+	}
+}
+
+func TestLive_IngestTriggersRecompute(t *testing.T) {
+	s, project := newTestServer(t, Config{LiveRecomputeInterval: 20 * time.Millisecond})
+	ch, cancel := s.live.subscribe(project.ID)
+	defer cancel()
+
+	body := fmt.Sprintf(`{"session_id":"s1","events":[{"event_type":"pageview","url":"https://example.com/","timestamp":%d}]}`, time.Now().UnixMilli())
+	r := httptest.NewRequest("POST", "/api/v1/events", strings.NewReader(body))
+	r.Header.Set("X-API-Key", project.APIKey)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, r)
+	if w.Code >= 300 {
+		t.Fatalf("ingest failed: %d %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected ingest to trigger a debounced recompute")
+	}
+
+	res, err := s.computeLiveWidget(r.Context(), project.ID, liveWidget{Kind: "retention", Arg: "day"})
+	if err != nil || res == nil {
+		t.Fatalf("computeLiveWidget: %v %v", res, err)
+	}
+}
+
+func TestParseLiveWidgets(t *testing.T) {
+	got, err := parseLiveWidgets("funnel:abc, retention:day,bogus,funnel:,funnel:abc")
+	if err != nil || len(got) != 2 || got[0].String() != "funnel:abc" || got[1].String() != "retention:day" {
+		t.Fatalf("unexpected widgets %+v (%v)", got, err)
+	}
+
+	many := make([]string, maxLiveWidgets+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("funnel:f%d", i)
+	}
+	if _, err := parseLiveWidgets(strings.Join(many, ",")); err == nil {
+		t.Fatalf("expected more than %d widgets to be rejected", maxLiveWidgets)
+	}
+	if got, err := parseLiveWidgets(strings.Join(many[:maxLiveWidgets], ",")); err != nil || len(got) != maxLiveWidgets {
+		t.Fatalf("expected %d widgets accepted, got %d (%v)", maxLiveWidgets, len(got), err)
+	}
+}
+
+func TestLive_WidgetRecomputesShareQuerySlots(t *testing.T) {
+	s, project := newTestServer(t, Config{LiveInterval: 20 * time.Millisecond, MaxConcurrentQueries: 1})
+
+	// stream runs a retention widget stream for 200ms while another query
+	// holds the project's only slot, signalling a change once the stream
+	// has subscribed. The slot is freed after hold, or when the stream ends.
+	stream := func(hold time.Duration) string {
+		release, ok := s.tryQuerySlot(project.ID)
+		if !ok {
+			t.Fatal("expected a free query slot")
+		}
+		done, freed := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(freed)
+			time.Sleep(30 * time.Millisecond)
+			s.live.fire(project.ID)
+			select {
+			case <-time.After(hold):
+			case <-done:
+			}
+			release()
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		w := httptest.NewRecorder()
+		s.liveEventsHandler(w, authedRequest("GET", "/api/v1/events/live?widgets=retention:day", "", project, "").WithContext(
+			auth.WithProject(ctx, project)))
+		close(done)
+		<-freed
+		return w.Body.String()
+	}
+
+	if out := stream(time.Hour); strings.Contains(out, "event: aggregate") {
+		t.Fatalf("expected no recompute while the project's query slot is taken, got %q", out)
+	}
+	if out := stream(50 * time.Millisecond); strings.Count(out, "event: aggregate") != 1 {
+		t.Fatalf("expected the recompute once the slot was free, got %q", out)
+	}
+
+	many := make([]string, maxLiveWidgets+1)
+	for i := range many {
+		many[i] = fmt.Sprintf("funnel:f%d", i)
+	}
+	w := httptest.NewRecorder()
+	s.liveEventsHandler(w, authedRequest("GET", "/api/v1/events/live?widgets="+strings.Join(many, ","), "", project, ""))
+	assertAPIError(t, "too many widgets", w, http.StatusBadRequest, "invalid_request")
+}
+
+func TestLive_BurstIsCoalescedIntoBoundedMessages(t *testing.T) {
+	s, project := newTestServer(t, Config{LiveInterval: 20 * time.Millisecond, LiveMaxBatch: 10})
+
+	// Timestamps slightly in the future so they fall after the stream's start.
+	base := time.Now().UTC().Add(time.Second).Truncate(time.Microsecond)
+	var burst []storage.Event
+	for i := 0; i < 35; i++ {
+		burst = append(burst, storage.Event{
+			ProjectID: project.ID, SessionID: "s1", EventType: "click", Fingerprint: "fp",
+			URL: "https://example.com/", URLPath: "/", Timestamp: base.Add(time.Duration(i) * time.Microsecond),
+		})
+	}
+	if err := s.events.InsertEvents(context.Background(), burst); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	s.liveEventsHandler(w, authedRequest("GET", "/api/v1/events/live", "", project, "").WithContext(
+		auth.WithProject(ctx, project)))
+
+	out := w.Body.String()
+	if !strings.Contains(out, "event: dropped\ndata: {\"dropped\":25}") {
+		t.Fatalf("expected drop marker for 25 events, got %q", out)
+	}
+	var batches int
+	for _, line := range strings.Split(out, "\n") {
+		data, ok := strings.CutPrefix(line, "data: [")
+		if !ok {
+			continue
+		}
+		batches++
+		var events []storage.Event
+		if err := json.Unmarshal([]byte("["+data), &events); err != nil {
+			t.Fatalf("decode batch: %v", err)
+		}
+		if len(events) != 10 {
+			t.Fatalf("expected batch capped at 10 events, got %d", len(events))
+		}
+		if !events[0].Timestamp.Equal(base.Add(34 * time.Microsecond)) {
+			t.Fatalf("expected newest events to be kept, first is %v", events[0].Timestamp)
+		}
+	}
+	if batches != 1 {
+		t.Fatalf("expected burst in a single message, got %d: %s", batches, out)
+	}
+}
+
+func TestLive_ResumesFromLastEventID(t *testing.T) {
+	s, project := newTestServer(t, Config{LiveInterval: 20 * time.Millisecond, LiveRetry: 3 * time.Second})
+
+	seen := time.Now().UTC().Add(-time.Minute).Truncate(time.Microsecond)
+	missed := seen.Add(10 * time.Second)
+	if err := s.events.InsertEvents(context.Background(), []storage.Event{
+		{ProjectID: project.ID, SessionID: "s1", EventType: "click", Fingerprint: "seen", URL: "https://example.com/", URLPath: "/", Timestamp: seen},
+		{ProjectID: project.ID, SessionID: "s1", EventType: "click", Fingerprint: "missed", URL: "https://example.com/", URLPath: "/", Timestamp: missed},
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	r := authedRequest("GET", "/api/v1/events/live", "", project, "").WithContext(auth.WithProject(ctx, project))
+	r.Header.Set("Last-Event-ID", liveEventID(seen))
+	w := httptest.NewRecorder()
+	s.liveEventsHandler(w, r)
+
+	out := w.Body.String()
+	if !strings.HasPrefix(out, "retry: 3000\n\n") {
+		t.Fatalf("expected retry directive first, got %q", out)
+	}
+	if !strings.Contains(out, "id: "+liveEventID(missed)+"\n") {
+		t.Fatalf("expected message id for resumed event, got %q", out)
+	}
+	if !strings.Contains(out, `"fingerprint":"missed"`) || strings.Contains(out, `"fingerprint":"seen"`) {
+		t.Fatalf("expected only events after Last-Event-ID, got %q", out)
+	}
+}
+
+func TestLive_FiltersAndNamesStreamedEvents(t *testing.T) {
+	s, project := newTestServer(t, Config{LiveInterval: 20 * time.Millisecond})
+	ctx := context.Background()
+	if err := s.meta.SetEventName(ctx, storage.EventName{ProjectID: project.ID, Fingerprint: "buy", AIName: "Click Buy"}); err != nil {
+		t.Fatalf("SetEventName: %v", err)
+	}
+
+	ts := time.Now().UTC().Add(time.Second)
+	ev := func(typ, fp, path string) storage.Event {
+		return storage.Event{ProjectID: project.ID, SessionID: "s1", EventType: typ, Fingerprint: fp,
+			URL: "https://example.com" + path, URLPath: path, Timestamp: ts}
+	}
+	if err := s.events.InsertEvents(ctx, []storage.Event{
+		ev("click", "buy", "/checkout"),
+		ev("click", "nav", "/home"),
+		ev("pageview", "view", "/checkout"),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	streamCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	s.liveEventsHandler(w, authedRequest("GET", "/api/v1/events/live?event_type=click&url_path=/checkout", "", project, "").WithContext(
+		auth.WithProject(streamCtx, project)))
+
+	var streamed []storage.Event
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if data, ok := strings.CutPrefix(line, "data: ["); ok {
+			var events []storage.Event
+			if err := json.Unmarshal([]byte("["+data), &events); err != nil {
+				t.Fatalf("decode batch: %v", err)
+			}
+			streamed = append(streamed, events...)
+		}
+	}
+	if len(streamed) != 1 || streamed[0].Fingerprint != "buy" {
+		t.Fatalf("expected only the checkout click, got %+v", streamed)
+	}
+	if streamed[0].EventName == nil || *streamed[0].EventName != "Click Buy" {
+		t.Fatalf("expected the AI name on the streamed event, got %v", streamed[0].EventName)
+	}
+}
+
+func TestLiveWebSocket_StreamsEventsAndCloses(t *testing.T) {
+	s, project := newTestServer(t, Config{LiveInterval: 20 * time.Millisecond, LiveHeartbeat: 30 * time.Millisecond})
+	ctx := context.Background()
+	user, err := s.meta.CreateUser(ctx, "ws@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.meta.AddProjectMember(ctx, user.ID, project.ID, "owner"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.meta.CreateUserSession(ctx, user.ID, time.Now().Add(time.Hour), project.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross := httptest.NewRequest("GET", "/api/v1/events/ws", nil)
+	cross.Header.Set("Origin", "https://evil.example")
+	cross.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: token})
+	w := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(w, cross)
+	assertAPIError(t, "foreign origin", w, http.StatusForbidden, "forbidden")
+
+	srv := httptest.NewServer(s.server.Handler)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET /api/v1/events/ws HTTP/1.1\r\nHost: %s\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+		"Sec-WebSocket-Key: %s\r\nSec-WebSocket-Version: 13\r\nCookie: %s=%s\r\n\r\n",
+		strings.TrimPrefix(srv.URL, "http://"), key, auth.SessionCookieName, token)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("expected 101 with the RFC 6455 accept key, got %d %v", resp.StatusCode, resp.Header)
+	}
+
+	// Server frames are unmasked and small enough here for a 16-bit length.
+	readFrame := func() (byte, []byte) {
+		t.Helper()
+		var head [2]byte
+		if _, err := io.ReadFull(br, head[:]); err != nil {
+			t.Fatalf("reading frame: %v", err)
+		}
+		n := int(head[1] & 0x7F)
+		if n == 126 {
+			var ext [2]byte
+			io.ReadFull(br, ext[:])
+			n = int(binary.BigEndian.Uint16(ext[:]))
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(br, payload); err != nil {
+			t.Fatalf("reading payload: %v", err)
+		}
+		return head[0] & 0x0F, payload
+	}
+
+	if err := s.events.InsertEvents(ctx, []storage.Event{{ProjectID: project.ID, SessionID: "s1", EventType: "click",
+		Fingerprint: "ws", URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC().Add(time.Second)}}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	var sawPing, sawEvents bool
+	for !sawPing || !sawEvents {
+		opcode, payload := readFrame()
+		switch opcode {
+		case 0x9:
+			sawPing = true
+		case 0x1:
+			var msg struct {
+				Type string          `json:"type"`
+				ID   string          `json:"id"`
+				Data []storage.Event `json:"data"`
+			}
+			if err := json.Unmarshal(payload, &msg); err != nil {
+				t.Fatalf("decode message: %v", err)
+			}
+			if msg.Type != "events" || msg.ID == "" || len(msg.Data) != 1 || msg.Data[0].Fingerprint != "ws" {
+				t.Fatalf("unexpected message %s", payload)
+			}
+			sawEvents = true
+		}
+	}
+
+	// A masked client close frame gets a close frame back.
+	mask := []byte{1, 2, 3, 4}
+	code := []byte{0x03 ^ mask[0], 0xE8 ^ mask[1]}
+	conn.Write(append([]byte{0x88, 0x82}, append(mask, code...)...))
+	for {
+		opcode, payload := readFrame()
+		if opcode == 0x8 {
+			if binary.BigEndian.Uint16(payload) != 1000 {
+				t.Fatalf("expected normal closure, got %v", payload)
+			}
+			break
+		}
+	}
+	if _, err := br.ReadByte(); err != io.EOF {
+		t.Fatalf("expected the server to drop the connection, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/query"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestNamingCoverage(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	now := time.Now().UTC()
+	buy := "Click Buy"
+	ev := func(fp, eventType string, name *string) storage.Event {
+		return storage.Event{ProjectID: project.ID, SessionID: "s1", EventType: eventType, Fingerprint: fp,
+			URL: "https://example.com/", URLPath: "/", Timestamp: now.Add(-time.Hour), EventName: name}
+	}
+	// Four click fingerprints, one of them named (on a later event); the
+	// pageview is not an interaction and doesn't count.
+	if err := s.events.InsertEvents(ctx, []storage.Event{
+		ev("fp1", "click", nil), ev("fp1", "click", &buy),
+		ev("fp2", "click", nil), ev("fp3", "submit", nil), ev("fp4", "input", nil),
+		ev("pv", "pageview", nil),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	if err := s.meta.SetEventName(ctx, storage.EventName{
+		ProjectID: project.ID, Fingerprint: "fp1", AIName: buy, Status: storage.NameApproved,
+	}); err != nil {
+		t.Fatalf("SetEventName: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	query.NewHandler(s.events, s.meta).NamingCoverageHandler(w, authedRequest("GET", "/api/v1/naming/coverage", "", project, ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data            []storage.NamingCoveragePoint `json:"data"`
+		NewFingerprints int64                         `json:"new_fingerprints"`
+		Unnamed         int64                         `json:"unnamed"`
+		CoveragePct     *float64                      `json:"coverage_pct"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.NewFingerprints != 4 || resp.Unnamed != 3 || resp.CoveragePct == nil || *resp.CoveragePct != 25 {
+		t.Fatalf("expected 4 fingerprints, 3 unnamed, 25%% coverage, got %+v", resp)
+	}
+	var named int64
+	for _, p := range resp.Data {
+		named += p.Named
+	}
+	if named != 1 {
+		t.Fatalf("expected one generated name in the series, got %+v", resp.Data)
+	}
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// quotaStatus is a project's monthly event quota and this month's usage.
+type quotaStatus struct {
+	MonthlyEventQuota int64     `json:"monthly_event_quota"` // 0 = unlimited
+	Month             string    `json:"month"`
+	Used              int64     `json:"used"`
+	Remaining         *int64    `json:"remaining"` // null when unlimited
+	ResetsAt          time.Time `json:"resets_at"`
+}
+
+// getQuotaHandler reports the project's monthly event quota and usage.
+// GET /api/v1/admin/quota
+func (s *Server) getQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	now := time.Now().UTC()
+	quota := s.meta.EventQuota(r.Context(), project.ID)
+	// Usage is only tracked under a quota; without one, count the events.
+	var used int64
+	var err error
+	if quota > 0 {
+		used, err = s.meta.MonthlyEventUsage(r.Context(), project.ID, now)
+	} else {
+		used, err = s.events.CountReceivedEvents(r.Context(), project.ID, storage.UsageMonthStart(now))
+	}
+	if err != nil {
+		log.Printf("ERROR reading event usage for %s: %v", project.ID, err)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+		return
+	}
+	st := quotaStatus{
+		MonthlyEventQuota: quota,
+		Month:             storage.UsageMonth(now),
+		Used:              used,
+		ResetsAt:          time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	if st.MonthlyEventQuota > 0 {
+		remaining := max(st.MonthlyEventQuota-used, 0)
+		st.Remaining = &remaining
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// putQuotaHandler sets how many events a project may ingest per UTC month;
+// 0 removes the limit. Once it is reached, ingestion answers 429 until the
+// month rolls over. The quota caps what the project's own members can do, so
+// only the instance admin may set it; project_id picks a project other than
+// the session's.
+// PUT /api/v1/admin/quota  {"monthly_event_quota":1000000,"project_id":"..."}
+func (s *Server) putQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !s.requireInstanceAdmin(w, r) {
+		return
+	}
+	var body struct {
+		MonthlyEventQuota int64  `json:"monthly_event_quota"`
+		ProjectID         string `json:"project_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if body.MonthlyEventQuota < 0 {
+		apierror.Error(w, "monthly_event_quota must be 0 (unlimited) or more", http.StatusBadRequest)
+		return
+	}
+	projectID := project.ID
+	if body.ProjectID != "" && body.ProjectID != project.ID {
+		if _, err := s.meta.GetProject(r.Context(), body.ProjectID); err != nil {
+			apierror.ErrorCode(w, apierror.CodeNotFound, "unknown project", http.StatusNotFound)
+			return
+		}
+		projectID = body.ProjectID
+	}
+	tracked := s.meta.EventQuota(r.Context(), projectID) > 0
+	if err := s.meta.SetEventQuota(r.Context(), projectID, body.MonthlyEventQuota); err != nil {
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	// Ingest only tracks usage under a quota, so a new one starts from the
+	// events already stored this month.
+	if body.MonthlyEventQuota > 0 && !tracked {
+		now := time.Now().UTC()
+		used, err := s.events.CountReceivedEvents(r.Context(), projectID, storage.UsageMonthStart(now))
+		if err == nil {
+			err = s.meta.SetEventUsage(r.Context(), projectID, now, used)
+		}
+		if err != nil {
+			log.Printf("ERROR seeding event usage for %s: %v", projectID, err)
+			apierror.Error(w, "save failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
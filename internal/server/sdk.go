@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// sdkAsset is the SDK bundle with its content-derived names. The hashed
+// path changes whenever the bytes do, so it can be cached forever; /sdk.js
+// stays as the always-latest alias.
+type sdkAsset struct {
+	body      []byte
+	hash      string // first 12 hex chars of the SHA-256, used in the URL
+	path      string // /sdk.<hash>.js
+	integrity string // Subresource Integrity value, sha384-<base64>
+}
+
+func newSDKAsset(js []byte) *sdkAsset {
+	if js == nil {
+		js = []byte("/* ClickNest SDK - build with 'make sdk' */")
+	}
+	sum := sha256.Sum256(js)
+	hash := hex.EncodeToString(sum[:])[:12]
+	sri := sha512.Sum384(js)
+	return &sdkAsset{
+		body:      js,
+		hash:      hash,
+		path:      "/sdk." + hash + ".js",
+		integrity: "sha384-" + base64.StdEncoding.EncodeToString(sri[:]),
+	}
+}
+
+// sdkLatestHandler serves /sdk.js. Browsers revalidate it on every load via
+// the ETag, so a server upgrade reaches existing snippets immediately.
+func (s *Server) sdkLatestHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", `"`+s.sdk.hash+`"`)
+	http.ServeContent(w, r, "sdk.js", time.Time{}, bytes.NewReader(s.sdk.body))
+}
+
+// sdkHashedHandler serves the content-hashed SDK with an immutable cache.
+func (s *Server) sdkHashedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/javascript")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Write(s.sdk.body)
+}
+
+// sdkInfoHandler returns the current SDK version, its hashed URL, and the
+// integrity value for <script integrity=... crossorigin="anonymous">.
+// GET /api/v1/sdk
+func (s *Server) sdkInfoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	json.NewEncoder(w).Encode(map[string]any{
+		"version":   s.sdk.hash,
+		"path":      s.sdk.path,
+		"integrity": s.sdk.integrity,
+	})
+}
@@ -0,0 +1,58 @@
+package server
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSDK_HashedURLAndIntegrity(t *testing.T) {
+	js := []byte("window.clicknest = {};")
+	s, _ := newTestServer(t, Config{SDKJS: js})
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		for k, v := range header {
+			r.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, r)
+		return w
+	}
+
+	var info struct {
+		Version   string `json:"version"`
+		Path      string `json:"path"`
+		Integrity string `json:"integrity"`
+	}
+	if err := json.NewDecoder(get("/api/v1/sdk", nil).Body).Decode(&info); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if info.Path != "/sdk."+info.Version+".js" {
+		t.Fatalf("expected hashed path for version %q, got %q", info.Version, info.Path)
+	}
+	sum := sha512.Sum384(js)
+	if want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:]); info.Integrity != want {
+		t.Fatalf("integrity = %q, want %q", info.Integrity, want)
+	}
+
+	w := get(info.Path, nil)
+	if w.Code != http.StatusOK || w.Body.String() != string(js) {
+		t.Fatalf("expected hashed URL to serve the SDK, got %d: %q", w.Code, w.Body.String())
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Fatalf("expected immutable cache on hashed URL, got %q", cc)
+	}
+
+	w = get("/sdk.js", nil)
+	if w.Body.String() != string(js) {
+		t.Fatalf("expected /sdk.js to serve the same bytes, got %q", w.Body.String())
+	}
+	w = get("/sdk.js", http.Header{"If-None-Match": {w.Header().Get("ETag")}})
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("expected 304 on revalidation, got %d", w.Code)
+	}
+}
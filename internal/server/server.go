@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"cmp"
 	"context"
 	"crypto/hmac"
 	"crypto/rand"
@@ -19,6 +20,8 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -26,6 +29,7 @@ import (
 	"time"
 
 	"github.com/danielthedm/clicknest/internal/ai"
+	"github.com/danielthedm/clicknest/internal/apierror"
 	"github.com/danielthedm/clicknest/internal/auth"
 	ghub "github.com/danielthedm/clicknest/internal/github"
 	"github.com/danielthedm/clicknest/internal/growth"
@@ -45,6 +49,24 @@ type Config struct {
 	GitHubClientSecret string // GitHub OAuth app client secret
 	CloudMode          bool   // True when running as a managed cloud instance
 
+	// FrontendOrigin, if set (e.g. "https://app.example.com"), is the origin
+	// of a dashboard served separately from the API. That origin alone gets
+	// credentialed CORS and session cookies become SameSite=None; Secure.
+	// Empty keeps the embedded single-origin mode.
+	FrontendOrigin string
+
+	// SDKOrigins, if set, are the only origins the public SDK routes (the
+	// SDK script, ingestion and the other API-key or token authenticated
+	// endpoints) answer cross-origin. Empty allows every origin: the SDK is
+	// public by design. Dashboard routes ignore it and answer only
+	// FrontendOrigin and the server's own origin.
+	SDKOrigins []string
+
+	// IngestPath, if set (e.g. "/t/collect"), is an extra path that accepts
+	// SDK events like POST /api/v1/events, for corporate proxies that block
+	// URLs containing "events". Must start with "/".
+	IngestPath string
+
 	// Single-tenant cloud instance fields. When ControlPlaneURL is set,
 	// this instance is a dedicated customer instance managed by the control plane.
 	ControlPlaneURL string // e.g. "https://api.clicknest.app"
@@ -53,7 +75,7 @@ type Config struct {
 
 	// RouteHook is called at the end of route setup. EE code uses this
 	// to inject billing, signup, and instance routes into the shared mux.
-	RouteHook func(mux *http.ServeMux, meta *storage.SQLite)
+	RouteHook func(mux *http.ServeMux, meta storage.MetaStore)
 
 	// ResourceLimitFn, if set, is consulted before creating metered resources.
 	// It returns an HTTP status code and error message if the limit is exceeded,
@@ -65,9 +87,16 @@ type Config struct {
 	// When nil, the server uses a 365-day default for all projects.
 	RetentionDaysFn func(ctx context.Context, projectID string) int
 
-	// RateLimitFn, if set, returns per-project event ingestion rate limits (tokens/sec, burst).
+	// RatePerSecond and RateBurst are the default per-project event ingestion
+	// limits (ingest requests/sec sustained, burst). Each request takes one
+	// token whatever the size of its batch. Over-limit requests get 429 with
+	// a Retry-After header. Defaults of 10/s and 50 applied in New() if unset.
+	RatePerSecond float64
+	RateBurst     int
+
+	// RateLimitFn, if set, returns per-project event ingestion rate limits (requests/sec, burst).
 	// Return rate <= 0 to disable rate limiting for the project (e.g. enterprise tier).
-	// When nil, the default 10/s, 50 burst limits apply.
+	// When nil, RatePerSecond and RateBurst apply.
 	RateLimitFn func(ctx context.Context, projectID string) (rate float64, burst int)
 
 	// OnEventIngested, if set, is called after a successful event batch is written to DuckDB.
@@ -75,10 +104,49 @@ type Config struct {
 	// Used by EE to increment the monthly usage counter in PostgreSQL.
 	OnEventIngested func(ctx context.Context, projectID string, count int64)
 
+	// MaxResultLimit caps the limit query parameter on list endpoints so a
+	// client can't pull an unbounded result set into memory. Responses echo
+	// the limit applied. Default query.DefaultMaxLimit applied in New() if
+	// unset.
+	MaxResultLimit int
+
 	// MaxConcurrentQueries is the maximum number of concurrent DuckDB analytics queries
 	// allowed per project. 0 means unlimited. Default applied in New() if unset.
 	MaxConcurrentQueries int
 
+	// ChatMaxMessageLength caps the length (in bytes) of a single AI chat message,
+	// including each history entry. ChatMaxHistory caps the number of prior
+	// messages a client may send. ChatRatePerMinute is the per-user chat request
+	// rate. Defaults applied in New() if unset.
+	ChatMaxMessageLength int
+	ChatMaxHistory       int
+	ChatRatePerMinute    float64
+
+	// LiveRecomputeInterval is the debounce window for pushing recomputed
+	// funnel/retention aggregates to live streams after new events arrive.
+	// Default applied in New() if unset.
+	LiveRecomputeInterval time.Duration
+
+	// LiveInterval is the minimum gap between event messages on the live
+	// stream and LiveMaxBatch the most events sent per message. Events beyond
+	// the batch are dropped oldest-first and reported with a "dropped" event.
+	// Defaults applied in New() if unset.
+	LiveInterval time.Duration
+	LiveMaxBatch int
+
+	// LiveHeartbeat is how often an idle live stream sends a keep-alive
+	// comment, and LiveRetry the reconnection delay advertised to EventSource
+	// clients via the SSE retry: field. Defaults applied in New() if unset.
+	LiveHeartbeat time.Duration
+	LiveRetry     time.Duration
+
+	// AlertInterval is how often every enabled alert is evaluated. Evaluations
+	// are staggered across the first half of the interval and run on at most
+	// AlertWorkers goroutines, so one slow count or webhook doesn't hold up the
+	// rest. Defaults applied in New() if unset.
+	AlertInterval time.Duration
+	AlertWorkers  int
+
 	// Analytics, if set, receives server-side event captures for backend
 	// instrumentation (dogfooding). Nil disables analytics capture.
 	Analytics AnalyticsTracker
@@ -104,21 +172,75 @@ func (s *Server) track(event string, properties map[string]any) {
 type Server struct {
 	config       Config
 	events       *storage.DuckDB
-	meta         *storage.SQLite
+	meta         storage.MetaStore
 	namer        *ai.Namer
 	syncer       *ghub.Syncer
 	matcher      *ghub.Matcher
 	registry     *growth.Registry
 	eventLimiter *ratelimit.Limiter
+	chatLimiter  *ratelimit.Limiter
+	embedLimiter *ratelimit.Limiter // public widget fetches, keyed by widget
+	flagLimiter  *ratelimit.Limiter // logged flag exposures, keyed by project
+	idempotency  *idempotencyCache
+	insights     *insightsCache
+	fingerprints *fingerprintJobs
+	alertBackoff []time.Duration // waits before each alert webhook retry
+	live         *liveBroker
+	sdkRoutes    map[string]bool // mux patterns under the SDK CORS policy
+	ingest       *ingest.Handler
+	sdk          *sdkAsset
 	querySlots   sync.Map // projectID → chan struct{} (semaphore)
 	mux          *http.ServeMux
 	server       *http.Server
 }
 
-func New(config Config, events *storage.DuckDB, meta *storage.SQLite, namer *ai.Namer, syncer *ghub.Syncer, matcher *ghub.Matcher, registry *growth.Registry) *Server {
+func New(config Config, events *storage.DuckDB, meta storage.MetaStore, namer *ai.Namer, syncer *ghub.Syncer, matcher *ghub.Matcher, registry *growth.Registry) *Server {
 	if config.MaxConcurrentQueries == 0 {
 		config.MaxConcurrentQueries = 5
 	}
+	if config.MaxResultLimit == 0 {
+		config.MaxResultLimit = query.DefaultMaxLimit
+	}
+	if config.RatePerSecond == 0 {
+		config.RatePerSecond = 10
+	}
+	if config.RateBurst == 0 {
+		config.RateBurst = 50
+	}
+	if config.ChatMaxMessageLength == 0 {
+		config.ChatMaxMessageLength = 4000
+	}
+	if config.ChatMaxHistory == 0 {
+		config.ChatMaxHistory = 20
+	}
+	if config.ChatRatePerMinute == 0 {
+		config.ChatRatePerMinute = 10
+	}
+	if config.LiveRecomputeInterval == 0 {
+		config.LiveRecomputeInterval = 5 * time.Second
+	}
+	if config.LiveInterval == 0 {
+		config.LiveInterval = 2 * time.Second
+	}
+	if config.LiveMaxBatch == 0 {
+		config.LiveMaxBatch = 50
+	}
+	if config.LiveHeartbeat == 0 {
+		config.LiveHeartbeat = 15 * time.Second
+	}
+	if config.LiveRetry == 0 {
+		config.LiveRetry = 5 * time.Second
+	}
+	if config.AlertInterval == 0 {
+		config.AlertInterval = 5 * time.Minute
+	}
+	if config.AlertWorkers == 0 {
+		config.AlertWorkers = 4
+	}
+	config.FrontendOrigin = strings.TrimRight(config.FrontendOrigin, "/")
+	if config.IngestPath != "" && !strings.HasPrefix(config.IngestPath, "/") {
+		config.IngestPath = "/" + config.IngestPath
+	}
 	s := &Server{
 		config:       config,
 		events:       events,
@@ -127,13 +249,23 @@ func New(config Config, events *storage.DuckDB, meta *storage.SQLite, namer *ai.
 		syncer:       syncer,
 		matcher:      matcher,
 		registry:     registry,
-		eventLimiter: ratelimit.New(10, 50),
+		eventLimiter: ratelimit.New(config.RatePerSecond, config.RateBurst),
+		chatLimiter:  ratelimit.New(config.ChatRatePerMinute/60, int(math.Max(1, config.ChatRatePerMinute))),
+		embedLimiter: ratelimit.New(1, 30),
+		flagLimiter:  ratelimit.New(exposureRatePerSecond, exposureBurst),
+		idempotency:  newIdempotencyCache(),
+		insights:     newInsightsCache(),
+		fingerprints: newFingerprintJobs(),
+		alertBackoff: []time.Duration{time.Second, 2 * time.Second, 4 * time.Second},
+		live:         newLiveBroker(config.LiveRecomputeInterval),
+		sdk:          newSDKAsset(config.SDKJS),
 		mux:          http.NewServeMux(),
+		sdkRoutes:    make(map[string]bool),
 	}
 	s.routes()
 	s.server = &http.Server{
 		Addr:         config.Addr,
-		Handler:      CORS(s.mux),
+		Handler:      s.cors(s.mux),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 30 * time.Second,
 		IdleTimeout:  60 * time.Second,
@@ -143,55 +275,91 @@ func New(config Config, events *storage.DuckDB, meta *storage.SQLite, namer *ai.
 
 func (s *Server) routes() {
 	ingestHandler := ingest.NewHandler(s.events, s.meta, s.namer)
-	if s.config.OnEventIngested != nil {
-		fn := s.config.OnEventIngested
-		ingestHandler.OnIngested = func(projectID string, count int64) {
-			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-			defer cancel()
-			fn(ctx, projectID, count)
+	s.ingest = ingestHandler
+	fn := s.config.OnEventIngested
+	ingestHandler.OnIngested = func(projectID string, count int64) {
+		s.live.notify(projectID)
+		if fn == nil {
+			return
 		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		fn(ctx, projectID, count)
 	}
 	queryHandler := query.NewHandler(s.events, s.meta)
 	queryHandler.SetMatcher(s.matcher)
+	queryHandler.SetMaxLimit(s.config.MaxResultLimit)
 
 	apiKeyAuth := auth.APIKeyMiddleware(s.meta)
-	sessionAuth := auth.SessionMiddleware(s.meta)
+	session := auth.SessionMiddleware(s.meta)
+	sessionAuth := func(next http.Handler) http.Handler { return s.originGuard(session(s.excludeInternal(s.applyTimezone(next)))) }
 
 	// SDK ingestion endpoint (API key auth + rate limiting).
 	rateLimitedIngest := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		project := auth.ProjectFromContext(r.Context())
 		if project != nil {
 			allowed := false
+			rate := s.config.RatePerSecond
 			if s.config.RateLimitFn != nil {
-				rate, burst := s.config.RateLimitFn(r.Context(), project.ID)
+				var burst int
+				rate, burst = s.config.RateLimitFn(r.Context(), project.ID)
 				allowed = s.eventLimiter.AllowRate(project.ID, rate, burst)
 			} else {
 				allowed = s.eventLimiter.Allow(project.ID)
 			}
 			if !allowed {
-				w.Header().Set("Retry-After", "1")
-				http.Error(w, `{"error":"rate limit exceeded"}`, http.StatusTooManyRequests)
+				// Suggest waiting until the bucket has refilled one token. A
+				// bucket that never refills has no useful wait; say a second.
+				retry := 1
+				if rate > 0 {
+					retry = int(math.Max(1, math.Ceil(1/rate)))
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(retry))
+				apierror.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
 				return
 			}
 		}
 		ingestHandler.ServeHTTP(w, r)
 	})
-	s.mux.Handle("POST /api/v1/events", apiKeyAuth(rateLimitedIngest))
+	s.sdkRoute("POST /api/v1/events", apiKeyAuth(rateLimitedIngest))
+	// Project-scoped form: the public ID in the path must match the API key.
+	s.sdkRoute("POST /api/v1/{public_id}/events", auth.PublicIDMiddleware(s.meta)(apiKeyAuth(auth.RequireMatchingPublicID(rateLimitedIngest))))
+	if s.config.IngestPath != "" {
+		s.sdkRoute("POST "+s.config.IngestPath, apiKeyAuth(rateLimitedIngest))
+	}
+
+	// Post-ingest enrichment (API key auth): merge properties learned later,
+	// e.g. server-confirmed revenue, into an event.
+	s.sdkRoute("PATCH /api/v1/events/{id}", apiKeyAuth(http.HandlerFunc(s.patchEventHandler)))
 
 	// Inbound lead ingestion (API key auth). External services like Gojiberry,
 	// Typeform, etc. can POST leads here. Creates synthetic events so the
 	// existing lead scoring system picks them up automatically.
-	s.mux.Handle("POST /api/v1/leads/ingest", apiKeyAuth(http.HandlerFunc(s.ingestLeadsHandler)))
+	s.sdkRoute("POST /api/v1/leads/ingest", apiKeyAuth(http.HandlerFunc(s.ingestLeadsHandler)))
+
+	// Server-side identity merge (API key auth), the same aliasing the SDK's
+	// $identify event performs.
+	s.sdkRoute("POST /api/v1/identify", apiKeyAuth(http.HandlerFunc(s.identifyHandler)))
+
+	// Ingestion heartbeat (API key auth) for external uptime monitors.
+	s.sdkRoute("GET /api/v1/heartbeat", apiKeyAuth(http.HandlerFunc(s.heartbeatHandler)))
 
 	// Dashboard query endpoints (session auth + per-project concurrent query limit).
 	ql := s.withQueryLimit
 	s.mux.Handle("GET /api/v1/events", sessionAuth(ql(http.HandlerFunc(queryHandler.EventsHandler))))
+	s.mux.Handle("DELETE /api/v1/events", sessionAuth(http.HandlerFunc(queryHandler.DeleteEventsHandler)))
 	s.mux.Handle("GET /api/v1/events/stats", sessionAuth(ql(http.HandlerFunc(queryHandler.EventStatsHandler))))
 	s.mux.Handle("GET /api/v1/events/live", sessionAuth(http.HandlerFunc(s.liveEventsHandler)))
+	s.mux.Handle("GET /api/v1/events/ws", sessionAuth(http.HandlerFunc(s.liveEventsWSHandler)))
 	s.mux.Handle("GET /api/v1/trends", sessionAuth(ql(http.HandlerFunc(queryHandler.TrendsHandler))))
 	s.mux.Handle("GET /api/v1/trends/breakdown", sessionAuth(ql(http.HandlerFunc(queryHandler.TrendsBreakdownHandler))))
+	s.mux.Handle("GET /api/v1/breakdown/property", sessionAuth(ql(http.HandlerFunc(queryHandler.PropertyBreakdownHandler))))
+	s.mux.Handle("POST /api/v1/query/sql", sessionAuth(ql(http.HandlerFunc(queryHandler.SQLHandler))))
+	s.mux.Handle("POST /api/v1/trends/multi", sessionAuth(ql(http.HandlerFunc(queryHandler.TrendsMultiHandler))))
 	s.mux.Handle("GET /api/v1/pages", sessionAuth(ql(http.HandlerFunc(queryHandler.PagesHandler))))
+	s.mux.Handle("GET /api/v1/pages/suggestions", sessionAuth(ql(http.HandlerFunc(queryHandler.PageSuggestionsHandler))))
 	s.mux.Handle("GET /api/v1/sessions", sessionAuth(ql(http.HandlerFunc(queryHandler.SessionsHandler))))
+	s.mux.Handle("GET /api/v1/sessions/stats", sessionAuth(ql(http.HandlerFunc(queryHandler.SessionStatsHandler))))
 	s.mux.Handle("GET /api/v1/sessions/{id}", sessionAuth(ql(http.HandlerFunc(queryHandler.SessionDetailHandler))))
 
 	// Properties.
@@ -199,27 +367,37 @@ func (s *Server) routes() {
 	s.mux.Handle("GET /api/v1/properties/values", sessionAuth(http.HandlerFunc(queryHandler.PropertyValuesHandler)))
 
 	// Users.
+	// Self-serve data requests: admins mint per-user tokens, end users redeem them.
+	s.mux.Handle("POST /api/v1/gdpr/tokens", sessionAuth(http.HandlerFunc(s.createUserTokenHandler)))
+	s.sdkRoute("POST /api/v1/gdpr/delete", http.HandlerFunc(s.gdprDeleteHandler))                // no session auth — signed user token
+	s.sdkRoute("GET /api/v1/gdpr/export", http.HandlerFunc(queryHandler.SelfServeExportHandler)) // no session auth — signed user token
+
 	s.mux.Handle("GET /api/v1/users", sessionAuth(http.HandlerFunc(queryHandler.UsersHandler)))
 	s.mux.Handle("GET /api/v1/users/{id}/events", sessionAuth(http.HandlerFunc(queryHandler.UserEventsHandler)))
+	s.mux.Handle("GET /api/v1/users/{id}/export", sessionAuth(http.HandlerFunc(queryHandler.UserExportHandler)))
 
 	// Funnels.
 	s.mux.Handle("GET /api/v1/funnels", sessionAuth(http.HandlerFunc(queryHandler.ListFunnelsHandler)))
-	s.mux.Handle("POST /api/v1/funnels", sessionAuth(http.HandlerFunc(queryHandler.CreateFunnelHandler)))
+	s.mux.Handle("POST /api/v1/funnels", sessionAuth(s.idempotent(http.HandlerFunc(queryHandler.CreateFunnelHandler))))
 	s.mux.Handle("GET /api/v1/funnels/{id}", sessionAuth(http.HandlerFunc(queryHandler.GetFunnelHandler)))
+	s.mux.Handle("PUT /api/v1/funnels/{id}", sessionAuth(http.HandlerFunc(queryHandler.UpdateFunnelHandler)))
 	s.mux.Handle("DELETE /api/v1/funnels/{id}", sessionAuth(http.HandlerFunc(queryHandler.DeleteFunnelHandler)))
 	s.mux.Handle("GET /api/v1/funnels/{id}/results", sessionAuth(ql(http.HandlerFunc(queryHandler.FunnelResultsHandler))))
 	s.mux.Handle("GET /api/v1/funnels/{id}/cohorts", sessionAuth(ql(http.HandlerFunc(queryHandler.FunnelCohortsHandler))))
+	s.mux.Handle("GET /api/v1/funnels/{id}/trend", sessionAuth(ql(http.HandlerFunc(queryHandler.FunnelTrendHandler))))
+	s.mux.Handle("GET /api/v1/funnels/{id}/converters", sessionAuth(ql(http.HandlerFunc(queryHandler.FunnelConvertersHandler))))
 	s.mux.Handle("POST /api/v1/funnels/suggest", sessionAuth(http.HandlerFunc(s.suggestFunnelsHandler)))
 
 	// AI chat.
 	s.mux.Handle("POST /api/v1/ai/chat", sessionAuth(http.HandlerFunc(s.aiChatHandler)))
+	s.mux.Handle("POST /api/v1/ai/insights", sessionAuth(http.HandlerFunc(s.aiInsightsHandler)))
 
 	// Retention.
 	s.mux.Handle("GET /api/v1/retention", sessionAuth(ql(http.HandlerFunc(queryHandler.RetentionHandler))))
 
 	// Dashboards.
 	s.mux.Handle("GET /api/v1/dashboards", sessionAuth(http.HandlerFunc(queryHandler.ListDashboardsHandler)))
-	s.mux.Handle("POST /api/v1/dashboards", sessionAuth(http.HandlerFunc(queryHandler.CreateDashboardHandler)))
+	s.mux.Handle("POST /api/v1/dashboards", sessionAuth(s.idempotent(http.HandlerFunc(queryHandler.CreateDashboardHandler))))
 	s.mux.Handle("GET /api/v1/dashboards/{id}", sessionAuth(http.HandlerFunc(queryHandler.GetDashboardHandler)))
 	s.mux.Handle("PUT /api/v1/dashboards/{id}", sessionAuth(http.HandlerFunc(queryHandler.UpdateDashboardHandler)))
 	s.mux.Handle("DELETE /api/v1/dashboards/{id}", sessionAuth(http.HandlerFunc(queryHandler.DeleteDashboardHandler)))
@@ -227,6 +405,32 @@ func (s *Server) routes() {
 	// Event names.
 	s.mux.Handle("GET /api/v1/names", sessionAuth(http.HandlerFunc(s.listNamesHandler)))
 	s.mux.Handle("PUT /api/v1/names/{fp}", sessionAuth(http.HandlerFunc(s.overrideNameHandler)))
+	s.mux.Handle("GET /api/v1/names/{fp}/element", sessionAuth(http.HandlerFunc(s.nameElementHandler)))
+	s.mux.Handle("GET /api/v1/naming/coverage", sessionAuth(ql(http.HandlerFunc(queryHandler.NamingCoverageHandler))))
+	s.mux.Handle("GET /api/v1/names/pending", sessionAuth(http.HandlerFunc(s.listPendingNamesHandler)))
+	s.mux.Handle("POST /api/v1/names/{fp}/approve", sessionAuth(http.HandlerFunc(s.approveNameHandler)))
+	s.mux.Handle("POST /api/v1/names/{fp}/reject", sessionAuth(http.HandlerFunc(s.rejectNameHandler)))
+	s.mux.Handle("GET /api/v1/names/review-settings", sessionAuth(http.HandlerFunc(s.getNameReviewSettingsHandler)))
+	s.mux.Handle("PUT /api/v1/names/review-settings", sessionAuth(http.HandlerFunc(s.putNameReviewSettingsHandler)))
+	s.mux.Handle("GET /api/v1/settings/path-rules", sessionAuth(http.HandlerFunc(s.getPathRulesHandler)))
+	s.mux.Handle("PUT /api/v1/settings/path-rules", sessionAuth(http.HandlerFunc(s.putPathRulesHandler)))
+	s.mux.Handle("GET /api/v1/settings/promoted-properties", sessionAuth(http.HandlerFunc(s.getPromotedPropertiesHandler)))
+	s.mux.Handle("PUT /api/v1/settings/promoted-properties", sessionAuth(http.HandlerFunc(s.putPromotedPropertiesHandler)))
+	s.mux.Handle("GET /api/v1/settings/sampling", sessionAuth(http.HandlerFunc(s.getSamplingHandler)))
+	s.mux.Handle("PUT /api/v1/settings/sampling", sessionAuth(http.HandlerFunc(s.putSamplingHandler)))
+	s.mux.Handle("GET /api/v1/settings/bot-filters", sessionAuth(http.HandlerFunc(s.getBotFiltersHandler)))
+	s.mux.Handle("PUT /api/v1/settings/bot-filters", sessionAuth(http.HandlerFunc(s.putBotFiltersHandler)))
+	s.mux.Handle("GET /api/v1/settings/naming-event-types", sessionAuth(http.HandlerFunc(s.getNamingEventTypesHandler)))
+	s.mux.Handle("PUT /api/v1/settings/naming-event-types", sessionAuth(http.HandlerFunc(s.putNamingEventTypesHandler)))
+	s.mux.Handle("GET /api/v1/settings/fingerprint-strategy", sessionAuth(http.HandlerFunc(s.getFingerprintStrategyHandler)))
+	s.mux.Handle("PUT /api/v1/settings/fingerprint-strategy", sessionAuth(http.HandlerFunc(s.putFingerprintStrategyHandler)))
+	s.mux.Handle("GET /api/v1/settings/internal-traffic", sessionAuth(http.HandlerFunc(s.getInternalTrafficHandler)))
+	s.mux.Handle("PUT /api/v1/settings/internal-traffic", sessionAuth(http.HandlerFunc(s.putInternalTrafficHandler)))
+	s.mux.Handle("GET /api/v1/settings/timezone", sessionAuth(http.HandlerFunc(s.getTimezoneHandler)))
+	s.mux.Handle("PUT /api/v1/settings/timezone", sessionAuth(http.HandlerFunc(s.putTimezoneHandler)))
+	s.mux.Handle("GET /api/v1/settings/primary-event", sessionAuth(http.HandlerFunc(s.getPrimaryEventHandler)))
+	s.mux.Handle("PUT /api/v1/settings/primary-event", sessionAuth(http.HandlerFunc(s.putPrimaryEventHandler)))
+	s.mux.Handle("GET /api/v1/overview", sessionAuth(http.HandlerFunc(s.overviewHandler)))
 
 	// Project/settings endpoints.
 	s.mux.Handle("GET /api/v1/project", sessionAuth(http.HandlerFunc(s.projectHandler)))
@@ -248,11 +452,11 @@ func (s *Server) routes() {
 	s.mux.Handle("POST /api/v1/flags", sessionAuth(http.HandlerFunc(s.createFlagHandler)))
 	s.mux.Handle("PUT /api/v1/flags/{id}", sessionAuth(http.HandlerFunc(s.updateFlagHandler)))
 	s.mux.Handle("DELETE /api/v1/flags/{id}", sessionAuth(http.HandlerFunc(s.deleteFlagHandler)))
-	s.mux.Handle("GET /api/v1/flags/evaluate", apiKeyAuth(http.HandlerFunc(s.evaluateFlagsHandler)))
+	s.sdkRoute("GET /api/v1/flags/evaluate", apiKeyAuth(http.HandlerFunc(s.evaluateFlagsHandler)))
 
 	// Alerts.
 	s.mux.Handle("GET /api/v1/alerts", sessionAuth(http.HandlerFunc(s.listAlertsHandler)))
-	s.mux.Handle("POST /api/v1/alerts", sessionAuth(http.HandlerFunc(s.createAlertHandler)))
+	s.mux.Handle("POST /api/v1/alerts", sessionAuth(s.idempotent(http.HandlerFunc(s.createAlertHandler))))
 	s.mux.Handle("PUT /api/v1/alerts/{id}", sessionAuth(http.HandlerFunc(s.updateAlertHandler)))
 	s.mux.Handle("DELETE /api/v1/alerts/{id}", sessionAuth(http.HandlerFunc(s.deleteAlertHandler)))
 
@@ -262,6 +466,12 @@ func (s *Server) routes() {
 	// Heatmap.
 	s.mux.Handle("GET /api/v1/heatmap", sessionAuth(ql(http.HandlerFunc(queryHandler.HeatmapHandler))))
 
+	// Form field engagement.
+	s.mux.Handle("GET /api/v1/forms/{path}/fields", sessionAuth(ql(http.HandlerFunc(queryHandler.FormFieldsHandler))))
+
+	// Performance metrics (Core Web Vitals).
+	s.mux.Handle("GET /api/v1/performance", sessionAuth(ql(http.HandlerFunc(queryHandler.PerformanceHandler))))
+
 	// Attribution.
 	s.mux.Handle("GET /api/v1/attribution", sessionAuth(ql(http.HandlerFunc(queryHandler.AttributionHandler))))
 	s.mux.Handle("GET /api/v1/attribution/sources", sessionAuth(ql(http.HandlerFunc(queryHandler.AttributionSourcesHandler))))
@@ -357,6 +567,13 @@ func (s *Server) routes() {
 	s.mux.Handle("POST /api/v1/segments", sessionAuth(http.HandlerFunc(s.createSegmentHandler)))
 	s.mux.Handle("DELETE /api/v1/segments/{id}", sessionAuth(http.HandlerFunc(s.deleteSegmentHandler)))
 	s.mux.Handle("GET /api/v1/segments/{id}/members", sessionAuth(ql(http.HandlerFunc(s.segmentMembersHandler))))
+	s.mux.Handle("GET /api/v1/compare", sessionAuth(ql(http.HandlerFunc(s.compareSegmentsHandler))))
+
+	// Embeddable widgets: admins create them, any page can fetch the value.
+	s.mux.Handle("GET /api/v1/widgets", sessionAuth(http.HandlerFunc(s.listWidgetsHandler)))
+	s.mux.Handle("POST /api/v1/widgets", sessionAuth(http.HandlerFunc(s.createWidgetHandler)))
+	s.mux.Handle("DELETE /api/v1/widgets/{id}", sessionAuth(http.HandlerFunc(s.deleteWidgetHandler)))
+	s.sdkRoute("GET /api/v1/embed/widget", http.HandlerFunc(s.embedWidgetHandler)) // no session auth — signed widget token
 
 	// Conversion Goals.
 	s.mux.Handle("GET /api/v1/conversion-goals", sessionAuth(http.HandlerFunc(s.listConversionGoalsHandler)))
@@ -386,8 +603,23 @@ func (s *Server) routes() {
 	if !s.config.CloudMode || s.config.ControlPlaneURL != "" {
 		s.mux.Handle("GET /api/v1/export", sessionAuth(http.HandlerFunc(s.exportHandler)))
 		s.mux.Handle("POST /api/v1/import", sessionAuth(http.HandlerFunc(s.importHandler)))
+
+		// Schema migration status / re-run, gated the same way as backups.
+		s.mux.Handle("GET /api/v1/admin/migrations", sessionAuth(http.HandlerFunc(s.migrationsHandler)))
+		s.mux.Handle("POST /api/v1/admin/migrations/run", sessionAuth(http.HandlerFunc(s.runMigrationsHandler)))
+		s.mux.Handle("POST /api/v1/admin/migrations/rollback", sessionAuth(http.HandlerFunc(s.rollbackMigrationHandler)))
 	}
 
+	// Demo data: synthetic events for exploring an empty project, and their purge.
+	s.mux.Handle("POST /api/v1/admin/seed-demo", sessionAuth(http.HandlerFunc(s.seedDemoHandler)))
+	s.mux.Handle("DELETE /api/v1/admin/seed-demo", sessionAuth(http.HandlerFunc(s.purgeDemoHandler)))
+	s.mux.Handle("POST /api/v1/admin/recompute-fingerprints", sessionAuth(http.HandlerFunc(s.recomputeFingerprintsHandler)))
+	s.mux.Handle("GET /api/v1/admin/recompute-fingerprints", sessionAuth(http.HandlerFunc(s.fingerprintJobHandler)))
+
+	// Monthly event quota for multi-project hosting.
+	s.mux.Handle("GET /api/v1/admin/quota", sessionAuth(http.HandlerFunc(s.getQuotaHandler)))
+	s.mux.Handle("PUT /api/v1/admin/quota", sessionAuth(http.HandlerFunc(s.putQuotaHandler)))
+
 	// Storage stats.
 	s.mux.Handle("GET /api/v1/storage", sessionAuth(http.HandlerFunc(s.storageHandler)))
 
@@ -429,16 +661,10 @@ func (s *Server) routes() {
 		})
 	}
 
-	// SDK JS file served at /sdk.js.
-	s.mux.HandleFunc("GET /sdk.js", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/javascript")
-		w.Header().Set("Cache-Control", "public, max-age=3600")
-		if s.config.SDKJS != nil {
-			w.Write(s.config.SDKJS)
-		} else {
-			fmt.Fprint(w, "/* ClickNest SDK - build with 'make sdk' */")
-		}
-	})
+	// SDK JS: /sdk.js is the latest alias, /sdk.<hash>.js the immutable copy.
+	s.sdkRoute("GET /sdk.js", http.HandlerFunc(s.sdkLatestHandler))
+	s.sdkRoute("GET "+s.sdk.path, http.HandlerFunc(s.sdkHashedHandler))
+	s.sdkRoute("GET /api/v1/sdk", http.HandlerFunc(s.sdkInfoHandler))
 
 	// Public config (tells the frontend about cloud mode).
 	s.mux.HandleFunc("GET /api/v1/config", func(w http.ResponseWriter, r *http.Request) {
@@ -488,6 +714,9 @@ func (s *Server) Start() error {
 		ticker := time.NewTicker(1 * time.Hour)
 		for range ticker.C {
 			s.eventLimiter.Cleanup(1 * time.Hour)
+			s.chatLimiter.Cleanup(1 * time.Hour)
+			s.embedLimiter.Cleanup(1 * time.Hour)
+			s.flagLimiter.Cleanup(1 * time.Hour)
 		}
 	}()
 	return s.server.ListenAndServe()
@@ -502,7 +731,7 @@ func (s *Server) Shutdown(ctx context.Context) error {
 func (s *Server) liveEventsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -518,80 +747,108 @@ func (s *Server) liveEventsHandler(w http.ResponseWriter, r *http.Request) {
 	rc := http.NewResponseController(w)
 	rc.SetWriteDeadline(time.Time{})
 
+	widgets, err := parseLiveWidgets(r.URL.Query().Get("widgets"))
+	if err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	ticker := time.NewTicker(2 * time.Second)
-	defer ticker.Stop()
-
-	heartbeat := time.NewTicker(15 * time.Second)
-	defer heartbeat.Stop()
-
-	lastCheck := time.Now().UTC()
+	if _, err := fmt.Fprintf(w, "retry: %d\n\n", s.config.LiveRetry.Milliseconds()); err != nil {
+		return
+	}
+	flusher.Flush()
 
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case <-heartbeat.C:
-			// SSE comment to keep connection alive and detect dead clients.
-			if _, err := fmt.Fprint(w, ":heartbeat\n\n"); err != nil {
-				return
-			}
-			flusher.Flush()
-		case <-ticker.C:
-			events, err := s.events.QueryEvents(r.Context(), storage.EventFilter{
-				ProjectID: project.ID,
-				StartTime: lastCheck,
-				Limit:     50,
-			})
-			if err != nil {
-				continue
-			}
-			lastCheck = time.Now().UTC()
+	s.streamLive(r.Context(), liveFilter(r, project.ID), liveResumePoint(r), widgets, sseSink{w: w, flusher: flusher})
+}
 
-			if len(events) > 0 {
-				data, err := json.Marshal(events)
-				if err != nil {
-					return
-				}
-				if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
-					return
-				}
-				flusher.Flush()
-			}
-		}
-	}
+// listedName is an event name as returned by the names list, flagged when the
+// AI was unsure of it.
+type listedName struct {
+	storage.EventName
+	LowConfidence bool `json:"low_confidence"`
 }
 
+// listNamesHandler lists the project's event names. Query parameters:
+// min_confidence drops AI names scored below it, low_confidence=true keeps
+// only flagged names, and sort=confidence orders least confident first
+// (default is newest first). A name is low confidence when it has no user
+// override and its score is under the project's threshold.
 func (s *Server) listNamesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	minConfidence := -1.0
+	if v := q.Get("min_confidence"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			apierror.Error(w, "min_confidence must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		minConfidence = f
+	}
+	onlyLow := q.Get("low_confidence") == "true"
+	sortBy := q.Get("sort")
+	if sortBy != "" && sortBy != "confidence" && sortBy != "created_at" {
+		apierror.Error(w, "sort must be confidence or created_at", http.StatusBadRequest)
 		return
 	}
 
 	names, err := s.meta.ListEventNames(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 
+	threshold := s.meta.NameConfidenceThreshold(r.Context(), project.ID)
+	result := make([]listedName, 0, len(names))
+	for _, en := range names {
+		low := en.UserName == nil && en.Confidence != nil && *en.Confidence < threshold
+		if onlyLow && !low {
+			continue
+		}
+		if minConfidence >= 0 && en.UserName == nil && en.Confidence != nil && *en.Confidence < minConfidence {
+			continue
+		}
+		result = append(result, listedName{EventName: en, LowConfidence: low})
+	}
+	if sortBy == "confidence" {
+		// Unscored names sort last; ties keep newest first.
+		score := func(n listedName) float64 {
+			if n.Confidence == nil {
+				return 2
+			}
+			return *n.Confidence
+		}
+		slices.SortStableFunc(result, func(a, b listedName) int {
+			return cmp.Compare(score(a), score(b))
+		})
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"names": names})
+	json.NewEncoder(w).Encode(map[string]any{
+		"names":                    result,
+		"low_confidence_threshold": threshold,
+	})
 }
 
 func (s *Server) overrideNameHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	fp := r.PathValue("fp")
 	if fp == "" {
-		http.Error(w, `{"error":"fingerprint required"}`, http.StatusBadRequest)
+		apierror.Error(w, "fingerprint required", http.StatusBadRequest)
 		return
 	}
 
@@ -599,12 +856,12 @@ func (s *Server) overrideNameHandler(w http.ResponseWriter, r *http.Request) {
 		Name string `json:"name"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
-		http.Error(w, `{"error":"name is required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name is required", http.StatusBadRequest)
 		return
 	}
 
 	if err := s.meta.OverrideEventName(r.Context(), project.ID, fp, body.Name); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -612,10 +869,614 @@ func (s *Server) overrideNameHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
 
+// nameElementHandler returns the DOM context behind a fingerprint — tag, id,
+// classes, text and a sample URL from its most recent event — so users can
+// see what they are naming.
+func (s *Server) nameElementHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fp := r.PathValue("fp")
+	e, err := s.events.FingerprintElement(r.Context(), project.ID, fp)
+	if err != nil {
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+		return
+	}
+	if e == nil {
+		apierror.Error(w, "fingerprint not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"fingerprint":     fp,
+		"event_type":      e.EventType,
+		"element_tag":     e.ElementTag,
+		"element_id":      e.ElementID,
+		"element_classes": e.ElementClasses,
+		"element_text":    e.ElementText,
+		"aria_label":      e.AriaLabel,
+		"parent_path":     e.ParentPath,
+		"url":             e.URL,
+		"url_path":        e.URLPath,
+		"page_title":      e.PageTitle,
+	})
+}
+
+// listPendingNamesHandler returns AI names awaiting review.
+func (s *Server) listPendingNamesHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	names, err := s.meta.ListEventNamesByStatus(r.Context(), project.ID, storage.NamePending)
+	if err != nil {
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+		return
+	}
+	if names == nil {
+		names = []storage.EventName{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"names": names})
+}
+
+// approveNameHandler makes a reviewed AI name live and backfills it onto
+// existing events.
+func (s *Server) approveNameHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	fp := r.PathValue("fp")
+	en, err := s.meta.GetEventName(r.Context(), project.ID, fp)
+	if err != nil {
+		apierror.Error(w, "name not found", http.StatusNotFound)
+		return
+	}
+	if en.Status != storage.NamePending {
+		apierror.Error(w, "only pending names can be approved", http.StatusConflict)
+		return
+	}
+	if err := s.meta.SetEventNameStatus(r.Context(), project.ID, fp, storage.NameApproved); err != nil {
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	if err := s.events.BackfillEventName(r.Context(), project.ID, fp, en.AIName); err != nil {
+		log.Printf("WARN backfilling approved name for %s: %v", fp, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// rejectNameHandler rejects a reviewed AI name. By default the fingerprint is
+// left unnamed; with {"requeue": true} the name is discarded and the
+// fingerprint is queued to be named again.
+func (s *Server) rejectNameHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body struct {
+		Requeue bool `json:"requeue"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
+			return
+		}
+	}
+
+	fp := r.PathValue("fp")
+	if _, err := s.meta.GetEventName(r.Context(), project.ID, fp); err != nil {
+		apierror.Error(w, "name not found", http.StatusNotFound)
+		return
+	}
+
+	if body.Requeue {
+		if err := s.meta.DeleteEventName(r.Context(), project.ID, fp); err != nil {
+			apierror.Error(w, "update failed", http.StatusInternalServerError)
+			return
+		}
+		if s.namer != nil {
+			go s.namer.Backfill(context.Background(), project.ID)
+		}
+	} else if err := s.meta.SetEventNameStatus(r.Context(), project.ID, fp, storage.NameRejected); err != nil {
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+func (s *Server) getNameReviewSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"require_review":           s.meta.NameReviewEnabled(r.Context(), project.ID),
+		"low_confidence_threshold": s.meta.NameConfidenceThreshold(r.Context(), project.ID),
+	})
+}
+
+func (s *Server) putNameReviewSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	// Both fields are optional so either can be changed on its own.
+	var body struct {
+		RequireReview          *bool    `json:"require_review"`
+		LowConfidenceThreshold *float64 `json:"low_confidence_threshold"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if t := body.LowConfidenceThreshold; t != nil && (*t < 0 || *t > 1) {
+		apierror.Error(w, "low_confidence_threshold must be between 0 and 1", http.StatusBadRequest)
+		return
+	}
+	if body.RequireReview != nil {
+		val := "false"
+		if *body.RequireReview {
+			val = "true"
+		}
+		if err := s.meta.SetGrowthSetting(r.Context(), project.ID, storage.NameReviewSetting, val); err != nil {
+			apierror.Error(w, "save failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	if t := body.LowConfidenceThreshold; t != nil {
+		val := strconv.FormatFloat(*t, 'f', -1, 64)
+		if err := s.meta.SetGrowthSetting(r.Context(), project.ID, storage.NameConfidenceSetting, val); err != nil {
+			apierror.Error(w, "save failed", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getPathRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"rules":    s.meta.GetPathRules(r.Context(), project.ID),
+		"defaults": storage.DefaultPathRules,
+	})
+}
+
+// putPathRulesHandler replaces the project's URL path normalization rules.
+// Sending "rules": null restores the defaults.
+func (s *Server) putPathRulesHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		Rules []storage.PathRule `json:"rules"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := storage.ValidatePathRules(body.Rules); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.meta.SetPathRules(r.Context(), project.ID, body.Rules); err != nil {
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getPromotedPropertiesHandler lists the property keys whose filters are
+// served from the property index.
+func (s *Server) getPromotedPropertiesHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	keys, err := s.events.PromotedProperties(r.Context(), project.ID)
+	if err != nil {
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"properties": keys})
+}
+
+// putPromotedPropertiesHandler replaces the project's promoted properties.
+// Newly promoted keys are backfilled from existing events before returning.
+func (s *Server) putPromotedPropertiesHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		Properties []string `json:"properties"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := storage.ValidatePromotedProperties(body.Properties); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.events.SetPromotedProperties(r.Context(), project.ID, body.Properties); err != nil {
+		log.Printf("ERROR promoting properties for %s: %v", project.ID, err)
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) getSamplingHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"sample_rate": s.meta.SampleRate(r.Context(), project.ID),
+	})
+}
+
+// putSamplingHandler sets the fraction of sessions kept at ingest. Sampling is
+// by session, so funnels and paths within kept sessions stay complete.
+func (s *Server) putSamplingHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		SampleRate float64 `json:"sample_rate"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if body.SampleRate <= 0 || body.SampleRate > 1 {
+		apierror.Error(w, "sample_rate must be greater than 0 and at most 1", http.StatusBadRequest)
+		return
+	}
+	val := strconv.FormatFloat(body.SampleRate, 'f', -1, 64)
+	if err := s.meta.SetGrowthSetting(r.Context(), project.ID, storage.SampleRateSetting, val); err != nil {
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getBotFiltersHandler returns the project's ingest-time user-agent exclusion
+// list and how many events it has discarded since the server started.
+func (s *Server) getBotFiltersHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"filters":   s.meta.GetBotFilters(r.Context(), project.ID),
+		"discarded": s.ingest.Discarded(project.ID),
+	})
+}
+
+// putBotFiltersHandler replaces the exclusion list. Entries are
+// case-insensitive substrings, or regexes written as /pattern/. Unlike
+// query-time filtering, matching events are never stored.
+func (s *Server) putBotFiltersHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		Filters []string `json:"filters"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if _, err := storage.CompileBotFilters(body.Filters); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.meta.SetBotFilters(r.Context(), project.ID, body.Filters); err != nil {
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getNamingEventTypesHandler returns the event types ingest submits for AI
+// naming; null means the default of everything but pageviews and
+// performance events.
+func (s *Server) getNamingEventTypesHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"event_types": s.meta.NamingEventTypes(r.Context(), project.ID),
+	})
+}
+
+// putNamingEventTypesHandler replaces the event types eligible for naming. A
+// null list restores the default; an empty one turns naming off. Events
+// already named keep their names.
+func (s *Server) putNamingEventTypesHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		EventTypes []string `json:"event_types"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := storage.ValidateNamingEventTypes(body.EventTypes); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.meta.SetNamingEventTypes(r.Context(), project.ID, body.EventTypes); err != nil {
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getInternalTrafficHandler returns the project's internal traffic rule.
+func (s *Server) getInternalTrafficHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.meta.InternalTraffic(r.Context(), project.ID))
+}
+
+// putInternalTrafficHandler replaces the internal traffic rule. Unlike bot
+// filters, matching events are still stored, tagged internal=true, and
+// "exclude" only controls whether analytics queries count them.
+func (s *Server) putInternalTrafficHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body storage.InternalTrafficRule
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := body.Validate(); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := s.meta.SetInternalTraffic(r.Context(), project.ID, body); err != nil {
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// excludeInternal applies the project's internal traffic rule to the request
+// context so analytics queries leave internal events out when it is active.
+func (s *Server) excludeInternal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if project := auth.ProjectFromContext(r.Context()); project != nil {
+			r = r.WithContext(storage.WithInternalExclusion(r.Context(), s.meta.InternalTraffic(r.Context(), project.ID)))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) getTimezoneHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"timezone": s.meta.Timezone(r.Context(), project.ID).String(),
+	})
+}
+
+// putTimezoneHandler sets the IANA timezone the project's dashboards bucket
+// days, weeks and months in. An empty name resets it to UTC.
+func (s *Server) putTimezoneHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := s.meta.SetTimezone(r.Context(), project.ID, body.Timezone); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// applyTimezone puts the location time-bucketed queries use on the request
+// context: the ?tz= parameter when given, otherwise the project's default.
+func (s *Server) applyTimezone(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		project := auth.ProjectFromContext(r.Context())
+		if project == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var loc *time.Location
+		if tz := r.URL.Query().Get("tz"); tz != "" {
+			l, err := time.LoadLocation(tz)
+			if err != nil {
+				apierror.Error(w, "unknown timezone "+strconv.Quote(tz), http.StatusBadRequest)
+				return
+			}
+			loc = l
+		} else {
+			loc = s.meta.Timezone(r.Context(), project.ID)
+		}
+		next.ServeHTTP(w, r.WithContext(storage.WithLocation(r.Context(), loc)))
+	})
+}
+
+func (s *Server) getPrimaryEventHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"event_name": s.meta.PrimaryEvent(r.Context(), project.ID),
+	})
+}
+
+// putPrimaryEventHandler sets the event name the overview and AI chat treat as
+// the project's north star. An empty name clears it.
+func (s *Server) putPrimaryEventHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		EventName string `json:"event_name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(body.EventName)
+	if len(name) > 200 {
+		apierror.Error(w, "event_name must be at most 200 characters", http.StatusBadRequest)
+		return
+	}
+	if err := s.meta.SetGrowthSetting(r.Context(), project.ID, storage.PrimaryEventSetting, name); err != nil {
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// primaryEventKPI is the week-over-week trend of a project's primary event.
+type primaryEventKPI struct {
+	EventName     string               `json:"event_name"`
+	Total         int64                `json:"total"`
+	PreviousTotal int64                `json:"previous_total"`
+	Trend         []storage.TrendPoint `json:"trend"`
+}
+
+// changePct returns the change against the previous 7 days as a whole
+// percentage, and false when there is no previous volume to compare with.
+func (k *primaryEventKPI) changePct() (int64, bool) {
+	if k.PreviousTotal == 0 {
+		return 0, false
+	}
+	return 100 * (k.Total - k.PreviousTotal) / k.PreviousTotal, true
+}
+
+// primaryEventSummary computes the primary event's daily counts for the 7 days
+// ending at now and its total for the 7 days before that. It returns nil when
+// the project has no primary event configured.
+func (s *Server) primaryEventSummary(ctx context.Context, projectID string, now time.Time) (*primaryEventKPI, error) {
+	name := s.meta.PrimaryEvent(ctx, projectID)
+	if name == "" {
+		return nil, nil
+	}
+	weekAgo := now.Add(-7 * 24 * time.Hour)
+	trend, err := s.events.QueryTrends(ctx, projectID, "day", "", name, weekAgo, now)
+	if err != nil {
+		return nil, err
+	}
+	prev, err := s.events.QueryTrends(ctx, projectID, "day", "", name, weekAgo.Add(-7*24*time.Hour), weekAgo)
+	if err != nil {
+		return nil, err
+	}
+	kpi := &primaryEventKPI{EventName: name, Trend: trend}
+	for _, p := range trend {
+		kpi.Total += p.Count
+	}
+	for _, p := range prev {
+		kpi.PreviousTotal += p.Count
+	}
+	if kpi.Trend == nil {
+		kpi.Trend = []storage.TrendPoint{}
+	}
+	return kpi, nil
+}
+
+// overviewHandler returns the headline KPIs for the dashboard home page.
+// primary_event is null until the project configures one.
+func (s *Server) overviewHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	kpi, err := s.primaryEventSummary(r.Context(), project.ID, time.Now().UTC())
+	if err != nil {
+		if r.Context().Err() != nil {
+			return
+		}
+		log.Printf("ERROR overview: %v", err)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"primary_event": kpi,
+	})
+}
+
 func (s *Server) projectHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -626,18 +1487,18 @@ func (s *Server) projectHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) updateProjectDescriptionHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
 		Description string `json:"description"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if err := s.meta.UpdateProjectDescription(r.Context(), project.ID, body.Description); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -647,7 +1508,7 @@ func (s *Server) updateProjectDescriptionHandler(w http.ResponseWriter, r *http.
 func (s *Server) getLLMConfigHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -660,6 +1521,7 @@ func (s *Server) getLLMConfigHandler(w http.ResponseWriter, r *http.Request) {
 			"model":    "",
 			"base_url": "",
 			"api_key_set": false,
+			"naming_style": ai.StyleSentence,
 		})
 		return
 	}
@@ -692,6 +1554,11 @@ func (s *Server) getLLMConfigHandler(w http.ResponseWriter, r *http.Request) {
 	// so the frontend can hide the configuration form.
 	isManaged := os.Getenv("DEFAULT_LLM_API_KEY") != "" && cfg.APIKey != nil && *cfg.APIKey == os.Getenv("DEFAULT_LLM_API_KEY")
 
+	namingStyle := cfg.NamingStyle
+	if namingStyle == "" {
+		namingStyle = ai.StyleSentence
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]any{
 		"provider":     cfg.Provider,
@@ -700,33 +1567,43 @@ func (s *Server) getLLMConfigHandler(w http.ResponseWriter, r *http.Request) {
 		"api_key_set":  apiKeySet,
 		"api_key_hint": apiKeyHint,
 		"is_managed":   isManaged,
+		"naming_style": namingStyle,
 	})
 }
 
 func (s *Server) llmConfigHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	var config storage.LLMConfig
 	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	config.ProjectID = project.ID
+	if !ai.ValidNamingStyle(config.NamingStyle) {
+		apierror.Error(w, "naming_style must be sentence, snake_case, or dot.notation", http.StatusBadRequest)
+		return
+	}
 
-	// If no new API key was provided, preserve the existing one.
-	if config.APIKey == nil || *config.APIKey == "" {
+	// If no new API key or naming style was provided, preserve the existing one.
+	if config.APIKey == nil || *config.APIKey == "" || config.NamingStyle == "" {
 		existing, err := s.meta.GetLLMConfig(r.Context(), project.ID)
 		if err == nil && existing != nil {
-			config.APIKey = existing.APIKey
+			if config.APIKey == nil || *config.APIKey == "" {
+				config.APIKey = existing.APIKey
+			}
+			if config.NamingStyle == "" {
+				config.NamingStyle = existing.NamingStyle
+			}
 		}
 	}
 
 	if err := s.meta.SetLLMConfig(r.Context(), config); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -750,7 +1627,7 @@ func (s *Server) llmConfigHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) reanalyzeEventsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -760,16 +1637,24 @@ func (s *Server) reanalyzeEventsHandler(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(map[string]string{"status": "reanalyzing"})
 }
 
+// llmNotConfigured answers an AI request for a project without an LLM
+// provider. It has its own code and status so the dashboard can prompt for
+// setup instead of reporting a failure; errors from a configured provider
+// stay 500s.
+func llmNotConfigured(w http.ResponseWriter) {
+	apierror.ErrorCode(w, apierror.CodeLLMNotConfigured, "LLM not configured. Go to Settings to add an AI provider.", http.StatusServiceUnavailable)
+}
+
 func (s *Server) suggestFunnelsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	cfg, err := s.meta.GetLLMConfig(r.Context(), project.ID)
 	if err != nil || cfg.Provider == "" {
-		http.Error(w, `{"error":"LLM not configured. Go to Settings to configure an AI provider."}`, http.StatusBadRequest)
+		llmNotConfigured(w)
 		return
 	}
 
@@ -778,11 +1663,11 @@ func (s *Server) suggestFunnelsHandler(w http.ResponseWriter, r *http.Request) {
 	sequences, err := s.events.QueryTopSequences(r.Context(), project.ID, start, end, 20)
 	if err != nil {
 		log.Printf("ERROR querying top sequences: %v", err)
-		http.Error(w, `{"error":"failed to query event sequences"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to query event sequences", http.StatusInternalServerError)
 		return
 	}
 	if len(sequences) == 0 {
-		http.Error(w, `{"error":"Not enough event data to suggest funnels. Record more events first."}`, http.StatusBadRequest)
+		apierror.Error(w, "Not enough event data to suggest funnels. Record more events first.", http.StatusBadRequest)
 		return
 	}
 
@@ -819,7 +1704,7 @@ func (s *Server) suggestFunnelsHandler(w http.ResponseWriter, r *http.Request) {
 	suggestions, err := ai.SuggestFunnels(r.Context(), cfg, sequences, productDesc, namedEvents, sourceFiles, repoDir)
 	if err != nil {
 		log.Printf("ERROR suggesting funnels: %v", err)
-		http.Error(w, `{"error":"AI suggestion failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "AI suggestion failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -830,22 +1715,55 @@ func (s *Server) suggestFunnelsHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) aiChatHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	var body struct {
+		Message string           `json:"message"`
+		History []ai.ChatMessage `json:"history"`
+		Stream  bool             `json:"stream"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, int64(s.config.ChatMaxMessageLength)*int64(s.config.ChatMaxHistory+1)+64*1024)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(body.Message) == "" {
+		apierror.Error(w, "message is required", http.StatusBadRequest)
+		return
+	}
+	if len(body.Message) > s.config.ChatMaxMessageLength {
+		apierror.Error(w, fmt.Sprintf("message exceeds %d characters", s.config.ChatMaxMessageLength), http.StatusBadRequest)
+		return
+	}
+	if len(body.History) > s.config.ChatMaxHistory {
+		apierror.Error(w, fmt.Sprintf("history exceeds %d messages", s.config.ChatMaxHistory), http.StatusBadRequest)
+		return
+	}
+	for _, m := range body.History {
+		if len(m.Content) > s.config.ChatMaxMessageLength {
+			apierror.Error(w, fmt.Sprintf("history message exceeds %d characters", s.config.ChatMaxMessageLength), http.StatusBadRequest)
+			return
+		}
+	}
+
 	cfg, err := s.meta.GetLLMConfig(r.Context(), project.ID)
 	if err != nil || cfg.Provider == "" {
-		http.Error(w, `{"error":"LLM not configured. Go to Settings to add an AI provider."}`, http.StatusBadRequest)
+		llmNotConfigured(w)
 		return
 	}
 
-	var body struct {
-		Message string            `json:"message"`
-		History []ai.ChatMessage  `json:"history"`
+	// Each chat request costs an LLM call, so throttle per user (falling back
+	// to the project when there is no user, e.g. legacy API-key sessions).
+	// Requests refused above don't reach the LLM and so don't spend a token.
+	limitKey := auth.UserIDFromContext(r.Context())
+	if limitKey == "" {
+		limitKey = "project:" + project.ID
 	}
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+	if !s.chatLimiter.Allow(limitKey) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(60/s.config.ChatRatePerMinute))))
+		apierror.Error(w, "chat rate limit exceeded", http.StatusTooManyRequests)
 		return
 	}
 
@@ -854,26 +1772,121 @@ func (s *Server) aiChatHandler(w http.ResponseWriter, r *http.Request) {
 	weekAgo := now.Add(-7 * 24 * time.Hour)
 	monthAgo := now.Add(-30 * 24 * time.Hour)
 
-	trendData, _ := s.events.QueryTrends(r.Context(), project.ID, "day", weekAgo, now)
-	topPages, _ := s.events.QueryTopPages(r.Context(), project.ID, weekAgo, now, 10)
+	trendData, _ := s.events.QueryTrends(r.Context(), project.ID, "day", "", "", weekAgo, now)
+	topPages, _ := s.events.QueryTopPages(r.Context(), project.ID, weekAgo, now, 10, nil)
 	topEvents, _ := s.events.QueryTopEventNames(r.Context(), project.ID, monthAgo, now, 10)
 
-	systemMsg := buildAnalyticsSystemPrompt(project.Description, trendData, topPages, topEvents)
+	primary, _ := s.primaryEventSummary(r.Context(), project.ID, now)
+
+	systemMsg := buildAnalyticsSystemPrompt(project.Description, primary, trendData, topPages, topEvents)
+
+	// Providers with tool calling can look up exact numbers instead of
+	// relying on the snapshot above.
+	var tools []ai.ChatTool
+	if cfg.Provider == "openai" {
+		loc := s.meta.Timezone(r.Context(), project.ID)
+		tools = s.chatTools(project.ID, loc)
+		systemMsg += fmt.Sprintf("\n\nUse the tools to look up exact counts for specific dates or events. Today is %s in the project's timezone (%s).",
+			now.In(loc).Format("Monday 2006-01-02"), loc)
+	}
 
 	history := append(body.History, ai.ChatMessage{Role: "user", Content: body.Message})
+	if body.Stream {
+		s.streamChatReply(w, r, cfg, systemMsg, history, tools)
+		return
+	}
+
+	reply, err := ai.ChatWithTools(r.Context(), cfg, systemMsg, history, tools)
+	if err != nil {
+		log.Printf("ERROR ai chat: %v", err)
+		apierror.Error(w, "AI request failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"reply": reply})
+}
+
+// chatChunk is a streamed chat reply frame, shaped like OpenAI's
+// chat.completion.chunk so OpenAI-compatible clients can read the stream.
+type chatChunk struct {
+	Object  string            `json:"object"`
+	Created int64             `json:"created"`
+	Model   string            `json:"model"`
+	Choices []chatChunkChoice `json:"choices"`
+}
+
+type chatChunkChoice struct {
+	Index        int               `json:"index"`
+	Delta        map[string]string `json:"delta"`
+	FinishReason *string           `json:"finish_reason"`
+}
 
-	reply, err := ai.ChatWithHistory(r.Context(), cfg, systemMsg, history)
+// streamChatReply writes the chat reply as server-sent events: a chunk per
+// token delta, a final chunk with finish_reason "stop", then data: [DONE].
+// A failure before the stream starts is an ordinary error response; one
+// partway through is sent as a data frame holding an API error body.
+func (s *Server) streamChatReply(w http.ResponseWriter, r *http.Request, cfg *storage.LLMConfig, systemMsg string, history []ai.ChatMessage, tools []ai.ChatTool) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		apierror.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	deltas, err := ai.ChatWithToolsStream(r.Context(), cfg, systemMsg, history, tools)
 	if err != nil {
 		log.Printf("ERROR ai chat: %v", err)
-		http.Error(w, `{"error":"AI request failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+		apierror.Error(w, "AI request failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A long reply can outlast the server's WriteTimeout, as the live feed
+	// would.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	write := func(v any) bool {
+		b, _ := json.Marshal(v)
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", b); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	chunk := func(delta map[string]string, finish *string) chatChunk {
+		return chatChunk{
+			Object:  "chat.completion.chunk",
+			Created: time.Now().Unix(),
+			Model:   cfg.Model,
+			Choices: []chatChunkChoice{{Delta: delta, FinishReason: finish}},
+		}
+	}
+
+	for d := range deltas {
+		if d.Err != nil {
+			log.Printf("ERROR ai chat stream: %v", d.Err)
+			write(apierror.Body{Error: apierror.Detail{
+				Code: apierror.CodeUpstream, Message: "AI request failed: " + d.Err.Error(),
+			}})
+			return
+		}
+		if !write(chunk(map[string]string{"content": d.Text}, nil)) {
+			return
+		}
+	}
+	if r.Context().Err() != nil {
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"reply": reply})
+	stop := "stop"
+	write(chunk(map[string]string{}, &stop))
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
 }
 
-func buildAnalyticsSystemPrompt(projectDescription string, trends []storage.TrendPoint, pages []storage.PageStat, events []storage.EventNameStat) string {
+func buildAnalyticsSystemPrompt(projectDescription string, primary *primaryEventKPI, trends []storage.TrendPoint, pages []storage.PageStat, events []storage.EventNameStat) string {
 	var b strings.Builder
 	b.WriteString("You are an analytics assistant embedded in ClickNest, a product analytics dashboard. ")
 	b.WriteString("You have access to real analytics data from the user's product. ")
@@ -886,6 +1899,24 @@ func buildAnalyticsSystemPrompt(projectDescription string, trends []storage.Tren
 		b.WriteString("\n\n")
 	}
 
+	// The primary event goes first: it is the number the user cares most about,
+	// so the assistant should lead with it.
+	if primary != nil {
+		fmt.Fprintf(&b, "PRIMARY EVENT (the product's key metric): %q — %d in the last 7 days", primary.EventName, primary.Total)
+		if pct, ok := primary.changePct(); ok {
+			fmt.Fprintf(&b, ", %+d%% vs the previous 7 days", pct)
+		}
+		b.WriteString("\n")
+		if len(primary.Trend) > 0 {
+			b.WriteString("Daily:")
+			for _, p := range primary.Trend {
+				fmt.Fprintf(&b, " %s=%d", strings.SplitN(p.Bucket, " ", 2)[0], p.Count)
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("Relate your answers to this event where relevant.\n\n")
+	}
+
 	if len(trends) > 0 {
 		total := int64(0)
 		for _, p := range trends {
@@ -926,7 +1957,7 @@ func buildAnalyticsSystemPrompt(projectDescription string, trends []storage.Tren
 func (s *Server) githubGetHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -957,7 +1988,7 @@ func (s *Server) githubGetHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) githubConnectHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -968,7 +1999,7 @@ func (s *Server) githubConnectHandler(w http.ResponseWriter, r *http.Request) {
 		DefaultBranch string `json:"default_branch"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	// If no token provided, reuse existing OAuth token from a prior connection.
@@ -979,7 +2010,7 @@ func (s *Server) githubConnectHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if body.RepoOwner == "" || body.RepoName == "" || body.AccessToken == "" {
-		http.Error(w, `{"error":"repo_owner, repo_name, and access_token are required"}`, http.StatusBadRequest)
+		apierror.Error(w, "repo_owner, repo_name, and access_token are required", http.StatusBadRequest)
 		return
 	}
 	if body.DefaultBranch == "" {
@@ -989,7 +2020,7 @@ func (s *Server) githubConnectHandler(w http.ResponseWriter, r *http.Request) {
 	// Verify the token works by listing the repo root.
 	client := ghub.NewClient(body.AccessToken)
 	if _, err := client.ListDirectory(r.Context(), body.RepoOwner, body.RepoName, "", body.DefaultBranch); err != nil {
-		http.Error(w, `{"error":"failed to access repo: `+err.Error()+`"}`, http.StatusBadRequest)
+		apierror.Error(w, "failed to access repo: "+err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -1001,7 +2032,7 @@ func (s *Server) githubConnectHandler(w http.ResponseWriter, r *http.Request) {
 		DefaultBranch: body.DefaultBranch,
 	}
 	if err := s.meta.SetGitHubConnection(r.Context(), conn); err != nil {
-		http.Error(w, `{"error":"save failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -1036,26 +2067,26 @@ func (s *Server) githubOAuthEnabledHandler(w http.ResponseWriter, r *http.Reques
 
 func (s *Server) githubOAuthAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
 	if s.config.GitHubClientID == "" {
-		http.Error(w, `{"error":"oauth not configured"}`, http.StatusBadRequest)
+		apierror.Error(w, "oauth not configured", http.StatusBadRequest)
 		return
 	}
 
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	// Generate random state token.
 	b := make([]byte, 16)
 	if _, err := rand.Read(b); err != nil {
-		http.Error(w, `{"error":"failed to generate state"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to generate state", http.StatusInternalServerError)
 		return
 	}
 	state := hex.EncodeToString(b)
 
 	if err := s.meta.SetOAuthState(r.Context(), state, project.ID); err != nil {
-		http.Error(w, `{"error":"failed to store state"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to store state", http.StatusInternalServerError)
 		return
 	}
 
@@ -1145,7 +2176,7 @@ func (s *Server) githubOAuthCallbackHandler(w http.ResponseWriter, r *http.Reque
 	}
 	if tokenResp.Error != "" || tokenResp.AccessToken == "" {
 		log.Printf("GitHub OAuth error: %s — %s", tokenResp.Error, tokenResp.ErrorDesc)
-		http.Error(w, `{"error":"GitHub denied the authorization request"}`, http.StatusBadRequest)
+		apierror.Error(w, "GitHub denied the authorization request", http.StatusBadRequest)
 		return
 	}
 
@@ -1185,12 +2216,12 @@ func (s *Server) githubOAuthCallbackHandler(w http.ResponseWriter, r *http.Reque
 func (s *Server) listFlagsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	flags, err := s.meta.ListFeatureFlags(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1200,27 +2231,67 @@ func (s *Server) listFlagsHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) createFlagHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
-		Key               string `json:"key"`
-		Name              string `json:"name"`
-		RolloutPercentage int    `json:"rollout_percentage"`
+		Key               string                  `json:"key"`
+		Name              string                  `json:"name"`
+		RolloutPercentage *int                    `json:"rollout_percentage"`
+		Conditions        []storage.FlagCondition `json:"conditions"`
+		Payload           json.RawMessage         `json:"payload"`
+		Variants          []storage.FlagVariant   `json:"variants"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Key == "" || body.Name == "" {
-		http.Error(w, `{"error":"key and name are required"}`, http.StatusBadRequest)
+		apierror.Error(w, "key and name are required", http.StatusBadRequest)
+		return
+	}
+	// An omitted rollout means everyone; an explicit 0 is a valid dark launch.
+	rollout := 100
+	if body.RolloutPercentage != nil {
+		rollout = *body.RolloutPercentage
+	}
+	if rollout < 0 || rollout > 100 {
+		apierror.Error(w, "rollout_percentage must be between 0 and 100", http.StatusBadRequest)
+		return
+	}
+	for _, c := range body.Conditions {
+		switch c.Operator {
+		case storage.FlagOpIs, storage.FlagOpIsNot, storage.FlagOpContains:
+		default:
+			apierror.Error(w, "condition operator must be is, is_not or contains", http.StatusBadRequest)
+			return
+		}
+		if c.Property == "" {
+			apierror.Error(w, "condition property is required", http.StatusBadRequest)
+			return
+		}
+	}
+	if body.Conditions == nil {
+		body.Conditions = []storage.FlagCondition{}
+	}
+	conditions, _ := json.Marshal(body.Conditions)
+	if err := storage.ValidateFlagVariants(body.Variants); err != nil {
+		apierror.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if body.Variants == nil {
+		body.Variants = []storage.FlagVariant{}
+	}
+	variants, _ := json.Marshal(body.Variants)
+	var payload string
+	if len(body.Payload) > 0 && string(body.Payload) != "null" {
+		if len(body.Payload) > maxFlagPayload {
+			apierror.Error(w, "payload is too large", http.StatusBadRequest)
+			return
+		}
+		payload = string(body.Payload)
+	}
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
-	rollout := body.RolloutPercentage
-	if rollout <= 0 {
-		rollout = 100
-	}
 	flag := storage.FeatureFlag{
 		ID:                id,
 		ProjectID:         project.ID,
@@ -1228,9 +2299,12 @@ func (s *Server) createFlagHandler(w http.ResponseWriter, r *http.Request) {
 		Name:              body.Name,
 		Enabled:           true,
 		RolloutPercentage: rollout,
+		Conditions:        string(conditions),
+		Payload:           payload,
+		Variants:          string(variants),
 	}
 	if err := s.meta.CreateFeatureFlag(r.Context(), flag); err != nil {
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1241,22 +2315,44 @@ func (s *Server) createFlagHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) updateFlagHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	var body struct {
-		Enabled           bool `json:"enabled"`
-		RolloutPercentage int  `json:"rollout_percentage"`
+		Enabled           bool                   `json:"enabled"`
+		RolloutPercentage int                    `json:"rollout_percentage"`
+		Variants          *[]storage.FlagVariant `json:"variants"` // omitted leaves them unchanged
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if body.RolloutPercentage < 0 || body.RolloutPercentage > 100 {
+		apierror.Error(w, "rollout_percentage must be between 0 and 100", http.StatusBadRequest)
 		return
 	}
+	if body.Variants != nil {
+		if err := storage.ValidateFlagVariants(*body.Variants); err != nil {
+			apierror.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 	if err := s.meta.UpdateFeatureFlag(r.Context(), project.ID, id, body.Enabled, body.RolloutPercentage); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
+	if body.Variants != nil {
+		vs := *body.Variants
+		if vs == nil {
+			vs = []storage.FlagVariant{}
+		}
+		variants, _ := json.Marshal(vs)
+		if err := s.meta.SetFeatureFlagVariants(r.Context(), project.ID, id, string(variants)); err != nil {
+			apierror.Error(w, "update failed", http.StatusInternalServerError)
+			return
+		}
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
 }
@@ -1264,42 +2360,78 @@ func (s *Server) updateFlagHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) deleteFlagHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.DeleteFeatureFlag(r.Context(), project.ID, id); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// maxFlagPayload bounds the JSON payload stored on a feature flag.
+const maxFlagPayload = 8 << 10
+
+// evaluatedFlag is one flag in the evaluate response. Payload and Variant are
+// only set when the flag is on.
+type evaluatedFlag struct {
+	Enabled bool            `json:"enabled"`
+	Payload json.RawMessage `json:"payload"`
+	Variant string          `json:"variant,omitempty"`
+}
+
+// evaluateFlagsHandler handles GET /api/v1/flags/evaluate. Each flag comes back
+// as {"enabled", "payload", "variant"}; format=simple returns the older
+// key → bool map. log_exposure=true also records which variant of each flag
+// the user got (see logExposures). Other query parameters besides
+// distinct_id, format and log_exposure are user properties for flag
+// conditions.
 func (s *Server) evaluateFlagsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
-	distinctID := r.URL.Query().Get("distinct_id")
+	q := r.URL.Query()
+	distinctID := q.Get("distinct_id")
 	flags, err := s.meta.ListFeatureFlags(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
-	result := make(map[string]bool, len(flags))
+	simple := make(map[string]bool, len(flags))
 	for _, f := range flags {
-		if !f.Enabled {
-			result[f.Key] = false
+		if !f.Enabled || !flagConditionsMatch(f, q) {
+			simple[f.Key] = false
 			continue
 		}
 		if f.RolloutPercentage >= 100 {
-			result[f.Key] = true
+			simple[f.Key] = true
 			continue
 		}
 		h := fnv.New32a()
 		h.Write([]byte(distinctID + ":" + f.ID))
-		result[f.Key] = int(h.Sum32()%100) < f.RolloutPercentage
+		simple[f.Key] = int(h.Sum32()%100) < f.RolloutPercentage
+	}
+	if q.Get("log_exposure") == "true" {
+		s.logExposures(project.ID, distinctID, flags, simple)
+	}
+	var result any = simple
+	if q.Get("format") != "simple" {
+		full := make(map[string]evaluatedFlag, len(flags))
+		for _, f := range flags {
+			ef := evaluatedFlag{Enabled: simple[f.Key]}
+			if ef.Enabled && f.Payload != "" {
+				ef.Payload = json.RawMessage(f.Payload)
+			}
+			if ef.Enabled {
+				ef.Variant = flagVariant(f, distinctID)
+			}
+			full[f.Key] = ef
+		}
+		result = full
 	}
 
 	// Enrich with experiment variant assignments.
@@ -1328,17 +2460,98 @@ func (s *Server) evaluateFlagsHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{"flags": result, "experiments": experiments})
 }
 
+// Logged exposures are capped per project so high-traffic flag evaluation
+// can't flood DuckDB with writes; evaluations over the cap go unlogged.
+const (
+	exposureRatePerSecond = 20
+	exposureBurst         = 100
+)
+
+// logExposures records one $feature_flag_called event per flag with the
+// variant distinctID was assigned — the variant name for multivariate flags,
+// otherwise "on" or "off". The insert runs in the background so it never
+// delays the evaluate response.
+func (s *Server) logExposures(projectID, distinctID string, flags []storage.FeatureFlag, enabled map[string]bool) {
+	if len(flags) == 0 || !s.flagLimiter.Allow(projectID) {
+		return
+	}
+	now := time.Now().UTC()
+	name := storage.ExposureEvent
+	events := make([]storage.Event, 0, len(flags))
+	for _, f := range flags {
+		variant := "off"
+		if enabled[f.Key] {
+			variant = cmp.Or(flagVariant(f, distinctID), "on")
+		}
+		events = append(events, storage.Event{
+			ProjectID:   projectID,
+			SessionID:   "flags_" + distinctID,
+			DistinctID:  distinctID,
+			EventType:   "custom",
+			EventName:   &name,
+			Fingerprint: ingest.ComputeFingerprint("", "", "", "", ""),
+			Timestamp:   now,
+			Properties:  map[string]any{"flag_key": f.Key, "variant": variant},
+		})
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.events.InsertEvents(ctx, events); err != nil {
+			log.Printf("WARN logging flag exposures for %s: %v", projectID, err)
+		}
+	}()
+}
+
+// flagVariant assigns distinctID one of the flag's variants, or "" for a plain
+// flag. The hash is salted apart from the rollout's so variant and rollout
+// buckets are independent.
+func flagVariant(f storage.FeatureFlag, distinctID string) string {
+	if f.Variants == "" || f.Variants == "[]" {
+		return ""
+	}
+	var variants []storage.FlagVariant
+	if err := json.Unmarshal([]byte(f.Variants), &variants); err != nil {
+		log.Printf("WARN flag %s: unreadable variants: %v", f.Key, err)
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(distinctID + ":" + f.ID + ":variant"))
+	return storage.PickFlagVariant(variants, h.Sum32())
+}
+
+// flagConditionsMatch reports whether the user properties passed as query
+// parameters (e.g. ?plan=pro) satisfy all of the flag's conditions. Conditions
+// that can't be read fail closed.
+func flagConditionsMatch(f storage.FeatureFlag, props url.Values) bool {
+	if f.Conditions == "" || f.Conditions == "[]" {
+		return true
+	}
+	var conds []storage.FlagCondition
+	if err := json.Unmarshal([]byte(f.Conditions), &conds); err != nil {
+		log.Printf("WARN flag %s: unreadable conditions: %v", f.Key, err)
+		return false
+	}
+	for _, c := range conds {
+		_, present := props[c.Property]
+		if !c.Matches(props.Get(c.Property), present) {
+			return false
+		}
+	}
+	return true
+}
+
 // --- Alert handlers ---
 
 func (s *Server) listAlertsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	alerts, err := s.meta.ListAlerts(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1348,7 +2561,7 @@ func (s *Server) listAlertsHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) createAlertHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
@@ -1356,19 +2569,43 @@ func (s *Server) createAlertHandler(w http.ResponseWriter, r *http.Request) {
 		Metric        string `json:"metric"`
 		EventName     string `json:"event_name"`
 		Threshold     int    `json:"threshold"`
-		WindowMinutes int    `json:"window_minutes"`
+		WindowMinutes *int   `json:"window_minutes"`
 		WebhookURL    string `json:"webhook_url"`
+		Format        string `json:"format"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" || body.Metric == "" || body.WebhookURL == "" {
-		http.Error(w, `{"error":"name, metric, and webhook_url are required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name, metric, and webhook_url are required", http.StatusBadRequest)
+		return
+	}
+	if body.Threshold < 0 {
+		apierror.Error(w, "threshold must not be negative", http.StatusBadRequest)
+		return
+	}
+	// Only an omitted window gets the default; 0 or less is rejected.
+	window := 60
+	if body.WindowMinutes != nil {
+		window = *body.WindowMinutes
+	}
+	if window <= 0 {
+		apierror.Error(w, "window_minutes must be positive", http.StatusBadRequest)
 		return
 	}
-	if body.WindowMinutes <= 0 {
-		body.WindowMinutes = 60
+	switch body.Format {
+	case "":
+		body.Format = storage.AlertFormatJSON
+	case storage.AlertFormatJSON, storage.AlertFormatSlack:
+	default:
+		apierror.Error(w, "format must be json or slack", http.StatusBadRequest)
+		return
 	}
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	secret, err := generateID()
+	if err != nil {
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	alert := storage.Alert{
@@ -1378,12 +2615,14 @@ func (s *Server) createAlertHandler(w http.ResponseWriter, r *http.Request) {
 		Metric:        body.Metric,
 		EventName:     body.EventName,
 		Threshold:     body.Threshold,
-		WindowMinutes: body.WindowMinutes,
+		WindowMinutes: window,
 		WebhookURL:    body.WebhookURL,
 		Enabled:       true,
+		Secret:        secret,
+		Format:        body.Format,
 	}
 	if err := s.meta.CreateAlert(r.Context(), alert); err != nil {
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1394,7 +2633,7 @@ func (s *Server) createAlertHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) updateAlertHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
@@ -1404,11 +2643,15 @@ func (s *Server) updateAlertHandler(w http.ResponseWriter, r *http.Request) {
 		WebhookURL string `json:"webhook_url"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
+		return
+	}
+	if body.Threshold < 0 {
+		apierror.Error(w, "threshold must not be negative", http.StatusBadRequest)
 		return
 	}
 	if err := s.meta.UpdateAlert(r.Context(), project.ID, id, body.Enabled, body.Threshold, body.WebhookURL); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1418,12 +2661,12 @@ func (s *Server) updateAlertHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) deleteAlertHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.DeleteAlert(r.Context(), project.ID, id); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -1434,12 +2677,12 @@ func (s *Server) deleteAlertHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) listRefCodesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	codes, err := s.meta.ListRefCodes(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1449,7 +2692,7 @@ func (s *Server) listRefCodesHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) createRefCodeHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
@@ -1458,12 +2701,12 @@ func (s *Server) createRefCodeHandler(w http.ResponseWriter, r *http.Request) {
 		Notes string `json:"notes"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Code == "" || body.Name == "" {
-		http.Error(w, `{"error":"code and name are required"}`, http.StatusBadRequest)
+		apierror.Error(w, "code and name are required", http.StatusBadRequest)
 		return
 	}
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	rc := storage.RefCode{
@@ -1474,7 +2717,7 @@ func (s *Server) createRefCodeHandler(w http.ResponseWriter, r *http.Request) {
 		Notes:     body.Notes,
 	}
 	if err := s.meta.CreateRefCode(r.Context(), rc); err != nil {
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1485,7 +2728,7 @@ func (s *Server) createRefCodeHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) updateRefCodeHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
@@ -1494,11 +2737,11 @@ func (s *Server) updateRefCodeHandler(w http.ResponseWriter, r *http.Request) {
 		Notes string `json:"notes"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if err := s.meta.UpdateRefCode(r.Context(), project.ID, id, body.Name, body.Notes); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1508,12 +2751,12 @@ func (s *Server) updateRefCodeHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) deleteRefCodeHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.DeleteRefCode(r.Context(), project.ID, id); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -1524,7 +2767,7 @@ func (s *Server) deleteRefCodeHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) listPublishersHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	publishers := s.registry.ListPublishers()
@@ -1540,23 +2783,23 @@ func (s *Server) listPublishersHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) publisherPostHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	name := r.PathValue("name")
 	p := s.registry.GetPublisher(name)
 	if p == nil {
-		http.Error(w, `{"error":"publisher not found"}`, http.StatusNotFound)
+		apierror.Error(w, "publisher not found", http.StatusNotFound)
 		return
 	}
 	var body growth.PostContent
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	result, err := p.Post(r.Context(), body)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"post failed: %s"}`, err.Error()), http.StatusInternalServerError)
+		apierror.Error(w, fmt.Sprintf("post failed: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1566,19 +2809,19 @@ func (s *Server) publisherPostHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) publisherEngagementHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	name := r.PathValue("name")
 	externalID := r.PathValue("externalID")
 	p := s.registry.GetPublisher(name)
 	if p == nil {
-		http.Error(w, `{"error":"publisher not found"}`, http.StatusNotFound)
+		apierror.Error(w, "publisher not found", http.StatusNotFound)
 		return
 	}
 	metrics, err := p.FetchEngagement(r.Context(), externalID)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"fetch failed: %s"}`, err.Error()), http.StatusInternalServerError)
+		apierror.Error(w, fmt.Sprintf("fetch failed: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1588,13 +2831,13 @@ func (s *Server) publisherEngagementHandler(w http.ResponseWriter, r *http.Reque
 func (s *Server) publisherValidateHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	name := r.PathValue("name")
 	p := s.registry.GetPublisher(name)
 	if p == nil {
-		http.Error(w, `{"error":"publisher not found"}`, http.StatusNotFound)
+		apierror.Error(w, "publisher not found", http.StatusNotFound)
 		return
 	}
 	if err := p.Validate(r.Context()); err != nil {
@@ -1611,12 +2854,12 @@ func (s *Server) publisherValidateHandler(w http.ResponseWriter, r *http.Request
 func (s *Server) listCampaignsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	campaigns, err := s.meta.ListCampaigns(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -1656,7 +2899,7 @@ func (s *Server) listCampaignsHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) createCampaignHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
@@ -1665,12 +2908,12 @@ func (s *Server) createCampaignHandler(w http.ResponseWriter, r *http.Request) {
 		Content string `json:"content"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" || body.Channel == "" {
-		http.Error(w, `{"error":"name and channel are required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name and channel are required", http.StatusBadRequest)
 		return
 	}
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	if body.Content == "" {
@@ -1685,7 +2928,7 @@ func (s *Server) createCampaignHandler(w http.ResponseWriter, r *http.Request) {
 		Content:   body.Content,
 	}
 	if err := s.meta.CreateCampaign(r.Context(), c); err != nil {
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1696,13 +2939,13 @@ func (s *Server) createCampaignHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) getCampaignHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	c, err := s.meta.GetCampaign(r.Context(), project.ID, id)
 	if err != nil {
-		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		apierror.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1712,7 +2955,7 @@ func (s *Server) getCampaignHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) updateCampaignHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
@@ -1723,11 +2966,11 @@ func (s *Server) updateCampaignHandler(w http.ResponseWriter, r *http.Request) {
 		Cost    float64 `json:"cost"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if err := s.meta.UpdateCampaign(r.Context(), project.ID, id, body.Name, body.Status, body.Content, body.Cost); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -1737,12 +2980,12 @@ func (s *Server) updateCampaignHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) deleteCampaignHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.DeleteCampaign(r.Context(), project.ID, id); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -1751,20 +2994,18 @@ func (s *Server) deleteCampaignHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) generateCampaignHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	if s.config.ResourceLimitFn != nil {
 		if code, msg := s.config.ResourceLimitFn(r.Context(), project.ID, "campaigns"); code != 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(code)
-			json.NewEncoder(w).Encode(map[string]any{"error": msg, "upgrade_required": true})
+			apierror.ErrorCode(w, apierror.CodeUpgradeRequired, msg, code)
 			return
 		}
 	}
 	cfg, err := s.meta.GetLLMConfig(r.Context(), project.ID)
 	if err != nil || cfg.Provider == "" {
-		http.Error(w, `{"error":"LLM not configured. Go to Settings to add an AI provider."}`, http.StatusBadRequest)
+		llmNotConfigured(w)
 		return
 	}
 
@@ -1773,13 +3014,13 @@ func (s *Server) generateCampaignHandler(w http.ResponseWriter, r *http.Request)
 		Topic   string `json:"topic"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Channel == "" {
-		http.Error(w, `{"error":"channel is required"}`, http.StatusBadRequest)
+		apierror.Error(w, "channel is required", http.StatusBadRequest)
 		return
 	}
 
 	now := time.Now().UTC()
 	monthAgo := now.Add(-30 * 24 * time.Hour)
-	topPages, _ := s.events.QueryTopPages(r.Context(), project.ID, monthAgo, now, 10)
+	topPages, _ := s.events.QueryTopPages(r.Context(), project.ID, monthAgo, now, 10, nil)
 	topEvents, _ := s.events.QueryTopEventNames(r.Context(), project.ID, monthAgo, now, 10)
 
 	// Auto-create a ref code for tracking.
@@ -1810,7 +3051,7 @@ func (s *Server) generateCampaignHandler(w http.ResponseWriter, r *http.Request)
 	content, err := ai.GenerateCampaign(r.Context(), cfg, cc)
 	if err != nil {
 		log.Printf("ERROR campaign generation: %v", err)
-		http.Error(w, `{"error":"AI generation failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+		apierror.Error(w, "AI generation failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -1828,7 +3069,7 @@ func (s *Server) generateCampaignHandler(w http.ResponseWriter, r *http.Request)
 		AIPrompt:  body.Topic,
 	}
 	if err := s.meta.CreateCampaign(r.Context(), campaign); err != nil {
-		http.Error(w, `{"error":"save failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -1843,19 +3084,19 @@ func (s *Server) generateCampaignHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) abTestHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	cfg, err := s.meta.GetLLMConfig(r.Context(), project.ID)
 	if err != nil || cfg.Provider == "" {
-		http.Error(w, `{"error":"LLM not configured"}`, http.StatusBadRequest)
+		llmNotConfigured(w)
 		return
 	}
 
 	campaignID := r.PathValue("id")
 	campaign, err := s.meta.GetCampaign(r.Context(), project.ID, campaignID)
 	if err != nil {
-		http.Error(w, `{"error":"campaign not found"}`, http.StatusNotFound)
+		apierror.Error(w, "campaign not found", http.StatusNotFound)
 		return
 	}
 
@@ -1865,7 +3106,7 @@ func (s *Server) abTestHandler(w http.ResponseWriter, r *http.Request) {
 	variations, err := ai.GenerateVariations(r.Context(), cfg, original, campaign.Channel, 2)
 	if err != nil {
 		log.Printf("ERROR A/B variation generation: %v", err)
-		http.Error(w, `{"error":"variation generation failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "variation generation failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -1942,13 +3183,13 @@ func (s *Server) abTestHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) campaignPerformanceHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	campaignID := r.PathValue("id")
 	campaign, err := s.meta.GetCampaign(r.Context(), project.ID, campaignID)
 	if err != nil {
-		http.Error(w, `{"error":"campaign not found"}`, http.StatusNotFound)
+		apierror.Error(w, "campaign not found", http.StatusNotFound)
 		return
 	}
 
@@ -2055,12 +3296,12 @@ func (s *Server) campaignPerformanceHandler(w http.ResponseWriter, r *http.Reque
 func (s *Server) icpAnalyzeHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	cfg, err := s.meta.GetLLMConfig(r.Context(), project.ID)
 	if err != nil || cfg.Provider == "" {
-		http.Error(w, `{"error":"LLM not configured. Go to Settings to add an AI provider."}`, http.StatusBadRequest)
+		llmNotConfigured(w)
 		return
 	}
 
@@ -2068,7 +3309,7 @@ func (s *Server) icpAnalyzeHandler(w http.ResponseWriter, r *http.Request) {
 		ConversionPaths []string `json:"conversion_paths"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || len(body.ConversionPaths) == 0 {
-		http.Error(w, `{"error":"conversion_paths is required"}`, http.StatusBadRequest)
+		apierror.Error(w, "conversion_paths is required", http.StatusBadRequest)
 		return
 	}
 
@@ -2077,7 +3318,7 @@ func (s *Server) icpAnalyzeHandler(w http.ResponseWriter, r *http.Request) {
 
 	profiles, err := s.events.QueryICPProfiles(r.Context(), project.ID, body.ConversionPaths, monthAgo, now, 50)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -2102,7 +3343,7 @@ func (s *Server) icpAnalyzeHandler(w http.ResponseWriter, r *http.Request) {
 	analysis, err := ai.AnalyzeICP(r.Context(), cfg, aiProfiles, projectDesc)
 	if err != nil {
 		log.Printf("ERROR ICP analysis: %v", err)
-		http.Error(w, `{"error":"AI analysis failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+		apierror.Error(w, "AI analysis failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -2135,12 +3376,12 @@ func (s *Server) icpAnalyzeHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) listICPAnalysesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	analyses, err := s.meta.ListICPAnalyses(r.Context(), project.ID, 20)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -2150,12 +3391,12 @@ func (s *Server) listICPAnalysesHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) getICPAnalysisHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	a, err := s.meta.GetICPAnalysis(r.Context(), project.ID, r.PathValue("id"))
 	if err != nil {
-		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		apierror.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -2165,11 +3406,11 @@ func (s *Server) getICPAnalysisHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) deleteICPAnalysisHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	if err := s.meta.DeleteICPAnalysis(r.Context(), project.ID, r.PathValue("id")); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -2218,12 +3459,12 @@ func (s *Server) pollEngagement(ctx context.Context) {
 func (s *Server) listScoringRulesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	rules, err := s.meta.ListScoringRules(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -2233,7 +3474,7 @@ func (s *Server) listScoringRulesHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) createScoringRuleHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
@@ -2243,12 +3484,12 @@ func (s *Server) createScoringRuleHandler(w http.ResponseWriter, r *http.Request
 		Points   int    `json:"points"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" || body.RuleType == "" {
-		http.Error(w, `{"error":"name and rule_type are required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name and rule_type are required", http.StatusBadRequest)
 		return
 	}
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	if body.Config == "" {
@@ -2264,7 +3505,7 @@ func (s *Server) createScoringRuleHandler(w http.ResponseWriter, r *http.Request
 		Enabled:   true,
 	}
 	if err := s.meta.CreateScoringRule(r.Context(), rule); err != nil {
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -2275,7 +3516,7 @@ func (s *Server) createScoringRuleHandler(w http.ResponseWriter, r *http.Request
 func (s *Server) updateScoringRuleHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
@@ -2287,11 +3528,11 @@ func (s *Server) updateScoringRuleHandler(w http.ResponseWriter, r *http.Request
 		Enabled  bool   `json:"enabled"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if err := s.meta.UpdateScoringRule(r.Context(), project.ID, id, body.Name, body.RuleType, body.Config, body.Points, body.Enabled); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -2301,12 +3542,12 @@ func (s *Server) updateScoringRuleHandler(w http.ResponseWriter, r *http.Request
 func (s *Server) deleteScoringRuleHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.DeleteScoringRule(r.Context(), project.ID, id); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -2317,12 +3558,12 @@ func (s *Server) deleteScoringRuleHandler(w http.ResponseWriter, r *http.Request
 func (s *Server) listCRMWebhooksHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	webhooks, err := s.meta.ListCRMWebhooks(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -2332,7 +3573,7 @@ func (s *Server) listCRMWebhooksHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) createCRMWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
@@ -2342,12 +3583,12 @@ func (s *Server) createCRMWebhookHandler(w http.ResponseWriter, r *http.Request)
 		PayloadTemplate string `json:"payload_template"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" || body.WebhookURL == "" {
-		http.Error(w, `{"error":"name and webhook_url are required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name and webhook_url are required", http.StatusBadRequest)
 		return
 	}
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	secret, _ := generateID()
@@ -2362,7 +3603,7 @@ func (s *Server) createCRMWebhookHandler(w http.ResponseWriter, r *http.Request)
 		PayloadTemplate: body.PayloadTemplate,
 	}
 	if err := s.meta.CreateCRMWebhook(r.Context(), wh); err != nil {
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -2373,7 +3614,7 @@ func (s *Server) createCRMWebhookHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) updateCRMWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
@@ -2386,11 +3627,11 @@ func (s *Server) updateCRMWebhookHandler(w http.ResponseWriter, r *http.Request)
 		PayloadTemplate string `json:"payload_template"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if err := s.meta.UpdateCRMWebhook(r.Context(), project.ID, id, body.Name, body.WebhookURL, body.MinScore, body.Enabled, body.Secret, body.PayloadTemplate); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -2400,12 +3641,12 @@ func (s *Server) updateCRMWebhookHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) deleteCRMWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.DeleteCRMWebhook(r.Context(), project.ID, id); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -2414,7 +3655,7 @@ func (s *Server) deleteCRMWebhookHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) testCRMWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	_ = r.PathValue("id")
@@ -2435,7 +3676,7 @@ func (s *Server) testCRMWebhookHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the webhook to find the URL.
 	webhooks, err := s.meta.ListCRMWebhooks(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	whID := r.PathValue("id")
@@ -2447,19 +3688,19 @@ func (s *Server) testCRMWebhookHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if targetURL == "" {
-		http.Error(w, `{"error":"webhook not found"}`, http.StatusNotFound)
+		apierror.Error(w, "webhook not found", http.StatusNotFound)
 		return
 	}
 
 	req, err := http.NewRequestWithContext(r.Context(), "POST", targetURL, bytes.NewReader(samplePayload))
 	if err != nil {
-		http.Error(w, `{"error":"failed to build request"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to build request", http.StatusInternalServerError)
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"webhook delivery failed: %s"}`, err.Error()), http.StatusBadGateway)
+		apierror.Error(w, fmt.Sprintf("webhook delivery failed: %s", err.Error()), http.StatusBadGateway)
 		return
 	}
 	resp.Body.Close()
@@ -2471,7 +3712,7 @@ func (s *Server) testCRMWebhookHandler(w http.ResponseWriter, r *http.Request) {
 // --- Alert checker ---
 
 func (s *Server) startAlertChecker() {
-	ticker := time.NewTicker(5 * time.Minute)
+	ticker := time.NewTicker(s.config.AlertInterval)
 	go func() {
 		for range ticker.C {
 			s.checkAlerts(context.Background())
@@ -2479,63 +3720,180 @@ func (s *Server) startAlertChecker() {
 	}()
 }
 
+// checkAlerts evaluates every enabled alert once. Start times are spread
+// evenly over the first half of AlertInterval so the DuckDB counts and webhook
+// calls don't all land at once, and each evaluation is bounded by a timeout
+// so the whole pass finishes well before the next tick.
 func (s *Server) checkAlerts(ctx context.Context) {
 	alerts, err := s.meta.ListAllEnabledAlerts(ctx)
 	if err != nil {
 		log.Printf("WARN alert checker: failed to list alerts: %v", err)
 		return
 	}
-	for _, a := range alerts {
-		since := time.Now().UTC().Add(-time.Duration(a.WindowMinutes) * time.Minute)
-		var eventType, eventName string
-		switch a.Metric {
-		case "error_count":
-			eventType = "error"
-		case "pageview_count":
-			eventType = "pageview"
-		case "event_count":
-			eventName = a.EventName
+	if len(alerts) == 0 {
+		return
+	}
+
+	spread := s.config.AlertInterval / 2
+	step := spread / time.Duration(len(alerts))
+	timeout := s.config.AlertInterval / 2
+
+	slots := make(chan struct{}, s.config.AlertWorkers)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i, a := range alerts {
+		if wait := time.Until(start.Add(time.Duration(i) * step)); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				wg.Wait()
+				return
+			}
 		}
-		count, err := s.events.CountEvents(ctx, a.ProjectID, eventType, eventName, since)
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			actx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			s.evaluateAlert(actx, a)
+		}()
+	}
+	wg.Wait()
+}
+
+// evaluateAlert counts the alert's metric over its window and, if the
+// threshold is exceeded outside the cooldown, delivers its webhook. For
+// event_rate_change the threshold is the percentage rise over the previous
+// window of the same length.
+func (s *Server) evaluateAlert(ctx context.Context, a storage.Alert) {
+	window := time.Duration(a.WindowMinutes) * time.Minute
+	since := time.Now().UTC().Add(-window)
+	var eventType, eventName string
+	switch a.Metric {
+	case "error_count":
+		eventType = "error"
+	case "pageview_count":
+		eventType = "pageview"
+	case "event_count", "event_rate_change":
+		eventName = a.EventName
+	}
+	count, err := s.events.CountEvents(ctx, a.ProjectID, eventType, eventName, since)
+	if err != nil {
+		log.Printf("WARN alert checker: count failed for alert %s: %v", a.ID, err)
+		return
+	}
+	fields := map[string]any{
+		"alert":      a.Name,
+		"metric":     a.Metric,
+		"count":      count,
+		"threshold":  a.Threshold,
+		"project_id": a.ProjectID,
+	}
+	if a.Metric == "event_rate_change" {
+		both, err := s.events.CountEvents(ctx, a.ProjectID, eventType, eventName, since.Add(-window))
 		if err != nil {
 			log.Printf("WARN alert checker: count failed for alert %s: %v", a.ID, err)
-			continue
+			return
 		}
-		if count <= int64(a.Threshold) {
-			continue
+		prev := both - count
+		// Without a previous count there is no rate to compare; firing on
+		// it would page on every project's first events.
+		if prev <= 0 {
+			return
 		}
-		// Cooldown: don't re-fire within the same window.
-		if a.LastTriggeredAt != nil {
-			if time.Since(*a.LastTriggeredAt) < time.Duration(a.WindowMinutes)*time.Minute {
-				continue
-			}
+		change := float64(count-prev) * 100 / float64(prev)
+		if change <= float64(a.Threshold) {
+			return
 		}
-		// Fire webhook.
-		payload, _ := json.Marshal(map[string]any{
-			"alert":      a.Name,
-			"metric":     a.Metric,
-			"count":      count,
-			"threshold":  a.Threshold,
-			"project_id": a.ProjectID,
-		})
+		fields["previous_count"] = prev
+		fields["change_pct"] = math.Round(change*10) / 10
+	} else if count <= int64(a.Threshold) {
+		return
+	}
+	// Cooldown: don't re-fire within the same window.
+	if a.LastTriggeredAt != nil {
+		if time.Since(*a.LastTriggeredAt) < time.Duration(a.WindowMinutes)*time.Minute {
+			return
+		}
+	}
+	// Fire webhook.
+	payload, _ := json.Marshal(fields)
+	if a.Format == storage.AlertFormatSlack {
+		payload, _ = json.Marshal(map[string]string{"text": slackAlertText(a, fields)})
+	}
+	if !s.deliverAlert(ctx, a, payload) {
+		// Leave last_triggered_at alone so the next pass fires again.
+		return
+	}
+	log.Printf("INFO alert %s fired: count=%d threshold=%d", a.Name, count, a.Threshold)
+	// Record the trigger even if ctx expired after the delivery.
+	now := time.Now().UTC()
+	if err := s.meta.UpdateAlertTriggered(context.WithoutCancel(ctx), a.ID, now); err != nil {
+		log.Printf("WARN alert checker: failed to update last_triggered_at: %v", err)
+	}
+	s.track("alert_triggered", map[string]any{"project_id": a.ProjectID, "alert_name": a.Name, "metric": a.Metric, "count": count})
+}
+
+// slackAlertText renders a fired alert as a one-line Slack message, e.g.
+// "⚠️ Alert 'Errors' fired: 412 errors in 60m (threshold 100)".
+func slackAlertText(a storage.Alert, fields map[string]any) string {
+	what := "events"
+	switch a.Metric {
+	case "error_count":
+		what = "errors"
+	case "pageview_count":
+		what = "pageviews"
+	}
+	if a.EventName != "" && (a.Metric == "event_count" || a.Metric == "event_rate_change") {
+		what = a.EventName + " events"
+	}
+	if a.Metric == "event_rate_change" {
+		return fmt.Sprintf("⚠️ Alert '%s' fired: %v %s in %dm, up %v%% on the previous %dm (threshold %d%%)",
+			a.Name, fields["count"], what, a.WindowMinutes, fields["change_pct"], a.WindowMinutes, a.Threshold)
+	}
+	return fmt.Sprintf("⚠️ Alert '%s' fired: %v %s in %dm (threshold %d)", a.Name, fields["count"], what, a.WindowMinutes, a.Threshold)
+}
+
+// alertRequestTimeout bounds one alert webhook attempt so a hanging
+// endpoint can't hold a checker worker for the whole pass.
+const alertRequestTimeout = 10 * time.Second
+
+// deliverAlert POSTs the alert payload, retrying after each s.alertBackoff
+// wait on a transport error or non-2xx response. It reports whether the
+// receiver accepted it.
+func (s *Server) deliverAlert(ctx context.Context, a storage.Alert, payload []byte) bool {
+	client := &http.Client{Timeout: alertRequestTimeout}
+	for attempt := 0; ; attempt++ {
 		req, err := http.NewRequestWithContext(ctx, "POST", a.WebhookURL, bytes.NewReader(payload))
 		if err != nil {
 			log.Printf("WARN alert %s: failed to build webhook request: %v", a.Name, err)
-		} else {
-			req.Header.Set("Content-Type", "application/json")
-			resp, err := http.DefaultClient.Do(req)
-			if err != nil {
-				log.Printf("WARN alert %s: webhook delivery failed: %v", a.Name, err)
-			} else {
-				resp.Body.Close()
-				log.Printf("INFO alert %s fired: count=%d threshold=%d", a.Name, count, a.Threshold)
+			return false
+		}
+		req.Header.Set("Content-Type", "application/json")
+		// Receivers verify the HMAC-SHA256 of the raw body bytes with the
+		// alert's secret.
+		if sig := signPayload(a.Secret, payload); sig != "" {
+			req.Header.Set("X-ClickNest-Signature", "sha256="+sig)
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return true
 			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
 		}
-		now := time.Now().UTC()
-		if err := s.meta.UpdateAlertTriggered(ctx, a.ID, now); err != nil {
-			log.Printf("WARN alert checker: failed to update last_triggered_at: %v", err)
+		if attempt == len(s.alertBackoff) {
+			log.Printf("WARN alert %s: webhook delivery failed after %d attempts: %v", a.Name, attempt+1, err)
+			return false
+		}
+		log.Printf("WARN alert %s: webhook delivery attempt %d failed: %v", a.Name, attempt+1, err)
+		select {
+		case <-time.After(s.alertBackoff[attempt]):
+		case <-ctx.Done():
+			return false
 		}
-		s.track("alert_triggered", map[string]any{"project_id": a.ProjectID, "alert_name": a.Name, "metric": a.Metric, "count": count})
 	}
 }
 
@@ -2642,12 +4000,12 @@ func signPayload(secret string, payload []byte) string {
 func (s *Server) webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	deliveries, err := s.meta.ListWebhookDeliveries(r.Context(), project.ID, r.PathValue("id"), 50)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -2675,13 +4033,13 @@ func scoreRelevance(content, title string, keywords []string) float64 {
 func (s *Server) publishCampaignHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	campaignID := r.PathValue("id")
 	campaign, err := s.meta.GetCampaign(r.Context(), project.ID, campaignID)
 	if err != nil {
-		http.Error(w, `{"error":"campaign not found"}`, http.StatusNotFound)
+		apierror.Error(w, "campaign not found", http.StatusNotFound)
 		return
 	}
 
@@ -2690,16 +4048,16 @@ func (s *Server) publishCampaignHandler(w http.ResponseWriter, r *http.Request)
 		ContentOverride string `json:"content_override"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if body.PublisherName == "" {
-		http.Error(w, `{"error":"publisher_name required"}`, http.StatusBadRequest)
+		apierror.Error(w, "publisher_name required", http.StatusBadRequest)
 		return
 	}
 	pub := s.registry.GetPublisher(body.PublisherName)
 	if pub == nil {
-		http.Error(w, `{"error":"publisher not found"}`, http.StatusNotFound)
+		apierror.Error(w, "publisher not found", http.StatusNotFound)
 		return
 	}
 
@@ -2732,7 +4090,7 @@ func (s *Server) publishCampaignHandler(w http.ResponseWriter, r *http.Request)
 		ExtraFields: sourceCredentialFields(s.meta, r.Context(), project.ID, body.PublisherName),
 	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"publish failed: %s"}`, err.Error()), http.StatusInternalServerError)
+		apierror.Error(w, fmt.Sprintf("publish failed: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 
@@ -2757,13 +4115,13 @@ func (s *Server) publishCampaignHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) refreshCampaignEngagementHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	campaignID := r.PathValue("id")
 	posts, err := s.meta.ListCampaignPosts(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	refreshed := 0
@@ -2793,13 +4151,13 @@ func (s *Server) refreshCampaignEngagementHandler(w http.ResponseWriter, r *http
 func (s *Server) retryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	webhookID := r.PathValue("id")
 	webhooks, err := s.meta.ListCRMWebhooks(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	var wh *storage.CRMWebhook
@@ -2810,7 +4168,7 @@ func (s *Server) retryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Requ
 		}
 	}
 	if wh == nil {
-		http.Error(w, `{"error":"webhook not found"}`, http.StatusNotFound)
+		apierror.Error(w, "webhook not found", http.StatusNotFound)
 		return
 	}
 
@@ -2823,7 +4181,7 @@ func (s *Server) retryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Requ
 	})
 	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, wh.WebhookURL, bytes.NewReader(payload))
 	if err != nil {
-		http.Error(w, `{"error":"failed to create request"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to create request", http.StatusInternalServerError)
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
@@ -2864,27 +4222,25 @@ func (s *Server) retryWebhookDeliveryHandler(w http.ResponseWriter, r *http.Requ
 func (s *Server) icpGenerateCampaignHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	if s.config.ResourceLimitFn != nil {
 		if code, msg := s.config.ResourceLimitFn(r.Context(), project.ID, "campaigns"); code != 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(code)
-			json.NewEncoder(w).Encode(map[string]any{"error": msg, "upgrade_required": true})
+			apierror.ErrorCode(w, apierror.CodeUpgradeRequired, msg, code)
 			return
 		}
 	}
 
 	cfg, err := s.meta.GetLLMConfig(r.Context(), project.ID)
 	if err != nil || cfg.Provider == "" {
-		http.Error(w, `{"error":"LLM not configured"}`, http.StatusBadRequest)
+		llmNotConfigured(w)
 		return
 	}
 
 	analysis, err := s.meta.GetICPAnalysis(r.Context(), project.ID, r.PathValue("id"))
 	if err != nil {
-		http.Error(w, `{"error":"analysis not found"}`, http.StatusNotFound)
+		apierror.Error(w, "analysis not found", http.StatusNotFound)
 		return
 	}
 
@@ -2900,7 +4256,7 @@ func (s *Server) icpGenerateCampaignHandler(w http.ResponseWriter, r *http.Reque
 
 	now := time.Now().UTC()
 	monthAgo := now.Add(-30 * 24 * time.Hour)
-	topPages, _ := s.events.QueryTopPages(r.Context(), project.ID, monthAgo, now, 10)
+	topPages, _ := s.events.QueryTopPages(r.Context(), project.ID, monthAgo, now, 10, nil)
 	topEvents, _ := s.events.QueryTopEventNames(r.Context(), project.ID, monthAgo, now, 10)
 
 	proj, _ := s.meta.GetProject(r.Context(), project.ID)
@@ -2930,7 +4286,7 @@ func (s *Server) icpGenerateCampaignHandler(w http.ResponseWriter, r *http.Reque
 
 	content, err := ai.GenerateCampaign(r.Context(), cfg, cc)
 	if err != nil {
-		http.Error(w, `{"error":"AI generation failed: `+err.Error()+`"}`, http.StatusInternalServerError)
+		apierror.Error(w, "AI generation failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
@@ -2947,7 +4303,7 @@ func (s *Server) icpGenerateCampaignHandler(w http.ResponseWriter, r *http.Reque
 		AIPrompt:  "ICP-derived: " + analysis.Summary,
 	}
 	if err := s.meta.CreateCampaign(r.Context(), campaign); err != nil {
-		http.Error(w, `{"error":"save failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -2962,13 +4318,13 @@ func (s *Server) icpGenerateCampaignHandler(w http.ResponseWriter, r *http.Reque
 func (s *Server) icpCreateScoringRulesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	analysis, err := s.meta.GetICPAnalysis(r.Context(), project.ID, r.PathValue("id"))
 	if err != nil {
-		http.Error(w, `{"error":"analysis not found"}`, http.StatusNotFound)
+		apierror.Error(w, "analysis not found", http.StatusNotFound)
 		return
 	}
 
@@ -3088,12 +4444,12 @@ func (s *Server) storageHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) listConversionGoalsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	goals, err := s.meta.ListConversionGoals(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3103,7 +4459,7 @@ func (s *Server) listConversionGoalsHandler(w http.ResponseWriter, r *http.Reque
 func (s *Server) createConversionGoalHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
@@ -3114,12 +4470,12 @@ func (s *Server) createConversionGoalHandler(w http.ResponseWriter, r *http.Requ
 		ValueProperty string `json:"value_property"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
-		http.Error(w, `{"error":"name is required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name is required", http.StatusBadRequest)
 		return
 	}
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	if body.EventType == "" {
@@ -3138,7 +4494,7 @@ func (s *Server) createConversionGoalHandler(w http.ResponseWriter, r *http.Requ
 		ValueProperty: body.ValueProperty,
 	}
 	if err := s.meta.CreateConversionGoal(r.Context(), goal); err != nil {
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3149,13 +4505,13 @@ func (s *Server) createConversionGoalHandler(w http.ResponseWriter, r *http.Requ
 func (s *Server) getConversionGoalHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	goal, err := s.meta.GetConversionGoal(r.Context(), project.ID, id)
 	if err != nil {
-		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		apierror.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3165,7 +4521,7 @@ func (s *Server) getConversionGoalHandler(w http.ResponseWriter, r *http.Request
 func (s *Server) updateConversionGoalHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
@@ -3177,7 +4533,7 @@ func (s *Server) updateConversionGoalHandler(w http.ResponseWriter, r *http.Requ
 		ValueProperty string `json:"value_property"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if err := s.meta.UpdateConversionGoal(r.Context(), project.ID, id, storage.ConversionGoal{
@@ -3187,7 +4543,7 @@ func (s *Server) updateConversionGoalHandler(w http.ResponseWriter, r *http.Requ
 		URLPattern:    body.URLPattern,
 		ValueProperty: body.ValueProperty,
 	}); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3197,12 +4553,12 @@ func (s *Server) updateConversionGoalHandler(w http.ResponseWriter, r *http.Requ
 func (s *Server) deleteConversionGoalHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.DeleteConversionGoal(r.Context(), project.ID, id); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -3213,12 +4569,12 @@ func (s *Server) deleteConversionGoalHandler(w http.ResponseWriter, r *http.Requ
 func (s *Server) listExperimentsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	experiments, err := s.meta.ListExperiments(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3228,7 +4584,7 @@ func (s *Server) listExperimentsHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) createExperimentHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
@@ -3239,16 +4595,16 @@ func (s *Server) createExperimentHandler(w http.ResponseWriter, r *http.Request)
 		AutoStop         bool     `json:"auto_stop"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" || body.FlagKey == "" {
-		http.Error(w, `{"error":"name and flag_key are required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name and flag_key are required", http.StatusBadRequest)
 		return
 	}
 	if len(body.Variants) < 2 {
-		http.Error(w, `{"error":"at least 2 variants required"}`, http.StatusBadRequest)
+		apierror.Error(w, "at least 2 variants required", http.StatusBadRequest)
 		return
 	}
 	id, err := generateID()
 	if err != nil {
-		http.Error(w, `{"error":"internal error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal error", http.StatusInternalServerError)
 		return
 	}
 	variantsJSON, _ := json.Marshal(body.Variants)
@@ -3263,7 +4619,7 @@ func (s *Server) createExperimentHandler(w http.ResponseWriter, r *http.Request)
 		AutoStop:         body.AutoStop,
 	}
 	if err := s.meta.CreateExperiment(r.Context(), exp); err != nil {
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3274,13 +4630,13 @@ func (s *Server) createExperimentHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) getExperimentHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	exp, err := s.meta.GetExperiment(r.Context(), project.ID, id)
 	if err != nil {
-		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		apierror.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3290,7 +4646,7 @@ func (s *Server) getExperimentHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) updateExperimentHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
@@ -3301,11 +4657,11 @@ func (s *Server) updateExperimentHandler(w http.ResponseWriter, r *http.Request)
 		ConversionGoalID string `json:"conversion_goal_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if err := s.meta.UpdateExperiment(r.Context(), project.ID, id, body.Name, body.Status, body.AutoStop, body.ConversionGoalID); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3315,12 +4671,12 @@ func (s *Server) updateExperimentHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) deleteExperimentHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.DeleteExperiment(r.Context(), project.ID, id); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -3329,12 +4685,12 @@ func (s *Server) deleteExperimentHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) stopExperimentHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.EndExperiment(r.Context(), project.ID, id, ""); err != nil {
-		http.Error(w, `{"error":"stop failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "stop failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3344,7 +4700,7 @@ func (s *Server) stopExperimentHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) declareWinnerHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
@@ -3352,19 +4708,19 @@ func (s *Server) declareWinnerHandler(w http.ResponseWriter, r *http.Request) {
 		Variant string `json:"variant"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Variant == "" {
-		http.Error(w, `{"error":"variant is required"}`, http.StatusBadRequest)
+		apierror.Error(w, "variant is required", http.StatusBadRequest)
 		return
 	}
 
 	exp, err := s.meta.GetExperiment(r.Context(), project.ID, id)
 	if err != nil {
-		http.Error(w, `{"error":"experiment not found"}`, http.StatusNotFound)
+		apierror.Error(w, "experiment not found", http.StatusNotFound)
 		return
 	}
 
 	// End the experiment with the winner.
 	if err := s.meta.EndExperiment(r.Context(), project.ID, id, body.Variant); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 
@@ -3488,7 +4844,7 @@ func generateID() (string, error) {
 func (s *Server) listSourcesHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	sources := s.registry.ListSources()
@@ -3511,19 +4867,19 @@ func (s *Server) listSourcesHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) triggerSourceSearchHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	name := r.PathValue("name")
 	src := s.registry.GetSource(name)
 	if src == nil {
-		http.Error(w, `{"error":"source not found"}`, http.StatusNotFound)
+		apierror.Error(w, "source not found", http.StatusNotFound)
 		return
 	}
 
 	cfg, err := s.meta.GetSourceConfig(r.Context(), project.ID, name)
 	if err != nil {
-		http.Error(w, `{"error":"source not configured"}`, http.StatusBadRequest)
+		apierror.Error(w, "source not configured", http.StatusBadRequest)
 		return
 	}
 
@@ -3542,7 +4898,7 @@ func (s *Server) triggerSourceSearchHandler(w http.ResponseWriter, r *http.Reque
 		ExtraFields: sourceCredentialFields(s.meta, r.Context(), project.ID, name),
 	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"search failed: %s"}`, err.Error()), http.StatusInternalServerError)
+		apierror.Error(w, fmt.Sprintf("search failed: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 
@@ -3577,12 +4933,12 @@ func (s *Server) triggerSourceSearchHandler(w http.ResponseWriter, r *http.Reque
 func (s *Server) listSourceConfigsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	configs, err := s.meta.ListSourceConfigs(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"list failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "list failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3592,7 +4948,7 @@ func (s *Server) listSourceConfigsHandler(w http.ResponseWriter, r *http.Request
 func (s *Server) upsertSourceConfigHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
@@ -3605,11 +4961,11 @@ func (s *Server) upsertSourceConfigHandler(w http.ResponseWriter, r *http.Reques
 		} `json:"filters"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	if body.SourceName == "" {
-		http.Error(w, `{"error":"source_name required"}`, http.StatusBadRequest)
+		apierror.Error(w, "source_name required", http.StatusBadRequest)
 		return
 	}
 	if body.ScheduleMinutes <= 0 {
@@ -3619,9 +4975,7 @@ func (s *Server) upsertSourceConfigHandler(w http.ResponseWriter, r *http.Reques
 	// Enforce connector limits before enabling a source.
 	if body.Enabled && s.config.ResourceLimitFn != nil {
 		if code, msg := s.config.ResourceLimitFn(r.Context(), project.ID, "connectors"); code != 0 {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(code)
-			json.NewEncoder(w).Encode(map[string]any{"error": msg, "upgrade_required": true})
+			apierror.ErrorCode(w, apierror.CodeUpgradeRequired, msg, code)
 			return
 		}
 	}
@@ -3645,7 +4999,7 @@ func (s *Server) upsertSourceConfigHandler(w http.ResponseWriter, r *http.Reques
 		Enabled:         body.Enabled,
 	})
 	if err != nil {
-		http.Error(w, `{"error":"save failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
 		return
 	}
 	s.track("source_configured", map[string]any{"project_id": project.ID, "source_name": body.SourceName, "enabled": body.Enabled})
@@ -3656,13 +5010,13 @@ func (s *Server) upsertSourceConfigHandler(w http.ResponseWriter, r *http.Reques
 func (s *Server) suggestSubredditsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	cfg, err := s.meta.GetLLMConfig(r.Context(), project.ID)
 	if err != nil || cfg.Provider == "" {
-		http.Error(w, `{"error":"LLM not configured"}`, http.StatusBadRequest)
+		llmNotConfigured(w)
 		return
 	}
 
@@ -3683,7 +5037,7 @@ func (s *Server) suggestSubredditsHandler(w http.ResponseWriter, r *http.Request
 
 	suggestions, err := ai.SuggestSubreddits(r.Context(), cfg, desc, icpTraits)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"suggestion failed: %s"}`, err.Error()), http.StatusInternalServerError)
+		apierror.Error(w, fmt.Sprintf("suggestion failed: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 
@@ -3696,37 +5050,34 @@ func (s *Server) suggestSubredditsHandler(w http.ResponseWriter, r *http.Request
 func (s *Server) listMentionsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	status := r.URL.Query().Get("status")
 	source := r.URL.Query().Get("source")
-	limit := 50
+	limit := query.Limit(r, 50, s.config.MaxResultLimit)
 	offset := 0
-	if v := r.URL.Query().Get("limit"); v != "" {
-		fmt.Sscanf(v, "%d", &limit)
-	}
 	if v := r.URL.Query().Get("offset"); v != "" {
 		fmt.Sscanf(v, "%d", &offset)
 	}
 	mentions, total, err := s.meta.ListMentions(r.Context(), project.ID, status, source, limit, offset)
 	if err != nil {
-		http.Error(w, `{"error":"list failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "list failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]any{"mentions": mentions, "total": total})
+	json.NewEncoder(w).Encode(map[string]any{"mentions": mentions, "total": total, "limit": limit})
 }
 
 func (s *Server) getMentionHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	m, err := s.meta.GetMention(r.Context(), project.ID, r.PathValue("id"))
 	if err != nil {
-		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		apierror.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3736,24 +5087,24 @@ func (s *Server) getMentionHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) updateMentionHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
 		Status string `json:"status"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 	switch body.Status {
 	case "new", "reviewed", "replied", "dismissed", "lead":
 	default:
-		http.Error(w, `{"error":"invalid status"}`, http.StatusBadRequest)
+		apierror.Error(w, "invalid status", http.StatusBadRequest)
 		return
 	}
 	if err := s.meta.UpdateMentionStatus(r.Context(), project.ID, r.PathValue("id"), body.Status); err != nil {
-		http.Error(w, `{"error":"update failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -3763,19 +5114,19 @@ func (s *Server) updateMentionHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) draftMentionReplyHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	m, err := s.meta.GetMention(r.Context(), project.ID, r.PathValue("id"))
 	if err != nil {
-		http.Error(w, `{"error":"mention not found"}`, http.StatusNotFound)
+		apierror.Error(w, "mention not found", http.StatusNotFound)
 		return
 	}
 
 	cfg, err := s.meta.GetLLMConfig(r.Context(), project.ID)
 	if err != nil || cfg.Provider == "" {
-		http.Error(w, `{"error":"LLM not configured"}`, http.StatusBadRequest)
+		llmNotConfigured(w)
 		return
 	}
 
@@ -3793,7 +5144,7 @@ func (s *Server) draftMentionReplyHandler(w http.ResponseWriter, r *http.Request
 		Platform:           m.SourceName,
 	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"draft failed: %s"}`, err.Error()), http.StatusInternalServerError)
+		apierror.Error(w, fmt.Sprintf("draft failed: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 
@@ -3807,13 +5158,13 @@ func (s *Server) draftMentionReplyHandler(w http.ResponseWriter, r *http.Request
 func (s *Server) publishMentionReplyHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
 	m, err := s.meta.GetMention(r.Context(), project.ID, r.PathValue("id"))
 	if err != nil {
-		http.Error(w, `{"error":"mention not found"}`, http.StatusNotFound)
+		apierror.Error(w, "mention not found", http.StatusNotFound)
 		return
 	}
 
@@ -3822,7 +5173,7 @@ func (s *Server) publishMentionReplyHandler(w http.ResponseWriter, r *http.Reque
 		ReplyText     string `json:"reply_text"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 
@@ -3833,13 +5184,13 @@ func (s *Server) publishMentionReplyHandler(w http.ResponseWriter, r *http.Reque
 		body.ReplyText = m.SuggestedReply
 	}
 	if body.ReplyText == "" {
-		http.Error(w, `{"error":"no reply text"}`, http.StatusBadRequest)
+		apierror.Error(w, "no reply text", http.StatusBadRequest)
 		return
 	}
 
 	pub := s.registry.GetPublisher(body.PublisherName)
 	if pub == nil {
-		http.Error(w, `{"error":"publisher not found"}`, http.StatusNotFound)
+		apierror.Error(w, "publisher not found", http.StatusNotFound)
 		return
 	}
 
@@ -3848,7 +5199,7 @@ func (s *Server) publishMentionReplyHandler(w http.ResponseWriter, r *http.Reque
 		Channel: m.SourceName,
 	})
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"publish failed: %s"}`, err.Error()), http.StatusInternalServerError)
+		apierror.Error(w, fmt.Sprintf("publish failed: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
 
@@ -4017,20 +5368,34 @@ func (s *Server) withQueryLimit(h http.Handler) http.Handler {
 			h.ServeHTTP(w, r)
 			return
 		}
-		val, _ := s.querySlots.LoadOrStore(project.ID,
-			make(chan struct{}, s.config.MaxConcurrentQueries))
-		sem := val.(chan struct{})
-		select {
-		case sem <- struct{}{}:
-			defer func() { <-sem }()
-		default:
-			http.Error(w, `{"error":"too many concurrent queries, try again shortly"}`, http.StatusTooManyRequests)
+		release, ok := s.tryQuerySlot(project.ID)
+		if !ok {
+			apierror.Error(w, "too many concurrent queries, try again shortly", http.StatusTooManyRequests)
 			return
 		}
+		defer release()
 		h.ServeHTTP(w, r)
 	})
 }
 
+// tryQuerySlot takes one of the project's concurrent query slots without
+// waiting. It reports false when all are in use; otherwise release must be
+// called once the query is done.
+func (s *Server) tryQuerySlot(projectID string) (release func(), ok bool) {
+	if s.config.MaxConcurrentQueries <= 0 {
+		return func() {}, true
+	}
+	val, _ := s.querySlots.LoadOrStore(projectID,
+		make(chan struct{}, s.config.MaxConcurrentQueries))
+	sem := val.(chan struct{})
+	select {
+	case sem <- struct{}{}:
+		return func() { <-sem }, true
+	default:
+		return nil, false
+	}
+}
+
 // --- Lead limit middleware ---
 
 // leadLimitCheck wraps a handler to enforce the per-project lead count limit.
@@ -4040,9 +5405,7 @@ func (s *Server) leadLimitCheck(h http.Handler) http.Handler {
 			project := auth.ProjectFromContext(r.Context())
 			if project != nil {
 				if code, msg := s.config.ResourceLimitFn(r.Context(), project.ID, "leads"); code != 0 {
-					w.Header().Set("Content-Type", "application/json")
-					w.WriteHeader(code)
-					json.NewEncoder(w).Encode(map[string]any{"error": msg, "upgrade_required": true})
+					apierror.ErrorCode(w, apierror.CodeUpgradeRequired, msg, code)
 					return
 				}
 			}
@@ -4056,12 +5419,12 @@ func (s *Server) leadLimitCheck(h http.Handler) http.Handler {
 func (s *Server) deadLettersHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	deliveries, err := s.meta.ListDeadLetterDeliveries(r.Context(), project.ID, 50)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	// Attach webhook names for display.
@@ -4134,7 +5497,7 @@ func buildWebhookPayload(wh storage.CRMWebhook, leads []storage.ScoredLead) []by
 
 // sourceCredentialFields looks up stored per-project OAuth credentials for a source/publisher
 // and returns them as an ExtraFields map for SearchQuery or PostContent.
-func sourceCredentialFields(meta *storage.SQLite, ctx context.Context, projectID, sourceName string) map[string]string {
+func sourceCredentialFields(meta storage.MetaStore, ctx context.Context, projectID, sourceName string) map[string]string {
 	creds, err := meta.GetSourceCredentials(ctx, projectID, sourceName)
 	if err != nil || creds == nil {
 		return nil
@@ -4163,7 +5526,7 @@ func pkceChallenge(verifier string) string {
 func (s *Server) getSourceCredentialsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	name := r.PathValue("name")
@@ -4183,7 +5546,7 @@ func (s *Server) getSourceCredentialsHandler(w http.ResponseWriter, r *http.Requ
 func (s *Server) saveSourceCredentialsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	name := r.PathValue("name")
@@ -4193,17 +5556,17 @@ func (s *Server) saveSourceCredentialsHandler(w http.ResponseWriter, r *http.Req
 		RefreshToken string `json:"refresh_token"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid request body"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid request body", http.StatusBadRequest)
 		return
 	}
 	if body.RefreshToken == "" && body.AccessToken == "" {
-		http.Error(w, `{"error":"access_token or refresh_token required"}`, http.StatusBadRequest)
+		apierror.Error(w, "access_token or refresh_token required", http.StatusBadRequest)
 		return
 	}
 
 	username, err := s.validateSourceToken(r.Context(), name, body.AccessToken, body.RefreshToken)
 	if err != nil {
-		http.Error(w, fmt.Sprintf(`{"error":"credential validation failed: %s"}`, err.Error()), http.StatusBadRequest)
+		apierror.Error(w, fmt.Sprintf("credential validation failed: %s", err.Error()), http.StatusBadRequest)
 		return
 	}
 
@@ -4214,7 +5577,7 @@ func (s *Server) saveSourceCredentialsHandler(w http.ResponseWriter, r *http.Req
 		RefreshToken: body.RefreshToken,
 		Username:     username,
 	}); err != nil {
-		http.Error(w, `{"error":"failed to save credentials"}`, http.StatusInternalServerError)
+		apierror.Error(w, "failed to save credentials", http.StatusInternalServerError)
 		return
 	}
 
@@ -4225,7 +5588,7 @@ func (s *Server) saveSourceCredentialsHandler(w http.ResponseWriter, r *http.Req
 func (s *Server) deleteSourceCredentialsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	name := r.PathValue("name")
@@ -4237,7 +5600,7 @@ func (s *Server) deleteSourceCredentialsHandler(w http.ResponseWriter, r *http.R
 func (s *Server) sourceOAuthAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	name := r.PathValue("name")
@@ -4271,7 +5634,7 @@ func (s *Server) sourceOAuthAuthorizeHandler(w http.ResponseWriter, r *http.Requ
 			return
 		}
 		if err := s.meta.SetOAuthStateExtra(r.Context(), state, project.ID, ""); err != nil {
-			http.Error(w, `{"error":"failed to create oauth state"}`, http.StatusInternalServerError)
+			apierror.Error(w, "failed to create oauth state", http.StatusInternalServerError)
 			return
 		}
 		params := url.Values{
@@ -4296,7 +5659,7 @@ func (s *Server) sourceOAuthAuthorizeHandler(w http.ResponseWriter, r *http.Requ
 		verifier := generateCodeVerifier()
 		challenge := pkceChallenge(verifier)
 		if err := s.meta.SetOAuthStateExtra(r.Context(), state, project.ID, verifier); err != nil {
-			http.Error(w, `{"error":"failed to create oauth state"}`, http.StatusInternalServerError)
+			apierror.Error(w, "failed to create oauth state", http.StatusInternalServerError)
 			return
 		}
 		params := url.Values{
@@ -4563,12 +5926,151 @@ func (s *Server) validateSourceToken(ctx context.Context, sourceName, accessToke
 	}
 }
 
+// ---- Event enrichment --------------------------------------------------------
+
+// heartbeatHandler handles GET /api/v1/heartbeat: the time of the project's
+// most recent event and the seconds since, so a monitor can alert when
+// ingestion stops. Both are null before the first event.
+func (s *Server) heartbeatHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	last, err := s.events.LatestEventTime(r.Context(), project.ID)
+	if err != nil {
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+		return
+	}
+	var secondsSince *int64
+	if last != nil {
+		// Client clocks can run ahead; never report a negative age.
+		secs := max(int64(time.Since(*last).Seconds()), 0)
+		secondsSince = &secs
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"last_event_at": last,
+		"seconds_since": secondsSince,
+	})
+}
+
+// identifyHandler handles POST /api/v1/identify with a body of
+// {"anonymous_id", "distinct_id"}: the anonymous ID is aliased to the
+// distinct ID, so later events sent under it are rewritten on ingest, and its
+// past events are moved over, along with the anonymous events sent earlier in
+// the distinct ID's sessions without any ID. Repeating a merge is harmless: the alias is
+// upserted and no events are left under the anonymous ID to move.
+func (s *Server) identifyHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		AnonymousID string `json:"anonymous_id"`
+		DistinctID  string `json:"distinct_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if body.AnonymousID == "" || body.DistinctID == "" {
+		apierror.Error(w, "anonymous_id and distinct_id are required", http.StatusBadRequest)
+		return
+	}
+
+	// Alias to the canonical ID so a distinct ID that was itself merged
+	// doesn't start a chain ingest would only resolve one step of.
+	target, err := s.meta.ResolveIdentity(r.Context(), project.ID, body.DistinctID)
+	if err != nil {
+		apierror.Error(w, "identity lookup failed", http.StatusInternalServerError)
+		return
+	}
+	if target == body.AnonymousID {
+		apierror.Error(w, "anonymous_id and distinct_id must differ", http.StatusBadRequest)
+		return
+	}
+	if err := s.meta.SetIdentityAlias(r.Context(), project.ID, body.AnonymousID, target); err != nil {
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
+		return
+	}
+	merged, err := s.events.MergeDistinctID(r.Context(), project.ID, body.AnonymousID, target)
+	if err != nil {
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "merge failed", http.StatusInternalServerError)
+		return
+	}
+	backfilled, err := s.events.BackfillSessionDistinctID(r.Context(), project.ID, target)
+	if err != nil {
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "merge failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"distinct_id":            target,
+		"events_updated":         merged,
+		"session_events_updated": backfilled,
+	})
+}
+
+// patchEventHandler handles PATCH /api/v1/events/{id} with a body of
+// {"properties": {...}}, merged into the event's properties (a null value
+// removes a key). Every other field is part of the event's identity or
+// analytics (type, URL, timestamp, session) and can't be changed.
+func (s *Server) patchEventHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var body map[string]json.RawMessage
+	r.Body = http.MaxBytesReader(w, r.Body, 64*1024)
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
+		return
+	}
+	for k := range body {
+		if k != "properties" {
+			apierror.Error(w, "only properties can be updated", http.StatusBadRequest)
+			return
+		}
+	}
+	var props map[string]any
+	if err := json.Unmarshal(body["properties"], &props); err != nil || len(props) == 0 {
+		apierror.Error(w, "properties must be a non-empty object", http.StatusBadRequest)
+		return
+	}
+	// Setting a reserved key to null would delete it, so any mention is refused.
+	for k := range props {
+		if storage.ReservedProperty(k) {
+			apierror.Error(w, k+" is set by ingest and can't be changed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	found, err := s.events.MergeEventProperties(r.Context(), project.ID, r.PathValue("id"), props)
+	if err != nil {
+		log.Printf("ERROR patching event: %v", err)
+		apierror.Error(w, "update failed", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		apierror.Error(w, "event not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 // ---- Inbound lead ingestion -------------------------------------------------
 
 func (s *Server) ingestLeadsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
@@ -4587,7 +6089,7 @@ func (s *Server) ingestLeadsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		http.Error(w, `{"error":"invalid json"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid json", http.StatusBadRequest)
 		return
 	}
 
@@ -4608,12 +6110,12 @@ func (s *Server) ingestLeadsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(leads) == 0 {
-		http.Error(w, `{"error":"at least one lead with an email is required"}`, http.StatusBadRequest)
+		apierror.Error(w, "at least one lead with an email is required", http.StatusBadRequest)
 		return
 	}
 
 	if len(leads) > 1000 {
-		http.Error(w, `{"error":"max 1000 leads per request"}`, http.StatusBadRequest)
+		apierror.Error(w, "max 1000 leads per request", http.StatusBadRequest)
 		return
 	}
 
@@ -4650,13 +6152,13 @@ func (s *Server) ingestLeadsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if len(events) == 0 {
-		http.Error(w, `{"error":"no valid leads (email required)"}`, http.StatusBadRequest)
+		apierror.Error(w, "no valid leads (email required)", http.StatusBadRequest)
 		return
 	}
 
 	if err := s.events.InsertEvents(r.Context(), events); err != nil {
 		log.Printf("ERROR inserting external leads: %v", err)
-		http.Error(w, `{"error":"internal server error"}`, http.StatusInternalServerError)
+		apierror.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
 
@@ -4681,13 +6183,13 @@ func (s *Server) ingestLeadsHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) leadScoreHistoryHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	distinctID := r.PathValue("id")
 	history, err := s.meta.GetLeadScoreHistory(r.Context(), project.ID, distinctID, 30)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -4697,13 +6199,13 @@ func (s *Server) leadScoreHistoryHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) leadAttributionHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	distinctID := r.PathValue("id")
 	sources, err := s.events.QueryLeadAttribution(r.Context(), project.ID, distinctID, 90)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -4715,12 +6217,12 @@ func (s *Server) leadAttributionHandler(w http.ResponseWriter, r *http.Request)
 func (s *Server) listSegmentsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	segs, err := s.meta.ListSegments(r.Context(), project.ID)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -4730,7 +6232,7 @@ func (s *Server) listSegmentsHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) createSegmentHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
@@ -4738,7 +6240,7 @@ func (s *Server) createSegmentHandler(w http.ResponseWriter, r *http.Request) {
 		Conditions string `json:"conditions"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
-		http.Error(w, `{"error":"name is required"}`, http.StatusBadRequest)
+		apierror.Error(w, "name is required", http.StatusBadRequest)
 		return
 	}
 	if body.Conditions == "" {
@@ -4746,7 +6248,7 @@ func (s *Server) createSegmentHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	seg, err := s.meta.CreateSegment(r.Context(), project.ID, body.Name, body.Conditions)
 	if err != nil {
-		http.Error(w, `{"error":"create failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -4757,12 +6259,12 @@ func (s *Server) createSegmentHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) deleteSegmentHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	if err := s.meta.DeleteSegment(r.Context(), project.ID, id); err != nil {
-		http.Error(w, `{"error":"delete failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -4771,20 +6273,20 @@ func (s *Server) deleteSegmentHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) segmentMembersHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	id := r.PathValue("id")
 	seg, err := s.meta.GetSegment(r.Context(), project.ID, id)
 	if err != nil {
-		http.Error(w, `{"error":"not found"}`, http.StatusNotFound)
+		apierror.Error(w, "not found", http.StatusNotFound)
 		return
 	}
 
 	// Parse segment conditions as scoring rules and run a lead score query.
 	var conditions []storage.ScoringRule
 	if err := json.Unmarshal([]byte(seg.Conditions), &conditions); err != nil {
-		http.Error(w, `{"error":"invalid conditions"}`, http.StatusBadRequest)
+		apierror.Error(w, "invalid conditions", http.StatusBadRequest)
 		return
 	}
 
@@ -4792,7 +6294,7 @@ func (s *Server) segmentMembersHandler(w http.ResponseWriter, r *http.Request) {
 	end := time.Now().UTC()
 	leads, total, err := s.events.QueryLeadScores(r.Context(), project.ID, conditions, start, end, 200, 0)
 	if err != nil {
-		http.Error(w, `{"error":"query failed"}`, http.StatusInternalServerError)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
 		return
 	}
 	// Filter to only include users with score > 0 (actually matching at least one condition).
@@ -4806,12 +6308,130 @@ func (s *Server) segmentMembersHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{"members": members, "total": total})
 }
 
+// segmentMetrics are the values compareSegmentsHandler can compare, each
+// aggregated over a segment's members.
+var segmentMetrics = map[string]func(members []storage.ScoredLead) float64{
+	"users": func(m []storage.ScoredLead) float64 { return float64(len(m)) },
+	"events": func(m []storage.ScoredLead) float64 {
+		var n int
+		for _, l := range m {
+			n += l.EventCount
+		}
+		return float64(n)
+	},
+	"sessions": func(m []storage.ScoredLead) float64 {
+		var n int
+		for _, l := range m {
+			n += l.SessionCount
+		}
+		return float64(n)
+	},
+	"pageviews": func(m []storage.ScoredLead) float64 {
+		var n int
+		for _, l := range m {
+			n += l.PageViews
+		}
+		return float64(n)
+	},
+	"events_per_user": func(m []storage.ScoredLead) float64 {
+		if len(m) == 0 {
+			return 0
+		}
+		var n int
+		for _, l := range m {
+			n += l.EventCount
+		}
+		return float64(n) / float64(len(m))
+	},
+}
+
+// segmentResult is one side of a segment comparison.
+type segmentResult struct {
+	SegmentID string  `json:"segment_id"`
+	Name      string  `json:"name"`
+	Members   int     `json:"members"`
+	Value     float64 `json:"value"`
+}
+
+// compareSegmentsHandler handles GET /api/v1/compare?a=<segment>&b=<segment>&metric=...
+// It resolves each saved segment's members the same way as the members
+// endpoint and aggregates the metric over them. delta is b minus a;
+// delta_pct is relative to a and null when a is zero.
+func (s *Server) compareSegmentsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("a") == "" || q.Get("b") == "" {
+		apierror.Error(w, "a and b segment ids are required", http.StatusBadRequest)
+		return
+	}
+	metric := q.Get("metric")
+	if metric == "" {
+		metric = "events"
+	}
+	agg, ok := segmentMetrics[metric]
+	if !ok {
+		apierror.Error(w, "metric must be one of users, events, sessions, pageviews, events_per_user", http.StatusBadRequest)
+		return
+	}
+	end := time.Now().UTC()
+	start := end.Add(-30 * 24 * time.Hour)
+	if v := q.Get("start"); v != "" {
+		start, _ = time.Parse(time.RFC3339, v)
+	}
+	if v := q.Get("end"); v != "" {
+		end, _ = time.Parse(time.RFC3339, v)
+	}
+
+	var results [2]segmentResult
+	for i, id := range []string{q.Get("a"), q.Get("b")} {
+		seg, err := s.meta.GetSegment(r.Context(), project.ID, id)
+		if err != nil {
+			apierror.Error(w, "segment not found", http.StatusNotFound)
+			return
+		}
+		var conditions []storage.ScoringRule
+		if err := json.Unmarshal([]byte(seg.Conditions), &conditions); err != nil {
+			apierror.Error(w, "invalid conditions", http.StatusBadRequest)
+			return
+		}
+		members, err := s.events.SegmentMembers(r.Context(), project.ID, conditions, start, end)
+		if err != nil {
+			if r.Context().Err() != nil {
+				return
+			}
+			log.Printf("ERROR comparing segments: %v", err)
+			apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+			return
+		}
+		results[i] = segmentResult{SegmentID: seg.ID, Name: seg.Name, Members: len(members), Value: agg(members)}
+	}
+
+	delta := results[1].Value - results[0].Value
+	var deltaPct *float64
+	if results[0].Value != 0 {
+		pct := delta / results[0].Value * 100
+		deltaPct = &pct
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"metric":    metric,
+		"a":         results[0],
+		"b":         results[1],
+		"delta":     delta,
+		"delta_pct": deltaPct,
+	})
+}
+
 // ---- ICP settings handlers ---------------------------------------------------
 
 func (s *Server) getICPSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	autoRefresh, _ := s.meta.GetGrowthSetting(r.Context(), project.ID, "icp_auto_refresh")
@@ -4824,14 +6444,14 @@ func (s *Server) getICPSettingsHandler(w http.ResponseWriter, r *http.Request) {
 func (s *Server) putICPSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	project := auth.ProjectFromContext(r.Context())
 	if project == nil {
-		http.Error(w, `{"error":"unauthorized"}`, http.StatusUnauthorized)
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 	var body struct {
 		ICPAutoRefresh bool `json:"icp_auto_refresh"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		http.Error(w, `{"error":"invalid body"}`, http.StatusBadRequest)
+		apierror.ErrorCode(w, apierror.CodeInvalidJSON, "invalid body", http.StatusBadRequest)
 		return
 	}
 	val := "false"
@@ -4839,7 +6459,7 @@ func (s *Server) putICPSettingsHandler(w http.ResponseWriter, r *http.Request) {
 		val = "true"
 	}
 	if err := s.meta.SetGrowthSetting(r.Context(), project.ID, "icp_auto_refresh", val); err != nil {
-		http.Error(w, `{"error":"save failed"}`, http.StatusInternalServerError)
+		apierror.Error(w, "save failed", http.StatusInternalServerError)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -0,0 +1,1358 @@
+package server
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/ratelimit"
+	"github.com/danielthedm/clicknest/internal/storage"
+
+	_ "github.com/marcboeker/go-duckdb"
+	_ "modernc.org/sqlite"
+)
+
+// newTestServer builds a Server backed by throwaway DuckDB and SQLite
+// databases and returns it along with a freshly created project.
+func newTestServer(t *testing.T, cfg Config) (*Server, *storage.Project) {
+	t.Helper()
+	dir := t.TempDir()
+	events, err := storage.NewDuckDB(filepath.Join(dir, "events.duckdb"))
+	if err != nil {
+		t.Fatalf("NewDuckDB: %v", err)
+	}
+	t.Cleanup(func() { events.Close() })
+	enc, err := storage.NewEncryptor(dir)
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	meta, err := storage.NewSQLite(filepath.Join(dir, "clicknest.db"), enc)
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { meta.Close() })
+
+	project, err := meta.CreateProject(context.Background(), "proj-1", "Test")
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	cfg.DataDir = dir
+	return New(cfg, events, meta, nil, nil, nil, nil), project
+}
+
+// authedRequest builds a request carrying the project and user in its context,
+// as the session middleware would.
+func authedRequest(method, target, body string, project *storage.Project, userID string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	ctx := auth.WithProject(r.Context(), project)
+	if userID != "" {
+		ctx = auth.WithUserID(ctx, userID)
+	}
+	return r.WithContext(ctx)
+}
+
+func TestAIChat_MessageTooLong(t *testing.T) {
+	s, project := newTestServer(t, Config{ChatMaxMessageLength: 10})
+
+	w := httptest.NewRecorder()
+	s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", `{"message":"this is far too long"}`, project, "user-1"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), "exceeds") {
+		t.Fatalf("expected length error, got %s", w.Body.String())
+	}
+}
+
+func TestAIChat_HistoryTooLong(t *testing.T) {
+	s, project := newTestServer(t, Config{ChatMaxHistory: 1})
+
+	body := `{"message":"hi","history":[{"role":"user","content":"a"},{"role":"assistant","content":"b"}]}`
+	w := httptest.NewRecorder()
+	s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", body, project, "user-1"))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestAIChat_RateLimited(t *testing.T) {
+	s, project := newTestServer(t, Config{ChatRatePerMinute: 2})
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"choices":[{"message":{"content":"hello"}}]}`)
+	}))
+	defer provider.Close()
+	key, baseURL := "sk-test", provider.URL
+	if err := s.meta.SetLLMConfig(context.Background(), storage.LLMConfig{
+		ProjectID: project.ID, Provider: "openai", APIKey: &key, BaseURL: &baseURL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Requests refused before the LLM call don't spend the budget.
+	for _, body := range []string{`{"message":""}`, `not json`, `{"message":"hi","history":[{"role":"user","content":"` + strings.Repeat("x", 5000) + `"}]}`} {
+		w := httptest.NewRecorder()
+		s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", body, project, "user-1"))
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("invalid request %.20q: expected 400, got %d: %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	var last *httptest.ResponseRecorder
+	for i := 0; i < 3; i++ {
+		last = httptest.NewRecorder()
+		s.aiChatHandler(last, authedRequest("POST", "/api/v1/ai/chat", `{"message":"hi"}`, project, "user-1"))
+		if i < 2 && last.Code != http.StatusOK {
+			t.Fatalf("request %d: expected 200, got %d: %s", i+1, last.Code, last.Body.String())
+		}
+	}
+	if last.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 on third request, got %d: %s", last.Code, last.Body.String())
+	}
+	if last.Header().Get("Retry-After") == "" {
+		t.Fatal("expected Retry-After header")
+	}
+
+	// A different user has their own bucket.
+	w := httptest.NewRecorder()
+	s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", `{"message":"hi"}`, project, "user-2"))
+	if w.Code == http.StatusTooManyRequests {
+		t.Fatal("expected other user not to be rate limited")
+	}
+}
+
+// archiveNames returns the file names in a .tar.gz body.
+func archiveNames(t *testing.T, body []byte) []string {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("tar: %v", err)
+		}
+		names = append(names, hdr.Name)
+	}
+	return names
+}
+
+func TestExport_IncludesKeyByDefault(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+
+	w := httptest.NewRecorder()
+	s.exportHandler(w, authedRequest("GET", "/api/v1/export", "", project, ""))
+	if !slices.Contains(archiveNames(t, w.Body.Bytes()), ".encryption_key") {
+		t.Fatal("expected .encryption_key in default export")
+	}
+}
+
+func TestExport_ExcludeKey(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+
+	w := httptest.NewRecorder()
+	s.exportHandler(w, authedRequest("GET", "/api/v1/export?include_key=false", "", project, ""))
+	names := archiveNames(t, w.Body.Bytes())
+	if slices.Contains(names, ".encryption_key") {
+		t.Fatalf("expected .encryption_key to be omitted, got %v", names)
+	}
+	if !slices.Contains(names, "clicknest.db") {
+		t.Fatalf("expected clicknest.db in export, got %v", names)
+	}
+}
+
+func TestMigrations_AppliedAndPending(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+
+	// Forget one applied SQLite migration so it shows up as pending.
+	if _, err := s.meta.DB().Exec(`DELETE FROM schema_migrations WHERE filename = '027_identity_aliases.sql'`); err != nil {
+		t.Fatal(err)
+	}
+
+	var status map[string]migrationReport
+	w := httptest.NewRecorder()
+	s.migrationsHandler(w, authedRequest("GET", "/api/v1/admin/migrations", "", project, ""))
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(status["duckdb"].Pending) != 0 || len(status["duckdb"].Applied) == 0 {
+		t.Fatalf("expected all duckdb migrations applied, got %+v", status["duckdb"])
+	}
+	sqlite := status["sqlite"]
+	if len(sqlite.Pending) != 1 || sqlite.Pending[0].Filename != "027_identity_aliases.sql" {
+		t.Fatalf("expected 027 pending, got %+v", sqlite.Pending)
+	}
+
+	adminID, memberID := seedInstanceUsers(t, s, project)
+	w = httptest.NewRecorder()
+	s.runMigrationsHandler(w, authedRequest("POST", "/api/v1/admin/migrations/run", "", project, memberID))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("member: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.runMigrationsHandler(w, authedRequest("POST", "/api/v1/admin/migrations/run", "", project, adminID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	status = nil
+	if err := json.NewDecoder(w.Body).Decode(&status); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(status["sqlite"].Pending) != 0 {
+		t.Fatalf("expected no pending migrations after run, got %+v", status["sqlite"].Pending)
+	}
+}
+
+// seedInstanceUsers creates the setup account, which is the instance admin,
+// and a later account that is only a member of project.
+func seedInstanceUsers(t *testing.T, s *Server, project *storage.Project) (adminID, memberID string) {
+	t.Helper()
+	ctx := context.Background()
+	admin, err := s.meta.CreateUser(ctx, "admin@example.com", "x")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	member, err := s.meta.CreateUser(ctx, "member@example.com", "x")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	if err := s.meta.AddProjectMember(ctx, admin.ID, project.ID, "owner"); err != nil {
+		t.Fatalf("AddProjectMember: %v", err)
+	}
+	if err := s.meta.AddProjectMember(ctx, member.ID, project.ID, "owner"); err != nil {
+		t.Fatalf("AddProjectMember: %v", err)
+	}
+	return admin.ID, member.ID
+}
+
+func TestMigrationRollback_RequiresInstanceAdmin(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	adminID, memberID := seedInstanceUsers(t, s, project)
+	body := `{"database":"sqlite","filename":"027_identity_aliases.sql"}`
+
+	w := httptest.NewRecorder()
+	s.rollbackMigrationHandler(w, authedRequest("POST", "/api/v1/admin/migrations/rollback", body, project, memberID))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("member: expected 403, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.rollbackMigrationHandler(w, authedRequest("POST", "/api/v1/admin/migrations/rollback",
+		`{"database":"sqlite","filename":"999_missing.sql"}`, project, adminID))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown migration: expected 400, got %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	s.rollbackMigrationHandler(w, authedRequest("POST", "/api/v1/admin/migrations/rollback", body, project, adminID))
+	if w.Code != http.StatusOK {
+		t.Fatalf("admin: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPutQuota_RequiresInstanceAdmin(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	adminID, memberID := seedInstanceUsers(t, s, project)
+	ctx := context.Background()
+	if err := s.meta.SetEventQuota(ctx, project.ID, 1000); err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.meta.CreateProject(ctx, "proj-2", "Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Project owners can't lift the cap on their own project.
+	w := httptest.NewRecorder()
+	s.putQuotaHandler(w, authedRequest("PUT", "/api/v1/admin/quota", `{"monthly_event_quota":0}`, project, memberID))
+	assertAPIError(t, "member", w, http.StatusForbidden, "forbidden")
+	if q := s.meta.EventQuota(ctx, project.ID); q != 1000 {
+		t.Fatalf("quota changed by member: %d", q)
+	}
+
+	w = httptest.NewRecorder()
+	s.putQuotaHandler(w, authedRequest("PUT", "/api/v1/admin/quota", `{"monthly_event_quota":500,"project_id":"proj-2"}`, project, adminID))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("admin: expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if q := s.meta.EventQuota(ctx, other.ID); q != 500 {
+		t.Fatalf("expected proj-2 quota 500, got %d", q)
+	}
+	if q := s.meta.EventQuota(ctx, project.ID); q != 1000 {
+		t.Fatalf("session project quota changed: %d", q)
+	}
+
+	w = httptest.NewRecorder()
+	s.putQuotaHandler(w, authedRequest("PUT", "/api/v1/admin/quota", `{"monthly_event_quota":5,"project_id":"nope"}`, project, adminID))
+	assertAPIError(t, "unknown project", w, http.StatusNotFound, "not_found")
+}
+
+func seedPendingName(t *testing.T, s *Server, projectID, fp, name string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := s.events.InsertEvents(ctx, []storage.Event{{
+		ProjectID: projectID, SessionID: "s1", EventType: "click", Fingerprint: fp,
+		URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC(),
+	}}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	if err := s.meta.SetEventName(ctx, storage.EventName{
+		ProjectID: projectID, Fingerprint: fp, AIName: name, Status: storage.NamePending,
+	}); err != nil {
+		t.Fatalf("SetEventName: %v", err)
+	}
+}
+
+func TestNameReview_Approve(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedPendingName(t, s, project.ID, "fp1", "Click Buy")
+
+	w := httptest.NewRecorder()
+	s.listPendingNamesHandler(w, authedRequest("GET", "/api/v1/names/pending", "", project, ""))
+	if !strings.Contains(w.Body.String(), `"fingerprint":"fp1"`) {
+		t.Fatalf("expected fp1 in pending list, got %s", w.Body.String())
+	}
+
+	r := authedRequest("POST", "/api/v1/names/fp1/approve", "", project, "")
+	r.SetPathValue("fp", "fp1")
+	w = httptest.NewRecorder()
+	s.approveNameHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	en, err := s.meta.GetEventName(context.Background(), project.ID, "fp1")
+	if err != nil || en.Status != storage.NameApproved || en.DisplayName() != "Click Buy" {
+		t.Fatalf("expected approved name, got %+v (%v)", en, err)
+	}
+	events, err := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID})
+	if err != nil || len(events) != 1 || events[0].EventName == nil || *events[0].EventName != "Click Buy" {
+		t.Fatalf("expected event backfilled with approved name, got %+v (%v)", events, err)
+	}
+}
+
+func TestNameReview_Reject(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedPendingName(t, s, project.ID, "fp1", "Click Buy")
+	seedPendingName(t, s, project.ID, "fp2", "Click Sell")
+
+	r := authedRequest("POST", "/api/v1/names/fp1/reject", "", project, "")
+	r.SetPathValue("fp", "fp1")
+	w := httptest.NewRecorder()
+	s.rejectNameHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	en, err := s.meta.GetEventName(context.Background(), project.ID, "fp1")
+	if err != nil || en.Status != storage.NameRejected || en.DisplayName() != "" {
+		t.Fatalf("expected rejected name hidden, got %+v (%v)", en, err)
+	}
+
+	// A rejected name can't be approved after the fact.
+	r = authedRequest("POST", "/api/v1/names/fp1/approve", "", project, "")
+	r.SetPathValue("fp", "fp1")
+	w = httptest.NewRecorder()
+	s.approveNameHandler(w, r)
+	assertAPIError(t, "approve rejected", w, http.StatusConflict, apierror.CodeConflict)
+	if en, _ := s.meta.GetEventName(context.Background(), project.ID, "fp1"); en == nil || en.Status != storage.NameRejected {
+		t.Fatalf("expected the name to stay rejected, got %+v", en)
+	}
+
+	// Requeue discards the name entirely so it can be regenerated.
+	r = authedRequest("POST", "/api/v1/names/fp2/reject", `{"requeue":true}`, project, "")
+	r.SetPathValue("fp", "fp2")
+	w = httptest.NewRecorder()
+	s.rejectNameHandler(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if _, err := s.meta.GetEventName(context.Background(), project.ID, "fp2"); err == nil {
+		t.Fatal("expected requeued name to be removed")
+	}
+
+	events, _ := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID})
+	for _, e := range events {
+		if e.EventName != nil {
+			t.Fatalf("rejected names must not be backfilled, got %q", *e.EventName)
+		}
+	}
+}
+
+func TestPrimaryEvent_HighlightedInSummary(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	now := time.Now().UTC()
+	signup := "Signup"
+	var events []storage.Event
+	for i := 0; i < 3; i++ {
+		events = append(events, storage.Event{
+			ProjectID: project.ID, SessionID: "s1", EventType: "click", EventName: &signup,
+			URL: "https://example.com/", URLPath: "/", Timestamp: now.Add(-time.Duration(i) * time.Hour),
+		})
+	}
+	events = append(events, storage.Event{
+		ProjectID: project.ID, SessionID: "s2", EventType: "click", EventName: &signup,
+		URL: "https://example.com/", URLPath: "/", Timestamp: now.Add(-9 * 24 * time.Hour),
+	})
+	if err := s.events.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	s.putPrimaryEventHandler(w, authedRequest("PUT", "/api/v1/settings/primary-event", `{"event_name":" Signup "}`, project, ""))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var overview struct {
+		PrimaryEvent *primaryEventKPI `json:"primary_event"`
+	}
+	w = httptest.NewRecorder()
+	s.overviewHandler(w, authedRequest("GET", "/api/v1/overview", "", project, ""))
+	if err := json.NewDecoder(w.Body).Decode(&overview); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	kpi := overview.PrimaryEvent
+	if kpi == nil || kpi.EventName != "Signup" || kpi.Total != 3 || kpi.PreviousTotal != 1 {
+		t.Fatalf("unexpected primary event KPI: %+v", kpi)
+	}
+
+	prompt := buildAnalyticsSystemPrompt("", kpi, []storage.TrendPoint{{Bucket: "2026-01-01", Count: 10}}, nil, nil)
+	primaryAt := strings.Index(prompt, `PRIMARY EVENT (the product's key metric): "Signup" — 3 in the last 7 days, +200% vs the previous 7 days`)
+	volumeAt := strings.Index(prompt, "EVENT VOLUME")
+	if primaryAt < 0 || volumeAt < 0 || primaryAt > volumeAt {
+		t.Fatalf("expected primary event section ahead of event volume, got:\n%s", prompt)
+	}
+
+	// Clearing the setting removes it from the overview.
+	w = httptest.NewRecorder()
+	s.putPrimaryEventHandler(w, authedRequest("PUT", "/api/v1/settings/primary-event", `{"event_name":""}`, project, ""))
+	w = httptest.NewRecorder()
+	s.overviewHandler(w, authedRequest("GET", "/api/v1/overview", "", project, ""))
+	if !strings.Contains(w.Body.String(), `"primary_event":null`) {
+		t.Fatalf("expected null primary_event after clearing, got %s", w.Body.String())
+	}
+}
+
+func TestCheckAlerts_SlowAlertDoesNotBlockOthers(t *testing.T) {
+	interval := 2 * time.Second
+	s, project := newTestServer(t, Config{AlertInterval: interval, AlertWorkers: 2})
+	ctx := context.Background()
+	if err := s.events.InsertEvents(ctx, []storage.Event{{
+		ProjectID: project.ID, SessionID: "s1", EventType: "error",
+		URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC(),
+	}}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+	fired := make(chan time.Duration, 2)
+	var start time.Time
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fired <- time.Since(start)
+	}))
+	defer fast.Close()
+
+	for i, url := range []string{fast.URL, fast.URL, slow.URL} {
+		if err := s.meta.CreateAlert(ctx, storage.Alert{
+			ID: "alert-" + strconv.Itoa(i), ProjectID: project.ID, Name: "errors", Metric: "error_count",
+			Threshold: 0, WindowMinutes: 60, WebhookURL: url, Enabled: true,
+		}); err != nil {
+			t.Fatalf("CreateAlert: %v", err)
+		}
+	}
+
+	start = time.Now()
+	s.checkAlerts(ctx)
+	if elapsed := time.Since(start); elapsed >= interval {
+		t.Fatalf("expected the pass to finish within the %v interval, took %v", interval, elapsed)
+	}
+	close(fired)
+	var n int
+	for d := range fired {
+		n++
+		if d >= interval/2 {
+			t.Fatalf("fast alert waited %v behind the slow one", d)
+		}
+	}
+	if n != 2 {
+		t.Fatalf("expected both fast alerts to fire, got %d", n)
+	}
+}
+
+func TestEvaluateAlert_SignsWebhook(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	if err := s.events.InsertEvents(ctx, []storage.Event{{
+		ProjectID: project.ID, SessionID: "s1", EventType: "error",
+		URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC(),
+	}}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	type delivery struct {
+		sig  string
+		body []byte
+	}
+	got := make(chan delivery, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- delivery{r.Header.Get("X-ClickNest-Signature"), body}
+	}))
+	defer receiver.Close()
+
+	w := httptest.NewRecorder()
+	s.createAlertHandler(w, authedRequest("POST", "/api/v1/alerts",
+		`{"name":"errors","metric":"error_count","threshold":0,"webhook_url":"`+receiver.URL+`"}`, project, ""))
+	var created storage.Alert
+	if w.Code != http.StatusCreated || json.NewDecoder(w.Body).Decode(&created) != nil || created.Secret == "" {
+		t.Fatalf("expected the created alert with its secret, got %d: %s", w.Code, w.Body.String())
+	}
+	var stored string
+	if err := s.meta.DB().QueryRow(`SELECT secret FROM alerts WHERE id = ?`, created.ID).Scan(&stored); err != nil {
+		t.Fatalf("reading stored secret: %v", err)
+	}
+	if stored == created.Secret {
+		t.Fatal("expected the secret to be stored encrypted")
+	}
+
+	alerts, err := s.meta.ListAlerts(ctx, project.ID)
+	if err != nil || len(alerts) != 1 {
+		t.Fatalf("ListAlerts: %v (%d alerts)", err, len(alerts))
+	}
+	s.evaluateAlert(ctx, alerts[0])
+	d := <-got
+	mac := hmac.New(sha256.New, []byte(created.Secret))
+	mac.Write(d.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); d.sig != want {
+		t.Fatalf("signature %q does not match the body (want %q)", d.sig, want)
+	}
+}
+
+func TestEvaluateAlert_RetriesAndRecordsOnlySuccess(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	s.alertBackoff = []time.Duration{time.Millisecond, time.Millisecond, time.Millisecond}
+	ctx := context.Background()
+	if err := s.events.InsertEvents(ctx, []storage.Event{{
+		ProjectID: project.ID, SessionID: "s1", EventType: "error",
+		URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC(),
+	}}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	// failFirst answers 503 that many times before accepting.
+	evaluate := func(id string, failFirst int) (attempts int, triggered bool) {
+		t.Helper()
+		receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			attempts++
+			if attempts <= failFirst {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer receiver.Close()
+		if err := s.meta.CreateAlert(ctx, storage.Alert{
+			ID: id, ProjectID: project.ID, Name: id, Metric: "error_count",
+			Threshold: 0, WindowMinutes: 60, WebhookURL: receiver.URL, Enabled: true,
+		}); err != nil {
+			t.Fatalf("CreateAlert: %v", err)
+		}
+		alerts, _ := s.meta.ListAlerts(ctx, project.ID)
+		for _, a := range alerts {
+			if a.ID == id {
+				s.evaluateAlert(ctx, a)
+			}
+		}
+		alerts, _ = s.meta.ListAlerts(ctx, project.ID)
+		for _, a := range alerts {
+			if a.ID == id {
+				return attempts, a.LastTriggeredAt != nil
+			}
+		}
+		t.Fatalf("alert %s not found", id)
+		return
+	}
+
+	if attempts, triggered := evaluate("flaky", 2); attempts != 3 || !triggered {
+		t.Fatalf("flaky receiver: expected 3 attempts and a recorded trigger, got %d, %v", attempts, triggered)
+	}
+	if attempts, triggered := evaluate("down", 100); attempts != 4 || triggered {
+		t.Fatalf("down receiver: expected 4 attempts and no recorded trigger, got %d, %v", attempts, triggered)
+	}
+}
+
+func TestEvaluateAlert_EventRateChange(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	fired := 0
+	var body map[string]any
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fired++
+		json.NewDecoder(r.Body).Decode(&body)
+	}))
+	defer receiver.Close()
+	alert := storage.Alert{ID: "rate", ProjectID: project.ID, Name: "signups up", Metric: "event_rate_change",
+		EventName: "Signup", Threshold: 100, WindowMinutes: 60, WebhookURL: receiver.URL, Enabled: true}
+
+	insert := func(n int, ago time.Duration) {
+		t.Helper()
+		name := "Signup"
+		var events []storage.Event
+		for range n {
+			events = append(events, storage.Event{ProjectID: project.ID, SessionID: "s1", EventType: "custom",
+				EventName: &name, URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC().Add(-ago)})
+		}
+		if err := s.events.InsertEvents(ctx, events); err != nil {
+			t.Fatalf("InsertEvents: %v", err)
+		}
+	}
+
+	// First data with nothing in the previous window never fires.
+	insert(5, 10*time.Minute)
+	s.evaluateAlert(ctx, alert)
+	if fired != 0 {
+		t.Fatal("expected no alert without a previous window to compare with")
+	}
+
+	// 5 now against 3 before is +67%, under the 100% threshold.
+	insert(3, 90*time.Minute)
+	s.evaluateAlert(ctx, alert)
+	if fired != 0 {
+		t.Fatal("expected no alert for a rise under the threshold")
+	}
+
+	// 8 now against 3 before is +167%.
+	insert(3, 5*time.Minute)
+	s.evaluateAlert(ctx, alert)
+	if fired != 1 {
+		t.Fatalf("expected the alert to fire once, fired %d times", fired)
+	}
+	if body["previous_count"] != float64(3) || body["change_pct"] != 166.7 {
+		t.Fatalf("unexpected payload: %v", body)
+	}
+}
+
+func TestEvaluateAlert_SlackFormat(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	var events []storage.Event
+	for range 3 {
+		events = append(events, storage.Event{ProjectID: project.ID, SessionID: "s1", EventType: "error",
+			URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC()})
+	}
+	if err := s.events.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	got := make(chan map[string]any, 1)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		got <- body
+	}))
+	defer receiver.Close()
+
+	w := httptest.NewRecorder()
+	s.createAlertHandler(w, authedRequest("POST", "/api/v1/alerts",
+		`{"name":"Errors","metric":"error_count","threshold":1,"webhook_url":"`+receiver.URL+`","format":"teams"}`, project, ""))
+	assertAPIError(t, "unknown format", w, http.StatusBadRequest, "invalid_request")
+
+	w = httptest.NewRecorder()
+	s.createAlertHandler(w, authedRequest("POST", "/api/v1/alerts",
+		`{"name":"Errors","metric":"error_count","threshold":1,"webhook_url":"`+receiver.URL+`","format":"slack"}`, project, ""))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+	alerts, _ := s.meta.ListAlerts(ctx, project.ID)
+	if len(alerts) != 1 || alerts[0].Format != storage.AlertFormatSlack {
+		t.Fatalf("expected one slack alert, got %+v", alerts)
+	}
+	s.evaluateAlert(ctx, alerts[0])
+	body := <-got
+	if len(body) != 1 || body["text"] != "⚠️ Alert 'Errors' fired: 3 errors in 60m (threshold 1)" {
+		t.Fatalf("unexpected slack body: %v", body)
+	}
+}
+
+func TestNameElement_ReturnsLatestDOMContext(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	now := time.Now().UTC()
+	if err := s.events.InsertEvents(context.Background(), []storage.Event{
+		{ProjectID: project.ID, SessionID: "s1", EventType: "click", Fingerprint: "fp1", ElementTag: "a",
+			ElementText: "Old", URL: "https://example.com/old", URLPath: "/old", Timestamp: now.Add(-time.Hour)},
+		{ProjectID: project.ID, SessionID: "s1", EventType: "click", Fingerprint: "fp1", ElementTag: "button",
+			ElementID: "buy", ElementClasses: "btn primary", ElementText: "Buy now", ParentPath: "form > div",
+			URL: "https://example.com/pricing", URLPath: "/pricing", PageTitle: "Pricing", Timestamp: now},
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	get := func(fp string) *httptest.ResponseRecorder {
+		r := authedRequest("GET", "/api/v1/names/"+fp+"/element", "", project, "")
+		r.SetPathValue("fp", fp)
+		w := httptest.NewRecorder()
+		s.nameElementHandler(w, r)
+		return w
+	}
+
+	w := get("fp1")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var el map[string]string
+	if err := json.NewDecoder(w.Body).Decode(&el); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := map[string]string{"fingerprint": "fp1", "element_tag": "button", "element_id": "buy",
+		"element_classes": "btn primary", "element_text": "Buy now", "parent_path": "form > div",
+		"url": "https://example.com/pricing", "page_title": "Pricing"}
+	for k, v := range want {
+		if el[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, el[k])
+		}
+	}
+
+	assertAPIError(t, "unknown fingerprint", get("nope"), http.StatusNotFound, "not_found")
+}
+
+func TestListNames_ConfidenceFlag(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	for fp, conf := range map[string]float64{"fp-low": 0.3, "fp-mid": 0.6, "fp-high": 0.9} {
+		c := conf
+		if err := s.meta.SetEventName(ctx, storage.EventName{
+			ProjectID: project.ID, Fingerprint: fp, AIName: "Name " + fp, Confidence: &c, Status: storage.NameApproved,
+		}); err != nil {
+			t.Fatalf("SetEventName: %v", err)
+		}
+	}
+
+	type listed struct {
+		Fingerprint   string   `json:"fingerprint"`
+		Confidence    *float64 `json:"confidence"`
+		LowConfidence bool     `json:"low_confidence"`
+	}
+	list := func(query string) []listed {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.listNamesHandler(w, authedRequest("GET", "/api/v1/names"+query, "", project, ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Names []listed `json:"names"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp.Names
+	}
+
+	names := list("?sort=confidence")
+	if len(names) != 3 || names[0].Fingerprint != "fp-low" || names[2].Fingerprint != "fp-high" {
+		t.Fatalf("expected names sorted by confidence, got %+v", names)
+	}
+	for _, n := range names {
+		if n.Confidence == nil {
+			t.Fatalf("expected confidence for %s", n.Fingerprint)
+		}
+		if n.LowConfidence != (n.Fingerprint == "fp-low") {
+			t.Fatalf("unexpected low_confidence for %s at default threshold: %+v", n.Fingerprint, n)
+		}
+	}
+
+	// Raising the threshold flags the middle name too.
+	w := httptest.NewRecorder()
+	s.putNameReviewSettingsHandler(w, authedRequest("PUT", "/api/v1/names/review-settings", `{"low_confidence_threshold":0.7}`, project, ""))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d: %s", w.Code, w.Body.String())
+	}
+	if low := list("?low_confidence=true"); len(low) != 2 {
+		t.Fatalf("expected 2 low-confidence names, got %+v", low)
+	}
+	if got := list("?min_confidence=0.5"); len(got) != 2 || slices.ContainsFunc(got, func(n listed) bool { return n.Fingerprint == "fp-low" }) {
+		t.Fatalf("expected min_confidence to drop fp-low, got %+v", got)
+	}
+	if s.meta.NameReviewEnabled(ctx, project.ID) {
+		t.Fatal("setting the threshold alone must not change require_review")
+	}
+}
+
+func TestCompareSegments_EventCounts(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	now := time.Now().UTC()
+	ev := func(user, session, device string) storage.Event {
+		return storage.Event{
+			ProjectID: project.ID, SessionID: session, DistinctID: user, EventType: "click",
+			URL: "https://example.com/", URLPath: "/", Timestamp: now.Add(-time.Hour),
+			Properties: map[string]any{"device": device},
+		}
+	}
+	// Two mobile users with 3 events between them; one desktop user with 4.
+	if err := s.events.InsertEvents(ctx, []storage.Event{
+		ev("m1", "s1", "mobile"), ev("m1", "s1", "mobile"), ev("m2", "s2", "mobile"),
+		ev("d1", "s3", "desktop"), ev("d1", "s3", "desktop"), ev("d1", "s4", "desktop"), ev("d1", "s4", "desktop"),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	segment := func(name, device string) string {
+		cond := `[{"rule_type":"property_match","config":"{\"property_key\":\"device\",\"property_value\":\"` + device + `\"}","points":1,"enabled":true}]`
+		seg, err := s.meta.CreateSegment(ctx, project.ID, name, cond)
+		if err != nil {
+			t.Fatalf("CreateSegment: %v", err)
+		}
+		return seg.ID
+	}
+	mobile, desktop := segment("Mobile", "mobile"), segment("Desktop", "desktop")
+
+	w := httptest.NewRecorder()
+	s.compareSegmentsHandler(w, authedRequest("GET", "/api/v1/compare?a="+mobile+"&b="+desktop+"&metric=events", "", project, ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		A, B     segmentResult
+		Delta    float64  `json:"delta"`
+		DeltaPct *float64 `json:"delta_pct"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.A.Name != "Mobile" || resp.A.Members != 2 || resp.A.Value != 3 {
+		t.Fatalf("unexpected mobile result: %+v", resp.A)
+	}
+	if resp.B.Name != "Desktop" || resp.B.Members != 1 || resp.B.Value != 4 {
+		t.Fatalf("unexpected desktop result: %+v", resp.B)
+	}
+	if resp.Delta != 1 || resp.DeltaPct == nil || math.Abs(*resp.DeltaPct-100.0/3) > 0.01 {
+		t.Fatalf("expected delta 1 (+33.3%%), got %v / %v", resp.Delta, resp.DeltaPct)
+	}
+
+	w = httptest.NewRecorder()
+	s.compareSegmentsHandler(w, authedRequest("GET", "/api/v1/compare?a="+mobile+"&b="+desktop+"&metric=bogus", "", project, ""))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown metric, got %d", w.Code)
+	}
+}
+
+func TestErrorResponses_Structured(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+
+	cases := []struct {
+		name   string
+		req    *http.Request
+		status int
+		code   string
+	}{
+		{"no session", httptest.NewRequest("GET", "/api/v1/funnels", nil), http.StatusUnauthorized, apierror.CodeUnauthorized},
+		{"bad ingest json", func() *http.Request {
+			r := httptest.NewRequest("POST", "/api/v1/events", strings.NewReader("{"))
+			r.Header.Set("X-API-Key", project.APIKey)
+			return r
+		}(), http.StatusBadRequest, apierror.CodeInvalidJSON},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, tc.req)
+		assertAPIError(t, tc.name, w, tc.status, tc.code)
+	}
+
+	w := httptest.NewRecorder()
+	s.createWidgetHandler(w, authedRequest("POST", "/api/v1/widgets", `{"name":"x","metric":"revenue"}`, project, "admin"))
+	assertAPIError(t, "bad widget metric", w, http.StatusBadRequest, apierror.CodeInvalidRequest)
+}
+
+func assertAPIError(t *testing.T, name string, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	if w.Code != status {
+		t.Errorf("%s: status %d, want %d", name, w.Code, status)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("%s: Content-Type %q", name, ct)
+	}
+	var body apierror.Body
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("%s: decode %q: %v", name, w.Body, err)
+	}
+	if body.Error.Code != code || body.Error.Message == "" {
+		t.Errorf("%s: error = %+v, want code %q with a message", name, body.Error, code)
+	}
+}
+
+func TestAIHandlers_LLMNotConfigured(t *testing.T) {
+	t.Setenv("DEFAULT_LLM_PROVIDER", "")
+	s, project := newTestServer(t, Config{})
+	chat := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", `{"message":"how are signups?"}`, project, "u1"))
+		return w
+	}
+	suggest := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.suggestFunnelsHandler(w, authedRequest("POST", "/api/v1/funnels/suggest", "", project, "u1"))
+		return w
+	}
+
+	assertAPIError(t, "chat unconfigured", chat(), http.StatusServiceUnavailable, apierror.CodeLLMNotConfigured)
+	assertAPIError(t, "suggest unconfigured", suggest(), http.StatusServiceUnavailable, apierror.CodeLLMNotConfigured)
+
+	// Once a provider is configured, its failures are ordinary errors.
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"message":"upstream exploded"}}`, http.StatusInternalServerError)
+	}))
+	defer provider.Close()
+	key, baseURL := "sk-test", provider.URL
+	if err := s.meta.SetLLMConfig(context.Background(), storage.LLMConfig{
+		ProjectID: project.ID, Provider: "openai", APIKey: &key, BaseURL: &baseURL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	assertAPIError(t, "chat provider failure", chat(), http.StatusInternalServerError, apierror.CodeInternal)
+	assertAPIError(t, "suggest without data", suggest(), http.StatusBadRequest, apierror.CodeInvalidRequest)
+}
+
+func TestAIChat_StreamsReply(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	streaming := true
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case req.Stream && !streaming:
+			http.Error(w, `{"error":{"message":"stream is not supported for this model"}}`, http.StatusBadRequest)
+		case req.Stream:
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, tok := range []string{"Signups ", "are ", "up."} {
+				fmt.Fprintf(w, "data: {\"choices\":[{\"delta\":{\"content\":%q}}]}\n\n", tok)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+		default:
+			fmt.Fprint(w, `{"choices":[{"message":{"content":"Signups are up."}}]}`)
+		}
+	}))
+	defer provider.Close()
+	key, baseURL := "sk-test", provider.URL
+	if err := s.meta.SetLLMConfig(context.Background(), storage.LLMConfig{
+		ProjectID: project.ID, Provider: "openai", APIKey: &key, BaseURL: &baseURL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// chat returns the content deltas of the stream and whether it ended
+	// with [DONE].
+	chat := func() ([]string, bool) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.aiChatHandler(w, authedRequest("POST", "/api/v1/ai/chat", `{"message":"how are signups?","stream":true}`, project, "u1"))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("expected an event stream, got %d %q: %s", w.Code, w.Header().Get("Content-Type"), w.Body)
+		}
+		var deltas []string
+		done := false
+		for line := range strings.SplitSeq(w.Body.String(), "\n") {
+			data, ok := strings.CutPrefix(line, "data: ")
+			if !ok {
+				continue
+			}
+			if data == "[DONE]" {
+				done = true
+				continue
+			}
+			var c chatChunk
+			if err := json.Unmarshal([]byte(data), &c); err != nil || len(c.Choices) != 1 || c.Object != "chat.completion.chunk" {
+				t.Fatalf("bad chunk %q: %v", data, err)
+			}
+			if content := c.Choices[0].Delta["content"]; content != "" {
+				deltas = append(deltas, content)
+			}
+		}
+		return deltas, done
+	}
+
+	deltas, done := chat()
+	if !slices.Equal(deltas, []string{"Signups ", "are ", "up."}) || !done {
+		t.Errorf("streamed deltas = %q (done %v), want each token then [DONE]", deltas, done)
+	}
+
+	// A model that rejects streaming still answers, in one delta.
+	streaming = false
+	deltas, done = chat()
+	if !slices.Equal(deltas, []string{"Signups are up."}) || !done {
+		t.Errorf("fallback deltas = %q (done %v), want the buffered reply", deltas, done)
+	}
+}
+
+func TestFlagsAndAlerts_BoundsValidated(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	call := func(h http.HandlerFunc, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h(w, authedRequest("POST", "/", body, project, ""))
+		return w
+	}
+
+	assertAPIError(t, "rollout 150", call(s.createFlagHandler, `{"key":"a","name":"A","rollout_percentage":150}`),
+		http.StatusBadRequest, apierror.CodeInvalidRequest)
+	assertAPIError(t, "rollout -1", call(s.createFlagHandler, `{"key":"a","name":"A","rollout_percentage":-1}`),
+		http.StatusBadRequest, apierror.CodeInvalidRequest)
+	var flag storage.FeatureFlag
+	w := call(s.createFlagHandler, `{"key":"b","name":"B"}`)
+	if w.Code != http.StatusCreated || json.NewDecoder(w.Body).Decode(&flag) != nil || flag.RolloutPercentage != 100 {
+		t.Fatalf("omitted rollout: expected 201 at 100%%, got %d %+v", w.Code, flag)
+	}
+	w = call(s.createFlagHandler, `{"key":"c","name":"C","rollout_percentage":0}`)
+	if w.Code != http.StatusCreated || json.NewDecoder(w.Body).Decode(&flag) != nil || flag.RolloutPercentage != 0 {
+		t.Fatalf("rollout 0: expected 201 at 0%%, got %d %+v", w.Code, flag)
+	}
+
+	alert := `{"name":"Spike","metric":"event_count","webhook_url":"https://example.com/hook"`
+	assertAPIError(t, "window 0", call(s.createAlertHandler, alert+`,"window_minutes":0}`),
+		http.StatusBadRequest, apierror.CodeInvalidRequest)
+	assertAPIError(t, "negative threshold", call(s.createAlertHandler, alert+`,"threshold":-5}`),
+		http.StatusBadRequest, apierror.CodeInvalidRequest)
+	var created storage.Alert
+	w = call(s.createAlertHandler, alert+`}`)
+	if w.Code != http.StatusCreated || json.NewDecoder(w.Body).Decode(&created) != nil || created.WindowMinutes != 60 {
+		t.Fatalf("omitted window: expected 201 with 60 minutes, got %d %+v", w.Code, created)
+	}
+}
+
+func TestEvaluateFlags_Conditions(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.createFlagHandler(w, authedRequest("POST", "/api/v1/flags", body, project, ""))
+		return w
+	}
+	assertAPIError(t, "unknown operator", create(`{"key":"x","name":"X","conditions":[{"property":"plan","operator":"gt","value":"1"}]}`),
+		http.StatusBadRequest, apierror.CodeInvalidRequest)
+	for _, body := range []string{
+		`{"key":"pro","name":"Pro","conditions":[{"property":"plan","operator":"is","value":"pro"}]}`,
+		`{"key":"not_free","name":"Not free","conditions":[{"property":"plan","operator":"is_not","value":"free"}]}`,
+		`{"key":"eu_pro","name":"EU pro","conditions":[{"property":"plan","operator":"is","value":"pro"},{"property":"region","operator":"contains","value":"eu"}]}`,
+		`{"key":"dark","name":"Dark","rollout_percentage":0,"conditions":[{"property":"plan","operator":"is","value":"pro"}]}`,
+		`{"key":"open","name":"Open"}`,
+	} {
+		if w := create(body); w.Code != http.StatusCreated {
+			t.Fatalf("create %s: %d %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	evaluate := func(query string) map[string]bool {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.evaluateFlagsHandler(w, authedRequest("GET", "/api/v1/flags/evaluate?distinct_id=u1"+query, "", project, ""))
+		var resp struct {
+			Flags map[string]struct {
+				Enabled bool `json:"enabled"`
+			} `json:"flags"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil {
+			t.Fatalf("evaluate %s: %d %s", query, w.Code, w.Body.String())
+		}
+		got := make(map[string]bool, len(resp.Flags))
+		for key, f := range resp.Flags {
+			got[key] = f.Enabled
+		}
+		return got
+	}
+	for query, want := range map[string]map[string]bool{
+		"&plan=pro&region=eu-west": {"pro": true, "not_free": true, "eu_pro": true, "dark": false, "open": true},
+		"&plan=pro&region=us-east": {"pro": true, "not_free": true, "eu_pro": false, "dark": false, "open": true},
+		"&plan=free":               {"pro": false, "not_free": false, "eu_pro": false, "dark": false, "open": true},
+		"":                         {"pro": false, "not_free": true, "eu_pro": false, "dark": false, "open": true},
+	} {
+		got := evaluate(query)
+		for key, v := range want {
+			if got[key] != v {
+				t.Errorf("%q: flag %s = %v, want %v", query, key, got[key], v)
+			}
+		}
+	}
+}
+
+func TestEvaluateFlags_Payload(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	for _, body := range []string{
+		`{"key":"theme","name":"Theme","payload":{"variant":"blue"}}`,
+		`{"key":"off","name":"Off","rollout_percentage":0,"payload":{"variant":"red"}}`,
+		`{"key":"plain","name":"Plain"}`,
+	} {
+		w := httptest.NewRecorder()
+		s.createFlagHandler(w, authedRequest("POST", "/api/v1/flags", body, project, ""))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: %d %s", body, w.Code, w.Body.String())
+		}
+	}
+
+	evaluate := func(query string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.evaluateFlagsHandler(w, authedRequest("GET", "/api/v1/flags/evaluate?distinct_id=u1"+query, "", project, ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("evaluate %s: %d %s", query, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Flags json.RawMessage `json:"flags"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return string(resp.Flags)
+	}
+
+	var full map[string]struct {
+		Enabled bool            `json:"enabled"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal([]byte(evaluate("")), &full); err != nil {
+		t.Fatalf("decode flags: %v", err)
+	}
+	if f := full["theme"]; !f.Enabled || string(f.Payload) != `{"variant":"blue"}` {
+		t.Errorf("theme: expected enabled with payload, got %+v", f)
+	}
+	if f := full["off"]; f.Enabled || string(f.Payload) != "null" {
+		t.Errorf("off: expected disabled without payload, got %v %s", f.Enabled, f.Payload)
+	}
+	if f := full["plain"]; !f.Enabled || string(f.Payload) != "null" {
+		t.Errorf("plain: expected enabled without payload, got %v %s", f.Enabled, f.Payload)
+	}
+
+	var simple map[string]bool
+	if err := json.Unmarshal([]byte(evaluate("&format=simple")), &simple); err != nil {
+		t.Fatalf("format=simple should return booleans: %v", err)
+	}
+	if !simple["theme"] || simple["off"] || !simple["plain"] {
+		t.Errorf("format=simple: unexpected flags %v", simple)
+	}
+}
+
+func TestEvaluateFlags_Variants(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	create := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.createFlagHandler(w, authedRequest("POST", "/api/v1/flags", body, project, ""))
+		return w
+	}
+	assertAPIError(t, "weights over 100", create(`{"key":"x","name":"X","variants":[{"key":"a","weight":60},{"key":"b","weight":50}]}`),
+		http.StatusBadRequest, apierror.CodeInvalidRequest)
+	assertAPIError(t, "duplicate variant", create(`{"key":"x","name":"X","variants":[{"key":"a","weight":50},{"key":"a","weight":50}]}`),
+		http.StatusBadRequest, apierror.CodeInvalidRequest)
+	w := create(`{"key":"color","name":"Color","variants":[{"key":"control","weight":50},{"key":"blue","weight":25},{"key":"green","weight":25}]}`)
+	var flag storage.FeatureFlag
+	if w.Code != http.StatusCreated || json.NewDecoder(w.Body).Decode(&flag) != nil {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+
+	variant := func(distinctID string) string {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.evaluateFlagsHandler(w, authedRequest("GET", "/api/v1/flags/evaluate?distinct_id="+distinctID, "", project, ""))
+		var resp struct {
+			Flags map[string]struct {
+				Variant string `json:"variant"`
+			} `json:"flags"`
+		}
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&resp) != nil {
+			t.Fatalf("evaluate: %d %s", w.Code, w.Body.String())
+		}
+		return resp.Flags["color"].Variant
+	}
+	counts := map[string]int{}
+	for i := range 400 {
+		counts[variant("user-"+strconv.Itoa(i))]++
+	}
+	if counts["control"] < 160 || counts["blue"] < 60 || counts["green"] < 60 || counts[""] != 0 {
+		t.Fatalf("expected roughly a 50/25/25 split, got %v", counts)
+	}
+	if first := variant("user-7"); variant("user-7") != first {
+		t.Fatal("expected the same user to keep the same variant")
+	}
+
+	update := func(body string) *httptest.ResponseRecorder {
+		r := authedRequest("PUT", "/api/v1/flags/"+flag.ID, body, project, "")
+		r.SetPathValue("id", flag.ID)
+		w := httptest.NewRecorder()
+		s.updateFlagHandler(w, r)
+		return w
+	}
+	assertAPIError(t, "update weights under 100", update(`{"enabled":true,"rollout_percentage":100,"variants":[{"key":"a","weight":10}]}`),
+		http.StatusBadRequest, apierror.CodeInvalidRequest)
+	if w := update(`{"enabled":true,"rollout_percentage":100,"variants":[{"key":"solo","weight":100}]}`); w.Code != http.StatusOK {
+		t.Fatalf("update: %d %s", w.Code, w.Body.String())
+	}
+	if got := variant("user-7"); got != "solo" {
+		t.Fatalf("expected the updated variant, got %q", got)
+	}
+}
+
+func TestEvaluateFlags_LogExposure(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	s.flagLimiter = ratelimit.New(0, 1) // one logged evaluation, then capped
+	for _, body := range []string{
+		`{"key":"color","name":"Color","variants":[{"key":"blue","weight":100}]}`,
+		`{"key":"dark","name":"Dark","rollout_percentage":0}`,
+	} {
+		w := httptest.NewRecorder()
+		s.createFlagHandler(w, authedRequest("POST", "/api/v1/flags", body, project, ""))
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: %d %s", body, w.Code, w.Body.String())
+		}
+	}
+	evaluate := func(query string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.evaluateFlagsHandler(w, authedRequest("GET", "/api/v1/flags/evaluate?distinct_id=u1"+query, "", project, ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("evaluate %s: %d %s", query, w.Code, w.Body.String())
+		}
+	}
+	exposures := func() []storage.Event {
+		t.Helper()
+		events, err := s.events.QueryEvents(context.Background(), storage.EventFilter{ProjectID: project.ID, EventName: "$feature_flag_called"})
+		if err != nil {
+			t.Fatalf("QueryEvents: %v", err)
+		}
+		return events
+	}
+
+	// Exposures are bookkeeping, not visits: a one-pageview session stays
+	// a bounce and no flag-only session appears.
+	seedUserEvents(t, s, project.ID, "u1")
+	sessionStats := func() (storage.SessionStats, int64) {
+		t.Helper()
+		ctx := context.Background()
+		start, end := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+		st, err := s.events.QuerySessionStats(ctx, project.ID, start, end)
+		if err != nil {
+			t.Fatalf("QuerySessionStats: %v", err)
+		}
+		_, total, err := s.events.QuerySessions(ctx, project.ID,
+			storage.SessionFilter{EventFilter: storage.EventFilter{StartTime: start, EndTime: end}}, 10, 0)
+		if err != nil {
+			t.Fatalf("QuerySessions: %v", err)
+		}
+		return *st, total
+	}
+	statsBefore, totalBefore := sessionStats()
+
+	evaluate("")
+	evaluate("&log_exposure=true")
+	var logged []storage.Event
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if logged = exposures(); len(logged) > 0 {
+			break
+		}
+	}
+	got := map[string]any{}
+	for _, e := range logged {
+		if e.EventType != "custom" || e.DistinctID != "u1" {
+			t.Fatalf("unexpected exposure event %+v", e)
+		}
+		got[e.Properties["flag_key"].(string)] = e.Properties["variant"]
+	}
+	if len(logged) != 2 || got["color"] != "blue" || got["dark"] != "off" {
+		t.Fatalf("expected color=blue and dark=off exposures, got %v", got)
+	}
+	if stats, total := sessionStats(); stats != statsBefore || total != totalBefore {
+		t.Fatalf("exposures changed session stats: %+v (%d sessions), want %+v (%d)", stats, total, statsBefore, totalBefore)
+	}
+
+	// Over the cap, evaluation still answers but isn't logged.
+	evaluate("&log_exposure=true")
+	time.Sleep(50 * time.Millisecond)
+	if n := len(exposures()); n != 2 {
+		t.Fatalf("expected the capped evaluation unlogged, got %d exposures", n)
+	}
+}
+
+func TestSessionMiddleware_ProjectSelector(t *testing.T) {
+	s, first := newTestServer(t, Config{})
+	ctx := context.Background()
+	second, err := s.meta.CreateProject(ctx, "proj-2", "Second")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.meta.CreateProject(ctx, "proj-3", "Not mine"); err != nil {
+		t.Fatal(err)
+	}
+	user, err := s.meta.CreateUser(ctx, "a@example.com", "x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{first.ID, second.ID} {
+		if err := s.meta.AddProjectMember(ctx, user.ID, p, "owner"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	token, err := s.meta.CreateUserSession(ctx, user.ID, time.Now().Add(time.Hour), first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(target, header string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", target, nil)
+		r.AddCookie(&http.Cookie{Name: auth.SessionCookieName, Value: token})
+		if header != "" {
+			r.Header.Set(auth.ProjectHeader, header)
+		}
+		w := httptest.NewRecorder()
+		s.mux.ServeHTTP(w, r)
+		return w
+	}
+	projectID := func(w *httptest.ResponseRecorder) string {
+		t.Helper()
+		var p storage.Project
+		if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&p) != nil {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		return p.ID
+	}
+
+	if got := projectID(get("/api/v1/project", "")); got != first.ID {
+		t.Fatalf("no selector: expected the session project %s, got %s", first.ID, got)
+	}
+	if got := projectID(get("/api/v1/project", second.ID)); got != second.ID {
+		t.Fatalf("header: expected %s, got %s", second.ID, got)
+	}
+	if got := projectID(get("/api/v1/project?project="+second.ID, "")); got != second.ID {
+		t.Fatalf("query param: expected %s, got %s", second.ID, got)
+	}
+	assertAPIError(t, "non-member", get("/api/v1/project", "proj-3"), http.StatusForbidden, apierror.CodeForbidden)
+	assertAPIError(t, "unknown", get("/api/v1/project", "nope"), http.StatusNotFound, apierror.CodeNotFound)
+
+	var list struct {
+		Projects []storage.Project `json:"projects"`
+	}
+	if w := get("/api/v1/projects", ""); json.NewDecoder(w.Body).Decode(&list) != nil || len(list.Projects) != 2 {
+		t.Fatalf("expected the user's 2 projects listed, got %+v", list.Projects)
+	}
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/query"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestSQLQuery_ScopedReadOnlySelect(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	ctx := context.Background()
+	other, err := s.meta.CreateProject(ctx, "proj-2", "Other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []storage.Event
+	for i, pid := range []string{project.ID, project.ID, project.ID, other.ID} {
+		events = append(events, storage.Event{ProjectID: pid, SessionID: "s", EventType: "pageview",
+			URL: "https://example.com/", URLPath: "/", Timestamp: time.Now().UTC().Add(time.Duration(-i) * time.Minute)})
+	}
+	if err := s.events.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	h := query.NewHandler(s.events, s.meta)
+	run := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.SQLHandler(w, authedRequest("POST", "/api/v1/query/sql", body, project, ""))
+		return w
+	}
+	type result struct {
+		Columns   []string `json:"columns"`
+		Rows      [][]any  `json:"rows"`
+		Truncated bool     `json:"truncated"`
+	}
+
+	w := run(`{"sql": "WITH pv AS (SELECT * FROM events WHERE event_type = 'pageview') SELECT project_id, count(*) AS n FROM pv GROUP BY ALL; -- per project"}`)
+	var got result
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&got) != nil {
+		t.Fatalf("select: %d %s", w.Code, w.Body.String())
+	}
+	if strings.Join(got.Columns, ",") != "project_id,n" || len(got.Rows) != 1 || got.Rows[0][0] != project.ID || got.Rows[0][1] != float64(3) {
+		t.Fatalf("expected only the caller's 3 events, got %+v", got)
+	}
+
+	// Keywords inside literals and comments aren't statements.
+	w = run(`{"sql": "SELECT count(*) AS n FROM events WHERE event_name = 'Delete account' OR page_title = 'Update profile' /* load */ -- insert\n"}`)
+	got = result{}
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&got) != nil || len(got.Rows) != 1 {
+		t.Fatalf("keywords in literals: %d %s", w.Code, w.Body.String())
+	}
+
+	w = run(`{"sql": "SELECT id FROM events", "limit": 2}`)
+	got = result{}
+	if w.Code != http.StatusOK || json.NewDecoder(w.Body).Decode(&got) != nil || len(got.Rows) != 2 || !got.Truncated {
+		t.Fatalf("expected 2 rows and truncated, got %d %s", w.Code, w.Body.String())
+	}
+
+	for name, sql := range map[string]string{
+		"delete":          "DELETE FROM events",
+		"literal, load":   "SELECT 'x'; LOAD httpfs",
+		"write in select": "SELECT * FROM events; INSERT INTO events SELECT * FROM events",
+		"two statements":  "SELECT 1; SELECT 2",
+		"qualified table": "SELECT count(*) FROM main.events",
+		"other table":     "SELECT * FROM duckdb_settings",
+		"table function":  "SELECT * FROM read_csv('/etc/passwd')",
+		"host function":   "SELECT getenv('HOME')",
+		"shadowing cte":   "WITH duckdb_tables AS (SELECT 1) SELECT * FROM duckdb_tables",
+		"parse error":     "SELEC 1",
+		"binder error":    "SELECT missing_column FROM events",
+	} {
+		body, _ := json.Marshal(map[string]string{"sql": sql})
+		assertAPIError(t, name, run(string(body)), http.StatusBadRequest, "invalid_request")
+	}
+}
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/query"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+func TestTrendsMulti_AlignedSeries(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	signup := "Signup"
+	ev := func(eventType string, at time.Time, name *string) storage.Event {
+		return storage.Event{ProjectID: project.ID, SessionID: "s1", EventType: eventType, Fingerprint: "fp",
+			URL: "https://example.com/", URLPath: "/", Timestamp: at, EventName: name}
+	}
+	if err := s.events.InsertEvents(context.Background(), []storage.Event{
+		ev("pageview", hour.Add(5*time.Minute), nil),
+		ev("pageview", hour.Add(10*time.Minute), nil),
+		ev("custom", hour.Add(2*time.Hour+5*time.Minute), &signup),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	body := fmt.Sprintf(`{"interval":"hour","start":%q,"end":%q,"metrics":[
+		{"name":"Pageviews","event_type":"pageview"},
+		{"event_name":"Signup"}]}`,
+		hour.Format(time.RFC3339), hour.Add(2*time.Hour+30*time.Minute).Format(time.RFC3339))
+	w := httptest.NewRecorder()
+	query.NewHandler(s.events, s.meta).TrendsMultiHandler(w, authedRequest("POST", "/api/v1/trends/multi", body, project, ""))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Series []storage.TrendSeries `json:"series"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(resp.Series) != 2 || resp.Series[0].Name != "Pageviews" || resp.Series[1].Name != "Signup" {
+		t.Fatalf("unexpected series %+v", resp.Series)
+	}
+	pv, su := resp.Series[0].Data, resp.Series[1].Data
+	if len(pv) != 3 || len(su) != 3 {
+		t.Fatalf("expected 3 gap-filled buckets each, got %d and %d", len(pv), len(su))
+	}
+	want := [][2]int64{{2, 0}, {0, 0}, {0, 1}}
+	for i := range pv {
+		if pv[i].Bucket != su[i].Bucket {
+			t.Fatalf("bucket %d misaligned: %s vs %s", i, pv[i].Bucket, su[i].Bucket)
+		}
+		if pv[i].Count != want[i][0] || su[i].Count != want[i][1] {
+			t.Fatalf("bucket %s: got %d/%d, want %v", pv[i].Bucket, pv[i].Count, su[i].Count, want[i])
+		}
+	}
+}
+
+func TestTrendsMulti_MismatchedIntervals(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	w := httptest.NewRecorder()
+	query.NewHandler(s.events, s.meta).TrendsMultiHandler(w, authedRequest("POST", "/api/v1/trends/multi",
+		`{"metrics":[{"event_type":"pageview","interval":"hour"},{"event_type":"click","interval":"day"}]}`, project, ""))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400, got %d", w.Code)
+	}
+}
+
+func TestTrends_ClientDisconnected(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	r := authedRequest("GET", "/api/v1/trends", "", project, "")
+	ctx, cancel := context.WithCancel(r.Context())
+	cancel()
+
+	w := httptest.NewRecorder()
+	query.NewHandler(s.events, s.meta).TrendsHandler(w, r.WithContext(ctx))
+	if w.Body.Len() != 0 {
+		t.Fatalf("expected no response for a disconnected client, got %d: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestTrends_ProjectTimezoneShiftsBuckets(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	// 20:00 UTC is already the next day in Tokyo (UTC+9).
+	at := time.Date(2026, 3, 4, 20, 0, 0, 0, time.UTC)
+	if err := s.events.InsertEvents(context.Background(), []storage.Event{{ProjectID: project.ID, SessionID: "s1",
+		EventType: "pageview", Fingerprint: "fp", URL: "https://example.com/", URLPath: "/", Timestamp: at}}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	if err := s.meta.SetTimezone(context.Background(), project.ID, "Asia/Tokyo"); err != nil {
+		t.Fatalf("SetTimezone: %v", err)
+	}
+
+	handler := s.applyTimezone(http.HandlerFunc(query.NewHandler(s.events, s.meta).TrendsHandler))
+	bucket := func(extra string) string {
+		t.Helper()
+		target := fmt.Sprintf("/api/v1/trends?interval=day&start=%s&end=%s%s",
+			at.Add(-time.Hour).Format(time.RFC3339), at.Add(time.Hour).Format(time.RFC3339), extra)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, authedRequest("GET", target, "", project, ""))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []storage.TrendPoint `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(resp.Data) != 1 {
+			t.Fatalf("expected one bucket, got %+v", resp.Data)
+		}
+		return resp.Data[0].Bucket
+	}
+
+	if got := bucket(""); got != "2026-03-05" {
+		t.Fatalf("project timezone: expected bucket 2026-03-05, got %s", got)
+	}
+	if got := bucket("&tz=UTC"); got != "2026-03-04" {
+		t.Fatalf("tz override: expected bucket 2026-03-04, got %s", got)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, authedRequest("GET", "/api/v1/trends?tz=Mars/Olympus", "", project, ""))
+	assertAPIError(t, "unknown tz", w, http.StatusBadRequest, "invalid_request")
+}
+
+func TestSparklines_DailyBucketsPerRow(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	h := query.NewHandler(s.events, s.meta)
+	day1 := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	signup := "Signup"
+	ev := func(eventType, path string, at time.Time, name *string) storage.Event {
+		return storage.Event{ProjectID: project.ID, SessionID: "s1", EventType: eventType, Fingerprint: "fp",
+			URL: "https://example.com" + path, URLPath: path, Timestamp: at, EventName: name}
+	}
+	if err := s.events.InsertEvents(context.Background(), []storage.Event{
+		ev("pageview", "/pricing", day1, nil),
+		ev("pageview", "/pricing", day1.Add(time.Hour), nil),
+		ev("pageview", "/", day1.AddDate(0, 0, 1), nil),
+		ev("pageview", "/pricing", day1.AddDate(0, 0, 2), nil),
+		ev("custom", "/signup", day1, &signup),
+		ev("custom", "/signup", day1.AddDate(0, 0, 2), &signup),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	rng := "?start=2026-03-02T00:00:00Z&end=2026-03-04T23:00:00Z"
+
+	w := httptest.NewRecorder()
+	h.PagesHandler(w, authedRequest("GET", "/api/v1/pages"+rng+"&sparkline=true", "", project, ""))
+	var pages struct {
+		Pages []storage.PageStat `json:"pages"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&pages); err != nil || len(pages.Pages) != 2 {
+		t.Fatalf("pages: %d %v %+v", w.Code, err, pages)
+	}
+	want := map[string]string{"/pricing": "[2 0 1]", "/": "[0 1 0]"}
+	for _, p := range pages.Pages {
+		if got := fmt.Sprint(p.Sparkline); got != want[p.Path] {
+			t.Errorf("page %s: expected sparkline %s, got %s", p.Path, want[p.Path], got)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	h.EventStatsHandler(w, authedRequest("GET", "/api/v1/events/stats"+rng+"&sparkline=true", "", project, ""))
+	var stats struct {
+		Stats []storage.EventNameStat `json:"stats"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil || len(stats.Stats) != 1 {
+		t.Fatalf("stats: %d %v %+v", w.Code, err, stats)
+	}
+	if got := fmt.Sprint(stats.Stats[0].Sparkline); got != "[1 0 1]" {
+		t.Errorf("Signup: expected sparkline [1 0 1], got %s", got)
+	}
+
+	// Off by default.
+	w = httptest.NewRecorder()
+	h.PagesHandler(w, authedRequest("GET", "/api/v1/pages"+rng, "", project, ""))
+	var plain struct {
+		Pages []storage.PageStat `json:"pages"`
+	}
+	if json.NewDecoder(w.Body).Decode(&plain); len(plain.Pages) == 0 || plain.Pages[0].Sparkline != nil {
+		t.Fatalf("expected no sparkline without the parameter, got %+v", plain.Pages)
+	}
+}
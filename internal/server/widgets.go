@@ -0,0 +1,194 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/danielthedm/clicknest/internal/apierror"
+	"github.com/danielthedm/clicknest/internal/auth"
+	"github.com/danielthedm/clicknest/internal/storage"
+)
+
+// maxWidgetWindowDays bounds how far back a widget counts.
+const maxWidgetWindowDays = 365
+
+// widgetResponse is a widget with its share token and public embed URL.
+type widgetResponse struct {
+	storage.Widget
+	Token    string `json:"token"`
+	EmbedURL string `json:"embed_url"`
+}
+
+func (s *Server) widgetWithToken(wd storage.Widget) (widgetResponse, error) {
+	token, err := auth.SignWidgetToken(s.meta.Encryptor(), auth.WidgetToken{ProjectID: wd.ProjectID, WidgetID: wd.ID})
+	if err != nil {
+		return widgetResponse{}, err
+	}
+	return widgetResponse{
+		Widget:   wd,
+		Token:    token,
+		EmbedURL: "/api/v1/embed/widget?token=" + url.QueryEscape(token),
+	}, nil
+}
+
+// listWidgetsHandler handles GET /api/v1/widgets.
+func (s *Server) listWidgetsHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	widgets, err := s.meta.ListWidgets(r.Context(), project.ID)
+	if err != nil {
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+		return
+	}
+	out := make([]widgetResponse, 0, len(widgets))
+	for _, wd := range widgets {
+		resp, err := s.widgetWithToken(wd)
+		if err != nil {
+			apierror.Error(w, "token signing unavailable", http.StatusInternalServerError)
+			return
+		}
+		out = append(out, resp)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"widgets": out})
+}
+
+// createWidgetHandler handles POST /api/v1/widgets. The response carries the
+// share token that authorizes the public embed endpoint.
+func (s *Server) createWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var body struct {
+		Name       string `json:"name"`
+		Metric     string `json:"metric"`
+		EventName  string `json:"event_name"`
+		WindowDays int    `json:"window_days"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Name == "" {
+		apierror.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if !storage.WidgetMetrics[body.Metric] {
+		apierror.Error(w, "metric must be events, pageviews or errors", http.StatusBadRequest)
+		return
+	}
+	if body.EventName != "" && body.Metric != "events" {
+		apierror.Error(w, "event_name only applies to the events metric", http.StatusBadRequest)
+		return
+	}
+	if body.WindowDays == 0 {
+		body.WindowDays = 30
+	}
+	if body.WindowDays < 1 || body.WindowDays > maxWidgetWindowDays {
+		apierror.Error(w, "window_days must be between 1 and 365", http.StatusBadRequest)
+		return
+	}
+
+	wd, err := s.meta.CreateWidget(r.Context(), storage.Widget{
+		ProjectID:  project.ID,
+		Name:       body.Name,
+		Metric:     body.Metric,
+		EventName:  body.EventName,
+		WindowDays: body.WindowDays,
+	})
+	if err != nil {
+		apierror.Error(w, "create failed", http.StatusInternalServerError)
+		return
+	}
+	resp, err := s.widgetWithToken(*wd)
+	if err != nil {
+		apierror.Error(w, "token signing unavailable", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// deleteWidgetHandler handles DELETE /api/v1/widgets/{id}. Deleting a widget
+// revokes its share token.
+func (s *Server) deleteWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	project := auth.ProjectFromContext(r.Context())
+	if project == nil {
+		apierror.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if err := s.meta.DeleteWidget(r.Context(), project.ID, r.PathValue("id")); err != nil {
+		apierror.Error(w, "delete failed", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// embedWidgetHandler handles GET /api/v1/embed/widget?token=. It is
+// authenticated by a widget share token rather than a session or API key, so
+// it can be fetched from any page; it is an SDK route, so CORS allows other
+// origins. Only the widget's one aggregate value is exposed.
+func (s *Server) embedWidgetHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	tok, err := auth.VerifyWidgetToken(s.meta.Encryptor(), token)
+	if err != nil {
+		apierror.Error(w, "invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+	if !s.embedLimiter.Allow(tok.WidgetID) {
+		w.Header().Set("Retry-After", "1")
+		apierror.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+	wd, err := s.meta.GetWidget(r.Context(), tok.ProjectID, tok.WidgetID)
+	if errors.Is(err, sql.ErrNoRows) {
+		apierror.Error(w, "invalid or missing token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		log.Printf("ERROR loading widget %s: %v", tok.WidgetID, err)
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+		return
+	}
+
+	ctx := storage.WithInternalExclusion(r.Context(), s.meta.InternalTraffic(r.Context(), wd.ProjectID))
+	value, err := s.widgetValue(ctx, wd, time.Now().UTC())
+	if err != nil {
+		if r.Context().Err() == nil {
+			log.Printf("ERROR computing widget %s: %v", wd.ID, err)
+		}
+		apierror.ErrorCode(w, apierror.CodeQueryFailed, "query failed", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=60")
+	json.NewEncoder(w).Encode(map[string]any{
+		"name":        wd.Name,
+		"metric":      wd.Metric,
+		"event_name":  wd.EventName,
+		"value":       value,
+		"window_days": wd.WindowDays,
+	})
+}
+
+// widgetValue counts the widget's metric over its window ending at now.
+func (s *Server) widgetValue(ctx context.Context, wd *storage.Widget, now time.Time) (int64, error) {
+	since := now.AddDate(0, 0, -wd.WindowDays)
+	switch wd.Metric {
+	case "pageviews":
+		return s.events.CountEvents(ctx, wd.ProjectID, "pageview", "", since)
+	case "errors":
+		return s.events.CountEvents(ctx, wd.ProjectID, "error", "", since)
+	default:
+		return s.events.CountEvents(ctx, wd.ProjectID, "", wd.EventName, since)
+	}
+}
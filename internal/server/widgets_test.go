@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestEmbedWidget_TokenAuthorizedCrossOrigin(t *testing.T) {
+	s, project := newTestServer(t, Config{})
+	seedUserEvents(t, s, project.ID, "u1", "u2", "u3")
+
+	w := httptest.NewRecorder()
+	s.createWidgetHandler(w, authedRequest("POST", "/api/v1/widgets",
+		`{"name":"Pageviews","metric":"pageviews","window_days":7}`, project, "admin"))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	var created widgetResponse
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil || created.Token == "" {
+		t.Fatalf("create response: %v %+v", err, created)
+	}
+
+	embed := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/embed/widget?token="+url.QueryEscape(token), nil)
+		req.Header.Set("Origin", "https://blog.example.org")
+		w := httptest.NewRecorder()
+		s.server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w = embed(created.Token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("embed: status %d: %s", w.Code, w.Body)
+	}
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	var body struct {
+		Metric string `json:"metric"`
+		Value  int64  `json:"value"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Metric != "pageviews" || body.Value != 3 {
+		t.Errorf("embed body = %+v, want 3 pageviews", body)
+	}
+
+	for name, token := range map[string]string{"missing": "", "forged": created.Token + "x"} {
+		if w := embed(token); w.Code != http.StatusUnauthorized {
+			t.Errorf("%s token: status %d, want 401", name, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	req := authedRequest("DELETE", "/api/v1/widgets/"+created.ID, "", project, "admin")
+	req.SetPathValue("id", created.ID)
+	s.deleteWidgetHandler(w, req)
+	if w := embed(created.Token); w.Code != http.StatusUnauthorized {
+		t.Errorf("deleted widget: status %d, want 401", w.Code)
+	}
+}
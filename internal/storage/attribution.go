@@ -110,7 +110,7 @@ GROUP BY c.source, c.channel
 ORDER BY sessions DESC
 LIMIT ?
 `
-	rows, err := d.db.QueryContext(ctx, query, projectID, start, end, projectID, start, end, limit)
+	rows, err := d.read.QueryContext(ctx, query, projectID, start, end, projectID, start, end, limit)
 	if err != nil {
 		return nil, fmt.Errorf("querying attribution: %w", err)
 	}
@@ -140,7 +140,7 @@ LEFT JOIN session_pages sp ON c.session_id = sp.session_id
 GROUP BY c.channel
 ORDER BY sessions DESC
 `
-	rows, err := d.db.QueryContext(ctx, query, projectID, start, end, projectID, start, end)
+	rows, err := d.read.QueryContext(ctx, query, projectID, start, end, projectID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("querying attribution overview: %w", err)
 	}
@@ -201,7 +201,7 @@ FROM ref_sessions rs
 LEFT JOIN session_pages sp ON rs.session_id = sp.session_id
 `
 	var s CampaignStats
-	err := d.db.QueryRowContext(ctx, query,
+	err := d.read.QueryRowContext(ctx, query,
 		projectID, start, end,
 		projectID, start, end,
 		projectID, start, end,
@@ -251,7 +251,7 @@ FROM ref_sessions rs
 LEFT JOIN session_pages sp ON rs.session_id = sp.session_id
 GROUP BY rs.ref_code
 `
-	rows, err := d.db.QueryContext(ctx, query, projectID, start, end, projectID, start, end)
+	rows, err := d.read.QueryContext(ctx, query, projectID, start, end, projectID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("querying ref code stats batch: %w", err)
 	}
@@ -322,7 +322,7 @@ LEFT JOIN ref_sessions rs ON c.session_id = rs.session_id
 GROUP BY c.channel
 ORDER BY sessions DESC
 `
-	rows, err := d.db.QueryContext(ctx, query, projectID, start, end, projectID, start, end)
+	rows, err := d.read.QueryContext(ctx, query, projectID, start, end, projectID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("querying campaign channel breakdown: %w", err)
 	}
@@ -356,7 +356,7 @@ WHERE e.project_id = ? AND e.event_type = ?
     AND e.timestamp BETWEEN ? AND ?
 `
 	var count int64
-	err := d.db.QueryRowContext(ctx, query,
+	err := d.read.QueryRowContext(ctx, query,
 		projectID, start, end,
 		projectID, conversionEvent, start, end,
 	).Scan(&count)
@@ -384,7 +384,7 @@ FROM ref_sessions
 GROUP BY day
 ORDER BY day
 `
-	rows, err := d.db.QueryContext(ctx, query, projectID, start, end)
+	rows, err := d.read.QueryContext(ctx, query, projectID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("querying campaign time series: %w", err)
 	}
@@ -526,7 +526,7 @@ LIMIT 50
 	allArgs = append(allArgs, convArgs...)
 	allArgs = append(allArgs, projectID, start, end)
 
-	rows, err := d.db.QueryContext(ctx, query, allArgs...)
+	rows, err := d.read.QueryContext(ctx, query, allArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("querying conversions by goal: %w", err)
 	}
@@ -620,7 +620,7 @@ LIMIT 50
 	allArgs = append(allArgs, convArgs...)
 	allArgs = append(allArgs, projectID, start, end)
 
-	rows, err := d.db.QueryContext(ctx, query, allArgs...)
+	rows, err := d.read.QueryContext(ctx, query, allArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("querying linear attribution: %w", err)
 	}
@@ -664,7 +664,7 @@ func (d *DuckDB) QueryRevenueOverview(ctx context.Context, projectID string, goa
 	totalArgs := append([]any{goal.ValueProperty}, convArgs...)
 
 	overview := &RevenueOverview{}
-	if err := d.db.QueryRowContext(ctx, totalQuery, totalArgs...).Scan(&overview.TotalConversions, &overview.TotalRevenue); err != nil {
+	if err := d.read.QueryRowContext(ctx, totalQuery, totalArgs...).Scan(&overview.TotalConversions, &overview.TotalRevenue); err != nil {
 		return nil, fmt.Errorf("querying revenue totals: %w", err)
 	}
 
@@ -763,7 +763,7 @@ GROUP BY source, channel, campaign
 ORDER BY sessions DESC
 LIMIT 20`
 
-	rows, err := d.db.QueryContext(ctx, q, projectID, distinctID, since)
+	rows, err := d.read.QueryContext(ctx, q, projectID, distinctID, since)
 	if err != nil {
 		return nil, fmt.Errorf("query lead attribution: %w", err)
 	}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// BotFiltersSetting is the growth setting key holding a project's ingest-time
+// user-agent exclusion list as a JSON array. Each entry is a case-insensitive
+// substring, or a regular expression when wrapped in slashes (/pattern/).
+// Unset means nothing is excluded.
+const BotFiltersSetting = "bot_filters"
+
+// maxBotFilters caps the exclusion list; every batch is matched against it.
+const maxBotFilters = 50
+
+// botFilterCacheTTL bounds how long a compiled exclusion list is reused
+// before the setting is re-read.
+const botFilterCacheTTL = time.Minute
+
+type botFilterEntry struct {
+	filter *BotFilter
+	loaded time.Time
+}
+
+// BotFilter matches user agents against a compiled exclusion list.
+type BotFilter struct {
+	substrings []string
+	patterns   []*regexp.Regexp
+}
+
+// CompileBotFilters compiles an exclusion list, rejecting empty entries and
+// invalid regular expressions.
+func CompileBotFilters(filters []string) (*BotFilter, error) {
+	if len(filters) > maxBotFilters {
+		return nil, fmt.Errorf("at most %d bot filters allowed", maxBotFilters)
+	}
+	f := &BotFilter{}
+	for _, entry := range filters {
+		if entry == "" {
+			return nil, fmt.Errorf("bot filter must not be empty")
+		}
+		if len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/") {
+			re, err := regexp.Compile("(?i)" + entry[1:len(entry)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid bot filter %q: %w", entry, err)
+			}
+			f.patterns = append(f.patterns, re)
+			continue
+		}
+		f.substrings = append(f.substrings, strings.ToLower(entry))
+	}
+	return f, nil
+}
+
+// Match reports whether ua is excluded. A nil filter matches nothing.
+func (f *BotFilter) Match(ua string) bool {
+	if f == nil || ua == "" {
+		return false
+	}
+	lower := strings.ToLower(ua)
+	for _, sub := range f.substrings {
+		if strings.Contains(lower, sub) {
+			return true
+		}
+	}
+	for _, re := range f.patterns {
+		if re.MatchString(ua) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetBotFilters returns the project's user-agent exclusion list.
+func (s *SQLite) GetBotFilters(ctx context.Context, projectID string) []string {
+	v, _ := s.GetGrowthSetting(ctx, projectID, BotFiltersSetting)
+	var filters []string
+	if v == "" || json.Unmarshal([]byte(v), &filters) != nil {
+		return []string{}
+	}
+	return filters
+}
+
+// BotFilter returns the project's compiled exclusion list, or nil when none
+// is configured. Compiled lists are cached per project so ingest doesn't
+// re-read and recompile the setting on every batch; entries expire after
+// botFilterCacheTTL so instances sharing Postgres metadata converge.
+func (s *SQLite) BotFilter(ctx context.Context, projectID string) *BotFilter {
+	if v, ok := s.botFilters.Load(projectID); ok {
+		if e := v.(botFilterEntry); time.Since(e.loaded) < botFilterCacheTTL {
+			return e.filter
+		}
+	}
+	var f *BotFilter
+	if filters := s.GetBotFilters(ctx, projectID); len(filters) > 0 {
+		f, _ = CompileBotFilters(filters)
+	}
+	s.botFilters.Store(projectID, botFilterEntry{filter: f, loaded: time.Now()})
+	return f
+}
+
+// SetBotFilters validates and stores the project's exclusion list. An empty
+// list turns exclusion off.
+func (s *SQLite) SetBotFilters(ctx context.Context, projectID string, filters []string) error {
+	value := ""
+	if len(filters) > 0 {
+		if _, err := CompileBotFilters(filters); err != nil {
+			return err
+		}
+		b, err := json.Marshal(filters)
+		if err != nil {
+			return err
+		}
+		value = string(b)
+	}
+	if err := s.SetGrowthSetting(ctx, projectID, BotFiltersSetting, value); err != nil {
+		return err
+	}
+	s.botFilters.Delete(projectID)
+	return nil
+}
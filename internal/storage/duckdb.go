@@ -3,12 +3,17 @@ package storage
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/danielthedm/clicknest/internal/ratelimit"
+	"github.com/marcboeker/go-duckdb"
 )
 
 type Event struct {
@@ -47,12 +52,24 @@ type EventFilter struct {
 	Fingerprint   string
 	SessionID     string
 	DistinctID    string
+	URLPath       string
 	PropertyKey   string
 	PropertyValue string
-	StartTime     time.Time
-	EndTime       time.Time
-	Limit         int
-	Offset        int
+	// Referrer matches events whose referrer contains it, case-insensitively.
+	// The UTM fields match the utm_* properties exactly.
+	Referrer    string
+	UTMSource   string
+	UTMMedium   string
+	UTMCampaign string
+	StartTime   time.Time
+	EndTime     time.Time
+	// BeforeTimestamp and BeforeID are a keyset cursor: QueryEvents returns
+	// only rows ordered after that row, so pages stay stable while new
+	// events arrive. Set both from the last row of the previous page.
+	BeforeTimestamp time.Time
+	BeforeID        string
+	Limit           int
+	Offset          int
 }
 
 type TrendPoint struct {
@@ -61,26 +78,113 @@ type TrendPoint struct {
 }
 
 type DuckDB struct {
-	db *sql.DB
+	db   *sql.DB // writer: inserts, updates, deletes, checkpoints
+	read *sql.DB // analytics reads; same as db unless a reader pool is enabled
+
+	promotedMu sync.Mutex
+	promoted   map[string][]string // project ID → promoted property keys
 }
 
 func NewDuckDB(path string) (*DuckDB, error) {
-	db, err := sql.Open("duckdb", path)
+	return NewDuckDBWithReader(path, 0)
+}
+
+// NewDuckDBWithReader opens the database like NewDuckDB but, when readConns > 0,
+// serves analytics queries from a separate pool of up to readConns connections.
+// Both pools share one DuckDB instance, so readers see every committed write,
+// but a burst of heavy dashboard queries can no longer starve InsertEvents of
+// connections.
+func NewDuckDBWithReader(path string, readConns int) (*DuckDB, error) {
+	connector, err := duckdb.NewConnector(path, nil)
 	if err != nil {
 		return nil, fmt.Errorf("opening duckdb: %w", err)
 	}
+	db := sql.OpenDB(connector)
 
 	if err := db.Ping(); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("pinging duckdb: %w", err)
 	}
 
 	if err := RunMigrations(db, duckdbMigrations, "migrations/duckdb"); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("running duckdb migrations: %w", err)
 	}
 
-	return &DuckDB{db: db}, nil
+	d := &DuckDB{db: db, read: db, promoted: make(map[string][]string)}
+	if readConns > 0 {
+		d.read = sql.OpenDB(sharedConnector{connector})
+		d.read.SetMaxOpenConns(readConns)
+		d.read.SetMaxIdleConns(readConns)
+		if err := d.read.Ping(); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("pinging duckdb reader: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// sharedConnector hides the underlying connector's Close method so closing the
+// reader pool does not close the database out from under the writer. Its
+// connections are read-only: DuckDB's access_mode applies to the whole
+// database instance, so the reader would otherwise share the writer's
+// permissions.
+type sharedConnector struct {
+	driver.Connector
+}
+
+func (c sharedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return readOnlyConn{conn: conn.(*duckdb.Conn)}, nil
+}
+
+// errReadOnly is returned when a write reaches the reader pool.
+var errReadOnly = errors.New("duckdb reader pool is read-only")
+
+// readOnlyConn prepares exactly one statement per query and refuses anything
+// but SELECT and EXPLAIN. It deliberately omits ExecerContext and
+// QueryerContext so database/sql routes every call through PrepareContext.
+type readOnlyConn struct {
+	conn *duckdb.Conn
+}
+
+func (c readOnlyConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	typ, err := stmt.(*duckdb.Stmt).StatementType()
+	if err == nil && typ != duckdb.STATEMENT_TYPE_SELECT && typ != duckdb.STATEMENT_TYPE_EXPLAIN {
+		err = errReadOnly
+	}
+	if err != nil {
+		stmt.Close()
+		return nil, err
+	}
+	return stmt, nil
+}
+
+func (c readOnlyConn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	return c.Prepare(query)
+}
+
+func (c readOnlyConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return c.conn.CheckNamedValue(nv)
 }
 
+func (c readOnlyConn) Close() error { return c.conn.Close() }
+
+func (c readOnlyConn) Begin() (driver.Tx, error) { return nil, errReadOnly }
+
+func (c readOnlyConn) BeginTx(context.Context, driver.TxOptions) (driver.Tx, error) {
+	return nil, errReadOnly
+}
+
+// InsertEvents writes a batch of events in one transaction. On success each
+// element's ID is set to the ID the database assigned it.
 func (d *DuckDB) InsertEvents(ctx context.Context, events []Event) error {
 	tx, err := d.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -97,6 +201,7 @@ func (d *DuckDB) InsertEvents(ctx context.Context, events []Event) error {
 			screen_width, screen_height, user_agent,
 			timestamp, received_at, properties
 		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
 	`)
 	if err != nil {
 		return fmt.Errorf("preparing statement: %w", err)
@@ -105,72 +210,128 @@ func (d *DuckDB) InsertEvents(ctx context.Context, events []Event) error {
 
 	now := time.Now().UTC()
 
-	for _, e := range events {
+	ids := make([]string, len(events))
+	propsJSON := make([]string, len(events))
+	for i, e := range events {
 		dataAttrs, _ := json.Marshal(e.DataAttributes)
 		props, _ := json.Marshal(e.Properties)
+		propsJSON[i] = string(props)
 
-		_, err := stmt.ExecContext(ctx,
+		err := stmt.QueryRowContext(ctx,
 			e.ProjectID, e.SessionID, e.DistinctID, e.EventType, e.Fingerprint, e.EventName,
 			e.ElementTag, e.ElementID, e.ElementClasses, e.ElementText, e.AriaLabel,
 			string(dataAttrs), e.ParentPath,
 			e.URL, e.URLPath, e.PageTitle, e.Referrer,
 			e.ScreenWidth, e.ScreenHeight, e.UserAgent,
 			e.Timestamp, now, string(props),
-		)
+		).Scan(&ids[i])
 		if err != nil {
 			return fmt.Errorf("inserting event: %w", err)
 		}
 	}
+	if err := d.insertPromotedProperties(ctx, tx, events, ids, propsJSON); err != nil {
+		return err
+	}
 
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for i := range events {
+		events[i].ID = ids[i]
+	}
+	return nil
 }
 
-func (d *DuckDB) QueryEvents(ctx context.Context, f EventFilter) ([]Event, error) {
-	query := `SELECT
-		id, project_id, session_id, distinct_id, event_type, fingerprint, event_name,
-		element_tag, element_id, element_classes, element_text, aria_label,
-		CAST(data_attributes AS VARCHAR), parent_path,
-		url, url_path, page_title, referrer,
-		screen_width, screen_height, user_agent,
-		timestamp, received_at, CAST(properties AS VARCHAR)
-		FROM events WHERE project_id = ?`
-
+// eventFilterWhere builds the WHERE clause (without the keyword) and its
+// arguments for f. Limit and Offset are left to the caller. A promoted
+// property filter goes through the event_properties index.
+func (d *DuckDB) eventFilterWhere(ctx context.Context, f EventFilter) (string, []any) {
+	where := "project_id = ?"
 	args := []any{f.ProjectID}
 
 	if f.EventType != "" {
-		query += " AND event_type = ?"
+		where += " AND event_type = ?"
 		args = append(args, f.EventType)
 	}
 	if f.EventName != "" {
-		query += " AND event_name = ?"
+		where += " AND event_name = ?"
 		args = append(args, f.EventName)
 	}
 	if f.Fingerprint != "" {
-		query += " AND fingerprint = ?"
+		where += " AND fingerprint = ?"
 		args = append(args, f.Fingerprint)
 	}
 	if f.SessionID != "" {
-		query += " AND session_id = ?"
+		where += " AND session_id = ?"
 		args = append(args, f.SessionID)
 	}
 	if f.DistinctID != "" {
-		query += " AND distinct_id = ?"
+		where += " AND distinct_id = ?"
 		args = append(args, f.DistinctID)
 	}
+	if f.URLPath != "" {
+		where += " AND url_path = ?"
+		args = append(args, f.URLPath)
+	}
 	if f.PropertyKey != "" && f.PropertyValue != "" {
-		query += " AND json_extract_string(properties, '$.' || ?) = ?"
-		args = append(args, f.PropertyKey, f.PropertyValue)
+		if d.propertyPromoted(ctx, f.ProjectID, f.PropertyKey) {
+			where += " AND " + promotedPropertyClause
+			args = append(args, f.ProjectID, f.PropertyKey, f.PropertyValue)
+		} else {
+			where += " AND json_extract_string(properties, '$.' || ?) = ?"
+			args = append(args, f.PropertyKey, f.PropertyValue)
+		}
+	}
+	if f.Referrer != "" {
+		where += ` AND referrer ILIKE ? ESCAPE '\'`
+		args = append(args, "%"+likeEscaper.Replace(f.Referrer)+"%")
+	}
+	for _, utm := range [][2]string{{"utm_source", f.UTMSource}, {"utm_medium", f.UTMMedium}, {"utm_campaign", f.UTMCampaign}} {
+		if utm[1] != "" {
+			where += " AND json_extract_string(properties, '$." + utm[0] + "') = ?"
+			args = append(args, utm[1])
+		}
 	}
 	if !f.StartTime.IsZero() {
-		query += " AND timestamp >= ?"
+		where += " AND timestamp >= ?"
 		args = append(args, f.StartTime)
 	}
 	if !f.EndTime.IsZero() {
-		query += " AND timestamp <= ?"
+		where += " AND timestamp <= ?"
 		args = append(args, f.EndTime)
 	}
+	return where, args
+}
 
-	query += " ORDER BY timestamp DESC"
+// likeEscaper escapes LIKE wildcards so a substring matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// Narrowed reports whether f filters on anything besides the project.
+func (f EventFilter) Narrowed() bool {
+	return f.EventType != "" || f.EventName != "" || f.Fingerprint != "" ||
+		f.SessionID != "" || f.DistinctID != "" || f.URLPath != "" ||
+		(f.PropertyKey != "" && f.PropertyValue != "") ||
+		f.Referrer != "" || f.UTMSource != "" || f.UTMMedium != "" || f.UTMCampaign != "" ||
+		!f.StartTime.IsZero() || !f.EndTime.IsZero()
+}
+
+func (d *DuckDB) QueryEvents(ctx context.Context, f EventFilter) ([]Event, error) {
+	where, args := d.eventFilterWhere(ctx, f)
+	query := `SELECT
+		id, project_id, session_id, distinct_id, event_type, fingerprint, event_name,
+		element_tag, element_id, element_classes, element_text, aria_label,
+		CAST(data_attributes AS VARCHAR), parent_path,
+		url, url_path, page_title, referrer,
+		screen_width, screen_height, user_agent,
+		timestamp, received_at, CAST(properties AS VARCHAR)
+		FROM events WHERE ` + where
+
+	if !f.BeforeTimestamp.IsZero() {
+		query += " AND (timestamp < ? OR (timestamp = ? AND id < ?))"
+		args = append(args, f.BeforeTimestamp, f.BeforeTimestamp, f.BeforeID)
+	}
+
+	query += " ORDER BY timestamp DESC, id DESC"
 
 	limit := f.Limit
 	if limit <= 0 {
@@ -184,7 +345,7 @@ func (d *DuckDB) QueryEvents(ctx context.Context, f EventFilter) ([]Event, error
 		args = append(args, f.Offset)
 	}
 
-	rows, err := d.db.QueryContext(ctx, query, args...)
+	rows, err := d.read.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("querying events: %w", err)
 	}
@@ -235,12 +396,12 @@ func (d *DuckDB) QueryEvents(ctx context.Context, f EventFilter) ([]Event, error
 		}
 		if dataAttrsJSON.Valid {
 			if err := json.Unmarshal([]byte(dataAttrsJSON.String), &e.DataAttributes); err != nil {
-				log.Printf("WARN scan event %s data_attributes: %v", e.ID, err)
+				ratelimit.Warnings.Printf("scan data_attributes "+e.ID, "WARN scan event %s data_attributes: %v", e.ID, err)
 			}
 		}
 		if propsJSON.Valid {
 			if err := json.Unmarshal([]byte(propsJSON.String), &e.Properties); err != nil {
-				log.Printf("WARN scan event %s properties: %v", e.ID, err)
+				ratelimit.Warnings.Printf("scan properties "+e.ID, "WARN scan event %s properties: %v", e.ID, err)
 			}
 		}
 
@@ -250,22 +411,37 @@ func (d *DuckDB) QueryEvents(ctx context.Context, f EventFilter) ([]Event, error
 	return events, rows.Err()
 }
 
-func (d *DuckDB) QueryTrends(ctx context.Context, projectID string, interval string, start, end time.Time) ([]TrendPoint, error) {
+// QueryTrends returns event counts per time bucket. eventType and eventName
+// scope the count to matching events; empty strings count everything. Under
+// WithSampleScaling the counts are estimates scaled up by sample rate.
+func (d *DuckDB) QueryTrends(ctx context.Context, projectID string, interval, eventType, eventName string, start, end time.Time) ([]TrendPoint, error) {
 	bucket := "hour"
 	switch interval {
 	case "minute", "hour", "day", "week", "month":
 		bucket = interval
 	}
 
+	args := []any{projectID, start, end}
+	var filter string
+	if eventType != "" {
+		filter += " AND event_type = ?"
+		args = append(args, eventType)
+	}
+	if eventName != "" {
+		filter += " AND event_name = ?"
+		args = append(args, eventName)
+	}
+	filter += internalFilter(ctx)
+
 	query := fmt.Sprintf(`
-		SELECT CAST(date_trunc('%s', CAST(timestamp AS TIMESTAMP)) AS VARCHAR) AS bucket, COUNT(*) AS count
+		SELECT CAST(date_trunc('%s', %s) AS VARCHAR) AS bucket, %s AS count
 		FROM events
-		WHERE project_id = ? AND timestamp >= ? AND timestamp <= ?
+		WHERE project_id = ? AND timestamp >= ? AND timestamp <= ?%s
 		GROUP BY bucket
 		ORDER BY bucket
-	`, bucket)
+	`, bucket, localTime(ctx, "timestamp", start, end), countExpr(ctx), filter)
 
-	rows, err := d.db.QueryContext(ctx, query, projectID, start, end)
+	rows, err := d.read.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("querying trends: %w", err)
 	}
@@ -283,9 +459,77 @@ func (d *DuckDB) QueryTrends(ctx context.Context, projectID string, interval str
 	return points, rows.Err()
 }
 
+// TrendMetric is one line of a multi-metric trend chart.
+type TrendMetric struct {
+	Name      string `json:"name"`
+	EventType string `json:"event_type,omitempty"`
+	EventName string `json:"event_name,omitempty"`
+}
+
+// QueryTrendsMulti runs QueryTrends for each metric and returns one series per
+// metric on a shared, gap-filled timeline so the series align bucket for bucket.
+func (d *DuckDB) QueryTrendsMulti(ctx context.Context, projectID, interval string, metrics []TrendMetric, start, end time.Time) ([]TrendSeries, error) {
+	buckets := trendBuckets(interval, start, end, locationFrom(ctx))
+	result := make([]TrendSeries, 0, len(metrics))
+	for _, m := range metrics {
+		points, err := d.QueryTrends(ctx, projectID, interval, m.EventType, m.EventName, start, end)
+		if err != nil {
+			return nil, err
+		}
+		counts := make(map[string]int64, len(points))
+		for _, p := range points {
+			counts[p.Bucket] = p.Count
+		}
+		data := make([]TrendPoint, len(buckets))
+		for i, b := range buckets {
+			data[i] = TrendPoint{Bucket: b, Count: counts[b]}
+		}
+		result = append(result, TrendSeries{Name: m.Name, Data: data})
+	}
+	return result, nil
+}
+
+// trendBuckets lists every bucket label between start and end in the format
+// DuckDB produces for CAST(date_trunc(interval, ts) AS VARCHAR), with
+// boundaries on wall-clock time in loc.
+func trendBuckets(interval string, start, end time.Time, loc *time.Location) []string {
+	start, end = start.In(loc), end.In(loc)
+	var t time.Time
+	var next func(time.Time) time.Time
+	switch interval {
+	case "minute":
+		t, next = start.Truncate(time.Minute), func(t time.Time) time.Time { return t.Add(time.Minute) }
+	case "day":
+		t, next = time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc), func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case "week":
+		// date_trunc('week') starts weeks on Monday.
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc)
+		t, next = day.AddDate(0, 0, -((int(day.Weekday())+6)%7)), func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	case "month":
+		t, next = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, loc), func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default: // hour
+		t, next = time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, loc), func(t time.Time) time.Time { return t.Add(time.Hour) }
+	}
+	// date_trunc yields a DATE (no time part) for day and coarser buckets.
+	layout := "2006-01-02 15:04:05"
+	switch interval {
+	case "day", "week", "month":
+		layout = "2006-01-02"
+	}
+	var out []string
+	for ; !t.After(end) && len(out) < maxTrendBuckets; t = next(t) {
+		out = append(out, t.Format(layout))
+	}
+	return out
+}
+
+// maxTrendBuckets caps gap-filling so a huge range at minute granularity
+// can't allocate an unbounded timeline.
+const maxTrendBuckets = 5000
+
 // UnnamedFingerprints returns one representative event per unnamed fingerprint (non-pageview).
 func (d *DuckDB) UnnamedFingerprints(ctx context.Context, projectID string) ([]Event, error) {
-	rows, err := d.db.QueryContext(ctx, `
+	rows, err := d.read.QueryContext(ctx, `
 		SELECT fingerprint, element_tag, element_id, element_classes, element_text,
 		       aria_label, parent_path, url, url_path, page_title
 		FROM events
@@ -311,10 +555,37 @@ func (d *DuckDB) UnnamedFingerprints(ctx context.Context, projectID string) ([]E
 	return events, rows.Err()
 }
 
+// FingerprintElement returns the most recent event with the given fingerprint,
+// carrying its DOM context, or nil when the fingerprint has never been seen.
+func (d *DuckDB) FingerprintElement(ctx context.Context, projectID, fingerprint string) (*Event, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT event_type, element_tag, element_id, element_classes, element_text,
+		       aria_label, parent_path, url, url_path, page_title
+		FROM events
+		WHERE project_id = ? AND fingerprint = ?
+		ORDER BY timestamp DESC
+		LIMIT 1
+	`, projectID, fingerprint)
+	if err != nil {
+		return nil, fmt.Errorf("querying fingerprint element: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	e := Event{ProjectID: projectID, Fingerprint: fingerprint}
+	if err := rows.Scan(&e.EventType, &e.ElementTag, &e.ElementID, &e.ElementClasses,
+		&e.ElementText, &e.AriaLabel, &e.ParentPath, &e.URL, &e.URLPath, &e.PageTitle); err != nil {
+		return nil, fmt.Errorf("scanning fingerprint element: %w", err)
+	}
+	return &e, nil
+}
+
 // AllFingerprints returns one representative event per fingerprint (non-pageview).
 // Used to re-run naming with source code enrichment.
 func (d *DuckDB) AllFingerprints(ctx context.Context, projectID string) ([]Event, error) {
-	rows, err := d.db.QueryContext(ctx, `
+	rows, err := d.read.QueryContext(ctx, `
 		SELECT fingerprint, element_tag, element_id, element_classes, element_text,
 		       aria_label, parent_path, url, url_path, page_title
 		FROM events
@@ -354,25 +625,132 @@ type FunnelStep struct {
 	URLPath     string `json:"url_path,omitempty"`
 }
 
+// Funnel matching modes. FunnelOrdered steps must happen in sequence;
+// FunnelUnordered counts a session at a step once it has performed every
+// event up to it, in any order.
+const (
+	FunnelOrdered   = "ordered"
+	FunnelUnordered = "unordered"
+)
+
+// MaxFunnelSteps bounds a funnel's length: every step adds a CTE joined to
+// the previous one, so the query grows with each. maxFunnelStepValue bounds
+// each step's matched values so the generated SQL stays small too.
+const (
+	MaxFunnelSteps     = 10
+	maxFunnelStepValue = 1024
+)
+
+// ErrFunnelTooLarge is returned for funnels beyond MaxFunnelSteps or with
+// oversized step values.
+var ErrFunnelTooLarge = errors.New("funnel too large")
+
+// ValidateFunnelSteps checks steps against the funnel size bounds.
+func ValidateFunnelSteps(steps []FunnelStep) error {
+	if len(steps) > MaxFunnelSteps {
+		return fmt.Errorf("%w: %d steps, at most %d allowed", ErrFunnelTooLarge, len(steps), MaxFunnelSteps)
+	}
+	for i, s := range steps {
+		if max(len(s.EventType), len(s.EventName), len(s.Fingerprint), len(s.URLPath)) > maxFunnelStepValue {
+			return fmt.Errorf("%w: step %d matches a value over %d bytes", ErrFunnelTooLarge, i+1, maxFunnelStepValue)
+		}
+	}
+	return nil
+}
+
+// FunnelPopulation restricts which sessions may enter a funnel at its first
+// step. The zero value admits every session.
+type FunnelPopulation struct {
+	// DistinctIDs admits sessions of these users, such as a saved segment's
+	// members. It is nil when unrestricted; an empty non-nil list admits
+	// no one.
+	DistinctIDs []string
+	// The remaining fields admit sessions with at least one event carrying
+	// the UTM value or property, as on EventFilter.
+	UTMSource     string
+	UTMMedium     string
+	UTMCampaign   string
+	PropertyKey   string
+	PropertyValue string
+}
+
+// where returns the population's conditions on a session_id column, inlined
+// like the rest of the funnel SQL, or "" for the whole population.
+func (p FunnelPopulation) where(projectID string, start, end time.Time) string {
+	var conds []string
+	if p.DistinctIDs != nil {
+		if len(p.DistinctIDs) == 0 {
+			return " AND FALSE"
+		}
+		quoted := make([]string, len(p.DistinctIDs))
+		for i, id := range p.DistinctIDs {
+			quoted[i] = "'" + sqlEsc(id) + "'"
+		}
+		conds = append(conds, "distinct_id IN ("+strings.Join(quoted, ", ")+")")
+	}
+	for _, utm := range [][2]string{{"utm_source", p.UTMSource}, {"utm_medium", p.UTMMedium}, {"utm_campaign", p.UTMCampaign}} {
+		if utm[1] != "" {
+			conds = append(conds, fmt.Sprintf("json_extract_string(properties, '$.%s') = '%s'", utm[0], sqlEsc(utm[1])))
+		}
+	}
+	if p.PropertyKey != "" && p.PropertyValue != "" {
+		conds = append(conds, fmt.Sprintf("json_extract_string(properties, '$.' || '%s') = '%s'", sqlEsc(p.PropertyKey), sqlEsc(p.PropertyValue)))
+	}
+
+	// Each condition may hold on a different event of the session: the UTM
+	// tags land on the first pageview, the distinct ID after identify.
+	var b strings.Builder
+	for _, c := range conds {
+		fmt.Fprintf(&b, " AND session_id IN (SELECT session_id FROM events WHERE project_id = '%s' AND %s", sqlEsc(projectID), c)
+		if !start.IsZero() {
+			fmt.Fprintf(&b, " AND timestamp >= '%s'", start.Format(time.RFC3339))
+		}
+		if !end.IsZero() {
+			fmt.Fprintf(&b, " AND timestamp <= '%s'", end.Format(time.RFC3339))
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
 type FunnelResult struct {
 	Step  string `json:"step"`
 	Count int64  `json:"count"`
 }
 
+// FunnelBreakdown is a funnel's step counts for the sessions whose first
+// step carried one value of the breakdown property. Value is nil for
+// sessions without it.
+type FunnelBreakdown struct {
+	Value *string        `json:"value"`
+	Steps []FunnelResult `json:"steps"`
+}
+
+// FunnelConverter is a session that completed a funnel.
+type FunnelConverter struct {
+	SessionID  string `json:"session_id"`
+	DistinctID string `json:"distinct_id,omitempty"`
+	// CompletedAt is when an ordered funnel's last step happened, or when an
+	// unordered funnel's session entered it.
+	CompletedAt time.Time `json:"completed_at"`
+}
+
 type RetentionCohort struct {
 	Cohort    string  `json:"cohort"`
 	Size      int64   `json:"size"`
 	Retention []int64 `json:"retention"`
 }
 
-// QueryPropertyKeys returns distinct top-level keys from the properties JSON column.
-func (d *DuckDB) QueryPropertyKeys(ctx context.Context, projectID string) ([]string, error) {
-	rows, err := d.db.QueryContext(ctx, `
+// QueryPropertyKeys returns distinct top-level keys from the properties JSON
+// column of the project's events between start and end.
+func (d *DuckDB) QueryPropertyKeys(ctx context.Context, projectID string, start, end time.Time) ([]string, error) {
+	rows, err := d.read.QueryContext(ctx, `
 		SELECT DISTINCT unnest(json_keys(properties)) AS key
 		FROM events
-		WHERE project_id = ? AND properties IS NOT NULL AND CAST(properties AS VARCHAR) != '{}'
+		WHERE project_id = ? AND timestamp >= ? AND timestamp <= ?
+			AND properties IS NOT NULL AND CAST(properties AS VARCHAR) != '{}'
 		ORDER BY key
-	`, projectID)
+	`, projectID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("querying property keys: %w", err)
 	}
@@ -389,17 +767,20 @@ func (d *DuckDB) QueryPropertyKeys(ctx context.Context, projectID string) ([]str
 	return keys, rows.Err()
 }
 
-func (d *DuckDB) QueryPropertyValues(ctx context.Context, projectID, key string, limit int) ([]string, error) {
+// QueryPropertyValues returns up to limit distinct values of properties.<key>
+// on the project's events between start and end.
+func (d *DuckDB) QueryPropertyValues(ctx context.Context, projectID, key string, start, end time.Time, limit int) ([]string, error) {
 	if limit <= 0 {
 		limit = 100
 	}
-	rows, err := d.db.QueryContext(ctx, `
+	rows, err := d.read.QueryContext(ctx, `
 		SELECT DISTINCT CAST(json_extract(properties, '$.' || ?) AS VARCHAR) AS val
 		FROM events
-		WHERE project_id = ? AND properties IS NOT NULL AND json_extract(properties, '$.' || ?) IS NOT NULL
+		WHERE project_id = ? AND timestamp >= ? AND timestamp <= ?
+			AND properties IS NOT NULL AND json_extract(properties, '$.' || ?) IS NOT NULL
 		ORDER BY val
 		LIMIT ?
-	`, key, projectID, key, limit)
+	`, key, projectID, start, end, key, limit)
 	if err != nil {
 		return nil, fmt.Errorf("querying property values: %w", err)
 	}
@@ -416,6 +797,43 @@ func (d *DuckDB) QueryPropertyValues(ctx context.Context, projectID, key string,
 	return values, rows.Err()
 }
 
+// PropertyCount is the number of events carrying one value of a property.
+// A nil Value is the bucket of events where the property is missing or null.
+type PropertyCount struct {
+	Value *string `json:"value"`
+	Count int64   `json:"count"`
+}
+
+// QueryCountByProperty counts the project's events between start and end
+// grouped by the value of properties.<property>, largest first.
+func (d *DuckDB) QueryCountByProperty(ctx context.Context, projectID, property string, start, end time.Time, limit int) ([]PropertyCount, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := d.read.QueryContext(ctx, `
+		SELECT json_extract_string(properties, '$.' || ?) AS val, COUNT(*) AS count
+		FROM events
+		WHERE project_id = ? AND timestamp >= ? AND timestamp <= ?`+internalFilter(ctx)+`
+		GROUP BY val
+		ORDER BY count DESC, val NULLS LAST
+		LIMIT ?
+	`, property, projectID, start, end, limit)
+	if err != nil {
+		return nil, fmt.Errorf("querying count by property: %w", err)
+	}
+	defer rows.Close()
+
+	var counts []PropertyCount
+	for rows.Next() {
+		var c PropertyCount
+		if err := rows.Scan(&c.Value, &c.Count); err != nil {
+			return nil, fmt.Errorf("scanning property count: %w", err)
+		}
+		counts = append(counts, c)
+	}
+	return counts, rows.Err()
+}
+
 func (d *DuckDB) QueryUsers(ctx context.Context, projectID string, limit, offset int, start, end time.Time) ([]UserProfile, int, error) {
 	if limit <= 0 {
 		limit = 50
@@ -431,10 +849,11 @@ func (d *DuckDB) QueryUsers(ctx context.Context, projectID string, limit, offset
 		where += " AND timestamp <= ?"
 		args = append(args, end)
 	}
+	where += internalFilter(ctx)
 
 	// Get total count.
 	var total int
-	err := d.db.QueryRowContext(ctx, fmt.Sprintf(
+	err := d.read.QueryRowContext(ctx, fmt.Sprintf(
 		"SELECT COUNT(DISTINCT distinct_id) FROM events WHERE %s", where,
 	), args...).Scan(&total)
 	if err != nil {
@@ -451,7 +870,7 @@ func (d *DuckDB) QueryUsers(ctx context.Context, projectID string, limit, offset
 	`, where)
 	args = append(args, limit, offset)
 
-	rows, err := d.db.QueryContext(ctx, query, args...)
+	rows, err := d.read.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("querying users: %w", err)
 	}
@@ -468,15 +887,191 @@ func (d *DuckDB) QueryUsers(ctx context.Context, projectID string, limit, offset
 	return users, total, rows.Err()
 }
 
-// QueryFunnel runs a session-based funnel analysis with ordered steps.
+// QueryFunnel runs a session-based funnel analysis. In FunnelOrdered mode
+// (the default) a non-zero window is the conversion window: each step must
+// follow the previous one within it. In FunnelUnordered mode steps may come
+// in any order, and a non-zero window bounds each one to within window of the
+// session's first step-one event, before or after. Zero leaves steps
+// unbounded. pop restricts which sessions may enter at the first step.
 // All values are inlined into the SQL to avoid go-duckdb parameter binding issues.
-func (d *DuckDB) QueryFunnel(ctx context.Context, projectID string, steps []FunnelStep, start, end time.Time) ([]FunnelResult, error) {
+func (d *DuckDB) QueryFunnel(ctx context.Context, projectID string, steps []FunnelStep, start, end time.Time, window time.Duration, mode string, pop FunnelPopulation) ([]FunnelResult, error) {
+	if len(steps) == 0 {
+		return nil, nil
+	}
+	if err := ValidateFunnelSteps(steps); err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(funnelStepsSQL(ctx, projectID, steps, start, end, window, mode, pop, ""))
+	for i, step := range steps {
+		if i > 0 {
+			sb.WriteString("UNION ALL\n")
+		}
+		sb.WriteString(fmt.Sprintf("SELECT '%s' as step, COUNT(*) as count FROM step%d\n", sqlEsc(funnelStepLabel(i, step)), i+1))
+	}
+
+	rows, err := d.read.QueryContext(ctx, sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("querying funnel: %w", err)
+	}
+	defer rows.Close()
+
+	var results []FunnelResult
+	for rows.Next() {
+		var r FunnelResult
+		if err := rows.Scan(&r.Step, &r.Count); err != nil {
+			return nil, fmt.Errorf("scanning funnel result: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// QueryFunnelBreakdown runs QueryFunnel segmented by the value of
+// properties.<property> on each session's first step-one event. Only the
+// DefaultBreakdownTop values entering the most sessions are returned, largest
+// first.
+func (d *DuckDB) QueryFunnelBreakdown(ctx context.Context, projectID string, steps []FunnelStep, property string, start, end time.Time, window time.Duration, mode string, pop FunnelPopulation) ([]FunnelBreakdown, error) {
 	if len(steps) == 0 {
 		return nil, nil
 	}
+	if err := ValidateFunnelSteps(steps); err != nil {
+		return nil, err
+	}
 
 	var sb strings.Builder
+	sb.WriteString(funnelStepsSQL(ctx, projectID, steps, start, end, window, mode, pop,
+		fmt.Sprintf("json_extract_string(properties, '$.' || '%s')", sqlEsc(property))))
+	sb.WriteString(fmt.Sprintf(", top AS (\n  SELECT value, COUNT(*) as n FROM step1 GROUP BY value ORDER BY n DESC, value NULLS LAST LIMIT %d\n)\n", DefaultBreakdownTop))
+	for i := range steps {
+		if i > 0 {
+			sb.WriteString("UNION ALL\n")
+		}
+		sb.WriteString(fmt.Sprintf("SELECT s.value, %d as idx, COUNT(*) as count FROM step%d s JOIN top t ON s.value IS NOT DISTINCT FROM t.value GROUP BY s.value\n", i, i+1))
+	}
+
+	rows, err := d.read.QueryContext(ctx, sb.String())
+	if err != nil {
+		return nil, fmt.Errorf("querying funnel breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	newSteps := func() []FunnelResult {
+		r := make([]FunnelResult, len(steps))
+		for i, step := range steps {
+			r[i].Step = funnelStepLabel(i, step)
+		}
+		return r
+	}
+	var breakdown []FunnelBreakdown
+	index := map[string]int{}
+	nullIndex := -1
+	for rows.Next() {
+		var value *string
+		var idx int
+		var count int64
+		if err := rows.Scan(&value, &idx, &count); err != nil {
+			return nil, fmt.Errorf("scanning funnel breakdown row: %w", err)
+		}
+		var i int
+		var ok bool
+		if value == nil {
+			i, ok = nullIndex, nullIndex >= 0
+		} else {
+			i, ok = index[*value]
+		}
+		if !ok {
+			i = len(breakdown)
+			breakdown = append(breakdown, FunnelBreakdown{Value: value, Steps: newSteps()})
+			if value == nil {
+				nullIndex = i
+			} else {
+				index[*value] = i
+			}
+		}
+		if idx >= 0 && idx < len(steps) {
+			breakdown[i].Steps[idx].Count = count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(breakdown, func(i, j int) bool {
+		return breakdown[i].Steps[0].Count > breakdown[j].Steps[0].Count
+	})
+	return breakdown, nil
+}
+
+// QueryFunnelConverters pages through the sessions that reached a funnel's
+// last step, most recent first, with each session's latest distinct ID. It
+// also returns how many sessions converted in all.
+func (d *DuckDB) QueryFunnelConverters(ctx context.Context, projectID string, steps []FunnelStep, start, end time.Time, window time.Duration, mode string, limit, offset int) ([]FunnelConverter, int64, error) {
+	if len(steps) == 0 {
+		return nil, 0, nil
+	}
+	if err := ValidateFunnelSteps(steps); err != nil {
+		return nil, 0, err
+	}
+	if limit <= 0 {
+		limit = 50
+	}
+	offset = max(offset, 0)
+
+	var sb strings.Builder
+	sb.WriteString(funnelStepsSQL(ctx, projectID, steps, start, end, window, mode, FunnelPopulation{}, ""))
+	sb.WriteString(fmt.Sprintf(`, page AS (
+  SELECT session_id, ts, COUNT(*) OVER () as total FROM step%d
+  ORDER BY ts DESC, session_id LIMIT %d OFFSET %d
+)
+SELECT p.session_id, COALESCE((
+  SELECT arg_max(e.distinct_id, e.timestamp) FROM events e
+  WHERE e.project_id = '%s' AND e.session_id = p.session_id AND COALESCE(e.distinct_id, '') != ''
+), ''), p.ts, p.total
+FROM page p ORDER BY p.ts DESC, p.session_id
+`, len(steps), limit, offset, sqlEsc(projectID)))
+
+	rows, err := d.read.QueryContext(ctx, sb.String())
+	if err != nil {
+		return nil, 0, fmt.Errorf("querying funnel converters: %w", err)
+	}
+	defer rows.Close()
 
+	var converters []FunnelConverter
+	var total int64
+	for rows.Next() {
+		var c FunnelConverter
+		if err := rows.Scan(&c.SessionID, &c.DistinctID, &c.CompletedAt, &total); err != nil {
+			return nil, 0, fmt.Errorf("scanning funnel converter: %w", err)
+		}
+		converters = append(converters, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	// A page past the end has no rows to carry the total.
+	if len(converters) == 0 && offset > 0 {
+		var sb strings.Builder
+		sb.WriteString(funnelStepsSQL(ctx, projectID, steps, start, end, window, mode, FunnelPopulation{}, ""))
+		sb.WriteString(fmt.Sprintf("SELECT COUNT(*) FROM step%d\n", len(steps)))
+		if err := d.read.QueryRowContext(ctx, sb.String()).Scan(&total); err != nil {
+			return nil, 0, fmt.Errorf("counting funnel converters: %w", err)
+		}
+	}
+	return converters, total, nil
+}
+
+// funnelStepsSQL returns the WITH clause of a funnel query: one CTE per step,
+// step1 through stepN, each holding the sessions that reached that step and
+// when. A non-empty value is a SQL expression evaluated on each session's
+// first step-one event and carried through every step as value.
+//
+// Ordered steps take ts from their own event, so the next step must follow
+// it. Unordered steps keep step one's ts as the session's anchor and match
+// events on either side of it.
+func funnelStepsSQL(ctx context.Context, projectID string, steps []FunnelStep, start, end time.Time, window time.Duration, mode string, pop FunnelPopulation, value string) string {
+	ordered := mode != FunnelUnordered
+	var sb strings.Builder
 	for i, step := range steps {
 		if i == 0 {
 			sb.WriteString("WITH ")
@@ -485,9 +1080,21 @@ func (d *DuckDB) QueryFunnel(ctx context.Context, projectID string, steps []Funn
 		}
 		sb.WriteString(fmt.Sprintf("step%d AS (\n", i+1))
 		if i == 0 {
-			sb.WriteString(fmt.Sprintf("  SELECT DISTINCT session_id, MIN(timestamp) as ts FROM events WHERE project_id = '%s'", sqlEsc(projectID)))
+			sb.WriteString("  SELECT DISTINCT session_id, MIN(timestamp) as ts")
+			if value != "" {
+				sb.WriteString(", arg_min(" + value + ", timestamp) as value")
+			}
+			sb.WriteString(fmt.Sprintf(" FROM events WHERE project_id = '%s'", sqlEsc(projectID)))
 		} else {
-			sb.WriteString(fmt.Sprintf("  SELECT DISTINCT e.session_id, MIN(e.timestamp) as ts FROM events e JOIN step%d s ON e.session_id = s.session_id WHERE e.project_id = '%s'", i, sqlEsc(projectID)))
+			if ordered {
+				sb.WriteString("  SELECT DISTINCT e.session_id, MIN(e.timestamp) as ts")
+			} else {
+				sb.WriteString("  SELECT DISTINCT e.session_id, s.ts")
+			}
+			if value != "" {
+				sb.WriteString(", s.value")
+			}
+			sb.WriteString(fmt.Sprintf(" FROM events e JOIN step%d s ON e.session_id = s.session_id WHERE e.project_id = '%s'", i, sqlEsc(projectID)))
 		}
 		sb.WriteString(fmt.Sprintf(" AND event_type = '%s'", sqlEsc(step.EventType)))
 		if step.Fingerprint != "" {
@@ -503,44 +1110,42 @@ func (d *DuckDB) QueryFunnel(ctx context.Context, projectID string, steps []Funn
 		if !end.IsZero() {
 			sb.WriteString(fmt.Sprintf(" AND timestamp <= '%s'", end.Format(time.RFC3339)))
 		}
-		if i > 0 {
+		sb.WriteString(internalFilter(ctx))
+		if i == 0 {
+			sb.WriteString(pop.where(projectID, start, end))
+		}
+		if i > 0 && ordered {
 			sb.WriteString(" AND e.timestamp > s.ts")
+			if window > 0 {
+				sb.WriteString(fmt.Sprintf(" AND epoch(CAST(e.timestamp AS TIMESTAMP)) - epoch(CAST(s.ts AS TIMESTAMP)) <= %d", int64(window.Seconds())))
+			}
+		} else if i > 0 && window > 0 {
+			sb.WriteString(fmt.Sprintf(" AND abs(epoch(CAST(e.timestamp AS TIMESTAMP)) - epoch(CAST(s.ts AS TIMESTAMP))) <= %d", int64(window.Seconds())))
 		}
 		sb.WriteString("\n  GROUP BY ")
 		if i == 0 {
 			sb.WriteString("session_id")
 		} else {
 			sb.WriteString("e.session_id")
+			if !ordered {
+				sb.WriteString(", s.ts")
+			}
+			if value != "" {
+				sb.WriteString(", s.value")
+			}
 		}
 		sb.WriteString("\n)\n")
 	}
+	return sb.String()
+}
 
-	for i, step := range steps {
-		if i > 0 {
-			sb.WriteString("UNION ALL\n")
-		}
-		label := step.EventName
-		if label == "" {
-			label = step.EventType
-		}
-		sb.WriteString(fmt.Sprintf("SELECT '%s' as step, COUNT(*) as count FROM step%d\n", sqlEsc(fmt.Sprintf("Step %d: %s", i+1, label)), i+1))
-	}
-
-	rows, err := d.db.QueryContext(ctx, sb.String())
-	if err != nil {
-		return nil, fmt.Errorf("querying funnel: %w", err)
+// funnelStepLabel names a funnel step in results.
+func funnelStepLabel(i int, step FunnelStep) string {
+	label := step.EventName
+	if label == "" {
+		label = step.EventType
 	}
-	defer rows.Close()
-
-	var results []FunnelResult
-	for rows.Next() {
-		var r FunnelResult
-		if err := rows.Scan(&r.Step, &r.Count); err != nil {
-			return nil, fmt.Errorf("scanning funnel result: %w", err)
-		}
-		results = append(results, r)
-	}
-	return results, rows.Err()
+	return fmt.Sprintf("Step %d: %s", i+1, label)
 }
 
 // sqlEsc escapes single quotes for safe SQL string interpolation.
@@ -569,23 +1174,24 @@ func (d *DuckDB) QueryRetention(ctx context.Context, projectID, interval string,
 
 	query := fmt.Sprintf(`
 		WITH user_cohorts AS (
-			SELECT distinct_id, date_trunc('%s', CAST(MIN(timestamp) AS TIMESTAMP)) as cohort
+			SELECT distinct_id, date_trunc('%s', MIN(%s)) as cohort
 			FROM events WHERE project_id = ? AND distinct_id IS NOT NULL AND distinct_id != ''
-				AND timestamp >= ? AND timestamp <= ?
+				AND timestamp >= ? AND timestamp <= ?%s
 			GROUP BY distinct_id
 		),
 		user_activity AS (
-			SELECT DISTINCT e.distinct_id, date_trunc('%s', CAST(e.timestamp AS TIMESTAMP)) as activity_period
+			SELECT DISTINCT e.distinct_id, date_trunc('%s', %s) as activity_period
 			FROM events e WHERE e.project_id = ? AND e.distinct_id IS NOT NULL AND e.distinct_id != ''
-				AND e.timestamp >= ? AND e.timestamp <= ?
+				AND e.timestamp >= ? AND e.timestamp <= ?%s
 		)
 		SELECT CAST(uc.cohort AS VARCHAR) as cohort, COUNT(DISTINCT uc.distinct_id) as cohort_size%s
 		FROM user_cohorts uc
 		LEFT JOIN user_activity ua ON uc.distinct_id = ua.distinct_id
 		GROUP BY uc.cohort ORDER BY uc.cohort
-	`, interval, interval, periodCols.String())
+	`, interval, localTime(ctx, "timestamp", start, end), internalFilter(ctx),
+		interval, localTime(ctx, "e.timestamp", start, end), internalFilter(ctx), periodCols.String())
 
-	rows, err := d.db.QueryContext(ctx, query, projectID, start, end, projectID, start, end)
+	rows, err := d.read.QueryContext(ctx, query, projectID, start, end, projectID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("querying retention: %w", err)
 	}
@@ -626,6 +1232,9 @@ func (d *DuckDB) QueryFunnelCohorts(ctx context.Context, projectID string, steps
 	if len(steps) == 0 {
 		return nil, nil
 	}
+	if err := ValidateFunnelSteps(steps); err != nil {
+		return nil, err
+	}
 
 	switch interval {
 	case "day", "week", "month":
@@ -636,7 +1245,7 @@ func (d *DuckDB) QueryFunnelCohorts(ctx context.Context, projectID string, steps
 	var sb strings.Builder
 
 	// Cohorts CTE — first-seen date per session.
-	sb.WriteString(fmt.Sprintf("WITH cohorts AS (\n  SELECT session_id, CAST(date_trunc('%s', CAST(MIN(timestamp) AS TIMESTAMP)) AS VARCHAR) as cohort\n  FROM events WHERE project_id = '%s'", interval, sqlEsc(projectID)))
+	sb.WriteString(fmt.Sprintf("WITH cohorts AS (\n  SELECT session_id, CAST(date_trunc('%s', MIN(%s)) AS VARCHAR) as cohort\n  FROM events WHERE project_id = '%s'", interval, localTime(ctx, "timestamp", start, end), sqlEsc(projectID)))
 	if !start.IsZero() {
 		sb.WriteString(fmt.Sprintf(" AND timestamp >= '%s'", start.Format(time.RFC3339)))
 	}
@@ -668,6 +1277,7 @@ func (d *DuckDB) QueryFunnelCohorts(ctx context.Context, projectID string, steps
 		if !end.IsZero() {
 			sb.WriteString(fmt.Sprintf(" AND timestamp <= '%s'", end.Format(time.RFC3339)))
 		}
+		sb.WriteString(internalFilter(ctx))
 		if i > 0 {
 			sb.WriteString(" AND e.timestamp > s.ts")
 		}
@@ -692,7 +1302,7 @@ func (d *DuckDB) QueryFunnelCohorts(ctx context.Context, projectID string, steps
 	}
 	sb.WriteString("ORDER BY cohort, step")
 
-	rows, err := d.db.QueryContext(ctx, sb.String())
+	rows, err := d.read.QueryContext(ctx, sb.String())
 	if err != nil {
 		return nil, fmt.Errorf("querying funnel cohorts: %w", err)
 	}
@@ -726,6 +1336,61 @@ func (d *DuckDB) QueryFunnelCohorts(ctx context.Context, projectID string, steps
 	return results, nil
 }
 
+// FunnelTrendPoint is a funnel's overall conversion for one period: of the
+// sessions that started in the period and entered the funnel, how many
+// reached the last step.
+type FunnelTrendPoint struct {
+	Period     string  `json:"period"`
+	Entered    int64   `json:"entered"`
+	Completed  int64   `json:"completed"`
+	Conversion float64 `json:"conversion"`
+}
+
+// QueryFunnelTrend computes the funnel's first-to-last-step conversion rate
+// for each interval bucket between start and end. It collapses the cohort
+// breakdown from QueryFunnelCohorts and gap-fills periods with no sessions.
+func (d *DuckDB) QueryFunnelTrend(ctx context.Context, projectID string, steps []FunnelStep, interval string, start, end time.Time) ([]FunnelTrendPoint, error) {
+	switch interval {
+	case "day", "week", "month":
+	default:
+		interval = "week"
+	}
+	cohorts, err := d.QueryFunnelCohorts(ctx, projectID, steps, interval, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	firstPrefix := "Step 1:"
+	lastPrefix := fmt.Sprintf("Step %d:", len(steps))
+	byPeriod := make(map[string]FunnelTrendPoint, len(cohorts))
+	for _, c := range cohorts {
+		p := FunnelTrendPoint{Period: c.Cohort}
+		for _, st := range c.Steps {
+			if strings.HasPrefix(st.Step, firstPrefix) {
+				p.Entered = st.Count
+			}
+			if strings.HasPrefix(st.Step, lastPrefix) {
+				p.Completed = st.Count
+			}
+		}
+		if p.Entered > 0 {
+			p.Conversion = float64(p.Completed) / float64(p.Entered)
+		}
+		byPeriod[c.Cohort] = p
+	}
+
+	buckets := trendBuckets(interval, start, end, locationFrom(ctx))
+	points := make([]FunnelTrendPoint, 0, len(buckets))
+	for _, b := range buckets {
+		p, ok := byPeriod[b]
+		if !ok {
+			p = FunnelTrendPoint{Period: b}
+		}
+		points = append(points, p)
+	}
+	return points, nil
+}
+
 // QueryTopSequences finds the most common 2- and 3-step event sequences across sessions.
 func (d *DuckDB) QueryTopSequences(ctx context.Context, projectID string, start, end time.Time, limit int) ([]EventSequence, error) {
 	if limit <= 0 {
@@ -737,7 +1402,7 @@ func (d *DuckDB) QueryTopSequences(ctx context.Context, projectID string, start,
 			SELECT session_id, event_type, COALESCE(event_name, '') as event_name,
 				ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp) as rn
 			FROM events
-			WHERE project_id = ? AND timestamp >= ? AND timestamp <= ?
+			WHERE project_id = ? AND timestamp >= ? AND timestamp <= ?` + internalFilter(ctx) + `
 		),
 		pairs AS (
 			SELECT a.event_type as t1, a.event_name as n1,
@@ -765,7 +1430,7 @@ func (d *DuckDB) QueryTopSequences(ctx context.Context, projectID string, start,
 		LIMIT ?
 	`
 
-	rows, err := d.db.QueryContext(ctx, query, projectID, start, end, limit)
+	rows, err := d.read.QueryContext(ctx, query, projectID, start, end, limit)
 	if err != nil {
 		return nil, fmt.Errorf("querying top sequences: %w", err)
 	}
@@ -795,6 +1460,8 @@ type PageStat struct {
 	Title    string `json:"title"`
 	Views    int64  `json:"views"`
 	Sessions int64  `json:"sessions"`
+	// Sparkline is daily views over the range, set by AttachPageSparklines.
+	Sparkline []int64 `json:"sparkline,omitempty"`
 }
 
 type TrendSeries struct {
@@ -802,21 +1469,23 @@ type TrendSeries struct {
 	Data []TrendPoint `json:"data"`
 }
 
-func (d *DuckDB) QueryTopPages(ctx context.Context, projectID string, start, end time.Time, limit int) ([]PageStat, error) {
+// QueryTopPages returns the most viewed pages. When rules are given, paths are
+// normalized with them (see PathRule) before grouping; nil groups raw paths.
+func (d *DuckDB) QueryTopPages(ctx context.Context, projectID string, start, end time.Time, limit int, rules []PathRule) ([]PageStat, error) {
 	if limit <= 0 {
 		limit = 50
 	}
-	rows, err := d.db.QueryContext(ctx, `
+	rows, err := d.read.QueryContext(ctx, `
 		SELECT
-			url_path,
+			`+pathExpr("url_path", rules)+` AS path,
 			MAX(COALESCE(page_title, '')) as page_title,
 			COUNT(*) as views,
 			COUNT(DISTINCT session_id) as sessions
 		FROM events
 		WHERE project_id = ? AND event_type = 'pageview'
 			AND timestamp >= ? AND timestamp <= ?
-			AND url_path IS NOT NULL AND url_path != ''
-		GROUP BY url_path
+			AND url_path IS NOT NULL AND url_path != ''`+internalFilter(ctx)+`
+		GROUP BY path
 		ORDER BY views DESC
 		LIMIT ?
 	`, projectID, start, end, limit)
@@ -836,9 +1505,29 @@ func (d *DuckDB) QueryTopPages(ctx context.Context, projectID string, start, end
 	return stats, rows.Err()
 }
 
+// Synthetic breakdown series added by QueryTrendsBreakdown with totals set.
+const (
+	OtherSeries = "Other"      // every series beyond the top ones
+	TotalSeries = "All events" // every series together
+)
+
+// DefaultBreakdownTop is how many series QueryTrendsBreakdown returns
+// individually when top isn't set; MaxBreakdownTop caps what callers ask for.
+const (
+	DefaultBreakdownTop = 8
+	MaxBreakdownTop     = 50
+)
+
 // QueryTrendsBreakdown returns time-bucketed event counts split by a dimension.
-// groupBy accepts "event_name", "event_type", or "url_path".
-func (d *DuckDB) QueryTrendsBreakdown(ctx context.Context, projectID, interval, groupBy string, start, end time.Time) ([]TrendSeries, error) {
+// groupBy accepts "event_name", "event_type", or "url_path". Only the top
+// series by total count are returned (DefaultBreakdownTop when top <= 0, at
+// most MaxBreakdownTop); with totals set, an OtherSeries summing the rest and
+// a TotalSeries over everything follow them so the chart adds up.
+func (d *DuckDB) QueryTrendsBreakdown(ctx context.Context, projectID, interval, groupBy string, start, end time.Time, top int, totals bool) ([]TrendSeries, error) {
+	if top <= 0 {
+		top = DefaultBreakdownTop
+	}
+	top = min(top, MaxBreakdownTop)
 	switch interval {
 	case "minute", "hour", "day", "week", "month":
 	default:
@@ -857,17 +1546,17 @@ func (d *DuckDB) QueryTrendsBreakdown(ctx context.Context, projectID, interval,
 
 	query := fmt.Sprintf(`
 		SELECT
-			CAST(date_trunc('%s', CAST(timestamp AS TIMESTAMP)) AS VARCHAR) as bucket,
+			CAST(date_trunc('%s', %s) AS VARCHAR) as bucket,
 			COALESCE(CAST(%s AS VARCHAR), '') as series,
 			COUNT(*) as count
 		FROM events
 		WHERE project_id = ? AND timestamp >= ? AND timestamp <= ?
-			AND %s IS NOT NULL AND CAST(%s AS VARCHAR) != ''
+			AND %s IS NOT NULL AND CAST(%s AS VARCHAR) != ''%s
 		GROUP BY bucket, series
 		ORDER BY bucket, series
-	`, interval, seriesExpr, seriesExpr, seriesExpr)
+	`, interval, localTime(ctx, "timestamp", start, end), seriesExpr, seriesExpr, seriesExpr, internalFilter(ctx))
 
-	rows, err := d.db.QueryContext(ctx, query, projectID, start, end)
+	rows, err := d.read.QueryContext(ctx, query, projectID, start, end)
 	if err != nil {
 		return nil, fmt.Errorf("querying trends breakdown: %w", err)
 	}
@@ -878,7 +1567,7 @@ func (d *DuckDB) QueryTrendsBreakdown(ctx context.Context, projectID, interval,
 		count  int64
 	}
 	seriesData := map[string][]entry{}
-	var seriesOrder []string
+	var seriesOrder, buckets []string
 
 	for rows.Next() {
 		var bucket, series string
@@ -889,13 +1578,16 @@ func (d *DuckDB) QueryTrendsBreakdown(ctx context.Context, projectID, interval,
 		if _, ok := seriesData[series]; !ok {
 			seriesOrder = append(seriesOrder, series)
 		}
+		if len(buckets) == 0 || buckets[len(buckets)-1] != bucket {
+			buckets = append(buckets, bucket)
+		}
 		seriesData[series] = append(seriesData[series], entry{bucket, count})
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	// Pick top 8 series by total count.
+	// Pick the top series by total count.
 	type scored struct {
 		name  string
 		total int64
@@ -910,10 +1602,7 @@ func (d *DuckDB) QueryTrendsBreakdown(ctx context.Context, projectID, interval,
 	}
 	sort.Slice(scores, func(i, j int) bool { return scores[i].total > scores[j].total })
 
-	topN := 8
-	if len(scores) < topN {
-		topN = len(scores)
-	}
+	topN := min(top, len(scores))
 	topNames := make(map[string]struct{}, topN)
 	for i := 0; i < topN; i++ {
 		topNames[scores[i].name] = struct{}{}
@@ -931,13 +1620,48 @@ func (d *DuckDB) QueryTrendsBreakdown(ctx context.Context, projectID, interval,
 		}
 		result = append(result, TrendSeries{Name: name, Data: pts})
 	}
-	return result, nil
+	if !totals || len(buckets) == 0 {
+		return result, nil
+	}
+
+	other := map[string]int64{}
+	total := map[string]int64{}
+	hasOther := false
+	for name, entries := range seriesData {
+		_, top := topNames[name]
+		for _, e := range entries {
+			total[e.bucket] += e.count
+			if !top {
+				other[e.bucket] += e.count
+				hasOther = true
+			}
+		}
+	}
+	points := func(counts map[string]int64) []TrendPoint {
+		pts := make([]TrendPoint, len(buckets))
+		for i, b := range buckets {
+			pts[i] = TrendPoint{Bucket: b, Count: counts[b]}
+		}
+		return pts
+	}
+	if hasOther {
+		result = append(result, TrendSeries{Name: OtherSeries, Data: points(other)})
+	}
+	return append(result, TrendSeries{Name: TotalSeries, Data: points(total)}), nil
 }
 
+// EventNameStat summarizes one named event. UniqueSessions and UniqueUsers
+// tell one user clicking a hundred times apart from a hundred users clicking
+// once; UniqueUsers counts identified distinct IDs only.
 type EventNameStat struct {
-	Name     string    `json:"name"`
-	Count    int64     `json:"count"`
-	LastSeen time.Time `json:"last_seen"`
+	Name           string    `json:"name"`
+	Count          int64     `json:"count"`
+	UniqueSessions int64     `json:"unique_sessions"`
+	UniqueUsers    int64     `json:"unique_users"`
+	LastSeen       time.Time `json:"last_seen"`
+	// Sparkline is the daily count over the range, set by
+	// AttachEventSparklines.
+	Sparkline []int64 `json:"sparkline,omitempty"`
 }
 
 func (d *DuckDB) QueryTopEventNames(ctx context.Context, projectID string, start, end time.Time, limit int) ([]EventNameStat, error) {
@@ -954,10 +1678,14 @@ func (d *DuckDB) QueryTopEventNames(ctx context.Context, projectID string, start
 		where += " AND timestamp <= ?"
 		args = append(args, end)
 	}
+	where += internalFilter(ctx)
 	args = append(args, limit)
 
-	rows, err := d.db.QueryContext(ctx, fmt.Sprintf(`
-		SELECT event_name, COUNT(*) as count, MAX(timestamp) as last_seen
+	rows, err := d.read.QueryContext(ctx, fmt.Sprintf(`
+		SELECT event_name, COUNT(*) as count,
+		       COUNT(DISTINCT session_id) as unique_sessions,
+		       COUNT(DISTINCT NULLIF(distinct_id, '')) as unique_users,
+		       MAX(timestamp) as last_seen
 		FROM events WHERE %s
 		GROUP BY event_name
 		ORDER BY count DESC
@@ -971,7 +1699,7 @@ func (d *DuckDB) QueryTopEventNames(ctx context.Context, projectID string, start
 	var stats []EventNameStat
 	for rows.Next() {
 		var s EventNameStat
-		if err := rows.Scan(&s.Name, &s.Count, &s.LastSeen); err != nil {
+		if err := rows.Scan(&s.Name, &s.Count, &s.UniqueSessions, &s.UniqueUsers, &s.LastSeen); err != nil {
 			return nil, fmt.Errorf("scanning event name stat: %w", err)
 		}
 		stats = append(stats, s)
@@ -991,16 +1719,18 @@ type HeatmapPoint struct {
 	Count int64   `json:"count"`
 }
 
-func (d *DuckDB) QueryPaths(ctx context.Context, projectID string, start, end time.Time, limit int) ([]PathTransition, error) {
+// QueryPaths returns the most common page-to-page transitions, optionally
+// normalizing paths with rules first.
+func (d *DuckDB) QueryPaths(ctx context.Context, projectID string, start, end time.Time, limit int, rules []PathRule) ([]PathTransition, error) {
 	if limit <= 0 {
 		limit = 20
 	}
-	rows, err := d.db.QueryContext(ctx, `
+	rows, err := d.read.QueryContext(ctx, `
 		WITH ordered AS (
-			SELECT session_id, url_path,
+			SELECT session_id, `+pathExpr("url_path", rules)+` AS url_path,
 			       ROW_NUMBER() OVER (PARTITION BY session_id ORDER BY timestamp) AS rn
 			FROM events WHERE project_id = ? AND event_type = 'pageview'
-				AND timestamp BETWEEN ? AND ?
+				AND timestamp BETWEEN ? AND ?`+internalFilter(ctx)+`
 		),
 		transitions AS (
 			SELECT a.url_path AS from_path, b.url_path AS to_path
@@ -1028,17 +1758,20 @@ func (d *DuckDB) QueryPaths(ctx context.Context, projectID string, start, end ti
 	return transitions, rows.Err()
 }
 
-func (d *DuckDB) QueryHeatmap(ctx context.Context, projectID, urlPath string, start, end time.Time) ([]HeatmapPoint, error) {
-	rows, err := d.db.QueryContext(ctx, `
+// QueryHeatmap returns click density for a page. With rules, urlPath is a
+// normalized path (e.g. /product/:id) and matches every concrete page that
+// normalizes to it.
+func (d *DuckDB) QueryHeatmap(ctx context.Context, projectID, urlPath string, start, end time.Time, rules []PathRule) ([]HeatmapPoint, error) {
+	rows, err := d.read.QueryContext(ctx, `
 		SELECT
 			ROUND(CAST(json_extract(properties, '$.client_x') AS DOUBLE), 2) AS x,
 			ROUND(CAST(json_extract(properties, '$.client_y') AS DOUBLE), 2) AS y,
 			COUNT(*) AS cnt
 		FROM events
 		WHERE project_id = ? AND event_type = 'click'
-			AND url_path = ?
+			AND `+pathExpr("url_path", rules)+` = ?
 			AND json_extract(properties, '$.client_x') IS NOT NULL
-			AND timestamp BETWEEN ? AND ?
+			AND timestamp BETWEEN ? AND ?`+internalFilter(ctx)+`
 		GROUP BY x, y
 		ORDER BY cnt DESC
 	`, projectID, urlPath, start, end)
@@ -1058,6 +1791,61 @@ func (d *DuckDB) QueryHeatmap(ctx context.Context, projectID, urlPath string, st
 	return points, rows.Err()
 }
 
+// PerformanceStat is the distribution of one performance metric (e.g. LCP)
+// on one page.
+type PerformanceStat struct {
+	Path    string  `json:"path"`
+	Samples int64   `json:"samples"`
+	P50     float64 `json:"p50"`
+	P75     float64 `json:"p75"`
+	P95     float64 `json:"p95"`
+}
+
+// QueryPerformance returns per-page percentiles of a performance metric
+// recorded by "performance" events, whose properties carry the metric name
+// and its value. An empty urlPath returns every page, busiest first.
+func (d *DuckDB) QueryPerformance(ctx context.Context, projectID, metric, urlPath string, start, end time.Time) ([]PerformanceStat, error) {
+	args := []any{projectID, metric, start, end}
+	var pathFilter string
+	if urlPath != "" {
+		pathFilter = " AND url_path = ?"
+		args = append(args, urlPath)
+	}
+	rows, err := d.read.QueryContext(ctx, `
+		WITH samples AS (
+			SELECT url_path, TRY_CAST(json_extract(properties, '$.value') AS DOUBLE) AS value
+			FROM events
+			WHERE project_id = ? AND event_type = 'performance'
+				AND json_extract_string(properties, '$.metric') = ?
+				AND timestamp >= ? AND timestamp <= ?`+pathFilter+internalFilter(ctx)+`
+		)
+		SELECT
+			url_path,
+			COUNT(*) AS samples,
+			quantile_cont(value, 0.5) AS p50,
+			quantile_cont(value, 0.75) AS p75,
+			quantile_cont(value, 0.95) AS p95
+		FROM samples
+		WHERE value IS NOT NULL
+		GROUP BY url_path
+		ORDER BY samples DESC, url_path
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying performance: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []PerformanceStat
+	for rows.Next() {
+		var s PerformanceStat
+		if err := rows.Scan(&s.Path, &s.Samples, &s.P50, &s.P75, &s.P95); err != nil {
+			return nil, fmt.Errorf("scanning performance stat: %w", err)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
 type ErrorGroup struct {
 	Message   string       `json:"message"`
 	ErrorType string       `json:"error_type"`
@@ -1075,7 +1863,7 @@ func (d *DuckDB) QueryErrorGroups(ctx context.Context, projectID string, start,
 		limit = 50
 	}
 
-	rows, err := d.db.QueryContext(ctx, `
+	rows, err := d.read.QueryContext(ctx, `
 		SELECT
 			COALESCE(json_extract_string(properties, '$.message'), 'Unknown error') AS message,
 			CASE
@@ -1099,7 +1887,7 @@ func (d *DuckDB) QueryErrorGroups(ctx context.Context, projectID string, start,
 			FIRST(id) AS sample_id
 		FROM events
 		WHERE project_id = ? AND event_type = 'error'
-			AND timestamp >= ? AND timestamp <= ?
+			AND timestamp >= ? AND timestamp <= ?`+internalFilter(ctx)+`
 		GROUP BY message, error_type
 		ORDER BY count DESC
 		LIMIT ?
@@ -1123,8 +1911,8 @@ func (d *DuckDB) QueryErrorGroups(ctx context.Context, projectID string, start,
 
 	// Get total count of all error events in range.
 	var total int
-	err = d.db.QueryRowContext(ctx,
-		`SELECT COUNT(*) FROM events WHERE project_id = ? AND event_type = 'error' AND timestamp >= ? AND timestamp <= ?`,
+	err = d.read.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM events WHERE project_id = ? AND event_type = 'error' AND timestamp >= ? AND timestamp <= ?`+internalFilter(ctx),
 		projectID, start, end,
 	).Scan(&total)
 	if err != nil {
@@ -1149,17 +1937,17 @@ func (d *DuckDB) QueryErrorTrends(ctx context.Context, projectID string, start,
 	query := fmt.Sprintf(`
 		SELECT
 			COALESCE(json_extract_string(properties, '$.message'), 'Unknown error') AS message,
-			CAST(date_trunc('day', CAST(timestamp AS TIMESTAMP)) AS VARCHAR) AS bucket,
+			CAST(date_trunc('day', %s) AS VARCHAR) AS bucket,
 			COUNT(*) AS count
 		FROM events
 		WHERE project_id = ? AND event_type = 'error'
 			AND timestamp >= ? AND timestamp <= ?
-			AND COALESCE(json_extract_string(properties, '$.message'), 'Unknown error') IN (%s)
+			AND COALESCE(json_extract_string(properties, '$.message'), 'Unknown error') IN (%s)%s
 		GROUP BY message, bucket
 		ORDER BY message, bucket
-	`, strings.Join(placeholders, ", "))
+	`, localTime(ctx, "timestamp", start, end), strings.Join(placeholders, ", "), internalFilter(ctx))
 
-	rows, err := d.db.QueryContext(ctx, query, args...)
+	rows, err := d.read.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("querying error trends: %w", err)
 	}
@@ -1179,7 +1967,7 @@ func (d *DuckDB) QueryErrorTrends(ctx context.Context, projectID string, start,
 }
 
 func (d *DuckDB) CountEvents(ctx context.Context, projectID, eventType, eventName string, since time.Time) (int64, error) {
-	query := "SELECT COUNT(*) FROM events WHERE project_id = ?"
+	query := "SELECT " + countExpr(ctx) + " FROM events WHERE project_id = ?" + internalFilter(ctx)
 	args := []any{projectID}
 	if eventType != "" {
 		query += " AND event_type = ?"
@@ -1194,10 +1982,84 @@ func (d *DuckDB) CountEvents(ctx context.Context, projectID, eventType, eventNam
 		args = append(args, since)
 	}
 	var count int64
-	err := d.db.QueryRowContext(ctx, query, args...).Scan(&count)
+	err := d.read.QueryRowContext(ctx, query, args...).Scan(&count)
 	return count, err
 }
 
+// CountMatchingEvents counts the events QueryEvents would return for f
+// without a limit. Limit, Offset and the cursor are ignored.
+func (d *DuckDB) CountMatchingEvents(ctx context.Context, f EventFilter) (int64, error) {
+	where, args := d.eventFilterWhere(ctx, f)
+	var count int64
+	if err := d.read.QueryRowContext(ctx, "SELECT COUNT(*) FROM events WHERE "+where, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("counting events: %w", err)
+	}
+	return count, nil
+}
+
+// LatestEventTime returns the timestamp of the project's most recent event, or
+// nil when it has none. Internal traffic counts: this tracks ingestion, not
+// analytics.
+func (d *DuckDB) LatestEventTime(ctx context.Context, projectID string) (*time.Time, error) {
+	var last *time.Time
+	err := d.read.QueryRowContext(ctx,
+		"SELECT MAX(timestamp) FROM events WHERE project_id = ?", projectID,
+	).Scan(&last)
+	if err != nil {
+		return nil, fmt.Errorf("querying latest event: %w", err)
+	}
+	return last, nil
+}
+
+// NamingCoveragePoint describes the interaction fingerprints first seen on one
+// day: how many appeared and how many are still unnamed. Named is filled in
+// from the metadata store with the names generated that day.
+type NamingCoveragePoint struct {
+	Bucket          string `json:"bucket"`
+	NewFingerprints int64  `json:"new_fingerprints"`
+	Unnamed         int64  `json:"unnamed"`
+	Named           int64  `json:"named"`
+}
+
+// QueryNamingCoverage buckets a project's click, input and submit
+// fingerprints by the day they were first seen, counting those with no
+// event name on any of their events. Only fingerprints first seen between
+// start and end are included.
+func (d *DuckDB) QueryNamingCoverage(ctx context.Context, projectID string, start, end time.Time) ([]NamingCoveragePoint, error) {
+	rows, err := d.read.QueryContext(ctx, fmt.Sprintf(`
+		WITH fps AS (
+			SELECT fingerprint,
+				MIN(timestamp) AS first_seen,
+				BOOL_OR(COALESCE(event_name, '') != '') AS named
+			FROM events
+			WHERE project_id = ? AND event_type IN ('click', 'input', 'submit')
+				AND fingerprint IS NOT NULL AND fingerprint != ''
+			GROUP BY fingerprint
+		)
+		SELECT CAST(date_trunc('day', %s) AS VARCHAR) AS bucket,
+			COUNT(*) AS new_fingerprints,
+			COUNT(*) FILTER (WHERE NOT named) AS unnamed
+		FROM fps
+		WHERE first_seen >= ? AND first_seen <= ?
+		GROUP BY bucket
+		ORDER BY bucket
+	`, localTime(ctx, "first_seen", start, end)), projectID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("querying naming coverage: %w", err)
+	}
+	defer rows.Close()
+
+	var points []NamingCoveragePoint
+	for rows.Next() {
+		var p NamingCoveragePoint
+		if err := rows.Scan(&p.Bucket, &p.NewFingerprints, &p.Unnamed); err != nil {
+			return nil, fmt.Errorf("scanning naming coverage row: %w", err)
+		}
+		points = append(points, p)
+	}
+	return points, rows.Err()
+}
+
 func (d *DuckDB) BackfillEventName(ctx context.Context, projectID, fingerprint, name string) error {
 	_, err := d.db.ExecContext(ctx,
 		`UPDATE events SET event_name = ? WHERE project_id = ? AND fingerprint = ? AND event_name IS NULL`,
@@ -1206,21 +2068,39 @@ func (d *DuckDB) BackfillEventName(ctx context.Context, projectID, fingerprint,
 	return err
 }
 
-// DeleteOldEvents removes events older than the given cutoff for a project.
-func (d *DuckDB) DeleteOldEvents(ctx context.Context, projectID string, before time.Time) (int64, error) {
+// MergeEventProperties merges props into an existing event's properties as a
+// JSON merge patch: keys are added or replaced, and a null value removes the
+// key. It reports whether the event exists in the project.
+func (d *DuckDB) MergeEventProperties(ctx context.Context, projectID, id string, props map[string]any) (bool, error) {
+	patch, err := json.Marshal(props)
+	if err != nil {
+		return false, fmt.Errorf("encoding properties: %w", err)
+	}
 	result, err := d.db.ExecContext(ctx,
-		`DELETE FROM events WHERE project_id = ? AND timestamp < ?`,
-		projectID, before,
+		`UPDATE events SET properties = json_merge_patch(COALESCE(properties, '{}'), ?::JSON)
+		 WHERE project_id = ? AND id = ?`,
+		string(patch), projectID, id,
 	)
 	if err != nil {
-		return 0, err
+		return false, fmt.Errorf("merging event properties: %w", err)
 	}
-	return result.RowsAffected()
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	return true, d.syncPromotedProperties(ctx, projectID, id)
 }
 
-// QueryTimeout creates a context with a 30-second timeout for dashboard queries.
-func (d *DuckDB) QueryTimeout() (context.Context, context.CancelFunc) {
-	return context.WithTimeout(context.Background(), 30*time.Second)
+// DeleteOldEvents removes events older than the given cutoff for a project.
+func (d *DuckDB) DeleteOldEvents(ctx context.Context, projectID string, before time.Time) (int64, error) {
+	return d.deleteEventsWhere(ctx, projectID, "project_id = ? AND timestamp < ?", []any{projectID, before})
+}
+
+// QueryTimeout derives a context with a 30-second timeout for dashboard
+// queries. Pass the request context so the query is also interrupted when the
+// client disconnects.
+func (d *DuckDB) QueryTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(parent, 30*time.Second)
 }
 
 // Checkpoint flushes the DuckDB WAL to the main database file, making it safe to copy.
@@ -1243,7 +2123,325 @@ func (d *DuckDB) MergeDistinctID(ctx context.Context, projectID, oldID, newID st
 	return result.RowsAffected()
 }
 
+// BackfillSessionDistinctID attributes anonymous events (no distinct ID) to
+// distinctID when it is the next ID known in their session: a session's
+// events from before identify belong to the user it identified as. Events
+// followed by a different ID, as on a shared device, keep waiting for that
+// one. Returns the number of rows updated.
+func (d *DuckDB) BackfillSessionDistinctID(ctx context.Context, projectID, distinctID string) (int64, error) {
+	result, err := d.db.ExecContext(ctx,
+		`UPDATE events SET distinct_id = ?
+		 WHERE project_id = ? AND COALESCE(distinct_id, '') = ''
+			AND session_id IN (SELECT session_id FROM events WHERE project_id = ? AND distinct_id = ?)
+			AND ? = (
+				SELECT k.distinct_id FROM events k
+				WHERE k.project_id = events.project_id AND k.session_id = events.session_id
+					AND COALESCE(k.distinct_id, '') != '' AND k.timestamp >= events.timestamp
+				ORDER BY k.timestamp LIMIT 1
+			)`,
+		distinctID, projectID, projectID, distinctID, distinctID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteUserEvents removes all of a project's events recorded under any of
+// the given distinct IDs. Returns the number of rows deleted.
+func (d *DuckDB) DeleteUserEvents(ctx context.Context, projectID string, distinctIDs []string) (int64, error) {
+	if len(distinctIDs) == 0 {
+		return 0, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(distinctIDs)), ",")
+	args := []any{projectID}
+	for _, id := range distinctIDs {
+		args = append(args, id)
+	}
+	return d.deleteEventsWhere(ctx, projectID, "project_id = ? AND distinct_id IN ("+placeholders+")", args)
+}
+
+// SessionSummary is one session in the session list.
+type SessionSummary struct {
+	SessionID  string    `json:"session_id"`
+	DistinctID string    `json:"distinct_id,omitempty"`
+	EventCount int64     `json:"event_count"`
+	FirstSeen  time.Time `json:"first_seen"`
+	LastSeen   time.Time `json:"last_seen"`
+	EntryURL   string    `json:"entry_url"`
+	ExitURL    string    `json:"exit_url,omitempty"`
+	Referrer   string    `json:"referrer,omitempty"`
+	// DurationSeconds is the time from the first to the last event. Bounced
+	// marks a session that never went past its landing: a single event, or
+	// one pageview and no interactions.
+	DurationSeconds int64 `json:"duration_seconds"`
+	Bounced         bool  `json:"bounced"`
+	// ClientSessions is how many SDK sessions a stitched session joins.
+	ClientSessions int64 `json:"client_sessions,omitempty"`
+}
+
+// sessionInteractionTypes are the event types that show a visitor engaged
+// with a page rather than bounced.
+const sessionInteractionTypes = "'click', 'input', 'submit', 'custom'"
+
+// ExposureEvent is the event name recorded for a logged feature flag
+// exposure.
+const ExposureEvent = "$feature_flag_called"
+
+// sessionEventsFilter leaves flag exposures out of session aggregates: they
+// are logged by the server on flag evaluation, not by the visitor, so they
+// would otherwise add sessions, and interactions that hide bounces.
+const sessionEventsFilter = " AND event_name IS DISTINCT FROM '" + ExposureEvent + "'"
+
+// finish derives the computed fields from the scanned aggregates.
+func (s *SessionSummary) finish(pageviews, interactions int64) {
+	s.DurationSeconds = int64(s.LastSeen.Sub(s.FirstSeen).Seconds())
+	s.Bounced = s.EventCount == 1 || (pageviews == 1 && interactions == 0)
+}
+
+// maxSessionURL caps the URLs and referrer returned per session so a page of
+// sessions stays small however long the tracked URLs are.
+const maxSessionURL = 512
+
+// SessionFilter selects sessions: the events they are built from, plus
+// thresholds on the aggregated session. Zero thresholds keep every session.
+type SessionFilter struct {
+	EventFilter
+	MinEvents   int           // at least this many events
+	MinDuration time.Duration // at least this long from first to last event
+}
+
+// having returns the HAVING clause for the session thresholds, or "".
+func (f SessionFilter) having() (string, []any) {
+	var conds []string
+	var args []any
+	if f.MinEvents > 0 {
+		conds = append(conds, "COUNT(*) >= ?")
+		args = append(args, f.MinEvents)
+	}
+	if f.MinDuration > 0 {
+		conds = append(conds, "epoch(CAST(MAX(timestamp) AS TIMESTAMP)) - epoch(CAST(MIN(timestamp) AS TIMESTAMP)) >= ?")
+		args = append(args, f.MinDuration.Seconds())
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " HAVING " + strings.Join(conds, " AND "), args
+}
+
+// QuerySessions aggregates the project's events matching f into sessions,
+// most recently active first, and returns one page of them with the total
+// session count. A session's entry URL and referrer come from its first event
+// and its exit URL from its last pageview. f's Limit and Offset are ignored
+// in favour of limit and offset.
+func (d *DuckDB) QuerySessions(ctx context.Context, projectID string, f SessionFilter, limit, offset int) ([]SessionSummary, int64, error) {
+	f.ProjectID = projectID
+	where, args := d.eventFilterWhere(ctx, f.EventFilter)
+	where += internalFilter(ctx) + sessionEventsFilter
+	having, havingArgs := f.having()
+	args = append(args, havingArgs...)
+
+	var total int64
+	if err := d.read.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM (SELECT session_id FROM events WHERE `+where+` GROUP BY session_id`+having+`)`, args...,
+	).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("counting sessions: %w", err)
+	}
+
+	query := `
+		SELECT session_id,
+			COALESCE(arg_max(distinct_id, timestamp), '') AS distinct_id,
+			COUNT(*) AS event_count,
+			MIN(timestamp) AS first_seen,
+			MAX(timestamp) AS last_seen,
+			left(COALESCE(arg_min(url, timestamp), ''), ?) AS entry_url,
+			left(COALESCE(arg_max(url, timestamp) FILTER (WHERE event_type = 'pageview'), ''), ?) AS exit_url,
+			left(COALESCE(arg_min(referrer, timestamp), ''), ?) AS referrer,
+			COUNT(*) FILTER (WHERE event_type = 'pageview') AS pageviews,
+			COUNT(*) FILTER (WHERE event_type IN (` + sessionInteractionTypes + `)) AS interactions
+		FROM events
+		WHERE ` + where + `
+		GROUP BY session_id` + having + `
+		ORDER BY last_seen DESC, session_id
+		LIMIT ? OFFSET ?`
+	args = append([]any{maxSessionURL, maxSessionURL, maxSessionURL}, args...)
+	rows, err := d.read.QueryContext(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("querying sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []SessionSummary
+	for rows.Next() {
+		var s SessionSummary
+		var pageviews, interactions int64
+		if err := rows.Scan(&s.SessionID, &s.DistinctID, &s.EventCount, &s.FirstSeen, &s.LastSeen, &s.EntryURL, &s.ExitURL, &s.Referrer,
+			&pageviews, &interactions); err != nil {
+			return nil, 0, fmt.Errorf("scanning session row: %w", err)
+		}
+		s.finish(pageviews, interactions)
+		sessions = append(sessions, s)
+	}
+	return sessions, total, rows.Err()
+}
+
+// SessionStats summarizes the sessions active in a time range.
+type SessionStats struct {
+	TotalSessions       int64   `json:"total_sessions"`
+	AvgDurationSeconds  float64 `json:"avg_duration_seconds"`
+	BounceRate          float64 `json:"bounce_rate"`
+	AvgEventsPerSession float64 `json:"avg_events_per_session"`
+}
+
+// QuerySessionStats aggregates the project's sessions between start and end
+// in SQL, with duration and bounce defined as on SessionSummary. A range
+// without sessions returns zeroes.
+func (d *DuckDB) QuerySessionStats(ctx context.Context, projectID string, start, end time.Time) (*SessionStats, error) {
+	query := `
+		SELECT COUNT(*),
+			COALESCE(AVG(duration), 0),
+			COALESCE(AVG(CASE WHEN event_count = 1 OR (pageviews = 1 AND interactions = 0) THEN 1.0 ELSE 0.0 END), 0),
+			COALESCE(AVG(event_count), 0)
+		FROM (
+			SELECT COUNT(*) AS event_count,
+				epoch(CAST(MAX(timestamp) AS TIMESTAMP)) - epoch(CAST(MIN(timestamp) AS TIMESTAMP)) AS duration,
+				COUNT(*) FILTER (WHERE event_type = 'pageview') AS pageviews,
+				COUNT(*) FILTER (WHERE event_type IN (` + sessionInteractionTypes + `)) AS interactions
+			FROM events
+			WHERE project_id = ? AND timestamp >= ? AND timestamp <= ?` + internalFilter(ctx) + sessionEventsFilter + `
+			GROUP BY session_id
+		)`
+	var st SessionStats
+	if err := d.read.QueryRowContext(ctx, query, projectID, start, end).Scan(
+		&st.TotalSessions, &st.AvgDurationSeconds, &st.BounceRate, &st.AvgEventsPerSession,
+	); err != nil {
+		return nil, fmt.Errorf("querying session stats: %w", err)
+	}
+	return &st, nil
+}
+
+// StitchGap is the inactivity that ends a stitched session.
+const StitchGap = 30 * time.Minute
+
+// QueryStitchedSessions is QuerySessions with sessions derived server-side
+// instead of taken from the client's session_id: each distinct ID's events
+// (or, for anonymous events, each client session's) form one session until a
+// gap of more than StitchGap between consecutive events starts the next. A
+// stitched session is reported under the client session_id it began in.
+func (d *DuckDB) QueryStitchedSessions(ctx context.Context, projectID string, f SessionFilter, limit, offset int) ([]SessionSummary, int64, error) {
+	f.ProjectID = projectID
+	where, args := d.eventFilterWhere(ctx, f.EventFilter)
+	where += internalFilter(ctx) + sessionEventsFilter
+	having, havingArgs := f.having()
+
+	// seq numbers each actor's sessions: a running count of session starts.
+	stitched := `
+		WITH actor_events AS (
+			SELECT *, COALESCE(NULLIF(distinct_id, ''), 'session:' || session_id) AS actor
+			FROM events WHERE ` + where + `
+		), starts AS (
+			SELECT *, CASE
+				WHEN lag(timestamp) OVER w IS NULL THEN 1
+				WHEN epoch(CAST(timestamp AS TIMESTAMP)) - epoch(CAST(lag(timestamp) OVER w AS TIMESTAMP)) > ? THEN 1
+				ELSE 0 END AS session_start
+			FROM actor_events
+			WINDOW w AS (PARTITION BY actor ORDER BY timestamp, id)
+		), stitched AS (
+			SELECT *, SUM(session_start) OVER (PARTITION BY actor ORDER BY timestamp, id ROWS UNBOUNDED PRECEDING) AS seq
+			FROM starts
+		)`
+	args = append(args, StitchGap.Seconds())
+	args = append(args, havingArgs...)
+
+	var total int64
+	if err := d.read.QueryRowContext(ctx,
+		stitched+` SELECT COUNT(*) FROM (SELECT actor, seq FROM stitched GROUP BY actor, seq`+having+`)`, args...,
+	).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("counting stitched sessions: %w", err)
+	}
+
+	query := stitched + `
+		SELECT arg_min(session_id, timestamp) AS session_id,
+			COALESCE(arg_max(distinct_id, timestamp), '') AS distinct_id,
+			COUNT(*) AS event_count,
+			MIN(timestamp) AS first_seen,
+			MAX(timestamp) AS last_seen,
+			left(COALESCE(arg_min(url, timestamp), ''), ?) AS entry_url,
+			left(COALESCE(arg_max(url, timestamp) FILTER (WHERE event_type = 'pageview'), ''), ?) AS exit_url,
+			left(COALESCE(arg_min(referrer, timestamp), ''), ?) AS referrer,
+			COUNT(*) FILTER (WHERE event_type = 'pageview') AS pageviews,
+			COUNT(*) FILTER (WHERE event_type IN (` + sessionInteractionTypes + `)) AS interactions,
+			COUNT(DISTINCT session_id) AS client_sessions
+		FROM stitched
+		GROUP BY actor, seq` + having + `
+		ORDER BY last_seen DESC, session_id
+		LIMIT ? OFFSET ?`
+	// The URL caps come after the CTE's placeholders and before HAVING's.
+	n := len(args) - len(havingArgs)
+	qargs := append(append(append([]any{}, args[:n]...), maxSessionURL, maxSessionURL, maxSessionURL), args[n:]...)
+	rows, err := d.read.QueryContext(ctx, query, append(qargs, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("querying stitched sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []SessionSummary
+	for rows.Next() {
+		var s SessionSummary
+		var pageviews, interactions int64
+		if err := rows.Scan(&s.SessionID, &s.DistinctID, &s.EventCount, &s.FirstSeen, &s.LastSeen, &s.EntryURL, &s.ExitURL, &s.Referrer,
+			&pageviews, &interactions, &s.ClientSessions); err != nil {
+			return nil, 0, fmt.Errorf("scanning stitched session row: %w", err)
+		}
+		s.finish(pageviews, interactions)
+		sessions = append(sessions, s)
+	}
+	return sessions, total, rows.Err()
+}
+
+// DeleteEvents removes the project's events matching f and returns how many
+// were deleted. Limit and Offset are ignored. f must be Narrowed, so an empty
+// filter can't wipe the whole project.
+func (d *DuckDB) DeleteEvents(ctx context.Context, f EventFilter) (int64, error) {
+	if !f.Narrowed() {
+		return 0, fmt.Errorf("deleting events: at least one filter besides the project is required")
+	}
+	where, args := d.eventFilterWhere(ctx, f)
+	return d.deleteEventsWhere(ctx, f.ProjectID, where, args)
+}
+
+// deleteEventsWhere deletes the project's events matching where (without the
+// keyword) together with their promoted property copies, in one transaction
+// so a failed delete can't leave events whose index rows are already gone.
+func (d *DuckDB) deleteEventsWhere(ctx context.Context, projectID, where string, args []any) (int64, error) {
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args, err = d.deletePromotedProperties(ctx, tx, projectID, where, args)
+	if err != nil {
+		return 0, err
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM events WHERE `+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("deleting events: %w", err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `DROP TABLE IF EXISTS deleting_events`); err != nil {
+		return 0, fmt.Errorf("dropping delete scratch table: %w", err)
+	}
+	return n, tx.Commit()
+}
+
 func (d *DuckDB) Close() error {
+	if d.read != d.db {
+		d.read.Close()
+	}
 	return d.db.Close()
 }
 
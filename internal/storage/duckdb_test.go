@@ -0,0 +1,607 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestDuckDB(t *testing.T) *DuckDB {
+	t.Helper()
+	db, err := NewDuckDB(filepath.Join(t.TempDir(), "events.duckdb"))
+	if err != nil {
+		t.Fatalf("NewDuckDB: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testEvent returns a minimal valid event for the given project.
+func testEvent(projectID, sessionID, eventType, urlPath string, ts time.Time) Event {
+	return Event{
+		ProjectID:   projectID,
+		SessionID:   sessionID,
+		EventType:   eventType,
+		Fingerprint: eventType + ":" + urlPath,
+		URL:         "https://example.com" + urlPath,
+		URLPath:     urlPath,
+		Timestamp:   ts,
+	}
+}
+
+func TestDuckDBReader_SeesCommittedWrites(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewDuckDBWithReader(filepath.Join(t.TempDir(), "events.duckdb"), 2)
+	if err != nil {
+		t.Fatalf("NewDuckDBWithReader: %v", err)
+	}
+	defer db.Close()
+	if db.read == db.db {
+		t.Fatal("expected a separate reader pool")
+	}
+
+	now := time.Now().UTC()
+	if err := db.InsertEvents(ctx, []Event{
+		testEvent("p1", "s1", "pageview", "/", now),
+		testEvent("p1", "s1", "click", "/", now),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	if err := db.Checkpoint(ctx); err != nil {
+		t.Fatalf("Checkpoint: %v", err)
+	}
+
+	got, err := db.QueryEvents(ctx, EventFilter{ProjectID: "p1"})
+	if err != nil {
+		t.Fatalf("QueryEvents: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("expected 2 events through reader, got %d", len(got))
+	}
+	n, err := db.CountEvents(ctx, "p1", "", "", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("CountEvents: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected count 2, got %d", n)
+	}
+}
+
+func TestDuckDBReader_RejectsWrites(t *testing.T) {
+	ctx := context.Background()
+	db, err := NewDuckDBWithReader(filepath.Join(t.TempDir(), "events.duckdb"), 1)
+	if err != nil {
+		t.Fatalf("NewDuckDBWithReader: %v", err)
+	}
+	defer db.Close()
+
+	for _, q := range []string{
+		`DELETE FROM events`,
+		`CREATE TABLE scratch (x INTEGER)`,
+		`SELECT 1; DELETE FROM events`,
+	} {
+		if _, err := db.read.ExecContext(ctx, q); err == nil {
+			t.Errorf("expected reader to reject %q", q)
+		}
+	}
+	if _, err := db.read.BeginTx(ctx, nil); err == nil {
+		t.Error("expected reader to refuse transactions")
+	}
+	var n int
+	if err := db.read.QueryRowContext(ctx, `SELECT count(*) FROM events WHERE project_id = ?`, "p1").Scan(&n); err != nil {
+		t.Fatalf("expected reads to work: %v", err)
+	}
+}
+
+func TestDuckDBReader_DefaultSharesWriter(t *testing.T) {
+	db := newTestDuckDB(t)
+	if db.read != db.db {
+		t.Fatal("expected reader to share the writer pool by default")
+	}
+}
+
+func TestQuery_CancelledContextAbortsDuckDB(t *testing.T) {
+	db := newTestDuckDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	// Scanning a trillion rows would take hours; only an interrupt returns early.
+	start := time.Now()
+	var n int64
+	err := db.read.QueryRowContext(ctx,
+		`SELECT count(*) FROM range(1000000000000) t WHERE t.range % 7 = 3`).Scan(&n)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("query ran %s after cancellation", elapsed)
+	}
+
+	// The connection is still usable afterwards.
+	if err := db.read.QueryRowContext(context.Background(), `SELECT 1`).Scan(&n); err != nil || n != 1 {
+		t.Fatalf("expected connection reusable after interrupt, got %d, %v", n, err)
+	}
+}
+
+func TestQueryTopEventNames_UniqueCounts(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+	named := func(sessionID, distinctID, name string) Event {
+		e := testEvent("p1", sessionID, "click", "/", now)
+		e.DistinctID = distinctID
+		e.EventName = &name
+		return e
+	}
+	// One user clicks Buy four times over two sessions; an anonymous visitor
+	// clicks it once.
+	if err := db.InsertEvents(ctx, []Event{
+		named("s1", "u1", "Click Buy"),
+		named("s1", "u1", "Click Buy"),
+		named("s1", "u1", "Click Buy"),
+		named("s2", "u1", "Click Buy"),
+		named("s3", "", "Click Buy"),
+		named("s1", "u1", "Signup"),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	stats, err := db.QueryTopEventNames(ctx, "p1", now.Add(-time.Hour), now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("QueryTopEventNames: %v", err)
+	}
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 names, got %+v", stats)
+	}
+	buy := stats[0]
+	if buy.Name != "Click Buy" || buy.Count != 5 || buy.UniqueSessions != 3 || buy.UniqueUsers != 1 {
+		t.Fatalf("expected Click Buy 5 events / 3 sessions / 1 user, got %+v", buy)
+	}
+	if signup := stats[1]; signup.Count != 1 || signup.UniqueSessions != 1 || signup.UniqueUsers != 1 {
+		t.Fatalf("expected Signup 1/1/1, got %+v", signup)
+	}
+}
+
+func TestQueryPerformance_P75LCP(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+	metric := func(path, name string, value float64) Event {
+		e := testEvent("p1", "s1", "performance", path, now)
+		e.Properties = map[string]any{"metric": name, "value": value}
+		return e
+	}
+	var events []Event
+	for _, v := range []float64{1000, 2000, 3000, 4000, 5000} {
+		events = append(events, metric("/", "LCP", v))
+	}
+	events = append(events,
+		metric("/", "CLS", 0.1),
+		metric("/pricing", "LCP", 1500),
+		testEvent("p1", "s1", "pageview", "/", now),
+	)
+	if err := db.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	stats, err := db.QueryPerformance(ctx, "p1", "LCP", "/", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("QueryPerformance: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("expected one page, got %+v", stats)
+	}
+	if s := stats[0]; s.Path != "/" || s.Samples != 5 || s.P50 != 3000 || s.P75 != 4000 {
+		t.Fatalf("expected / with 5 samples, p50 3000, p75 4000, got %+v", s)
+	}
+
+	all, err := db.QueryPerformance(ctx, "p1", "LCP", "", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("QueryPerformance: %v", err)
+	}
+	if len(all) != 2 || all[0].Path != "/" || all[1].Path != "/pricing" {
+		t.Fatalf("expected both pages busiest first, got %+v", all)
+	}
+}
+
+func TestQueryEvents_ReferrerAndUTM(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+	ev := func(session, referrer string, props map[string]any) Event {
+		e := testEvent("p1", session, "pageview", "/", now)
+		e.Referrer = referrer
+		e.Properties = props
+		return e
+	}
+	if err := db.InsertEvents(ctx, []Event{
+		ev("google", "https://www.Google.com/search?q=x", map[string]any{"utm_source": "newsletter"}),
+		ev("bing", "https://bing.com/", map[string]any{"utm_source": "ads"}),
+		ev("wild", "https://example.com/100%_off", nil),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	sessions := func(f EventFilter) []string {
+		t.Helper()
+		f.ProjectID = "p1"
+		events, err := db.QueryEvents(ctx, f)
+		if err != nil {
+			t.Fatalf("QueryEvents: %v", err)
+		}
+		var out []string
+		for _, e := range events {
+			out = append(out, e.SessionID)
+		}
+		return out
+	}
+	if got := sessions(EventFilter{Referrer: "google"}); len(got) != 1 || got[0] != "google" {
+		t.Fatalf("referrer contains google: got %v", got)
+	}
+	if got := sessions(EventFilter{Referrer: "%_"}); len(got) != 1 || got[0] != "wild" {
+		t.Fatalf("wildcards should match literally: got %v", got)
+	}
+	if got := sessions(EventFilter{UTMSource: "ads"}); len(got) != 1 || got[0] != "bing" {
+		t.Fatalf("utm_source=ads: got %v", got)
+	}
+}
+
+func TestQuerySessions_AggregatesAndOrders(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	at := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+	// Inserted out of order so the entry URL must come from the timestamps.
+	if err := db.InsertEvents(ctx, []Event{
+		testEvent("p1", "a", "pageview", "/pricing", at(5)),
+		testEvent("p1", "a", "pageview", "/", at(1)),
+		testEvent("p1", "a", "click", "/pricing", at(7)),
+		testEvent("p1", "b", "pageview", "/blog", at(10)),
+		testEvent("p1", "c", "pageview", "/docs", at(3)),
+		testEvent("p2", "other", "pageview", "/", at(20)),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	sessions, total, err := db.QuerySessions(ctx, "p1", SessionFilter{}, 2, 0)
+	if err != nil {
+		t.Fatalf("QuerySessions: %v", err)
+	}
+	if total != 3 {
+		t.Fatalf("expected 3 sessions in total, got %d", total)
+	}
+	if len(sessions) != 2 || sessions[0].SessionID != "b" || sessions[1].SessionID != "a" {
+		t.Fatalf("expected sessions b, a by last activity, got %+v", sessions)
+	}
+	a := sessions[1]
+	if a.EventCount != 3 || !a.FirstSeen.Equal(at(1)) || !a.LastSeen.Equal(at(7)) || a.EntryURL != "https://example.com/" {
+		t.Fatalf("session a aggregated wrongly: %+v", a)
+	}
+	if a.DurationSeconds != 6*60 || a.Bounced {
+		t.Fatalf("session a: expected 6 minutes and not bounced, got %+v", a)
+	}
+	if b := sessions[0]; b.DurationSeconds != 0 || !b.Bounced {
+		t.Fatalf("single-event session b: expected bounced with no duration, got %+v", b)
+	}
+
+	sessions, total, err = db.QuerySessions(ctx, "p1", SessionFilter{}, 2, 2)
+	if err != nil {
+		t.Fatalf("QuerySessions page 2: %v", err)
+	}
+	if total != 3 || len(sessions) != 1 || sessions[0].SessionID != "c" {
+		t.Fatalf("expected session c alone on page 2 of 3, got %+v (total %d)", sessions, total)
+	}
+}
+
+func TestQuerySessions_CountsPastTheOldEventCap(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	base := time.Now().UTC().Add(-time.Hour)
+	// The list used to group the first 10,000 raw events in memory, so
+	// sessions beyond them went missing from the total.
+	const n = 10_500
+	events := make([]Event, 0, n+1)
+	for i := range n {
+		events = append(events, testEvent("p1", "s"+strconv.Itoa(i), "pageview", "/", base.Add(time.Duration(i)*time.Millisecond)))
+	}
+	events = append(events, testEvent("p1", "s0", "click", "/", base.Add(time.Minute)))
+	if err := db.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	sessions, total, err := db.QuerySessions(ctx, "p1", SessionFilter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("QuerySessions: %v", err)
+	}
+	if total != n || len(sessions) != 10 {
+		t.Fatalf("expected %d sessions paged by 10, got %d (total %d)", n, len(sessions), total)
+	}
+	if s0 := sessions[0]; s0.SessionID != "s0" || s0.EventCount != 2 || s0.EntryURL != "https://example.com/" {
+		t.Fatalf("expected s0 first with both events aggregated, got %+v", s0)
+	}
+}
+
+func TestQuerySessionStats_AggregatesInSQL(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	at := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+	if err := db.InsertEvents(ctx, []Event{
+		// a: 3 events over 6 minutes, engaged.
+		testEvent("p1", "a", "pageview", "/", at(1)),
+		testEvent("p1", "a", "click", "/", at(4)),
+		testEvent("p1", "a", "pageview", "/pricing", at(7)),
+		// b: a single pageview, bounced.
+		testEvent("p1", "b", "pageview", "/blog", at(10)),
+		// c: outside the range.
+		testEvent("p1", "c", "pageview", "/docs", base.Add(-48*time.Hour)),
+		testEvent("p2", "other", "pageview", "/", at(20)),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	st, err := db.QuerySessionStats(ctx, "p1", base.Add(-time.Hour), time.Now())
+	if err != nil {
+		t.Fatalf("QuerySessionStats: %v", err)
+	}
+	if st.TotalSessions != 2 || st.AvgDurationSeconds != 180 || st.BounceRate != 0.5 || st.AvgEventsPerSession != 2 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	st, err = db.QuerySessionStats(ctx, "empty", base.Add(-time.Hour), time.Now())
+	if err != nil || st.TotalSessions != 0 || st.AvgDurationSeconds != 0 {
+		t.Fatalf("expected zero stats for an empty project, got %+v (%v)", st, err)
+	}
+}
+
+func TestQueryStitchedSessions_SplitsOnInactivity(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	base := time.Now().UTC().Add(-6 * time.Hour).Truncate(time.Second)
+	at := func(m int) time.Time { return base.Add(time.Duration(m) * time.Minute) }
+	ev := func(session, distinctID, path string, m int) Event {
+		e := testEvent("p1", session, "pageview", path, at(m))
+		e.DistinctID = distinctID
+		return e
+	}
+	if err := db.InsertEvents(ctx, []Event{
+		// One visit spread over three page loads, each a new client session.
+		ev("load-1", "u1", "/", 0),
+		ev("load-2", "u1", "/pricing", 10),
+		ev("load-3", "u1", "/signup", 35),
+		// Back after an hour: a second visit.
+		ev("load-4", "u1", "/", 100),
+		// Anonymous events stay within their client session.
+		ev("anon", "", "/blog", 5),
+		ev("anon", "", "/blog/2", 50),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	sessions, total, err := db.QueryStitchedSessions(ctx, "p1", SessionFilter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("QueryStitchedSessions: %v", err)
+	}
+	if total != 4 || len(sessions) != 4 {
+		t.Fatalf("expected 4 stitched sessions, got %d (total %d): %+v", len(sessions), total, sessions)
+	}
+	byStart := map[string]SessionSummary{}
+	for _, s := range sessions {
+		byStart[s.SessionID+"@"+s.FirstSeen.Sub(base).String()] = s
+	}
+	visit, ok := byStart["load-1@0s"]
+	if !ok || visit.EventCount != 3 || visit.ClientSessions != 3 || visit.DurationSeconds != 35*60 ||
+		visit.EntryURL != "https://example.com/" || visit.ExitURL != "https://example.com/signup" {
+		t.Fatalf("expected the first visit stitched across three page loads, got %+v", visit)
+	}
+	if s, ok := byStart["load-4@1h40m0s"]; !ok || s.EventCount != 1 {
+		t.Fatalf("expected the return visit as its own session, got %+v", byStart)
+	}
+	if _, ok := byStart["anon@5m0s"]; !ok {
+		t.Fatalf("expected the anonymous session split at its 45 minute gap, got %+v", byStart)
+	}
+
+	// Session thresholds apply to the stitched sessions.
+	if _, total, _ := db.QueryStitchedSessions(ctx, "p1", SessionFilter{MinEvents: 2}, 10, 0); total != 1 {
+		t.Fatalf("expected only the first visit to have 2+ events, got %d", total)
+	}
+}
+
+func TestQuerySessions_EntryExitURLs(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	landing := testEvent("p1", "s", "pageview", "/", base)
+	landing.Referrer = "https://news.ycombinator.com/"
+	if err := db.InsertEvents(ctx, []Event{
+		testEvent("p1", "s", "pageview", "/pricing", base.Add(2*time.Minute)),
+		landing,
+		testEvent("p1", "s", "pageview", "/signup", base.Add(5*time.Minute)),
+		// A later click doesn't make its page the exit page.
+		testEvent("p1", "s", "click", "/signup/done", base.Add(6*time.Minute)),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	sessions, _, err := db.QuerySessions(ctx, "p1", SessionFilter{}, 10, 0)
+	if err != nil {
+		t.Fatalf("QuerySessions: %v", err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(sessions))
+	}
+	s := sessions[0]
+	if s.EntryURL != "https://example.com/" || s.ExitURL != "https://example.com/signup" || s.Referrer != "https://news.ycombinator.com/" {
+		t.Fatalf("unexpected entry/exit: entry %q exit %q referrer %q", s.EntryURL, s.ExitURL, s.Referrer)
+	}
+}
+
+func TestQuerySessions_MinEventsAndDuration(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	if err := db.InsertEvents(ctx, []Event{
+		testEvent("p1", "bounce", "pageview", "/", base),
+		testEvent("p1", "quick", "pageview", "/", base),
+		testEvent("p1", "quick", "click", "/", base.Add(10*time.Second)),
+		testEvent("p1", "engaged", "pageview", "/", base),
+		testEvent("p1", "engaged", "pageview", "/pricing", base.Add(3*time.Minute)),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	ids := func(f SessionFilter) ([]string, int64) {
+		t.Helper()
+		sessions, total, err := db.QuerySessions(ctx, "p1", f, 10, 0)
+		if err != nil {
+			t.Fatalf("QuerySessions: %v", err)
+		}
+		var out []string
+		for _, s := range sessions {
+			out = append(out, s.SessionID)
+		}
+		slices.Sort(out)
+		return out, total
+	}
+	if got, total := ids(SessionFilter{MinEvents: 2}); !slices.Equal(got, []string{"engaged", "quick"}) || total != 2 {
+		t.Fatalf("min 2 events: got %v (total %d)", got, total)
+	}
+	if got, total := ids(SessionFilter{MinDuration: time.Minute}); !slices.Equal(got, []string{"engaged"}) || total != 1 {
+		t.Fatalf("min 1m duration: got %v (total %d)", got, total)
+	}
+}
+
+func TestQueryPropertyKeys_ScopedToRange(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+	old := testEvent("p1", "s", "custom", "/", now.Add(-90*24*time.Hour))
+	old.Properties = map[string]any{"legacy": "yes", "plan": "old"}
+	recent := testEvent("p1", "s", "custom", "/", now)
+	recent.Properties = map[string]any{"plan": "pro"}
+	if err := db.InsertEvents(ctx, []Event{old, recent}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	start, end := now.Add(-30*24*time.Hour), now.Add(time.Hour)
+	keys, err := db.QueryPropertyKeys(ctx, "p1", start, end)
+	if err != nil {
+		t.Fatalf("QueryPropertyKeys: %v", err)
+	}
+	if !slices.Equal(keys, []string{"plan"}) {
+		t.Fatalf("expected only the recent key, got %v", keys)
+	}
+	values, err := db.QueryPropertyValues(ctx, "p1", "plan", start, end, 10)
+	if err != nil {
+		t.Fatalf("QueryPropertyValues: %v", err)
+	}
+	if !slices.Equal(values, []string{`"pro"`}) {
+		t.Fatalf("expected only the recent value, got %v", values)
+	}
+
+	all, _ := db.QueryPropertyKeys(ctx, "p1", now.Add(-100*24*time.Hour), end)
+	if !slices.Equal(all, []string{"legacy", "plan"}) {
+		t.Fatalf("expected both keys over the full range, got %v", all)
+	}
+}
+
+func TestSampleScaling_EstimatesTrueCount(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+
+	// 4000 single-event sessions sampled at 10% by session hash, as ingest does.
+	const total, rate = 4000, 0.1
+	var kept []Event
+	for i := range total {
+		sid := "s" + strconv.Itoa(i)
+		h := fnv.New32a()
+		h.Write([]byte(sid))
+		if h.Sum32()%10 != 0 {
+			continue
+		}
+		e := testEvent("p1", sid, "pageview", "/", now)
+		e.Properties = map[string]any{SampleRateProperty: rate}
+		kept = append(kept, e)
+	}
+	unsampled := testEvent("p1", "err", "error", "/", now)
+	if err := db.InsertEvents(ctx, append(kept, unsampled)); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	raw, err := db.CountEvents(ctx, "p1", "", "", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("CountEvents: %v", err)
+	}
+	if raw != int64(len(kept))+1 {
+		t.Fatalf("expected raw count %d, got %d", len(kept)+1, raw)
+	}
+	scaled, err := db.CountEvents(WithSampleScaling(ctx), "p1", "", "", now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("CountEvents scaled: %v", err)
+	}
+	if scaled != int64(len(kept))*10+1 {
+		t.Fatalf("expected each sampled event to weigh 10, got %d for %d kept", scaled, len(kept))
+	}
+	if diff := math.Abs(float64(scaled-total-1)) / total; diff > 0.1 {
+		t.Fatalf("scaled estimate %d is more than 10%% off the true %d", scaled, total+1)
+	}
+
+	points, err := db.QueryTrends(WithSampleScaling(ctx), "p1", "day", "pageview", "", now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("QueryTrends: %v", err)
+	}
+	var sum int64
+	for _, p := range points {
+		sum += p.Count
+	}
+	if sum != int64(len(kept))*10 {
+		t.Fatalf("expected scaled trend total %d, got %d", len(kept)*10, sum)
+	}
+}
+
+func TestQueryCountByProperty_GroupsValues(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+	ev := func(props map[string]any) Event {
+		e := testEvent("p1", "s", "custom", "/", now)
+		e.Properties = props
+		return e
+	}
+	if err := db.InsertEvents(ctx, []Event{
+		ev(map[string]any{"plan": "pro"}),
+		ev(map[string]any{"plan": "pro"}),
+		ev(map[string]any{"plan": "free"}),
+		ev(map[string]any{"plan": nil}),
+		ev(nil),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	counts, err := db.QueryCountByProperty(ctx, "p1", "plan", now.Add(-time.Hour), now.Add(time.Hour), 10)
+	if err != nil {
+		t.Fatalf("QueryCountByProperty: %v", err)
+	}
+	got := map[string]int64{}
+	for _, c := range counts {
+		v := "<missing>"
+		if c.Value != nil {
+			v = *c.Value
+		}
+		got[v] = c.Count
+	}
+	want := map[string]int64{"pro": 2, "free": 1, "<missing>": 2}
+	if len(got) != len(want) || got["pro"] != 2 || got["free"] != 1 || got["<missing>"] != 2 {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if counts[0].Value == nil || *counts[0].Value != "pro" {
+		t.Fatalf("expected the largest bucket first, got %+v", counts)
+	}
+}
@@ -3,13 +3,16 @@ package storage
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 )
 
@@ -23,6 +26,7 @@ const (
 // A nil *Encryptor is safe to use — all methods become no-op passthroughs.
 type Encryptor struct {
 	aead cipher.AEAD
+	mac  []byte // HMAC key derived from the encryption key, used by Sign
 }
 
 // NewEncryptor creates an Encryptor using a key from the CLICKNEST_ENCRYPTION_KEY
@@ -44,7 +48,30 @@ func NewEncryptor(dataDir string) (*Encryptor, error) {
 		return nil, fmt.Errorf("creating GCM: %w", err)
 	}
 
-	return &Encryptor{aead: aead}, nil
+	// Derive a separate signing key so signatures never reuse the AES key directly.
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte("clicknest-signing-v1"))
+
+	return &Encryptor{aead: aead, mac: h.Sum(nil)}, nil
+}
+
+// Sign returns an HMAC-SHA256 signature of msg. A nil Encryptor returns nil,
+// so nothing signed without a key ever verifies.
+func (e *Encryptor) Sign(msg []byte) []byte {
+	if e == nil {
+		return nil
+	}
+	h := hmac.New(sha256.New, e.mac)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// Verify reports whether sig is a valid signature of msg.
+func (e *Encryptor) Verify(msg, sig []byte) bool {
+	if e == nil || len(sig) == 0 {
+		return false
+	}
+	return hmac.Equal(e.Sign(msg), sig)
 }
 
 // Encrypt encrypts plaintext and returns a string with the "enc:v1:" prefix.
@@ -162,3 +189,46 @@ func loadKey(dataDir string) ([]byte, error) {
 
 	return key, nil
 }
+
+// PermissionProblem describes a data directory entry that is readable by
+// users other than the owner.
+type PermissionProblem struct {
+	Path string
+	Mode os.FileMode
+	Want os.FileMode
+	// Critical is set for the encryption key file, which ClickNest always
+	// writes 0600 — a looser mode means it was changed out from under us.
+	Critical bool
+}
+
+func (p PermissionProblem) String() string {
+	return fmt.Sprintf("%s has mode %#o, want %#o or stricter", p.Path, p.Mode, p.Want)
+}
+
+// CheckPermissions reports entries in dataDir that grant any access to group
+// or other users. The directory is created 0700 and the key file and
+// databases 0600, but only the group and other bits are checked, so an
+// owner-only mode such as 0700 on a file is accepted. Missing files are
+// ignored. Always returns nil on Windows, where Unix mode bits are not
+// meaningful.
+func CheckPermissions(dataDir string) []PermissionProblem {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	var problems []PermissionProblem
+	check := func(path string, want os.FileMode, critical bool) {
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		if mode := info.Mode().Perm(); mode&0o077 != 0 {
+			problems = append(problems, PermissionProblem{Path: path, Mode: mode, Want: want, Critical: critical})
+		}
+	}
+	check(dataDir, 0700, false)
+	check(filepath.Join(dataDir, keyFileName), 0600, true)
+	for _, name := range []string{"clicknest.db", "events.duckdb"} {
+		check(filepath.Join(dataDir, name), 0600, false)
+	}
+	return problems
+}
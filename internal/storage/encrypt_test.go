@@ -227,3 +227,65 @@ func TestPtrRoundTrip(t *testing.T) {
 		t.Fatalf("ptr round-trip: got %q, want %q", *decrypted, original)
 	}
 }
+
+func TestCheckPermissions_Secure(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEncryptor(dir); err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	if problems := CheckPermissions(dir); len(problems) != 0 {
+		t.Fatalf("expected no problems, got %v", problems)
+	}
+}
+
+func TestCheckPermissions_OpenKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEncryptor(dir); err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	keyPath := filepath.Join(dir, keyFileName)
+	if err := os.Chmod(keyPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	problems := CheckPermissions(dir)
+	if len(problems) != 1 {
+		t.Fatalf("expected 1 problem, got %v", problems)
+	}
+	if problems[0].Path != keyPath || !problems[0].Critical {
+		t.Fatalf("expected critical problem for key file, got %+v", problems[0])
+	}
+}
+
+func TestCheckPermissions_OpenDataDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	problems := CheckPermissions(dir)
+	if len(problems) != 1 || problems[0].Critical {
+		t.Fatalf("expected one non-critical problem for data dir, got %v", problems)
+	}
+}
+
+func TestCheckPermissions_OwnerExecAllowed(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewEncryptor(dir); err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	if err := os.Chmod(filepath.Join(dir, keyFileName), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if problems := CheckPermissions(dir); len(problems) != 0 {
+		t.Fatalf("expected owner-only modes to pass, got %v", problems)
+	}
+}
@@ -101,7 +101,7 @@ ORDER BY ve.variant
 	allArgs := []any{projectID, flagKey, start, end, valueProp}
 	allArgs = append(allArgs, convArgs...)
 
-	rows, err := d.db.QueryContext(ctx, query, allArgs...)
+	rows, err := d.read.QueryContext(ctx, query, allArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("querying experiment results: %w", err)
 	}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// FingerprintStrategySetting is the growth setting key holding the project's
+// FingerprintStrategy as JSON. Unset is the zero strategy.
+const FingerprintStrategySetting = "fingerprint_strategy"
+
+// FingerprintStrategy selects which DOM context goes into an element's
+// fingerprint. The zero value hashes everything.
+type FingerprintStrategy struct {
+	// ExcludeURLPath fingerprints an element the same on every page, so a
+	// shared nav button is one event rather than one per URL.
+	ExcludeURLPath bool `json:"exclude_url_path"`
+	// StripHashedClasses drops build-generated class names (CSS modules,
+	// styled-components, emotion) that change between deploys.
+	StripHashedClasses bool `json:"strip_hashed_classes"`
+}
+
+// FingerprintStrategy returns the project's fingerprint strategy.
+func (s *SQLite) FingerprintStrategy(ctx context.Context, projectID string) FingerprintStrategy {
+	var st FingerprintStrategy
+	if v, _ := s.GetGrowthSetting(ctx, projectID, FingerprintStrategySetting); v != "" {
+		json.Unmarshal([]byte(v), &st)
+	}
+	return st
+}
+
+// SetFingerprintStrategy stores the project's fingerprint strategy. Existing
+// events keep their fingerprints until recomputed.
+func (s *SQLite) SetFingerprintStrategy(ctx context.Context, projectID string, st FingerprintStrategy) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return s.SetGrowthSetting(ctx, projectID, FingerprintStrategySetting, string(b))
+}
+
+// FingerprintChange is one fingerprint a recompute moved events off, and the
+// fingerprint they now carry.
+type FingerprintChange struct {
+	Old    string
+	New    string
+	Events int64
+}
+
+// RecomputeFingerprints rewrites the fingerprints of the project's events
+// with compute, which gets an event's element tag, ID, classes, parent path
+// and URL path. Events are grouped by that DOM context, so each distinct
+// element is hashed once, and updated batch groups per transaction; progress,
+// if set, is called after every batch with the groups done and the total.
+func (d *DuckDB) RecomputeFingerprints(ctx context.Context, projectID string, compute func(tag, id, classes, parentPath, urlPath string) string, batch int, progress func(done, total int)) ([]FingerprintChange, error) {
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT fingerprint, COALESCE(element_tag, ''), COALESCE(element_id, ''), COALESCE(element_classes, ''),
+			COALESCE(parent_path, ''), url_path, COUNT(*)
+		 FROM events WHERE project_id = ?
+		 GROUP BY ALL`,
+		projectID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("listing fingerprint groups: %w", err)
+	}
+	type group struct {
+		fp, tag, id, classes, parentPath, urlPath string
+		events                                    int64
+	}
+	var groups []group
+	for rows.Next() {
+		var g group
+		if err := rows.Scan(&g.fp, &g.tag, &g.id, &g.classes, &g.parentPath, &g.urlPath, &g.events); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scanning fingerprint group: %w", err)
+		}
+		groups = append(groups, g)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	batch = max(batch, 1)
+	moved := make(map[[2]string]int64)
+	var order [][2]string
+	for start := 0; start < len(groups); start += batch {
+		tx, err := d.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range groups[start:min(start+batch, len(groups))] {
+			fp := compute(g.tag, g.id, g.classes, g.parentPath, g.urlPath)
+			if fp == g.fp {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx,
+				`UPDATE events SET fingerprint = ?
+				 WHERE project_id = ? AND fingerprint = ? AND COALESCE(element_tag, '') = ? AND COALESCE(element_id, '') = ?
+					AND COALESCE(element_classes, '') = ? AND COALESCE(parent_path, '') = ? AND url_path = ?`,
+				fp, projectID, g.fp, g.tag, g.id, g.classes, g.parentPath, g.urlPath,
+			); err != nil {
+				tx.Rollback()
+				return nil, fmt.Errorf("updating fingerprint %s: %w", g.fp, err)
+			}
+			key := [2]string{g.fp, fp}
+			if _, ok := moved[key]; !ok {
+				order = append(order, key)
+			}
+			moved[key] += g.events
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+		if progress != nil {
+			progress(min(start+batch, len(groups)), len(groups))
+		}
+	}
+
+	changes := make([]FingerprintChange, 0, len(order))
+	for _, key := range order {
+		changes = append(changes, FingerprintChange{Old: key[0], New: key[1], Events: moved[key]})
+	}
+	return changes, nil
+}
+
+// SetFingerprintEventName overwrites the stored event name of every event
+// with the fingerprint, for names re-linked after a recompute.
+func (d *DuckDB) SetFingerprintEventName(ctx context.Context, projectID, fingerprint, name string) error {
+	_, err := d.db.ExecContext(ctx,
+		`UPDATE events SET event_name = ? WHERE project_id = ? AND fingerprint = ?`,
+		name, projectID, fingerprint,
+	)
+	return err
+}
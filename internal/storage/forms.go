@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FormFieldStat is how a form field on one page was used: how many sessions
+// touched it, how often, where it came in their fill order, and how many
+// sessions left the form after it without submitting.
+type FormFieldStat struct {
+	Field        string  `json:"field"` // name, else element ID, else label, else fingerprint
+	ElementID    string  `json:"element_id,omitempty"`
+	Name         string  `json:"name,omitempty"`
+	Label        string  `json:"label,omitempty"`
+	Interactions int64   `json:"interactions"`
+	Sessions     int64   `json:"sessions"`
+	AvgOrder     float64 `json:"avg_order"` // mean 1-based position of the field's first touch in a session
+	DropOffs     int64   `json:"drop_offs"` // sessions whose last touched field this was, with no submit after
+	DropOffRate  float64 `json:"drop_off_rate"`
+}
+
+// formFieldExpr identifies the field an input event belongs to.
+const formFieldExpr = `COALESCE(
+	NULLIF(json_extract_string(properties, '$.field_name'), ''),
+	NULLIF(element_id, ''),
+	NULLIF(json_extract_string(properties, '$.field_label'), ''),
+	NULLIF(aria_label, ''),
+	fingerprint)`
+
+// QueryFormFieldEngagement ranks the form fields on urlPath by the input
+// events recorded against them between start and end: most sessions first,
+// then most interactions, then earliest in the fill order. A session drops
+// off at the last field it touched unless it submits a form on the page at
+// or after that touch.
+func (d *DuckDB) QueryFormFieldEngagement(ctx context.Context, projectID, urlPath string, start, end time.Time) ([]FormFieldStat, error) {
+	rows, err := d.read.QueryContext(ctx, `
+		WITH inputs AS (
+			SELECT session_id, timestamp, element_id, aria_label,
+				json_extract_string(properties, '$.field_name') AS name,
+				json_extract_string(properties, '$.field_label') AS label,
+				`+formFieldExpr+` AS field
+			FROM events
+			WHERE project_id = ? AND event_type = 'input' AND url_path = ?
+				AND timestamp BETWEEN ? AND ?`+internalFilter(ctx)+`
+		),
+		firsts AS (
+			SELECT session_id, field,
+				row_number() OVER (PARTITION BY session_id ORDER BY MIN(timestamp), field) AS pos
+			FROM inputs
+			GROUP BY session_id, field
+		),
+		lasts AS (
+			SELECT session_id, arg_max(field, timestamp) AS field, MAX(timestamp) AS last_at
+			FROM inputs
+			GROUP BY session_id
+		),
+		submits AS (
+			SELECT session_id, MAX(timestamp) AS submitted_at
+			FROM events
+			WHERE project_id = ? AND event_type = 'submit' AND url_path = ?
+				AND timestamp BETWEEN ? AND ?
+			GROUP BY session_id
+		),
+		drops AS (
+			SELECT l.field, COUNT(*) AS n
+			FROM lasts l
+			LEFT JOIN submits s ON s.session_id = l.session_id AND s.submitted_at >= l.last_at
+			WHERE s.session_id IS NULL
+			GROUP BY l.field
+		),
+		fields AS (
+			SELECT field,
+				COALESCE(MAX(NULLIF(element_id, '')), '') AS element_id,
+				COALESCE(MAX(NULLIF(name, '')), '') AS name,
+				COALESCE(MAX(NULLIF(label, '')), MAX(NULLIF(aria_label, '')), '') AS label,
+				COUNT(*) AS interactions,
+				COUNT(DISTINCT session_id) AS sessions
+			FROM inputs
+			GROUP BY field
+		)
+		SELECT f.field, f.element_id, f.name, f.label, f.interactions, f.sessions,
+			(SELECT AVG(pos) FROM firsts WHERE firsts.field = f.field) AS avg_order,
+			COALESCE(d.n, 0) AS drop_offs
+		FROM fields f
+		LEFT JOIN drops d ON d.field = f.field
+		ORDER BY f.sessions DESC, f.interactions DESC, avg_order, f.field
+	`, projectID, urlPath, start, end, projectID, urlPath, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("querying form fields: %w", err)
+	}
+	defer rows.Close()
+
+	stats := []FormFieldStat{}
+	for rows.Next() {
+		var s FormFieldStat
+		if err := rows.Scan(&s.Field, &s.ElementID, &s.Name, &s.Label, &s.Interactions, &s.Sessions, &s.AvgOrder, &s.DropOffs); err != nil {
+			return nil, fmt.Errorf("scanning form field: %w", err)
+		}
+		if s.Sessions > 0 {
+			s.DropOffRate = float64(s.DropOffs) / float64(s.Sessions)
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
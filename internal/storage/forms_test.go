@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestQueryFormFieldEngagement_RanksFields(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC().Add(-time.Hour)
+	at := func(sec int) time.Time { return now.Add(time.Duration(sec) * time.Second) }
+	email := func(session string, sec int) Event {
+		e := testEvent("p1", session, "input", "/signup", at(sec))
+		e.Properties = map[string]any{"field_name": "email"}
+		return e
+	}
+	name := func(session string, sec int) Event {
+		e := testEvent("p1", session, "input", "/signup", at(sec))
+		e.ElementID = "full-name"
+		return e
+	}
+	password := func(session string, sec int) Event {
+		e := testEvent("p1", session, "input", "/signup", at(sec))
+		e.AriaLabel = "Password"
+		return e
+	}
+	// s1 fills every field and submits; s2 edits name twice and leaves; s3
+	// starts with name, stops at email.
+	if err := db.InsertEvents(ctx, []Event{
+		email("s1", 0), name("s1", 1), password("s1", 2),
+		testEvent("p1", "s1", "submit", "/signup", at(3)),
+		email("s2", 0), name("s2", 1), name("s2", 2),
+		name("s3", 0), email("s3", 1),
+		email("s4", 0),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	// Input elsewhere and other event types on the page don't count.
+	other := email("s4", 0)
+	other.URLPath = "/login"
+	if err := db.InsertEvents(ctx, []Event{other, testEvent("p1", "s2", "click", "/signup", at(1))}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	stats, err := db.QueryFormFieldEngagement(ctx, "p1", "/signup", now.Add(-time.Minute), now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("QueryFormFieldEngagement: %v", err)
+	}
+	if len(stats) != 3 {
+		t.Fatalf("expected 3 fields, got %+v", stats)
+	}
+	want := []struct {
+		field                  string
+		sessions, interactions int64
+		avgOrder               float64
+		dropOffs               int64
+	}{
+		{"email", 4, 4, 1.25, 2},
+		{"full-name", 3, 4, 5.0 / 3, 1},
+		{"Password", 1, 1, 3, 0},
+	}
+	for i, w := range want {
+		s := stats[i]
+		if s.Field != w.field || s.Sessions != w.sessions || s.Interactions != w.interactions ||
+			math.Abs(s.AvgOrder-w.avgOrder) > 1e-9 || s.DropOffs != w.dropOffs {
+			t.Errorf("rank %d = %+v, want %+v", i, s, w)
+		}
+	}
+	if stats[0].Name != "email" || stats[1].ElementID != "full-name" || stats[2].Label != "Password" {
+		t.Errorf("field identity not kept: %+v", stats)
+	}
+	if stats[0].DropOffRate != 0.5 {
+		t.Errorf("email drop-off rate = %v, want 0.5", stats[0].DropOffRate)
+	}
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueryFunnelTrend_PerPeriodConversion(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	day1 := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	day2 := day1.AddDate(0, 0, 1)
+
+	var events []Event
+	visit := func(session string, at time.Time, converts bool) {
+		events = append(events, testEvent("p1", session, "pageview", "/pricing", at))
+		if converts {
+			events = append(events, testEvent("p1", session, "pageview", "/signup", at.Add(time.Minute)))
+		}
+	}
+	// Day 1: 1 of 4 sessions converts. Day 2: 2 of 2. Day 3: no traffic.
+	visit("a", day1, true)
+	visit("b", day1, false)
+	visit("c", day1, false)
+	visit("d", day1, false)
+	visit("e", day2, true)
+	visit("f", day2, true)
+	if err := db.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+
+	steps := []FunnelStep{
+		{EventType: "pageview", URLPath: "/pricing"},
+		{EventType: "pageview", URLPath: "/signup"},
+	}
+	start := time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2026, 3, 4, 23, 0, 0, 0, time.UTC)
+	trend, err := db.QueryFunnelTrend(ctx, "p1", steps, "day", start, end)
+	if err != nil {
+		t.Fatalf("QueryFunnelTrend: %v", err)
+	}
+
+	want := []FunnelTrendPoint{
+		{Period: "2026-03-02", Entered: 4, Completed: 1, Conversion: 0.25},
+		{Period: "2026-03-03", Entered: 2, Completed: 2, Conversion: 1},
+		{Period: "2026-03-04"},
+	}
+	if len(trend) != len(want) {
+		t.Fatalf("expected %d periods, got %+v", len(want), trend)
+	}
+	for i := range want {
+		if trend[i] != want[i] {
+			t.Errorf("period %d: got %+v, want %+v", i, trend[i], want[i])
+		}
+	}
+}
@@ -70,7 +70,7 @@ func (d *DuckDB) QueryICPProfiles(ctx context.Context, projectID string, convers
 
 	args = append(args, projectID, limit)
 
-	rows, err := d.db.QueryContext(ctx, query, args...)
+	rows, err := d.read.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("querying ICP profiles: %w", err)
 	}
@@ -99,7 +99,7 @@ func (d *DuckDB) QueryICPProfiles(ctx context.Context, projectID string, convers
 }
 
 func (d *DuckDB) queryUserTopPages(ctx context.Context, projectID, distinctID string, limit int) ([]string, error) {
-	rows, err := d.db.QueryContext(ctx, `
+	rows, err := d.read.QueryContext(ctx, `
 		SELECT url_path, COUNT(*) AS cnt
 		FROM events
 		WHERE project_id = ? AND distinct_id = ? AND event_type = 'pageview'
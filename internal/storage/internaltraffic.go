@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// InternalTrafficSetting is the growth setting key holding a project's
+// internal traffic rule as JSON.
+const InternalTrafficSetting = "internal_traffic"
+
+// InternalProperty is the event property ingest sets to true on events from
+// internal traffic. InternalParam is the page query parameter (?ch_internal=1)
+// that opts a browser into being tagged.
+const (
+	InternalProperty = "$internal"
+	InternalParam    = "ch_internal"
+)
+
+// maxInternalEntries caps each list in the rule; every query carries the
+// distinct ID list.
+const maxInternalEntries = 200
+
+// InternalTrafficRule identifies a team's own activity. Events from matching
+// IP ranges are tagged $internal=true at ingest; the address itself is never
+// stored. Listed distinct IDs are matched at query time. Excluding is a query
+// time switch, so turning it off restores the full numbers.
+type InternalTrafficRule struct {
+	Exclude     bool     `json:"exclude"`
+	IPRanges    []string `json:"ip_ranges"`
+	DistinctIDs []string `json:"distinct_ids"`
+
+	prefixes []netip.Prefix
+}
+
+// Validate checks the rule's lists. IP ranges are CIDR prefixes or single
+// addresses.
+func (r *InternalTrafficRule) Validate() error {
+	if len(r.IPRanges) > maxInternalEntries || len(r.DistinctIDs) > maxInternalEntries {
+		return fmt.Errorf("at most %d IP ranges and %d distinct IDs allowed", maxInternalEntries, maxInternalEntries)
+	}
+	r.prefixes = r.prefixes[:0]
+	for _, s := range r.IPRanges {
+		p, err := parseIPRange(s)
+		if err != nil {
+			return fmt.Errorf("invalid IP range %q", s)
+		}
+		r.prefixes = append(r.prefixes, p)
+	}
+	for _, id := range r.DistinctIDs {
+		if id == "" {
+			return fmt.Errorf("distinct ID must not be empty")
+		}
+	}
+	return nil
+}
+
+func parseIPRange(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		return p.Masked(), err
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// MatchIP reports whether ip falls in one of the rule's ranges.
+func (r *InternalTrafficRule) MatchIP(ip string) bool {
+	if r == nil || len(r.prefixes) == 0 {
+		return false
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range r.prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// InternalTraffic returns the project's internal traffic rule. An unset or
+// unreadable setting is the zero rule, which matches and excludes nothing.
+func (s *SQLite) InternalTraffic(ctx context.Context, projectID string) *InternalTrafficRule {
+	r := &InternalTrafficRule{IPRanges: []string{}, DistinctIDs: []string{}}
+	v, _ := s.GetGrowthSetting(ctx, projectID, InternalTrafficSetting)
+	if v == "" {
+		return r
+	}
+	if json.Unmarshal([]byte(v), r) != nil || r.Validate() != nil {
+		return &InternalTrafficRule{IPRanges: []string{}, DistinctIDs: []string{}}
+	}
+	return r
+}
+
+// SetInternalTraffic validates and stores the project's internal traffic rule.
+func (s *SQLite) SetInternalTraffic(ctx context.Context, projectID string, r InternalTrafficRule) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.SetGrowthSetting(ctx, projectID, InternalTrafficSetting, string(b))
+}
+
+type internalExclusionKey struct{}
+
+// WithInternalExclusion returns a context under which DuckDB analytics
+// queries leave out internal traffic as described by r. A nil rule or one
+// with Exclude unset leaves ctx unchanged.
+func WithInternalExclusion(ctx context.Context, r *InternalTrafficRule) context.Context {
+	if r == nil || !r.Exclude {
+		return ctx
+	}
+	return context.WithValue(ctx, internalExclusionKey{}, r)
+}
+
+// internalFilter returns the WHERE fragment excluding internal traffic for
+// ctx, or "" when exclusion is off. It inlines its values so it can be
+// appended to any query without disturbing placeholder order.
+func internalFilter(ctx context.Context) string {
+	r, _ := ctx.Value(internalExclusionKey{}).(*InternalTrafficRule)
+	if r == nil {
+		return ""
+	}
+	f := " AND COALESCE(json_extract_string(properties, '" + propertyPath(InternalProperty) + "'), '') <> 'true'"
+	if len(r.DistinctIDs) > 0 {
+		quoted := make([]string, len(r.DistinctIDs))
+		for i, id := range r.DistinctIDs {
+			quoted[i] = "'" + sqlEsc(id) + "'"
+		}
+		f += " AND COALESCE(distinct_id, '') NOT IN (" + strings.Join(quoted, ", ") + ")"
+	}
+	return f
+}
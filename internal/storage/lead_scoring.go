@@ -44,6 +44,26 @@ type LeadScoringConfig struct {
 	DecayHalfLifeDays int `json:"decay_half_life_days"` // 0 = no decay
 }
 
+// MaxSegmentMembers caps how many users a segment expands to.
+const MaxSegmentMembers = 10000
+
+// SegmentMembers expands a saved segment's conditions into its members: the
+// users active between start and end who match at least one condition, up to
+// MaxSegmentMembers.
+func (d *DuckDB) SegmentMembers(ctx context.Context, projectID string, conditions []ScoringRule, start, end time.Time) ([]ScoredLead, error) {
+	leads, _, err := d.QueryLeadScores(ctx, projectID, conditions, start, end, MaxSegmentMembers, 0)
+	if err != nil {
+		return nil, err
+	}
+	var members []ScoredLead
+	for _, l := range leads {
+		if l.Score > 0 {
+			members = append(members, l)
+		}
+	}
+	return members, nil
+}
+
 // QueryLeadScores evaluates scoring rules against event data and returns scored leads.
 func (d *DuckDB) QueryLeadScores(ctx context.Context, projectID string, rules []ScoringRule, start, end time.Time, limit, offset int) ([]ScoredLead, int, error) {
 	if limit <= 0 {
@@ -64,7 +84,7 @@ func (d *DuckDB) QueryLeadScores(ctx context.Context, projectID string, rules []
 
 	// Count total users.
 	var total int
-	err := d.db.QueryRowContext(ctx, fmt.Sprintf(
+	err := d.read.QueryRowContext(ctx, fmt.Sprintf(
 		"SELECT COUNT(DISTINCT distinct_id) FROM events WHERE %s", where,
 	), args...).Scan(&total)
 	if err != nil {
@@ -181,7 +201,7 @@ func (d *DuckDB) QueryLeadScores(ctx context.Context, projectID string, rules []
 	allArgs = append(allArgs, args...)
 	allArgs = append(allArgs, limit, offset)
 
-	rows, err := d.db.QueryContext(ctx, query, allArgs...)
+	rows, err := d.read.QueryContext(ctx, query, allArgs...)
 	if err != nil {
 		return nil, 0, fmt.Errorf("querying lead scores: %w", err)
 	}
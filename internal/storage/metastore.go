@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// MetaStore is the metadata store: projects, users, saved analyses, flags,
+// alerts and growth settings. The HTTP server and query handlers depend on it
+// rather than on a concrete database. *SQLite implements it, both on an
+// SQLite file (NewSQLite) and on Postgres (NewPostgres), so several instances
+// can share one Postgres metadata database behind a load balancer.
+type MetaStore interface {
+	// Store lifecycle and schema.
+	Postgres() bool
+	Encryptor() *Encryptor
+	DB() *sql.DB
+	Close() error
+	MigrationStatus() ([]MigrationStatus, error)
+	Migrate() error
+	RollbackMigration(name string) error
+
+	// Projects, members and project settings.
+	CreateProject(ctx context.Context, id, name string) (*Project, error)
+	GetProject(ctx context.Context, id string) (*Project, error)
+	GetProjectByAPIKey(ctx context.Context, apiKey string) (*Project, error)
+	GetProjectByPublicID(ctx context.Context, publicID string) (*Project, error)
+	ListProjects(ctx context.Context) ([]Project, error)
+	UpdateProjectDescription(ctx context.Context, id, description string) error
+	AddProjectMember(ctx context.Context, userID, projectID, role string) error
+	RemoveProjectMember(ctx context.Context, userID, projectID string) error
+	ListProjectMembers(ctx context.Context, projectID string) ([]ProjectMember, error)
+	ListUserProjects(ctx context.Context, userID string) ([]Project, error)
+	GetUserProjectRole(ctx context.Context, userID, projectID string) (string, error)
+	GetGrowthSetting(ctx context.Context, projectID, key string) (string, error)
+	SetGrowthSetting(ctx context.Context, projectID, key, value string) error
+	ListProjectsWithSetting(ctx context.Context, key, value string) ([]string, error)
+	Timezone(ctx context.Context, projectID string) *time.Location
+	SetTimezone(ctx context.Context, projectID, name string) error
+	SampleRate(ctx context.Context, projectID string) float64
+	EventQuota(ctx context.Context, projectID string) int64
+	SetEventQuota(ctx context.Context, projectID string, quota int64) error
+	MonthlyEventUsage(ctx context.Context, projectID string, now time.Time) (int64, error)
+	AddEventUsage(ctx context.Context, projectID string, now time.Time, n int64) (int64, error)
+	SetEventUsage(ctx context.Context, projectID string, now time.Time, n int64) error
+	PrimaryEvent(ctx context.Context, projectID string) string
+	GetBotFilters(ctx context.Context, projectID string) []string
+	BotFilter(ctx context.Context, projectID string) *BotFilter
+	SetBotFilters(ctx context.Context, projectID string, filters []string) error
+	NamingEventTypes(ctx context.Context, projectID string) []string
+	SetNamingEventTypes(ctx context.Context, projectID string, types []string) error
+	FingerprintStrategy(ctx context.Context, projectID string) FingerprintStrategy
+	SetFingerprintStrategy(ctx context.Context, projectID string, st FingerprintStrategy) error
+	InternalTraffic(ctx context.Context, projectID string) *InternalTrafficRule
+	SetInternalTraffic(ctx context.Context, projectID string, r InternalTrafficRule) error
+	GetPathRules(ctx context.Context, projectID string) []PathRule
+	SetPathRules(ctx context.Context, projectID string, rules []PathRule) error
+
+	// Users and dashboard sessions.
+	CountUsers(ctx context.Context) (int, error)
+	CreateUser(ctx context.Context, email, passwordHash string) (*User, error)
+	InstanceAdminID(ctx context.Context) (string, error)
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+	GetUser(ctx context.Context, id string) (*User, error)
+	CreateUserSession(ctx context.Context, userID string, expires time.Time, projectID string) (string, error)
+	GetUserSession(ctx context.Context, token string) (string, string, error)
+	DeleteUserSession(ctx context.Context, token string) error
+	SwitchSessionProject(ctx context.Context, token, projectID string) error
+
+	// Identity aliases.
+	SetIdentityAlias(ctx context.Context, projectID, anonymousID, identifiedID string) error
+	ResolveIdentity(ctx context.Context, projectID, distinctID string) (string, error)
+	DeleteIdentityAliases(ctx context.Context, projectID, identifiedID string) error
+	ListAliases(ctx context.Context, projectID, identifiedID string) ([]string, error)
+
+	// AI event naming.
+	GetEventName(ctx context.Context, projectID, fingerprint string) (*EventName, error)
+	BatchGetEventNames(ctx context.Context, projectID string, fingerprints []string) (map[string]*EventName, error)
+	SetEventName(ctx context.Context, en EventName) error
+	NameReviewEnabled(ctx context.Context, projectID string) bool
+	NameConfidenceThreshold(ctx context.Context, projectID string) float64
+	ListEventNamesByStatus(ctx context.Context, projectID, status string) ([]EventName, error)
+	SetEventNameStatus(ctx context.Context, projectID, fingerprint, status string) error
+	DeleteEventName(ctx context.Context, projectID, fingerprint string) error
+	EventNameTaken(ctx context.Context, projectID, name, excludeFingerprint string) (bool, error)
+	ClearAIEventNames(ctx context.Context, projectID string) error
+	OverrideEventName(ctx context.Context, projectID, fingerprint, userName string) error
+	ListEventNames(ctx context.Context, projectID string) ([]EventName, error)
+	CountEventNamesByDay(ctx context.Context, projectID string, start, end time.Time) (map[string]int64, error)
+	GetLLMConfig(ctx context.Context, projectID string) (*LLMConfig, error)
+	SetLLMConfig(ctx context.Context, c LLMConfig) error
+
+	// Integrations: GitHub, OAuth and source credentials.
+	GetGitHubConnection(ctx context.Context, projectID string) (*GitHubConnection, error)
+	SetGitHubConnection(ctx context.Context, g GitHubConnection) error
+	SetOAuthState(ctx context.Context, state, projectID string) error
+	SetOAuthStateExtra(ctx context.Context, state, projectID, extra string) error
+	ValidateOAuthState(ctx context.Context, state string) (string, error)
+	ValidateOAuthStateExtra(ctx context.Context, state string) (projectID, extra string, err error)
+	GetSourceCredentials(ctx context.Context, projectID, sourceName string) (*SourceCredentials, error)
+	UpsertSourceCredentials(ctx context.Context, c SourceCredentials) error
+	DeleteSourceCredentials(ctx context.Context, projectID, sourceName string) error
+	UpsertSourceIndex(ctx context.Context, projectID, filePath, componentName, selectors, contentHash string) error
+
+	// Saved analyses: funnels, dashboards, widgets and segments.
+	CreateFunnel(ctx context.Context, f Funnel) error
+	GetFunnel(ctx context.Context, projectID, id string) (*Funnel, error)
+	ListFunnels(ctx context.Context, projectID string) ([]Funnel, error)
+	UpdateFunnel(ctx context.Context, f Funnel) error
+	DeleteFunnel(ctx context.Context, projectID, id string) error
+	CreateDashboard(ctx context.Context, d Dashboard) error
+	GetDashboard(ctx context.Context, projectID, id string) (*Dashboard, error)
+	ListDashboards(ctx context.Context, projectID string) ([]Dashboard, error)
+	UpdateDashboard(ctx context.Context, d Dashboard) error
+	DeleteDashboard(ctx context.Context, projectID, id string) error
+	CreateWidget(ctx context.Context, wd Widget) (*Widget, error)
+	ListWidgets(ctx context.Context, projectID string) ([]Widget, error)
+	GetWidget(ctx context.Context, projectID, id string) (*Widget, error)
+	DeleteWidget(ctx context.Context, projectID, id string) error
+	CreateSegment(ctx context.Context, projectID, name, conditions string) (*Segment, error)
+	ListSegments(ctx context.Context, projectID string) ([]Segment, error)
+	GetSegment(ctx context.Context, projectID, id string) (*Segment, error)
+	DeleteSegment(ctx context.Context, projectID, id string) error
+
+	// Feature flags and experiments.
+	CreateFeatureFlag(ctx context.Context, f FeatureFlag) error
+	ListFeatureFlags(ctx context.Context, projectID string) ([]FeatureFlag, error)
+	UpdateFeatureFlag(ctx context.Context, projectID, id string, enabled bool, rolloutPct int) error
+	SetFeatureFlagVariants(ctx context.Context, projectID, id, variants string) error
+	DeleteFeatureFlag(ctx context.Context, projectID, id string) error
+	CreateExperiment(ctx context.Context, e Experiment) error
+	ListExperiments(ctx context.Context, projectID string) ([]Experiment, error)
+	GetExperiment(ctx context.Context, projectID, id string) (*Experiment, error)
+	GetExperimentByFlagKey(ctx context.Context, projectID, flagKey string) (*Experiment, error)
+	UpdateExperiment(ctx context.Context, projectID, id string, name, status string, autoStop bool, conversionGoalID string) error
+	EndExperiment(ctx context.Context, projectID, id, winnerVariant string) error
+	DeleteExperiment(ctx context.Context, projectID, id string) error
+
+	// Alerts.
+	CreateAlert(ctx context.Context, a Alert) error
+	ListAlerts(ctx context.Context, projectID string) ([]Alert, error)
+	ListAllEnabledAlerts(ctx context.Context) ([]Alert, error)
+	UpdateAlert(ctx context.Context, projectID, id string, enabled bool, threshold int, webhookURL string) error
+	DeleteAlert(ctx context.Context, projectID, id string) error
+	UpdateAlertTriggered(ctx context.Context, id string, t time.Time) error
+
+	// Growth: attribution, lead scoring, CRM webhooks and campaigns.
+	CreateRefCode(ctx context.Context, rc RefCode) error
+	GetRefCode(ctx context.Context, projectID, id string) (*RefCode, error)
+	ListRefCodes(ctx context.Context, projectID string) ([]RefCode, error)
+	UpdateRefCode(ctx context.Context, projectID, id, name, notes string) error
+	DeleteRefCode(ctx context.Context, projectID, id string) error
+	CreateConversionGoal(ctx context.Context, g ConversionGoal) error
+	ListConversionGoals(ctx context.Context, projectID string) ([]ConversionGoal, error)
+	GetConversionGoal(ctx context.Context, projectID, id string) (*ConversionGoal, error)
+	UpdateConversionGoal(ctx context.Context, projectID, id string, g ConversionGoal) error
+	DeleteConversionGoal(ctx context.Context, projectID, id string) error
+	CreateScoringRule(ctx context.Context, r ScoringRule) error
+	ListScoringRules(ctx context.Context, projectID string) ([]ScoringRule, error)
+	UpdateScoringRule(ctx context.Context, projectID, id string, name, ruleType, config string, points int, enabled bool) error
+	DeleteScoringRule(ctx context.Context, projectID, id string) error
+	UpsertLeadScoreSnapshot(ctx context.Context, projectID, distinctID, date string, score, rawScore int) error
+	GetYesterdayScores(ctx context.Context, projectID string) (map[string]int, error)
+	GetLeadScoreHistory(ctx context.Context, projectID, distinctID string, days int) ([]LeadScoreSnapshot, error)
+	CreateCRMWebhook(ctx context.Context, w CRMWebhook) error
+	ListCRMWebhooks(ctx context.Context, projectID string) ([]CRMWebhook, error)
+	ListAllEnabledCRMWebhooks(ctx context.Context) ([]CRMWebhook, error)
+	UpdateCRMWebhook(ctx context.Context, projectID, id string, name, webhookURL string, minScore int, enabled bool, secret, payloadTemplate string) error
+	UpdateCRMWebhookPushed(ctx context.Context, id string, t time.Time) error
+	DeleteCRMWebhook(ctx context.Context, projectID, id string) error
+	CreateWebhookDelivery(ctx context.Context, d WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, projectID, webhookID string, limit int) ([]WebhookDelivery, error)
+	ListDeadLetterDeliveries(ctx context.Context, projectID string, limit int) ([]WebhookDelivery, error)
+	CreateCampaign(ctx context.Context, c Campaign) error
+	ListCampaigns(ctx context.Context, projectID string) ([]Campaign, error)
+	GetCampaign(ctx context.Context, projectID, id string) (*Campaign, error)
+	UpdateCampaign(ctx context.Context, projectID, id, name, status, content string, cost float64) error
+	DeleteCampaign(ctx context.Context, projectID, id string) error
+	CreateCampaignPost(ctx context.Context, cp CampaignPost) error
+	ListCampaignPosts(ctx context.Context, projectID string) ([]CampaignPost, error)
+	UpdateCampaignPostEngagement(ctx context.Context, id, engagement string, fetchedAt time.Time) error
+	CreateICPAnalysis(ctx context.Context, a ICPAnalysis) error
+	ListICPAnalyses(ctx context.Context, projectID string, limit int) ([]ICPAnalysis, error)
+	GetICPAnalysis(ctx context.Context, projectID, id string) (*ICPAnalysis, error)
+	DeleteICPAnalysis(ctx context.Context, projectID, id string) error
+
+	// Mentions and their sources.
+	UpsertMention(ctx context.Context, m MentionRecord) error
+	ListMentions(ctx context.Context, projectID, status, source string, limit, offset int) ([]MentionRecord, int, error)
+	GetMention(ctx context.Context, projectID, id string) (*MentionRecord, error)
+	UpdateMentionStatus(ctx context.Context, projectID, id, status string) error
+	UpdateMentionReply(ctx context.Context, projectID, id, suggestedReply string) error
+	ListSourceConfigs(ctx context.Context, projectID string) ([]SourceConfig, error)
+	GetSourceConfig(ctx context.Context, projectID, sourceName string) (*SourceConfig, error)
+	UpsertSourceConfig(ctx context.Context, sc SourceConfig) error
+	UpdateSourceConfigLastRun(ctx context.Context, projectID, sourceName string, t time.Time) error
+}
+
+var _ MetaStore = (*SQLite)(nil)
@@ -3,6 +3,7 @@ package storage
 import (
 	"database/sql"
 	"embed"
+	"errors"
 	"fmt"
 	"io/fs"
 	"sort"
@@ -15,9 +16,27 @@ var duckdbMigrations embed.FS
 //go:embed migrations/sqlite/*.sql
 var sqliteMigrations embed.FS
 
+//go:embed migrations/postgres/*.sql
+var postgresMigrations embed.FS
+
+// downSuffix marks a rollback script paired with a forward migration:
+// 027_identity_aliases.sql is reverted by 027_identity_aliases.down.sql.
+const downSuffix = ".down.sql"
+
+// ErrInvalidRollback is returned by RollbackMigration when the named
+// migration can't be rolled back: it isn't a forward migration, isn't
+// applied, or has no down script.
+var ErrInvalidRollback = errors.New("invalid rollback")
+
+// isUpMigration reports whether name is a forward migration file.
+func isUpMigration(name string) bool {
+	return strings.HasSuffix(name, ".sql") && !strings.HasSuffix(name, downSuffix)
+}
+
 // RunMigrations executes any SQL migration files that have not yet been applied.
 // It maintains a schema_migrations table in the target database to track which
-// files have already run, so each migration executes exactly once.
+// files have already run, so each migration executes exactly once. Paired
+// .down.sql files are never run here; see RollbackMigration.
 func RunMigrations(db *sql.DB, migrations embed.FS, dir string) error {
 	// Ensure the tracking table exists.
 	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
@@ -57,7 +76,7 @@ func RunMigrations(db *sql.DB, migrations embed.FS, dir string) error {
 	})
 
 	for _, entry := range entries {
-		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".sql") {
+		if entry.IsDir() || !isUpMigration(entry.Name()) {
 			continue
 		}
 		if applied[entry.Name()] {
@@ -69,14 +88,191 @@ func RunMigrations(db *sql.DB, migrations embed.FS, dir string) error {
 			return fmt.Errorf("reading migration %s: %w", entry.Name(), err)
 		}
 
-		if _, err := db.Exec(string(data)); err != nil {
-			return fmt.Errorf("executing migration %s: %w", entry.Name(), err)
+		if err := applyMigration(db, entry.Name(), string(data)); err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
 
-		if _, err := db.Exec(`INSERT INTO schema_migrations (filename) VALUES (?)`, entry.Name()); err != nil {
-			return fmt.Errorf("recording migration %s: %w", entry.Name(), err)
+// noTxDirective opts a migration out of the wrapping transaction. Put it on
+// the first line of files containing statements the driver refuses to run
+// inside a transaction (e.g. DuckDB CHECKPOINT/VACUUM or SQLite PRAGMA
+// foreign_keys). Such migrations are not atomic.
+const noTxDirective = "-- clicknest:no-transaction"
+
+// applyMigration runs one migration file and records it in schema_migrations.
+// SQLite, Postgres and DuckDB all support transactional DDL, so by default the script
+// and its tracking row commit together: a failure partway through rolls back
+// every statement and leaves the migration unrecorded, to be retried on the
+// next start.
+func applyMigration(db *sql.DB, name, script string) error {
+	if strings.HasPrefix(script, noTxDirective) {
+		if _, err := db.Exec(script); err != nil {
+			return fmt.Errorf("executing migration %s: %w", name, err)
+		}
+		if _, err := db.Exec(`INSERT INTO schema_migrations (filename) VALUES (?)`, name); err != nil {
+			return fmt.Errorf("recording migration %s: %w", name, err)
 		}
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning migration %s: %w", name, err)
 	}
+	defer tx.Rollback()
 
+	if _, err := tx.Exec(script); err != nil {
+		return fmt.Errorf("executing migration %s: %w", name, err)
+	}
+	if _, err := tx.Exec(`INSERT INTO schema_migrations (filename) VALUES (?)`, name); err != nil {
+		return fmt.Errorf("recording migration %s: %w", name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("committing migration %s: %w", name, err)
+	}
 	return nil
 }
+
+// MigrationStatus describes one embedded migration file and whether it has
+// been applied to the target database.
+type MigrationStatus struct {
+	Filename   string `json:"filename"`
+	Applied    bool   `json:"applied"`
+	AppliedAt  string `json:"applied_at,omitempty"`
+	Reversible bool   `json:"reversible"` // a paired .down.sql exists
+}
+
+// GetMigrationStatus lists every migration file in dir alongside its
+// schema_migrations record, sorted by filename. Files that have not run yet
+// are reported with Applied=false.
+func GetMigrationStatus(db *sql.DB, migrations embed.FS, dir string) ([]MigrationStatus, error) {
+	rows, err := db.Query(`SELECT filename, CAST(applied_at AS VARCHAR) FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("querying schema_migrations: %w", err)
+	}
+	appliedAt := make(map[string]string)
+	for rows.Next() {
+		var name, at string
+		if err := rows.Scan(&name, &at); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		appliedAt[name] = at
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading migration dir %s: %w", dir, err)
+	}
+	downs := make(map[string]bool)
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), downSuffix) {
+			downs[entry.Name()] = true
+		}
+	}
+	var out []MigrationStatus
+	for _, entry := range entries {
+		if entry.IsDir() || !isUpMigration(entry.Name()) {
+			continue
+		}
+		at, ok := appliedAt[entry.Name()]
+		out = append(out, MigrationStatus{
+			Filename:   entry.Name(),
+			Applied:    ok,
+			AppliedAt:  at,
+			Reversible: downs[downMigrationName(entry.Name())],
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Filename < out[j].Filename })
+	return out, nil
+}
+
+// downMigrationName returns the rollback script name for a forward migration.
+func downMigrationName(name string) string {
+	return strings.TrimSuffix(name, ".sql") + downSuffix
+}
+
+// RollbackMigration reverts a single applied migration by running its paired
+// .down.sql script and deleting its schema_migrations row, both in one
+// transaction so a failing script leaves the migration recorded as applied.
+// Rolling back anything other than the most recent migration is allowed but
+// the caller is responsible for any later migrations that depend on it.
+func RollbackMigration(db *sql.DB, migrations embed.FS, dir, name string) error {
+	if !isUpMigration(name) {
+		return fmt.Errorf("%w: invalid migration name %q", ErrInvalidRollback, name)
+	}
+	var applied int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations WHERE filename = ?`, name).Scan(&applied); err != nil {
+		return fmt.Errorf("querying schema_migrations: %w", err)
+	}
+	if applied == 0 {
+		return fmt.Errorf("%w: migration %s is not applied", ErrInvalidRollback, name)
+	}
+
+	data, err := fs.ReadFile(migrations, dir+"/"+downMigrationName(name))
+	if err != nil {
+		return fmt.Errorf("%w: migration %s has no down script: %v", ErrInvalidRollback, name, err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginning rollback of %s: %w", name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(string(data)); err != nil {
+		return fmt.Errorf("executing rollback of %s: %w", name, err)
+	}
+	if _, err := tx.Exec(`DELETE FROM schema_migrations WHERE filename = ?`, name); err != nil {
+		return fmt.Errorf("unrecording migration %s: %w", name, err)
+	}
+	return tx.Commit()
+}
+
+// metaMigrations returns the migration set for the metadata store's backend.
+func (s *SQLite) metaMigrations() (embed.FS, string) {
+	if s.postgres {
+		return postgresMigrations, "migrations/postgres"
+	}
+	return sqliteMigrations, "migrations/sqlite"
+}
+
+// MigrationStatus reports applied and pending metadata store migrations.
+func (s *SQLite) MigrationStatus() ([]MigrationStatus, error) {
+	migrations, dir := s.metaMigrations()
+	return GetMigrationStatus(s.db, migrations, dir)
+}
+
+// Migrate applies any pending metadata store migrations.
+func (s *SQLite) Migrate() error {
+	migrations, dir := s.metaMigrations()
+	return RunMigrations(s.db, migrations, dir)
+}
+
+// RollbackMigration reverts one applied metadata store migration.
+func (s *SQLite) RollbackMigration(name string) error {
+	migrations, dir := s.metaMigrations()
+	return RollbackMigration(s.db, migrations, dir, name)
+}
+
+// MigrationStatus reports applied and pending DuckDB migrations.
+func (d *DuckDB) MigrationStatus() ([]MigrationStatus, error) {
+	return GetMigrationStatus(d.db, duckdbMigrations, "migrations/duckdb")
+}
+
+// Migrate applies any pending DuckDB migrations.
+func (d *DuckDB) Migrate() error {
+	return RunMigrations(d.db, duckdbMigrations, "migrations/duckdb")
+}
+
+// RollbackMigration reverts one applied DuckDB migration.
+func (d *DuckDB) RollbackMigration(name string) error {
+	return RollbackMigration(d.db, duckdbMigrations, "migrations/duckdb", name)
+}
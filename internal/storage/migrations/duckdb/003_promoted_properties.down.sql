@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS event_properties;
+DROP TABLE IF EXISTS promoted_properties;
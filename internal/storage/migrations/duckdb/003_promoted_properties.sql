@@ -0,0 +1,16 @@
+-- Hot properties a project filters on often. Their values are copied out of
+-- the properties JSON into event_properties, whose index serves the filter
+-- instead of scanning every row's JSON.
+CREATE TABLE IF NOT EXISTS promoted_properties (
+    project_id VARCHAR NOT NULL,
+    key        VARCHAR NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS event_properties (
+    project_id VARCHAR NOT NULL,
+    key        VARCHAR NOT NULL,
+    value      VARCHAR NOT NULL,
+    event_id   VARCHAR NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_event_properties_lookup ON event_properties (project_id, key, value);
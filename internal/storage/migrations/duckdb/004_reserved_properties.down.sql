@@ -0,0 +1,7 @@
+UPDATE events
+SET properties = json_merge_patch(properties, json_object('$internal', NULL, 'internal', json_extract(properties, '$."$internal"')))
+WHERE json_extract(properties, '$."$internal"') IS NOT NULL;
+
+UPDATE events
+SET properties = json_merge_patch(properties, json_object('$sample_rate', NULL, 'sample_rate', json_extract(properties, '$."$sample_rate"')))
+WHERE json_extract(properties, '$."$sample_rate"') IS NOT NULL;
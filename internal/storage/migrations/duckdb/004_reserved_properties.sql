@@ -0,0 +1,10 @@
+-- Ingest's own properties move to $-prefixed keys clients can't send, so a
+-- client property named internal or sample_rate no longer changes filtering
+-- or sample scaling. Rows written before keep the meaning they had.
+UPDATE events
+SET properties = json_merge_patch(properties, json_object('internal', NULL, '$internal', json_extract(properties, '$.internal')))
+WHERE json_extract(properties, '$.internal') IS NOT NULL;
+
+UPDATE events
+SET properties = json_merge_patch(properties, json_object('sample_rate', NULL, '$sample_rate', json_extract(properties, '$.sample_rate')))
+WHERE json_extract(properties, '$.sample_rate') IS NOT NULL;
@@ -0,0 +1,29 @@
+DROP TABLE IF EXISTS identity_aliases CASCADE;
+DROP TABLE IF EXISTS experiments CASCADE;
+DROP TABLE IF EXISTS conversion_goals CASCADE;
+DROP TABLE IF EXISTS segments CASCADE;
+DROP TABLE IF EXISTS growth_settings CASCADE;
+DROP TABLE IF EXISTS lead_score_snapshots CASCADE;
+DROP TABLE IF EXISTS source_credentials CASCADE;
+DROP TABLE IF EXISTS icp_analyses CASCADE;
+DROP TABLE IF EXISTS webhook_deliveries CASCADE;
+DROP TABLE IF EXISTS source_configs CASCADE;
+DROP TABLE IF EXISTS mentions CASCADE;
+DROP TABLE IF EXISTS project_members CASCADE;
+DROP TABLE IF EXISTS campaign_posts CASCADE;
+DROP TABLE IF EXISTS campaigns CASCADE;
+DROP TABLE IF EXISTS crm_webhooks CASCADE;
+DROP TABLE IF EXISTS scoring_rules CASCADE;
+DROP TABLE IF EXISTS ref_codes CASCADE;
+DROP TABLE IF EXISTS user_sessions CASCADE;
+DROP TABLE IF EXISTS users CASCADE;
+DROP TABLE IF EXISTS alerts CASCADE;
+DROP TABLE IF EXISTS feature_flags CASCADE;
+DROP TABLE IF EXISTS dashboards CASCADE;
+DROP TABLE IF EXISTS funnels CASCADE;
+DROP TABLE IF EXISTS oauth_state CASCADE;
+DROP TABLE IF EXISTS event_names CASCADE;
+DROP TABLE IF EXISTS llm_config CASCADE;
+DROP TABLE IF EXISTS source_index CASCADE;
+DROP TABLE IF EXISTS github_connections CASCADE;
+DROP TABLE IF EXISTS projects CASCADE;
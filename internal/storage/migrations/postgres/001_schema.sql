@@ -0,0 +1,334 @@
+-- 001_schema.sql
+-- Postgres schema for the metadata store, equivalent to SQLite migrations
+-- 001-029. Booleans stay INTEGER so queries written against SQLite
+-- (enabled = 1) run unchanged. New SQLite migrations need a matching file here.
+CREATE TABLE IF NOT EXISTS projects (
+    id          TEXT PRIMARY KEY,
+    name        TEXT NOT NULL,
+    api_key     TEXT UNIQUE NOT NULL,
+    created_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS github_connections (
+    project_id      TEXT PRIMARY KEY REFERENCES projects(id),
+    repo_owner      TEXT NOT NULL,
+    repo_name       TEXT NOT NULL,
+    access_token    TEXT NOT NULL,
+    default_branch  TEXT DEFAULT 'main',
+    last_synced_at  TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS source_index (
+    project_id      TEXT NOT NULL,
+    file_path       TEXT NOT NULL,
+    component_name  TEXT,
+    selectors       TEXT,
+    content_hash    TEXT,
+    updated_at      TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, file_path)
+);
+
+CREATE TABLE IF NOT EXISTS llm_config (
+    project_id   TEXT PRIMARY KEY REFERENCES projects(id),
+    provider     TEXT NOT NULL DEFAULT 'openai',
+    api_key      TEXT,
+    model        TEXT NOT NULL DEFAULT 'gpt-4o-mini',
+    base_url     TEXT,
+    naming_style TEXT NOT NULL DEFAULT 'sentence'
+);
+
+CREATE TABLE IF NOT EXISTS event_names (
+    fingerprint TEXT NOT NULL,
+    project_id  TEXT NOT NULL,
+    ai_name     TEXT NOT NULL,
+    user_name   TEXT,
+    source_file TEXT,
+    confidence  DOUBLE PRECISION,
+    created_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    status      TEXT NOT NULL DEFAULT 'approved',
+    PRIMARY KEY (fingerprint, project_id)
+);
+
+CREATE TABLE IF NOT EXISTS oauth_state (
+    state       TEXT PRIMARY KEY,
+    project_id  TEXT NOT NULL REFERENCES projects(id),
+    created_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    extra       TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS funnels (
+    id          TEXT PRIMARY KEY,
+    project_id  TEXT NOT NULL REFERENCES projects(id),
+    name        TEXT NOT NULL,
+    steps       TEXT NOT NULL,
+    created_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS dashboards (
+    id          TEXT PRIMARY KEY,
+    project_id  TEXT NOT NULL REFERENCES projects(id),
+    name        TEXT NOT NULL,
+    config      TEXT NOT NULL,
+    created_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at  TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    key TEXT NOT NULL,
+    name TEXT NOT NULL,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    rollout_percentage INTEGER NOT NULL DEFAULT 100,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(project_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS alerts (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    metric TEXT NOT NULL,
+    event_name TEXT,
+    threshold INTEGER NOT NULL,
+    window_minutes INTEGER NOT NULL DEFAULT 60,
+    webhook_url TEXT NOT NULL,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    last_triggered_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id            TEXT PRIMARY KEY,
+    email         TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS user_sessions (
+    token      TEXT PRIMARY KEY,
+    user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    project_id TEXT REFERENCES projects(id)
+);
+
+CREATE TABLE IF NOT EXISTS ref_codes (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    code TEXT NOT NULL,
+    name TEXT NOT NULL,
+    notes TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(project_id, code)
+);
+
+CREATE TABLE IF NOT EXISTS scoring_rules (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    rule_type TEXT NOT NULL,
+    config TEXT NOT NULL DEFAULT '{}',
+    points INTEGER NOT NULL DEFAULT 0,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS crm_webhooks (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    webhook_url TEXT NOT NULL,
+    min_score INTEGER NOT NULL DEFAULT 0,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    last_pushed_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    secret TEXT NOT NULL DEFAULT '',
+    payload_template TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS campaigns (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    channel TEXT NOT NULL,
+    ref_code_id TEXT REFERENCES ref_codes(id),
+    status TEXT NOT NULL DEFAULT 'draft',
+    content TEXT NOT NULL DEFAULT '{}',
+    ai_prompt TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    cost DOUBLE PRECISION NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS campaign_posts (
+    id TEXT PRIMARY KEY,
+    campaign_id TEXT NOT NULL REFERENCES campaigns(id),
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    connector_name TEXT NOT NULL,
+    external_id TEXT NOT NULL DEFAULT '',
+    external_url TEXT NOT NULL DEFAULT '',
+    posted_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_engagement TEXT NOT NULL DEFAULT '{}',
+    last_fetched_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS project_members (
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    project_id TEXT NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'member' CHECK(role IN ('owner','member')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, project_id)
+);
+
+CREATE TABLE IF NOT EXISTS mentions (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    source_name TEXT NOT NULL,
+    external_id TEXT NOT NULL,
+    external_url TEXT NOT NULL DEFAULT '',
+    author TEXT NOT NULL DEFAULT '',
+    title TEXT NOT NULL DEFAULT '',
+    content TEXT NOT NULL DEFAULT '',
+    relevance_score DOUBLE PRECISION NOT NULL DEFAULT 0.0,
+    status TEXT NOT NULL DEFAULT 'new',
+    suggested_reply TEXT NOT NULL DEFAULT '',
+    parent_id TEXT NOT NULL DEFAULT '',
+    metadata TEXT NOT NULL DEFAULT '{}',
+    posted_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_mentions_project_status ON mentions(project_id, status);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_mentions_project_external ON mentions(project_id, source_name, external_id);
+
+CREATE TABLE IF NOT EXISTS source_configs (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    source_name TEXT NOT NULL,
+    keywords TEXT NOT NULL DEFAULT '[]',
+    filters TEXT NOT NULL DEFAULT '{}',
+    schedule_minutes INTEGER NOT NULL DEFAULT 60,
+    enabled INTEGER NOT NULL DEFAULT 1,
+    last_run_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_source_configs_project_source ON source_configs(project_id, source_name);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT NOT NULL REFERENCES crm_webhooks(id) ON DELETE CASCADE,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    lead_count INTEGER NOT NULL DEFAULT 0,
+    status_code INTEGER NOT NULL DEFAULT 0,
+    response_body TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    success INTEGER NOT NULL DEFAULT 0,
+    attempt INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS icp_analyses (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    conversion_pages TEXT NOT NULL DEFAULT '[]',
+    summary TEXT NOT NULL DEFAULT '',
+    traits TEXT NOT NULL DEFAULT '[]',
+    channels TEXT NOT NULL DEFAULT '[]',
+    recommendations TEXT NOT NULL DEFAULT '[]',
+    profile_count INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_icp_analyses_project ON icp_analyses(project_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS source_credentials (
+    id            TEXT PRIMARY KEY,
+    project_id    TEXT NOT NULL,
+    source_name   TEXT NOT NULL,
+    access_token  TEXT NOT NULL DEFAULT '',
+    refresh_token TEXT NOT NULL DEFAULT '',
+    token_expiry  TIMESTAMPTZ,
+    username      TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(project_id, source_name)
+);
+
+CREATE TABLE IF NOT EXISTS lead_score_snapshots (
+    id TEXT PRIMARY KEY DEFAULT md5(random()::text || clock_timestamp()::text),
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    distinct_id TEXT NOT NULL,
+    score INTEGER NOT NULL DEFAULT 0,
+    raw_score INTEGER NOT NULL DEFAULT 0,
+    snapshot_date TEXT NOT NULL, -- YYYY-MM-DD
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(project_id, distinct_id, snapshot_date)
+);
+CREATE INDEX IF NOT EXISTS idx_score_snapshots_lead ON lead_score_snapshots(project_id, distinct_id, snapshot_date DESC);
+CREATE INDEX IF NOT EXISTS idx_score_snapshots_date ON lead_score_snapshots(project_id, snapshot_date DESC);
+
+CREATE TABLE IF NOT EXISTS growth_settings (
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    key TEXT NOT NULL,
+    value TEXT NOT NULL DEFAULT '',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, key)
+);
+
+CREATE TABLE IF NOT EXISTS segments (
+    id TEXT PRIMARY KEY DEFAULT md5(random()::text || clock_timestamp()::text),
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    conditions TEXT NOT NULL DEFAULT '[]',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_segments_project ON segments(project_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS conversion_goals (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    event_type TEXT NOT NULL DEFAULT 'custom',
+    event_name TEXT NOT NULL DEFAULT '',
+    url_pattern TEXT NOT NULL DEFAULT '',
+    value_property TEXT NOT NULL DEFAULT '$value',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(project_id, name)
+);
+CREATE INDEX IF NOT EXISTS idx_conversion_goals_project ON conversion_goals(project_id);
+
+CREATE TABLE IF NOT EXISTS experiments (
+    id TEXT PRIMARY KEY,
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    flag_key TEXT NOT NULL,
+    variants TEXT NOT NULL DEFAULT '[]',
+    conversion_goal_id TEXT DEFAULT '' REFERENCES conversion_goals(id),
+    status TEXT NOT NULL DEFAULT 'running',
+    auto_stop INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ended_at TIMESTAMPTZ,
+    winner_variant TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_experiments_project ON experiments(project_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_experiments_flag ON experiments(project_id, flag_key);
+
+CREATE TABLE IF NOT EXISTS identity_aliases (
+    project_id TEXT NOT NULL,
+    anonymous_id TEXT NOT NULL,
+    identified_id TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (project_id, anonymous_id)
+);
+CREATE INDEX IF NOT EXISTS idx_identity_aliases_identified ON identity_aliases(project_id, identified_id);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_projects_public_id;
+ALTER TABLE projects DROP COLUMN IF EXISTS public_id;
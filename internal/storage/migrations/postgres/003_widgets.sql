@@ -0,0 +1,11 @@
+-- Embeddable widgets: one saved metric served publicly to holders of a share token.
+CREATE TABLE IF NOT EXISTS widgets (
+    id TEXT PRIMARY KEY DEFAULT md5(random()::text || clock_timestamp()::text),
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    metric TEXT NOT NULL,
+    event_name TEXT NOT NULL DEFAULT '',
+    window_days INTEGER NOT NULL DEFAULT 30,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_widgets_project ON widgets(project_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- Per-alert secret used to sign webhook deliveries (X-ClickNest-Signature).
+-- Stored encrypted; existing alerts get a fresh random secret.
+ALTER TABLE alerts ADD COLUMN IF NOT EXISTS secret TEXT NOT NULL DEFAULT '';
+UPDATE alerts SET secret = md5(random()::text || id) WHERE secret = '';
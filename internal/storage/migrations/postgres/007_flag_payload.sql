@@ -0,0 +1,2 @@
+-- Optional JSON value returned with an enabled flag, e.g. {"variant":"blue"}.
+ALTER TABLE feature_flags ADD COLUMN IF NOT EXISTS payload TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,3 @@
+-- Weighted variants for multivariate flags: a JSON array of {key, weight}
+-- whose weights sum to 100. Empty means a plain on/off flag.
+ALTER TABLE feature_flags ADD COLUMN IF NOT EXISTS variants TEXT NOT NULL DEFAULT '[]';
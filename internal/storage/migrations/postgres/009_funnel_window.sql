@@ -0,0 +1,3 @@
+-- Default conversion window, in hours, for a funnel's results: each step
+-- must follow the previous within it. 0 means unbounded.
+ALTER TABLE funnels ADD COLUMN IF NOT EXISTS window_hours INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,3 @@
+-- How a funnel's steps match: 'ordered' requires them in sequence,
+-- 'unordered' counts them in any order.
+ALTER TABLE funnels ADD COLUMN IF NOT EXISTS mode TEXT NOT NULL DEFAULT 'ordered';
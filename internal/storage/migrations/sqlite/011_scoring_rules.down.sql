@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS crm_webhooks;
+DROP TABLE IF EXISTS scoring_rules;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_mentions_project_external;
+DROP INDEX IF EXISTS idx_mentions_project_status;
+DROP TABLE IF EXISTS mentions;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_source_configs_project_source;
+DROP TABLE IF EXISTS source_configs;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_icp_analyses_project;
+DROP TABLE IF EXISTS icp_analyses;
@@ -0,0 +1,2 @@
+ALTER TABLE oauth_state DROP COLUMN extra;
+DROP TABLE IF EXISTS source_credentials;
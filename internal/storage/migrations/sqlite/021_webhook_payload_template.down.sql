@@ -0,0 +1 @@
+ALTER TABLE crm_webhooks DROP COLUMN payload_template;
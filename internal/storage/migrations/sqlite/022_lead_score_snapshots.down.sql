@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_score_snapshots_date;
+DROP INDEX IF EXISTS idx_score_snapshots_lead;
+DROP TABLE IF EXISTS lead_score_snapshots;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_segments_project;
+DROP TABLE IF EXISTS segments;
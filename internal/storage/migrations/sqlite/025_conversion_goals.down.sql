@@ -0,0 +1,3 @@
+ALTER TABLE campaigns DROP COLUMN cost;
+DROP INDEX IF EXISTS idx_conversion_goals_project;
+DROP TABLE IF EXISTS conversion_goals;
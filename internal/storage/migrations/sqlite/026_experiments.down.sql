@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_experiments_flag;
+DROP INDEX IF EXISTS idx_experiments_project;
+DROP TABLE IF EXISTS experiments;
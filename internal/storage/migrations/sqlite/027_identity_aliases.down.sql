@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_identity_aliases_identified;
+DROP TABLE IF EXISTS identity_aliases;
@@ -0,0 +1 @@
+ALTER TABLE llm_config DROP COLUMN naming_style;
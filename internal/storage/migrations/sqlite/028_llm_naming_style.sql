@@ -0,0 +1 @@
+ALTER TABLE llm_config ADD COLUMN naming_style TEXT NOT NULL DEFAULT 'sentence';
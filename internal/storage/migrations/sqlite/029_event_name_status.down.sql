@@ -0,0 +1 @@
+ALTER TABLE event_names DROP COLUMN status;
@@ -0,0 +1 @@
+ALTER TABLE event_names ADD COLUMN status TEXT NOT NULL DEFAULT 'approved';
@@ -0,0 +1,5 @@
+-- A non-secret project identifier for project-scoped ingest URLs
+-- (/api/v1/{public_id}/events). The API key is still required.
+ALTER TABLE projects ADD COLUMN public_id TEXT NOT NULL DEFAULT '';
+UPDATE projects SET public_id = 'pub_' || lower(hex(randomblob(8))) WHERE public_id = '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_projects_public_id ON projects(public_id);
@@ -0,0 +1,12 @@
+-- 031_widgets.sql
+-- Embeddable widgets: one saved metric served publicly to holders of a share token.
+CREATE TABLE IF NOT EXISTS widgets (
+    id TEXT PRIMARY KEY DEFAULT (lower(hex(randomblob(16)))),
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    name TEXT NOT NULL,
+    metric TEXT NOT NULL, -- events, pageviews or errors
+    event_name TEXT NOT NULL DEFAULT '',
+    window_days INTEGER NOT NULL DEFAULT 30,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS idx_widgets_project ON widgets(project_id, created_at DESC);
@@ -0,0 +1,4 @@
+-- Per-alert secret used to sign webhook deliveries (X-ClickNest-Signature).
+-- Stored encrypted; existing alerts get a fresh random secret.
+ALTER TABLE alerts ADD COLUMN secret TEXT NOT NULL DEFAULT '';
+UPDATE alerts SET secret = lower(hex(randomblob(16))) WHERE secret = '';
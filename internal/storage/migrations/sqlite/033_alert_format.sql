@@ -0,0 +1,2 @@
+-- Webhook body format for alert deliveries: 'json' (default) or 'slack'.
+ALTER TABLE alerts ADD COLUMN format TEXT NOT NULL DEFAULT 'json';
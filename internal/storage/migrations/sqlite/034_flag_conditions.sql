@@ -0,0 +1,3 @@
+-- Targeting rules for feature flags: a JSON array of
+-- {property, operator, value} that must all pass before the rollout applies.
+ALTER TABLE feature_flags ADD COLUMN conditions TEXT NOT NULL DEFAULT '[]';
@@ -0,0 +1 @@
+ALTER TABLE funnels DROP COLUMN mode;
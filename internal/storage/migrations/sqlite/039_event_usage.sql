@@ -0,0 +1,8 @@
+-- Events ingested per project per UTC calendar month ('2006-01'), the running
+-- counter a project's monthly event quota is checked against.
+CREATE TABLE IF NOT EXISTS event_usage (
+    project_id TEXT NOT NULL REFERENCES projects(id),
+    month TEXT NOT NULL,
+    events INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (project_id, month)
+);
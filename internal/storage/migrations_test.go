@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tableExists(t *testing.T, s *SQLite, name string) bool {
+	t.Helper()
+	var n int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, name).Scan(&n); err != nil {
+		t.Fatalf("querying sqlite_master: %v", err)
+	}
+	return n > 0
+}
+
+func TestRollbackMigration(t *testing.T) {
+	db := newTestDB(t)
+	if !tableExists(t, db, "identity_aliases") {
+		t.Fatal("expected identity_aliases after migrations")
+	}
+
+	if err := db.RollbackMigration("027_identity_aliases.sql"); err != nil {
+		t.Fatalf("RollbackMigration: %v", err)
+	}
+	if tableExists(t, db, "identity_aliases") {
+		t.Fatal("expected identity_aliases to be dropped by rollback")
+	}
+
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	for _, m := range status {
+		if m.Filename == "027_identity_aliases.sql" && (m.Applied || !m.Reversible) {
+			t.Fatalf("expected 027 pending and reversible, got %+v", m)
+		}
+	}
+
+	// Forward migration re-applies it.
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if !tableExists(t, db, "identity_aliases") {
+		t.Fatal("expected identity_aliases after re-running migrations")
+	}
+}
+
+func TestRollbackMigration_NotApplied(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.RollbackMigration("999_missing.sql"); !errors.Is(err, ErrInvalidRollback) {
+		t.Fatal("expected error rolling back an unapplied migration")
+	}
+}
+
+func TestRollbackMigration_NoDownScript(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.RollbackMigration("001_projects.sql"); !errors.Is(err, ErrInvalidRollback) {
+		t.Fatal("expected error for a migration without a down script")
+	}
+	if !tableExists(t, db, "projects") {
+		t.Fatal("projects table should be untouched")
+	}
+}
+
+func TestRollbackMigration_DownScriptsRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	status, err := db.MigrationStatus()
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+
+	// Walk back from the newest migration until one can't be reverted.
+	for i := len(status) - 1; i >= 0 && status[i].Reversible; i-- {
+		if err := db.RollbackMigration(status[i].Filename); err != nil {
+			t.Fatalf("RollbackMigration(%s): %v", status[i].Filename, err)
+		}
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate after rollbacks: %v", err)
+	}
+}
+
+//go:embed testdata/failing_migrations/*.sql
+var failingMigrations embed.FS
+
+func TestRunMigrations_FailureRollsBack(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "m.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := RunMigrations(db, failingMigrations, "testdata/failing_migrations"); err == nil {
+		t.Fatal("expected migration error")
+	}
+
+	count := func(query string) int {
+		var n int
+		if err := db.QueryRow(query).Scan(&n); err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		return n
+	}
+	if count(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'first_ok'`) != 1 {
+		t.Fatal("expected the first migration to be applied")
+	}
+	if count(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_applied'`) != 0 {
+		t.Fatal("expected the failed migration's first statement to be rolled back")
+	}
+	if count(`SELECT COUNT(*) FROM schema_migrations WHERE filename = '002_broken.sql'`) != 0 {
+		t.Fatal("failed migration must not be recorded")
+	}
+	if count(`SELECT COUNT(*) FROM schema_migrations WHERE filename = '001_ok.sql'`) != 1 {
+		t.Fatal("expected the first migration to be recorded")
+	}
+}
+
+func TestDuckDBMigration_ReservedPropertyKeys(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	e := testEvent("p1", "s1", "pageview", "/", time.Now().UTC())
+	e.Properties = map[string]any{InternalProperty: true, SampleRateProperty: 0.5, "plan": "pro"}
+	if err := db.InsertEvents(ctx, []Event{e}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	props := func() map[string]any {
+		t.Helper()
+		events, err := db.QueryEvents(ctx, EventFilter{ProjectID: "p1"})
+		if err != nil || len(events) != 1 {
+			t.Fatalf("QueryEvents: %+v (%v)", events, err)
+		}
+		return events[0].Properties
+	}
+
+	// Going down restores the old unprefixed keys; migrating again moves
+	// them back, as it does for rows written before the rename.
+	if err := db.RollbackMigration("004_reserved_properties.sql"); err != nil {
+		t.Fatalf("RollbackMigration: %v", err)
+	}
+	if p := props(); p["internal"] != true || p["sample_rate"] != 0.5 || p[InternalProperty] != nil || p["plan"] != "pro" {
+		t.Fatalf("after rollback: %v", p)
+	}
+	if err := db.Migrate(); err != nil {
+		t.Fatalf("Migrate: %v", err)
+	}
+	if p := props(); p[InternalProperty] != true || p[SampleRateProperty] != 0.5 || p["internal"] != nil || p["sample_rate"] != nil || p["plan"] != "pro" {
+		t.Fatalf("after migrate: %v", p)
+	}
+}
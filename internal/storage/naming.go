@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// NamingEventTypesSetting is the growth setting key holding, as a JSON array,
+// the event types ingest submits for AI naming. Unset means every type except
+// defaultUnnamedTypes; an empty array turns naming off.
+const NamingEventTypesSetting = "naming_event_types"
+
+// defaultUnnamedTypes are left unnamed by default: pageviews are identified
+// by their URL and performance events have no element.
+var defaultUnnamedTypes = []string{"pageview", "performance"}
+
+// maxNamingEventTypes caps the configured list.
+const maxNamingEventTypes = 50
+
+// ValidateNamingEventTypes checks a list of event types eligible for naming.
+func ValidateNamingEventTypes(types []string) error {
+	if len(types) > maxNamingEventTypes {
+		return fmt.Errorf("at most %d event types allowed", maxNamingEventTypes)
+	}
+	for _, t := range types {
+		if t == "" {
+			return fmt.Errorf("event type must not be empty")
+		}
+	}
+	return nil
+}
+
+// NamesEventType reports whether events of eventType are submitted for naming
+// under types, as returned by NamingEventTypes. Nil types is the default.
+func NamesEventType(types []string, eventType string) bool {
+	if types == nil {
+		return !slices.Contains(defaultUnnamedTypes, eventType)
+	}
+	return slices.Contains(types, eventType)
+}
+
+// NamingEventTypes returns the project's event types eligible for naming, or
+// nil when it uses the default.
+func (s *SQLite) NamingEventTypes(ctx context.Context, projectID string) []string {
+	v, _ := s.GetGrowthSetting(ctx, projectID, NamingEventTypesSetting)
+	var types []string
+	if v == "" || json.Unmarshal([]byte(v), &types) != nil {
+		return nil
+	}
+	if types == nil {
+		types = []string{}
+	}
+	return types
+}
+
+// SetNamingEventTypes stores the project's event types eligible for naming.
+// Nil restores the default.
+func (s *SQLite) SetNamingEventTypes(ctx context.Context, projectID string, types []string) error {
+	if types == nil {
+		return s.SetGrowthSetting(ctx, projectID, NamingEventTypesSetting, "")
+	}
+	if err := ValidateNamingEventTypes(types); err != nil {
+		return err
+	}
+	b, err := json.Marshal(types)
+	if err != nil {
+		return err
+	}
+	return s.SetGrowthSetting(ctx, projectID, NamingEventTypesSetting, string(b))
+}
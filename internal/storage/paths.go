@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// PathRule rewrites URL path segments that fully match Pattern (an RE2
+// regular expression) to Replacement, so that parameterized routes such as
+// /product/123 and /product/456 aggregate as /product/:id. A rule with a
+// Prefix, such as "/blog/", only rewrites segments below it; a ":name"
+// segment in the prefix stands for any one segment.
+type PathRule struct {
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+	Prefix      string `json:"prefix,omitempty"`
+}
+
+// prefixPattern returns the RE2 pattern matching the start of paths under
+// the rule's prefix, and how many '/'-separated parts the prefix spans
+// before the first segment the rule may rewrite.
+func (r PathRule) prefixPattern() (string, int) {
+	parts := strings.Split(strings.TrimSuffix(r.Prefix, "/"), "/")
+	for i, p := range parts {
+		if strings.HasPrefix(p, ":") {
+			parts[i] = "[^/]*"
+		} else {
+			parts[i] = regexp.QuoteMeta(p)
+		}
+	}
+	return "^" + strings.Join(parts, "/") + "/", len(parts)
+}
+
+// DefaultPathRules collapse numeric IDs, UUIDs and long hex tokens.
+var DefaultPathRules = []PathRule{
+	{Pattern: `[0-9]+`, Replacement: ":id"},
+	{Pattern: `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`, Replacement: ":id"},
+	{Pattern: `[0-9a-fA-F]{16,}`, Replacement: ":id"},
+}
+
+// maxPathRules bounds the size of the generated CASE expression.
+const maxPathRules = 20
+
+// ValidatePathRules checks that every rule has a compilable pattern.
+func ValidatePathRules(rules []PathRule) error {
+	if len(rules) > maxPathRules {
+		return fmt.Errorf("at most %d path rules are allowed", maxPathRules)
+	}
+	for _, r := range rules {
+		if r.Pattern == "" {
+			return fmt.Errorf("path rule pattern is required")
+		}
+		if strings.Contains(r.Replacement, "/") {
+			return fmt.Errorf("path rule replacement %q must not contain '/'", r.Replacement)
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("invalid path rule pattern %q: %w", r.Pattern, err)
+		}
+		if r.Prefix != "" && (!strings.HasPrefix(r.Prefix, "/") || !strings.HasSuffix(r.Prefix, "/")) {
+			return fmt.Errorf("path rule prefix %q must start and end with '/'", r.Prefix)
+		}
+	}
+	return nil
+}
+
+// NormalizePath applies rules to each segment of path, mirroring the SQL
+// produced by pathExpr. Rules are tried in order; the first match wins.
+func NormalizePath(path string, rules []PathRule) string {
+	if len(rules) == 0 {
+		return path
+	}
+	segs := strings.Split(path, "/")
+	for i, seg := range segs {
+		for _, r := range rules {
+			if r.Prefix != "" {
+				prefix, depth := r.prefixPattern()
+				if i < depth || !regexp.MustCompile(prefix).MatchString(path) {
+					continue
+				}
+			}
+			if re, err := regexp.Compile("^(?:" + r.Pattern + ")$"); err == nil && re.MatchString(seg) {
+				segs[i] = r.Replacement
+				break
+			}
+		}
+	}
+	return strings.Join(segs, "/")
+}
+
+// pathExpr returns a SQL expression for column with rules applied segment by
+// segment. With no rules it returns column unchanged. Values are inlined
+// (escaped) like the funnel queries, so rules must be validated first.
+func pathExpr(column string, rules []PathRule) string {
+	if len(rules) == 0 {
+		return column
+	}
+	var b strings.Builder
+	b.WriteString("array_to_string(list_transform(string_split(")
+	b.WriteString(column)
+	b.WriteString(", '/'), (seg, i) -> CASE")
+	for _, r := range rules {
+		b.WriteString(" WHEN ")
+		if r.Prefix != "" {
+			// i is 1-based, so i > depth is the first segment after the prefix.
+			prefix, depth := r.prefixPattern()
+			fmt.Fprintf(&b, "i > %d AND regexp_matches(%s, '%s') AND ", depth, column, sqlEsc(prefix))
+		}
+		fmt.Fprintf(&b, "regexp_full_match(seg, '%s') THEN '%s'", sqlEsc(r.Pattern), sqlEsc(r.Replacement))
+	}
+	b.WriteString(" ELSE seg END), '/')")
+	return b.String()
+}
+
+// PathRulesSetting is the growth setting key holding a project's PathRule
+// list as JSON. When unset, DefaultPathRules apply.
+const PathRulesSetting = "path_rules"
+
+// GetPathRules returns the project's path normalization rules.
+func (s *SQLite) GetPathRules(ctx context.Context, projectID string) []PathRule {
+	v, _ := s.GetGrowthSetting(ctx, projectID, PathRulesSetting)
+	if v == "" {
+		return DefaultPathRules
+	}
+	var rules []PathRule
+	if err := json.Unmarshal([]byte(v), &rules); err != nil || ValidatePathRules(rules) != nil {
+		return DefaultPathRules
+	}
+	return rules
+}
+
+// SetPathRules validates and stores the project's path normalization rules.
+// A nil slice restores the defaults.
+func (s *SQLite) SetPathRules(ctx context.Context, projectID string, rules []PathRule) error {
+	if rules == nil {
+		return s.SetGrowthSetting(ctx, projectID, PathRulesSetting, "")
+	}
+	if err := ValidatePathRules(rules); err != nil {
+		return err
+	}
+	b, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	return s.SetGrowthSetting(ctx, projectID, PathRulesSetting, string(b))
+}
+
+// PathSuggestion proposes a PathRule for a URL position whose segment takes
+// many distinct values, e.g. the second segment of /product/123.
+type PathSuggestion struct {
+	Prefix         string   `json:"prefix"`
+	Position       int      `json:"position"`
+	DistinctValues int      `json:"distinct_values"`
+	Views          int64    `json:"views"`
+	Examples       []string `json:"examples"`
+	Rule           PathRule `json:"rule"`
+}
+
+// Inferred patterns for high-cardinality segments, most specific first.
+var suggestionPatterns = []PathRule{
+	{Pattern: `[0-9]+`, Replacement: ":id"},
+	{Pattern: `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`, Replacement: ":id"},
+	{Pattern: `[0-9a-fA-F]{8,}`, Replacement: ":id"},
+	{Pattern: `[A-Za-z0-9_-]*[0-9][A-Za-z0-9_-]*`, Replacement: ":id"},
+	{Pattern: `[a-z0-9]+(-[a-z0-9]+)+`, Replacement: ":slug"},
+}
+
+// SuggestPathRules looks for path positions that have at least minDistinct
+// distinct segment values under the same prefix and proposes a rule that
+// would collapse them. pages are raw (un-normalized) path counts; paths are
+// first normalized with the project's current rules so already-grouped
+// segments are not suggested again and nested IDs share a prefix.
+func SuggestPathRules(pages []PageStat, rules []PathRule, minDistinct int) []PathSuggestion {
+	if minDistinct < 2 {
+		minDistinct = 2
+	}
+	type group struct {
+		prefix   string
+		position int
+		values   map[string]int64
+	}
+	groups := map[string]*group{}
+	var order []string
+	for _, p := range pages {
+		segs := strings.Split(NormalizePath(p.Path, rules), "/")
+		for i := 1; i < len(segs); i++ {
+			seg := segs[i]
+			if seg == "" || strings.HasPrefix(seg, ":") {
+				continue
+			}
+			prefix := strings.Join(segs[:i], "/") + "/"
+			key := fmt.Sprintf("%d|%s", i, prefix)
+			g, ok := groups[key]
+			if !ok {
+				g = &group{prefix: prefix, position: i, values: map[string]int64{}}
+				groups[key] = g
+				order = append(order, key)
+			}
+			g.values[seg] += p.Views
+		}
+	}
+
+	var out []PathSuggestion
+	for _, key := range order {
+		g := groups[key]
+		if len(g.values) < minDistinct {
+			continue
+		}
+		rule, ok := inferPathRule(g.values)
+		if !ok {
+			continue
+		}
+		rule.Prefix = g.prefix
+		s := PathSuggestion{Prefix: g.prefix, Position: g.position, DistinctValues: len(g.values), Rule: rule}
+		vals := make([]string, 0, len(g.values))
+		for v, n := range g.values {
+			s.Views += n
+			vals = append(vals, v)
+		}
+		slices.SortFunc(vals, func(a, b string) int {
+			if c := cmp.Compare(g.values[b], g.values[a]); c != 0 {
+				return c
+			}
+			return cmp.Compare(a, b)
+		})
+		s.Examples = vals[:min(5, len(vals))]
+		out = append(out, s)
+	}
+	slices.SortFunc(out, func(a, b PathSuggestion) int {
+		return cmp.Compare(b.DistinctValues, a.DistinctValues)
+	})
+	return out
+}
+
+// inferPathRule returns the first suggestion pattern that matches at least
+// 90% of values, tolerating a few static siblings such as /product/new.
+func inferPathRule(values map[string]int64) (PathRule, bool) {
+	for _, r := range suggestionPatterns {
+		re := regexp.MustCompile("^(?:" + r.Pattern + ")$")
+		matched := 0
+		for v := range values {
+			if re.MatchString(v) {
+				matched++
+			}
+		}
+		if matched*10 >= len(values)*9 {
+			return r, true
+		}
+	}
+	return PathRule{}, false
+}
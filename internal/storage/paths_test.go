@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestNormalizePath(t *testing.T) {
+	cases := map[string]string{
+		"/product/123": "/product/:id",
+		"/users/550e8400-e29b-41d4-a716-446655440000/x": "/users/:id/x",
+		"/commit/0123456789abcdef0123":                  "/commit/:id",
+		"/pricing":                                      "/pricing",
+		"/v2/docs":                                      "/v2/docs",
+	}
+	for in, want := range cases {
+		if got := NormalizePath(in, DefaultPathRules); got != want {
+			t.Errorf("NormalizePath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestQueryTopPages_Normalized(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+	if err := db.InsertEvents(ctx, []Event{
+		testEvent("p1", "s1", "pageview", "/product/1", now),
+		testEvent("p1", "s2", "pageview", "/product/2", now),
+		testEvent("p1", "s3", "pageview", "/product/3", now),
+		testEvent("p1", "s1", "pageview", "/pricing", now),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+
+	raw, err := db.QueryTopPages(ctx, "p1", start, end, 10, nil)
+	if err != nil {
+		t.Fatalf("QueryTopPages: %v", err)
+	}
+	if len(raw) != 4 {
+		t.Fatalf("expected 4 raw pages, got %d", len(raw))
+	}
+
+	pages, err := db.QueryTopPages(ctx, "p1", start, end, 10, DefaultPathRules)
+	if err != nil {
+		t.Fatalf("QueryTopPages normalized: %v", err)
+	}
+	if len(pages) != 2 || pages[0].Path != "/product/:id" || pages[0].Views != 3 || pages[0].Sessions != 3 {
+		t.Fatalf("expected /product/:id with 3 views first, got %+v", pages)
+	}
+
+	if _, err := db.QueryPaths(ctx, "p1", start, end, 10, DefaultPathRules); err != nil {
+		t.Fatalf("QueryPaths normalized: %v", err)
+	}
+	if _, err := db.QueryHeatmap(ctx, "p1", "/product/:id", start, end, DefaultPathRules); err != nil {
+		t.Fatalf("QueryHeatmap normalized: %v", err)
+	}
+}
+
+func TestQueryTopPages_PrefixedRule(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+	if err := db.InsertEvents(ctx, []Event{
+		testEvent("p1", "s1", "pageview", "/blog/first-post", now),
+		testEvent("p1", "s2", "pageview", "/blog/second-post", now),
+		testEvent("p1", "s3", "pageview", "/about/our-team", now),
+		testEvent("p1", "s4", "pageview", "/shop/7/red-shoes", now),
+		testEvent("p1", "s5", "pageview", "/shop/8/blue-shoes", now),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	rules := []PathRule{
+		{Pattern: `[0-9]+`, Replacement: ":id"},
+		{Pattern: `[a-z0-9]+(-[a-z0-9]+)+`, Replacement: ":slug", Prefix: "/blog/"},
+		{Pattern: `[a-z0-9]+(-[a-z0-9]+)+`, Replacement: ":slug", Prefix: "/shop/:id/"},
+	}
+	pages, err := db.QueryTopPages(ctx, "p1", now.Add(-time.Hour), now.Add(time.Hour), 10, rules)
+	if err != nil {
+		t.Fatalf("QueryTopPages: %v", err)
+	}
+	got := map[string]int64{}
+	for _, p := range pages {
+		got[p.Path] = p.Views
+	}
+	want := map[string]int64{"/blog/:slug": 2, "/about/our-team": 1, "/shop/:id/:slug": 2}
+	if len(got) != len(want) {
+		t.Fatalf("got pages %v, want %v", got, want)
+	}
+	for path, views := range want {
+		if got[path] != views {
+			t.Errorf("%s: %d views, want %d (all: %v)", path, got[path], views, got)
+		}
+	}
+}
+
+func TestValidatePathRules(t *testing.T) {
+	if err := ValidatePathRules([]PathRule{{Pattern: "[", Replacement: ":id"}}); err == nil {
+		t.Fatal("expected invalid regex to be rejected")
+	}
+	if err := ValidatePathRules([]PathRule{{Pattern: "[a-z]+", Replacement: "a/b"}}); err == nil {
+		t.Fatal("expected replacement containing '/' to be rejected")
+	}
+	if err := ValidatePathRules([]PathRule{{Pattern: "[a-z]+", Replacement: ":slug", Prefix: "blog"}}); err == nil {
+		t.Fatal("expected a prefix without slashes to be rejected")
+	}
+	if err := ValidatePathRules([]PathRule{{Pattern: "[a-z]{2}", Replacement: ":locale"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSuggestPathRules_FlagsHighCardinalitySegment(t *testing.T) {
+	var pages []PageStat
+	for i := 0; i < 30; i++ {
+		pages = append(pages, PageStat{Path: fmt.Sprintf("/blog/post-number-%c%c", 'a'+i%26, 'a'+i/26), Views: 1})
+	}
+	pages = append(pages,
+		PageStat{Path: "/pricing", Views: 50},
+		PageStat{Path: "/docs/intro", Views: 10},
+		PageStat{Path: "/docs/setup", Views: 10},
+		PageStat{Path: "/product/7", Views: 3},
+	)
+
+	got := SuggestPathRules(pages, DefaultPathRules, 20)
+	if len(got) != 1 {
+		t.Fatalf("expected one suggestion, got %+v", got)
+	}
+	s := got[0]
+	if s.Prefix != "/blog/" || s.Position != 2 || s.DistinctValues != 30 || s.Views != 30 {
+		t.Fatalf("unexpected suggestion %+v", s)
+	}
+	if s.Rule.Replacement != ":slug" {
+		t.Fatalf("expected slug rule, got %+v", s.Rule)
+	}
+	if NormalizePath("/blog/another-post", []PathRule{s.Rule}) != "/blog/:slug" {
+		t.Fatalf("suggested rule %q does not collapse slugs", s.Rule.Pattern)
+	}
+
+	if s.Rule.Prefix != "/blog/" {
+		t.Fatalf("expected the rule scoped to /blog/, got %+v", s.Rule)
+	}
+	if got := NormalizePath("/about/our-team", []PathRule{s.Rule}); got != "/about/our-team" {
+		t.Fatalf("slug rule for /blog/ rewrote an unrelated page: %q", got)
+	}
+
+	// Once the rule is accepted, nothing further is suggested.
+	if again := SuggestPathRules(pages, append(DefaultPathRules, s.Rule), 20); len(again) != 0 {
+		t.Fatalf("expected no suggestions after accepting rule, got %+v", again)
+	}
+}
@@ -0,0 +1,90 @@
+//go:build postgres
+
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+// Run with: CLICKNEST_TEST_POSTGRES_URL=postgres://... go test -tags postgres ./internal/storage
+func newTestPostgres(t *testing.T) *SQLite {
+	t.Helper()
+	url := os.Getenv("CLICKNEST_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("CLICKNEST_TEST_POSTGRES_URL not set")
+	}
+	enc, err := NewEncryptor(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	db, err := NewPostgres(url, enc)
+	if err != nil {
+		t.Fatalf("NewPostgres: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.RollbackMigration("001_schema.sql"); err != nil {
+			t.Errorf("RollbackMigration: %v", err)
+		}
+		db.Close()
+	})
+	return db
+}
+
+func TestPostgres_ProjectsAndSettings(t *testing.T) {
+	ctx := context.Background()
+	db := newTestPostgres(t)
+
+	p, err := db.CreateProject(ctx, "proj-1", "My App")
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	got, err := db.GetProjectByAPIKey(ctx, p.APIKey)
+	if err != nil || got.ID != "proj-1" {
+		t.Fatalf("GetProjectByAPIKey = %+v, %v", got, err)
+	}
+
+	if err := db.SetGrowthSetting(ctx, p.ID, "k", "v1"); err != nil {
+		t.Fatalf("SetGrowthSetting: %v", err)
+	}
+	if err := db.SetGrowthSetting(ctx, p.ID, "k", "v2"); err != nil {
+		t.Fatalf("SetGrowthSetting upsert: %v", err)
+	}
+	if v, err := db.GetGrowthSetting(ctx, p.ID, "k"); err != nil || v != "v2" {
+		t.Fatalf("GetGrowthSetting = %q, %v", v, err)
+	}
+}
+
+func TestPostgres_UsersAndMembers(t *testing.T) {
+	ctx := context.Background()
+	db := newTestPostgres(t)
+
+	p, err := db.CreateProject(ctx, "proj-1", "My App")
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	u, err := db.CreateUser(ctx, "a@example.com", "hash")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	// INSERT OR IGNORE is rewritten to ON CONFLICT DO NOTHING, so adding the
+	// same member twice must not fail.
+	for i := 0; i < 2; i++ {
+		if err := db.AddProjectMember(ctx, u.ID, p.ID, "owner"); err != nil {
+			t.Fatalf("AddProjectMember #%d: %v", i+1, err)
+		}
+	}
+	if n, err := db.CountUsers(ctx); err != nil || n != 1 {
+		t.Fatalf("CountUsers = %d, %v", n, err)
+	}
+
+	if err := db.CreateFeatureFlag(ctx, FeatureFlag{ID: "f1", ProjectID: p.ID, Key: "beta", Name: "Beta", Enabled: true, RolloutPercentage: 50}); err != nil {
+		t.Fatalf("CreateFeatureFlag: %v", err)
+	}
+	flags, err := db.ListFeatureFlags(ctx, p.ID)
+	if err != nil || len(flags) != 1 || !flags[0].Enabled || flags[0].CreatedAt.After(time.Now().Add(time.Minute)) {
+		t.Fatalf("ListFeatureFlags = %+v, %v", flags, err)
+	}
+}
@@ -0,0 +1,32 @@
+package storage
+
+import "testing"
+
+func TestRebindPostgres(t *testing.T) {
+	cases := map[string]string{
+		`SELECT id FROM projects WHERE id = ? AND api_key = ?`:                        `SELECT id FROM projects WHERE id = $1 AND api_key = $2`,
+		`SELECT 'what?' FROM t WHERE a = ?`:                                           `SELECT 'what?' FROM t WHERE a = $1`,
+		`UPDATE t SET updated_at = datetime('now') WHERE id = ?`:                      `UPDATE t SET updated_at = CURRENT_TIMESTAMP WHERE id = $1`,
+		`SELECT 1 FROM oauth_state WHERE created_at > datetime('now', '-10 minutes')`: `SELECT 1 FROM oauth_state WHERE created_at > (CURRENT_TIMESTAMP + INTERVAL '-10 minutes')`,
+		`INSERT OR IGNORE INTO project_members (user_id, project_id) VALUES (?, ?)`:   `INSERT INTO project_members (user_id, project_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+		`INSERT INTO segments (id, name) VALUES (lower(hex(randomblob(16))), ?)`:      `INSERT INTO segments (id, name) VALUES (md5(random()::text || clock_timestamp()::text), $1)`,
+	}
+	for in, want := range cases {
+		if got := rebindPostgres(in); got != want {
+			t.Errorf("rebindPostgres(%q)\n got %q\nwant %q", in, got, want)
+		}
+	}
+}
+
+func TestIsPostgresURL(t *testing.T) {
+	for url, want := range map[string]bool{
+		"postgres://u:p@localhost/clicknest": true,
+		"postgresql://localhost/clicknest":   true,
+		"":                                   false,
+		"/var/lib/clicknest/clicknest.db":    false,
+	} {
+		if got := IsPostgresURL(url); got != want {
+			t.Errorf("IsPostgresURL(%q) = %v, want %v", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+)
+
+// Promoted properties are hot property keys whose values are copied into the
+// indexed event_properties table as events arrive, so PropertyKey filters on
+// them become an index lookup instead of a json_extract_string scan. Keys
+// that aren't promoted are still filtered through the JSON.
+
+// Bounds on a project's promoted properties: each one adds a row per event.
+const (
+	MaxPromotedProperties = 20
+	maxPromotedKey        = 128
+)
+
+// ValidatePromotedProperties checks a project's promoted property keys.
+func ValidatePromotedProperties(keys []string) error {
+	if len(keys) > MaxPromotedProperties {
+		return fmt.Errorf("at most %d promoted properties are allowed", MaxPromotedProperties)
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k == "" {
+			return fmt.Errorf("promoted property key is required")
+		}
+		if len(k) > maxPromotedKey {
+			return fmt.Errorf("promoted property key is longer than %d bytes", maxPromotedKey)
+		}
+		if seen[k] {
+			return fmt.Errorf("duplicate promoted property %q", k)
+		}
+		seen[k] = true
+	}
+	return nil
+}
+
+// PromotedProperties returns the project's promoted property keys, sorted.
+// The keys are cached; the lock is held while loading so a load can't race
+// SetPromotedProperties and cache a stale set.
+func (d *DuckDB) PromotedProperties(ctx context.Context, projectID string) ([]string, error) {
+	d.promotedMu.Lock()
+	defer d.promotedMu.Unlock()
+	if keys, ok := d.promoted[projectID]; ok {
+		return keys, nil
+	}
+
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT key FROM promoted_properties WHERE project_id = ? ORDER BY key`, projectID)
+	if err != nil {
+		return nil, fmt.Errorf("querying promoted properties: %w", err)
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, fmt.Errorf("scanning promoted property: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	d.promoted[projectID] = keys
+	return keys, nil
+}
+
+// SetPromotedProperties replaces the project's promoted property keys.
+// Newly promoted keys are backfilled from existing events; dropped keys have
+// their copied values removed.
+func (d *DuckDB) SetPromotedProperties(ctx context.Context, projectID string, keys []string) error {
+	if err := ValidatePromotedProperties(keys); err != nil {
+		return err
+	}
+	current, err := d.PromotedProperties(ctx, projectID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, k := range current {
+		if slices.Contains(keys, k) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM promoted_properties WHERE project_id = ? AND key = ?`, projectID, k); err != nil {
+			return fmt.Errorf("demoting property %q: %w", k, err)
+		}
+		if _, err := tx.ExecContext(ctx,
+			`DELETE FROM event_properties WHERE project_id = ? AND key = ?`, projectID, k); err != nil {
+			return fmt.Errorf("dropping values of property %q: %w", k, err)
+		}
+	}
+	for _, k := range keys {
+		if slices.Contains(current, k) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO promoted_properties (project_id, key) VALUES (?, ?)`, projectID, k); err != nil {
+			return fmt.Errorf("promoting property %q: %w", k, err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO event_properties (project_id, key, value, event_id)
+			SELECT project_id, ?, value, id FROM (
+				SELECT project_id, id, json_extract_string(properties, '$.' || ?) AS value
+				FROM events WHERE project_id = ?
+			) WHERE value IS NOT NULL
+		`, k, k, projectID); err != nil {
+			return fmt.Errorf("backfilling property %q: %w", k, err)
+		}
+	}
+
+	d.promotedMu.Lock()
+	defer d.promotedMu.Unlock()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	delete(d.promoted, projectID)
+	return nil
+}
+
+// propertyPromoted reports whether key is promoted for the project. Lookup
+// errors report false, which falls back to the always-correct JSON filter.
+func (d *DuckDB) propertyPromoted(ctx context.Context, projectID, key string) bool {
+	keys, err := d.PromotedProperties(ctx, projectID)
+	return err == nil && slices.Contains(keys, key)
+}
+
+// insertPromotedProperties copies the promoted properties of just-inserted
+// events into event_properties. Values are extracted by DuckDB from the same
+// JSON that was inserted, so they match json_extract_string exactly.
+func (d *DuckDB) insertPromotedProperties(ctx context.Context, tx *sql.Tx, events []Event, ids []string, props []string) error {
+	var stmt *sql.Stmt
+	for i, e := range events {
+		keys, err := d.PromotedProperties(ctx, e.ProjectID)
+		if err != nil {
+			return err
+		}
+		if len(keys) == 0 || len(e.Properties) == 0 {
+			continue
+		}
+		if stmt == nil {
+			stmt, err = tx.PrepareContext(ctx, `
+				INSERT INTO event_properties (project_id, key, value, event_id)
+				SELECT ?, ?, value, ? FROM (
+					SELECT json_extract_string(?::JSON, '$.' || ?) AS value
+				) WHERE value IS NOT NULL
+			`)
+			if err != nil {
+				return fmt.Errorf("preparing promoted property statement: %w", err)
+			}
+			defer stmt.Close()
+		}
+		for _, k := range keys {
+			if _, ok := e.Properties[k]; !ok {
+				continue
+			}
+			if _, err := stmt.ExecContext(ctx, e.ProjectID, k, ids[i], props[i], k); err != nil {
+				return fmt.Errorf("inserting promoted property %q: %w", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// syncPromotedProperties recopies one event's promoted properties after its
+// properties changed.
+func (d *DuckDB) syncPromotedProperties(ctx context.Context, projectID, id string) error {
+	keys, err := d.PromotedProperties(ctx, projectID)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("beginning transaction: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM event_properties WHERE project_id = ? AND event_id = ?`, projectID, id); err != nil {
+		return fmt.Errorf("clearing promoted properties: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO event_properties (project_id, key, value, event_id)
+		SELECT project_id, key, value, id FROM (
+			SELECT e.project_id, p.key, e.id, json_extract_string(e.properties, '$.' || p.key) AS value
+			FROM events e JOIN promoted_properties p ON p.project_id = e.project_id
+			WHERE e.project_id = ? AND e.id = ?
+		) WHERE value IS NOT NULL
+	`, projectID, id); err != nil {
+		return fmt.Errorf("copying promoted properties: %w", err)
+	}
+	return tx.Commit()
+}
+
+// deletePromotedProperties removes the copied values of the project's events
+// matching where (without the keyword), ahead of deleting those events in
+// the same transaction. The matching IDs are captured in a temp table first,
+// since where may itself filter through event_properties, and the returned
+// clause and args select exactly those events for the caller's DELETE.
+func (d *DuckDB) deletePromotedProperties(ctx context.Context, tx *sql.Tx, projectID, where string, args []any) (string, []any, error) {
+	keys, err := d.PromotedProperties(ctx, projectID)
+	if err != nil || len(keys) == 0 {
+		return where, args, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`CREATE OR REPLACE TEMP TABLE deleting_events AS SELECT id FROM events WHERE `+where, args...); err != nil {
+		return "", nil, fmt.Errorf("collecting events to delete: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM event_properties WHERE project_id = ? AND event_id IN (SELECT id FROM deleting_events)`,
+		projectID); err != nil {
+		return "", nil, fmt.Errorf("deleting promoted properties: %w", err)
+	}
+	return "project_id = ? AND id IN (SELECT id FROM deleting_events)", []any{projectID}, nil
+}
+
+// promotedPropertyClause filters on a promoted property through the
+// event_properties index. It takes the project ID, key and value.
+const promotedPropertyClause = "id IN (SELECT event_id FROM event_properties WHERE project_id = ? AND key = ? AND value = ?)"
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestPromotedProperty_FiltersThroughIndex(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+	ev := func(session string, props map[string]any) Event {
+		e := testEvent("p1", session, "pageview", "/", now)
+		e.Properties = props
+		return e
+	}
+	insert := func(events ...Event) {
+		t.Helper()
+		if err := db.InsertEvents(ctx, events); err != nil {
+			t.Fatalf("InsertEvents: %v", err)
+		}
+	}
+	sessions := func(key, value string) []string {
+		t.Helper()
+		events, err := db.QueryEvents(ctx, EventFilter{ProjectID: "p1", PropertyKey: key, PropertyValue: value})
+		if err != nil {
+			t.Fatalf("QueryEvents: %v", err)
+		}
+		var out []string
+		for _, e := range events {
+			out = append(out, e.SessionID)
+		}
+		slices.Sort(out)
+		return out
+	}
+
+	// Existing events are backfilled when the property is promoted.
+	insert(ev("old-pro", map[string]any{"plan": "pro", "seats": 5}), ev("old-free", map[string]any{"plan": "free"}), ev("none", nil))
+	if err := db.SetPromotedProperties(ctx, "p1", []string{"plan", "seats"}); err != nil {
+		t.Fatalf("SetPromotedProperties: %v", err)
+	}
+	if keys, _ := db.PromotedProperties(ctx, "p1"); !slices.Equal(keys, []string{"plan", "seats"}) {
+		t.Fatalf("expected plan and seats promoted, got %v", keys)
+	}
+	// New events are indexed as they are inserted.
+	other := ev("other-project", map[string]any{"plan": "pro"})
+	other.ProjectID = "p2"
+	insert(ev("new-pro", map[string]any{"plan": "pro"}), other)
+	if got := sessions("plan", "pro"); !slices.Equal(got, []string{"new-pro", "old-pro"}) {
+		t.Fatalf("plan=pro: got %v", got)
+	}
+	if got := sessions("seats", "5"); !slices.Equal(got, []string{"old-pro"}) {
+		t.Fatalf("numeric values should match like the JSON filter: got %v", got)
+	}
+
+	// Patching properties moves the event between values.
+	events, _ := db.QueryEvents(ctx, EventFilter{ProjectID: "p1", SessionID: "old-free"})
+	if ok, err := db.MergeEventProperties(ctx, "p1", events[0].ID, map[string]any{"plan": "pro"}); !ok || err != nil {
+		t.Fatalf("MergeEventProperties: %v %v", ok, err)
+	}
+	if got := sessions("plan", "pro"); !slices.Equal(got, []string{"new-pro", "old-free", "old-pro"}) {
+		t.Fatalf("after patch, plan=pro: got %v", got)
+	}
+	if got := sessions("plan", "free"); len(got) != 0 {
+		t.Fatalf("after patch, plan=free: got %v", got)
+	}
+
+	// Deleted events drop out of the index.
+	if _, err := db.DeleteEvents(ctx, EventFilter{ProjectID: "p1", SessionID: "new-pro"}); err != nil {
+		t.Fatalf("DeleteEvents: %v", err)
+	}
+	var indexed int
+	if err := db.read.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM event_properties WHERE project_id = 'p1' AND key = 'plan'`).Scan(&indexed); err != nil {
+		t.Fatalf("counting index rows: %v", err)
+	}
+	if indexed != 2 {
+		t.Fatalf("expected 2 indexed plan values after delete, got %d", indexed)
+	}
+
+	// Demoting falls back to the JSON filter with the same results.
+	if err := db.SetPromotedProperties(ctx, "p1", nil); err != nil {
+		t.Fatalf("SetPromotedProperties: %v", err)
+	}
+	if got := sessions("plan", "pro"); !slices.Equal(got, []string{"old-free", "old-pro"}) {
+		t.Fatalf("demoted plan=pro: got %v", got)
+	}
+}
+
+func TestPromotedProperty_DeleteByPromotedKey(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC()
+	pro := testEvent("p1", "pro", "pageview", "/", now)
+	pro.Properties = map[string]any{"plan": "pro"}
+	free := testEvent("p1", "free", "pageview", "/", now)
+	free.Properties = map[string]any{"plan": "free"}
+	if err := db.InsertEvents(ctx, []Event{pro, free}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	if err := db.SetPromotedProperties(ctx, "p1", []string{"plan"}); err != nil {
+		t.Fatalf("SetPromotedProperties: %v", err)
+	}
+
+	// The filter itself reads event_properties, so the index rows must not be
+	// removed before the events they select.
+	n, err := db.DeleteEvents(ctx, EventFilter{ProjectID: "p1", PropertyKey: "plan", PropertyValue: "pro"})
+	if err != nil {
+		t.Fatalf("DeleteEvents: %v", err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 event deleted, got %d", n)
+	}
+	remaining, err := db.QueryEvents(ctx, EventFilter{ProjectID: "p1"})
+	if err != nil {
+		t.Fatalf("QueryEvents: %v", err)
+	}
+	if len(remaining) != 1 || remaining[0].SessionID != "free" {
+		t.Fatalf("expected only the free event to remain, got %+v", remaining)
+	}
+	var indexed int
+	if err := db.read.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM event_properties WHERE project_id = 'p1'`).Scan(&indexed); err != nil {
+		t.Fatalf("counting index rows: %v", err)
+	}
+	if indexed != 1 {
+		t.Fatalf("expected only the free event's index row to remain, got %d", indexed)
+	}
+}
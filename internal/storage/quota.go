@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// EventQuotaSetting is the growth setting key holding a project's monthly
+// event quota. Unset or 0 is unlimited.
+const EventQuotaSetting = "monthly_event_quota"
+
+// UsageMonth is the UTC calendar month usage at t counts toward, e.g.
+// "2026-10". Usage starts from zero each month.
+func UsageMonth(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// UsageMonthStart returns the start of the UTC month containing t.
+func UsageMonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// EventQuota returns the most events the project may ingest per month, or 0
+// for no limit.
+func (s *SQLite) EventQuota(ctx context.Context, projectID string) int64 {
+	v, _ := s.GetGrowthSetting(ctx, projectID, EventQuotaSetting)
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// SetEventQuota sets the project's monthly event quota; 0 removes it.
+func (s *SQLite) SetEventQuota(ctx context.Context, projectID string, quota int64) error {
+	v := ""
+	if quota > 0 {
+		v = strconv.FormatInt(quota, 10)
+	}
+	return s.SetGrowthSetting(ctx, projectID, EventQuotaSetting, v)
+}
+
+// MonthlyEventUsage returns how many events the project has ingested in the
+// month containing now.
+func (s *SQLite) MonthlyEventUsage(ctx context.Context, projectID string, now time.Time) (int64, error) {
+	var n int64
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(events), 0) FROM event_usage WHERE project_id = ? AND month = ?`,
+		projectID, UsageMonth(now),
+	).Scan(&n)
+	return n, err
+}
+
+// AddEventUsage adds n events to the project's usage for the month
+// containing now and returns the month's new total.
+func (s *SQLite) AddEventUsage(ctx context.Context, projectID string, now time.Time, n int64) (int64, error) {
+	if _, err := s.db.ExecContext(ctx, `
+		INSERT INTO event_usage (project_id, month, events) VALUES (?, ?, ?)
+		ON CONFLICT(project_id, month) DO UPDATE SET events = event_usage.events + excluded.events`,
+		projectID, UsageMonth(now), n,
+	); err != nil {
+		return 0, err
+	}
+	return s.MonthlyEventUsage(ctx, projectID, now)
+}
+
+// SetEventUsage replaces the project's usage for the month containing now,
+// seeding the counter when a quota starts being tracked mid-month.
+func (s *SQLite) SetEventUsage(ctx context.Context, projectID string, now time.Time, n int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO event_usage (project_id, month, events) VALUES (?, ?, ?)
+		ON CONFLICT(project_id, month) DO UPDATE SET events = excluded.events`,
+		projectID, UsageMonth(now), n,
+	)
+	return err
+}
+
+// CountReceivedEvents returns how many of the project's events are stored
+// with a received time at or after since, sampling and internal traffic
+// notwithstanding: what ingest usage would have counted.
+func (d *DuckDB) CountReceivedEvents(ctx context.Context, projectID string, since time.Time) (int64, error) {
+	var n int64
+	err := d.read.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM events WHERE project_id = ? AND received_at >= ?`, projectID, since,
+	).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,52 @@
+package storage
+
+import "context"
+
+// SampleRateProperty is the event property ingest records the project's
+// sample rate (0–1) under when it kept the event's session by sampling.
+// Events without it were stored unsampled and weigh 1.
+const SampleRateProperty = "$sample_rate"
+
+// ReservedProperty reports whether key is a property only ingest may set.
+// Clients can't send or patch these: they drive internal traffic filtering
+// and sample scaling.
+func ReservedProperty(key string) bool {
+	return key == InternalProperty || key == SampleRateProperty
+}
+
+// StripReservedProperties removes reserved keys a client sent in props.
+func StripReservedProperties(props map[string]any) {
+	delete(props, InternalProperty)
+	delete(props, SampleRateProperty)
+}
+
+// propertyPath is the JSON path of a top-level property key, quoted so keys
+// such as $sample_rate parse.
+func propertyPath(key string) string {
+	return `$."` + key + `"`
+}
+
+type sampleScalingKey struct{}
+
+// WithSampleScaling returns a context under which DuckDB count and trend
+// queries weight each event by the inverse of its sample rate, estimating
+// the totals sampling would have recorded.
+func WithSampleScaling(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sampleScalingKey{}, true)
+}
+
+// SampleScaled reports whether ctx asks for sample-scaled counts.
+func SampleScaled(ctx context.Context) bool {
+	v, _ := ctx.Value(sampleScalingKey{}).(bool)
+	return v
+}
+
+// countExpr returns the SQL aggregate counting events for ctx: COUNT(*), or
+// the rounded sum of inverse sample rates when scaling is on.
+func countExpr(ctx context.Context) string {
+	if !SampleScaled(ctx) {
+		return "COUNT(*)"
+	}
+	return "COALESCE(CAST(ROUND(SUM(1.0 / COALESCE(NULLIF(TRY_CAST(json_extract_string(properties, '" +
+		propertyPath(SampleRateProperty) + "') AS DOUBLE), 0), 1))) AS BIGINT), 0)"
+}
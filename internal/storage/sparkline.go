@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxSparklineDays bounds a sparkline's length; longer ranges keep their
+// most recent days.
+const maxSparklineDays = 92
+
+// sparklineDays returns the local calendar days from start to end, oldest
+// first, as strftime('%Y-%m-%d') renders them.
+func sparklineDays(ctx context.Context, start, end time.Time) []string {
+	loc := locationFrom(ctx)
+	last := end.In(loc)
+	first := start.In(loc)
+	if last.Sub(first) > maxSparklineDays*24*time.Hour {
+		first = last.AddDate(0, 0, -(maxSparklineDays - 1))
+	}
+	var days []string
+	for d := time.Date(first.Year(), first.Month(), first.Day(), 0, 0, 0, 0, loc); !d.After(last); d = d.AddDate(0, 0, 1) {
+		days = append(days, d.Format("2006-01-02"))
+	}
+	return days
+}
+
+// querySparklines counts the events matching where per key (keyExpr) and
+// local day, for the given keys only. Every key gets one count per day in the
+// range, zero-filled.
+func (d *DuckDB) querySparklines(ctx context.Context, keyExpr, where string, args []any, keys []string, start, end time.Time) (map[string][]int64, error) {
+	days := sparklineDays(ctx, start, end)
+	index := make(map[string]int, len(days))
+	for i, day := range days {
+		index[day] = i
+	}
+	lines := make(map[string][]int64, len(keys))
+	for _, k := range keys {
+		lines[k] = make([]int64, len(days))
+	}
+	if len(keys) == 0 || len(days) == 0 {
+		return lines, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(keys)), ", ")
+	for _, k := range keys {
+		args = append(args, k)
+	}
+	rows, err := d.read.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s AS key, strftime(%s, '%%Y-%%m-%%d') AS day, COUNT(*)
+		FROM events
+		WHERE %s AND %s IN (%s)
+		GROUP BY key, day
+	`, keyExpr, localTime(ctx, "timestamp", start, end), where, keyExpr, placeholders), args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying sparklines: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key, day string
+		var n int64
+		if err := rows.Scan(&key, &day, &n); err != nil {
+			return nil, fmt.Errorf("scanning sparkline row: %w", err)
+		}
+		if i, ok := index[day]; ok && lines[key] != nil {
+			lines[key][i] = n
+		}
+	}
+	return lines, rows.Err()
+}
+
+// AttachPageSparklines sets each page's Sparkline to its daily views over
+// start–end, grouping paths with rules as QueryTopPages does.
+func (d *DuckDB) AttachPageSparklines(ctx context.Context, projectID string, pages []PageStat, start, end time.Time, rules []PathRule) error {
+	keys := make([]string, len(pages))
+	for i, p := range pages {
+		keys[i] = p.Path
+	}
+	lines, err := d.querySparklines(ctx, pathExpr("url_path", rules),
+		"project_id = ? AND event_type = 'pageview' AND timestamp >= ? AND timestamp <= ?"+internalFilter(ctx),
+		[]any{projectID, start, end}, keys, start, end)
+	if err != nil {
+		return err
+	}
+	for i := range pages {
+		pages[i].Sparkline = lines[pages[i].Path]
+	}
+	return nil
+}
+
+// AttachEventSparklines sets each named event's Sparkline to its daily count
+// over start–end.
+func (d *DuckDB) AttachEventSparklines(ctx context.Context, projectID string, stats []EventNameStat, start, end time.Time) error {
+	keys := make([]string, len(stats))
+	for i, s := range stats {
+		keys[i] = s.Name
+	}
+	lines, err := d.querySparklines(ctx, "event_name",
+		"project_id = ? AND timestamp >= ? AND timestamp <= ?"+internalFilter(ctx),
+		[]any{projectID, start, end}, keys, start, end)
+	if err != nil {
+		return err
+	}
+	for i := range stats {
+		stats[i].Sparkline = lines[stats[i].Name]
+	}
+	return nil
+}
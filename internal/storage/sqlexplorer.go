@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// MaxSQLRows caps how many rows QuerySQL returns.
+const MaxSQLRows = 10000
+
+// ErrInvalidSQL is returned by QuerySQL for statements it refuses to run or
+// that DuckDB cannot parse or execute.
+var ErrInvalidSQL = errors.New("invalid sql")
+
+// sqlWriteKeyword catches statements that change data or the database even
+// before parsing, so they are refused with a clear reason. It is matched
+// against the query's code only (see sqlCode): a name like 'Delete account'
+// in a string literal is fine, and the parser refuses non-SELECTs anyway.
+var sqlWriteKeyword = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|ATTACH|DETACH|COPY|PRAGMA|INSTALL|LOAD)\b`)
+
+// sqlCode blanks out the string literals, quoted identifiers and comments in
+// query, leaving the keywords and names that make up the statement itself.
+func sqlCode(query string) string {
+	var b strings.Builder
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"':
+			// A doubled quote escapes itself and keeps the literal open.
+			for i++; i < len(query); i++ {
+				if query[i] == c {
+					if i+1 < len(query) && query[i+1] == c {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			b.WriteByte(' ')
+		case strings.HasPrefix(query[i:], "--"):
+			if n := strings.IndexByte(query[i:], '\n'); n >= 0 {
+				i += n
+			} else {
+				i = len(query)
+			}
+			b.WriteByte(' ')
+		case strings.HasPrefix(query[i:], "/*"):
+			if n := strings.Index(query[i+2:], "*/"); n >= 0 {
+				i += n + 3
+			} else {
+				i = len(query)
+			}
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// sqlDeniedFunctions are scalar functions that read the host rather than the
+// events table.
+var sqlDeniedFunctions = map[string]bool{
+	"getenv":          true,
+	"current_setting": true,
+	"read_text":       true,
+	"read_blob":       true,
+	"glob":            true,
+}
+
+// SQLResult is the output of an ad-hoc query: column names and rows of
+// JSON-ready values in column order.
+type SQLResult struct {
+	Columns   []string `json:"columns"`
+	Rows      [][]any  `json:"rows"`
+	Truncated bool     `json:"truncated"` // more than limit rows matched
+}
+
+// QuerySQL runs an ad-hoc read-only SELECT against the project's events.
+// The statement must be a single SELECT whose tables are only events (or
+// its own CTEs): it runs under a CTE named events holding just the
+// project's rows, so no other project's data is reachable. At most limit
+// rows (capped at MaxSQLRows) are returned. Cancel ctx to stop a runaway
+// query.
+func (d *DuckDB) QuerySQL(ctx context.Context, projectID, query string, limit int) (*SQLResult, error) {
+	query = strings.TrimRight(strings.TrimSpace(query), "; \t\n")
+	if query == "" {
+		return nil, fmt.Errorf("%w: empty statement", ErrInvalidSQL)
+	}
+	if m := sqlWriteKeyword.FindString(sqlCode(query)); m != "" {
+		return nil, fmt.Errorf("%w: %s is not allowed; only SELECT statements run", ErrInvalidSQL, strings.ToUpper(m))
+	}
+	query, err := d.checkReadOnlySelect(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxSQLRows {
+		limit = MaxSQLRows
+	}
+
+	wrapped := fmt.Sprintf("WITH events AS (SELECT * FROM main.events WHERE project_id = '%s') SELECT * FROM (%s) AS q LIMIT %d",
+		sqlEsc(projectID), query, limit+1)
+	rows, err := d.read.QueryContext(ctx, wrapped)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSQL, err)
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := &SQLResult{Columns: cols, Rows: [][]any{}}
+	for rows.Next() {
+		if len(result.Rows) == limit {
+			result.Truncated = true
+			break
+		}
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("scanning sql row: %w", err)
+		}
+		for i, v := range vals {
+			vals[i] = sqlJSONValue(v)
+		}
+		result.Rows = append(result.Rows, vals)
+	}
+	if err := rows.Err(); err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSQL, err)
+	}
+	return result, nil
+}
+
+// checkReadOnlySelect parses query with DuckDB and walks its syntax tree:
+// exactly one SELECT, reading only unqualified events or its own CTEs, with
+// no table functions (read_csv, glob, ...) or host-reading functions. It
+// returns the statement as DuckDB rebuilds it from the tree, free of
+// comments and semicolons, so it wraps safely.
+func (d *DuckDB) checkReadOnlySelect(ctx context.Context, query string) (string, error) {
+	var serialized string
+	if err := d.read.QueryRowContext(ctx,
+		"SELECT CAST(json_serialize_sql('"+sqlEsc(query)+"') AS VARCHAR)",
+	).Scan(&serialized); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSQL, err)
+	}
+	var parsed struct {
+		Error        bool              `json:"error"`
+		ErrorMessage string            `json:"error_message"`
+		Statements   []json.RawMessage `json:"statements"`
+	}
+	if err := json.Unmarshal([]byte(serialized), &parsed); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSQL, err)
+	}
+	if parsed.Error {
+		return "", fmt.Errorf("%w: %s", ErrInvalidSQL, parsed.ErrorMessage)
+	}
+	if len(parsed.Statements) != 1 {
+		return "", fmt.Errorf("%w: exactly one statement is allowed", ErrInvalidSQL)
+	}
+	var tree any
+	if err := json.Unmarshal(parsed.Statements[0], &tree); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSQL, err)
+	}
+
+	// CTE names the statement defines may be read, unless they shadow a
+	// real table or view: then which one a reference reaches depends on
+	// scope, so such names are refused outright.
+	relations, err := d.relationNames(ctx)
+	if err != nil {
+		return "", err
+	}
+	ctes := map[string]bool{}
+	walkSQLTree(tree, func(node map[string]any) {
+		if m, ok := node["cte_map"].(map[string]any); ok {
+			entries, _ := m["map"].([]any)
+			for _, e := range entries {
+				if entry, ok := e.(map[string]any); ok {
+					if key, ok := entry["key"].(string); ok {
+						ctes[strings.ToLower(key)] = true
+					}
+				}
+			}
+		}
+	})
+
+	var problem string
+	walkSQLTree(tree, func(node map[string]any) {
+		if problem != "" {
+			return
+		}
+		switch {
+		case node["type"] == "TABLE_FUNCTION":
+			problem = "table functions are not allowed"
+		case node["type"] == "BASE_TABLE":
+			name := strings.ToLower(fmt.Sprint(node["table_name"]))
+			if node["schema_name"] != "" || node["catalog_name"] != "" {
+				problem = "qualified table names are not allowed"
+			} else if name != "events" && (!ctes[name] || relations[name]) {
+				problem = fmt.Sprintf("table %q is not allowed; query events", name)
+			}
+		case node["class"] == "FUNCTION":
+			name := strings.ToLower(fmt.Sprint(node["function_name"]))
+			if sqlDeniedFunctions[name] || strings.HasPrefix(name, "read_") ||
+				node["schema"] != "" || node["catalog"] != "" {
+				problem = fmt.Sprintf("function %s is not allowed", name)
+			}
+		}
+	})
+	if problem != "" {
+		return "", fmt.Errorf("%w: %s", ErrInvalidSQL, problem)
+	}
+
+	var rebuilt string
+	if err := d.read.QueryRowContext(ctx,
+		"SELECT json_deserialize_sql(CAST('"+sqlEsc(serialized)+"' AS JSON))",
+	).Scan(&rebuilt); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSQL, err)
+	}
+	return rebuilt, nil
+}
+
+// relationNames returns the lower-cased names of every table and view in
+// the database, system views included.
+func (d *DuckDB) relationNames(ctx context.Context) (map[string]bool, error) {
+	rows, err := d.read.QueryContext(ctx,
+		`SELECT table_name FROM duckdb_tables() UNION SELECT view_name FROM duckdb_views()`)
+	if err != nil {
+		return nil, fmt.Errorf("listing relations: %w", err)
+	}
+	defer rows.Close()
+	names := map[string]bool{}
+	for rows.Next() {
+		var n string
+		if err := rows.Scan(&n); err != nil {
+			return nil, err
+		}
+		names[strings.ToLower(n)] = true
+	}
+	return names, rows.Err()
+}
+
+// walkSQLTree calls fn on every object in a json_serialize_sql tree.
+func walkSQLTree(v any, fn func(map[string]any)) {
+	switch t := v.(type) {
+	case map[string]any:
+		fn(t)
+		for _, child := range t {
+			walkSQLTree(child, fn)
+		}
+	case []any:
+		for _, child := range t {
+			walkSQLTree(child, fn)
+		}
+	}
+}
+
+// sqlJSONValue converts a scanned DuckDB value to one encoding/json can
+// write: bytes become strings and anything it can't marshal (NaN, maps
+// with non-string keys, ...) its printed form.
+func sqlJSONValue(v any) any {
+	switch t := v.(type) {
+	case nil, bool, string, int8, int16, int32, int64, uint8, uint16, uint32, uint64, time.Time:
+		return t
+	case []byte:
+		return string(t)
+	}
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	}
+	return v
+}
@@ -5,9 +5,12 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,6 +19,7 @@ type Project struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	APIKey      string    `json:"api_key"`
+	PublicID    string    `json:"public_id"` // non-secret, for project-scoped ingest URLs
 	CreatedAt   time.Time `json:"created_at"`
 }
 
@@ -26,15 +30,37 @@ type EventName struct {
 	UserName    *string  `json:"user_name,omitempty"`
 	SourceFile  *string  `json:"source_file,omitempty"`
 	Confidence  *float64 `json:"confidence,omitempty"`
+	Status      string   `json:"status"` // approved, pending, or rejected
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// Event name review statuses. Only approved AI names are shown in queries;
+// a user override is always shown regardless of status.
+const (
+	NameApproved = "approved"
+	NamePending  = "pending"
+	NameRejected = "rejected"
+)
+
+// DisplayName returns the name to show for the fingerprint, or "" when the
+// AI name is still awaiting review or was rejected.
+func (en *EventName) DisplayName() string {
+	if en.UserName != nil && *en.UserName != "" {
+		return *en.UserName
+	}
+	if en.Status != "" && en.Status != NameApproved {
+		return ""
+	}
+	return en.AIName
+}
+
 type LLMConfig struct {
-	ProjectID string  `json:"project_id"`
-	Provider  string  `json:"provider"`
-	APIKey    *string `json:"api_key,omitempty"`
-	Model     string  `json:"model"`
-	BaseURL   *string `json:"base_url,omitempty"`
+	ProjectID   string  `json:"project_id"`
+	Provider    string  `json:"provider"`
+	APIKey      *string `json:"api_key,omitempty"`
+	Model       string  `json:"model"`
+	BaseURL     *string `json:"base_url,omitempty"`
+	NamingStyle string  `json:"naming_style"` // sentence (default), snake_case, or dot.notation
 }
 
 type GitHubConnection struct {
@@ -46,9 +72,15 @@ type GitHubConnection struct {
 	LastSyncedAt  *time.Time `json:"last_synced_at,omitempty"`
 }
 
+// SQLite is the metadata store. It is backed by an SQLite file by default, or
+// by Postgres when opened with NewPostgres; queries are written for SQLite and
+// translated for Postgres by the driver wrapper in postgres.go.
 type SQLite struct {
-	db  *sql.DB
-	enc *Encryptor
+	db       *sql.DB
+	enc      *Encryptor
+	postgres bool
+
+	botFilters sync.Map // projectID → botFilterEntry
 }
 
 // NewSQLite opens a SQLite database at the given path and runs migrations.
@@ -74,6 +106,17 @@ func NewSQLite(path string, enc *Encryptor) (*SQLite, error) {
 	return &SQLite{db: db, enc: enc}, nil
 }
 
+// Postgres reports whether the store is backed by Postgres rather than a
+// local SQLite file.
+func (s *SQLite) Postgres() bool {
+	return s.postgres
+}
+
+// Encryptor returns the encryptor used for sensitive fields; it may be nil.
+func (s *SQLite) Encryptor() *Encryptor {
+	return s.enc
+}
+
 // --- Projects ---
 
 // CreateProject creates a new project with a generated API key.
@@ -82,23 +125,27 @@ func (s *SQLite) CreateProject(ctx context.Context, id, name string) (*Project,
 	if err != nil {
 		return nil, err
 	}
+	publicID, err := generatePublicID()
+	if err != nil {
+		return nil, err
+	}
 
 	_, err = s.db.ExecContext(ctx,
-		`INSERT INTO projects (id, name, api_key) VALUES (?, ?, ?)`,
-		id, name, apiKey,
+		`INSERT INTO projects (id, name, api_key, public_id) VALUES (?, ?, ?, ?)`,
+		id, name, apiKey, publicID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("inserting project: %w", err)
 	}
 
-	return &Project{ID: id, Name: name, APIKey: apiKey, CreatedAt: time.Now()}, nil
+	return &Project{ID: id, Name: name, APIKey: apiKey, PublicID: publicID, CreatedAt: time.Now()}, nil
 }
 
 func (s *SQLite) GetProject(ctx context.Context, id string) (*Project, error) {
 	var p Project
 	err := s.db.QueryRowContext(ctx,
-		`SELECT id, name, description, api_key, created_at FROM projects WHERE id = ?`, id,
-	).Scan(&p.ID, &p.Name, &p.Description, &p.APIKey, &p.CreatedAt)
+		`SELECT id, name, description, api_key, public_id, created_at FROM projects WHERE id = ?`, id,
+	).Scan(&p.ID, &p.Name, &p.Description, &p.APIKey, &p.PublicID, &p.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -108,8 +155,20 @@ func (s *SQLite) GetProject(ctx context.Context, id string) (*Project, error) {
 func (s *SQLite) GetProjectByAPIKey(ctx context.Context, apiKey string) (*Project, error) {
 	var p Project
 	err := s.db.QueryRowContext(ctx,
-		`SELECT id, name, description, api_key, created_at FROM projects WHERE api_key = ?`, apiKey,
-	).Scan(&p.ID, &p.Name, &p.Description, &p.APIKey, &p.CreatedAt)
+		`SELECT id, name, description, api_key, public_id, created_at FROM projects WHERE api_key = ?`, apiKey,
+	).Scan(&p.ID, &p.Name, &p.Description, &p.APIKey, &p.PublicID, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetProjectByPublicID looks up a project by its public ID.
+func (s *SQLite) GetProjectByPublicID(ctx context.Context, publicID string) (*Project, error) {
+	var p Project
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id, name, description, api_key, public_id, created_at FROM projects WHERE public_id = ?`, publicID,
+	).Scan(&p.ID, &p.Name, &p.Description, &p.APIKey, &p.PublicID, &p.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -117,7 +176,7 @@ func (s *SQLite) GetProjectByAPIKey(ctx context.Context, apiKey string) (*Projec
 }
 
 func (s *SQLite) ListProjects(ctx context.Context) ([]Project, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, name, description, api_key, created_at FROM projects ORDER BY created_at DESC`)
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, description, api_key, public_id, created_at FROM projects ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -126,7 +185,7 @@ func (s *SQLite) ListProjects(ctx context.Context) ([]Project, error) {
 	var projects []Project
 	for rows.Next() {
 		var p Project
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.APIKey, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.APIKey, &p.PublicID, &p.CreatedAt); err != nil {
 			return nil, err
 		}
 		projects = append(projects, p)
@@ -147,10 +206,10 @@ func (s *SQLite) UpdateProjectDescription(ctx context.Context, id, description s
 func (s *SQLite) GetEventName(ctx context.Context, projectID, fingerprint string) (*EventName, error) {
 	var en EventName
 	err := s.db.QueryRowContext(ctx,
-		`SELECT fingerprint, project_id, ai_name, user_name, source_file, confidence, created_at
+		`SELECT fingerprint, project_id, ai_name, user_name, source_file, confidence, status, created_at
 		 FROM event_names WHERE project_id = ? AND fingerprint = ?`,
 		projectID, fingerprint,
-	).Scan(&en.Fingerprint, &en.ProjectID, &en.AIName, &en.UserName, &en.SourceFile, &en.Confidence, &en.CreatedAt)
+	).Scan(&en.Fingerprint, &en.ProjectID, &en.AIName, &en.UserName, &en.SourceFile, &en.Confidence, &en.Status, &en.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -169,7 +228,7 @@ func (s *SQLite) BatchGetEventNames(ctx context.Context, projectID string, finge
 		args = append(args, fp)
 	}
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT fingerprint, project_id, ai_name, user_name, source_file, confidence, created_at
+		`SELECT fingerprint, project_id, ai_name, user_name, source_file, confidence, status, created_at
 		 FROM event_names WHERE project_id = ? AND fingerprint IN (`+placeholders+`)`, args...)
 	if err != nil {
 		return nil, err
@@ -178,7 +237,7 @@ func (s *SQLite) BatchGetEventNames(ctx context.Context, projectID string, finge
 	result := make(map[string]*EventName, len(fingerprints))
 	for rows.Next() {
 		var en EventName
-		if err := rows.Scan(&en.Fingerprint, &en.ProjectID, &en.AIName, &en.UserName, &en.SourceFile, &en.Confidence, &en.CreatedAt); err != nil {
+		if err := rows.Scan(&en.Fingerprint, &en.ProjectID, &en.AIName, &en.UserName, &en.SourceFile, &en.Confidence, &en.Status, &en.CreatedAt); err != nil {
 			return nil, err
 		}
 		result[en.Fingerprint] = &en
@@ -187,16 +246,133 @@ func (s *SQLite) BatchGetEventNames(ctx context.Context, projectID string, finge
 }
 
 func (s *SQLite) SetEventName(ctx context.Context, en EventName) error {
+	status := en.Status
+	if status == "" {
+		status = NameApproved
+	}
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO event_names (fingerprint, project_id, ai_name, source_file, confidence)
-		 VALUES (?, ?, ?, ?, ?)
+		`INSERT INTO event_names (fingerprint, project_id, ai_name, source_file, confidence, status)
+		 VALUES (?, ?, ?, ?, ?, ?)
 		 ON CONFLICT (fingerprint, project_id)
-		 DO UPDATE SET ai_name = excluded.ai_name, source_file = excluded.source_file, confidence = excluded.confidence`,
-		en.Fingerprint, en.ProjectID, en.AIName, en.SourceFile, en.Confidence,
+		 DO UPDATE SET ai_name = excluded.ai_name, source_file = excluded.source_file, confidence = excluded.confidence, status = excluded.status`,
+		en.Fingerprint, en.ProjectID, en.AIName, en.SourceFile, en.Confidence, status,
 	)
 	return err
 }
 
+// NameReviewSetting is the growth setting key that, when "true", holds new AI
+// names for human review before they are used.
+const NameReviewSetting = "name_review"
+
+// NameReviewEnabled reports whether a project requires AI names to be approved.
+func (s *SQLite) NameReviewEnabled(ctx context.Context, projectID string) bool {
+	v, _ := s.GetGrowthSetting(ctx, projectID, NameReviewSetting)
+	return v == "true"
+}
+
+// NameConfidenceSetting is the growth setting key for the AI confidence (0–1)
+// below which a name is flagged as low confidence in the names list.
+const NameConfidenceSetting = "name_confidence_threshold"
+
+// DefaultNameConfidenceThreshold applies when a project hasn't set one.
+const DefaultNameConfidenceThreshold = 0.5
+
+// NameConfidenceThreshold returns the project's low-confidence threshold.
+func (s *SQLite) NameConfidenceThreshold(ctx context.Context, projectID string) float64 {
+	v, _ := s.GetGrowthSetting(ctx, projectID, NameConfidenceSetting)
+	t, err := strconv.ParseFloat(v, 64)
+	if err != nil || t < 0 || t > 1 {
+		return DefaultNameConfidenceThreshold
+	}
+	return t
+}
+
+// SampleRateSetting is the growth setting key for the fraction (0–1) of
+// sessions a project keeps at ingest. Unset means keep everything.
+const SampleRateSetting = "sample_rate"
+
+// SampleRate returns the project's ingest sample rate, defaulting to 1.
+func (s *SQLite) SampleRate(ctx context.Context, projectID string) float64 {
+	v, _ := s.GetGrowthSetting(ctx, projectID, SampleRateSetting)
+	rate, err := strconv.ParseFloat(v, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		return 1
+	}
+	return rate
+}
+
+// PrimaryEventSetting is the growth setting key for the event name a project
+// treats as its north star (e.g. "Signup"). Unset means no primary event.
+const PrimaryEventSetting = "primary_event"
+
+// PrimaryEvent returns the project's primary event name, or "" when unset.
+func (s *SQLite) PrimaryEvent(ctx context.Context, projectID string) string {
+	v, _ := s.GetGrowthSetting(ctx, projectID, PrimaryEventSetting)
+	return strings.TrimSpace(v)
+}
+
+// ListEventNamesByStatus returns a project's names with the given review
+// status, oldest first so the review queue is worked in arrival order.
+func (s *SQLite) ListEventNamesByStatus(ctx context.Context, projectID, status string) ([]EventName, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT fingerprint, project_id, ai_name, user_name, source_file, confidence, status, created_at
+		 FROM event_names WHERE project_id = ? AND status = ? ORDER BY created_at ASC`,
+		projectID, status,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []EventName
+	for rows.Next() {
+		var en EventName
+		if err := rows.Scan(&en.Fingerprint, &en.ProjectID, &en.AIName, &en.UserName, &en.SourceFile, &en.Confidence, &en.Status, &en.CreatedAt); err != nil {
+			return nil, err
+		}
+		names = append(names, en)
+	}
+	return names, rows.Err()
+}
+
+// SetEventNameStatus updates the review status of a name. Returns
+// sql.ErrNoRows if the fingerprint has no name.
+func (s *SQLite) SetEventNameStatus(ctx context.Context, projectID, fingerprint, status string) error {
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE event_names SET status = ? WHERE project_id = ? AND fingerprint = ?`,
+		status, projectID, fingerprint,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteEventName removes a cached name so the fingerprint is named again.
+func (s *SQLite) DeleteEventName(ctx context.Context, projectID, fingerprint string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM event_names WHERE project_id = ? AND fingerprint = ?`,
+		projectID, fingerprint,
+	)
+	return err
+}
+
+// EventNameTaken reports whether another fingerprint in the project already
+// displays the given name (AI or user override), compared case-insensitively.
+func (s *SQLite) EventNameTaken(ctx context.Context, projectID, name, excludeFingerprint string) (bool, error) {
+	var n int
+	err := s.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM event_names
+		 WHERE project_id = ? AND fingerprint != ? AND status != 'rejected'
+		   AND (lower(ai_name) = lower(?) OR lower(COALESCE(user_name, '')) = lower(?))`,
+		projectID, excludeFingerprint, name, name,
+	).Scan(&n)
+	return n > 0, err
+}
+
 // ClearAIEventNames deletes all AI-generated names (preserving user overrides)
 // for a project so they can be regenerated with new context.
 func (s *SQLite) ClearAIEventNames(ctx context.Context, projectID string) error {
@@ -218,7 +394,7 @@ func (s *SQLite) OverrideEventName(ctx context.Context, projectID, fingerprint,
 
 func (s *SQLite) ListEventNames(ctx context.Context, projectID string) ([]EventName, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT fingerprint, project_id, ai_name, user_name, source_file, confidence, created_at
+		`SELECT fingerprint, project_id, ai_name, user_name, source_file, confidence, status, created_at
 		 FROM event_names WHERE project_id = ? ORDER BY created_at DESC`,
 		projectID,
 	)
@@ -230,7 +406,7 @@ func (s *SQLite) ListEventNames(ctx context.Context, projectID string) ([]EventN
 	var names []EventName
 	for rows.Next() {
 		var en EventName
-		if err := rows.Scan(&en.Fingerprint, &en.ProjectID, &en.AIName, &en.UserName, &en.SourceFile, &en.Confidence, &en.CreatedAt); err != nil {
+		if err := rows.Scan(&en.Fingerprint, &en.ProjectID, &en.AIName, &en.UserName, &en.SourceFile, &en.Confidence, &en.Status, &en.CreatedAt); err != nil {
 			return nil, err
 		}
 		names = append(names, en)
@@ -238,14 +414,40 @@ func (s *SQLite) ListEventNames(ctx context.Context, projectID string) ([]EventN
 	return names, rows.Err()
 }
 
+// CountEventNamesByDay returns how many names were generated for a project
+// on each day between start and end, keyed by "2006-01-02" in UTC.
+func (s *SQLite) CountEventNamesByDay(ctx context.Context, projectID string, start, end time.Time) (map[string]int64, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT created_at FROM event_names WHERE project_id = ?`,
+		projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var created time.Time
+		if err := rows.Scan(&created); err != nil {
+			return nil, err
+		}
+		if created.Before(start) || created.After(end) {
+			continue
+		}
+		counts[created.UTC().Format("2006-01-02")]++
+	}
+	return counts, rows.Err()
+}
+
 // --- LLM Config ---
 
 func (s *SQLite) GetLLMConfig(ctx context.Context, projectID string) (*LLMConfig, error) {
 	var c LLMConfig
 	err := s.db.QueryRowContext(ctx,
-		`SELECT project_id, provider, api_key, model, base_url FROM llm_config WHERE project_id = ?`,
+		`SELECT project_id, provider, api_key, model, base_url, naming_style FROM llm_config WHERE project_id = ?`,
 		projectID,
-	).Scan(&c.ProjectID, &c.Provider, &c.APIKey, &c.Model, &c.BaseURL)
+	).Scan(&c.ProjectID, &c.Provider, &c.APIKey, &c.Model, &c.BaseURL, &c.NamingStyle)
 	if err != nil {
 		// Fall back to environment defaults (used by cloud instances).
 		return defaultLLMConfig(projectID)
@@ -290,12 +492,16 @@ func (s *SQLite) SetLLMConfig(ctx context.Context, c LLMConfig) error {
 	if err != nil {
 		return fmt.Errorf("encrypting llm api key: %w", err)
 	}
+	namingStyle := c.NamingStyle
+	if namingStyle == "" {
+		namingStyle = "sentence"
+	}
 	_, err = s.db.ExecContext(ctx,
-		`INSERT INTO llm_config (project_id, provider, api_key, model, base_url)
-		 VALUES (?, ?, ?, ?, ?)
+		`INSERT INTO llm_config (project_id, provider, api_key, model, base_url, naming_style)
+		 VALUES (?, ?, ?, ?, ?, ?)
 		 ON CONFLICT (project_id)
-		 DO UPDATE SET provider = excluded.provider, api_key = excluded.api_key, model = excluded.model, base_url = excluded.base_url`,
-		c.ProjectID, c.Provider, encKey, c.Model, c.BaseURL,
+		 DO UPDATE SET provider = excluded.provider, api_key = excluded.api_key, model = excluded.model, base_url = excluded.base_url, naming_style = excluded.naming_style`,
+		c.ProjectID, c.Provider, encKey, c.Model, c.BaseURL, namingStyle,
 	)
 	return err
 }
@@ -496,17 +702,25 @@ func (s *SQLite) UpsertSourceIndex(ctx context.Context, projectID, filePath, com
 // --- Funnels ---
 
 type Funnel struct {
-	ID        string    `json:"id"`
-	ProjectID string    `json:"project_id"`
-	Name      string    `json:"name"`
-	Steps     string    `json:"steps"`
+	ID        string `json:"id"`
+	ProjectID string `json:"project_id"`
+	Name      string `json:"name"`
+	Steps     string `json:"steps"`
+	// WindowHours is the default conversion window for the funnel's
+	// results; 0 means unbounded.
+	WindowHours int `json:"window_hours"`
+	// Mode is FunnelOrdered or FunnelUnordered.
+	Mode      string    `json:"mode"`
 	CreatedAt time.Time `json:"created_at"`
 }
 
 func (s *SQLite) CreateFunnel(ctx context.Context, f Funnel) error {
+	if f.Mode == "" {
+		f.Mode = FunnelOrdered
+	}
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO funnels (id, project_id, name, steps) VALUES (?, ?, ?, ?)`,
-		f.ID, f.ProjectID, f.Name, f.Steps,
+		`INSERT INTO funnels (id, project_id, name, steps, window_hours, mode) VALUES (?, ?, ?, ?, ?, ?)`,
+		f.ID, f.ProjectID, f.Name, f.Steps, f.WindowHours, f.Mode,
 	)
 	return err
 }
@@ -514,9 +728,9 @@ func (s *SQLite) CreateFunnel(ctx context.Context, f Funnel) error {
 func (s *SQLite) GetFunnel(ctx context.Context, projectID, id string) (*Funnel, error) {
 	var f Funnel
 	err := s.db.QueryRowContext(ctx,
-		`SELECT id, project_id, name, steps, created_at FROM funnels WHERE project_id = ? AND id = ?`,
+		`SELECT id, project_id, name, steps, window_hours, mode, created_at FROM funnels WHERE project_id = ? AND id = ?`,
 		projectID, id,
-	).Scan(&f.ID, &f.ProjectID, &f.Name, &f.Steps, &f.CreatedAt)
+	).Scan(&f.ID, &f.ProjectID, &f.Name, &f.Steps, &f.WindowHours, &f.Mode, &f.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -525,7 +739,7 @@ func (s *SQLite) GetFunnel(ctx context.Context, projectID, id string) (*Funnel,
 
 func (s *SQLite) ListFunnels(ctx context.Context, projectID string) ([]Funnel, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, project_id, name, steps, created_at FROM funnels WHERE project_id = ? ORDER BY created_at DESC`,
+		`SELECT id, project_id, name, steps, window_hours, mode, created_at FROM funnels WHERE project_id = ? ORDER BY created_at DESC`,
 		projectID,
 	)
 	if err != nil {
@@ -536,7 +750,7 @@ func (s *SQLite) ListFunnels(ctx context.Context, projectID string) ([]Funnel, e
 	var funnels []Funnel
 	for rows.Next() {
 		var f Funnel
-		if err := rows.Scan(&f.ID, &f.ProjectID, &f.Name, &f.Steps, &f.CreatedAt); err != nil {
+		if err := rows.Scan(&f.ID, &f.ProjectID, &f.Name, &f.Steps, &f.WindowHours, &f.Mode, &f.CreatedAt); err != nil {
 			return nil, err
 		}
 		funnels = append(funnels, f)
@@ -544,6 +758,25 @@ func (s *SQLite) ListFunnels(ctx context.Context, projectID string) ([]Funnel, e
 	return funnels, rows.Err()
 }
 
+// UpdateFunnel replaces a funnel's definition, keeping its ID and creation
+// time. It returns sql.ErrNoRows if the funnel doesn't exist.
+func (s *SQLite) UpdateFunnel(ctx context.Context, f Funnel) error {
+	if f.Mode == "" {
+		f.Mode = FunnelOrdered
+	}
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE funnels SET name = ?, steps = ?, window_hours = ?, mode = ? WHERE project_id = ? AND id = ?`,
+		f.Name, f.Steps, f.WindowHours, f.Mode, f.ProjectID, f.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (s *SQLite) DeleteFunnel(ctx context.Context, projectID, id string) error {
 	_, err := s.db.ExecContext(ctx,
 		`DELETE FROM funnels WHERE project_id = ? AND id = ?`,
@@ -629,21 +862,106 @@ type FeatureFlag struct {
 	Name              string    `json:"name"`
 	Enabled           bool      `json:"enabled"`
 	RolloutPercentage int       `json:"rollout_percentage"`
+	Conditions        string    `json:"conditions"`        // JSON array of FlagCondition
+	Payload           string    `json:"payload,omitempty"` // JSON value returned when the flag is on
+	Variants          string    `json:"variants"`          // JSON array of FlagVariant
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
 
+// FlagCondition is one feature flag targeting rule, checked against the
+// properties a client passes when evaluating flags.
+type FlagCondition struct {
+	Property string `json:"property"`
+	Operator string `json:"operator"` // FlagOpIs, FlagOpIsNot or FlagOpContains
+	Value    string `json:"value"`
+}
+
+// Flag condition operators.
+const (
+	FlagOpIs       = "is"
+	FlagOpIsNot    = "is_not"
+	FlagOpContains = "contains"
+)
+
+// Matches reports whether the property value passes the condition. A missing
+// property only passes is_not.
+func (c FlagCondition) Matches(value string, present bool) bool {
+	switch c.Operator {
+	case FlagOpIs:
+		return present && value == c.Value
+	case FlagOpIsNot:
+		return !present || value != c.Value
+	case FlagOpContains:
+		return present && strings.Contains(value, c.Value)
+	}
+	return false
+}
+
+// FlagVariant is one arm of a multivariate flag. Weights are percentages of
+// the users the flag is on for.
+type FlagVariant struct {
+	Key    string `json:"key"`
+	Weight int    `json:"weight"`
+}
+
+// ValidateFlagVariants checks that variants have unique keys and weights
+// summing to 100. No variants is valid.
+func ValidateFlagVariants(variants []FlagVariant) error {
+	if len(variants) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(variants))
+	total := 0
+	for _, v := range variants {
+		if v.Key == "" {
+			return errors.New("variant key is required")
+		}
+		if seen[v.Key] {
+			return fmt.Errorf("duplicate variant %q", v.Key)
+		}
+		seen[v.Key] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("variant %q has a negative weight", v.Key)
+		}
+		total += v.Weight
+	}
+	if total != 100 {
+		return fmt.Errorf("variant weights must sum to 100, got %d", total)
+	}
+	return nil
+}
+
+// PickFlagVariant maps a hash bucket onto the variants' cumulative weight
+// ranges, so the same bucket always gets the same variant.
+func PickFlagVariant(variants []FlagVariant, bucket uint32) string {
+	b := int(bucket % 100)
+	for _, v := range variants {
+		if b < v.Weight {
+			return v.Key
+		}
+		b -= v.Weight
+	}
+	return ""
+}
+
 func (s *SQLite) CreateFeatureFlag(ctx context.Context, f FeatureFlag) error {
+	if f.Conditions == "" {
+		f.Conditions = "[]"
+	}
+	if f.Variants == "" {
+		f.Variants = "[]"
+	}
 	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO feature_flags (id, project_id, key, name, enabled, rollout_percentage) VALUES (?, ?, ?, ?, ?, ?)`,
-		f.ID, f.ProjectID, f.Key, f.Name, b2i(f.Enabled), f.RolloutPercentage,
+		`INSERT INTO feature_flags (id, project_id, key, name, enabled, rollout_percentage, conditions, payload, variants) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		f.ID, f.ProjectID, f.Key, f.Name, b2i(f.Enabled), f.RolloutPercentage, f.Conditions, f.Payload, f.Variants,
 	)
 	return err
 }
 
 func (s *SQLite) ListFeatureFlags(ctx context.Context, projectID string) ([]FeatureFlag, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, project_id, key, name, enabled, rollout_percentage, created_at, updated_at
+		`SELECT id, project_id, key, name, enabled, rollout_percentage, conditions, payload, variants, created_at, updated_at
 		 FROM feature_flags WHERE project_id = ? ORDER BY created_at DESC`,
 		projectID,
 	)
@@ -656,7 +974,7 @@ func (s *SQLite) ListFeatureFlags(ctx context.Context, projectID string) ([]Feat
 	for rows.Next() {
 		var f FeatureFlag
 		var enabledInt int
-		if err := rows.Scan(&f.ID, &f.ProjectID, &f.Key, &f.Name, &enabledInt, &f.RolloutPercentage, &f.CreatedAt, &f.UpdatedAt); err != nil {
+		if err := rows.Scan(&f.ID, &f.ProjectID, &f.Key, &f.Name, &enabledInt, &f.RolloutPercentage, &f.Conditions, &f.Payload, &f.Variants, &f.CreatedAt, &f.UpdatedAt); err != nil {
 			return nil, err
 		}
 		f.Enabled = enabledInt != 0
@@ -674,6 +992,16 @@ func (s *SQLite) UpdateFeatureFlag(ctx context.Context, projectID, id string, en
 	return err
 }
 
+// SetFeatureFlagVariants replaces a flag's variants (a JSON array of FlagVariant).
+func (s *SQLite) SetFeatureFlagVariants(ctx context.Context, projectID, id, variants string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE feature_flags SET variants = ?, updated_at = CURRENT_TIMESTAMP
+		 WHERE project_id = ? AND id = ?`,
+		variants, projectID, id,
+	)
+	return err
+}
+
 func (s *SQLite) DeleteFeatureFlag(ctx context.Context, projectID, id string) error {
 	_, err := s.db.ExecContext(ctx,
 		`DELETE FROM feature_flags WHERE project_id = ? AND id = ?`,
@@ -694,22 +1022,37 @@ type Alert struct {
 	WindowMinutes   int        `json:"window_minutes"`
 	WebhookURL      string     `json:"webhook_url"`
 	Enabled         bool       `json:"enabled"`
+	Secret          string     `json:"secret,omitempty"` // HMAC key for X-ClickNest-Signature
+	Format          string     `json:"format"`           // webhook body: AlertFormatJSON or AlertFormatSlack
 	LastTriggeredAt *time.Time `json:"last_triggered_at,omitempty"`
 	CreatedAt       time.Time  `json:"created_at"`
 }
 
+// Alert webhook body formats.
+const (
+	AlertFormatJSON  = "json"  // the alert's fields as a JSON object
+	AlertFormatSlack = "slack" // a Slack incoming-webhook {"text": ...} message
+)
+
 func (s *SQLite) CreateAlert(ctx context.Context, a Alert) error {
-	_, err := s.db.ExecContext(ctx,
-		`INSERT INTO alerts (id, project_id, name, metric, event_name, threshold, window_minutes, webhook_url, enabled)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		a.ID, a.ProjectID, a.Name, a.Metric, a.EventName, a.Threshold, a.WindowMinutes, a.WebhookURL, b2i(a.Enabled),
+	if a.Format == "" {
+		a.Format = AlertFormatJSON
+	}
+	encSecret, err := s.enc.Encrypt(a.Secret)
+	if err != nil {
+		return fmt.Errorf("encrypting alert secret: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO alerts (id, project_id, name, metric, event_name, threshold, window_minutes, webhook_url, enabled, secret, format)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.ProjectID, a.Name, a.Metric, a.EventName, a.Threshold, a.WindowMinutes, a.WebhookURL, b2i(a.Enabled), encSecret, a.Format,
 	)
 	return err
 }
 
 func (s *SQLite) ListAlerts(ctx context.Context, projectID string) ([]Alert, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, project_id, name, metric, event_name, threshold, window_minutes, webhook_url, enabled, last_triggered_at, created_at
+		`SELECT id, project_id, name, metric, event_name, threshold, window_minutes, webhook_url, enabled, secret, format, last_triggered_at, created_at
 		 FROM alerts WHERE project_id = ? ORDER BY created_at DESC`,
 		projectID,
 	)
@@ -717,33 +1060,37 @@ func (s *SQLite) ListAlerts(ctx context.Context, projectID string) ([]Alert, err
 		return nil, err
 	}
 	defer rows.Close()
-	return scanAlerts(rows)
+	return s.scanAlerts(rows)
 }
 
 // ListAllEnabledAlerts returns all enabled alerts across all projects (for background checker).
 func (s *SQLite) ListAllEnabledAlerts(ctx context.Context) ([]Alert, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, project_id, name, metric, event_name, threshold, window_minutes, webhook_url, enabled, last_triggered_at, created_at
+		`SELECT id, project_id, name, metric, event_name, threshold, window_minutes, webhook_url, enabled, secret, format, last_triggered_at, created_at
 		 FROM alerts WHERE enabled = 1 ORDER BY created_at DESC`,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	return scanAlerts(rows)
+	return s.scanAlerts(rows)
 }
 
-func scanAlerts(rows *sql.Rows) ([]Alert, error) {
+func (s *SQLite) scanAlerts(rows *sql.Rows) ([]Alert, error) {
 	var alerts []Alert
 	for rows.Next() {
 		var a Alert
 		var enabledInt int
 		var eventName sql.NullString
+		var encSecret string
 		if err := rows.Scan(&a.ID, &a.ProjectID, &a.Name, &a.Metric, &eventName, &a.Threshold,
-			&a.WindowMinutes, &a.WebhookURL, &enabledInt, &a.LastTriggeredAt, &a.CreatedAt); err != nil {
+			&a.WindowMinutes, &a.WebhookURL, &enabledInt, &encSecret, &a.Format, &a.LastTriggeredAt, &a.CreatedAt); err != nil {
 			return nil, err
 		}
 		a.Enabled = enabledInt != 0
+		if dec, err := s.enc.Decrypt(encSecret); err == nil {
+			a.Secret = dec
+		}
 		if eventName.Valid {
 			a.EventName = eventName.String
 		}
@@ -1173,7 +1520,7 @@ func (s *SQLite) ListProjectMembers(ctx context.Context, projectID string) ([]Pr
 
 func (s *SQLite) ListUserProjects(ctx context.Context, userID string) ([]Project, error) {
 	rows, err := s.db.QueryContext(ctx,
-		`SELECT p.id, p.name, p.description, p.api_key, p.created_at
+		`SELECT p.id, p.name, p.description, p.api_key, p.public_id, p.created_at
 		 FROM projects p
 		 JOIN project_members pm ON pm.project_id = p.id
 		 WHERE pm.user_id = ?
@@ -1188,7 +1535,7 @@ func (s *SQLite) ListUserProjects(ctx context.Context, userID string) ([]Project
 	var projects []Project
 	for rows.Next() {
 		var p Project
-		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.APIKey, &p.CreatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description, &p.APIKey, &p.PublicID, &p.CreatedAt); err != nil {
 			return nil, err
 		}
 		projects = append(projects, p)
@@ -1230,6 +1577,15 @@ func (s *SQLite) CountUsers(ctx context.Context) (int, error) {
 	return n, err
 }
 
+// InstanceAdminID returns the ID of the instance admin: the account created
+// at first-run setup, which is the oldest user. It returns sql.ErrNoRows
+// before setup.
+func (s *SQLite) InstanceAdminID(ctx context.Context) (string, error) {
+	var id string
+	err := s.db.QueryRowContext(ctx, `SELECT id FROM users ORDER BY created_at, id LIMIT 1`).Scan(&id)
+	return id, err
+}
+
 func (s *SQLite) CreateUser(ctx context.Context, email, passwordHash string) (*User, error) {
 	id, err := generateRandomHex(16)
 	if err != nil {
@@ -1320,6 +1676,14 @@ func generateAPIKey() (string, error) {
 	return "cn_" + hex.EncodeToString(b), nil
 }
 
+func generatePublicID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating public id: %w", err)
+	}
+	return "pub_" + hex.EncodeToString(b), nil
+}
+
 // --- Webhook Deliveries ---
 
 type WebhookDelivery struct {
@@ -2040,6 +2404,16 @@ func (s *SQLite) ResolveIdentity(ctx context.Context, projectID, distinctID stri
 	return identifiedID, nil
 }
 
+// DeleteIdentityAliases removes every alias linking an anonymous ID to
+// identifiedID.
+func (s *SQLite) DeleteIdentityAliases(ctx context.Context, projectID, identifiedID string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM identity_aliases WHERE project_id = ? AND identified_id = ?`,
+		projectID, identifiedID,
+	)
+	return err
+}
+
 // ListAliases returns all anonymous IDs that have been linked to the given
 // identified user ID.
 func (s *SQLite) ListAliases(ctx context.Context, projectID, identifiedID string) ([]string, error) {
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"path/filepath"
 	"testing"
+	"time"
 
 	_ "modernc.org/sqlite"
 )
@@ -162,3 +163,63 @@ func isValidAPIKey(key string) bool {
 	}
 	return true
 }
+
+func TestEventUsage_ResetsMonthly(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	p, err := db.CreateProject(ctx, "p1", "Test")
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	if q := db.EventQuota(ctx, p.ID); q != 0 {
+		t.Fatalf("expected no quota by default, got %d", q)
+	}
+
+	oct := time.Date(2026, 10, 31, 23, 59, 0, 0, time.UTC)
+	nov := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	if _, err := db.AddEventUsage(ctx, p.ID, oct, 40); err != nil {
+		t.Fatalf("AddEventUsage: %v", err)
+	}
+	if total, err := db.AddEventUsage(ctx, p.ID, oct, 2); err != nil || total != 42 {
+		t.Fatalf("expected October total 42, got %d (%v)", total, err)
+	}
+	if used, err := db.MonthlyEventUsage(ctx, p.ID, nov); err != nil || used != 0 {
+		t.Fatalf("expected November to start at 0, got %d (%v)", used, err)
+	}
+	if total, err := db.AddEventUsage(ctx, p.ID, nov, 1); err != nil || total != 1 {
+		t.Fatalf("expected November total 1, got %d (%v)", total, err)
+	}
+	// Months are UTC: late evening Oct 31 in New York is already November.
+	est := time.FixedZone("EST", -5*3600)
+	if used, err := db.MonthlyEventUsage(ctx, p.ID, time.Date(2026, 10, 31, 20, 0, 0, 0, est)); err != nil || used != 1 {
+		t.Fatalf("expected UTC month boundaries, got %d (%v)", used, err)
+	}
+}
+
+func TestBotFilter_CachedUntilSet(t *testing.T) {
+	db := newTestDB(t)
+	ctx := context.Background()
+	p, err := db.CreateProject(ctx, "p1", "Test")
+	if err != nil {
+		t.Fatalf("CreateProject: %v", err)
+	}
+	if f := db.BotFilter(ctx, p.ID); f != nil {
+		t.Fatal("expected no filter by default")
+	}
+	if err := db.SetBotFilters(ctx, p.ID, []string{"UptimeRobot"}); err != nil {
+		t.Fatalf("SetBotFilters: %v", err)
+	}
+	f := db.BotFilter(ctx, p.ID)
+	if f == nil || !f.Match("UptimeRobot/2.0") {
+		t.Fatal("expected the new filter to apply after SetBotFilters")
+	}
+	if again := db.BotFilter(ctx, p.ID); again != f {
+		t.Fatal("expected the compiled filter to be reused")
+	}
+	if err := db.SetBotFilters(ctx, p.ID, nil); err != nil {
+		t.Fatalf("SetBotFilters: %v", err)
+	}
+	if f := db.BotFilter(ctx, p.ID); f != nil {
+		t.Fatal("expected clearing the list to drop the cached filter")
+	}
+}
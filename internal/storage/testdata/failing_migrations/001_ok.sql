@@ -0,0 +1 @@
+CREATE TABLE first_ok (id TEXT PRIMARY KEY);
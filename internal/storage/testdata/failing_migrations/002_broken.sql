@@ -0,0 +1,2 @@
+CREATE TABLE half_applied (id TEXT PRIMARY KEY);
+ALTER TABLE no_such_table ADD COLUMN broken TEXT;
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TimezoneSetting is the growth setting key holding a project's IANA
+// timezone name (e.g. "Europe/Berlin"). Time-bucketed queries use it for day,
+// week and month boundaries. Unset means UTC.
+const TimezoneSetting = "timezone"
+
+// Timezone returns the project's default location, or UTC when none is set
+// or the stored name no longer loads.
+func (s *SQLite) Timezone(ctx context.Context, projectID string) *time.Location {
+	v, _ := s.GetGrowthSetting(ctx, projectID, TimezoneSetting)
+	if v == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(v)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// SetTimezone validates and stores the project's timezone. An empty name
+// resets it to UTC.
+func (s *SQLite) SetTimezone(ctx context.Context, projectID, name string) error {
+	name = strings.TrimSpace(name)
+	if name != "" {
+		if _, err := time.LoadLocation(name); err != nil {
+			return fmt.Errorf("unknown timezone %q", name)
+		}
+	}
+	return s.SetGrowthSetting(ctx, projectID, TimezoneSetting, name)
+}
+
+type locationKey struct{}
+
+// WithLocation returns a context under which DuckDB queries bucket
+// timestamps by wall-clock time in loc. A nil loc or UTC leaves ctx
+// unchanged.
+func WithLocation(ctx context.Context, loc *time.Location) context.Context {
+	if loc == nil || loc == time.UTC {
+		return ctx
+	}
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+func locationFrom(ctx context.Context) *time.Location {
+	if loc, ok := ctx.Value(locationKey{}).(*time.Location); ok {
+		return loc
+	}
+	return time.UTC
+}
+
+// localTime returns a SQL expression for the TIMESTAMPTZ expression col as a
+// wall-clock TIMESTAMP in ctx's location. DuckDB is built without ICU, so the
+// UTC offsets in effect between start and end are worked out here and
+// inlined as a CASE over the zone's transitions. With UTC it is the plain
+// CAST the queries have always used.
+func localTime(ctx context.Context, col string, start, end time.Time) string {
+	utc := "CAST(" + col + " AS TIMESTAMP)"
+	loc := locationFrom(ctx)
+	if loc == time.UTC {
+		return utc
+	}
+	if end.IsZero() {
+		end = time.Now()
+	}
+	if start.IsZero() || start.After(end) {
+		start = end.AddDate(-1, 0, 0)
+	}
+	segs := zoneSegments(loc, start, end)
+	if len(segs) == 1 {
+		return fmt.Sprintf("(%s + INTERVAL '%d seconds')", utc, segs[0].offset)
+	}
+	var b strings.Builder
+	b.WriteString("(CASE")
+	for _, s := range segs[:len(segs)-1] {
+		fmt.Fprintf(&b, " WHEN %s < TIMESTAMP '%s' THEN %s + INTERVAL '%d seconds'",
+			utc, s.until.UTC().Format("2006-01-02 15:04:05"), utc, s.offset)
+	}
+	fmt.Fprintf(&b, " ELSE %s + INTERVAL '%d seconds' END)", utc, segs[len(segs)-1].offset)
+	return b.String()
+}
+
+// zoneSegment is a span with one UTC offset, ending at until (exclusive).
+type zoneSegment struct {
+	until  time.Time
+	offset int // seconds east of UTC
+}
+
+// zoneSegments splits [start, end] at loc's offset changes. The last
+// segment's until is zero.
+func zoneSegments(loc *time.Location, start, end time.Time) []zoneSegment {
+	offsetAt := func(t time.Time) int {
+		_, off := t.In(loc).Zone()
+		return off
+	}
+	var segs []zoneSegment
+	cur := offsetAt(start)
+	prev := start
+	for t := start.Add(time.Hour); ; t = t.Add(time.Hour) {
+		if t.After(end) {
+			t = end
+		}
+		if off := offsetAt(t); off != cur {
+			// Narrow the change down to the second.
+			lo, hi := prev, t
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if offsetAt(mid) == cur {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			segs = append(segs, zoneSegment{until: hi.Truncate(time.Second), offset: cur})
+			cur = off
+		}
+		if !t.Before(end) {
+			break
+		}
+		prev = t
+	}
+	return append(segs, zoneSegment{offset: cur})
+}
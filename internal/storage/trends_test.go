@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueryTrends_Filtered(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC().Truncate(time.Hour).Add(30 * time.Minute)
+	signup := "Signup"
+	purchase := "Purchase"
+
+	events := []Event{
+		testEvent("p1", "s1", "pageview", "/", now),
+		testEvent("p1", "s1", "pageview", "/pricing", now),
+		testEvent("p1", "s1", "custom", "/", now),
+		testEvent("p1", "s2", "custom", "/", now),
+		testEvent("p1", "s2", "custom", "/", now),
+	}
+	events[2].EventName = &signup
+	events[3].EventName = &signup
+	events[4].EventName = &purchase
+	if err := db.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+
+	count := func(eventType, eventName string) int64 {
+		t.Helper()
+		points, err := db.QueryTrends(ctx, "p1", "hour", eventType, eventName, start, end)
+		if err != nil {
+			t.Fatalf("QueryTrends: %v", err)
+		}
+		var total int64
+		for _, p := range points {
+			total += p.Count
+		}
+		return total
+	}
+
+	if got := count("", ""); got != 5 {
+		t.Fatalf("unfiltered: expected 5, got %d", got)
+	}
+	if got := count("", "Signup"); got != 2 {
+		t.Fatalf("event_name=Signup: expected 2, got %d", got)
+	}
+	if got := count("pageview", ""); got != 2 {
+		t.Fatalf("event_type=pageview: expected 2, got %d", got)
+	}
+	if got := count("custom", "Purchase"); got != 1 {
+		t.Fatalf("custom Purchase: expected 1, got %d", got)
+	}
+}
+
+func TestQueryTrendsMulti_BucketLabelsMatchDuckDB(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	at := time.Date(2026, 3, 4, 15, 30, 0, 0, time.UTC) // a Wednesday
+	if err := db.InsertEvents(ctx, []Event{testEvent("p1", "s1", "pageview", "/", at)}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	for _, interval := range []string{"minute", "hour", "day", "week", "month"} {
+		series, err := db.QueryTrendsMulti(ctx, "p1", interval, []TrendMetric{{Name: "all"}}, at.Add(-time.Minute), at.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("%s: %v", interval, err)
+		}
+		var total int64
+		for _, p := range series[0].Data {
+			total += p.Count
+		}
+		if total != 1 {
+			t.Fatalf("%s: event fell outside the gap-filled buckets %+v", interval, series[0].Data)
+		}
+	}
+}
+
+func TestQueryTrends_LocationAcrossDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("no zoneinfo: %v", err)
+	}
+	ctx := WithLocation(context.Background(), ny)
+	db := newTestDuckDB(t)
+	// New York moves from UTC-5 to UTC-4 on 2026-03-08.
+	before := time.Date(2026, 3, 8, 4, 30, 0, 0, time.UTC) // 23:30 on the 7th
+	after := time.Date(2026, 3, 9, 3, 30, 0, 0, time.UTC)  // 23:30 on the 8th
+	if err := db.InsertEvents(ctx, []Event{
+		testEvent("p1", "s1", "pageview", "/", before),
+		testEvent("p1", "s1", "pageview", "/", after),
+	}); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	series, err := db.QueryTrendsMulti(ctx, "p1", "day", []TrendMetric{{Name: "all"}}, before.Add(-time.Hour), after.Add(10*time.Minute))
+	if err != nil {
+		t.Fatalf("QueryTrendsMulti: %v", err)
+	}
+	got := map[string]int64{}
+	for _, p := range series[0].Data {
+		got[p.Bucket] = p.Count
+	}
+	if got["2026-03-07"] != 1 || got["2026-03-08"] != 1 || len(series[0].Data) != 2 {
+		t.Fatalf("expected one event on each local day, got %+v", series[0].Data)
+	}
+}
+
+func TestQueryTrendsBreakdown_OtherAndTotal(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDuckDB(t)
+	now := time.Now().UTC().Truncate(time.Hour).Add(30 * time.Minute)
+
+	// Ten paths: /p0 gets 10 events down to /p9 with 1, so the top eight
+	// leave /p8 (2) and /p9 (1) in the tail.
+	var events []Event
+	for i := range 10 {
+		for range 10 - i {
+			events = append(events, testEvent("p1", "s", "pageview", "/p"+string(rune('0'+i)), now))
+		}
+	}
+	if err := db.InsertEvents(ctx, events); err != nil {
+		t.Fatalf("InsertEvents: %v", err)
+	}
+	start, end := now.Add(-time.Hour), now.Add(time.Hour)
+
+	sum := func(s TrendSeries) (n int64) {
+		for _, p := range s.Data {
+			n += p.Count
+		}
+		return n
+	}
+	series, err := db.QueryTrendsBreakdown(ctx, "p1", "hour", "url_path", start, end, 0, false)
+	if err != nil {
+		t.Fatalf("QueryTrendsBreakdown: %v", err)
+	}
+	if len(series) != 8 {
+		t.Fatalf("expected the top 8 series without totals, got %d", len(series))
+	}
+
+	series, err = db.QueryTrendsBreakdown(ctx, "p1", "hour", "url_path", start, end, 0, true)
+	if err != nil {
+		t.Fatalf("QueryTrendsBreakdown with totals: %v", err)
+	}
+	if len(series) != 10 || series[8].Name != OtherSeries || series[9].Name != TotalSeries {
+		t.Fatalf("expected top 8 then Other and All events, got %d series", len(series))
+	}
+	if got := sum(series[8]); got != 3 {
+		t.Fatalf("expected Other to hold the tail's 3 events, got %d", got)
+	}
+	var top int64
+	for _, s := range series[:8] {
+		top += sum(s)
+	}
+	if total := sum(series[9]); total != 55 || top+sum(series[8]) != total {
+		t.Fatalf("expected series to reconcile to 55, got top %d + other %d vs total %d", top, sum(series[8]), total)
+	}
+
+	series, err = db.QueryTrendsBreakdown(ctx, "p1", "hour", "url_path", start, end, 3, false)
+	if err != nil {
+		t.Fatalf("QueryTrendsBreakdown top 3: %v", err)
+	}
+	if len(series) != 3 {
+		t.Fatalf("expected 3 series for top 3, got %d", len(series))
+	}
+	series, err = db.QueryTrendsBreakdown(ctx, "p1", "hour", "url_path", start, end, 3, true)
+	if err != nil {
+		t.Fatalf("QueryTrendsBreakdown top 3 with totals: %v", err)
+	}
+	if len(series) != 5 || series[3].Name != OtherSeries || sum(series[3]) != 55-10-9-8 {
+		t.Fatalf("expected top 3 then Other with the remaining 28 events, got %+v", series)
+	}
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Metrics a widget can show, each counted over the widget's window.
+var WidgetMetrics = map[string]bool{
+	"events":    true,
+	"pageviews": true,
+	"errors":    true,
+}
+
+// Widget is one saved metric that can be embedded on an external page.
+type Widget struct {
+	ID         string    `json:"id"`
+	ProjectID  string    `json:"project_id"`
+	Name       string    `json:"name"`
+	Metric     string    `json:"metric"`
+	EventName  string    `json:"event_name,omitempty"` // narrows "events" to one named event
+	WindowDays int       `json:"window_days"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// CreateWidget inserts a widget and returns it with its generated ID.
+func (s *SQLite) CreateWidget(ctx context.Context, wd Widget) (*Widget, error) {
+	out := &Widget{}
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO widgets (id, project_id, name, metric, event_name, window_days)
+		VALUES (lower(hex(randomblob(16))), ?, ?, ?, ?, ?)
+		RETURNING id, project_id, name, metric, event_name, window_days, created_at`,
+		wd.ProjectID, wd.Name, wd.Metric, wd.EventName, wd.WindowDays,
+	).Scan(&out.ID, &out.ProjectID, &out.Name, &out.Metric, &out.EventName, &out.WindowDays, &out.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListWidgets returns a project's widgets, newest first.
+func (s *SQLite) ListWidgets(ctx context.Context, projectID string) ([]Widget, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, project_id, name, metric, event_name, window_days, created_at
+		FROM widgets WHERE project_id = ? ORDER BY created_at DESC`,
+		projectID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []Widget
+	for rows.Next() {
+		var wd Widget
+		if err := rows.Scan(&wd.ID, &wd.ProjectID, &wd.Name, &wd.Metric, &wd.EventName, &wd.WindowDays, &wd.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, wd)
+	}
+	return out, rows.Err()
+}
+
+// GetWidget retrieves a single widget by ID.
+func (s *SQLite) GetWidget(ctx context.Context, projectID, id string) (*Widget, error) {
+	wd := &Widget{}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, project_id, name, metric, event_name, window_days, created_at
+		FROM widgets WHERE project_id = ? AND id = ?`,
+		projectID, id,
+	).Scan(&wd.ID, &wd.ProjectID, &wd.Name, &wd.Metric, &wd.EventName, &wd.WindowDays, &wd.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return wd, nil
+}
+
+// DeleteWidget removes a widget, revoking its share token.
+func (s *SQLite) DeleteWidget(ctx context.Context, projectID, id string) error {
+	_, err := s.db.ExecContext(ctx,
+		`DELETE FROM widgets WHERE project_id = ? AND id = ?`, projectID, id,
+	)
+	return err
+}
@@ -26,6 +26,6 @@ func ProjectFromContext(ctx context.Context) *storage.Project {
 const SessionCookieName = iauth.SessionCookieName
 
 // APIKeyMiddleware validates the X-API-Key header for SDK ingestion endpoints.
-func APIKeyMiddleware(meta *storage.SQLite) func(http.Handler) http.Handler {
+func APIKeyMiddleware(meta storage.MetaStore) func(http.Handler) http.Handler {
 	return iauth.APIKeyMiddleware(meta)
 }
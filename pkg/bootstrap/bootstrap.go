@@ -41,6 +41,18 @@ type Config struct {
 	// CloudMode tells the frontend this is a cloud-managed instance.
 	CloudMode bool
 
+	// FrontendOrigin is the origin of a dashboard hosted separately from the
+	// API (e.g. on a CDN). Empty serves the embedded dashboard same-origin.
+	FrontendOrigin string
+
+	// SDKOrigins limits which sites may call the public SDK routes
+	// cross-origin. Empty allows every origin.
+	SDKOrigins []string
+
+	// IngestPath is an extra path accepting SDK events, for networks that
+	// block URLs containing "events". Empty serves only the default paths.
+	IngestPath string
+
 	// Single-tenant cloud instance fields.
 	ControlPlaneURL string // Control plane URL (e.g. "https://api.clicknest.app")
 	InstanceID      string // Instance UUID from the control plane
@@ -50,7 +62,7 @@ type Config struct {
 	// the shared HTTP mux and the metadata store so that EE code can
 	// inject additional routes (billing, signup, instances) and access
 	// the user/project database directly.
-	RouteHook func(mux *http.ServeMux, meta *storage.SQLite)
+	RouteHook func(mux *http.ServeMux, meta storage.MetaStore)
 
 	// ResourceLimitFn, if set, is consulted before creating metered resources
 	// (campaigns, leads, etc.). Returns HTTP status + message when exceeded,
@@ -62,9 +74,18 @@ type Config struct {
 	// When nil, the server uses a 365-day default.
 	RetentionDaysFn func(ctx context.Context, projectID string) int
 
+	// MaxResultLimit caps the limit parameter on list endpoints. Zero uses
+	// the server default.
+	MaxResultLimit int
+
+	// RatePerSecond and RateBurst are the default per-project event ingestion
+	// limits. Zero uses the server defaults (10/s, 50 burst).
+	RatePerSecond float64
+	RateBurst     int
+
 	// RateLimitFn, if set, returns per-project event ingestion rate limits (tokens/sec, burst).
 	// Return rate <= 0 to disable rate limiting for the project (e.g. enterprise tier).
-	// When nil, the default 10/s, 50 burst limits apply.
+	// When nil, RatePerSecond and RateBurst apply.
 	RateLimitFn func(ctx context.Context, projectID string) (rate float64, burst int)
 
 	// OnEventIngested, if set, is called after a successful event batch is written.
@@ -72,6 +93,19 @@ type Config struct {
 	// Used by EE to increment the monthly usage counter in PostgreSQL.
 	OnEventIngested func(ctx context.Context, projectID string, count int64)
 
+	// DuckDBReadConns, if > 0, serves dashboard queries from a separate DuckDB
+	// connection pool of this size so heavy reads don't block ingestion.
+	DuckDBReadConns int
+
+	// MetaURL, if set to a postgres:// URL, stores metadata (projects, users,
+	// settings) in Postgres instead of clicknest.db in DataDir. Events always
+	// stay in DuckDB.
+	MetaURL string
+
+	// InsecurePermissions downgrades the startup refusal for an over-permissive
+	// encryption key file to a warning.
+	InsecurePermissions bool
+
 	// Version is the application version string for telemetry.
 	Version string
 
@@ -97,7 +131,9 @@ func Setup(cfg Config) *App {
 		cfg.Registry = growth.NewRegistry()
 	}
 
-	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+	_, statErr := os.Stat(cfg.DataDir)
+	freshDataDir := os.IsNotExist(statErr)
+	if err := os.MkdirAll(cfg.DataDir, 0700); err != nil {
 		log.Fatalf("creating data dir: %v", err)
 	}
 
@@ -105,7 +141,7 @@ func Setup(cfg Config) *App {
 	duckdbPath := filepath.Join(cfg.DataDir, "events.duckdb")
 	sqlitePath := filepath.Join(cfg.DataDir, "clicknest.db")
 
-	events, err := storage.NewDuckDB(duckdbPath)
+	events, err := storage.NewDuckDBWithReader(duckdbPath, cfg.DuckDBReadConns)
 	if err != nil {
 		log.Fatalf("opening duckdb: %v", err)
 	}
@@ -116,10 +152,29 @@ func Setup(cfg Config) *App {
 	}
 	log.Println("Encryption at rest enabled for API keys and tokens")
 
-	meta, err := storage.NewSQLite(sqlitePath, enc)
-	if err != nil {
-		log.Fatalf("opening sqlite: %v", err)
+	var meta *storage.SQLite
+	switch {
+	case cfg.MetaURL == "":
+		meta, err = storage.NewSQLite(sqlitePath, enc)
+		if err != nil {
+			log.Fatalf("opening sqlite: %v", err)
+		}
+	case storage.IsPostgresURL(cfg.MetaURL):
+		meta, err = storage.NewPostgres(cfg.MetaURL, enc)
+		if err != nil {
+			log.Fatalf("opening postgres: %v", err)
+		}
+		log.Println("Metadata stored in Postgres")
+	default:
+		log.Fatalf("unsupported metadata URL %q: expected postgres://", cfg.MetaURL)
+	}
+
+	// Lock down files we just created, then make sure nothing in the data
+	// directory is readable by other users.
+	if freshDataDir {
+		tightenDataDirPermissions(cfg.DataDir)
 	}
+	checkDataDirPermissions(cfg.DataDir, cfg.InsecurePermissions)
 
 	// Ensure a default project exists.
 	ensureDefaultProject(meta)
@@ -219,12 +274,18 @@ func Setup(cfg Config) *App {
 		GitHubClientID:     ghClientID,
 		GitHubClientSecret: ghClientSecret,
 		CloudMode:          cfg.CloudMode,
+		FrontendOrigin:     cfg.FrontendOrigin,
+		IngestPath:         cfg.IngestPath,
+		SDKOrigins:         cfg.SDKOrigins,
 		ControlPlaneURL:    cfg.ControlPlaneURL,
 		InstanceID:         cfg.InstanceID,
 		InstanceSecret:     cfg.InstanceSecret,
 		RouteHook:          cfg.RouteHook,
 		ResourceLimitFn:    cfg.ResourceLimitFn,
 		RetentionDaysFn:    cfg.RetentionDaysFn,
+		MaxResultLimit:     cfg.MaxResultLimit,
+		RatePerSecond:      cfg.RatePerSecond,
+		RateBurst:          cfg.RateBurst,
 		RateLimitFn:        cfg.RateLimitFn,
 		OnEventIngested:    onEventIngested,
 		Analytics:          selfAnalytics,
@@ -294,7 +355,7 @@ func (a *App) Close() {
 	a.Events.Close()
 }
 
-func getDefaultProject(meta *storage.SQLite) *storage.Project {
+func getDefaultProject(meta storage.MetaStore) *storage.Project {
 	projects, err := meta.ListProjects(context.Background())
 	if err != nil || len(projects) == 0 {
 		return nil
@@ -302,7 +363,7 @@ func getDefaultProject(meta *storage.SQLite) *storage.Project {
 	return &projects[0]
 }
 
-func ensureDefaultProject(meta *storage.SQLite) {
+func ensureDefaultProject(meta storage.MetaStore) {
 	ctx := context.Background()
 	projects, err := meta.ListProjects(ctx)
 	if err != nil {
@@ -321,3 +382,30 @@ func ensureDefaultProject(meta *storage.SQLite) {
 	}
 	log.Printf("Created default project: %s (API key: %s)", project.Name, project.APIKey)
 }
+
+// tightenDataDirPermissions restricts every file in a freshly created data
+// directory to the owner. The database drivers create files with the process
+// umask (usually 0644), which would otherwise leave them world-readable.
+func tightenDataDirPermissions(dataDir string) {
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			os.Chmod(filepath.Join(dataDir, e.Name()), 0600)
+		}
+	}
+}
+
+// checkDataDirPermissions logs a warning for each over-permissive entry in the
+// data directory. A world- or group-readable encryption key is fatal unless
+// insecure is set, since anyone who can read it can decrypt every stored secret.
+func checkDataDirPermissions(dataDir string, insecure bool) {
+	for _, p := range storage.CheckPermissions(dataDir) {
+		if p.Critical && !insecure {
+			log.Fatalf("refusing to start: %s (fix with chmod %#o, or pass -insecure-perms to override)", p, p.Want)
+		}
+		log.Printf("WARN insecure permissions: %s", p)
+	}
+}
@@ -7,7 +7,8 @@ import "github.com/danielthedm/clicknest/internal/storage"
 
 // Re-export types so external packages can reference them.
 type (
-	SQLite  = storage.SQLite
-	User    = storage.User
-	Project = storage.Project
+	SQLite    = storage.SQLite
+	MetaStore = storage.MetaStore
+	User      = storage.User
+	Project   = storage.Project
 )
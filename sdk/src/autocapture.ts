@@ -18,6 +18,9 @@ export function startAutocapture(): void {
   // Capture form submissions.
   document.addEventListener('submit', handleSubmit, { capture: true, passive: true });
 
+  // Capture which form fields are filled in (never their values).
+  document.addEventListener('change', handleFieldChange, { capture: true, passive: true });
+
   // Capture JS errors.
   window.addEventListener('error', handleError);
   window.addEventListener('unhandledrejection', handleRejection);
@@ -44,6 +47,7 @@ export function stopAutocapture(): void {
   isCapturing = false;
   document.removeEventListener('click', handleClick, { capture: true });
   document.removeEventListener('submit', handleSubmit, { capture: true });
+  document.removeEventListener('change', handleFieldChange, { capture: true });
   window.removeEventListener('error', handleError);
   window.removeEventListener('unhandledrejection', handleRejection);
   window.removeEventListener('popstate', capturePageview);
@@ -124,6 +128,33 @@ function extractErrorType(message: string): string | null {
   return match ? match[1] : null;
 }
 
+// Input types that are buttons rather than fields someone fills in.
+const NON_FIELD_INPUT_TYPES = new Set(['submit', 'button', 'reset', 'image', 'hidden']);
+
+// Record that a form field was changed: its identity (id, name, label) and
+// type, but never what was entered. The server drops any value too.
+function handleFieldChange(e: Event): void {
+  const el = e.target as HTMLInputElement | HTMLTextAreaElement | HTMLSelectElement;
+  if (!el || !el.tagName) return;
+  const tag = el.tagName.toLowerCase();
+  if (tag !== 'input' && tag !== 'textarea' && tag !== 'select') return;
+  const type = (el.type ?? '').toLowerCase();
+  if (tag === 'input' && NON_FIELD_INPUT_TYPES.has(type)) return;
+
+  const label = el.labels?.[0]?.innerText?.trim().substring(0, 200) ?? '';
+  enqueue({
+    event_type: 'input',
+    ...extractContext(el),
+    element_text: '',
+    timestamp: Date.now(),
+    properties: {
+      ...(el.name ? { field_name: el.name } : {}),
+      ...(label ? { field_label: label } : {}),
+      field_type: type || tag,
+    },
+  });
+}
+
 function handleSubmit(e: SubmitEvent): void {
   const form = e.target as HTMLFormElement;
   if (!form) return;
@@ -1,6 +1,7 @@
-import { send, TransportConfig, TransportPayload } from './transport';
+import { beacon, send, TransportConfig, TransportPayload } from './transport';
 import { getSessionId } from './session';
 import { getDistinctId } from './identify';
+import { isInternal } from './internal';
 
 const MAX_BATCH_SIZE = 10;
 const FLUSH_INTERVAL = 5000; // 5 seconds
@@ -13,14 +14,14 @@ export function initBatch(transportConfig: TransportConfig): void {
   config = transportConfig;
   startFlushTimer();
 
-  // Flush on page unload.
+  // Flush on page unload, as a beacon so the browser still delivers it.
   if (typeof window !== 'undefined') {
     window.addEventListener('visibilitychange', () => {
       if (document.visibilityState === 'hidden') {
-        flush();
+        flush(true);
       }
     });
-    window.addEventListener('pagehide', flush);
+    window.addEventListener('pagehide', () => flush(true));
   }
 }
 
@@ -32,7 +33,7 @@ export function enqueue(event: Record<string, unknown>): void {
   }
 }
 
-export function flush(): void {
+export function flush(unloading = false): void {
   if (!config || queue.length === 0) return;
 
   const events = queue.splice(0);
@@ -41,8 +42,13 @@ export function flush(): void {
     session_id: getSessionId(),
     distinct_id: getDistinctId(),
   };
+  if (isInternal()) payload.internal = true;
 
-  send(config, payload);
+  if (unloading) {
+    beacon(config, payload);
+  } else {
+    send(config, payload);
+  }
 }
 
 function startFlushTimer(): void {
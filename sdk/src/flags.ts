@@ -1,18 +1,37 @@
 import { enqueue } from './batch';
 
 let flagCache: Record<string, boolean> = {};
+let flagPayloads: Record<string, unknown> = {};
+let flagVariants: Record<string, string> = {};
 let experimentVariants: Record<string, string> = {};
 let exposuresSent: Set<string> = new Set();
+let lastLoad: { host: string; apiKey: string } | null = null;
 
-export async function loadFlags(host: string, apiKey: string, distinctId: string): Promise<void> {
+// properties are user traits (e.g. { plan: 'pro' }) that flag conditions
+// are checked against.
+export async function loadFlags(host: string, apiKey: string, distinctId: string, properties?: Record<string, string>): Promise<void> {
+  lastLoad = { host, apiKey };
   try {
+    const params = new URLSearchParams({ ...properties, distinct_id: distinctId });
     const resp = await fetch(
-      `${host}/api/v1/flags/evaluate?distinct_id=${encodeURIComponent(distinctId)}`,
+      `${host}/api/v1/flags/evaluate?${params.toString()}`,
       { headers: { 'X-API-Key': apiKey } },
     );
     if (!resp.ok) return;
     const data = await resp.json();
-    flagCache = data.flags ?? {};
+    flagCache = {};
+    flagPayloads = {};
+    flagVariants = {};
+    for (const [key, flag] of Object.entries((data.flags ?? {}) as Record<string, any>)) {
+      // Older servers return a plain boolean per flag.
+      if (flag && typeof flag === 'object') {
+        flagCache[key] = flag.enabled === true;
+        if (flag.payload != null) flagPayloads[key] = flag.payload;
+        if (flag.variant) flagVariants[key] = flag.variant;
+      } else {
+        flagCache[key] = flag === true;
+      }
+    }
     experimentVariants = {};
     if (data.experiments) {
       for (const [key, info] of Object.entries(data.experiments as Record<string, any>)) {
@@ -27,6 +46,24 @@ export async function loadFlags(host: string, apiKey: string, distinctId: string
   }
 }
 
+// reloadFlags re-evaluates flags for the current user with the given
+// properties. It does nothing before init.
+export function reloadFlags(distinctId: string, properties?: Record<string, string>): Promise<void> {
+  if (!lastLoad) return Promise.resolve();
+  return loadFlags(lastLoad.host, lastLoad.apiKey, distinctId, properties);
+}
+
+// getFlagPayload returns the JSON payload of an enabled flag, or undefined.
+export function getFlagPayload(key: string): unknown {
+  return flagPayloads[key];
+}
+
+// getFlagVariant returns the variant a multivariate flag assigned this user,
+// or undefined.
+export function getFlagVariant(key: string): string | undefined {
+  return flagVariants[key];
+}
+
 export function isEnabled(key: string): boolean {
   const value = flagCache[key] === true;
 
@@ -41,7 +78,7 @@ export function isEnabled(key: string): boolean {
       timestamp: Date.now(),
       properties: {
         $flag_key: key,
-        $variant: experimentVariants[key] ?? (value ? 'on' : 'off'),
+        $variant: experimentVariants[key] ?? flagVariants[key] ?? (value ? 'on' : 'off'),
       },
     });
   }
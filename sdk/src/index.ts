@@ -2,12 +2,16 @@ import { initBatch, enqueue, flush } from './batch';
 import { startAutocapture, stopAutocapture } from './autocapture';
 import { identify, resetIdentity, getDistinctId } from './identify';
 import { getSessionId } from './session';
-import { loadFlags, isEnabled } from './flags';
+import { loadFlags, reloadFlags, isEnabled, getFlagPayload, getFlagVariant } from './flags';
+import { capturePerformance, startPerformanceCapture } from './performance';
+import { initInternalFlag } from './internal';
 
 export interface ClickNestConfig {
   apiKey: string;
   host: string;
   autocapture?: boolean;
+  projectId?: string;
+  ingestPath?: string;
 }
 
 let initialized = false;
@@ -18,16 +22,25 @@ function init(config: ClickNestConfig): void {
 
   const host = config.host.replace(/\/$/, '');
 
-  initBatch({ host, apiKey: config.apiKey });
+  initInternalFlag();
+
+  initBatch({ host, apiKey: config.apiKey, projectId: config.projectId, ingestPath: config.ingestPath });
 
   if (config.autocapture !== false) {
     startAutocapture();
+    startPerformanceCapture();
   }
 
   // Load feature flags in the background — isEnabled() will return false until ready.
   loadFlags(host, config.apiKey, getDistinctId() ?? '');
 }
 
+// Re-evaluates feature flags with user properties for targeting rules,
+// e.g. reloadFlags({ plan: 'pro' }).
+function reloadFlagsWith(properties: Record<string, string>): Promise<void> {
+  return reloadFlags(getDistinctId() ?? '', properties);
+}
+
 function capture(eventType: string, properties?: Record<string, unknown>): void {
   if (!initialized) return;
 
@@ -48,7 +61,12 @@ if (typeof document !== 'undefined') {
     const apiKey = script.getAttribute('data-api-key');
     const host = script.getAttribute('data-host');
     if (apiKey && host) {
-      init({ apiKey, host });
+      init({
+        apiKey,
+        host,
+        projectId: script.getAttribute('data-project') ?? undefined,
+        ingestPath: script.getAttribute('data-ingest-path') ?? undefined,
+      });
     }
   }
 }
@@ -56,11 +74,15 @@ if (typeof document !== 'undefined') {
 export default {
   init,
   capture,
+  capturePerformance,
   identify,
   resetIdentity,
   getDistinctId,
   getSessionId,
   isEnabled,
+  getFlagPayload,
+  getFlagVariant,
+  reloadFlags: reloadFlagsWith,
   flush,
   startAutocapture,
   stopAutocapture,
@@ -0,0 +1,26 @@
+const INTERNAL_KEY = '_cn_internal';
+const INTERNAL_PARAM = 'ch_internal';
+
+let internal = false;
+
+// Visiting any page with ?ch_internal=1 marks this browser as internal
+// traffic until a visit with ?ch_internal=0. The server tags its events so
+// they can be excluded from analytics.
+export function initInternalFlag(): void {
+  try {
+    const param = new URLSearchParams(window.location.search).get(INTERNAL_PARAM);
+    if (param === '1') {
+      localStorage.setItem(INTERNAL_KEY, '1');
+    } else if (param === '0') {
+      localStorage.removeItem(INTERNAL_KEY);
+    }
+    internal = localStorage.getItem(INTERNAL_KEY) === '1';
+  } catch {
+    // localStorage not available — fall back to this page's URL.
+    internal = new URLSearchParams(window.location.search).get(INTERNAL_PARAM) === '1';
+  }
+}
+
+export function isInternal(): boolean {
+  return internal;
+}
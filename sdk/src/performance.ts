@@ -0,0 +1,55 @@
+import { enqueue } from './batch';
+
+let observing = false;
+
+// Records one performance metric for the current page, e.g. ('LCP', 2450).
+export function capturePerformance(metric: string, value: number): void {
+  enqueue({
+    event_type: 'performance',
+    url: window.location.href,
+    url_path: window.location.pathname,
+    page_title: document.title,
+    timestamp: Date.now(),
+    properties: { metric, value },
+  });
+}
+
+// Observes Core Web Vitals: FID on the first input, and LCP and CLS once the
+// page is hidden, when their values are final.
+export function startPerformanceCapture(): void {
+  if (observing || typeof PerformanceObserver === 'undefined') return;
+  observing = true;
+
+  let lcp = 0;
+  let cls = 0;
+  let reported = false;
+
+  observe('largest-contentful-paint', (entries) => {
+    const last = entries[entries.length - 1];
+    if (last) lcp = last.startTime;
+  });
+  observe('layout-shift', (entries) => {
+    for (const e of entries as Array<PerformanceEntry & { value: number; hadRecentInput: boolean }>) {
+      if (!e.hadRecentInput) cls += e.value;
+    }
+  });
+  observe('first-input', (entries) => {
+    const first = entries[0] as (PerformanceEntry & { processingStart: number }) | undefined;
+    if (first) capturePerformance('FID', first.processingStart - first.startTime);
+  });
+
+  document.addEventListener('visibilitychange', () => {
+    if (document.visibilityState !== 'hidden' || reported) return;
+    reported = true;
+    if (lcp > 0) capturePerformance('LCP', lcp);
+    capturePerformance('CLS', cls);
+  });
+}
+
+function observe(type: string, cb: (entries: PerformanceEntry[]) => void): void {
+  try {
+    new PerformanceObserver((list) => cb(list.getEntries())).observe({ type, buffered: true });
+  } catch {
+    // Entry type not supported by this browser.
+  }
+}
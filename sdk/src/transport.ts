@@ -1,12 +1,17 @@
 export interface TransportConfig {
   host: string;
   apiKey: string;
+  // Project public ID; sends to /api/v1/{projectId}/events.
+  projectId?: string;
+  // Custom ingest path configured on the server (-ingest-path).
+  ingestPath?: string;
 }
 
 export interface TransportPayload {
   events: Record<string, unknown>[];
   session_id: string;
   distinct_id: string | null;
+  internal?: boolean;
 }
 
 const MAX_RETRIES = 3;
@@ -17,7 +22,7 @@ export async function send(
   payload: TransportPayload,
   retryCount = 0
 ): Promise<boolean> {
-  const url = `${config.host.replace(/\/$/, '')}/api/v1/events`;
+  const url = config.host.replace(/\/$/, '') + ingestPath(config);
 
   try {
     const resp = await fetch(url, {
@@ -48,6 +53,28 @@ export async function send(
   }
 }
 
+// beacon hands the batch to navigator.sendBeacon, which survives the page
+// being unloaded. Beacons can't carry headers, so the key goes in the query
+// string and the body is sent as text/plain. Falls back to send when the
+// browser won't queue the beacon.
+export function beacon(config: TransportConfig, payload: TransportPayload): void {
+  const url =
+    config.host.replace(/\/$/, '') +
+    ingestPath(config) +
+    '?api_key=' +
+    encodeURIComponent(config.apiKey);
+  if (typeof navigator !== 'undefined' && navigator.sendBeacon?.(url, JSON.stringify(payload))) {
+    return;
+  }
+  send(config, payload);
+}
+
+function ingestPath(config: TransportConfig): string {
+  if (config.ingestPath) return config.ingestPath;
+  if (config.projectId) return `/api/v1/${encodeURIComponent(config.projectId)}/events`;
+  return '/api/v1/events';
+}
+
 function delay(ms: number): Promise<void> {
   return new Promise((r) => setTimeout(r, ms));
 }
@@ -1,6 +1,31 @@
-import type { Event, TrendPoint, Session, EventName, Project, LLMConfig, GitHubConnection, UserProfile, Funnel, FunnelStep, FunnelResult, FunnelCohortResult, SuggestedFunnel, RetentionCohort, Dashboard, PageStat, TrendSeries, EventNameStat, ChatMessage, FeatureFlag, Alert, PathTransition, HeatmapPoint, AttributionSource, ChannelSummary, RefCode, ErrorGroup, SourceLink, ScoringRule, ScoredLead, CRMWebhook, Campaign, CampaignContent, ConnectorInfo, ICPAnalysis, ICPUserProfile, ABVariation, MeResponse } from './types';
+import type { Event, TrendPoint, Session, SessionStats, EventName, NameElement, Project, LLMConfig, GitHubConnection, UserProfile, Funnel, FunnelStep, FunnelResult, FunnelBreakdown, FunnelConverter, FunnelCohortResult, SuggestedFunnel, RetentionCohort, Dashboard, PageStat, TrendSeries, EventNameStat, ChatMessage, FeatureFlag, Alert, PathTransition, HeatmapPoint, FormFieldStat, QuotaStatus, AttributionSource, ChannelSummary, RefCode, ErrorGroup, SourceLink, ScoringRule, ScoredLead, CRMWebhook, Campaign, CampaignContent, ConnectorInfo, ICPAnalysis, ICPUserProfile, ABVariation, MeResponse, PrimaryEventKPI } from './types';
+
+// VITE_API_ORIGIN points a separately hosted dashboard at the API server
+// (which must be started with -frontend-origin); empty means same origin.
+export const BASE = `${import.meta.env.VITE_API_ORIGIN ?? ''}/api/v1`;
+
+// ApiError is thrown for non-2xx responses. code is the server's stable
+// error code ({"error":{"code","message"}}), or '' for non-JSON bodies.
+export class ApiError extends Error {
+	constructor(
+		public status: number,
+		public code: string,
+		message: string,
+	) {
+		super(message);
+	}
+}
 
-const BASE = '/api/v1';
+async function apiError(resp: Response): Promise<ApiError> {
+	const text = await resp.text();
+	try {
+		const { error } = JSON.parse(text);
+		if (error?.code) return new ApiError(resp.status, error.code, error.message);
+	} catch {
+		// not a JSON error body
+	}
+	return new ApiError(resp.status, '', `API error ${resp.status}: ${text}`);
+}
 
 async function request<T>(path: string, options?: RequestInit): Promise<T> {
 	const controller = new AbortController();
@@ -8,12 +33,12 @@ async function request<T>(path: string, options?: RequestInit): Promise<T> {
 	try {
 		const resp = await fetch(`${BASE}${path}`, {
 			headers: { 'Content-Type': 'application/json' },
+			credentials: 'include',
 			signal: controller.signal,
 			...options,
 		});
 		if (!resp.ok) {
-			const body = await resp.text();
-			throw new Error(`API error ${resp.status}: ${body}`);
+			throw await apiError(resp);
 		}
 		return resp.json();
 	} finally {
@@ -21,20 +46,52 @@ async function request<T>(path: string, options?: RequestInit): Promise<T> {
 	}
 }
 
-export async function getEvents(params?: Record<string, string>): Promise<{ events: Event[]; count: number }> {
+// Identical create requests made within a few seconds of each other (a
+// double-click, a retried submit) share an Idempotency-Key, so the server
+// returns the first resource instead of creating a duplicate.
+const IDEMPOTENCY_WINDOW_MS = 5_000;
+const recentCreates = new Map<string, { key: string; at: number }>();
+
+function create<T>(path: string, body: string): Promise<T> {
+	const now = Date.now();
+	for (const [k, v] of recentCreates) {
+		if (now - v.at > IDEMPOTENCY_WINDOW_MS) recentCreates.delete(k);
+	}
+	const id = `${path}\n${body}`;
+	let entry = recentCreates.get(id);
+	if (!entry) {
+		entry = { key: crypto.randomUUID(), at: now };
+		recentCreates.set(id, entry);
+	}
+	return request(path, {
+		method: 'POST',
+		headers: { 'Content-Type': 'application/json', 'Idempotency-Key': entry.key },
+		body,
+	});
+}
+
+export async function getEvents(params?: Record<string, string>): Promise<{ events: Event[]; count: number; next_cursor: string }> {
 	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
 	return request(`/events${qs}`);
 }
 
-export function liveEvents(onEvent: (events: Event[]) => void): () => void {
+// Set VITE_LIVE_TRANSPORT=ws when a proxy in front of the API buffers SSE.
+const LIVE_TRANSPORT = import.meta.env.VITE_LIVE_TRANSPORT ?? 'sse';
+
+export function liveEvents(onEvent: (events: Event[]) => void, onDropped?: (count: number) => void): () => void {
+	if (LIVE_TRANSPORT === 'ws') return liveEventsWS(onEvent, onDropped);
 	let source: EventSource | null = null;
 	let timer: ReturnType<typeof setTimeout> | null = null;
 	let stopped = false;
+	let lastEventId = '';
 
 	function connect() {
 		if (stopped) return;
-		source = new EventSource(`${BASE}/events/live`);
+		// A fresh EventSource doesn't carry Last-Event-ID, so pass it explicitly.
+		const qs = lastEventId ? `?last_event_id=${encodeURIComponent(lastEventId)}` : '';
+		source = new EventSource(`${BASE}/events/live${qs}`, { withCredentials: true });
 		source.onmessage = (e) => {
+			if (e.lastEventId) lastEventId = e.lastEventId;
 			try {
 				const events: Event[] = JSON.parse(e.data);
 				onEvent(events);
@@ -42,6 +99,13 @@ export function liveEvents(onEvent: (events: Event[]) => void): () => void {
 				// ignore parse errors
 			}
 		};
+		source.addEventListener('dropped', (e) => {
+			try {
+				onDropped?.(JSON.parse((e as MessageEvent).data).dropped);
+			} catch {
+				// ignore parse errors
+			}
+		});
 		source.onerror = () => {
 			// Close the broken connection and reconnect with backoff
 			// to avoid exhausting Chrome's 6-connection-per-origin limit.
@@ -62,6 +126,50 @@ export function liveEvents(onEvent: (events: Event[]) => void): () => void {
 	};
 }
 
+// liveEventsWS is liveEvents over GET /events/ws. Messages are
+// { type, id, data } with the same payloads as the SSE events.
+function liveEventsWS(onEvent: (events: Event[]) => void, onDropped?: (count: number) => void): () => void {
+	let socket: WebSocket | null = null;
+	let timer: ReturnType<typeof setTimeout> | null = null;
+	let stopped = false;
+	let lastEventId = '';
+
+	function connect() {
+		if (stopped) return;
+		const qs = lastEventId ? `?last_event_id=${encodeURIComponent(lastEventId)}` : '';
+		const url = new URL(`${BASE}/events/ws${qs}`, window.location.href);
+		url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:';
+		socket = new WebSocket(url);
+		socket.onmessage = (e) => {
+			try {
+				const msg = JSON.parse(e.data);
+				if (msg.type === 'events') {
+					if (msg.id) lastEventId = msg.id;
+					onEvent(msg.data as Event[]);
+				} else if (msg.type === 'dropped') {
+					onDropped?.(msg.data.dropped);
+				}
+			} catch {
+				// ignore parse errors
+			}
+		};
+		socket.onclose = () => {
+			socket = null;
+			if (!stopped) {
+				timer = setTimeout(connect, 5_000);
+			}
+		};
+	}
+
+	connect();
+
+	return () => {
+		stopped = true;
+		if (timer) clearTimeout(timer);
+		socket?.close();
+	};
+}
+
 export async function getTrends(params?: Record<string, string>): Promise<{ data: TrendPoint[]; interval: string }> {
 	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
 	return request(`/trends${qs}`);
@@ -72,6 +180,11 @@ export async function getSessions(params?: Record<string, string>): Promise<{ se
 	return request(`/sessions${qs}`);
 }
 
+export async function getSessionStats(params?: Record<string, string>): Promise<SessionStats> {
+	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
+	return request(`/sessions/stats${qs}`);
+}
+
 export async function getSessionDetail(id: string): Promise<{ session_id: string; events: Event[]; count: number }> {
 	return request(`/sessions/${id}`);
 }
@@ -80,6 +193,10 @@ export async function getNames(): Promise<{ names: EventName[] }> {
 	return request('/names');
 }
 
+export async function getNameElement(fingerprint: string): Promise<NameElement> {
+	return request(`/names/${fingerprint}/element`);
+}
+
 export async function overrideName(fingerprint: string, name: string): Promise<void> {
 	await request(`/names/${fingerprint}`, {
 		method: 'PUT',
@@ -91,6 +208,43 @@ export async function getProject(): Promise<Project> {
 	return request('/project');
 }
 
+export async function getOverview(): Promise<{ primary_event: PrimaryEventKPI | null }> {
+	return request('/overview');
+}
+
+export async function getPrimaryEvent(): Promise<{ event_name: string }> {
+	return request('/settings/primary-event');
+}
+
+export async function setPrimaryEvent(eventName: string): Promise<void> {
+	await request('/settings/primary-event', {
+		method: 'PUT',
+		body: JSON.stringify({ event_name: eventName }),
+	});
+}
+
+export async function getInternalTraffic(): Promise<import('./types').InternalTrafficRule> {
+	return request('/settings/internal-traffic');
+}
+
+export async function setInternalTraffic(rule: import('./types').InternalTrafficRule): Promise<void> {
+	await request('/settings/internal-traffic', {
+		method: 'PUT',
+		body: JSON.stringify(rule),
+	});
+}
+
+export async function getTimezone(): Promise<{ timezone: string }> {
+	return request('/settings/timezone');
+}
+
+export async function setTimezone(timezone: string): Promise<void> {
+	await request('/settings/timezone', {
+		method: 'PUT',
+		body: JSON.stringify({ timezone }),
+	});
+}
+
 export async function updateProjectDescription(description: string): Promise<void> {
 	await request('/project/description', {
 		method: 'PUT',
@@ -138,6 +292,11 @@ export async function getPropertyValues(key: string): Promise<{ values: string[]
 	return request(`/properties/values?key=${encodeURIComponent(key)}`);
 }
 
+export async function getPropertyBreakdown(key: string, params?: Record<string, string>): Promise<{ key: string; values: { value: string | null; count: number }[] }> {
+	const qs = new URLSearchParams({ ...params, key }).toString();
+	return request(`/breakdown/property?${qs}`);
+}
+
 // Users
 export async function getUsers(params?: Record<string, string>): Promise<{ users: UserProfile[]; total: number }> {
 	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
@@ -154,11 +313,8 @@ export async function listFunnels(): Promise<{ funnels: Funnel[] }> {
 	return request('/funnels');
 }
 
-export async function createFunnel(name: string, steps: FunnelStep[]): Promise<Funnel> {
-	return request('/funnels', {
-		method: 'POST',
-		body: JSON.stringify({ name, steps }),
-	});
+export async function createFunnel(name: string, steps: FunnelStep[], windowHours = 0, mode: Funnel['mode'] = 'ordered'): Promise<Funnel> {
+	return create('/funnels', JSON.stringify({ name, steps, window_hours: windowHours, mode }));
 }
 
 export async function getFunnel(id: string): Promise<Funnel> {
@@ -169,11 +325,23 @@ export async function deleteFunnel(id: string): Promise<void> {
 	await request(`/funnels/${id}`, { method: 'DELETE' });
 }
 
-export async function getFunnelResults(id: string, params?: Record<string, string>): Promise<{ results: FunnelResult[] }> {
+export async function updateFunnel(id: string, name: string, steps: FunnelStep[], windowHours = 0, mode: Funnel['mode'] = 'ordered'): Promise<Funnel> {
+	return request(`/funnels/${id}`, {
+		method: 'PUT',
+		body: JSON.stringify({ name, steps, window_hours: windowHours, mode }),
+	});
+}
+
+export async function getFunnelResults(id: string, params?: Record<string, string>): Promise<{ results: FunnelResult[]; window_hours: number; mode: Funnel['mode']; breakdown?: FunnelBreakdown[]; breakdown_property?: string }> {
 	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
 	return request(`/funnels/${id}/results${qs}`);
 }
 
+export async function getFunnelConverters(id: string, params?: Record<string, string>): Promise<{ converters: FunnelConverter[]; total: number; limit: number; offset: number }> {
+	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
+	return request(`/funnels/${id}/converters${qs}`);
+}
+
 export async function getFunnelCohorts(id: string, params?: Record<string, string>): Promise<{ cohorts: FunnelCohortResult[] }> {
 	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
 	return request(`/funnels/${id}/cohorts${qs}`);
@@ -184,13 +352,13 @@ export async function suggestFunnels(): Promise<{ suggestions: SuggestedFunnel[]
 	const timeout = setTimeout(() => controller.abort(), 30_000);
 	try {
 		const resp = await fetch(`${BASE}/funnels/suggest`, {
+			credentials: 'include',
 			method: 'POST',
 			headers: { 'Content-Type': 'application/json' },
 			signal: controller.signal,
 		});
 		if (!resp.ok) {
-			const body = await resp.text();
-			throw new Error(`API error ${resp.status}: ${body}`);
+			throw await apiError(resp);
 		}
 		return resp.json();
 	} finally {
@@ -208,6 +376,13 @@ export async function getEventStats(params?: Record<string, string>): Promise<{
 	return request(`/events/stats${qs}`);
 }
 
+export async function runSQL(sql: string, limit = 1000): Promise<{ columns: string[]; rows: unknown[][]; truncated: boolean; limit: number }> {
+	return request('/query/sql', {
+		method: 'POST',
+		body: JSON.stringify({ sql, limit }),
+	});
+}
+
 export async function getTrendsBreakdown(params?: Record<string, string>): Promise<{ series: TrendSeries[]; interval: string; group_by: string }> {
 	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
 	return request(`/trends/breakdown${qs}`);
@@ -219,14 +394,14 @@ export async function aiChat(message: string, history: ChatMessage[]): Promise<{
 	const timeout = setTimeout(() => controller.abort(), 60_000);
 	try {
 		const resp = await fetch(`${BASE}/ai/chat`, {
+			credentials: 'include',
 			method: 'POST',
 			headers: { 'Content-Type': 'application/json' },
 			body: JSON.stringify({ message, history }),
 			signal: controller.signal,
 		});
 		if (!resp.ok) {
-			const body = await resp.text();
-			throw new Error(`API error ${resp.status}: ${body}`);
+			throw await apiError(resp);
 		}
 		return resp.json();
 	} finally {
@@ -234,6 +409,63 @@ export async function aiChat(message: string, history: ChatMessage[]): Promise<{
 	}
 }
 
+// aiChatStream is aiChat with the reply streamed: onDelta gets each piece as
+// the model writes it, and the full reply is returned at the end. The stream
+// is server-sent events in OpenAI's chat.completion.chunk format.
+export async function aiChatStream(message: string, history: ChatMessage[], onDelta: (text: string) => void): Promise<{ reply: string }> {
+	const controller = new AbortController();
+	const timeout = setTimeout(() => controller.abort(), 60_000);
+	try {
+		const resp = await fetch(`${BASE}/ai/chat`, {
+			credentials: 'include',
+			method: 'POST',
+			headers: { 'Content-Type': 'application/json', Accept: 'text/event-stream' },
+			body: JSON.stringify({ message, history, stream: true }),
+			signal: controller.signal,
+		});
+		if (!resp.ok || !resp.body) {
+			throw await apiError(resp);
+		}
+		const reader = resp.body.pipeThrough(new TextDecoderStream()).getReader();
+		let buffer = '';
+		let reply = '';
+		for (;;) {
+			const { value, done } = await reader.read();
+			if (done) break;
+			buffer += value;
+			const frames = buffer.split('\n\n');
+			buffer = frames.pop() ?? '';
+			for (const frame of frames) {
+				const data = frame.startsWith('data: ') ? frame.slice(6) : '';
+				if (!data || data === '[DONE]') continue;
+				const chunk = JSON.parse(data);
+				if (chunk.error) throw new ApiError(resp.status, chunk.error.code, chunk.error.message);
+				const text: string = chunk.choices?.[0]?.delta?.content ?? '';
+				if (text) {
+					reply += text;
+					onDelta(text);
+				}
+			}
+		}
+		return { reply: reply.trim() };
+	} finally {
+		clearTimeout(timeout);
+	}
+}
+
+export interface Insight {
+	kind: 'spike' | 'drop' | 'funnel_dropoff' | 'trend' | 'other';
+	severity: 'info' | 'warning' | 'critical';
+	title: string;
+	detail: string;
+	metric?: string;
+}
+
+// AI insights are cached server-side for an hour; refresh regenerates them.
+export async function getInsights(refresh = false): Promise<{ insights: Insight[]; generated_at: string; cached: boolean }> {
+	return request(`/ai/insights${refresh ? '?refresh=true' : ''}`, { method: 'POST' });
+}
+
 // Retention
 export async function getRetention(params?: Record<string, string>): Promise<{ cohorts: RetentionCohort[] }> {
 	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
@@ -246,10 +478,7 @@ export async function listDashboards(): Promise<{ dashboards: Dashboard[] }> {
 }
 
 export async function createDashboard(name: string, config: Record<string, unknown>): Promise<Dashboard> {
-	return request('/dashboards', {
-		method: 'POST',
-		body: JSON.stringify({ name, config }),
-	});
+	return create('/dashboards', JSON.stringify({ name, config }));
 }
 
 export async function getDashboard(id: string): Promise<Dashboard> {
@@ -283,10 +512,21 @@ export async function listFlags(): Promise<{ flags: FeatureFlag[] }> {
 	return request('/flags');
 }
 
-export async function createFlag(key: string, name: string, rolloutPercentage = 100): Promise<FeatureFlag> {
+export interface FlagCondition {
+	property: string;
+	operator: 'is' | 'is_not' | 'contains';
+	value: string;
+}
+
+export interface FlagVariant {
+	key: string;
+	weight: number;
+}
+
+export async function createFlag(key: string, name: string, rolloutPercentage = 100, conditions: FlagCondition[] = [], payload?: unknown, variants: FlagVariant[] = []): Promise<FeatureFlag> {
 	return request('/flags', {
 		method: 'POST',
-		body: JSON.stringify({ key, name, rollout_percentage: rolloutPercentage }),
+		body: JSON.stringify({ key, name, rollout_percentage: rolloutPercentage, conditions, payload, variants }),
 	});
 }
 
@@ -307,10 +547,7 @@ export async function listAlerts(): Promise<{ alerts: Alert[] }> {
 }
 
 export async function createAlert(data: Omit<Alert, 'id' | 'project_id' | 'created_at' | 'last_triggered_at'>): Promise<Alert> {
-	return request('/alerts', {
-		method: 'POST',
-		body: JSON.stringify(data),
-	});
+	return create('/alerts', JSON.stringify(data));
 }
 
 export async function updateAlert(id: string, enabled: boolean, threshold: number, webhookUrl: string): Promise<void> {
@@ -336,6 +573,24 @@ export async function getHeatmap(params?: Record<string, string>): Promise<{ poi
 	return request(`/heatmap${qs}`);
 }
 
+// Form field engagement for the form on a page path (e.g. /signup).
+export async function getFormFields(path: string, params?: Record<string, string>): Promise<{ path: string; fields: FormFieldStat[] }> {
+	const qs = params ? '?' + new URLSearchParams(params).toString() : '';
+	return request(`/forms/${encodeURIComponent(path)}/fields${qs}`);
+}
+
+// Monthly event quota (0 = unlimited) and this month's usage.
+export async function getQuota(): Promise<QuotaStatus> {
+	return request('/admin/quota');
+}
+
+export async function setQuota(monthlyEventQuota: number, projectId?: string): Promise<void> {
+	await request('/admin/quota', {
+		method: 'PUT',
+		body: JSON.stringify({ monthly_event_quota: monthlyEventQuota, project_id: projectId }),
+	});
+}
+
 // Backup / restore
 export function exportBackupURL(): string {
 	return `${BASE}/export`;
@@ -344,7 +599,7 @@ export function exportBackupURL(): string {
 export async function importBackup(file: File): Promise<{ status: string; message: string }> {
 	const form = new FormData();
 	form.append('backup', file);
-	const resp = await fetch(`${BASE}/import`, { method: 'POST', body: form });
+	const resp = await fetch(`${BASE}/import`, { method: 'POST', body: form, credentials: 'include' });
 	if (!resp.ok) {
 		const body = await resp.text();
 		throw new Error(`Import failed: ${body}`);
@@ -472,14 +727,14 @@ export async function generateCampaign(channel: string, topic: string): Promise<
 	const timeout = setTimeout(() => controller.abort(), 60_000);
 	try {
 		const resp = await fetch(`${BASE}/campaigns/generate`, {
+			credentials: 'include',
 			method: 'POST',
 			headers: { 'Content-Type': 'application/json' },
 			body: JSON.stringify({ channel, topic }),
 			signal: controller.signal,
 		});
 		if (!resp.ok) {
-			const body = await resp.text();
-			throw new Error(`API error ${resp.status}: ${body}`);
+			throw await apiError(resp);
 		}
 		return resp.json();
 	} finally {
@@ -492,13 +747,13 @@ export async function createABTest(campaignId: string): Promise<{ variations: AB
 	const timeout = setTimeout(() => controller.abort(), 60_000);
 	try {
 		const resp = await fetch(`${BASE}/campaigns/${campaignId}/ab-test`, {
+			credentials: 'include',
 			method: 'POST',
 			headers: { 'Content-Type': 'application/json' },
 			signal: controller.signal,
 		});
 		if (!resp.ok) {
-			const body = await resp.text();
-			throw new Error(`API error ${resp.status}: ${body}`);
+			throw await apiError(resp);
 		}
 		return resp.json();
 	} finally {
@@ -539,14 +794,14 @@ export async function analyzeICP(conversionPaths: string[]): Promise<{ analysis:
 	const timeout = setTimeout(() => controller.abort(), 60_000);
 	try {
 		const resp = await fetch(`${BASE}/icp/analyze`, {
+			credentials: 'include',
 			method: 'POST',
 			headers: { 'Content-Type': 'application/json' },
 			body: JSON.stringify({ conversion_paths: conversionPaths }),
 			signal: controller.signal,
 		});
 		if (!resp.ok) {
-			const body = await resp.text();
-			throw new Error(`API error ${resp.status}: ${body}`);
+			throw await apiError(resp);
 		}
 		return resp.json();
 	} finally {
@@ -639,13 +894,13 @@ export async function draftMentionReply(id: string): Promise<{ reply: string }>
 	const t = setTimeout(() => controller.abort(), 30_000);
 	try {
 		const resp = await fetch(`${BASE}/mentions/${id}/draft`, {
+			credentials: 'include',
 			method: 'POST',
 			headers: { 'Content-Type': 'application/json' },
 			signal: controller.signal,
 		});
 		if (!resp.ok) {
-			const b = await resp.text();
-			throw new Error(`API error ${resp.status}: ${b}`);
+			throw await apiError(resp);
 		}
 		return resp.json();
 	} finally {
@@ -751,15 +1006,15 @@ export async function icpGenerateCampaign(
 	const controller = new AbortController();
 	const timeout = setTimeout(() => controller.abort(), 60_000);
 	try {
-		const resp = await fetch(`/api/v1/icp/analyses/${analysisId}/generate-campaign`, {
+		const resp = await fetch(`${BASE}/icp/analyses/${analysisId}/generate-campaign`, {
+			credentials: 'include',
 			method: 'POST',
 			headers: { 'Content-Type': 'application/json' },
 			body: JSON.stringify({ channel }),
 			signal: controller.signal,
 		});
 		if (!resp.ok) {
-			const b = await resp.text();
-			throw new Error(`API error ${resp.status}: ${b}`);
+			throw await apiError(resp);
 		}
 		return resp.json();
 	} finally {
@@ -799,6 +1054,25 @@ export async function getSegmentMembers(id: string): Promise<{ members: import('
 	return request(`/segments/${id}/members`);
 }
 
+export async function compareSegments(params: Record<string, string>): Promise<import('./types').SegmentComparison> {
+	const qs = new URLSearchParams(params).toString();
+	return request(`/compare?${qs}`);
+}
+
+// --- Widgets ---
+
+export async function listWidgets(): Promise<{ widgets: import('./types').Widget[] }> {
+	return request('/widgets');
+}
+
+export async function createWidget(data: { name: string; metric: string; event_name?: string; window_days?: number }): Promise<import('./types').Widget> {
+	return request('/widgets', { method: 'POST', body: JSON.stringify(data) });
+}
+
+export async function deleteWidget(id: string): Promise<void> {
+	await request(`/widgets/${id}`, { method: 'DELETE' });
+}
+
 // --- ICP settings ---
 
 export async function getICPSettings(): Promise<{ icp_auto_refresh: boolean }> {
@@ -39,6 +39,18 @@ export interface Session {
 	first_seen: string;
 	last_seen: string;
 	entry_url: string;
+	exit_url?: string;
+	referrer?: string;
+	duration_seconds: number;
+	bounced: boolean;
+	client_sessions?: number; // set on stitched sessions (?stitch=true)
+}
+
+export interface SessionStats {
+	total_sessions: number;
+	avg_duration_seconds: number;
+	bounce_rate: number;
+	avg_events_per_session: number;
 }
 
 export interface EventName {
@@ -48,17 +60,41 @@ export interface EventName {
 	user_name?: string;
 	source_file?: string;
 	confidence?: number;
+	status?: string;
+	low_confidence?: boolean;
 	created_at: string;
 }
 
+export interface NameElement {
+	fingerprint: string;
+	event_type: string;
+	element_tag: string;
+	element_id: string;
+	element_classes: string;
+	element_text: string;
+	aria_label: string;
+	parent_path: string;
+	url: string;
+	url_path: string;
+	page_title: string;
+}
+
 export interface Project {
 	id: string;
 	name: string;
 	description: string;
 	api_key: string;
+	public_id: string;
 	created_at: string;
 }
 
+export interface PrimaryEventKPI {
+	event_name: string;
+	total: number;
+	previous_total: number;
+	trend: TrendPoint[];
+}
+
 export interface LLMConfig {
 	project_id: string;
 	provider: string;
@@ -88,6 +124,8 @@ export interface Funnel {
 	project_id: string;
 	name: string;
 	steps: string;
+	window_hours: number; // conversion window; 0 = unbounded
+	mode: 'ordered' | 'unordered';
 	created_at: string;
 }
 
@@ -103,6 +141,17 @@ export interface FunnelResult {
 	count: number;
 }
 
+export interface FunnelConverter {
+	session_id: string;
+	distinct_id?: string;
+	completed_at: string;
+}
+
+export interface FunnelBreakdown {
+	value: string | null; // null for sessions without the property
+	steps: FunnelResult[];
+}
+
 export interface FunnelCohortStep {
 	step: string;
 	count: number;
@@ -130,6 +179,7 @@ export interface PageStat {
 	title: string;
 	views: number;
 	sessions: number;
+	sparkline?: number[]; // daily counts, with ?sparkline=true
 }
 
 export interface TrendSeries {
@@ -140,7 +190,10 @@ export interface TrendSeries {
 export interface EventNameStat {
 	name: string;
 	count: number;
+	unique_sessions: number;
+	unique_users: number;
 	last_seen: string;
+	sparkline?: number[]; // daily counts, with ?sparkline=true
 }
 
 export interface ChatMessage {
@@ -164,6 +217,9 @@ export interface FeatureFlag {
 	name: string;
 	enabled: boolean;
 	rollout_percentage: number;
+	conditions?: string; // JSON array of { property, operator, value }
+	payload?: string; // JSON value returned when the flag is on
+	variants?: string; // JSON array of { key, weight }
 	created_at: string;
 	updated_at: string;
 }
@@ -178,6 +234,8 @@ export interface Alert {
 	window_minutes: number;
 	webhook_url: string;
 	enabled: boolean;
+	secret?: string;
+	format?: 'json' | 'slack';
 	last_triggered_at?: string;
 	created_at: string;
 }
@@ -194,6 +252,26 @@ export interface HeatmapPoint {
 	count: number;
 }
 
+export interface FormFieldStat {
+	field: string;
+	element_id?: string;
+	name?: string;
+	label?: string;
+	interactions: number;
+	sessions: number;
+	avg_order: number;
+	drop_offs: number;
+	drop_off_rate: number;
+}
+
+export interface QuotaStatus {
+	monthly_event_quota: number; // 0 = unlimited
+	month: string;
+	used: number;
+	remaining: number | null;
+	resets_at: string;
+}
+
 export interface ErrorGroup {
 	message: string;
 	error_type: string;
@@ -533,3 +611,36 @@ export interface ExperimentResults {
 	sample_size_needed: number;
 	winner?: string;
 }
+
+export interface InternalTrafficRule {
+	exclude: boolean;
+	ip_ranges: string[];
+	distinct_ids: string[];
+}
+
+export interface Widget {
+	id: string;
+	project_id: string;
+	name: string;
+	metric: 'events' | 'pageviews' | 'errors';
+	event_name?: string;
+	window_days: number;
+	created_at: string;
+	token: string;
+	embed_url: string;
+}
+
+export interface SegmentComparisonSide {
+	segment_id: string;
+	name: string;
+	members: number;
+	value: number;
+}
+
+export interface SegmentComparison {
+	metric: string;
+	a: SegmentComparisonSide;
+	b: SegmentComparisonSide;
+	delta: number;
+	delta_pct: number | null;
+}